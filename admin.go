@@ -0,0 +1,96 @@
+package kite
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DisconnectArgs are the arguments of the kite.admin.disconnect method.
+type DisconnectArgs struct {
+	// KiteID is the ID of the kite to disconnect.
+	KiteID string `json:"kiteID"`
+
+	// Reason is the name of the reason sent to the kite, "kicked" (the
+	// default) prevents it from reconnecting, "shutdown" drains it - lets
+	// it reconnect, e.g. to another instance. See CloseReason.
+	Reason string `json:"reason,omitempty"`
+}
+
+// DisconnectResult is the reply of the kite.admin.disconnect method.
+type DisconnectResult struct {
+	Disconnected int `json:"disconnected"`
+}
+
+// closeReasons are the reasons accepted by kite.admin.disconnect.
+var closeReasons = map[string]*CloseReason{
+	CloseShutdown.Reason:    CloseShutdown,
+	CloseAuthExpired.Reason: CloseAuthExpired,
+	CloseKicked.Reason:      CloseKicked,
+	CloseOverloaded.Reason:  CloseOverloaded,
+}
+
+// Disconnect closes all the connections made to the kite by the remote kite
+// with the given ID, sending the reason to it. A nil reason defaults to
+// CloseKicked. It returns the number of closed connections.
+func (k *Kite) Disconnect(kiteID string, reason *CloseReason) int {
+	if reason == nil {
+		reason = CloseKicked
+	}
+
+	k.connsMu.Lock()
+	var conns []*Client
+	for c := range k.conns {
+		c.m.RLock()
+		id := c.Kite.ID
+		c.m.RUnlock()
+
+		if id == kiteID {
+			conns = append(conns, c)
+		}
+	}
+	k.connsMu.Unlock()
+
+	for _, c := range conns {
+		k.Log.Info("Disconnecting %s with reason %q", kiteID, reason)
+		c.CloseWithReason(reason)
+	}
+
+	return len(conns)
+}
+
+// handleDisconnect disconnects the given kite, it can be called only by
+// the owner of the kite.
+func (k *Kite) handleDisconnect(r *Request) (interface{}, error) {
+	if r.Username != k.Config.Username {
+		return nil, &Error{
+			Type:    "authenticationError",
+			Message: fmt.Sprintf("%q is not allowed to disconnect kites", r.Username),
+		}
+	}
+
+	if r.Args == nil {
+		return nil, errors.New("empty arguments")
+	}
+
+	var args DisconnectArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if args.KiteID == "" {
+		return nil, errors.New("empty kite ID")
+	}
+
+	reason := CloseKicked
+	if args.Reason != "" {
+		var ok bool
+		if reason, ok = closeReasons[args.Reason]; !ok {
+			return nil, fmt.Errorf("unknown reason %q", args.Reason)
+		}
+	}
+
+	return &DisconnectResult{
+		Disconnected: k.Disconnect(args.KiteID, reason),
+	}, nil
+}
@@ -0,0 +1,68 @@
+package kite
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+
+	"github.com/koding/kite/dnode"
+)
+
+func TestKite_HandleDisconnect(t *testing.T) {
+	k := New("admin", "0.0.1")
+	k.Config.Username = "devrim"
+	defer k.Close()
+
+	stale := k.NewClient("")
+	stale.Kite.ID = "stale"
+
+	other := k.NewClient("")
+	other.Kite.ID = "other"
+
+	k.conns = map[*Client]struct{}{stale: {}, other: {}}
+
+	args := func(v interface{}) *dnode.Partial {
+		p, err := json.Marshal([]interface{}{v})
+		if err != nil {
+			t.Fatalf("Marshal()=%s", err)
+		}
+
+		return &dnode.Partial{Raw: p}
+	}
+
+	r := &Request{
+		LocalKite: k,
+		Username:  "mallory",
+		Args:      args(DisconnectArgs{KiteID: "stale"}),
+	}
+
+	if _, err := k.handleDisconnect(r); err == nil {
+		t.Fatal("want other users to be refused")
+	}
+
+	r.Username = "devrim"
+	r.Args = args(DisconnectArgs{KiteID: "stale", Reason: "unknown"})
+
+	if _, err := k.handleDisconnect(r); err == nil {
+		t.Fatal("want unknown reasons to be refused")
+	}
+
+	r.Args = args(DisconnectArgs{KiteID: "stale", Reason: "shutdown"})
+
+	res, err := k.handleDisconnect(r)
+	if err != nil {
+		t.Fatalf("handleDisconnect()=%s", err)
+	}
+
+	if n := res.(*DisconnectResult).Disconnected; n != 1 {
+		t.Fatalf("got %d disconnected, want 1", n)
+	}
+
+	if stale.closeReason() != CloseShutdown {
+		t.Fatalf("got %v, want %v", stale.closeReason(), CloseShutdown)
+	}
+
+	if atomic.LoadInt32(&other.closed) != 0 {
+		t.Fatal("want other kites to stay connected")
+	}
+}
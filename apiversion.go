@@ -0,0 +1,136 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+type apiVersionKey struct{}
+
+// WithAPIVersion returns a copy of ctx that requests the given version of
+// the called methods. Calls made with Client.TellWithContext are served by
+// the implementation registered for the version with Kite.HandleVersion.
+func WithAPIVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, apiVersionKey{}, version)
+}
+
+func apiVersionFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	version, _ := ctx.Value(apiVersionKey{}).(string)
+	return version
+}
+
+// HandleVersion registers the handler as the implementation of the given
+// version of the method, e.g. "v2" of "fs.readFile". Callers choose the
+// version with WithAPIVersion, so the contract of a method can evolve
+// without introducing new method names.
+//
+// Calls which do not request any version are served by the handler
+// registered with Handle, or by the latest version if there is none.
+//
+// The returned *Method configures the given version only.
+func (k *Kite) HandleVersion(method, version string, handler Handler) *Method {
+	k.methodsMu.Lock()
+	defer k.methodsMu.Unlock()
+
+	base, ok := k.handlers[method]
+	if !ok {
+		base = &Method{name: method}
+		k.handlers[method] = base
+	}
+
+	m := k.newMethod(method, handler)
+	m.version = version
+
+	if base.versions == nil {
+		base.versions = make(map[string]*Method)
+	}
+
+	base.versions[version] = m
+
+	return m
+}
+
+// HandleFuncVersion is the same as HandleVersion. It accepts a HandlerFunc.
+func (k *Kite) HandleFuncVersion(method, version string, handler HandlerFunc) *Method {
+	return k.HandleVersion(method, version, handler)
+}
+
+// resolveVersion gives the implementation of the method, which serves the
+// version requested by the caller.
+func (m *Method) resolveVersion(r *Request) (*Method, *Error) {
+	if len(m.versions) == 0 {
+		if r.APIVersion != "" && m.version != r.APIVersion {
+			return nil, m.unsupportedVersion(r)
+		}
+
+		return m, nil
+	}
+
+	resolved := m
+
+	switch {
+	case r.APIVersion != "":
+		v, ok := m.versions[r.APIVersion]
+		if !ok {
+			return nil, m.unsupportedVersion(r)
+		}
+
+		resolved = v
+	case m.handler == nil:
+		versions := m.versionNames()
+		resolved = m.versions[versions[len(versions)-1]]
+	}
+
+	r.APIVersion = resolved.version
+
+	if resolved.version != "" {
+		r.SetMetadata("apiVersion", resolved.version)
+	}
+
+	return resolved, nil
+}
+
+func (m *Method) unsupportedVersion(r *Request) *Error {
+	return &Error{
+		Type: "unsupportedVersion",
+		Message: fmt.Sprintf("method %q does not support version %q, supported versions: %s",
+			m.name, r.APIVersion, strings.Join(m.versionNames(), ", ")),
+		RequestID: r.ID,
+	}
+}
+
+// versionNames gives the versions of the method, from the oldest to the
+// latest one.
+func (m *Method) versionNames() []string {
+	names := make([]string, 0, len(m.versions))
+	for name := range m.versions {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return versionLess(names[i], names[j])
+	})
+
+	return names
+}
+
+// versionLess compares versions semantically, e.g. "v2" < "v10", falling
+// back to comparing them as strings.
+func versionLess(a, b string) bool {
+	va, errA := version.NewVersion(a)
+	vb, errB := version.NewVersion(b)
+
+	if errA != nil || errB != nil {
+		return a < b
+	}
+
+	return va.LessThan(vb)
+}
@@ -0,0 +1,177 @@
+package kite
+
+import (
+	"fmt"
+	"path"
+)
+
+// ACL restricts which users can call the methods of the kite, see SetACL.
+//
+//     k.SetACL(&kite.ACL{
+//         Roles: map[string][]string{
+//             "admin": {"alice", "bob"},
+//         },
+//         Rules: []kite.ACLRule{
+//             {Roles: []string{"admin"}, Methods: []string{"kite.admin.*", "deploy"}},
+//             {Users: []string{"*"}, Methods: []string{"status"}},
+//         },
+//     })
+type ACL struct {
+	// Roles maps role names to the usernames having them.
+	Roles map[string][]string
+
+	// Rules are the methods the users and roles are allowed to call.
+	Rules []ACLRule
+
+	// DenyUnlisted rejects calls of the methods, which are not matched by
+	// any of the rules. By default they are allowed to everyone.
+	DenyUnlisted bool
+}
+
+// ACLRule allows the users, and the users having any of the roles, to call
+// the methods.
+type ACLRule struct {
+	// Users are the allowed usernames, "*" allows everyone.
+	Users []string
+
+	// Roles are the allowed roles, see ACL.Roles.
+	Roles []string
+
+	// Methods are the names of the methods, they can be patterns with
+	// the syntax of path.Match, like "kite.admin.*".
+	Methods []string
+}
+
+func (rule *ACLRule) matchMethod(method string) bool {
+	for _, pattern := range rule.Methods {
+		if ok, _ := path.Match(pattern, method); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rule *ACLRule) allows(username string, roles map[string]bool) bool {
+	for _, u := range rule.Users {
+		if u == "*" || u == username {
+			return true
+		}
+	}
+
+	for _, role := range rule.Roles {
+		if roles[role] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// roles gives the roles of the user.
+func (acl *ACL) roles(username string) map[string]bool {
+	roles := make(map[string]bool)
+
+	for role, users := range acl.Roles {
+		for _, u := range users {
+			if u == username {
+				roles[role] = true
+				break
+			}
+		}
+	}
+
+	return roles
+}
+
+// Allowed tells whether the user is allowed to call the method.
+func (acl *ACL) Allowed(username, method string) bool {
+	var (
+		listed bool
+		roles  map[string]bool
+	)
+
+	for i := range acl.Rules {
+		rule := &acl.Rules[i]
+
+		if !rule.matchMethod(method) {
+			continue
+		}
+
+		listed = true
+
+		if roles == nil {
+			roles = acl.roles(username)
+		}
+
+		if rule.allows(username, roles) {
+			return true
+		}
+	}
+
+	return !listed && !acl.DenyUnlisted
+}
+
+// SetACL restricts the calls of the methods to the users allowed by
+// the ACL, the other calls are rejected with an "authorizationError" error.
+// A nil ACL removes the restrictions.
+//
+// The usernames of the calls of methods with the authentication disabled
+// are sent by the callers and are not verified.
+func (k *Kite) SetACL(acl *ACL) {
+	k.authzMu.Lock()
+	k.acl = acl
+	k.authzMu.Unlock()
+}
+
+// Authorize adds a function, which tells whether the authenticated request
+// is allowed, by returning a nil error. Unlike the authenticators, which
+// tell who the caller is, the authorizers tell what the caller can do, e.g.
+// with the username and the tenant of the request. The calls are rejected
+// if any of the authorizers or the ACL of the kite rejects them.
+//
+// Errors other than *Error are sent as "authorizationError" errors.
+func (k *Kite) Authorize(fn func(*Request) error) {
+	k.authzMu.Lock()
+	k.authorizers = append(k.authorizers, fn)
+	k.authzMu.Unlock()
+}
+
+// authorize checks the request against the ACL and the authorizers of
+// the kite. It returns a non-nil error if the request is not allowed.
+func (k *Kite) authorize(r *Request) *Error {
+	k.authzMu.RLock()
+	acl, authorizers := k.acl, k.authorizers
+	k.authzMu.RUnlock()
+
+	if acl != nil && !acl.Allowed(r.Username, r.Method) {
+		return &Error{
+			Type:      "authorizationError",
+			Message:   fmt.Sprintf("%q is not allowed to call %q", r.Username, r.Method),
+			RequestID: r.ID,
+		}
+	}
+
+	for _, fn := range authorizers {
+		err := fn(r)
+		if err == nil {
+			continue
+		}
+
+		if kiteErr, ok := err.(*Error); ok {
+			if kiteErr.RequestID == "" {
+				kiteErr.RequestID = r.ID
+			}
+
+			return kiteErr
+		}
+
+		return &Error{
+			Type:      "authorizationError",
+			Message:   err.Error(),
+			RequestID: r.ID,
+		}
+	}
+
+	return nil
+}
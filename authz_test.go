@@ -0,0 +1,86 @@
+package kite
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestACL_Allowed(t *testing.T) {
+	acl := &ACL{
+		Roles: map[string][]string{
+			"admin": {"alice"},
+		},
+		Rules: []ACLRule{
+			{Roles: []string{"admin"}, Methods: []string{"kite.admin.*", "deploy"}},
+			{Users: []string{"bob"}, Methods: []string{"deploy"}},
+			{Users: []string{"*"}, Methods: []string{"status"}},
+		},
+	}
+
+	cases := []struct {
+		username string
+		method   string
+		allowed  bool
+	}{
+		{"alice", "kite.admin.disconnect", true},
+		{"alice", "deploy", true},
+		{"bob", "deploy", true},
+		{"bob", "kite.admin.disconnect", false},
+		{"carol", "deploy", false},
+		{"carol", "status", true},
+		{"carol", "square", true},
+	}
+
+	for _, cas := range cases {
+		if allowed := acl.Allowed(cas.username, cas.method); allowed != cas.allowed {
+			t.Errorf("Allowed(%q, %q)=%t, want %t", cas.username, cas.method, allowed, cas.allowed)
+		}
+	}
+
+	acl.DenyUnlisted = true
+
+	if acl.Allowed("carol", "square") {
+		t.Fatal("expected unlisted method to be denied")
+	}
+}
+
+func TestKite_Authorize(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	r := &Request{ID: "1", Username: "alice", Method: "deploy", Tenant: "acme"}
+
+	if err := k.authorize(r); err != nil {
+		t.Fatalf("authorize()=%s", err)
+	}
+
+	k.SetACL(&ACL{
+		Rules: []ACLRule{{Users: []string{"bob"}, Methods: []string{"deploy"}}},
+	})
+
+	err := k.authorize(r)
+	if err == nil || err.Type != "authorizationError" || err.RequestID != "1" {
+		t.Fatalf("want authorizationError, got %v", err)
+	}
+
+	k.SetACL(nil)
+
+	k.Authorize(func(r *Request) error {
+		if r.Tenant != "acme" {
+			return errors.New("wrong tenant")
+		}
+
+		return nil
+	})
+
+	if err := k.authorize(r); err != nil {
+		t.Fatalf("authorize()=%s", err)
+	}
+
+	r.Tenant = "other"
+
+	err = k.authorize(r)
+	if err == nil || err.Type != "authorizationError" || err.Message != "wrong tenant" {
+		t.Fatalf("want authorizationError, got %v", err)
+	}
+}
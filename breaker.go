@@ -0,0 +1,275 @@
+package kite
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets all the calls through.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen fails all the calls right away.
+	BreakerOpen
+
+	// BreakerHalfOpen lets a few trial calls through, which close
+	// the breaker when they succeed, or open it again when they fail.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// CircuitBreaker stops calling a remote kite, which keeps failing, so the
+// callers do not wait for the calls to time out, and the kite is given time
+// to recover. It is an interceptor of the calls made by one client:
+//
+//     b := &kite.CircuitBreaker{
+//         MaxFailures: 5,
+//         OpenTimeout: 10 * time.Second,
+//     }
+//     b.OnStateChange(func(from, to kite.BreakerState) {
+//         log.Printf("circuit breaker of %s: %s -> %s", c.Kite, from, to)
+//     })
+//     c.Intercept(b.Intercept)
+//
+// The breaker opens after MaxFailures consecutive failures, and fails the
+// calls with the "circuitOpen" error while it's open. After OpenTimeout
+// it lets HalfOpenCalls trial calls through, and closes once they succeed.
+//
+// By default only the timeouts and the errors of the connection count as
+// failures, the errors returned by the handlers of the remote kite mean
+// the kite is up, see IsFailure.
+type CircuitBreaker struct {
+	// MaxFailures is the number of consecutive failures opening the breaker.
+	//
+	// When 0, the default value of 5 is used.
+	MaxFailures int
+
+	// OpenTimeout is the time the breaker stays open before trial calls
+	// are let through.
+	//
+	// When 0, the default value of 30s is used.
+	OpenTimeout time.Duration
+
+	// HalfOpenCalls is the number of the trial calls, which must succeed
+	// to close the breaker. The other calls fail while they are made.
+	//
+	// When 0, the default value of 1 is used.
+	HalfOpenCalls int
+
+	// IsFailure tells whether the error of the call counts as a failure.
+	//
+	// If nil, the errors of the "timeout", "sendError", "disconnect",
+	// "overloadedError" and "shutdownError" types count as failures.
+	IsFailure func(err error) bool
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	trials    int // trial calls made in the half-open state
+	successes int // trial calls succeeded
+	handlers  []func(from, to BreakerState)
+	changes   []BreakerState // states changed to since locking, see unlock
+}
+
+// breakerFailures are the types of the errors, which count as failures
+// by default.
+var breakerFailures = map[string]bool{
+	"timeout":         true,
+	"sendError":       true,
+	"disconnect":      true,
+	"overloadedError": true,
+	"shutdownError":   true,
+}
+
+func isBreakerFailure(err error) bool {
+	e, ok := err.(*Error)
+	return ok && breakerFailures[e.Type]
+}
+
+// OnStateChange adds a callback, which is called when the state of
+// the breaker changes.
+func (b *CircuitBreaker) OnStateChange(handler func(from, to BreakerState)) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.halfOpen()
+
+	return b.state
+}
+
+// Intercept makes the call if the breaker allows it, it's meant to be
+// added with Client.Intercept.
+func (b *CircuitBreaker) Intercept(call *Call, next Invoker) (*Result, error) {
+	trial, err := b.allow(call.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := next(call)
+
+	b.done(trial, err)
+
+	return res, err
+}
+
+// allow tells whether the call can be made, and whether it's a trial call.
+func (b *CircuitBreaker) allow(method string) (trial bool, err error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.halfOpen()
+
+	switch b.state {
+	case BreakerOpen:
+		return false, &Error{
+			Type:       "circuitOpen",
+			Message:    fmt.Sprintf("Call to %q method: circuit breaker is open", method),
+			RetryAfter: b.openTimeout() - time.Since(b.openedAt),
+		}
+	case BreakerHalfOpen:
+		if b.trials >= b.halfOpenCalls() {
+			return false, &Error{
+				Type:    "circuitOpen",
+				Message: fmt.Sprintf("Call to %q method: circuit breaker is half-open", method),
+			}
+		}
+
+		b.trials++
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// done records the result of the call.
+func (b *CircuitBreaker) done(trial bool, err error) {
+	isFailure := b.IsFailure
+	if isFailure == nil {
+		isFailure = isBreakerFailure
+	}
+
+	b.mu.Lock()
+	defer b.unlock()
+
+	if e, ok := err.(*Error); ok && e.Type == "canceled" {
+		// The caller gave up, it tells nothing about the remote kite.
+		if trial && b.state == BreakerHalfOpen {
+			b.trials--
+		}
+		return
+	}
+
+	if err != nil && isFailure(err) {
+		b.failures++
+
+		if b.state == BreakerHalfOpen || b.failures >= b.maxFailures() {
+			b.setState(BreakerOpen)
+		}
+		return
+	}
+
+	b.failures = 0
+
+	if trial && b.state == BreakerHalfOpen {
+		b.successes++
+
+		if b.successes >= b.halfOpenCalls() {
+			b.setState(BreakerClosed)
+		}
+	}
+}
+
+// halfOpen lets the trial calls through once the open breaker times out.
+func (b *CircuitBreaker) halfOpen() {
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.openTimeout() {
+		b.setState(BreakerHalfOpen)
+	}
+}
+
+// setState changes the state of the breaker, it must be called with
+// the breaker locked.
+func (b *CircuitBreaker) setState(state BreakerState) {
+	from := b.state
+
+	b.state = state
+	b.failures = 0
+	b.trials = 0
+	b.successes = 0
+
+	if state == BreakerOpen {
+		b.openedAt = time.Now()
+	}
+
+	if from != state {
+		if len(b.changes) == 0 {
+			b.changes = append(b.changes, from)
+		}
+
+		b.changes = append(b.changes, state)
+	}
+}
+
+// unlock unlocks the breaker and calls the state change callbacks, so
+// they can use the breaker.
+func (b *CircuitBreaker) unlock() {
+	changes, handlers := b.changes, b.handlers
+	b.changes = nil
+	b.mu.Unlock()
+
+	for i := 1; i < len(changes); i++ {
+		for _, handler := range handlers {
+			func() {
+				defer nopRecover()
+				handler(changes[i-1], changes[i])
+			}()
+		}
+	}
+}
+
+func (b *CircuitBreaker) maxFailures() int {
+	if b.MaxFailures > 0 {
+		return b.MaxFailures
+	}
+
+	return 5
+}
+
+func (b *CircuitBreaker) openTimeout() time.Duration {
+	if b.OpenTimeout > 0 {
+		return b.OpenTimeout
+	}
+
+	return 30 * time.Second
+}
+
+func (b *CircuitBreaker) halfOpenCalls() int {
+	if b.HalfOpenCalls > 0 {
+		return b.HalfOpenCalls
+	}
+
+	return 1
+}
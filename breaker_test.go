@@ -0,0 +1,118 @@
+package kite
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := &CircuitBreaker{
+		MaxFailures: 2,
+		OpenTimeout: 50 * time.Millisecond,
+	}
+
+	var changes []string
+	b.OnStateChange(func(from, to BreakerState) {
+		changes = append(changes, from.String()+">"+to.String())
+	})
+
+	var calls int
+	fail := func(call *Call) (*Result, error) {
+		calls++
+		return nil, &Error{Type: "timeout"}
+	}
+	succeed := func(call *Call) (*Result, error) {
+		calls++
+		return &Result{}, nil
+	}
+	handlerErr := func(call *Call) (*Result, error) {
+		calls++
+		return nil, errors.New("not found")
+	}
+
+	call := &Call{Method: "square"}
+
+	b.Intercept(call, fail)
+	b.Intercept(call, handlerErr) // resets the failures
+	b.Intercept(call, fail)
+
+	if s := b.State(); s != BreakerClosed {
+		t.Fatalf("got %s, want closed", s)
+	}
+
+	b.Intercept(call, fail)
+
+	if s := b.State(); s != BreakerOpen {
+		t.Fatalf("got %s, want open", s)
+	}
+
+	_, err := b.Intercept(call, succeed)
+	if e, ok := err.(*Error); !ok || e.Type != "circuitOpen" || e.RetryAfter <= 0 {
+		t.Fatalf("got %v, want circuitOpen error", err)
+	}
+
+	if calls != 4 {
+		t.Fatalf("got %d calls, want 4", calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	// The failed trial call opens the breaker again.
+	b.Intercept(call, fail)
+
+	if s := b.State(); s != BreakerOpen {
+		t.Fatalf("got %s, want open", s)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if _, err := b.Intercept(call, succeed); err != nil {
+		t.Fatalf("Intercept()=%s", err)
+	}
+
+	if s := b.State(); s != BreakerClosed {
+		t.Fatalf("got %s, want closed", s)
+	}
+
+	want := []string{
+		"closed>open",
+		"open>half-open",
+		"half-open>open",
+		"open>half-open",
+		"half-open>closed",
+	}
+
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("got %v, want %v", changes, want)
+	}
+}
+
+func TestCircuitBreaker_HalfOpen(t *testing.T) {
+	b := &CircuitBreaker{
+		MaxFailures: 1,
+		OpenTimeout: time.Millisecond,
+	}
+
+	b.Intercept(&Call{}, func(*Call) (*Result, error) { return nil, &Error{Type: "disconnect"} })
+
+	time.Sleep(5 * time.Millisecond)
+
+	// Only one trial call is let through at a time.
+	_, err := b.Intercept(&Call{}, func(call *Call) (*Result, error) {
+		_, err := b.Intercept(call, func(*Call) (*Result, error) { return &Result{}, nil })
+		if e, ok := err.(*Error); !ok || e.Type != "circuitOpen" {
+			t.Errorf("got %v, want circuitOpen error", err)
+		}
+
+		return &Result{}, nil
+	})
+	if err != nil {
+		t.Fatalf("Intercept()=%s", err)
+	}
+
+	if s := b.State(); s != BreakerClosed {
+		t.Fatalf("got %s, want closed", s)
+	}
+}
@@ -0,0 +1,98 @@
+package kite
+
+import (
+	"context"
+	"errors"
+)
+
+// ContextHandlerFunc is a handler which receives the context of the request.
+// The context is canceled when the caller disconnects or cancels the call,
+// e.g. by canceling the ctx passed to Client.TellWithContext, which allows
+// long-running handlers to stop early.
+type ContextHandlerFunc func(ctx context.Context, r *Request) (result interface{}, err error)
+
+// ServeKite calls h(r.Context, r)
+func (h ContextHandlerFunc) ServeKite(r *Request) (interface{}, error) {
+	return h(r.Context, r)
+}
+
+// HandleContextFunc registers a handler, which receives the context of the
+// request, to run when a method call is received from a Kite.
+func (k *Kite) HandleContextFunc(method string, handler ContextHandlerFunc) *Method {
+	return k.addHandle(method, handler)
+}
+
+// CancelArgs are arguments of the "kite.cancel" method, which cancels the
+// context of a request made over the same connection. Every call made with
+// a cancelable context carries an ID, which is sent along with the call.
+type CancelArgs struct {
+	CallID string `json:"callId"`
+}
+
+func handleCancel(r *Request) (interface{}, error) {
+	var args CancelArgs
+
+	if r.Args == nil {
+		return nil, errors.New("missing call ID")
+	}
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	return r.Client.cancelCall(args.CallID), nil
+}
+
+// trackCall returns a context of the call with the given ID, which is
+// canceled by cancelCall or releaseCall.
+func (c *Client) trackCall(ctx context.Context, id string) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+
+	c.callsMu.Lock()
+	defer c.callsMu.Unlock()
+
+	if c.calls == nil {
+		c.calls = make(map[string]context.CancelFunc)
+	}
+
+	c.calls[id] = cancel
+
+	return ctx
+}
+
+// cancelCall cancels the context of the call with the given ID. It returns
+// false if the call is not running.
+func (c *Client) cancelCall(id string) bool {
+	c.callsMu.Lock()
+	cancel, ok := c.calls[id]
+	c.callsMu.Unlock()
+
+	if ok {
+		cancel()
+	}
+
+	return ok
+}
+
+// releaseCall cancels the context of the finished call and forgets it.
+func (c *Client) releaseCall(id string) {
+	c.callsMu.Lock()
+	cancel, ok := c.calls[id]
+	delete(c.calls, id)
+	c.callsMu.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
+// cancelRemote tells the remote kite to cancel the call with the given ID.
+func (c *Client) cancelRemote(id string) {
+	if id == "" {
+		return
+	}
+
+	if _, err := c.TellWithTimeout("kite.cancel", c.config().Timeout, CancelArgs{CallID: id}); err != nil {
+		c.LocalKite.Log.Debug("Canceling call %s failed: %s", id, err)
+	}
+}
@@ -0,0 +1,158 @@
+package kite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+func TestClient_CancelCall(t *testing.T) {
+	k := New("cancel", "0.0.1")
+	defer k.Close()
+
+	c := k.NewClient("")
+
+	ctx := c.trackCall(context.Background(), "call1")
+
+	p, err := json.Marshal([]interface{}{CancelArgs{CallID: "call1"}})
+	if err != nil {
+		t.Fatalf("Marshal()=%s", err)
+	}
+
+	res, err := handleCancel(&Request{Client: c, Args: &dnode.Partial{Raw: p}})
+	if err != nil {
+		t.Fatalf("handleCancel()=%s", err)
+	}
+
+	if canceled := res.(bool); !canceled {
+		t.Fatal("want the call to be canceled")
+	}
+
+	select {
+	case <-ctx.Done():
+	default:
+		t.Fatal("want the context to be canceled")
+	}
+
+	c.releaseCall("call1")
+
+	if c.cancelCall("call1") {
+		t.Fatal("want released call to be forgotten")
+	}
+
+	ctx = c.trackCall(context.Background(), "call2")
+	c.releaseCall("call2")
+
+	if ctx.Err() == nil {
+		t.Fatal("want the context of a finished call to be canceled")
+	}
+}
+
+func TestClient_CallTimeoutExpires(t *testing.T) {
+	k := New("calltimeout", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+
+	done := make(chan struct{})
+	defer close(done)
+
+	k.HandleFunc("hang", func(r *Request) (interface{}, error) {
+		<-done
+		return nil, nil
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	e := New("exp", "0.0.1")
+	e.Config.CallTimeout = 200 * time.Millisecond
+
+	c := e.NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+
+	_, err := c.Tell("hang")
+	if e, ok := err.(*Error); !ok || e.Type != "timeout" {
+		t.Fatalf("want timeout error, got %v", err)
+	}
+
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("call took %s, want it to time out after 200ms", d)
+	}
+}
+
+func TestHandleContextFunc(t *testing.T) {
+	k := New("cancel", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+
+	canceled := make(chan struct{})
+
+	k.HandleContextFunc("wait", func(ctx context.Context, r *Request) (interface{}, error) {
+		select {
+		case <-ctx.Done():
+			close(canceled)
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Second):
+			return nil, nil
+		}
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.TellWithContext(ctx, "wait"); err == nil {
+		t.Fatal("want the call to time out")
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the handler to be canceled")
+	}
+}
+
+func TestClient_CallTimeout(t *testing.T) {
+	k := New("calltimeout", "0.0.1")
+	defer k.Close()
+
+	k.Config.CallTimeout = 2 * time.Second
+
+	c := k.NewClient("")
+
+	if got := c.callTimeout(context.Background()); got != 2*time.Second {
+		t.Fatalf("got %s, want 2s", got)
+	}
+
+	c.CallTimeout = time.Second
+
+	if got := c.callTimeout(context.Background()); got != time.Second {
+		t.Fatalf("got %s, want 1s", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if got := c.callTimeout(ctx); got != 0 {
+		t.Fatalf("got %s, want no timeout for ctx with deadline", got)
+	}
+}
@@ -2,7 +2,6 @@ package kite
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -16,9 +15,9 @@ import (
 	"github.com/koding/kite/dnode"
 	"github.com/koding/kite/protocol"
 	"github.com/koding/kite/sockjsclient"
+	"github.com/koding/kite/utils"
 
 	"github.com/cenkalti/backoff"
-	"github.com/gorilla/websocket"
 	"github.com/igm/sockjs-go/sockjs"
 )
 
@@ -36,6 +35,21 @@ func nopSetSession(sockjs.Session) {}
 // Client is the client for communicating with another Kite.
 // It has Tell() and Go() methods for calling methods sync/async way.
 type Client struct {
+	// lastRecv is the time of the last message received from the remote
+	// kite, in Unix nanoseconds, see startKeepAlive
+	lastRecv int64
+
+	// latency is the smoothed round trip time of the pings of the remote
+	// kite, in nanoseconds, see Latency
+	latency int64
+
+	// bytesIn and bytesOut count the traffic of the client, memory is
+	// the number of bytes held for it, see MemoryUsage. They go first
+	// to be aligned on 32-bit platforms.
+	bytesIn  uint64
+	bytesOut uint64
+	memory   int64
+
 	protocol.Kite // remote kite information
 
 	// LocalKite references to the kite which owns the client
@@ -52,9 +66,36 @@ type Client struct {
 	// broke.
 	Reconnect bool
 
+	// ReconnectPolicy configures redialing of the remote kite when
+	// Reconnect is true. If nil, the client redials forever with
+	// exponentially growing delays.
+	ReconnectPolicy *ReconnectPolicy
+
 	// URL specifies the SockJS URL of the remote kite.
 	URL string
 
+	// DisablePinning disables verifying that the remote kite has the same
+	// identity on every reconnect as it had on the first connection,
+	// see Client.Identity.
+	DisablePinning bool
+
+	// Transport is used for connecting to the remote kite. If nil, the
+	// transport registered for the URL scheme or the one set with
+	// Config.Transport is used, see Transport.
+	Transport Transport
+
+	// CallTimeout is the default timeout of waiting for the reply to
+	// a method call, used when the call is made without a timeout. If 0,
+	// Config.CallTimeout is used.
+	CallTimeout time.Duration
+
+	// PingInterval and PongTimeout override Config.PingInterval and
+	// Config.PongTimeout of the local kite, when non-zero. They are applied
+	// when the connection is made, so for the clients of the connections
+	// accepted by the kite they must be set in OnConnect handlers.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+
 	// Config is used when setting up client connection to
 	// the remote kite.
 	//
@@ -114,6 +155,10 @@ type Client struct {
 	// is closed but was not dialed
 	closeRenewer chan struct{}
 
+	// tokenRenewer renews the token of the clients returned by GetKites,
+	// see renewExpiringToken
+	tokenRenewer *TokenRenewer
+
 	// interrupt is used to signalise readloop that
 	// session was interrupted.
 	interrupt chan error
@@ -121,6 +166,13 @@ type Client struct {
 	// To syncronize the consumers
 	wg sync.WaitGroup
 
+	// dialed is true if the connection was initiated by us
+	dialed bool
+
+	// tokenAudience is the audience of the token shared with other
+	// clients, see Config.TokenCache
+	tokenAudience string
+
 	// SockJS session
 	// TODO: replace this with a proper interface to support multiple
 	// transport/protocols
@@ -132,9 +184,45 @@ type Client struct {
 	ctx    context.Context
 	cancel func()
 
+	// calls are cancel functions of the running requests of the remote
+	// kite by their call IDs, see CancelArgs
+	calls   map[string]context.CancelFunc
+	callsMu sync.Mutex
+
+	// features are advertised by the remote kite, featuresKnown is
+	// closed once they are exchanged after dialing, featuresAsked tells
+	// whether the exchange has started
+	features      map[string]bool
+	featuresKnown chan struct{}
+	featuresAsked bool
+	featuresMu    sync.Mutex
+
+	// msgpack is 1 if the messages are sent encoded with MessagePack,
+	// see FeatureMsgpack
+	msgpack int32
+
+	// pinned is the identity of the remote kite trusted on the first
+	// connection, verified is closed once the identity is verified after
+	// dialing, the calls are not sent until then
+	pinned      *Identity
+	verified    chan struct{}
+	identityErr *IdentityError
+	pinnedMu    sync.Mutex
+
+	// sharedID is the ID of the remote kite if the client is shared with
+	// DialShared, refs counts its users; both are protected by
+	// LocalKite.sharedMu
+	sharedID string
+	refs     int
+
 	// muReconnect protects Reconnect
 	muReconnect sync.Mutex
 
+	// queue holds the calls made while the client is reconnecting, it is
+	// nil otherwise, see ReconnectPolicy.QueueSize
+	queue   *callQueue
+	queueMu sync.Mutex
+
 	// closed is to ensure Close is idempotent
 	closed int32
 
@@ -147,9 +235,28 @@ type Client struct {
 	// on connect/disconnect handlers are invoked after every
 	// connect/disconnect.
 	onConnectHandlers     []func()
+	onReconnectHandlers   []func()
 	onDisconnectHandlers  []func()
 	onTokenExpireHandlers []func()
 	onTokenRenewHandlers  []func(string)
+	onSecurityErrHandlers []func(error)
+	onResubscribeHandlers []func(*Subscription, error)
+
+	// subscriptions are made again on every reconnect, see Subscribe
+	subscriptions   map[*Subscription]struct{}
+	subscriptionsMu sync.Mutex
+
+	// closeWith is the reason the connection is closed with, see
+	// CloseWithReason; remoteClose is the reason the remote kite
+	// closed it with, see CloseReason
+	closeWith   *CloseReason
+	remoteClose *CloseReason
+
+	// interceptorsList are added with Intercept
+	interceptorsList []Interceptor
+
+	// responseValidators are added with ValidateResponse
+	responseValidators map[string]ResponseValidator
 
 	testHookSetSession func(sockjs.Session)
 
@@ -161,8 +268,9 @@ type Client struct {
 
 // message carries an encoded payload sent over connected session.
 type message struct {
-	p    []byte
-	errC chan<- error
+	p      []byte
+	binary bool // encoded with MessagePack
+	errC   chan<- error
 }
 
 // callOptions is the type of first argument in the dnode message.
@@ -173,6 +281,14 @@ type callOptions struct {
 	Auth             *Auth          `json:"authentication"`
 	WithArgs         *dnode.Partial `json:"withArgs" dnode:"-"`
 	ResponseCallback dnode.Function `json:"responseCallback"`
+	Tenant           string         `json:"tenant,omitempty"`
+	Impersonate      string         `json:"impersonate,omitempty"`
+	APIVersion       string         `json:"apiVersion,omitempty"`
+	KiteVersion      string         `json:"kiteVersion,omitempty"`
+	CallID           string         `json:"callId,omitempty"`
+	Priority         Priority       `json:"priority,omitempty"`
+	Cost             int            `json:"cost,omitempty"`
+	TraceParent      string         `json:"traceparent,omitempty"`
 }
 
 // callOptionsOut is the same structure with callOptions.
@@ -195,12 +311,27 @@ type Auth struct {
 type response struct {
 	Result *dnode.Partial
 	Err    error
+
+	// Warnings and Metadata are attached to the response by the
+	// remote handler.
+	Warnings []string
+	Metadata map[string]*dnode.Partial
 }
 
 // NewClient returns a pointer to a new Client. The returned instance
 // is not connected. You have to call Dial() or DialForever() before calling
 // Tell() and Go() methods.
 func (k *Kite) NewClient(remoteURL string) *Client {
+	c := k.newClient(remoteURL)
+
+	k.OnRegister(c.updateAuth)
+
+	return c
+}
+
+// newClient returns a new Client, which does not update its authentication
+// when the kite registers, see Client.updateAuth.
+func (k *Kite) newClient(remoteURL string) *Client {
 	c := &Client{
 		LocalKite:          k,
 		URL:                remoteURL,
@@ -219,8 +350,6 @@ func (k *Kite) NewClient(remoteURL string) *Client {
 	c.OnConnect(c.setContext)
 	c.OnDisconnect(c.closeContext)
 
-	k.OnRegister(c.updateAuth)
-
 	return c
 }
 
@@ -237,6 +366,10 @@ func (c *Client) Dial() (err error) {
 }
 
 // DialTimeout acts like Dial but takes a timeout.
+//
+// Unless the pinning is disabled, it returns once the remote kite proved
+// its identity, the error is an *IdentityError if it failed to, see
+// Client.Identity.
 func (c *Client) DialTimeout(timeout time.Duration) error {
 	err := c.dial(timeout)
 
@@ -246,9 +379,11 @@ func (c *Client) DialTimeout(timeout time.Duration) error {
 		return err
 	}
 
+	verified := c.verifiedChan()
+
 	go c.run()
 
-	return nil
+	return c.waitVerified(verified)
 }
 
 // Dial connects to the remote Kite. If it can't connect, it retries
@@ -304,32 +439,23 @@ func (c *Client) authCopy() *Auth {
 }
 
 func (c *Client) dial(timeout time.Duration) (err error) {
-	transport := c.config().Transport
-
-	c.LocalKite.Log.Debug("Client transport is set to '%s'", transport)
-
-	var session sockjs.Session
-
-	switch transport {
-	case config.WebSocket:
-		session, err = sockjsclient.DialWebsocket(c.URL, c.config())
-	case config.XHRPolling:
-		session, err = sockjsclient.DialXHR(c.URL, c.config())
-	case config.Auto:
-		session, err = sockjsclient.DialWebsocket(c.URL, c.config())
-		if err == websocket.ErrBadHandshake {
-			// In cases when kite server is behind a proxy that do
-			// not support websocket connections, fall back to XHR.
-			session, err = sockjsclient.DialXHR(c.URL, c.config())
-		}
-	default:
-		return fmt.Errorf("Connection transport is not known '%v'", transport)
+	transport, err := c.transport()
+	if err != nil {
+		return err
 	}
 
+	c.LocalKite.Log.Debug("Client transport is set to '%s'", c.config().Transport)
+
+	session, err := transport.Dial(c.URL, c.config())
 	if err != nil {
 		return err
 	}
 
+	c.m.Lock()
+	reconnected := c.dialed
+	c.dialed = true
+	c.m.Unlock()
+
 	c.setSession(session)
 	c.wg.Add(1)
 	go c.sendHub()
@@ -337,9 +463,37 @@ func (c *Client) dial(timeout time.Duration) (err error) {
 	// Reset the wait time.
 	c.redialBackOff.Reset()
 
+	// The features are exchanged right away only if the remote kite
+	// needs ours, e.g. to negotiate the encoding, see SupportsFeature.
+	c.resetFeatures()
+	if len(c.LocalKite.Features()) != 0 {
+		go c.exchangeFeaturesOnce()
+	}
+
+	verified := c.resetVerified()
+
 	// Must be run in a goroutine because a handler may wait a response from
 	// server.
-	go c.callOnConnectHandlers()
+	go func() {
+		connected := true
+
+		if verified != nil {
+			connected = c.verifyIdentity()
+			c.setVerified(verified)
+		}
+
+		c.callOnConnectHandlers()
+
+		if reconnected {
+			c.callOnReconnectHandlers()
+		}
+
+		// The queued calls wait for the next connection, if this one
+		// was lost while verifying the identity.
+		if connected {
+			c.flushQueue()
+		}
+	}()
 
 	return nil
 }
@@ -361,7 +515,23 @@ func (c *Client) dialForever(connectNotifyChan chan bool) {
 		return nil
 	}
 
-	backoff.Retry(dial, c.redialBackOff) // this will retry dial forever
+	b := c.redialBackOff
+	if c.ReconnectPolicy != nil {
+		b = c.ReconnectPolicy.backOff()
+	}
+
+	// this will retry dial forever, unless ReconnectPolicy limits retries
+	if err := backoff.Retry(dial, b); err != nil {
+		c.LocalKite.Log.Error("Giving up dialing '%s' kite: %s: %v", c.Kite.Name, c.URL, err)
+
+		c.Close()
+
+		if connectNotifyChan != nil {
+			close(connectNotifyChan)
+		}
+
+		return
+	}
 
 	if connectNotifyChan != nil {
 		close(connectNotifyChan)
@@ -376,12 +546,14 @@ func (c *Client) RemoteAddr() string {
 		return ""
 	}
 
-	websocketsession, ok := session.(*sockjsclient.WebsocketSession)
+	addr, ok := session.(interface {
+		RemoteAddr() string
+	})
 	if !ok {
 		return ""
 	}
 
-	return websocketsession.RemoteAddr()
+	return addr.RemoteAddr()
 }
 
 // run consumes incoming dnode messages. Reconnects if necessary.
@@ -391,6 +563,12 @@ func (c *Client) run() {
 		c.LocalKite.Log.Debug("readloop err: %s", err)
 	}
 
+	delay, redial := c.redialDelay(c.setRemoteClose(err))
+
+	if redial && c.reconnect() {
+		c.startQueue()
+	}
+
 	// falls here when connection disconnects
 	c.callOnDisconnectHandlers()
 
@@ -402,7 +580,7 @@ func (c *Client) run() {
 	}
 	c.disconnectMu.Unlock()
 
-	if c.reconnect() {
+	if redial && c.reconnect() {
 		// we override it so it doesn't get selected next time. Because we are
 		// redialing, so after redial if a new method is called, the disconnect
 		// channel is being read and the local "disconnect" message will be the
@@ -410,7 +588,12 @@ func (c *Client) run() {
 		c.disconnectMu.Lock()
 		c.disconnect = make(chan struct{}, 1)
 		c.disconnectMu.Unlock()
-		go c.dialForever(nil)
+
+		if delay > 0 {
+			time.AfterFunc(delay, func() { c.dialForever(nil) })
+		} else {
+			go c.dialForever(nil)
+		}
 	}
 }
 
@@ -423,28 +606,56 @@ func (c *Client) reconnect() bool {
 
 // readLoop reads a message from websocket and processes it.
 func (c *Client) readLoop() error {
+	defer c.startKeepAlive()()
+
 	for {
+		if err := c.waitMemory(); err != nil {
+			return err
+		}
+
 		p, err := c.receiveData()
 
-		c.LocalKite.Log.Debug("readloop received: %s %v", p, err)
+		if err == nil {
+			c.touch()
+
+			data, e := decodeMessage(p)
+			if e != nil {
+				c.LocalKite.Log.Warning("error decoding message: %s", e)
+				continue
+			}
+
+			p = data
+		}
+
+		if err == nil && c.handleFast(p) {
+			continue
+		}
+
+		c.LocalKite.Log.Debug("readloop received: %s %v", c.LocalKite.redactJSON(p), err)
 
 		if err != nil {
 			return err
 		}
 
+		c.traceFrame(traceIn, p)
+		c.countBytes(&c.bytesIn, &c.LocalKite.bytesIn, len(p))
+
 		msg, fn, err := c.processMessage(p)
 		if err != nil {
 			if _, ok := err.(dnode.CallbackNotFoundError); !ok {
-				c.LocalKite.Log.Warning("error processing message err: %s message: %s", err, msg)
+				c.LocalKite.Log.Warning("error processing message err: %s message: %s", err, c.LocalKite.redactJSON(p))
 			}
 		}
 
 		switch v := fn.(type) {
 		case *Method: // invoke method
+			// The message is held until the method returns.
+			c.holdMemory(len(p))
+
 			if c.Concurrent {
-				go c.runMethod(v, msg.Arguments)
+				go c.runHeldMethod(v, msg.Arguments, len(p))
 			} else {
-				c.runMethod(v, msg.Arguments)
+				c.runHeldMethod(v, msg.Arguments, len(p))
 			}
 		case func(*dnode.Partial): // invoke callback
 			if c.Concurrent && c.ConcurrentCallbacks {
@@ -456,6 +667,14 @@ func (c *Client) readLoop() error {
 	}
 }
 
+// runHeldMethod runs the method, it releases the size of its message
+// once the method returns.
+func (c *Client) runHeldMethod(method *Method, args *dnode.Partial, size int) {
+	defer c.holdMemory(-size)
+
+	c.runMethod(method, args, nil)
+}
+
 // receiveData reads a message from session.
 func (c *Client) receiveData() ([]byte, error) {
 	type recv struct {
@@ -492,12 +711,6 @@ func (c *Client) processMessage(data []byte) (msg *dnode.Message, fn interface{}
 		}
 	}()
 
-	msg = &dnode.Message{}
-
-	if err = json.Unmarshal(data, &msg); err != nil {
-		return nil, nil, err
-	}
-
 	sender := func(id uint64, args []interface{}) error {
 		// do not name the error variable to "err" here, it's a trap for
 		// shadowing variables
@@ -505,11 +718,24 @@ func (c *Client) processMessage(data []byte) (msg *dnode.Message, fn interface{}
 		return e
 	}
 
-	// Replace function placeholders with real functions.
-	if err := dnode.ParseCallbacks(msg, sender); err != nil {
+	limits := &dnode.Limits{
+		MaxDepth:     c.LocalKite.Config.MaxMessageDepth,
+		MaxCallbacks: c.LocalKite.Config.MaxMessageCallbacks,
+		MaxArguments: c.LocalKite.Config.MaxMessageArgs,
+	}
+
+	// Decode the message and replace function placeholders with real
+	// functions.
+	if msg, err = dnode.ParseMessageWithLimits(data, sender, limits); err != nil {
+		if e, ok := err.(dnode.LimitError); ok && e.Message != nil {
+			c.rejectMessage(e.Message, err)
+		}
 		return nil, nil, err
 	}
 
+	msg.Arguments.Naming = c.LocalKite.Config.FieldNaming
+	msg.Arguments.Numbers = c.LocalKite.Config.Numbers
+
 	// Find the handler function. Method may be string or integer.
 	switch method := msg.Method.(type) {
 	case float64:
@@ -525,7 +751,7 @@ func (c *Client) processMessage(data []byte) (msg *dnode.Message, fn interface{}
 
 		return msg, callback, nil
 	case string:
-		m, ok := c.LocalKite.handlers[method]
+		m, ok := c.LocalKite.method(method)
 		if !ok {
 			err = dnode.MethodNotFoundError{
 				Method: method,
@@ -541,6 +767,10 @@ func (c *Client) processMessage(data []byte) (msg *dnode.Message, fn interface{}
 }
 
 func (c *Client) Close() {
+	if !c.releaseShared() {
+		return // still used by other callers of DialShared
+	}
+
 	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
 		return // TODO: ErrAlreadyClosed
 	}
@@ -560,11 +790,16 @@ func (c *Client) Close() {
 		}
 	}
 
+	if c.tokenAudience != "" {
+		c.LocalKite.tokenCache().remove(c)
+	}
+
 	// wait for consumers to finish buffered messages
 	c.wg.Wait()
 
 	if session := c.getSession(); session != nil {
-		session.Close(3000, "Go away!")
+		reason := c.closeReason()
+		session.Close(uint32(reason.Code), reason.Reason)
 	}
 }
 
@@ -575,14 +810,20 @@ func (c *Client) sendHub() {
 	for {
 		select {
 		case msg := <-c.send:
-			c.LocalKite.Log.Debug("sending: %s", msg)
+			c.LocalKite.Log.Debug("sending: %s", debugMessage{c.LocalKite, msg})
 			session := c.getSession()
 			if session == nil {
+				c.holdMemory(-len(msg.p))
 				c.LocalKite.Log.Error("not connected")
 				continue
 			}
 
-			err := session.Send(string(msg.p))
+			if c.LocalKite.Trace() {
+				c.traceFrame(traceOut, msg.json())
+			}
+
+			n, err := c.sendMessage(session, msg)
+			c.holdMemory(-len(msg.p))
 			if err != nil {
 				if msg.errC != nil {
 					msg.errC <- err
@@ -598,7 +839,11 @@ func (c *Client) sendHub() {
 					c.LocalKite.Log.Error("error sending to %s: %s", session.ID(), err)
 					return
 				}
+
+				continue
 			}
+
+			c.countBytes(&c.bytesOut, &c.LocalKite.bytesOut, n)
 		case <-c.closeChan:
 			c.LocalKite.Log.Debug("Send hub is closed")
 			return
@@ -638,6 +883,15 @@ func (c *Client) OnTokenRenew(handler func(token string)) {
 	c.m.Unlock()
 }
 
+// OnSecurityError adds a callback which is called when the connection is
+// closed for security reasons, e.g. when the remote kite presents
+// a different identity after reconnecting, see IdentityError.
+func (c *Client) OnSecurityError(handler func(err error)) {
+	c.m.Lock()
+	c.onSecurityErrHandlers = append(c.onSecurityErrHandlers, handler)
+	c.m.Unlock()
+}
+
 // callOnConnectHandlers runs the registered connect handlers.
 func (c *Client) callOnConnectHandlers() {
 	c.m.RLock()
@@ -678,6 +932,18 @@ func (c *Client) callOnTokenExpireHandlers() {
 	}
 }
 
+func (c *Client) callOnSecurityErrHandlers(err error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	for _, handler := range c.onSecurityErrHandlers {
+		func() {
+			defer nopRecover()
+			handler(err)
+		}()
+	}
+}
+
 // callOnTokenRenewHandlers calls all registered functions when
 // we successfully obtain new token from kontrol.
 func (c *Client) callOnTokenRenewHandlers(token string) {
@@ -692,13 +958,29 @@ func (c *Client) callOnTokenRenewHandlers(token string) {
 	}
 }
 
-func (c *Client) wrapMethodArgs(args []interface{}, responseCallback dnode.Function) []interface{} {
+func (c *Client) wrapMethodArgs(ctx context.Context, args []interface{}, responseCallback dnode.Function, callID string) []interface{} {
+	if c.LocalKite.Config.FieldNaming != dnode.GoNaming {
+		named := make([]interface{}, len(args))
+		for i, arg := range args {
+			named[i] = c.LocalKite.applyNaming(arg)
+		}
+		args = named
+	}
+
 	options := callOptionsOut{
 		WithArgs: args,
 		callOptions: callOptions{
 			Kite:             *c.LocalKite.Kite(),
 			Auth:             c.authCopy(),
 			ResponseCallback: responseCallback,
+			Tenant:           TenantFromContext(ctx),
+			Impersonate:      impersonationFromContext(ctx),
+			APIVersion:       apiVersionFromContext(ctx),
+			KiteVersion:      c.remoteVersion(),
+			CallID:           callID,
+			Priority:         priorityFromContext(ctx),
+			Cost:             costFromContext(ctx),
+			TraceParent:      traceParentFromContext(ctx),
 		},
 	}
 	return []interface{}{options}
@@ -713,12 +995,110 @@ func (c *Client) Tell(method string, args ...interface{}) (result *dnode.Partial
 
 // TellWithTimeout does the same thing with Tell() method except it takes an
 // extra argument that is the timeout for waiting reply from the remote Kite.
-// If timeout is given 0, the behavior is same as Tell().
+// If timeout is given 0, the behavior is same as Tell(), which waits up to
+// the default timeout of the client, see CallTimeout. A negative timeout
+// waits forever.
 func (c *Client) TellWithTimeout(method string, timeout time.Duration, args ...interface{}) (result *dnode.Partial, err error) {
 	response := <-c.GoWithTimeout(method, timeout, args...)
 	return response.Result, response.Err
 }
 
+// TellWithContext does the same thing with Tell() method except it stops
+// waiting for the reply when the ctx is done. The tenant carried by the ctx
+// is sent along with the call, so passing the Request.Context of a handler
+// propagates the tenant to the remote kite. So are the user to impersonate
+// and the requested API version, see WithImpersonation and WithAPIVersion,
+// as well as the priority and cost hints, see WithPriority and WithCost,
+// and the trace context, see WithSpanContext.
+func (c *Client) TellWithContext(ctx context.Context, method string, args ...interface{}) (result *dnode.Partial, err error) {
+	responseChan := make(chan *response, 1)
+
+	c.sendMethod(ctx, method, args, 0, responseChan)
+
+	response := <-responseChan
+	return response.Result, response.Err
+}
+
+// Call makes a blocking method call to the server, sending args as the only
+// argument of the method, and unmarshals the result into the value pointed
+// to by result. A nil args sends no arguments and a nil result discards
+// the result. Errors returned by the remote handler are of *Error type.
+//
+//     var sq SquareResult
+//     err := c.Call("square", SquareArgs{Number: 4}, &sq)
+func (c *Client) Call(method string, args, result interface{}) error {
+	return c.CallWithContext(context.Background(), method, args, result)
+}
+
+// CallWithContext does the same thing with Call() method except it stops
+// waiting for the reply when the ctx is done, see TellWithContext.
+func (c *Client) CallWithContext(ctx context.Context, method string, args, result interface{}) error {
+	var withArgs []interface{}
+	if args != nil {
+		withArgs = []interface{}{args}
+	}
+
+	res, err := c.TellWithContext(ctx, method, withArgs...)
+	if err != nil {
+		return err
+	}
+
+	// A null result leaves the value untouched, the same way
+	// json.Unmarshal does.
+	if result == nil || res == nil {
+		return nil
+	}
+
+	if err := res.Unmarshal(result); err != nil {
+		return &Error{
+			Type:    "invalidResponse",
+			Message: fmt.Sprintf("Unable to unmarshal result of %q method: %s", method, err),
+		}
+	}
+
+	return nil
+}
+
+// Result is the reply of a remote kite together with the non-fatal
+// warnings and metadata attached by the handler.
+type Result struct {
+	// Value is the result returned by the handler.
+	Value *dnode.Partial
+
+	// Warnings are notices for the caller, e.g. about calling a deprecated
+	// method.
+	Warnings []string
+
+	// Metadata holds values like cache status or partial-result flags.
+	Metadata map[string]*dnode.Partial
+}
+
+// Meta unmarshals the metadata value with the given key into v. It returns
+// false if there is no such key.
+func (r *Result) Meta(key string, v interface{}) (bool, error) {
+	p, ok := r.Metadata[key]
+	if !ok || p == nil {
+		return false, nil
+	}
+
+	return true, p.Unmarshal(v)
+}
+
+// TellResult does the same thing with TellWithTimeout() method except it
+// returns the result wrapped together with its warnings and metadata. The
+// result is non-nil also when the handler has returned an error.
+func (c *Client) TellResult(method string, timeout time.Duration, args ...interface{}) (*Result, error) {
+	response := <-c.GoWithTimeout(method, timeout, args...)
+
+	result := &Result{
+		Value:    response.Result,
+		Warnings: response.Warnings,
+		Metadata: response.Metadata,
+	}
+
+	return result, response.Err
+}
+
 // Go makes an unblocking method call to the server.
 // It returns a channel that the caller can wait on it to get the response.
 func (c *Client) Go(method string, args ...interface{}) chan *response {
@@ -727,20 +1107,100 @@ func (c *Client) Go(method string, args ...interface{}) chan *response {
 
 // GoWithTimeout does the same thing with Go() method except it takes an
 // extra argument that is the timeout for waiting reply from the remote Kite.
-// If timeout is given 0, the behavior is same as Go().
+// If timeout is given 0, the behavior is same as Go(), which waits up to
+// the default timeout of the client, see CallTimeout. A negative timeout
+// waits forever.
 func (c *Client) GoWithTimeout(method string, timeout time.Duration, args ...interface{}) chan *response {
 	// We will return this channel to the caller.
 	// It can wait on this channel to get the response.
 	responseChan := make(chan *response, 1)
 
-	c.sendMethod(method, args, timeout, responseChan)
+	c.sendMethod(context.Background(), method, args, timeout, responseChan)
 
 	return responseChan
 }
 
-// sendMethod wraps the arguments, adds a response callback,
+// sendMethod runs the call through the interceptors and sends it, once
+// the outbound rate limit allows it.
+func (c *Client) sendMethod(ctx context.Context, method string, args []interface{}, timeout time.Duration, responseChan chan *response) {
+	if timeout == 0 {
+		timeout = c.callTimeout(ctx)
+	}
+
+	ctx, responseChan = c.startCallSpan(ctx, method, responseChan)
+
+	interceptors := c.interceptors()
+	if len(interceptors) == 0 && c.outboundBucket() == nil {
+		c.invokeMethod(ctx, method, args, timeout, responseChan)
+		return
+	}
+
+	call := &Call{
+		Context: ctx,
+		Method:  method,
+		Args:    args,
+		Timeout: timeout,
+	}
+
+	go func() {
+		result, err := c.intercept(call, interceptors)
+
+		resp := &response{Err: err}
+		if result != nil {
+			resp.Result = result.Value
+			resp.Warnings = result.Warnings
+			resp.Metadata = result.Metadata
+		}
+
+		responseChan <- resp
+	}()
+}
+
+// renewExpiringToken renews the token of the client before a call is sent,
+// if the token expires before the renewal in background would happen, so
+// the call does not fail with an expired token. The renewal waits for
+// Kontrol up to the timeout of the call, the call is sent with the old
+// token if it fails.
+func (c *Client) renewExpiringToken(ctx context.Context, timeout time.Duration) {
+	if c.tokenRenewer == nil {
+		return
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if err := c.tokenRenewer.renewExpiring(ctx); err != nil {
+		c.LocalKite.Log.Warning("Cannot renew the expiring token for %s: %s", c.Kite, err)
+	}
+}
+
+// invokeMethod wraps the arguments, adds a response callback,
 // marshals the message and send it over the wire.
-func (c *Client) sendMethod(method string, args []interface{}, timeout time.Duration, responseChan chan *response) {
+func (c *Client) invokeMethod(ctx context.Context, method string, args []interface{}, timeout time.Duration, responseChan chan *response) {
+	// The calls made while the client is reconnecting are sent once it
+	// is connected again, see ReconnectPolicy.QueueSize.
+	if c.queueCall(ctx, method, args, timeout, responseChan) {
+		return
+	}
+
+	// The calls made before the identity of the remote kite is verified
+	// are sent once it is, so they never reach an impostor.
+	if verified := c.verifiedChan(); verified != nil {
+		go func() {
+			<-verified
+			c.invokeMethod(ctx, method, args, timeout, responseChan)
+		}()
+		return
+	}
+
+	c.sendCall(ctx, method, args, timeout, responseChan)
+}
+
+// sendCall sends the call right away and waits for the response.
+func (c *Client) sendCall(ctx context.Context, method string, args []interface{}, timeout time.Duration, responseChan chan *response) {
 	// To clean the sent callback after response is received.
 	// Send/Receive in a channel to prevent race condition because
 	// the callback is run in a separate goroutine.
@@ -749,8 +1209,17 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 	// When a callback is called it will send the response to this channel.
 	doneChan := make(chan *response, 1)
 
+	c.renewExpiringToken(ctx, timeout)
+
 	cb := c.makeResponseCallback(doneChan, removeCallback, method, args)
-	args = c.wrapMethodArgs(args, cb)
+	// Calls which can be canceled are identified, so the remote kite can
+	// be told to cancel them, see CancelArgs.
+	var callID string
+	if ctx.Done() != nil {
+		callID = utils.RandomString(16)
+	}
+
+	args = c.wrapMethodArgs(ctx, args, cb, callID)
 
 	callbacks, errC, err := c.marshalAndSend(method, args)
 	if err != nil {
@@ -773,8 +1242,11 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 
 	// Waits until the response has came or the connection has disconnected.
 	go func() {
+		// The lock is not held while waiting, as it would block closing
+		// the channel on disconnect, delaying the reconnect.
 		c.disconnectMu.Lock()
-		defer c.disconnectMu.Unlock()
+		disconnect := c.disconnect
+		c.disconnectMu.Unlock()
 
 		select {
 		case resp := <-doneChan:
@@ -785,10 +1257,9 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 			}
 
 			responseChan <- resp
-		case <-c.disconnect:
+		case <-disconnect:
 			responseChan <- &response{
-				nil,
-				&Error{
+				Err: &Error{
 					Type:    "disconnect",
 					Message: "Remote kite has disconnected",
 				},
@@ -796,8 +1267,7 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 		case err := <-errC:
 			if err != nil {
 				responseChan <- &response{
-					nil,
-					&Error{
+					Err: &Error{
 						Type:    "sendError",
 						Message: err.Error(),
 					},
@@ -805,8 +1275,7 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 			}
 		case <-afterTimeout:
 			responseChan <- &response{
-				nil,
-				&Error{
+				Err: &Error{
 					Type:    "timeout",
 					Message: fmt.Sprintf("No response to %q method in %s", method, timeout),
 				},
@@ -814,6 +1283,24 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 
 			// Remove the callback function from the map so we do not
 			// consume memory for unused callbacks.
+			if id, ok := <-removeCallback; ok {
+				c.scrubber.RemoveCallback(id)
+			}
+		case <-ctx.Done():
+			errType := "canceled"
+			if ctx.Err() == context.DeadlineExceeded {
+				errType = "timeout"
+			}
+
+			go c.cancelRemote(callID)
+
+			responseChan <- &response{
+				Err: &Error{
+					Type:    errType,
+					Message: fmt.Sprintf("Call to %q method: %s", method, ctx.Err()),
+				},
+			}
+
 			if id, ok := <-removeCallback; ok {
 				c.scrubber.RemoveCallback(id)
 			}
@@ -824,7 +1311,7 @@ func (c *Client) sendMethod(method string, args []interface{}, timeout time.Dura
 }
 
 // marshalAndSend takes a method and arguments, scrubs the arguments to create
-// a dnode message, marshals the message to JSON and sends it over the wire.
+// a dnode message, encodes the message and sends it over the wire.
 func (c *Client) marshalAndSend(method interface{}, arguments []interface{}) (callbacks map[string]dnode.Path, errC <-chan error, err error) {
 	// scrub trough the arguments and save any callbacks.
 	callbacks = c.scrubber.Scrub(arguments)
@@ -840,38 +1327,42 @@ func (c *Client) marshalAndSend(method interface{}, arguments []interface{}) (ca
 		arguments = make([]interface{}, 0)
 	}
 
-	rawArgs, err := json.Marshal(arguments)
+	p, binary, err := c.encodeMessage(&outMessage{
+		Method:    method,
+		Arguments: arguments,
+		Callbacks: callbacks,
+	})
 	if err != nil {
 		return nil, nil, err
 	}
 
-	msg := dnode.Message{
-		Method:    method,
-		Arguments: &dnode.Partial{Raw: rawArgs},
-		Callbacks: callbacks,
-	}
+	sent := make(chan error, 1)
 
-	p, err := json.Marshal(msg)
-	if err != nil {
+	if err := c.enqueue(&message{p: p, binary: binary, errC: sent}); err != nil {
 		return nil, nil, err
 	}
 
+	return callbacks, sent, nil
+}
+
+// enqueue hands the message to the sendHub, the error of sending it is
+// sent to the errC of the message, if it's non-nil.
+func (c *Client) enqueue(msg *message) error {
 	select {
 	case <-c.closeChan:
-		return nil, nil, errors.New("can't send, client is closed")
+		return errors.New("can't send, client is closed")
 	default:
 		if c.getSession() == nil {
-			return nil, nil, errors.New("can't send, session is not established yet")
+			return errors.New("can't send, session is not established yet")
 		}
 
-		errC := make(chan error, 1)
+		// The message is held until it is handed to the session,
+		// see sendHub.
+		c.holdMemory(len(msg.p))
 
-		c.send <- &message{
-			p:    p,
-			errC: errC,
-		}
+		c.send <- msg
 
-		return callbacks, errC, nil
+		return nil
 	}
 }
 
@@ -908,6 +1399,20 @@ func (c *Client) config() *config.Config {
 	return c.LocalKite.Config
 }
 
+// callTimeout gives the timeout of calls made without one. Calls with
+// a ctx that has a deadline are not given a default timeout.
+func (c *Client) callTimeout(ctx context.Context) time.Duration {
+	if _, ok := ctx.Deadline(); ok {
+		return 0
+	}
+
+	if c.CallTimeout != 0 {
+		return c.CallTimeout
+	}
+
+	return c.config().CallTimeout
+}
+
 // sendCallbackID send the callback number to be deleted after response is received.
 func sendCallbackID(callbacks map[string]dnode.Path, ch chan<- uint64) {
 	// TODO fix finding of responseCallback in dnode message when removing callback
@@ -940,18 +1445,26 @@ func (c *Client) makeResponseCallback(doneChan chan *response, removeCallback <-
 	return dnode.Callback(func(arguments *dnode.Partial) {
 		// Single argument of response callback.
 		var resp struct {
-			Result *dnode.Partial `json:"result"`
-			Err    *Error         `json:"error"`
+			Result   *dnode.Partial            `json:"result"`
+			Err      *Error                    `json:"error"`
+			Warnings []string                  `json:"warnings"`
+			Metadata map[string]*dnode.Partial `json:"metadata"`
 		}
 
 		// Notify that the callback is finished.
 		defer func() {
+			r := &response{
+				Result:   resp.Result,
+				Warnings: resp.Warnings,
+				Metadata: resp.Metadata,
+			}
+
 			if resp.Err != nil {
-				c.LocalKite.Log.Debug("Error received from kite: %q method: %q args: %#v err: %s", c.Kite.Name, method, args, resp.Err.Error())
-				doneChan <- &response{resp.Result, resp.Err}
-			} else {
-				doneChan <- &response{resp.Result, nil}
+				c.LocalKite.Log.Debug("Error received from kite: %q method: %q args: %s err: %s", c.Kite.Name, method, c.LocalKite.Redact(args), resp.Err.Error())
+				r.Err = resp.Err
 			}
+
+			doneChan <- r
 		}()
 
 		// Remove the callback function from the map so we do not
@@ -974,6 +1487,10 @@ func (c *Client) makeResponseCallback(doneChan chan *response, removeCallback <-
 			return
 		}
 
+		for _, warning := range resp.Warnings {
+			c.LocalKite.Log.Warning("Warning received from kite: %q method: %q: %s", c.Kite.Name, method, warning)
+		}
+
 		// At least result or error must be sent.
 		keys := make(map[string]interface{})
 		err = arg[0].Unmarshal(&keys)
@@ -986,9 +1503,45 @@ func (c *Client) makeResponseCallback(doneChan chan *response, removeCallback <-
 			}
 			return
 		}
+
+		if resp.Err == nil {
+			if err := c.validateResponse(method, resp.Result); err != nil {
+				resp.Result, resp.Err = nil, err
+			}
+		}
 	})
 }
 
+// rejectMessage sends the error to the response callback of a message that
+// is not going to be processed, so the caller does not wait for a response
+// until it times out. Callbacks of the message are expected to be not
+// parsed yet.
+func (c *Client) rejectMessage(msg *dnode.Message, err error) {
+	for key, path := range msg.Callbacks {
+		if len(path) != 2 || fmt.Sprint(path[0]) != "0" || path[1] != "responseCallback" {
+			continue
+		}
+
+		id, e := strconv.ParseUint(key, 10, 64)
+		if e != nil {
+			return
+		}
+
+		response := Response{
+			Error: &Error{
+				Type:    "messageLimitError",
+				Message: err.Error(),
+			},
+		}
+
+		if _, _, e := c.marshalAndSend(id, []interface{}{response}); e != nil {
+			c.LocalKite.Log.Error("failed to reject message: %s", e)
+		}
+
+		return
+	}
+}
+
 // onError is called when an error happened in a method handler.
 func onError(err error) {
 	// TODO do not marshal options again here
@@ -1039,3 +1592,11 @@ func (lb *lockedBackoff) Reset() {
 
 	lb.b.Reset()
 }
+
+// isDialed returns true if the connection was initiated by us.
+func (c *Client) isDialed() bool {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return c.dialed
+}
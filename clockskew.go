@@ -0,0 +1,88 @@
+package kite
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ClockSkew returns the difference between the local clock and Kontrol's one,
+// measured on the last registration or HTTP heartbeat. A positive value
+// means the local clock is ahead. It returns zero if the skew was not
+// measured yet.
+func (k *Kite) ClockSkew() time.Duration {
+	return time.Duration(atomic.LoadInt64(&k.clockSkew))
+}
+
+// ClockSkewed returns true if the local clock is skewed too much, see
+// OnClockSkew.
+func (k *Kite) ClockSkewed() bool {
+	return atomic.LoadInt32(&k.clockSkewed) == 1
+}
+
+// OnClockSkew registers a callback which is called when the local clock is
+// detected to be skewed relative to Kontrol's one by more than half of
+// Config.ClockSkew (but no less than a second). Skew breaks validation of
+// the tokens, so it usually means the NTP of the host needs fixing.
+//
+// The callback is called once when the skew is detected, and again only
+// after the clock was in sync in the meantime.
+func (k *Kite) OnClockSkew(handler func(skew time.Duration)) {
+	k.handlersMu.Lock()
+	k.onClockSkewHandlers = append(k.onClockSkewHandlers, handler)
+	k.handlersMu.Unlock()
+}
+
+func (k *Kite) callOnClockSkewHandlers(skew time.Duration) {
+	k.handlersMu.RLock()
+	defer k.handlersMu.RUnlock()
+
+	for _, handler := range k.onClockSkewHandlers {
+		func() {
+			defer nopRecover()
+			handler(skew)
+		}()
+	}
+}
+
+// clockSkewThreshold is the skew considered too much.
+func (k *Kite) clockSkewThreshold() time.Duration {
+	if threshold := k.Config.ClockSkew / 2; threshold > time.Second {
+		return threshold
+	}
+
+	return time.Second
+}
+
+// updateClockSkew updates the skew given the remote time in Unix nanoseconds,
+// received in the reply to a request made between sent and received.
+func (k *Kite) updateClockSkew(sent, received time.Time, remote int64) {
+	if remote == 0 {
+		return // older Kontrol
+	}
+
+	// Assume the remote time was taken halfway through the round trip.
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := local.Sub(time.Unix(0, remote))
+
+	atomic.StoreInt64(&k.clockSkew, int64(skew))
+
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+
+	if abs > k.clockSkewThreshold() {
+		if atomic.CompareAndSwapInt32(&k.clockSkewed, 0, 1) {
+			k.Log.Warning("Local clock is off by %s relative to Kontrol, token "+
+				"validation may fail; check NTP synchronization of the host", skew)
+
+			k.callOnClockSkewHandlers(skew)
+		}
+
+		return
+	}
+
+	if atomic.CompareAndSwapInt32(&k.clockSkewed, 1, 0) {
+		k.Log.Info("Local clock is in sync with Kontrol again, skew is %s", skew)
+	}
+}
@@ -0,0 +1,54 @@
+package kite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestKite_UpdateClockSkew(t *testing.T) {
+	k := New("clockskew", "0.0.1")
+	k.Config = config.New()
+	k.Config.ClockSkew = 30 * time.Second
+	defer k.Close()
+
+	var skews []time.Duration
+	k.OnClockSkew(func(skew time.Duration) {
+		skews = append(skews, skew)
+	})
+
+	sent := time.Now()
+	received := sent.Add(200 * time.Millisecond)
+
+	// Kontrol's clock is a minute behind.
+	k.updateClockSkew(sent, received, sent.Add(100*time.Millisecond-time.Minute).UnixNano())
+
+	if skew := k.ClockSkew(); skew != time.Minute {
+		t.Fatalf("got %s, want %s", skew, time.Minute)
+	}
+
+	if !k.ClockSkewed() {
+		t.Fatal("want clock to be skewed")
+	}
+
+	// The handlers are called only once.
+	k.updateClockSkew(sent, received, sent.Add(-time.Minute).UnixNano())
+
+	if len(skews) != 1 || skews[0] != time.Minute {
+		t.Fatalf("got %v", skews)
+	}
+
+	k.updateClockSkew(sent, received, sent.Add(5*time.Second).UnixNano())
+
+	if k.ClockSkewed() {
+		t.Fatalf("want clock to be in sync, skew is %s", k.ClockSkew())
+	}
+
+	// Older Kontrols do not send the time.
+	k.updateClockSkew(sent, received, 0)
+
+	if skew := k.ClockSkew(); skew != 100*time.Millisecond-5*time.Second {
+		t.Fatalf("got %s", skew)
+	}
+}
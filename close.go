@@ -0,0 +1,142 @@
+package kite
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/koding/kite/sockjsclient"
+)
+
+// CloseReason is the code and reason a connection is closed with. It is sent
+// to the remote kite, so its reconnect logic can react appropriately, see
+// Client.CloseWithReason.
+type CloseReason struct {
+	Code   int
+	Reason string
+}
+
+// Reasons of closing connections known to kites. Codes 4000-4999 are free
+// for application use.
+var (
+	// CloseShutdown is sent when the kite is shutting down. The clients
+	// reconnect, expecting the kite to come back.
+	CloseShutdown = &CloseReason{Code: 4000, Reason: "shutdown"}
+
+	// CloseAuthExpired is sent when the credentials of the client have
+	// expired. The clients renew their token before reconnecting.
+	CloseAuthExpired = &CloseReason{Code: 4001, Reason: "auth expired"}
+
+	// CloseKicked is sent when the client is disconnected on purpose,
+	// e.g. by an operator. The clients do not reconnect.
+	CloseKicked = &CloseReason{Code: 4002, Reason: "kicked"}
+
+	// CloseOverloaded is sent when the kite sheds load. The clients wait
+	// OverloadedRedialDelay before reconnecting.
+	CloseOverloaded = &CloseReason{Code: 4003, Reason: "overloaded"}
+)
+
+// closeGoAway is the reason connections are closed with by default.
+var closeGoAway = &CloseReason{Code: 3000, Reason: "Go away!"}
+
+// OverloadedRedialDelay is the delay before reconnecting to a kite, which
+// closed the connection because it was overloaded. A random jitter of up to
+// the half of the delay is added, so the clients do not come back at once.
+var OverloadedRedialDelay = 10 * time.Second
+
+func (r *CloseReason) String() string {
+	return r.Reason
+}
+
+// CloseWithReason closes the connection like Close does, sending the given
+// reason to the remote kite.
+//
+// The reason is delivered only to the kites that dialed this one, as only
+// the server side of the connection can send it.
+func (c *Client) CloseWithReason(reason *CloseReason) {
+	c.m.Lock()
+	c.closeWith = reason
+	c.m.Unlock()
+
+	c.Close()
+}
+
+// CloseReason returns the reason the remote kite closed the last connection
+// with, or nil if it was closed without one, e.g. when the network failed.
+func (c *Client) CloseReason() *CloseReason {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return c.remoteClose
+}
+
+// closeReason returns the reason to close the connection with.
+func (c *Client) closeReason() *CloseReason {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	if c.closeWith != nil {
+		return c.closeWith
+	}
+
+	return closeGoAway
+}
+
+// setRemoteClose stores the reason of the remote kite closing the
+// connection, given the error the read loop has ended with.
+func (c *Client) setRemoteClose(err error) *CloseReason {
+	var reason *CloseReason
+
+	if e, ok := err.(*sockjsclient.ErrSession); ok {
+		if ce, ok := e.Err.(*sockjsclient.CloseError); ok {
+			reason = &CloseReason{Code: ce.Code, Reason: ce.Reason}
+		}
+	}
+
+	c.m.Lock()
+	c.remoteClose = reason
+	c.m.Unlock()
+
+	return reason
+}
+
+// redialDelay tells how to react to the remote kite closing the connection
+// with the given reason - whether to reconnect, and how long to wait first.
+func (c *Client) redialDelay(reason *CloseReason) (time.Duration, bool) {
+	if reason == nil {
+		return 0, true
+	}
+
+	switch reason.Code {
+	case CloseKicked.Code:
+		c.LocalKite.Log.Info("Kicked by %q, not reconnecting", c.URL)
+		return 0, false
+	case CloseAuthExpired.Code:
+		c.LocalKite.Log.Info("Authentication to %q has expired, renewing token", c.URL)
+		c.callOnTokenExpireHandlers()
+	case CloseOverloaded.Code:
+		delay := OverloadedRedialDelay
+		if delay > 0 {
+			delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+		}
+
+		c.LocalKite.Log.Info("%q is overloaded, reconnecting in %s", c.URL, delay)
+		return delay, true
+	}
+
+	return 0, true
+}
+
+// closeConnections closes all the connections made to the kite with
+// the given reason.
+func (k *Kite) closeConnections(reason *CloseReason) {
+	k.connsMu.Lock()
+	conns := make([]*Client, 0, len(k.conns))
+	for c := range k.conns {
+		conns = append(conns, c)
+	}
+	k.connsMu.Unlock()
+
+	for _, c := range conns {
+		go c.CloseWithReason(reason)
+	}
+}
@@ -0,0 +1,54 @@
+package kite
+
+import (
+	"testing"
+
+	"github.com/igm/sockjs-go/sockjs"
+	"github.com/koding/kite/sockjsclient"
+)
+
+func TestClient_RedialDelay(t *testing.T) {
+	k := New("close", "0.0.1")
+	defer k.Close()
+
+	c := k.NewClient("http://127.0.0.1:1/kite")
+
+	var expired int
+	c.OnTokenExpire(func() { expired++ })
+
+	closed := func(reason *CloseReason) error {
+		return &sockjsclient.ErrSession{
+			State: sockjs.SessionClosed,
+			Err:   &sockjsclient.CloseError{Code: reason.Code, Reason: reason.Reason},
+		}
+	}
+
+	if delay, redial := c.redialDelay(c.setRemoteClose(closed(CloseShutdown))); !redial || delay != 0 {
+		t.Fatalf("shutdown: got %s, %t", delay, redial)
+	}
+
+	if reason := c.CloseReason(); reason == nil || reason.Code != CloseShutdown.Code {
+		t.Fatalf("got %v, want %v", reason, CloseShutdown)
+	}
+
+	if _, redial := c.redialDelay(c.setRemoteClose(closed(CloseKicked))); redial {
+		t.Fatal("kicked: want no redial")
+	}
+
+	if _, redial := c.redialDelay(c.setRemoteClose(closed(CloseAuthExpired))); !redial || expired != 1 {
+		t.Fatalf("auth expired: got %t, %d token expirations", redial, expired)
+	}
+
+	delay, redial := c.redialDelay(c.setRemoteClose(closed(CloseOverloaded)))
+	if !redial || delay < OverloadedRedialDelay || delay > OverloadedRedialDelay*3/2 {
+		t.Fatalf("overloaded: got %s, %t", delay, redial)
+	}
+
+	if delay, redial := c.redialDelay(c.setRemoteClose(sockjsclient.ErrSessionClosed)); !redial || delay != 0 {
+		t.Fatalf("no reason: got %s, %t", delay, redial)
+	}
+
+	if reason := c.CloseReason(); reason != nil {
+		t.Fatalf("want no reason, got %v", reason)
+	}
+}
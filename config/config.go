@@ -9,8 +9,10 @@ import (
 	"net/http/cookiejar"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/koding/kite/dnode"
 	"github.com/koding/kite/kitekey"
 	"github.com/koding/kite/protocol"
 
@@ -34,10 +36,148 @@ type Config struct {
 	DisableAuthentication bool      // Do not require authentication for requests.
 	DisableConcurrency    bool      // Do not process messages concurrently.
 	Transport             Transport // SockJS transport to use.
+	Color                 string    // Deployment color (e.g. "blue" or "green") to set when registering to Kontrol.
 
 	IP   string // IP of the kite server.
 	Port int    // Port number of the kite server.
 
+	// TLSCertFile and TLSKeyFile are paths of the PEM-encoded certificate
+	// and private key the kite server is served over TLS with, unless
+	// Kite.TLSConfig is set. They may be comma-separated lists of the same
+	// length to serve a certificate per host name, the certificate is
+	// chosen by the name the client requests with SNI.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TLSClientCAFile is the path of the PEM-encoded certificates of
+	// the CAs, which the certificates of the clients are verified with.
+	// Clients without a valid certificate are rejected, unless
+	// TLSClientCertOptional is set, which verifies only the certificates
+	// the clients present.
+	TLSClientCAFile       string
+	TLSClientCertOptional bool
+
+	// LogLevel is the level of the kite logger, one of "debug", "info",
+	// "warning", "error" and "fatal". When empty, the level is read from
+	// the KITE_LOG_LEVEL environment variable.
+	LogLevel string
+
+	// MaxMessageDepth, MaxMessageCallbacks and MaxMessageArgs limit the
+	// nesting depth, the number of callbacks and the number of arguments
+	// of incoming messages. Messages exceeding any of the limits are
+	// rejected with a "messageLimitError" error.
+	//
+	// Zero means no limit.
+	MaxMessageDepth     int
+	MaxMessageCallbacks int
+	MaxMessageArgs      int
+
+	// MaxConcurrentRequests limits the number of calls handled at once,
+	// the calls over the limit wait in a queue, ordered by the priority
+	// hints sent by the callers. MaxQueuedRequests limits the length of
+	// the queue, when it is full the least urgent calls are rejected with
+	// an "overloadedError" error.
+	//
+	// Zero means no limit.
+	MaxConcurrentRequests int
+	MaxQueuedRequests     int
+
+	// MaxConnectionMemory caps the approximate number of bytes held for
+	// a connection: the calls being handled, the messages waiting to be
+	// written and the received chunks of the streams not read yet.
+	// A connection over the cap is not read from until it drops under
+	// the cap, for up to MemoryThrottleTimeout, after which it is closed
+	// with the overloaded reason. Zero MemoryThrottleTimeout closes such
+	// connections right away.
+	//
+	// Zero means no cap.
+	MaxConnectionMemory   int
+	MemoryThrottleTimeout time.Duration
+
+	// RevocationSyncInterval tells how often the kite fetches the tokens
+	// revoked at Kontrol, which are rejected afterwards, see
+	// kite.Kite.RevokeTokens. Zero disables fetching them.
+	RevocationSyncInterval time.Duration
+
+	// RegistrationCheckInterval tells how often a kite registered with
+	// RegisterForever verifies that Kontrol still has its registration,
+	// registering again when it is gone, e.g. after Kontrol's storage
+	// was wiped. Every check queries Kontrol, so it's off by default,
+	// zero disables it.
+	RegistrationCheckInterval time.Duration
+
+	// Modules are names of the modules - sets of handlers registered with
+	// kite.RegisterModule - that are enabled by Kite.LoadModules.
+	Modules []string
+
+	// FileRoot is the directory the kite.file.* methods transfer files
+	// within, see kite.Client.PutFile. The methods can be called by the
+	// owner of the kite only.
+	//
+	// When empty, file transfers are disabled.
+	FileRoot string
+
+	// Impersonators are usernames of the callers, like operators or admin
+	// kites, which are allowed to make requests on behalf of other users,
+	// see kite.WithImpersonation. Every impersonated request is logged.
+	Impersonators []string
+
+	// HTTPCalls enables calling the methods of the kite with plain HTTP
+	// POST requests, see kite.HTTPCallPath. It's disabled by default, as
+	// the requests can be made by any page open in a browser.
+	HTTPCalls bool
+
+	// Trace enables logging of every frame sent and received by the kite,
+	// see Kite.SetTrace. Payloads of the frames are truncated to
+	// TraceMaxPayload bytes, zero means no truncation.
+	Trace           bool
+	TraceMaxPayload int
+
+	// FieldNaming is the naming convention of the keys of JSON objects in
+	// arguments and results of the methods, which allows talking with kites
+	// written in other languages without tagging every struct field. Keys
+	// of the received objects are matched to the struct fields ignoring case
+	// and underscores, keys of the sent ones are converted to the convention.
+	FieldNaming dnode.Naming
+
+	// Numbers tells how the numbers are decoded into the interface{} values
+	// of the arguments and the results of the methods, e.g. as int64 so
+	// the large IDs do not lose their precision, see dnode.NumberMode.
+	Numbers dnode.NumberMode
+
+	// TokenCache makes the clients returned by GetKites share the tokens
+	// of the kites with the same audience, e.g. instances of a service.
+	// The tokens are renewed in background before they expire, at a
+	// random time, so gateway kites holding tokens to many kites do not
+	// renew them all at once.
+	TokenCache bool
+
+	// LocalMode makes the kite work without Kontrol, e.g. when developing
+	// it locally. Register only records the kite and GetKites returns the
+	// kites added with Kite.AddLocalKite and the ones in LocalKites, which
+	// maps kite names to their URLs. Other methods which need Kontrol,
+	// like GetToken, fail with kite.ErrLocalMode.
+	LocalMode  bool
+	LocalKites map[string]string
+
+	// RequireSignedResults makes the kite reject the results of Kontrol
+	// queries which are not signed, or which can't be verified because
+	// the key of Kontrol is not known. Signed results are verified with
+	// the key regardless, once it's known, e.g. from the kite key.
+	//
+	// Older Kontrols do not sign the results, so upgrade Kontrol first
+	// before enabling it.
+	RequireSignedResults bool
+
+	// KiteID is the ID of the kite, which is random for every process
+	// otherwise. With StableID the ID is derived from the kite key,
+	// the hostname, the port and the name, environment and region of
+	// the kite instead, so it is kept across restarts, e.g. for session
+	// affinity and continuity of metrics. KiteID takes precedence over
+	// StableID, see kite.NewKiteID.
+	KiteID   string
+	StableID bool
+
 	// VerifyFunc is used to verify the public key of the signed token.
 	//
 	// If the pub key is not to be trusted, the function must return
@@ -58,6 +198,15 @@ type Config struct {
 	// When 0, the default value of 300s is used.
 	VerifyTTL time.Duration
 
+	// ClockSkew is the tolerated difference between the clocks of the kite
+	// and of the token issuer, applied when validating the exp, nbf and
+	// iat claims of tokens. The skew extends the validity of every token
+	// by that much on both ends, so it should stay small.
+	//
+	// When <=0, no skew is tolerated and the claims are checked against
+	// the local clock exactly. The default is five seconds.
+	ClockSkew time.Duration
+
 	// VerifyAudienceFunc is used to verify the audience of JWT token.
 	//
 	// If nil, the default audience verify function is used which
@@ -84,6 +233,32 @@ type Config struct {
 	// TODO(rjeczalik): Make kite heartbeats configurable as well.
 	Timeout time.Duration
 
+	// CallTimeout is the default timeout of waiting for the reply to
+	// a method call made with Client.Tell or Client.Go, it can be
+	// overridden per client with Client.CallTimeout. The default is one
+	// minute.
+	//
+	// When 0, calls wait for the reply forever.
+	CallTimeout time.Duration
+
+	// PingInterval makes the kite ping the remote kites of the connections,
+	// which did not receive any message for the interval. The connections
+	// which do not receive any message within PongTimeout after the ping
+	// are closed, as the remote kite is gone, so the OnDisconnect handlers
+	// are called right away instead of after the TCP timeouts. Any message
+	// counts as a pong, so busy connections are not pinged at all. The
+	// round trip times of the pings are recorded in kite.Client.Latency.
+	//
+	// When PongTimeout is 0, PingInterval is used. Zero PingInterval
+	// disables the pings.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+
+	// LatencyInterval makes the kite ping the remote kites of all the
+	// connections every interval, to measure the latency of the connections,
+	// see kite.Client.Latency. Zero disables the measurement.
+	LatencyInterval time.Duration
+
 	// Client is a HTTP client used for issuing HTTP register request and
 	// HTTP heartbeats.
 	Client *http.Client
@@ -101,6 +276,19 @@ type Config struct {
 	// Required.
 	SockJS *sockjs.Options
 
+	// Compression enables the permessage-deflate extension of the websocket
+	// connections dialed and accepted by the kite, it is used when the remote
+	// end supports it as well.
+	//
+	// The dialed connections send messages shorter than CompressionThreshold
+	// bytes uncompressed, as compressing them costs more than it saves.
+	// The SockJS server compresses all the messages of the connections it
+	// accepted with the extension. CompressionLevel is the flate level of
+	// the dialed connections, zero means the default one.
+	Compression          bool
+	CompressionThreshold int
+	CompressionLevel     int
+
 	// Serve is serving HTTP requests using handler on requests
 	// comming from the given listener.
 	//
@@ -121,6 +309,18 @@ var DefaultConfig = &Config{
 	Port:        0,
 	Transport:   Auto,
 	Timeout:     15 * time.Second,
+	CallTimeout: time.Minute,
+
+	MaxMessageDepth:     128,
+	MaxMessageCallbacks: 256,
+	MaxMessageArgs:      256,
+
+	TraceMaxPayload: 1024,
+
+	CompressionThreshold: 1024,
+
+	ClockSkew: 5 * time.Second,
+
 	XHR: &http.Client{
 		Jar: CookieJar,
 	},
@@ -162,11 +362,25 @@ func NewFromKiteKey(file string) (*Config, error) {
 	return &c, nil
 }
 
+// Get returns a new Config initialized with defaults, the user's kite key,
+// the config file pointed to by the KITE_CONFIG_FILE environment variable,
+// if set, and the environment variables, in that order of precedence.
+//
+// The profile of the config file is chosen by the environment of the kite,
+// which is read from the KITE_ENVIRONMENT environment variable.
 func Get() (*Config, error) {
 	c := New()
 	if err := c.ReadKiteKey(); err != nil {
 		return nil, err
 	}
+	if file := os.Getenv("KITE_CONFIG_FILE"); file != "" {
+		if environment := os.Getenv("KITE_ENVIRONMENT"); environment != "" {
+			c.Environment = environment
+		}
+		if err := c.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
 	if err := c.ReadEnvironmentVariables(); err != nil {
 		return nil, err
 	}
@@ -208,10 +422,83 @@ func (c *Config) ReadEnvironmentVariables() error {
 		}
 	}
 
+	if certFile := os.Getenv("KITE_TLS_CERT_FILE"); certFile != "" {
+		c.TLSCertFile = certFile
+	}
+
+	if keyFile := os.Getenv("KITE_TLS_KEY_FILE"); keyFile != "" {
+		c.TLSKeyFile = keyFile
+	}
+
+	if caFile := os.Getenv("KITE_TLS_CLIENT_CA_FILE"); caFile != "" {
+		c.TLSClientCAFile = caFile
+	}
+
+	if optional, err := strconv.ParseBool(os.Getenv("KITE_TLS_CLIENT_CERT_OPTIONAL")); err == nil {
+		c.TLSClientCertOptional = optional
+	}
+
 	if kontrolURL := os.Getenv("KITE_KONTROL_URL"); kontrolURL != "" {
 		c.KontrolURL = kontrolURL
 	}
 
+	if color := os.Getenv("KITE_COLOR"); color != "" {
+		c.Color = color
+	}
+
+	if modules := os.Getenv("KITE_MODULES"); modules != "" {
+		c.Modules = strings.Split(modules, ",")
+	}
+
+	if fileRoot := os.Getenv("KITE_FILE_ROOT"); fileRoot != "" {
+		c.FileRoot = fileRoot
+	}
+
+	if impersonators := os.Getenv("KITE_IMPERSONATORS"); impersonators != "" {
+		c.Impersonators = strings.Split(impersonators, ",")
+	}
+
+	if httpCalls, err := strconv.ParseBool(os.Getenv("KITE_HTTP_CALLS")); err == nil {
+		c.HTTPCalls = httpCalls
+	}
+
+	if trace, err := strconv.ParseBool(os.Getenv("KITE_TRACE")); err == nil {
+		c.Trace = trace
+	}
+
+	if tokenCache, err := strconv.ParseBool(os.Getenv("KITE_TOKEN_CACHE")); err == nil {
+		c.TokenCache = tokenCache
+	}
+
+	if localMode, err := strconv.ParseBool(os.Getenv("KITE_LOCAL_MODE")); err == nil {
+		c.LocalMode = localMode
+	}
+
+	if signed, err := strconv.ParseBool(os.Getenv("KITE_REQUIRE_SIGNED_RESULTS")); err == nil {
+		c.RequireSignedResults = signed
+	}
+
+	if kiteID := os.Getenv("KITE_ID"); kiteID != "" {
+		c.KiteID = kiteID
+	}
+
+	if stableID, err := strconv.ParseBool(os.Getenv("KITE_STABLE_ID")); err == nil {
+		c.StableID = stableID
+	}
+
+	if localKites := os.Getenv("KITE_LOCAL_KITES"); localKites != "" {
+		c.LocalKites = make(map[string]string)
+
+		for _, kite := range strings.Split(localKites, ",") {
+			i := strings.IndexRune(kite, '=')
+			if i == -1 {
+				return fmt.Errorf("local kite '%s' is not in name=url form", kite)
+			}
+
+			c.LocalKites[kite[:i]] = kite[i+1:]
+		}
+	}
+
 	if transportName := os.Getenv("KITE_TRANSPORT"); transportName != "" {
 		transport, ok := Transports[transportName]
 		if !ok {
@@ -221,19 +508,93 @@ func (c *Config) ReadEnvironmentVariables() error {
 		c.Transport = transport
 	}
 
+	if namingName := os.Getenv("KITE_FIELD_NAMING"); namingName != "" {
+		naming, ok := dnode.Namings[namingName]
+		if !ok {
+			return fmt.Errorf("field naming '%s' doesn't exists", namingName)
+		}
+
+		c.FieldNaming = naming
+	}
+
+	if numbersName := os.Getenv("KITE_NUMBERS"); numbersName != "" {
+		numbers, ok := dnode.NumberModes[numbersName]
+		if !ok {
+			return fmt.Errorf("number mode '%s' doesn't exists", numbersName)
+		}
+
+		c.Numbers = numbers
+	}
+
+	if max, err := strconv.Atoi(os.Getenv("KITE_MAX_CONCURRENT_REQUESTS")); err == nil {
+		c.MaxConcurrentRequests = max
+	}
+
+	if max, err := strconv.Atoi(os.Getenv("KITE_MAX_QUEUED_REQUESTS")); err == nil {
+		c.MaxQueuedRequests = max
+	}
+
+	if max, err := strconv.Atoi(os.Getenv("KITE_MAX_CONNECTION_MEMORY")); err == nil {
+		c.MaxConnectionMemory = max
+	}
+
+	if timeout, err := time.ParseDuration(os.Getenv("KITE_MEMORY_THROTTLE_TIMEOUT")); err == nil {
+		c.MemoryThrottleTimeout = timeout
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv("KITE_REVOCATION_SYNC_INTERVAL")); err == nil {
+		c.RevocationSyncInterval = interval
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv("KITE_REGISTRATION_CHECK_INTERVAL")); err == nil {
+		c.RegistrationCheckInterval = interval
+	}
+
 	if ttl, err := time.ParseDuration(os.Getenv("KITE_VERIFY_TTL")); err == nil {
 		c.VerifyTTL = ttl
 	}
 
+	if skew, err := time.ParseDuration(os.Getenv("KITE_CLOCK_SKEW")); err == nil {
+		c.ClockSkew = skew
+	}
+
 	if timeout, err := time.ParseDuration(os.Getenv("KITE_TIMEOUT")); err == nil {
 		c.Timeout = timeout
 		c.Client.Timeout = timeout
 	}
 
+	if timeout, err := time.ParseDuration(os.Getenv("KITE_CALL_TIMEOUT")); err == nil {
+		c.CallTimeout = timeout
+	}
+
 	if timeout, err := time.ParseDuration(os.Getenv("KITE_HANDSHAKE_TIMEOUT")); err == nil {
 		c.Websocket.HandshakeTimeout = timeout
 	}
 
+	if interval, err := time.ParseDuration(os.Getenv("KITE_PING_INTERVAL")); err == nil {
+		c.PingInterval = interval
+	}
+
+	if timeout, err := time.ParseDuration(os.Getenv("KITE_PONG_TIMEOUT")); err == nil {
+		c.PongTimeout = timeout
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv("KITE_LATENCY_INTERVAL")); err == nil {
+		c.LatencyInterval = interval
+	}
+
+	if compression, err := strconv.ParseBool(os.Getenv("KITE_COMPRESSION")); err == nil {
+		c.Compression = compression
+	}
+
+	if threshold, err := strconv.Atoi(os.Getenv("KITE_COMPRESSION_THRESHOLD")); err == nil {
+		c.CompressionThreshold = threshold
+	}
+
+	if level, err := strconv.Atoi(os.Getenv("KITE_COMPRESSION_LEVEL")); err == nil {
+		c.CompressionLevel = level
+	}
+
 	return nil
 }
 
@@ -284,5 +645,20 @@ func (c *Config) Copy() *Config {
 		copy.Websocket = &ws
 	}
 
+	if c.Modules != nil {
+		copy.Modules = append([]string(nil), c.Modules...)
+	}
+
+	if c.Impersonators != nil {
+		copy.Impersonators = append([]string(nil), c.Impersonators...)
+	}
+
+	if c.LocalKites != nil {
+		copy.LocalKites = make(map[string]string, len(c.LocalKites))
+		for name, url := range c.LocalKites {
+			copy.LocalKites[name] = url
+		}
+	}
+
 	return &copy
 }
@@ -1,9 +1,14 @@
 package config_test
 
 import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/koding/kite/config"
 
@@ -30,3 +35,143 @@ func TestConfigCopy(t *testing.T) {
 		}
 	}
 }
+
+func TestConfigReadFile(t *testing.T) {
+	const file = `{
+	  "profiles": {
+	    "default": {"region": "us-east-1", "timeout": "10s", "port": 3000},
+	    "staging": {"kontrolURL": "https://staging.example.com/kontrol/kite"},
+	    "production": {
+	      "inherits": "staging",
+	      "port": 4000,
+	      "callTimeout": "1m",
+	      "pingInterval": "30s",
+	      "pongTimeout": "10s",
+	      "latencyInterval": "5m",
+	      "compression": true,
+	      "compressionThreshold": 512,
+	      "compressionLevel": 6,
+	      "modules": ["fs", "exec"]
+	    },
+	    "isolated": {"inherits": "", "region": "eu-west-1"}
+	  }
+	}`
+
+	f, err := ioutil.TempFile("", "kite-config")
+	if err != nil {
+		t.Fatalf("TempFile()=%s", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(file); err != nil {
+		t.Fatalf("WriteString()=%s", err)
+	}
+	f.Close()
+
+	cases := []struct {
+		env  string
+		want *config.Config
+	}{{
+		"production", &config.Config{
+			Region:               "us-east-1",
+			Port:                 4000,
+			Timeout:              10 * time.Second,
+			CallTimeout:          time.Minute,
+			PingInterval:         30 * time.Second,
+			PongTimeout:          10 * time.Second,
+			LatencyInterval:      5 * time.Minute,
+			Compression:          true,
+			CompressionThreshold: 512,
+			CompressionLevel:     6,
+			KontrolURL:           "https://staging.example.com/kontrol/kite",
+			Modules:              []string{"fs", "exec"},
+		},
+	}, {
+		"staging", &config.Config{
+			Region:     "us-east-1",
+			Port:       3000,
+			Timeout:    10 * time.Second,
+			KontrolURL: "https://staging.example.com/kontrol/kite",
+		},
+	}, {
+		"development", &config.Config{
+			Region:  "us-east-1",
+			Port:    3000,
+			Timeout: 10 * time.Second,
+		},
+	}, {
+		"isolated", &config.Config{
+			Region: "eu-west-1",
+		},
+	}}
+
+	for _, cas := range cases {
+		c := &config.Config{Environment: cas.env}
+
+		if err := c.ReadFile(f.Name()); err != nil {
+			t.Fatalf("%s: ReadFile()=%s", cas.env, err)
+		}
+
+		cas.want.Environment = cas.env
+
+		if !reflect.DeepEqual(c, cas.want) {
+			t.Errorf("%s: got %+v, want %+v", cas.env, c, cas.want)
+		}
+	}
+}
+
+func TestFileProfileCycle(t *testing.T) {
+	f := &config.File{
+		Profiles: map[string]json.RawMessage{
+			"a": json.RawMessage(`{"inherits": "b"}`),
+			"b": json.RawMessage(`{"inherits": "a"}`),
+		},
+	}
+
+	if _, err := f.Profile("a"); err == nil {
+		t.Fatal("expected error for inheritance cycle")
+	}
+}
+
+func TestConfigFlagSet(t *testing.T) {
+	c := config.New()
+	c.Region = "us-east-1"
+
+	fs := c.FlagSet(flag.NewFlagSet("kite", flag.ContinueOnError))
+
+	args := []string{
+		"-port", "4000",
+		"-kontrol-url", "https://example.com/kontrol/kite",
+		"-log-level", "DEBUG",
+		"-tls-cert", "cert.pem",
+		"-tls-key", "key.pem",
+		"-timeout", "5s",
+		"-stable-id",
+		"-tls-client-ca", "ca.pem",
+	}
+
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Parse()=%s", err)
+	}
+
+	if c.Port != 4000 || c.KontrolURL != "https://example.com/kontrol/kite" || c.LogLevel != "debug" ||
+		c.TLSCertFile != "cert.pem" || c.TLSKeyFile != "key.pem" || !c.StableID ||
+		c.TLSClientCAFile != "ca.pem" {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+
+	if c.Timeout != 5*time.Second || c.Client.Timeout != 5*time.Second {
+		t.Fatalf("got timeouts %s and %s, want 5s", c.Timeout, c.Client.Timeout)
+	}
+
+	if c.Region != "us-east-1" {
+		t.Fatalf("got region %q, want the default to be kept", c.Region)
+	}
+
+	fs = c.FlagSet(flag.NewFlagSet("kite", flag.ContinueOnError))
+	fs.SetOutput(ioutil.Discard)
+
+	if err := fs.Parse([]string{"-log-level", "verbose"}); err == nil {
+		t.Fatal("expected unknown log level to fail")
+	}
+}
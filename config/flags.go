@@ -0,0 +1,98 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// LogLevels are the names of the levels accepted by Config.LogLevel.
+var LogLevels = []string{"debug", "info", "warning", "error", "fatal"}
+
+// FlagSet registers the standard kite options on the fs, bound to the fields
+// of the config, so every kite binary gets the same command line options:
+//
+//     conf := config.MustGet()
+//     fs := conf.FlagSet(nil)
+//     fs.Parse(os.Args[1:])
+//
+//     k := kite.NewWithConfig("mykite", "1.0.0", conf)
+//
+// The current values of the fields are used as the defaults of the flags,
+// so the flags take precedence over the kite key and the environment
+// variables read beforehand. If fs is nil, a new flag set named after the
+// program is created.
+func (c *Config) FlagSet(fs *flag.FlagSet) *flag.FlagSet {
+	if fs == nil {
+		fs = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	}
+
+	fs.StringVar(&c.IP, "ip", c.IP, "IP address the kite server listens on.")
+	fs.IntVar(&c.Port, "port", c.Port, "Port the kite server listens on, 0 picks a random one.")
+	fs.StringVar(&c.Username, "username", c.Username, "Username of the kite.")
+	fs.StringVar(&c.Environment, "environment", c.Environment, "Environment of the kite.")
+	fs.StringVar(&c.Region, "region", c.Region, "Region of the kite.")
+	fs.StringVar(&c.Color, "color", c.Color, "Deployment color of the kite.")
+	fs.StringVar(&c.KontrolURL, "kontrol-url", c.KontrolURL, "URL of Kontrol to register to.")
+	fs.StringVar(&c.TLSCertFile, "tls-cert", c.TLSCertFile, "PEM-encoded TLS certificate file.")
+	fs.StringVar(&c.TLSKeyFile, "tls-key", c.TLSKeyFile, "PEM-encoded TLS private key file.")
+	fs.StringVar(&c.TLSClientCAFile, "tls-client-ca", c.TLSClientCAFile, "PEM-encoded CA certificates file to verify client certificates with.")
+	fs.Var((*logLevelValue)(c), "log-level", "Log level, one of: "+strings.Join(LogLevels, ", ")+".")
+	fs.Var((*timeoutValue)(c), "timeout", "Timeout of dialing, XHR polling and Kontrol requests.")
+	fs.StringVar(&c.KiteID, "id", c.KiteID, "ID of the kite, random if empty.")
+	fs.BoolVar(&c.StableID, "stable-id", c.StableID, "Derive the ID of the kite from its kite key, host and port.")
+	fs.BoolVar(&c.LocalMode, "local", c.LocalMode, "Run without Kontrol, registering and discovering kites locally.")
+	fs.DurationVar(&c.CallTimeout, "call-timeout", c.CallTimeout, "Default timeout of method calls, 0 waits forever.")
+
+	return fs
+}
+
+type logLevelValue Config
+
+func (v *logLevelValue) String() string {
+	return v.LogLevel
+}
+
+func (v *logLevelValue) Set(s string) error {
+	if !isLogLevel(s) {
+		return fmt.Errorf("unknown log level %q", s)
+	}
+
+	v.LogLevel = strings.ToLower(s)
+	return nil
+}
+
+// timeoutValue sets the timeout of the HTTP client as well, like the
+// KITE_TIMEOUT environment variable does.
+type timeoutValue Config
+
+func (v *timeoutValue) String() string {
+	return v.Timeout.String()
+}
+
+func (v *timeoutValue) Set(s string) error {
+	timeout, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	v.Timeout = timeout
+
+	if v.Client != nil {
+		v.Client.Timeout = timeout
+	}
+
+	return nil
+}
+
+func isLogLevel(s string) bool {
+	for _, level := range LogLevels {
+		if strings.EqualFold(s, level) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,340 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+// DefaultProfile is the name of the profile which is used when there is no
+// profile for the environment of the kite, and which the other profiles
+// inherit from unless they say otherwise.
+const DefaultProfile = "default"
+
+// File is a config file with settings for several deployments of a kite.
+// It is a JSON document like:
+//
+//     {
+//       "profiles": {
+//         "default": {"region": "us-east-1", "timeout": "15s"},
+//         "staging": {"kontrolURL": "https://staging.example.com/kontrol/kite"},
+//         "production": {
+//           "inherits": "staging",
+//           "kontrolURL": "https://example.com/kontrol/kite",
+//           "maxConcurrentRequests": 512
+//         }
+//       }
+//     }
+//
+// A profile inherits the settings of the profile named by its "inherits"
+// key, or of the default profile, overriding the ones it sets itself. An empty
+// "inherits" key disables the inheritance.
+type File struct {
+	Profiles map[string]json.RawMessage `json:"profiles"`
+}
+
+// Profile holds the settings of a single profile. Nil fields are not set
+// by the profile.
+type Profile struct {
+	Inherits string `json:"inherits,omitempty"`
+
+	Username    *string `json:"username,omitempty"`
+	Environment *string `json:"environment,omitempty"`
+	Region      *string `json:"region,omitempty"`
+	IP          *string `json:"ip,omitempty"`
+	Port        *int    `json:"port,omitempty"`
+	Color       *string `json:"color,omitempty"`
+	Transport   *string `json:"transport,omitempty"`
+	FieldNaming *string `json:"fieldNaming,omitempty"`
+	Numbers     *string `json:"numbers,omitempty"`
+	LogLevel    *string `json:"logLevel,omitempty"`
+	TLSCertFile *string `json:"tlsCertFile,omitempty"`
+	TLSKeyFile  *string `json:"tlsKeyFile,omitempty"`
+
+	TLSClientCAFile       *string `json:"tlsClientCAFile,omitempty"`
+	TLSClientCertOptional *bool   `json:"tlsClientCertOptional,omitempty"`
+
+	KontrolURL  *string `json:"kontrolURL,omitempty"`
+	KontrolUser *string `json:"kontrolUser,omitempty"`
+
+	KiteID   *string `json:"kiteId,omitempty"`
+	StableID *bool   `json:"stableId,omitempty"`
+
+	FileRoot      *string  `json:"fileRoot,omitempty"`
+	Modules       []string `json:"modules,omitempty"`
+	Impersonators []string `json:"impersonators,omitempty"`
+
+	Trace           *bool `json:"trace,omitempty"`
+	TraceMaxPayload *int  `json:"traceMaxPayload,omitempty"`
+	TokenCache      *bool `json:"tokenCache,omitempty"`
+
+	RequireSignedResults *bool `json:"requireSignedResults,omitempty"`
+	LocalMode            *bool `json:"localMode,omitempty"`
+
+	LocalKites map[string]string `json:"localKites,omitempty"`
+
+	MaxMessageDepth       *int `json:"maxMessageDepth,omitempty"`
+	MaxMessageCallbacks   *int `json:"maxMessageCallbacks,omitempty"`
+	MaxMessageArgs        *int `json:"maxMessageArgs,omitempty"`
+	MaxConcurrentRequests *int `json:"maxConcurrentRequests,omitempty"`
+	MaxQueuedRequests     *int `json:"maxQueuedRequests,omitempty"`
+	MaxConnectionMemory   *int `json:"maxConnectionMemory,omitempty"`
+
+	Compression          *bool `json:"compression,omitempty"`
+	CompressionThreshold *int  `json:"compressionThreshold,omitempty"`
+	CompressionLevel     *int  `json:"compressionLevel,omitempty"`
+
+	Timeout                   *Duration `json:"timeout,omitempty"`
+	CallTimeout               *Duration `json:"callTimeout,omitempty"`
+	HandshakeTimeout          *Duration `json:"handshakeTimeout,omitempty"`
+	ClockSkew                 *Duration `json:"clockSkew,omitempty"`
+	VerifyTTL                 *Duration `json:"verifyTTL,omitempty"`
+	RegistrationCheckInterval *Duration `json:"registrationCheckInterval,omitempty"`
+	MemoryThrottleTimeout     *Duration `json:"memoryThrottleTimeout,omitempty"`
+	RevocationSyncInterval    *Duration `json:"revocationSyncInterval,omitempty"`
+	PingInterval              *Duration `json:"pingInterval,omitempty"`
+	PongTimeout               *Duration `json:"pongTimeout,omitempty"`
+	LatencyInterval           *Duration `json:"latencyInterval,omitempty"`
+}
+
+// Duration is a time.Duration which is encoded in JSON as a string,
+// like "1m30s".
+type Duration time.Duration
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *Duration) UnmarshalJSON(p []byte) error {
+	var s string
+	if err := json.Unmarshal(p, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+// ReadFile reads the config file and applies the settings of the profile
+// named after c.Environment, or of the default profile if the file has no
+// such profile.
+func (c *Config) ReadFile(file string) error {
+	p, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var f File
+	if err := json.Unmarshal(p, &f); err != nil {
+		return fmt.Errorf("config: unable to read %q: %s", file, err)
+	}
+
+	name := c.Environment
+	if _, ok := f.Profiles[name]; !ok {
+		name = DefaultProfile
+	}
+
+	if _, ok := f.Profiles[name]; !ok {
+		return nil
+	}
+
+	profile, err := f.Profile(name)
+	if err != nil {
+		return fmt.Errorf("config: unable to read %q: %s", file, err)
+	}
+
+	return c.ApplyProfile(profile)
+}
+
+// Profile gives the settings of the named profile, merged with the
+// settings of the profiles it inherits from.
+func (f *File) Profile(name string) (*Profile, error) {
+	var chain []json.RawMessage
+	seen := make(map[string]bool)
+
+	for name != "" {
+		if seen[name] {
+			return nil, fmt.Errorf("profile %q inherits from itself", name)
+		}
+		seen[name] = true
+
+		raw, ok := f.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("profile %q does not exist", name)
+		}
+
+		var p struct {
+			Inherits *string `json:"inherits"`
+		}
+
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return nil, fmt.Errorf("profile %q: %s", name, err)
+		}
+
+		chain = append(chain, raw)
+
+		next := ""
+		if p.Inherits != nil {
+			next = *p.Inherits
+		} else if _, ok := f.Profiles[DefaultProfile]; ok && name != DefaultProfile {
+			next = DefaultProfile
+		}
+
+		name = next
+	}
+
+	// Apply the settings from the most distant ancestor, so that each
+	// profile overrides the ones it inherits from.
+	var profile Profile
+	for i := len(chain) - 1; i >= 0; i-- {
+		if err := json.Unmarshal(chain[i], &profile); err != nil {
+			return nil, err
+		}
+	}
+
+	return &profile, nil
+}
+
+// ApplyProfile sets the fields of the config to the settings of the profile.
+func (c *Config) ApplyProfile(p *Profile) error {
+	setString(&c.Username, p.Username)
+	setString(&c.Environment, p.Environment)
+	setString(&c.Region, p.Region)
+	setString(&c.IP, p.IP)
+	setString(&c.Color, p.Color)
+	setString(&c.KontrolURL, p.KontrolURL)
+	setString(&c.KontrolUser, p.KontrolUser)
+	setString(&c.FileRoot, p.FileRoot)
+	setString(&c.KiteID, p.KiteID)
+	setString(&c.TLSCertFile, p.TLSCertFile)
+	setString(&c.TLSKeyFile, p.TLSKeyFile)
+	setString(&c.TLSClientCAFile, p.TLSClientCAFile)
+
+	setInt(&c.Port, p.Port)
+	setInt(&c.TraceMaxPayload, p.TraceMaxPayload)
+	setInt(&c.MaxMessageDepth, p.MaxMessageDepth)
+	setInt(&c.MaxMessageCallbacks, p.MaxMessageCallbacks)
+	setInt(&c.MaxMessageArgs, p.MaxMessageArgs)
+	setInt(&c.MaxConcurrentRequests, p.MaxConcurrentRequests)
+	setInt(&c.MaxQueuedRequests, p.MaxQueuedRequests)
+	setInt(&c.MaxConnectionMemory, p.MaxConnectionMemory)
+	setInt(&c.CompressionThreshold, p.CompressionThreshold)
+	setInt(&c.CompressionLevel, p.CompressionLevel)
+
+	setBool(&c.Trace, p.Trace)
+	setBool(&c.TokenCache, p.TokenCache)
+	setBool(&c.RequireSignedResults, p.RequireSignedResults)
+	setBool(&c.LocalMode, p.LocalMode)
+	setBool(&c.StableID, p.StableID)
+	setBool(&c.TLSClientCertOptional, p.TLSClientCertOptional)
+	setBool(&c.Compression, p.Compression)
+
+	setDuration(&c.CallTimeout, p.CallTimeout)
+	setDuration(&c.ClockSkew, p.ClockSkew)
+	setDuration(&c.VerifyTTL, p.VerifyTTL)
+	setDuration(&c.RegistrationCheckInterval, p.RegistrationCheckInterval)
+	setDuration(&c.MemoryThrottleTimeout, p.MemoryThrottleTimeout)
+	setDuration(&c.RevocationSyncInterval, p.RevocationSyncInterval)
+	setDuration(&c.PingInterval, p.PingInterval)
+	setDuration(&c.PongTimeout, p.PongTimeout)
+	setDuration(&c.LatencyInterval, p.LatencyInterval)
+
+	if p.Modules != nil {
+		c.Modules = append([]string(nil), p.Modules...)
+	}
+
+	if p.LocalKites != nil {
+		c.LocalKites = make(map[string]string, len(p.LocalKites))
+		for name, url := range p.LocalKites {
+			c.LocalKites[name] = url
+		}
+	}
+
+	if p.Impersonators != nil {
+		c.Impersonators = append([]string(nil), p.Impersonators...)
+	}
+
+	if p.Timeout != nil {
+		c.Timeout = time.Duration(*p.Timeout)
+
+		if c.Client != nil {
+			c.Client.Timeout = c.Timeout
+		}
+	}
+
+	if p.HandshakeTimeout != nil && c.Websocket != nil {
+		c.Websocket.HandshakeTimeout = time.Duration(*p.HandshakeTimeout)
+	}
+
+	if p.Transport != nil {
+		transport, ok := Transports[*p.Transport]
+		if !ok {
+			return fmt.Errorf("transport '%s' doesn't exists", *p.Transport)
+		}
+
+		c.Transport = transport
+	}
+
+	if p.LogLevel != nil {
+		if !isLogLevel(*p.LogLevel) {
+			return fmt.Errorf("log level '%s' doesn't exists", *p.LogLevel)
+		}
+
+		c.LogLevel = *p.LogLevel
+	}
+
+	if p.FieldNaming != nil {
+		naming, ok := dnode.Namings[*p.FieldNaming]
+		if !ok {
+			return fmt.Errorf("field naming '%s' doesn't exists", *p.FieldNaming)
+		}
+
+		c.FieldNaming = naming
+	}
+
+	if p.Numbers != nil {
+		numbers, ok := dnode.NumberModes[*p.Numbers]
+		if !ok {
+			return fmt.Errorf("number mode '%s' doesn't exists", *p.Numbers)
+		}
+
+		c.Numbers = numbers
+	}
+
+	return nil
+}
+
+func setString(dst *string, src *string) {
+	if src != nil {
+		*dst = strings.TrimSpace(*src)
+	}
+}
+
+func setInt(dst *int, src *int) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+func setBool(dst *bool, src *bool) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+func setDuration(dst *time.Duration, src *Duration) {
+	if src != nil {
+		*dst = time.Duration(*src)
+	}
+}
@@ -0,0 +1,490 @@
+// Package consul registers kites as services of Consul and resolves them,
+// so the kites can find each other without Kontrol:
+//
+//     c := consul.New(nil) // the local agent, see Config
+//
+//     if err := c.Register(k, kiteURL); err != nil {
+//         return err
+//     }
+//
+//     clients, err := c.GetKites(k, &protocol.KontrolQuery{
+//         Username:    "koding",
+//         Environment: "production",
+//         Name:        "fs",
+//     })
+//
+// A kite is registered as a service named after the kite, with the ID of
+// the kite as the ID of the service. The other fields of the kite are
+// stored as tags, e.g. "environment=production", and in the metadata of
+// the service. The service has a TTL health check, which is passed
+// periodically while the kite is registered, so Consul stops returning
+// the kites which have died.
+//
+// The kites resolved with Consul are authenticated with the kite key of
+// the calling kite, as there are no tokens issued by Kontrol.
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-version"
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+)
+
+// Config configures the connection to the Consul agent.
+type Config struct {
+	// Address is the address of the HTTP API of the agent, like
+	// "127.0.0.1:8500" or "https://consul.example.com".
+	//
+	// When empty, the CONSUL_HTTP_ADDR environment variable is used, or
+	// "127.0.0.1:8500" if it's not set.
+	Address string
+
+	// Token is the ACL token sent with the requests.
+	//
+	// When empty, the CONSUL_HTTP_TOKEN environment variable is used.
+	Token string
+
+	// Datacenter is the datacenter the kites are resolved in. When empty,
+	// the one of the agent is used.
+	Datacenter string
+
+	// TTL is the TTL of the health checks of the registered kites, they
+	// are passed every third of it.
+	//
+	// When 0, the default value of 30s is used.
+	TTL time.Duration
+
+	// DeregisterAfter is the time after which the kites with failing
+	// health checks are deregistered by Consul.
+	//
+	// When 0, the default value of 10m is used.
+	DeregisterAfter time.Duration
+
+	// Client is used for the requests to the agent.
+	//
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Consul registers and resolves kites with a Consul agent.
+type Consul struct {
+	addr   string
+	config Config
+
+	mu      sync.Mutex
+	renewal map[string]*renewal // by the IDs of the kites
+}
+
+// renewal passes the health checks of a registered kite.
+type renewal struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (r *renewal) close() {
+	close(r.stop)
+	<-r.done
+}
+
+// New returns a new Consul using the given config, which may be nil.
+func New(cfg *Config) *Consul {
+	c := &Consul{
+		renewal: make(map[string]*renewal),
+	}
+
+	if cfg != nil {
+		c.config = *cfg
+	}
+
+	if c.config.Address == "" {
+		c.config.Address = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+
+	if c.config.Address == "" {
+		c.config.Address = "127.0.0.1:8500"
+	}
+
+	if c.config.Token == "" {
+		c.config.Token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+
+	if c.config.TTL == 0 {
+		c.config.TTL = 30 * time.Second
+	}
+
+	if c.config.DeregisterAfter == 0 {
+		c.config.DeregisterAfter = 10 * time.Minute
+	}
+
+	if c.config.Client == nil {
+		c.config.Client = http.DefaultClient
+	}
+
+	c.addr = c.config.Address
+	if !strings.Contains(c.addr, "://") {
+		c.addr = "http://" + c.addr
+	}
+
+	c.addr = strings.TrimSuffix(c.addr, "/")
+
+	return c
+}
+
+// Error is returned for the requests rejected by the agent.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("consul: %d %s", e.StatusCode, e.Message)
+}
+
+// service is the registration of a kite, see the /agent/service/register
+// endpoint of the Consul API.
+type service struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Tags    []string          `json:"Tags,omitempty"`
+	Address string            `json:"Address,omitempty"`
+	Port    int               `json:"Port,omitempty"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Check   *check            `json:"Check,omitempty"`
+}
+
+type check struct {
+	CheckID                        string `json:"CheckID,omitempty"`
+	Name                           string `json:"Name,omitempty"`
+	TTL                            string `json:"TTL,omitempty"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter,omitempty"`
+}
+
+// serviceEntry is an element of the response of the /health/service
+// endpoint of the Consul API.
+type serviceEntry struct {
+	Service service `json:"Service"`
+}
+
+// urlMeta is the key of the metadata holding the URL of the kite.
+const urlMeta = "kite_url"
+
+// fields are the fields of the kite stored as the tags of its service,
+// the name and the ID are the ones of the service itself.
+var fields = []string{"username", "environment", "version", "region", "hostname"}
+
+// Tags returns the tags of the service of the kite.
+func Tags(k *protocol.Kite) []string {
+	values := k.Query().Fields()
+	tags := make([]string, 0, len(fields))
+
+	for _, field := range fields {
+		tags = append(tags, field+"="+values[field])
+	}
+
+	return tags
+}
+
+// CheckID returns the ID of the health check of the kite with the given ID.
+func CheckID(id string) string {
+	return "kite:" + id
+}
+
+// Register registers the kite listening on the URL as a service and
+// passes its health check until the kite is deregistered. The kite is
+// deregistered when it is shut down, see kite.Kite.Shutdown.
+func (c *Consul) Register(k *kite.Kite, kiteURL *url.URL) error {
+	pk := k.Kite()
+
+	if err := c.register(pk, kiteURL); err != nil {
+		return err
+	}
+
+	r := &renewal{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	c.mu.Lock()
+	prev, registered := c.renewal[pk.ID]
+	c.renewal[pk.ID] = r
+	c.mu.Unlock()
+
+	if registered {
+		prev.close()
+	}
+
+	go c.passChecks(k, pk, kiteURL, r)
+
+	if registered {
+		return nil
+	}
+
+	k.OnShutdown(kite.ShutdownDeregister, func(ctx context.Context) {
+		if err := c.Deregister(k); err != nil {
+			k.Log.Warning("Deregistering from Consul failed: %s", err)
+		}
+	})
+
+	return nil
+}
+
+func (c *Consul) register(k *protocol.Kite, kiteURL *url.URL) error {
+	s := &service{
+		ID:   k.ID,
+		Name: k.Name,
+		Tags: Tags(k),
+		Meta: k.Query().Fields(),
+		Check: &check{
+			CheckID:                        CheckID(k.ID),
+			Name:                           "kite " + k.Name,
+			TTL:                            c.config.TTL.String(),
+			DeregisterCriticalServiceAfter: c.config.DeregisterAfter.String(),
+		},
+	}
+
+	s.Meta[urlMeta] = kiteURL.String()
+
+	host, port, err := net.SplitHostPort(kiteURL.Host)
+	if err != nil {
+		host = kiteURL.Host
+	} else {
+		s.Port, _ = strconv.Atoi(port)
+	}
+
+	s.Address = host
+
+	if err := c.do("PUT", "/v1/agent/service/register", nil, s, nil); err != nil {
+		return err
+	}
+
+	return c.pass(k.ID)
+}
+
+func (c *Consul) pass(id string) error {
+	return c.do("PUT", "/v1/agent/check/pass/"+url.PathEscape(CheckID(id)), nil, nil, nil)
+}
+
+// passChecks passes the health check of the kite until the renewal is
+// closed. The kite is registered again if the agent has lost it, e.g.
+// after it was restarted.
+func (c *Consul) passChecks(k *kite.Kite, pk *protocol.Kite, kiteURL *url.URL, r *renewal) {
+	t := time.NewTicker(c.config.TTL / 3)
+	defer t.Stop()
+	defer close(r.done)
+
+	for {
+		select {
+		case <-t.C:
+		case <-r.stop:
+			return
+		}
+
+		err := c.pass(pk.ID)
+
+		if e, ok := err.(*Error); ok && e.StatusCode == http.StatusNotFound {
+			err = c.register(pk, kiteURL)
+		}
+
+		if err != nil {
+			k.Log.Warning("Passing health check to Consul failed: %s", err)
+		}
+	}
+}
+
+// Deregister deregisters the kite, so it's not resolved anymore.
+func (c *Consul) Deregister(k *kite.Kite) error {
+	c.mu.Lock()
+	r, ok := c.renewal[k.Id]
+	delete(c.renewal, k.Id)
+	c.mu.Unlock()
+
+	// The health check is not passed anymore, so the kite is not
+	// registered again after it's deregistered.
+	if ok {
+		r.close()
+	}
+
+	return c.do("PUT", "/v1/agent/service/deregister/"+url.PathEscape(k.Id), nil, nil, nil)
+}
+
+// GetKites returns the clients of the healthy kites matching the query,
+// in random order, like kite.Kite.GetKites. The Name field of the query
+// is required, the Version field may be a constraint like ">= 1.0, < 1.4".
+//
+// It returns kite.ErrNoKitesAvailable if there are no matching kites.
+func (c *Consul) GetKites(k *kite.Kite, query *protocol.KontrolQuery) ([]*kite.Client, error) {
+	kites, err := c.Resolve(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(kites) == 0 {
+		return nil, kite.ErrNoKitesAvailable
+	}
+
+	clients := make([]*kite.Client, len(kites))
+	for i, kt := range kites {
+		clients[i] = k.NewClient(kt.URL)
+		clients[i].Kite = kt.Kite
+		clients[i].Auth = &kite.Auth{
+			Type: "kiteKey",
+			Key:  k.KiteKey(),
+		}
+	}
+
+	return clients, nil
+}
+
+// Resolve returns the healthy kites matching the query with their URLs,
+// see GetKites.
+func (c *Consul) Resolve(query *protocol.KontrolQuery) ([]*protocol.KiteWithToken, error) {
+	if query.Name == "" {
+		return nil, errors.New("consul: empty name field")
+	}
+
+	var constraint version.Constraints
+	if query.Version != "" {
+		if _, err := version.NewVersion(query.Version); err != nil {
+			constraint, err = version.NewConstraint(query.Version)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	params := url.Values{"passing": {"1"}}
+
+	if query.Username != "" {
+		params.Set("tag", "username="+query.Username)
+	}
+
+	if c.config.Datacenter != "" {
+		params.Set("dc", c.config.Datacenter)
+	}
+
+	var entries []serviceEntry
+
+	if err := c.do("GET", "/v1/health/service/"+url.PathEscape(query.Name), params, nil, &entries); err != nil {
+		return nil, err
+	}
+
+	kites := make([]*protocol.KiteWithToken, 0, len(entries))
+
+	for _, e := range entries {
+		k := &protocol.KiteWithToken{
+			Kite: protocol.Kite{
+				Username:    e.Service.Meta["username"],
+				Environment: e.Service.Meta["environment"],
+				Name:        e.Service.Name,
+				Version:     e.Service.Meta["version"],
+				Region:      e.Service.Meta["region"],
+				Hostname:    e.Service.Meta["hostname"],
+				ID:          e.Service.ID,
+			},
+			URL: e.Service.Meta[urlMeta],
+		}
+
+		if k.URL != "" && matches(&k.Kite, query, constraint) {
+			kites = append(kites, k)
+		}
+	}
+
+	for i := range kites {
+		j := rand.Intn(i + 1)
+		kites[i], kites[j] = kites[j], kites[i]
+	}
+
+	return kites, nil
+}
+
+// matches tells whether the kite matches the query, the version of which
+// is matched with the constraint if it's not nil.
+func matches(k *protocol.Kite, query *protocol.KontrolQuery, constraint version.Constraints) bool {
+	want := query.Fields()
+	got := k.Query().Fields()
+
+	for field, v := range want {
+		if v == "" || field == "version" && constraint != nil {
+			continue
+		}
+
+		if got[field] != v {
+			return false
+		}
+	}
+
+	if constraint != nil {
+		v, err := version.NewVersion(k.Version)
+		if err != nil || !constraint.Check(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// do makes a request to the agent, sending in as the JSON body if it's
+// not nil and decoding the response into out if it's not nil.
+func (c *Consul) do(method, path string, params url.Values, in, out interface{}) error {
+	u := c.addr + path
+	if len(params) != 0 {
+		u += "?" + params.Encode()
+	}
+
+	var body io.Reader
+	if in != nil {
+		p, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(p)
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+
+	if c.config.Token != "" {
+		req.Header.Set("X-Consul-Token", c.config.Token)
+	}
+
+	resp, err := c.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		p, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+
+		return &Error{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(p)),
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,195 @@
+package consul_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/consul"
+	"github.com/koding/kite/protocol"
+)
+
+// agent is a fake Consul agent.
+type agent struct {
+	mu       sync.Mutex
+	services map[string]map[string]interface{}
+}
+
+func newAgent() *agent {
+	return &agent{services: make(map[string]map[string]interface{})}
+}
+
+func (a *agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch path := r.URL.Path; {
+	case path == "/v1/agent/service/register":
+		var s map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		a.services[s["ID"].(string)] = s
+	case strings.HasPrefix(path, "/v1/agent/check/pass/kite:"):
+		if _, ok := a.services[strings.TrimPrefix(path, "/v1/agent/check/pass/kite:")]; !ok {
+			http.Error(w, "unknown check", http.StatusNotFound)
+			return
+		}
+	case strings.HasPrefix(path, "/v1/agent/service/deregister/"):
+		delete(a.services, strings.TrimPrefix(path, "/v1/agent/service/deregister/"))
+	case strings.HasPrefix(path, "/v1/health/service/"):
+		name := strings.TrimPrefix(path, "/v1/health/service/")
+		tag := r.URL.Query().Get("tag")
+
+		entries := []interface{}{}
+	services:
+		for _, s := range a.services {
+			if s["Name"] != name {
+				continue
+			}
+
+			if tag != "" {
+				for _, t := range s["Tags"].([]interface{}) {
+					if t == tag {
+						entries = append(entries, map[string]interface{}{"Service": s})
+						continue services
+					}
+				}
+
+				continue
+			}
+
+			entries = append(entries, map[string]interface{}{"Service": s})
+		}
+
+		json.NewEncoder(w).Encode(entries)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *agent) reset() {
+	a.mu.Lock()
+	a.services = make(map[string]map[string]interface{})
+	a.mu.Unlock()
+}
+
+func (a *agent) len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.services)
+}
+
+func newKite(name, version string) *kite.Kite {
+	k := kite.New(name, version)
+	k.Config.Username = "koding"
+	k.Config.Environment = "testing"
+	k.Config.KiteKey = "kitekey"
+	return k
+}
+
+func TestConsul(t *testing.T) {
+	a := newAgent()
+	srv := httptest.NewServer(a)
+	defer srv.Close()
+
+	c := consul.New(&consul.Config{
+		Address: srv.URL,
+		TTL:     30 * time.Millisecond,
+	})
+
+	k1 := newKite("fs", "1.0.0")
+	k2 := newKite("fs", "2.0.0")
+	k3 := newKite("os", "1.0.0")
+
+	for i, k := range []*kite.Kite{k1, k2, k3} {
+		u := &url.URL{Scheme: "http", Host: "127.0.0.1:" + strconv.Itoa(i+1) + "000", Path: "/kite"}
+
+		if err := c.Register(k, u); err != nil {
+			t.Fatalf("Register()=%s", err)
+		}
+	}
+
+	defer c.Deregister(k1)
+	defer c.Deregister(k2)
+	defer c.Deregister(k3)
+
+	cases := []struct {
+		query *protocol.KontrolQuery
+		want  int
+	}{
+		{&protocol.KontrolQuery{Username: "koding", Name: "fs"}, 2},
+		{&protocol.KontrolQuery{Username: "koding", Name: "fs", Version: "2.0.0"}, 1},
+		{&protocol.KontrolQuery{Username: "koding", Name: "fs", Version: "< 2.0"}, 1},
+		{&protocol.KontrolQuery{Username: "koding", Name: "fs", ID: k2.Id}, 1},
+		{&protocol.KontrolQuery{Username: "koding", Environment: "production", Name: "fs"}, 0},
+		{&protocol.KontrolQuery{Username: "other", Name: "fs"}, 0},
+	}
+
+	for i, cas := range cases {
+		kites, err := c.Resolve(cas.query)
+		if err != nil {
+			t.Fatalf("%d: Resolve()=%s", i, err)
+		}
+
+		if len(kites) != cas.want {
+			t.Errorf("%d: got %d kites, want %d", i, len(kites), cas.want)
+		}
+	}
+
+	clients, err := c.GetKites(k3, &protocol.KontrolQuery{Username: "koding", Name: "os"})
+	if err != nil {
+		t.Fatalf("GetKites()=%s", err)
+	}
+
+	if len(clients) != 1 {
+		t.Fatalf("got %d clients, want 1", len(clients))
+	}
+
+	if got, want := clients[0].URL, "http://127.0.0.1:3000/kite"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got, want := clients[0].Kite, *k3.Kite(); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if clients[0].Auth.Type != "kiteKey" || clients[0].Auth.Key != "kitekey" {
+		t.Errorf("got %+v, want kite key auth", clients[0].Auth)
+	}
+
+	if _, err := c.GetKites(k3, &protocol.KontrolQuery{Username: "koding", Name: "none"}); err != kite.ErrNoKitesAvailable {
+		t.Errorf("got %v, want %v", err, kite.ErrNoKitesAvailable)
+	}
+
+	// The kites lost by the agent are registered again.
+	a.reset()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if n := a.len(); n != 3 {
+		t.Fatalf("got %d services, want 3", n)
+	}
+
+	if err := c.Deregister(k1); err != nil {
+		t.Fatalf("Deregister()=%s", err)
+	}
+
+	kites, err := c.Resolve(&protocol.KontrolQuery{Username: "koding", Name: "fs"})
+	if err != nil {
+		t.Fatalf("Resolve()=%s", err)
+	}
+
+	if len(kites) != 1 || kites[0].Kite.ID != k2.Id {
+		t.Fatalf("got %+v, want %s only", kites, k2.Id)
+	}
+}
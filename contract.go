@@ -0,0 +1,103 @@
+package kite
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/koding/kite/dnode"
+)
+
+// ResponseValidator validates the result of a method call, before it is
+// delivered to the caller. It returns a non-nil error if the result does
+// not match the contract of the method, e.g. its JSON Schema:
+//
+//     schema := gojsonschema.NewStringLoader(`{"type": "number"}`)
+//
+//     k.ValidateResponse("square", func(result *dnode.Partial) error {
+//         res, err := gojsonschema.Validate(schema, gojsonschema.NewBytesLoader(result.Raw))
+//         if err == nil && !res.Valid() {
+//             err = fmt.Errorf("%v", res.Errors())
+//         }
+//         return err
+//     })
+//
+// The result is nil, if the remote kite returned no result.
+type ResponseValidator func(result *dnode.Partial) error
+
+// ResponseShape returns a ResponseValidator, which rejects results that
+// cannot be decoded into the type of v, or have fields not known to it.
+// The value of v itself is ignored.
+func ResponseShape(v interface{}) ResponseValidator {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return func(result *dnode.Partial) error {
+		if result == nil {
+			return nil
+		}
+
+		if err := dnode.CheckFields(result.Raw, t); err != nil {
+			return err
+		}
+
+		return result.Unmarshal(reflect.New(t).Interface())
+	}
+}
+
+// ValidateResponse validates the results of the calls of the method made
+// by all the clients of the kite, unless the client has its own validator
+// of the method. The results, which fail the validation, are not delivered
+// to the callers, the calls fail with a "contractViolation" error instead.
+func (k *Kite) ValidateResponse(method string, validator ResponseValidator) {
+	k.responseValidatorsMu.Lock()
+	defer k.responseValidatorsMu.Unlock()
+
+	if k.responseValidators == nil {
+		k.responseValidators = make(map[string]ResponseValidator)
+	}
+
+	k.responseValidators[method] = validator
+}
+
+// ValidateResponse validates the results of the calls of the method made
+// by the client, see Kite.ValidateResponse. A nil validator disables
+// the validation of the method.
+func (c *Client) ValidateResponse(method string, validator ResponseValidator) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.responseValidators == nil {
+		c.responseValidators = make(map[string]ResponseValidator)
+	}
+
+	c.responseValidators[method] = validator
+}
+
+// validateResponse validates the result of the call of the method with
+// the validator of the client or the kite.
+func (c *Client) validateResponse(method string, result *dnode.Partial) *Error {
+	c.m.RLock()
+	validator, ok := c.responseValidators[method]
+	c.m.RUnlock()
+
+	if !ok && c.LocalKite != nil {
+		c.LocalKite.responseValidatorsMu.RLock()
+		validator = c.LocalKite.responseValidators[method]
+		c.LocalKite.responseValidatorsMu.RUnlock()
+	}
+
+	if validator == nil {
+		return nil
+	}
+
+	if err := validator(result); err != nil {
+		return &Error{
+			Type:    "contractViolation",
+			Message: fmt.Sprintf("Response of %q violates the contract: %s", method, err),
+		}
+	}
+
+	return nil
+}
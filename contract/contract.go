@@ -0,0 +1,254 @@
+// Package contract records the API of a kite - its methods together with the
+// schemas of their arguments and results - into a contract file, and checks
+// whether a later build of the kite breaks that contract.
+//
+// The schemas are built from the types declared with Method.Args and
+// Method.Returns:
+//
+//     k.HandleFunc("square", square).Args(SquareArgs{}).Returns(SquareResult{})
+//
+// A typical usage is a test in the kite's package, which fails whenever a
+// breaking change is made:
+//
+//     func TestContract(t *testing.T) {
+//         contract.Verify(t, newKite(), "testdata/contract.json")
+//     }
+//
+// The contract file is created if it does not exist yet. It is recreated
+// when the KITE_CONTRACT_UPDATE environment variable is set to 1, which is
+// the way to accept an intentional breaking change.
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/koding/kite"
+)
+
+// FormatVersion is the version of the contract file format.
+const FormatVersion = 1
+
+// Contract describes the API of a kite.
+type Contract struct {
+	FormatVersion int                `json:"formatVersion"`
+	Name          string             `json:"name"`
+	Version       string             `json:"version"`
+	Methods       map[string]*Method `json:"methods"`
+}
+
+// Method describes a single method of a kite.
+type Method struct {
+	Args       *Schema `json:"args,omitempty"`
+	Result     *Schema `json:"result,omitempty"`
+	Deprecated bool    `json:"deprecated,omitempty"`
+}
+
+// Record returns the contract of the given kite.
+func Record(k *kite.Kite) *Contract {
+	c := &Contract{
+		FormatVersion: FormatVersion,
+		Name:          k.Kite().Name,
+		Version:       k.Kite().Version,
+		Methods:       make(map[string]*Method),
+	}
+
+	for _, m := range k.Methods() {
+		c.Methods[m.Name] = &Method{
+			Args:       SchemaOf(m.Args),
+			Result:     SchemaOf(m.Result),
+			Deprecated: m.Deprecated,
+		}
+	}
+
+	return c
+}
+
+// Read decodes a contract from the given reader.
+func Read(r io.Reader) (*Contract, error) {
+	var c Contract
+
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, err
+	}
+
+	if c.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("unsupported contract format version: %d", c.FormatVersion)
+	}
+
+	return &c, nil
+}
+
+// ReadFile reads a contract from the given file.
+func ReadFile(file string) (*Contract, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// Write encodes the contract to the given writer.
+func (c *Contract) Write(w io.Writer) error {
+	p, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(p, '\n'))
+	return err
+}
+
+// WriteFile writes the contract to the given file.
+func (c *Contract) WriteFile(file string) error {
+	var buf bytes.Buffer
+
+	if err := c.Write(&buf); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, buf.Bytes(), 0644)
+}
+
+// BreakingError is returned by Check when the new contract is not
+// compatible with the old one.
+type BreakingError struct {
+	Changes []string
+}
+
+func (e *BreakingError) Error() string {
+	return "breaking changes:\n\t" + strings.Join(e.Changes, "\n\t")
+}
+
+// Check returns a *BreakingError if any of the following changes were made
+// between the from and to contracts:
+//
+//   - a method was removed
+//   - a required argument field was added
+//   - a result field was removed or became optional
+//   - a type of an argument or a result field was changed
+//
+// Other changes, like adding new methods, new optional arguments or new
+// result fields, are considered compatible.
+func Check(from, to *Contract) error {
+	var changes []string
+
+	for name, oldMethod := range from.Methods {
+		newMethod, ok := to.Methods[name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s: method was removed", name))
+			continue
+		}
+
+		// Schemas which were not declared before can't be compared.
+		if oldMethod.Args != nil && newMethod.Args != nil {
+			changes = append(changes, compare(name+": args", oldMethod.Args, newMethod.Args, true)...)
+		}
+
+		if oldMethod.Result != nil && newMethod.Result != nil {
+			changes = append(changes, compare(name+": result", oldMethod.Result, newMethod.Result, false)...)
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	sort.Strings(changes)
+
+	return &BreakingError{Changes: changes}
+}
+
+// compare returns breaking changes between the from and to schemas, path is
+// used to describe the changes. The args flag tells whether the schema
+// describes values sent to a method or values returned by it.
+func compare(path string, from, to *Schema, args bool) []string {
+	if isAny(from) || isAny(to) {
+		return nil
+	}
+
+	if from.Type != to.Type {
+		return []string{fmt.Sprintf("%s: type changed from %s to %s", path, from.Type, to.Type)}
+	}
+
+	var changes []string
+
+	if from.Elem != nil && to.Elem != nil {
+		changes = append(changes, compare(path+"[]", from.Elem, to.Elem, args)...)
+	}
+
+	for name, oldField := range from.Fields {
+		fieldPath := path + "." + name
+
+		newField, ok := to.Fields[name]
+		switch {
+		case !ok && !args:
+			changes = append(changes, fmt.Sprintf("%s: field was removed", fieldPath))
+		case !ok:
+			// the kite ignores the argument, which is fine
+		case !args && !oldField.Optional && newField.Optional:
+			changes = append(changes, fmt.Sprintf("%s: field became optional", fieldPath))
+		case args && oldField.Optional && !newField.Optional:
+			changes = append(changes, fmt.Sprintf("%s: field became required", fieldPath))
+		}
+
+		if ok {
+			changes = append(changes, compare(fieldPath, oldField.Schema, newField.Schema, args)...)
+		}
+	}
+
+	if args {
+		for name, newField := range to.Fields {
+			if _, ok := from.Fields[name]; !ok && !newField.Optional {
+				changes = append(changes, fmt.Sprintf("%s.%s: required field was added", path, name))
+			}
+		}
+	}
+
+	return changes
+}
+
+// isAny returns true if s describes arbitrary values, which are compatible
+// with every other schema.
+func isAny(s *Schema) bool {
+	return s.Type == "any" || (s.Type == "map" && s.Elem != nil && s.Elem.Type == "any")
+}
+
+// TestingT is the subset of testing.TB used by Verify.
+type TestingT interface {
+	Fatalf(format string, args ...interface{})
+	Logf(format string, args ...interface{})
+}
+
+// Verify checks the contract of the given kite against the one stored in
+// the file, failing the test on breaking changes. The file is written
+// instead, when it does not exist or KITE_CONTRACT_UPDATE is set to 1.
+func Verify(t TestingT, k *kite.Kite, file string) {
+	c := Record(k)
+
+	old, err := ReadFile(file)
+	if os.IsNotExist(err) || os.Getenv("KITE_CONTRACT_UPDATE") == "1" {
+		if err := c.WriteFile(file); err != nil {
+			t.Fatalf("contract: writing %s failed: %s", file, err)
+		}
+
+		t.Logf("contract: written to %s", file)
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("contract: reading %s failed: %s", file, err)
+	}
+
+	if err := Check(old, c); err != nil {
+		t.Fatalf("contract: %s is broken by %s", file, err)
+	}
+}
@@ -0,0 +1,134 @@
+package contract_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/contract"
+)
+
+type Args struct {
+	Number int    `json:"number"`
+	Unit   string `json:"unit,omitempty"`
+}
+
+type Result struct {
+	Square int      `json:"square"`
+	Tags   []string `json:"tags"`
+}
+
+func newKite(args, result interface{}) *kite.Kite {
+	k := kite.New("mathworker", "1.0.0")
+
+	k.HandleFunc("square", func(*kite.Request) (interface{}, error) {
+		return nil, nil
+	}).Args(args).Returns(result)
+
+	return k
+}
+
+func TestRecordReadWrite(t *testing.T) {
+	k := newKite(Args{}, Result{})
+	defer k.Close()
+
+	c := contract.Record(k)
+
+	m, ok := c.Methods["square"]
+	if !ok {
+		t.Fatal("square method is missing from the contract")
+	}
+
+	if f := m.Args.Fields["unit"]; f == nil || !f.Optional || f.Type != "string" {
+		t.Fatalf("unexpected unit field: %+v", f)
+	}
+
+	if f := m.Result.Fields["tags"]; f == nil || f.Type != "array" || f.Elem.Type != "string" {
+		t.Fatalf("unexpected tags field: %+v", f)
+	}
+
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		t.Fatalf("Write()=%s", err)
+	}
+
+	c2, err := contract.Read(&buf)
+	if err != nil {
+		t.Fatalf("Read()=%s", err)
+	}
+
+	if err := contract.Check(c, c2); err != nil {
+		t.Fatalf("Check()=%s", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	type ArgsRequired struct {
+		Args
+		Precision int `json:"precision"`
+	}
+
+	type ArgsOptional struct {
+		Args
+		Precision int `json:"precision,omitempty"`
+	}
+
+	type ResultRemoved struct {
+		Square int `json:"square"`
+	}
+
+	type ResultAdded struct {
+		Result
+		Cached bool `json:"cached"`
+	}
+
+	type ResultChanged struct {
+		Square string   `json:"square"`
+		Tags   []string `json:"tags"`
+	}
+
+	cases := map[string]struct {
+		args, result interface{}
+		breaking     string
+	}{
+		"same":            {Args{}, Result{}, ""},
+		"optional arg":    {ArgsOptional{}, Result{}, ""},
+		"result added":    {Args{}, ResultAdded{}, ""},
+		"required arg":    {ArgsRequired{}, Result{}, "square: args.precision: required field was added"},
+		"result removed":  {Args{}, ResultRemoved{}, "square: result.tags: field was removed"},
+		"result changed":  {Args{}, ResultChanged{}, "square: result.square: type changed from number to string"},
+		"method removed":  {nil, nil, "square: method was removed"},
+		"arg type is any": {map[string]interface{}{}, Result{}, ""},
+	}
+
+	k := newKite(Args{}, Result{})
+	defer k.Close()
+
+	from := contract.Record(k)
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			k := newKite(cas.args, cas.result)
+			defer k.Close()
+
+			to := contract.Record(k)
+			if cas.args == nil {
+				delete(to.Methods, "square")
+			}
+
+			err := contract.Check(from, to)
+
+			if cas.breaking == "" {
+				if err != nil {
+					t.Fatalf("Check()=%s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), cas.breaking) {
+				t.Fatalf("got %v, want %q", err, cas.breaking)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package contract
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+// Schema describes the shape of a JSON value that is sent over the wire.
+type Schema struct {
+	// Type is one of "object", "map", "array", "string", "number",
+	// "boolean", "function" or "any".
+	Type string `json:"type"`
+
+	// Fields describes the fields of an object.
+	Fields map[string]*Field `json:"fields,omitempty"`
+
+	// Elem describes the elements of an array or the values of a map.
+	Elem *Schema `json:"elem,omitempty"`
+}
+
+// Field describes a single field of an object.
+type Field struct {
+	*Schema
+
+	// Optional is true for fields which may be missing, that is fields
+	// tagged with omitempty or fields of pointer types.
+	Optional bool `json:"optional,omitempty"`
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	functionType = reflect.TypeOf(dnode.Function{})
+	partialType  = reflect.TypeOf(dnode.Partial{})
+	rawType      = reflect.TypeOf(json.RawMessage{})
+	marshalType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// SchemaOf returns a schema for values of the given type, as they are encoded
+// by the encoding/json package. It returns nil for a nil type.
+func SchemaOf(typ reflect.Type) *Schema {
+	if typ == nil {
+		return nil
+	}
+
+	return schemaOf(typ, make(map[reflect.Type]bool))
+}
+
+func schemaOf(typ reflect.Type, seen map[reflect.Type]bool) *Schema {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ {
+	case timeType:
+		return &Schema{Type: "string"}
+	case functionType:
+		return &Schema{Type: "function"}
+	case partialType, rawType:
+		return &Schema{Type: "any"}
+	}
+
+	// Types with custom encoding can't be described reliably.
+	if typ.Implements(marshalType) || reflect.PtrTo(typ).Implements(marshalType) {
+		return &Schema{Type: "any"}
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		// []byte is encoded as a base64 string
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string"}
+		}
+
+		return &Schema{Type: "array", Elem: schemaOf(typ.Elem(), seen)}
+	case reflect.Map:
+		return &Schema{Type: "map", Elem: schemaOf(typ.Elem(), seen)}
+	case reflect.Struct:
+		// Recursive types are described only up to the first cycle.
+		if seen[typ] {
+			return &Schema{Type: "object"}
+		}
+
+		seen[typ] = true
+		defer delete(seen, typ)
+
+		s := &Schema{
+			Type:   "object",
+			Fields: make(map[string]*Field),
+		}
+
+		addFields(s, typ, seen, false)
+
+		return s
+	default:
+		return &Schema{Type: "any"}
+	}
+}
+
+// addFields adds the exported fields of the struct type to s, embedded
+// structs are flattened the same way the encoding/json package does.
+func addFields(s *Schema, typ reflect.Type, seen map[reflect.Type]bool, embedded bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if i := strings.IndexRune(tag, ','); i != -1 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+
+		if f.Anonymous && name == "" {
+			t := f.Type
+			if t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+
+			if t.Kind() == reflect.Struct {
+				addFields(s, t, seen, true)
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		// Fields of the outer struct take precedence over the embedded ones.
+		if _, ok := s.Fields[name]; ok && embedded {
+			continue
+		}
+
+		s.Fields[name] = &Field{
+			Schema:   schemaOf(f.Type, seen),
+			Optional: f.Type.Kind() == reflect.Ptr || strings.Contains(opts, "omitempty"),
+		}
+	}
+}
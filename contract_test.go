@@ -0,0 +1,78 @@
+package kite
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/koding/kite/dnode"
+)
+
+func TestResponseShape(t *testing.T) {
+	type result struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	validate := ResponseShape(&result{})
+
+	cases := []struct {
+		raw string
+		ok  bool
+	}{
+		{`{"name":"foo","count":1}`, true},
+		{`{"name":"foo"}`, true},
+		{`null`, true},
+		{`{"name":"foo","extra":true}`, false},
+		{`{"name":"foo","count":"1"}`, false},
+		{`[1,2]`, false},
+	}
+
+	for _, cas := range cases {
+		err := validate(&dnode.Partial{Raw: []byte(cas.raw)})
+		if (err == nil) != cas.ok {
+			t.Errorf("%s: got %v, want ok=%t", cas.raw, err, cas.ok)
+		}
+	}
+
+	if err := validate(nil); err != nil {
+		t.Fatalf("want no result to be valid, got %s", err)
+	}
+}
+
+func TestClient_ValidateResponse(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	fail := func(*dnode.Partial) error { return errors.New("bad result") }
+
+	k.ValidateResponse("square", fail)
+	k.ValidateResponse("cube", fail)
+
+	c := k.NewClient("http://127.0.0.1:3636/kite")
+	c.ValidateResponse("cube", nil)
+
+	result := &dnode.Partial{Raw: []byte(`4`)}
+
+	err := c.validateResponse("square", result)
+	if err == nil || err.Type != "contractViolation" {
+		t.Fatalf("want contractViolation error, got %v", err)
+	}
+
+	if err := c.validateResponse("cube", result); err != nil {
+		t.Fatalf("want validation disabled by client, got %s", err)
+	}
+
+	if err := c.validateResponse("echo", result); err != nil {
+		t.Fatalf("want method without validator to pass, got %s", err)
+	}
+
+	// Validators can be registered while the clients are calling.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		k.ValidateResponse("echo", fail)
+	}()
+
+	c.validateResponse("echo", result)
+	<-done
+}
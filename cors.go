@@ -0,0 +1,207 @@
+package kite
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS allows the pages of other origins to call the HTTP endpoints of
+// the kite, like the HTTP calls of the methods or the handlers added with
+// HandleHTTP, see SetCORS.
+//
+//     k.SetCORS(&kite.CORS{
+//         AllowedOrigins:   []string{"https://app.example.com"},
+//         AllowedHeaders:   []string{"Authorization", "Content-Type"},
+//         AllowCredentials: true,
+//     })
+//
+// The SockJS endpoints handle the cross-origin requests on their own, they
+// are restricted with SetUpgradePolicy instead.
+type CORS struct {
+	// AllowedOrigins are the origins of the pages allowed to make the
+	// requests, they can be patterns with the syntax of path.Match, "*"
+	// allows all of them. The origins are compared case-insensitively.
+	AllowedOrigins []string
+
+	// AllowedMethods are the methods of the allowed requests. If empty,
+	// GET, HEAD and POST requests are allowed.
+	AllowedMethods []string
+
+	// AllowedHeaders are the names of the headers the requests can carry,
+	// besides the ones always allowed by the browsers. If empty, the
+	// Authorization and Content-Type headers are allowed.
+	AllowedHeaders []string
+
+	// ExposedHeaders are the names of the response headers the pages can
+	// read, besides the ones always exposed by the browsers.
+	ExposedHeaders []string
+
+	// AllowCredentials allows the requests to carry cookies and
+	// the Authorization header. It can't be combined with the "*"
+	// origin, as it would let any page make requests with the
+	// credentials of its visitors.
+	AllowCredentials bool
+
+	// MaxAge tells how long the browsers can cache the responses to
+	// the preflight requests. Zero leaves it to the browsers.
+	MaxAge time.Duration
+}
+
+var (
+	defaultCORSMethods = []string{"GET", "HEAD", "POST"}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type"}
+)
+
+func (c *CORS) methods() []string {
+	if len(c.AllowedMethods) == 0 {
+		return defaultCORSMethods
+	}
+
+	return c.AllowedMethods
+}
+
+func (c *CORS) headers() []string {
+	if len(c.AllowedHeaders) == 0 {
+		return defaultCORSHeaders
+	}
+
+	return c.AllowedHeaders
+}
+
+func (c *CORS) allowedMethod(method string) bool {
+	for _, m := range c.methods() {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowedHeaders tells whether all the headers, listed as in
+// the Access-Control-Request-Headers header, are allowed.
+func (c *CORS) allowedHeaders(list string) bool {
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		allowed := false
+
+		for _, h := range c.headers() {
+			if strings.EqualFold(h, name) {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SetCORS allows the cross-origin requests to the HTTP endpoints of
+// the kite, according to the given policy. A nil policy disables them,
+// which is the default.
+func (k *Kite) SetCORS(c *CORS) error {
+	if c != nil && c.AllowCredentials {
+		for _, origin := range c.AllowedOrigins {
+			if origin == "*" {
+				return errors.New("kite: CORS credentials can't be allowed for all origins")
+			}
+		}
+	}
+
+	k.corsMu.Lock()
+	k.cors = c
+	k.corsMu.Unlock()
+
+	return nil
+}
+
+// isSockJSPath tells whether the request is handled by the SockJS server.
+func isSockJSPath(p string) bool {
+	if strings.HasPrefix(p, HTTPCallPath) {
+		return false
+	}
+
+	return p == "/kite" || strings.HasPrefix(p, "/kite/")
+}
+
+// handleCORS sets the CORS headers of the response to a cross-origin
+// request. It tells whether the request was a preflight one, which was
+// answered already.
+func (k *Kite) handleCORS(w http.ResponseWriter, req *http.Request) bool {
+	k.corsMu.RLock()
+	c := k.cors
+	k.corsMu.RUnlock()
+
+	origin := req.Header.Get("Origin")
+
+	if c == nil || origin == "" || isSockJSPath(req.URL.Path) {
+		return false
+	}
+
+	h := w.Header()
+	h.Add("Vary", "Origin")
+
+	preflight := req.Method == "OPTIONS" && req.Header.Get("Access-Control-Request-Method") != ""
+
+	if !matchOrigin(c.AllowedOrigins, origin) {
+		if preflight {
+			http.Error(w, "origin is not allowed", http.StatusForbidden)
+			return true
+		}
+
+		return false
+	}
+
+	if c.AllowCredentials || !matchOrigin(c.AllowedOrigins, "*") {
+		h.Set("Access-Control-Allow-Origin", origin)
+	} else {
+		h.Set("Access-Control-Allow-Origin", "*")
+	}
+
+	if c.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !preflight {
+		if len(c.ExposedHeaders) != 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+		}
+
+		return false
+	}
+
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	if !c.allowedMethod(req.Header.Get("Access-Control-Request-Method")) {
+		http.Error(w, "method is not allowed", http.StatusForbidden)
+		return true
+	}
+
+	if !c.allowedHeaders(req.Header.Get("Access-Control-Request-Headers")) {
+		http.Error(w, "headers are not allowed", http.StatusForbidden)
+		return true
+	}
+
+	h.Set("Access-Control-Allow-Methods", strings.Join(c.methods(), ", "))
+	h.Set("Access-Control-Allow-Headers", strings.Join(c.headers(), ", "))
+
+	if c.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge/time.Second)))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return true
+}
@@ -0,0 +1,112 @@
+package kite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKite_CORS(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	k.HandleHTTPFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	serve := func(method, path, origin string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+
+		rec := httptest.NewRecorder()
+		k.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	if rec := serve("GET", "/health", "https://app.example.com", nil); rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("want no CORS headers without a policy")
+	}
+
+	err := k.SetCORS(&CORS{
+		AllowedOrigins:   []string{"*"},
+		AllowCredentials: true,
+	})
+	if err == nil {
+		t.Fatal("want credentials for all origins to be rejected")
+	}
+
+	err = k.SetCORS(&CORS{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		ExposedHeaders:   []string{"X-Request-Id"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("SetCORS()=%s", err)
+	}
+
+	rec := serve("GET", "/health", "https://app.example.com", nil)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Fatalf("got %q allowed origin", got)
+	}
+
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Fatalf("got %q allowed credentials", got)
+	}
+
+	if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-Id" {
+		t.Fatalf("got %q exposed headers", got)
+	}
+
+	if rec.Body.String() != "ok" {
+		t.Fatalf("got %q body", rec.Body.String())
+	}
+
+	if rec := serve("GET", "/health", "https://evil.io", nil); rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("want no CORS headers for a disallowed origin")
+	}
+
+	preflight := http.Header{
+		"Access-Control-Request-Method":  {"POST"},
+		"Access-Control-Request-Headers": {"authorization, content-type"},
+	}
+
+	rec = serve("OPTIONS", HTTPCallPath+"kite.ping", "https://app.example.com", preflight)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "GET, HEAD, POST" {
+		t.Fatalf("got %q allowed methods", got)
+	}
+
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "3600" {
+		t.Fatalf("got %q max age", got)
+	}
+
+	preflight.Set("Access-Control-Request-Method", "DELETE")
+
+	if rec := serve("OPTIONS", "/health", "https://app.example.com", preflight); rec.Code != http.StatusForbidden {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	preflight.Set("Access-Control-Request-Method", "POST")
+	preflight.Set("Access-Control-Request-Headers", "X-Custom")
+
+	if rec := serve("OPTIONS", "/health", "https://app.example.com", preflight); rec.Code != http.StatusForbidden {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	if rec := serve("GET", "/kite/info", "https://app.example.com", nil); rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("want SockJS endpoints to be left alone")
+	}
+}
@@ -0,0 +1,379 @@
+// Package dashboard implements an admin kite which periodically collects
+// kite.stats and kite.systemInfo from the kites registered to Kontrol and
+// serves them on a small web dashboard.
+//
+// The dashboard kite needs a kite key of a user that is allowed to call
+// the monitored kites, usually the same user the kites are registered with.
+//
+// The dashboard is served to the same user only, who authenticates with
+// a token or a kite key, sent with the Authorization header as
+// "Bearer <token>" or as the password of the basic authentication, so
+// browsers prompt for it.
+package dashboard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/protocol"
+)
+
+const (
+	Version = "0.0.1"
+	Name    = "dashboard"
+)
+
+// Interval is the default interval of collecting the stats.
+var Interval = 30 * time.Second
+
+// Concurrency is the maximum number of kites queried at the same time.
+var Concurrency = 16
+
+// KiteStatus is the state of a single kite, as seen by the dashboard.
+type KiteStatus struct {
+	Kite       protocol.Kite   `json:"kite"`
+	URL        string          `json:"url"`
+	Latency    time.Duration   `json:"latency"` // round-trip time of kite.ping
+	Stats      *kite.Stats     `json:"stats,omitempty"`
+	SystemInfo json.RawMessage `json:"systemInfo,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// Snapshot is the state of the fleet at the given time.
+type Snapshot struct {
+	Kites   []*KiteStatus `json:"kites"`
+	Updated time.Time     `json:"updated"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// Dashboard is the admin kite serving the dashboard.
+type Dashboard struct {
+	Kite *kite.Kite
+
+	// Query selects the monitored kites. By default all the kites of
+	// the dashboard's user are monitored.
+	Query *protocol.KontrolQuery
+
+	// Interval of collecting the stats, the default is Interval.
+	Interval time.Duration
+
+	snapshot   *Snapshot
+	snapshotMu sync.RWMutex
+
+	closeC    chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a dashboard kite, which serves the dashboard on "/" and
+// the collected snapshot as JSON on "/api/kites" to the user of the kite.
+func New(conf *config.Config) *Dashboard {
+	k := kite.New(Name, Version)
+	k.Config = conf
+
+	d := &Dashboard{
+		Kite:   k,
+		closeC: make(chan struct{}),
+	}
+
+	k.HandleHTTP("/", d.authorize(http.HandlerFunc(d.serveIndex)))
+	k.HandleHTTP("/api/kites", d.authorize(http.HandlerFunc(d.serveKites)))
+
+	return d
+}
+
+// Run starts collecting the stats and runs the kite's server. It blocks
+// until Close is called.
+func (d *Dashboard) Run() {
+	go d.collectLoop()
+	d.Kite.Run()
+}
+
+// Close stops collecting the stats and closes the kite.
+func (d *Dashboard) Close() {
+	d.closeOnce.Do(func() {
+		close(d.closeC)
+	})
+
+	d.Kite.Close()
+}
+
+// Snapshot returns the most recently collected state of the fleet,
+// or nil if nothing was collected yet.
+func (d *Dashboard) Snapshot() *Snapshot {
+	d.snapshotMu.RLock()
+	defer d.snapshotMu.RUnlock()
+
+	return d.snapshot
+}
+
+func (d *Dashboard) collectLoop() {
+	interval := d.Interval
+	if interval == 0 {
+		interval = Interval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		d.Refresh()
+
+		select {
+		case <-ticker.C:
+		case <-d.closeC:
+			return
+		}
+	}
+}
+
+// Refresh collects the state of the fleet and stores it as the current
+// snapshot.
+func (d *Dashboard) Refresh() *Snapshot {
+	s := d.collect()
+
+	d.snapshotMu.Lock()
+	d.snapshot = s
+	d.snapshotMu.Unlock()
+
+	return s
+}
+
+func (d *Dashboard) query() *protocol.KontrolQuery {
+	if d.Query != nil {
+		return d.Query
+	}
+
+	return &protocol.KontrolQuery{
+		Username: d.Kite.Config.Username,
+	}
+}
+
+func (d *Dashboard) collect() *Snapshot {
+	s := &Snapshot{
+		Kites:   []*KiteStatus{},
+		Updated: time.Now().UTC(),
+	}
+
+	clients, err := d.Kite.GetKites(d.query())
+	if err != nil && err != kite.ErrNoKitesAvailable {
+		d.Kite.Log.Error("Dashboard: querying kites failed: %s", err)
+		s.Error = err.Error()
+		return s
+	}
+
+	statuses := make([]*KiteStatus, len(clients))
+	sem := make(chan struct{}, Concurrency)
+	var wg sync.WaitGroup
+
+	for i, c := range clients {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, c *kite.Client) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			statuses[i] = d.status(c)
+		}(i, c)
+	}
+
+	wg.Wait()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Kite.Name != statuses[j].Kite.Name {
+			return statuses[i].Kite.Name < statuses[j].Kite.Name
+		}
+
+		return statuses[i].Kite.ID < statuses[j].Kite.ID
+	})
+
+	s.Kites = statuses
+
+	return s
+}
+
+// status queries a single kite, the client is closed afterwards.
+func (d *Dashboard) status(c *kite.Client) *KiteStatus {
+	defer c.Close()
+
+	st := &KiteStatus{
+		Kite: c.Kite,
+		URL:  c.URL,
+	}
+
+	timeout := d.Kite.Config.Timeout
+
+	if err := c.DialTimeout(timeout); err != nil {
+		st.Error = err.Error()
+		return st
+	}
+
+	start := time.Now()
+
+	if _, err := c.TellWithTimeout("kite.ping", timeout); err != nil {
+		st.Error = err.Error()
+		return st
+	}
+
+	st.Latency = time.Since(start)
+
+	result, err := c.TellWithTimeout("kite.stats", timeout)
+	if err == nil {
+		err = result.Unmarshal(&st.Stats)
+	}
+
+	if err != nil {
+		// Older kites do not support kite.stats.
+		d.Kite.Log.Debug("Dashboard: fetching stats of %q failed: %s", c.URL, err)
+	}
+
+	result, err = c.TellWithTimeout("kite.systemInfo", timeout)
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+
+	st.SystemInfo = json.RawMessage(result.Raw)
+
+	return st
+}
+
+// authorize serves the requests of the user of the dashboard kite with h,
+// the other ones are rejected.
+func (d *Dashboard) authorize(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		username, err := d.authenticate(req)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="kite dashboard"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if username != d.Kite.Config.Username {
+			http.Error(w, fmt.Sprintf("%q is not allowed to see the dashboard", username), http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, req)
+	})
+}
+
+// authenticate gives the username of the token or of the kite key
+// the request is made with.
+func (d *Dashboard) authenticate(req *http.Request) (string, error) {
+	var key string
+
+	if _, password, ok := req.BasicAuth(); ok {
+		key = password
+	} else if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimSpace(auth[len("Bearer "):])
+	}
+
+	if key == "" {
+		return "", errors.New("no authentication information is provided")
+	}
+
+	if claims, err := d.Kite.ValidateToken(key); err == nil {
+		return claims.Subject, nil
+	}
+
+	return d.Kite.AuthenticateSimpleKiteKey(key)
+}
+
+func (d *Dashboard) serveKites(w http.ResponseWriter, req *http.Request) {
+	s := d.Snapshot()
+	if s == nil {
+		http.Error(w, "stats are not collected yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+func (d *Dashboard) serveIndex(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+
+	s := d.Snapshot()
+	if s == nil {
+		s = &Snapshot{}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := index.Execute(w, s); err != nil {
+		d.Kite.Log.Error("Dashboard: rendering failed: %s", err)
+	}
+}
+
+var index = template.Must(template.New("index").Funcs(template.FuncMap{
+	"round": func(d time.Duration) time.Duration {
+		return d - d%time.Millisecond
+	},
+	"bytes": func(n uint64) string {
+		switch {
+		case n >= 1<<30:
+			return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+		case n >= 1<<20:
+			return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+		case n >= 1<<10:
+			return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+		default:
+			return fmt.Sprintf("%d B", n)
+		}
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>Kite dashboard</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; }
+th, td { padding: 4px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+.error { color: #c00; }
+</style>
+</head>
+<body>
+<h1>Kites</h1>
+<p>Updated: {{.Updated.Format "2006-01-02 15:04:05 MST"}}</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<table>
+<tr><th>Name</th><th>Version</th><th>Username</th><th>Environment</th><th>Region</th><th>Hostname</th><th>URL</th><th>Latency</th><th>Connections</th><th>Goroutines</th><th>In</th><th>Out</th><th>Uptime</th><th>Error</th></tr>
+{{range .Kites}}
+<tr>
+<td>{{.Kite.Name}}</td>
+<td>{{.Kite.Version}}</td>
+<td>{{.Kite.Username}}</td>
+<td>{{.Kite.Environment}}</td>
+<td>{{.Kite.Region}}</td>
+<td>{{.Kite.Hostname}}</td>
+<td>{{.URL}}</td>
+<td>{{if .Latency}}{{round .Latency}}{{end}}</td>
+<td>{{with .Stats}}{{.Connections}}{{end}}</td>
+<td>{{with .Stats}}{{.Goroutines}}{{end}}</td>
+<td>{{with .Stats}}{{bytes .BytesIn}}{{end}}</td>
+<td>{{with .Stats}}{{bytes .BytesOut}}{{end}}</td>
+<td>{{with .Stats}}{{round .Uptime}}{{end}}</td>
+<td class="error">{{.Error}}</td>
+</tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
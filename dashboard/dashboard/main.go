@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dashboard"
+	"github.com/koding/kite/protocol"
+)
+
+var (
+	flagIp          = flag.String("ip", "127.0.0.1", "Listening IP")
+	flagPort        = flag.Int("port", 3998, "Server port to bind")
+	flagEnvironment = flag.String("env", "", "Show only kites from the given environment")
+	flagName        = flag.String("name", "", "Show only kites with the given name")
+	flagInterval    = flag.Duration("interval", 30*time.Second, "Interval of collecting the stats")
+	flagVersion     = flag.Bool("version", false, "Show version and exit")
+)
+
+func main() {
+	flag.Parse()
+
+	if *flagVersion {
+		fmt.Println(dashboard.Version)
+		os.Exit(0)
+	}
+
+	conf := config.MustGet()
+	conf.IP = *flagIp
+	conf.Port = *flagPort
+
+	if conf.KontrolURL == "" {
+		log.Fatal("Please specify Kontrol URL via KITE_KONTROL_URL or the kite key. Aborting.")
+	}
+
+	d := dashboard.New(conf)
+	d.Interval = *flagInterval
+	d.Query = &protocol.KontrolQuery{
+		Username:    conf.Username,
+		Environment: *flagEnvironment,
+		Name:        *flagName,
+	}
+
+	d.Run()
+}
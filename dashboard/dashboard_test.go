@@ -0,0 +1,78 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/protocol"
+	"github.com/koding/kite/testkeys"
+	"github.com/koding/kite/testutil"
+)
+
+func TestDashboard_Serve(t *testing.T) {
+	conf := config.New()
+	conf.Username = "testuser"
+	conf.KontrolKey = testkeys.Public
+
+	d := New(conf)
+
+	get := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if key != "" {
+			req.SetBasicAuth("", key)
+		}
+
+		rec := httptest.NewRecorder()
+		d.Kite.ServeHTTP(rec, req)
+		return rec
+	}
+
+	key := testutil.NewKiteKeyUsername("testuser").Raw
+
+	if rec := get("/api/kites", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	if rec := get("/", testutil.NewKiteKeyUsername("other").Raw); rec.Code != http.StatusForbidden {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	rec := get("/api/kites", key)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	d.snapshot = &Snapshot{
+		Kites: []*KiteStatus{{
+			Kite:    protocol.Kite{Name: "mathworker", Version: "1.2.3"},
+			URL:     "http://localhost:3636/kite",
+			Latency: 1500 * time.Microsecond,
+		}},
+		Updated: time.Now(),
+	}
+
+	rec = get("/api/kites", key)
+
+	var s Snapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	if len(s.Kites) != 1 || s.Kites[0].Kite.Name != "mathworker" {
+		t.Fatalf("got %+v", s.Kites)
+	}
+
+	rec = get("/", key)
+
+	for _, want := range []string{"mathworker", "1.2.3", "1ms"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("dashboard does not contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package kite
+
+import (
+	"encoding/json"
+
+	"github.com/koding/kite/dnode"
+)
+
+// DecoderHandlerFunc is a handler of a method with large arguments, see
+// HandleDecoderFunc.
+type DecoderHandlerFunc func(r *Request, args *json.Decoder) (result interface{}, err error)
+
+// HandleDecoderFunc registers a handler of a method, which decodes its
+// arguments from a JSON decoder instead of unmarshaling r.Args, e.g. to
+// process the elements of a large array one by one:
+//
+//     k.HandleDecoderFunc("import", func(r *kite.Request, args *json.Decoder) (interface{}, error) {
+//         if _, err := args.Token(); err != nil { // [
+//             return nil, err
+//         }
+//
+//         n := 0
+//         for ; args.More(); n++ {
+//             var rec Record
+//             if err := args.Decode(&rec); err != nil {
+//                 return nil, err
+//             }
+//             ...
+//         }
+//
+//         return n, nil
+//     })
+//
+// The arguments of the method share the data of the received message,
+// unlike the ones of the other methods, which are copied while the message
+// is parsed. So only the message and the values decoded by the handler
+// are held in memory, which matters for the arguments of hundreds of MB.
+//
+// The decoder reads the array of the arguments, see dnode.Partial.Decoder.
+func (k *Kite) HandleDecoderFunc(method string, handler DecoderHandlerFunc) *Method {
+	m := k.addHandle(method, handler)
+	m.rawArgs = true
+	return m
+}
+
+// ServeKite calls the handler with a decoder of the arguments.
+func (h DecoderHandlerFunc) ServeKite(r *Request) (interface{}, error) {
+	args := r.Args
+	if args == nil {
+		args = &dnode.Partial{Raw: []byte("[]")}
+	}
+
+	return h(r, args.Decoder())
+}
+
+// unmarshalRawOptions unmarshals the options of the call from the dnode
+// arguments without copying the arguments of the method, which are set
+// to options.WithArgs.
+func unmarshalRawOptions(args *dnode.Partial, options *callOptions) {
+	raw := args.MustIndex(0)
+
+	// The options are unmarshaled with the keys as they are, as matching
+	// them with the naming or decoding the numbers would copy the data.
+	header := &dnode.Partial{Raw: raw.Raw}
+
+	for _, spec := range raw.CallbackSpecs {
+		if len(spec.Path) == 0 || spec.Path[0] != "withArgs" {
+			header.CallbackSpecs = append(header.CallbackSpecs, spec)
+		}
+	}
+
+	var v struct {
+		callOptions
+		WithArgs discardJSON `json:"withArgs"`
+	}
+
+	header.MustUnmarshal(&v)
+
+	*options = v.callOptions
+
+	if withArgs := raw.MustField("withArgs"); withArgs != nil && string(withArgs.Raw) != "null" {
+		options.WithArgs = withArgs
+	}
+}
+
+// discardJSON skips the JSON value it's unmarshaled from.
+type discardJSON struct{}
+
+func (*discardJSON) UnmarshalJSON([]byte) error {
+	return nil
+}
@@ -0,0 +1,99 @@
+package kite
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/koding/kite/dnode"
+)
+
+func TestHandleDecoderFunc(t *testing.T) {
+	type record struct {
+		Name string `json:"name"`
+		Size int    `json:"size"`
+	}
+
+	k := New("importer", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+
+	k.HandleDecoderFunc("import", func(r *Request, args *json.Decoder) (interface{}, error) {
+		if _, err := args.Token(); err != nil {
+			return nil, err
+		}
+
+		var names []string
+		var size int
+
+		for args.More() {
+			var rec record
+			if err := args.Decode(&rec); err != nil {
+				return nil, err
+			}
+
+			names = append(names, rec.Name)
+			size += rec.Size
+		}
+
+		return fmt.Sprintf("%s=%d", strings.Join(names, ","), size), nil
+	})
+
+	k.HandleDecoderFunc("count", func(r *Request, args *json.Decoder) (interface{}, error) {
+		var v []interface{}
+		if err := args.Decode(&v); err != nil {
+			return nil, err
+		}
+
+		return len(v), nil
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	result, err := c.Tell("import", record{"a", 1}, record{"b", 2}, record{"c", 3})
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if s := result.MustString(); s != "a,b,c=6" {
+		t.Fatalf("got %q, want %q", s, "a,b,c=6")
+	}
+
+	result, err = c.Tell("count")
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if n := result.MustFloat64(); n != 0 {
+		t.Fatalf("got %v, want 0", n)
+	}
+
+	// The callbacks in the arguments are passed too.
+	done := make(chan string, 1)
+
+	k.HandleDecoderFunc("callback", func(r *Request, args *json.Decoder) (interface{}, error) {
+		var fn dnode.Function
+		r.Args.One().MustUnmarshal(&fn)
+		return nil, fn.Call("called")
+	})
+
+	_, err = c.Tell("callback", dnode.Callback(func(p *dnode.Partial) {
+		done <- p.One().MustString()
+	}))
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if s := <-done; s != "called" {
+		t.Fatalf("got %q, want %q", s, "called")
+	}
+}
@@ -0,0 +1,38 @@
+package kite
+
+// MethodDoc is the documentation of a method, as served by the kite.describe
+// method.
+type MethodDoc struct {
+	Name         string        `json:"name"`
+	Version      string        `json:"version,omitempty"`
+	Description  string        `json:"description,omitempty"`
+	Example      []interface{} `json:"example,omitempty"`
+	Authenticate bool          `json:"authenticate"`
+	Deprecated   bool          `json:"deprecated,omitempty"`
+	Replacement  string        `json:"replacement,omitempty"`
+}
+
+// Describe returns the documentation of the methods registered with the
+// kite, sorted by the method name, see Method.Describe and Method.Example.
+func (k *Kite) Describe() []*MethodDoc {
+	methods := k.Methods()
+	docs := make([]*MethodDoc, 0, len(methods))
+
+	for _, m := range methods {
+		docs = append(docs, &MethodDoc{
+			Name:         m.Name,
+			Version:      m.Version,
+			Description:  m.Description,
+			Example:      m.Example,
+			Authenticate: m.Authenticate,
+			Deprecated:   m.Deprecated,
+			Replacement:  m.Replacement,
+		})
+	}
+
+	return docs
+}
+
+func (k *Kite) handleDescribe(r *Request) (interface{}, error) {
+	return k.Describe(), nil
+}
@@ -0,0 +1,148 @@
+package kite
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/koding/kite/protocol"
+)
+
+// Selector orders the kites returned by Kontrol in which DialQuery is going
+// to try them. It may also leave some kites out.
+type Selector func(clients []*Client) []*Client
+
+// PreferRegion returns a Selector which moves the kites from the given
+// region to the front, keeping the order Kontrol returned them in.
+func PreferRegion(region string) Selector {
+	return func(clients []*Client) []*Client {
+		sorted := make([]*Client, 0, len(clients))
+
+		for _, c := range clients {
+			if c.Kite.Region == region {
+				sorted = append(sorted, c)
+			}
+		}
+
+		for _, c := range clients {
+			if c.Kite.Region != region {
+				sorted = append(sorted, c)
+			}
+		}
+
+		return sorted
+	}
+}
+
+// DialOptions configures DialQueryWithOptions.
+type DialOptions struct {
+	// Select orders the kites to dial. By default the order returned by
+	// Kontrol, which is random, is used.
+	Select Selector
+
+	// Timeout is the timeout of dialing a single kite. The default is
+	// Config.Timeout.
+	Timeout time.Duration
+
+	// MaxAttempts is the maximum number of kites to dial before giving up.
+	// Zero means all of the kites are tried.
+	MaxAttempts int
+
+	// Shared makes the connection shared with other callers that dial
+	// the same kite, see DialShared.
+	Shared bool
+}
+
+// DialError is returned by DialQuery when none of the kites could be dialed.
+type DialError struct {
+	Errs map[string]error // dial errors by kite URL
+}
+
+func (e *DialError) Error() string {
+	errs := make([]string, 0, len(e.Errs))
+	for url, err := range e.Errs {
+		errs = append(errs, fmt.Sprintf("%s: %s", url, err))
+	}
+
+	return "unable to dial any of the kites: " + strings.Join(errs, "; ")
+}
+
+// DialQuery queries Kontrol for kites matching the query and returns a client
+// connected to the first kite that it was able to dial. The client is
+// authenticated with a token, which is renewed when it expires.
+func (k *Kite) DialQuery(query *protocol.KontrolQuery) (*Client, error) {
+	return k.DialQueryWithOptions(query, nil)
+}
+
+// DialQueryWithOptions does the same thing with DialQuery() method except it
+// takes options to configure selection and failover of the kites.
+func (k *Kite) DialQueryWithOptions(query *protocol.KontrolQuery, opts *DialOptions) (*Client, error) {
+	if opts == nil {
+		opts = &DialOptions{}
+	}
+
+	clients, err := k.GetKites(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return k.dialAny(clients, opts)
+}
+
+// dialAny returns the first of the clients it was able to dial, closing
+// the other ones.
+func (k *Kite) dialAny(clients []*Client, opts *DialOptions) (*Client, error) {
+	candidates := clients
+	if opts.Select != nil {
+		candidates = opts.Select(clients)
+	}
+
+	if opts.MaxAttempts > 0 && len(candidates) > opts.MaxAttempts {
+		candidates = candidates[:opts.MaxAttempts]
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = k.Config.Timeout
+	}
+
+	var dialed *Client
+	dialErr := &DialError{Errs: make(map[string]error)}
+
+	for _, c := range candidates {
+		var err error
+
+		if opts.Shared {
+			dialed, err = k.DialShared(c, timeout)
+		} else {
+			dialed, err = c, c.DialTimeout(timeout)
+		}
+
+		if err != nil {
+			k.Log.Debug("DialQuery: dialing %s failed: %s", c.URL, err)
+			dialErr.Errs[c.URL] = err
+			dialed = nil
+			continue
+		}
+
+		break
+	}
+
+	// Close the clients that are not going to be used, so their token
+	// renewers are not leaked.
+	for _, c := range clients {
+		if c != dialed {
+			c.Close()
+		}
+	}
+
+	if dialed == nil {
+		if len(dialErr.Errs) == 0 {
+			return nil, ErrNoKitesAvailable
+		}
+
+		return nil, dialErr
+	}
+
+	return dialed, nil
+}
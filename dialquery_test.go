@@ -0,0 +1,165 @@
+package kite
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/protocol"
+
+	"github.com/igm/sockjs-go/sockjs"
+)
+
+func TestPreferRegion(t *testing.T) {
+	var clients []*Client
+	for _, region := range []string{"us", "eu", "us", "eu"} {
+		clients = append(clients, &Client{Kite: protocol.Kite{Region: region}})
+	}
+
+	sorted := PreferRegion("eu")(clients)
+
+	want := []*Client{clients[1], clients[3], clients[0], clients[2]}
+
+	if len(sorted) != len(want) {
+		t.Fatalf("got %d clients, want %d", len(sorted), len(want))
+	}
+
+	for i := range want {
+		if sorted[i] != want[i] {
+			t.Fatalf("%d: got %q client, want %q", i, sorted[i].Kite.Region, want[i].Kite.Region)
+		}
+	}
+}
+
+// testSession is a connected session, which receives nothing until it is
+// closed.
+type testSession struct {
+	id     string
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newTestSession(id string) *testSession {
+	return &testSession{
+		id:     id,
+		closed: make(chan struct{}),
+	}
+}
+
+func (s *testSession) ID() string {
+	return s.id
+}
+
+func (s *testSession) Request() *http.Request {
+	return nil
+}
+
+func (s *testSession) Recv() (string, error) {
+	<-s.closed
+	return "", errors.New("session closed")
+}
+
+func (s *testSession) Send(string) error {
+	return nil
+}
+
+func (s *testSession) Close(uint32, string) error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+func (s *testSession) GetSessionState() sockjs.SessionState {
+	return sockjs.SessionActive
+}
+
+func (s *testSession) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestKite_DialAny(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	var mu sync.Mutex
+	var dialed []string
+
+	transport := TransportFunc(func(url string, _ *config.Config) (sockjs.Session, error) {
+		mu.Lock()
+		dialed = append(dialed, url)
+		mu.Unlock()
+
+		if url == "http://b/kite" {
+			return newTestSession(url), nil
+		}
+
+		return nil, errors.New("connection refused")
+	})
+
+	newClients := func(urls ...string) []*Client {
+		var clients []*Client
+		for _, url := range urls {
+			c := k.NewClient(url)
+			c.Transport = transport
+			c.DisablePinning = true // the sessions do not reply
+			clients = append(clients, c)
+		}
+
+		return clients
+	}
+
+	// The next kite is dialed when the previous one fails.
+	clients := newClients("http://a/kite", "http://b/kite", "http://c/kite")
+
+	c, err := k.dialAny(clients, &DialOptions{})
+	if err != nil {
+		t.Fatalf("dialAny()=%s", err)
+	}
+	defer c.Close()
+
+	if c != clients[1] {
+		t.Fatalf("got %s client, want http://b/kite", c.URL)
+	}
+
+	if want := []string{"http://a/kite", "http://b/kite"}; !reflect.DeepEqual(dialed, want) {
+		t.Fatalf("got %v dialed, want %v", dialed, want)
+	}
+
+	for _, c := range []*Client{clients[0], clients[2]} {
+		if atomic.LoadInt32(&c.closed) != 1 {
+			t.Fatalf("want unused %s client to be closed", c.URL)
+		}
+	}
+
+	// No more than MaxAttempts kites are dialed and the errors of all
+	// of them are returned.
+	dialed = nil
+	clients = newClients("http://a/kite", "http://c/kite", "http://b/kite")
+
+	_, err = k.dialAny(clients, &DialOptions{MaxAttempts: 2})
+
+	e, ok := err.(*DialError)
+	if !ok {
+		t.Fatalf("want *DialError, got %v", err)
+	}
+
+	if want := []string{"http://a/kite", "http://c/kite"}; !reflect.DeepEqual(dialed, want) {
+		t.Fatalf("got %v dialed, want %v", dialed, want)
+	}
+
+	if len(e.Errs) != 2 || e.Errs["http://a/kite"] == nil || e.Errs["http://c/kite"] == nil {
+		t.Fatalf("got %v errors, want the ones of both kites", e.Errs)
+	}
+
+	if _, err := k.dialAny(nil, &DialOptions{}); err != ErrNoKitesAvailable {
+		t.Fatalf("want ErrNoKitesAvailable, got %v", err)
+	}
+}
@@ -29,10 +29,12 @@ func (f Function) IsValid() bool {
 }
 
 func (f Function) MarshalJSON() ([]byte, error) {
-	if _, ok := f.Caller.(callback); !ok {
+	switch f.Caller.(type) {
+	case callback, *trackedCallback:
+		return []byte(`"[Function]"`), nil
+	default:
 		return []byte(`null`), nil
 	}
-	return []byte(`"[Function]"`), nil
 }
 
 func (*Function) UnmarshalJSON(data []byte) error {
@@ -46,6 +48,15 @@ func Callback(f func(*Partial)) Function {
 	}
 }
 
+// TrackedCallback is like Callback, but registered is called with the ID of
+// the callback whenever a Scrubber registers it, so the callback can be
+// removed with Scrubber.RemoveCallback once it is not going to be called.
+func TrackedCallback(f func(*Partial), registered func(id uint64)) Function {
+	return Function{
+		Caller: &trackedCallback{f: f, registered: registered},
+	}
+}
+
 type callback func(*Partial)
 
 func (f callback) Call(args ...interface{}) error {
@@ -53,6 +64,15 @@ func (f callback) Call(args ...interface{}) error {
 	panic("you cannot call your own callback method")
 }
 
+type trackedCallback struct {
+	f          func(*Partial)
+	registered func(id uint64)
+}
+
+func (*trackedCallback) Call(args ...interface{}) error {
+	panic("you cannot call your own callback method")
+}
+
 // functionReceived is a type implementing caller interface.
 // It is used to set the Function when a callback function is received.
 type functionReceived func(...interface{}) error
@@ -76,6 +96,10 @@ type Path []interface{}
 // parseCallbacks parses the message's "callbacks" field and prepares
 // callback functions in "arguments" field.
 func ParseCallbacks(msg *Message, sender func(id uint64, args []interface{}) error) error {
+	if msg.Arguments == nil && len(msg.Callbacks) != 0 {
+		return errors.New("callbacks given for empty arguments")
+	}
+
 	// Parse callbacks field and create callback functions.
 	for methodID, path := range msg.Callbacks {
 		id, err := strconv.ParseUint(methodID, 10, 64)
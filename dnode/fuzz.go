@@ -0,0 +1,54 @@
+//go:build gofuzz
+// +build gofuzz
+
+package dnode
+
+// The following functions are entry points for go-fuzz, build them with:
+//
+//     go-fuzz-build -func FuzzMessage github.com/koding/kite/dnode
+//
+
+// FuzzMessage fuzzes decoding of a dnode message.
+func FuzzMessage(data []byte) int {
+	if _, err := ParseMessage(data, nopSender); err != nil {
+		return 0
+	}
+
+	return 1
+}
+
+// FuzzCallbacks fuzzes decoding of a dnode message together with setting
+// its callbacks into the most common types of arguments.
+func FuzzCallbacks(data []byte) int {
+	msg, err := ParseMessage(data, nopSender)
+	if err != nil {
+		return 0
+	}
+
+	var (
+		slice   []interface{}
+		partial []*Partial
+		object  []map[string]interface{}
+		fn      []struct {
+			Callback Function
+			Args     *Partial
+		}
+	)
+
+	msg.Arguments.Unmarshal(&slice)
+	msg.Arguments.Unmarshal(&object)
+	msg.Arguments.Unmarshal(&fn)
+
+	if err := msg.Arguments.Unmarshal(&partial); err != nil {
+		return 0
+	}
+
+	for _, p := range partial {
+		var m map[string]*Partial
+		p.Unmarshal(&m)
+	}
+
+	return 1
+}
+
+func nopSender(uint64, []interface{}) error { return nil }
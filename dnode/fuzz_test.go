@@ -0,0 +1,42 @@
+//go:build go1.18
+// +build go1.18
+
+package dnode
+
+import "testing"
+
+func FuzzParseMessage(f *testing.F) {
+	for _, seed := range messages {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := ParseMessage(data, func(uint64, []interface{}) error { return nil })
+		if err != nil {
+			return
+		}
+
+		var (
+			slice   []interface{}
+			partial []*Partial
+			object  []map[string]interface{}
+			fn      []struct {
+				Callback Function
+				Args     *Partial
+			}
+		)
+
+		msg.Arguments.Unmarshal(&slice)
+		msg.Arguments.Unmarshal(&object)
+		msg.Arguments.Unmarshal(&fn)
+
+		if err := msg.Arguments.Unmarshal(&partial); err != nil {
+			return
+		}
+
+		for _, p := range partial {
+			var m map[string]*Partial
+			p.Unmarshal(&m)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package dnode
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Limits restricts the shape of messages accepted by ParseMessageWithLimits,
+// protecting the receiver from maliciously crafted messages. A zero value of
+// any of the fields means there is no limit.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of JSON objects and arrays
+	// of the whole message.
+	MaxDepth int
+
+	// MaxCallbacks is the maximum number of callbacks in a message.
+	MaxCallbacks int
+
+	// MaxArguments is the maximum number of arguments in a message.
+	MaxArguments int
+}
+
+// LimitError is returned when a message exceeds one of the Limits.
+type LimitError struct {
+	// Limit is the name of exceeded limit - "depth", "callbacks"
+	// or "arguments".
+	Limit string
+
+	// Max is the value of the exceeded limit.
+	Max int
+
+	// Message is the rejected message, its callbacks are not parsed.
+	// It is nil when the message was rejected before being decoded.
+	Message *Message
+}
+
+func (e LimitError) Error() string {
+	return fmt.Sprintf("message exceeds the %s limit of %d", e.Limit, e.Max)
+}
+
+// ParseMessageWithLimits works like ParseMessage, but returns a LimitError
+// for messages that exceed the given limits. A nil limits means no limits.
+func ParseMessageWithLimits(data []byte, sender func(id uint64, args []interface{}) error, limits *Limits) (*Message, error) {
+	if limits == nil {
+		return ParseMessage(data, sender)
+	}
+
+	// The depth is checked before decoding, so deeply nested messages
+	// never reach the decoder.
+	if limits.MaxDepth > 0 && depth(data) > limits.MaxDepth {
+		return nil, LimitError{Limit: "depth", Max: limits.MaxDepth}
+	}
+
+	msg, err := decodeMessage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if limits.MaxCallbacks > 0 && len(msg.Callbacks) > limits.MaxCallbacks {
+		return nil, LimitError{Limit: "callbacks", Max: limits.MaxCallbacks, Message: msg}
+	}
+
+	if limits.MaxArguments > 0 {
+		var args []json.RawMessage
+
+		// Non-array arguments are rejected later on, when unmarshaled.
+		if json.Unmarshal(msg.Arguments.Raw, &args) == nil && len(args) > limits.MaxArguments {
+			return nil, LimitError{Limit: "arguments", Max: limits.MaxArguments, Message: msg}
+		}
+	}
+
+	if err := ParseCallbacks(msg, sender); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// depth returns the maximum nesting depth of objects and arrays in the
+// given JSON data. It does not validate the data.
+func depth(data []byte) int {
+	var (
+		cur, max int
+		inString bool
+		escaped  bool
+	)
+
+	for _, b := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch b {
+		case '"':
+			inString = true
+		case '{', '[':
+			cur++
+			if cur > max {
+				max = cur
+			}
+		case '}', ']':
+			cur--
+		}
+	}
+
+	return max
+}
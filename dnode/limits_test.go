@@ -0,0 +1,67 @@
+package dnode
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMessageWithLimits(t *testing.T) {
+	limits := &Limits{
+		MaxDepth:     4,
+		MaxCallbacks: 2,
+		MaxArguments: 2,
+	}
+
+	cases := map[string]struct {
+		msg   string
+		limit string
+	}{
+		"ok": {
+			`{"method":"a","arguments":[{"a":[1]},"[\"{"],"callbacks":{"0":["0","cb"]}}`,
+			"",
+		},
+		"depth": {
+			`{"method":"a","arguments":[{"a":[[1]]}],"callbacks":{}}`,
+			"depth",
+		},
+		"callbacks": {
+			`{"method":"a","arguments":[{}],"callbacks":{"0":["0","a"],"1":["0","b"],"2":["0","c"]}}`,
+			"callbacks",
+		},
+		"arguments": {
+			`{"method":"a","arguments":[1,2,3],"callbacks":{}}`,
+			"arguments",
+		},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			msg, err := ParseMessageWithLimits([]byte(cas.msg), func(uint64, []interface{}) error { return nil }, limits)
+
+			if cas.limit == "" {
+				if err != nil {
+					t.Fatalf("ParseMessageWithLimits()=%s", err)
+				}
+
+				if len(msg.Arguments.CallbackSpecs) != 1 {
+					t.Fatalf("want 1 callback, got %d", len(msg.Arguments.CallbackSpecs))
+				}
+
+				return
+			}
+
+			e, ok := err.(LimitError)
+			if !ok {
+				t.Fatalf("want LimitError, got %v", err)
+			}
+
+			if e.Limit != cas.limit || !strings.Contains(e.Error(), cas.limit) {
+				t.Fatalf("want %q limit, got %q", cas.limit, e.Error())
+			}
+
+			if (e.Message == nil) != (cas.limit == "depth") {
+				t.Fatalf("unexpected message: %+v", e.Message)
+			}
+		})
+	}
+}
@@ -3,6 +3,11 @@
 // https://github.com/substack/dnode-protocol/blob/master/doc/protocol.markdown
 package dnode
 
+import (
+	"encoding/json"
+	"errors"
+)
+
 // Message is the JSON object to call a method at the other side.
 type Message struct {
 	// Method can be an integer or string.
@@ -14,3 +19,34 @@ type Message struct {
 	// Integer map of callback paths in arguments
 	Callbacks map[string]Path `json:"callbacks"`
 }
+
+// ParseMessage decodes a dnode message from data and prepares the callback
+// functions of its arguments, which are going to be called with the given
+// sender. It returns an error for every malformed message and never panics,
+// so it is safe to use it for frames received from the network.
+func ParseMessage(data []byte, sender func(id uint64, args []interface{}) error) (*Message, error) {
+	msg, err := decodeMessage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ParseCallbacks(msg, sender); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func decodeMessage(data []byte) (*Message, error) {
+	var msg Message
+
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+
+	if msg.Arguments == nil {
+		return nil, errors.New("dnode: message has no arguments")
+	}
+
+	return &msg, nil
+}
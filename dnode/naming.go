@@ -0,0 +1,268 @@
+package dnode
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Naming is a convention of naming the keys of JSON objects. It allows
+// talking with kites written in other languages, which use e.g. snake_case
+// keys, without tagging every field of the Go structs.
+type Naming int
+
+const (
+	// GoNaming leaves the keys as they are - Go field names are sent, unless
+	// the fields are tagged, and keys are matched case-insensitively.
+	GoNaming Naming = iota
+
+	// SnakeCase names the keys like "field_name".
+	SnakeCase
+
+	// CamelCase names the keys like "fieldName".
+	CamelCase
+)
+
+var partialType = reflect.TypeOf(Partial{})
+
+// Namings maps names of the conventions to their values.
+var Namings = map[string]Naming{
+	"go":         GoNaming,
+	"snake_case": SnakeCase,
+	"camelCase":  CamelCase,
+}
+
+func (n Naming) String() string {
+	switch n {
+	case GoNaming:
+		return "go"
+	case SnakeCase:
+		return "snake_case"
+	case CamelCase:
+		return "camelCase"
+	default:
+		return "unknown"
+	}
+}
+
+// Key converts the key to the naming convention, e.g. "UserID" is converted
+// to "user_id" by SnakeCase and to "userID" by CamelCase.
+func (n Naming) Key(key string) string {
+	switch n {
+	case SnakeCase:
+		return snakeCase(key)
+	case CamelCase:
+		return camelCase(key)
+	default:
+		return key
+	}
+}
+
+// Marshal returns the JSON encoding of v with keys of all the objects,
+// including the ones encoded from maps, converted to the naming convention.
+func (n Naming) Marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || n == GoNaming {
+		return data, err
+	}
+
+	tree, err := decodeTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(renameKeys(tree, n.Key))
+}
+
+// MatchFields rewrites keys of the JSON objects in data, which are going to
+// be decoded into struct fields of the type t, to the names of the fields.
+// The keys are matched ignoring case and underscores, so both "user_id" and
+// "userId" are decoded into the UserID field. Keys of maps are left intact.
+func MatchFields(data []byte, t reflect.Type) ([]byte, error) {
+	if t == nil {
+		return data, nil
+	}
+
+	tree, err := decodeTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(matchFields(tree, t))
+}
+
+func decodeTree(data []byte) (interface{}, error) {
+	var tree interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+func renameKeys(v interface{}, rename func(string) string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			renamed[rename(key)] = renameKeys(value, rename)
+		}
+		return renamed
+	case []interface{}:
+		for i, value := range v {
+			v[i] = renameKeys(value, rename)
+		}
+	}
+
+	return v
+}
+
+func matchFields(v interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// Types with custom decoding are left as they are.
+	if t.Implements(unmarshalerType) || reflect.PtrTo(t).Implements(unmarshalerType) {
+		return v
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+
+		fields := make(map[string]reflect.Type)
+		structFields(t, fields)
+
+		names := make(map[string]string, len(fields))
+		for name := range fields {
+			names[normalizeKey(name)] = name
+		}
+
+		matched := make(map[string]interface{}, len(obj))
+		for key, value := range obj {
+			if _, ok := fields[strings.ToLower(key)]; !ok {
+				if name, ok := names[normalizeKey(key)]; ok {
+					key = name
+				}
+			}
+
+			if ft, ok := fields[strings.ToLower(key)]; ok {
+				value = matchFields(value, ft)
+			}
+
+			matched[key] = value
+		}
+		return matched
+	case reflect.Map:
+		if obj, ok := v.(map[string]interface{}); ok {
+			for key, value := range obj {
+				obj[key] = matchFields(value, t.Elem())
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if arr, ok := v.([]interface{}); ok {
+			for i, value := range arr {
+				arr[i] = matchFields(value, t.Elem())
+			}
+		}
+	}
+
+	return v
+}
+
+// setOptions passes the naming convention and the number decoding of
+// the partial p to the partials contained in v.
+func setOptions(v reflect.Value, p *Partial) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			setOptions(v.Elem(), p)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			setOptions(v.Index(i), p)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			setOptions(v.MapIndex(key), p)
+		}
+	case reflect.Struct:
+		if v.Type() == partialType {
+			if v.CanAddr() {
+				nested := v.Addr().Interface().(*Partial)
+				nested.Naming = p.Naming
+				nested.Numbers = p.Numbers
+			}
+			return
+		}
+
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				setOptions(v.Field(i), p)
+			}
+		}
+	}
+}
+
+// normalizeKey lowercases the key and strips underscores from it.
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.Replace(key, "_", "", -1))
+}
+
+func snakeCase(key string) string {
+	runes := []rune(key)
+	buf := make([]rune, 0, len(runes)+4)
+
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+
+			if prev != '_' && (unicode.IsLower(prev) || unicode.IsDigit(prev) || nextLower && unicode.IsUpper(prev)) {
+				buf = append(buf, '_')
+			}
+		}
+
+		buf = append(buf, unicode.ToLower(r))
+	}
+
+	return string(buf)
+}
+
+func camelCase(key string) string {
+	parts := strings.Split(key, "_")
+	runes := []rune(parts[0])
+
+	// Lowercase the leading upper case letters, leaving the last one of an
+	// acronym followed by a word, e.g. "HTTPServer" becomes "httpServer".
+	for i := 0; i < len(runes) && unicode.IsUpper(runes[i]); i++ {
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+
+		runes[i] = unicode.ToLower(runes[i])
+	}
+
+	buf := runes
+	for _, part := range parts[1:] {
+		if part == "" {
+			continue
+		}
+
+		p := []rune(part)
+		p[0] = unicode.ToUpper(p[0])
+		buf = append(buf, p...)
+	}
+
+	return string(buf)
+}
@@ -0,0 +1,101 @@
+package dnode
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNaming_Key(t *testing.T) {
+	cases := []struct {
+		key   string
+		snake string
+		camel string
+	}{
+		{"UserID", "user_id", "userID"},
+		{"HTTPServer", "http_server", "httpServer"},
+		{"fieldName", "field_name", "fieldName"},
+		{"field_name", "field_name", "fieldName"},
+		{"ID", "id", "id"},
+		{"Version2Name", "version2_name", "version2Name"},
+		{"name", "name", "name"},
+	}
+
+	for _, cas := range cases {
+		if got := SnakeCase.Key(cas.key); got != cas.snake {
+			t.Errorf("SnakeCase.Key(%q)=%q, want %q", cas.key, got, cas.snake)
+		}
+
+		if got := CamelCase.Key(cas.key); got != cas.camel {
+			t.Errorf("CamelCase.Key(%q)=%q, want %q", cas.key, got, cas.camel)
+		}
+
+		if got := GoNaming.Key(cas.key); got != cas.key {
+			t.Errorf("GoNaming.Key(%q)=%q", cas.key, got)
+		}
+	}
+}
+
+func TestNaming_Marshal(t *testing.T) {
+	type Result struct {
+		UserID    int
+		FirstName string
+		Groups    []struct{ GroupName string }
+	}
+
+	v := Result{UserID: 1, FirstName: "john", Groups: []struct{ GroupName string }{{"admins"}}}
+
+	p, err := SnakeCase.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal()=%s", err)
+	}
+
+	want := `{"first_name":"john","groups":[{"group_name":"admins"}],"user_id":1}`
+
+	if string(p) != want {
+		t.Fatalf("got %s, want %s", p, want)
+	}
+}
+
+func TestPartial_UnmarshalNaming(t *testing.T) {
+	type Args struct {
+		UserID   int
+		FullName string `json:"fullName"`
+		Labels   map[string]string
+		OnDone   Function
+	}
+
+	raw := `[{"user_id":1,"full_name":"John Doe","labels":{"team_name":"x"},"on_done":"[Function]"}]`
+
+	var called bool
+
+	p := &Partial{
+		Raw:    []byte(raw),
+		Naming: SnakeCase,
+		CallbackSpecs: []CallbackSpec{{
+			Path:     Path{"0", "on_done"},
+			Function: Function{functionReceived(func(...interface{}) error { called = true; return nil })},
+		}},
+	}
+
+	var args Args
+
+	if err := p.One().Unmarshal(&args); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	want := Args{UserID: 1, FullName: "John Doe", Labels: map[string]string{"team_name": "x"}}
+
+	if !args.OnDone.IsValid() {
+		t.Fatal("want OnDone callback to be set")
+	}
+
+	if err := args.OnDone.Call(); err != nil || !called {
+		t.Fatalf("Call()=%v, called=%t", err, called)
+	}
+
+	args.OnDone = Function{}
+
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("got %+v, want %+v", args, want)
+	}
+}
@@ -0,0 +1,150 @@
+package dnode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+)
+
+// NumberMode tells how the JSON numbers are decoded into interface{} values,
+// e.g. the ones of map[string]interface{} arguments. By default they are
+// decoded as float64, which silently loses the precision of the integers
+// larger than 2^53, like the IDs generated by databases. The numbers decoded
+// into fields of the numeric types are not affected.
+type NumberMode int
+
+const (
+	// NumberFloat64 decodes the numbers as float64.
+	NumberFloat64 NumberMode = iota
+
+	// NumberJSON decodes the numbers as json.Number, keeping their text.
+	NumberJSON
+
+	// NumberInt64 decodes the integers as int64 and the other numbers as
+	// float64. The integers overflowing int64 are decoded as json.Number.
+	NumberInt64
+)
+
+var numberType = reflect.TypeOf(json.Number(""))
+
+// NumberModes maps names of the number modes to their values.
+var NumberModes = map[string]NumberMode{
+	"float64": NumberFloat64,
+	"json":    NumberJSON,
+	"int64":   NumberInt64,
+}
+
+func (m NumberMode) String() string {
+	switch m {
+	case NumberFloat64:
+		return "float64"
+	case NumberJSON:
+		return "json"
+	case NumberInt64:
+		return "int64"
+	default:
+		return "unknown"
+	}
+}
+
+// unmarshal works like json.Unmarshal, decoding the numbers into
+// the interface{} values according to the mode.
+func (m NumberMode) unmarshal(data []byte, v interface{}) error {
+	if m == NumberFloat64 {
+		return json.Unmarshal(data, v)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+
+	// json.Unmarshal rejects the data following the value, so does
+	// the decoding.
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid data after top-level value")
+	}
+
+	if m == NumberInt64 {
+		convertNumbers(reflect.ValueOf(v))
+	}
+
+	return nil
+}
+
+// convertNumbers replaces the json.Number values held by the interface{}
+// values in v with int64 or float64 ones, see NumberInt64.
+func convertNumbers(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			convertNumbers(v.Elem())
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+
+		if e := v.Elem(); e.Type() == numberType {
+			if v.CanSet() {
+				v.Set(reflect.ValueOf(convertNumber(json.Number(e.String()))))
+			}
+		} else {
+			convertNumbers(e)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			convertNumbers(v.Index(i))
+		}
+	case reflect.Map:
+		// The values of maps are not addressable, they are converted
+		// in copies.
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			convertNumbers(elem)
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.Struct:
+		if v.Type() == partialType {
+			return
+		}
+
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				convertNumbers(v.Field(i))
+			}
+		}
+	}
+}
+
+func convertNumber(n json.Number) interface{} {
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+
+	if isInteger(string(n)) {
+		return n // overflows int64
+	}
+
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+
+	return n
+}
+
+// isInteger tells whether the JSON number has no fraction nor exponent.
+func isInteger(s string) bool {
+	for _, c := range s {
+		if c == '.' || c == 'e' || c == 'E' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,91 @@
+package dnode
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNumberMode(t *testing.T) {
+	raw := []byte(`[{"id":9007199254740993,"ratio":0.5,"big":18446744073709551615,"ids":[1,2]},{"user":{"id":9007199254740993}}]`)
+
+	type args struct {
+		User map[string]interface{}
+	}
+
+	cases := []struct {
+		mode NumberMode
+		want map[string]interface{}
+		user interface{}
+	}{{
+		NumberFloat64,
+		map[string]interface{}{
+			"id":    float64(9007199254740993),
+			"ratio": 0.5,
+			"big":   float64(18446744073709551615),
+			"ids":   []interface{}{float64(1), float64(2)},
+		},
+		float64(9007199254740993),
+	}, {
+		NumberJSON,
+		map[string]interface{}{
+			"id":    json.Number("9007199254740993"),
+			"ratio": json.Number("0.5"),
+			"big":   json.Number("18446744073709551615"),
+			"ids":   []interface{}{json.Number("1"), json.Number("2")},
+		},
+		json.Number("9007199254740993"),
+	}, {
+		NumberInt64,
+		map[string]interface{}{
+			"id":    int64(9007199254740993),
+			"ratio": 0.5,
+			"big":   json.Number("18446744073709551615"),
+			"ids":   []interface{}{int64(1), int64(2)},
+		},
+		int64(9007199254740993),
+	}}
+
+	for _, cas := range cases {
+		p := &Partial{Raw: raw, Numbers: cas.mode}
+
+		s, err := p.Slice()
+		if err != nil {
+			t.Fatalf("%s: Slice()=%s", cas.mode, err)
+		}
+
+		var got map[string]interface{}
+		if err := s[0].Unmarshal(&got); err != nil {
+			t.Fatalf("%s: Unmarshal()=%s", cas.mode, err)
+		}
+
+		if !reflect.DeepEqual(got, cas.want) {
+			t.Errorf("%s: got %#v, want %#v", cas.mode, got, cas.want)
+		}
+
+		var a args
+		if err := s[1].Unmarshal(&a); err != nil {
+			t.Fatalf("%s: Unmarshal()=%s", cas.mode, err)
+		}
+
+		if got := a.User["id"]; got != cas.user {
+			t.Errorf("%s: got %#v, want %#v", cas.mode, got, cas.user)
+		}
+	}
+}
+
+func TestPartial_Int64(t *testing.T) {
+	p := &Partial{Raw: []byte(`9007199254740993`)}
+
+	if n := p.MustInt64(); n != 9007199254740993 {
+		t.Fatalf("got %d, want 9007199254740993", n)
+	}
+
+	if n := p.MustNumber(); n != "9007199254740993" {
+		t.Fatalf("got %s, want 9007199254740993", n)
+	}
+
+	if _, err := (&Partial{Raw: []byte(`1 2`), Numbers: NumberJSON}).Int64(); err == nil {
+		t.Fatal("Int64(): want error")
+	}
+}
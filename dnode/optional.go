@@ -0,0 +1,153 @@
+package dnode
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+var null = []byte("null")
+
+// Optional is a field of arguments, which allows handlers to tell apart
+// a field that was not sent, a field sent as null and a field sent with
+// a zero value - all of which are decoded into a zero value otherwise:
+//
+//     type UpdateArgs struct {
+//         Name  dnode.OptionalString
+//         Owner dnode.Optional
+//     }
+//
+//     if args.Owner.Set && !args.Owner.Null {
+//         err := args.Owner.Value.Unmarshal(&owner)
+//     }
+//
+// Optional fields which are not set are sent as null.
+type Optional struct {
+	Set   bool     // the field was present
+	Null  bool     // the field was null
+	Value *Partial // the raw value, nil unless the field was set
+}
+
+// Valid returns true if the field was set to a non-null value.
+func (o Optional) Valid() bool {
+	return o.Set && !o.Null
+}
+
+// Unmarshal unmarshals the value of the field into v. It's a no-op unless
+// the field was set to a non-null value.
+func (o Optional) Unmarshal(v interface{}) error {
+	if !o.Valid() {
+		return nil
+	}
+
+	return o.Value.Unmarshal(v)
+}
+
+func (o Optional) MarshalJSON() ([]byte, error) {
+	if !o.Valid() || o.Value == nil {
+		return null, nil
+	}
+
+	return o.Value.Raw, nil
+}
+
+func (o *Optional) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	o.Null = isNull(data)
+	o.Value = &Partial{Raw: append([]byte(nil), data...)}
+	return nil
+}
+
+// OptionalString is an Optional string field.
+type OptionalString struct {
+	Value string
+	Set   bool // the field was present
+	Null  bool // the field was null
+}
+
+// Valid returns true if the field was set to a non-null value.
+func (o OptionalString) Valid() bool { return o.Set && !o.Null }
+
+func (o OptionalString) MarshalJSON() ([]byte, error) {
+	return marshalOptional(o.Valid(), o.Value)
+}
+
+func (o *OptionalString) UnmarshalJSON(data []byte) error {
+	return unmarshalOptional(data, &o.Set, &o.Null, &o.Value)
+}
+
+// OptionalInt64 is an Optional integer field.
+type OptionalInt64 struct {
+	Value int64
+	Set   bool // the field was present
+	Null  bool // the field was null
+}
+
+// Valid returns true if the field was set to a non-null value.
+func (o OptionalInt64) Valid() bool { return o.Set && !o.Null }
+
+func (o OptionalInt64) MarshalJSON() ([]byte, error) {
+	return marshalOptional(o.Valid(), o.Value)
+}
+
+func (o *OptionalInt64) UnmarshalJSON(data []byte) error {
+	return unmarshalOptional(data, &o.Set, &o.Null, &o.Value)
+}
+
+// OptionalFloat64 is an Optional number field.
+type OptionalFloat64 struct {
+	Value float64
+	Set   bool // the field was present
+	Null  bool // the field was null
+}
+
+// Valid returns true if the field was set to a non-null value.
+func (o OptionalFloat64) Valid() bool { return o.Set && !o.Null }
+
+func (o OptionalFloat64) MarshalJSON() ([]byte, error) {
+	return marshalOptional(o.Valid(), o.Value)
+}
+
+func (o *OptionalFloat64) UnmarshalJSON(data []byte) error {
+	return unmarshalOptional(data, &o.Set, &o.Null, &o.Value)
+}
+
+// OptionalBool is an Optional boolean field.
+type OptionalBool struct {
+	Value bool
+	Set   bool // the field was present
+	Null  bool // the field was null
+}
+
+// Valid returns true if the field was set to a non-null value.
+func (o OptionalBool) Valid() bool { return o.Set && !o.Null }
+
+func (o OptionalBool) MarshalJSON() ([]byte, error) {
+	return marshalOptional(o.Valid(), o.Value)
+}
+
+func (o *OptionalBool) UnmarshalJSON(data []byte) error {
+	return unmarshalOptional(data, &o.Set, &o.Null, &o.Value)
+}
+
+func marshalOptional(valid bool, v interface{}) ([]byte, error) {
+	if !valid {
+		return null, nil
+	}
+
+	return json.Marshal(v)
+}
+
+func unmarshalOptional(data []byte, set, isnull *bool, v interface{}) error {
+	*set = true
+	*isnull = isNull(data)
+
+	if *isnull {
+		return nil
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func isNull(data []byte) bool {
+	return bytes.Equal(bytes.TrimSpace(data), null)
+}
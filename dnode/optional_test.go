@@ -0,0 +1,59 @@
+package dnode
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOptional(t *testing.T) {
+	type Args struct {
+		Name  OptionalString
+		Count OptionalInt64
+		Ratio OptionalFloat64
+		Force OptionalBool
+		Owner Optional
+	}
+
+	var args Args
+
+	raw := `{"name":"","count":null,"owner":{"id":"1"}}`
+
+	if err := (&Partial{Raw: []byte(raw)}).Unmarshal(&args); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	if !args.Name.Set || args.Name.Null || !args.Name.Valid() {
+		t.Errorf("want name to be set to an empty string: %+v", args.Name)
+	}
+
+	if !args.Count.Set || !args.Count.Null || args.Count.Valid() {
+		t.Errorf("want count to be null: %+v", args.Count)
+	}
+
+	if args.Ratio.Set || args.Force.Set {
+		t.Errorf("want ratio and force not to be set: %+v, %+v", args.Ratio, args.Force)
+	}
+
+	var owner struct{ ID string }
+
+	if err := args.Owner.Unmarshal(&owner); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	if owner.ID != "1" {
+		t.Errorf("got owner %+v, want ID 1", owner)
+	}
+
+	args.Force = OptionalBool{Value: true, Set: true}
+
+	p, err := json.Marshal(args)
+	if err != nil {
+		t.Fatalf("Marshal()=%s", err)
+	}
+
+	want := `{"Name":"","Count":null,"Ratio":null,"Force":true,"Owner":{"id":"1"}}`
+
+	if string(p) != want {
+		t.Fatalf("got %s, want %s", p, want)
+	}
+}
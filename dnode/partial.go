@@ -11,6 +11,15 @@ import (
 type Partial struct {
 	Raw           []byte
 	CallbackSpecs []CallbackSpec
+
+	// Naming is the naming convention of the keys in Raw. Unless it's
+	// GoNaming, the keys are matched to the struct fields with MatchFields
+	// when unmarshaling.
+	Naming Naming
+
+	// Numbers tells how the numbers are decoded into the interface{}
+	// values when unmarshaling, see NumberMode.
+	Numbers NumberMode
 }
 
 // MarshalJSON returns the raw bytes of the Partial.
@@ -36,12 +45,29 @@ func (p *Partial) Unmarshal(v interface{}) error {
 		return fmt.Errorf("Cannot unmarshal nil argument")
 	}
 
-	if err := json.Unmarshal(p.Raw, &v); err != nil {
+	raw := p.Raw
+	if p.Naming != GoNaming {
+		if matched, err := MatchFields(raw, reflect.TypeOf(v)); err == nil {
+			raw = matched
+		}
+	}
+
+	if t := reflect.TypeOf(v); hasTimes(t) {
+		if converted, err := ConvertTimes(raw, t); err == nil {
+			raw = converted
+		}
+	}
+
+	if err := p.Numbers.unmarshal(raw, &v); err != nil {
 		return fmt.Errorf("%s. Data: %s", err.Error(), string(p.Raw))
 	}
 
 	value := reflect.ValueOf(v)
 
+	if p.Naming != GoNaming || p.Numbers != NumberFloat64 {
+		setOptions(value, p)
+	}
+
 	for _, spec := range p.CallbackSpecs {
 		if err := setCallback(value, spec.Path, spec.Function.Caller.(functionReceived)); err != nil {
 			return err
@@ -98,6 +124,19 @@ func (p *Partial) Float64() (f float64, err error) {
 	return
 }
 
+// Int64 is a helper to unmarshal a JSON Number, which is an integer,
+// without losing the precision of the large ones.
+func (p *Partial) Int64() (n int64, err error) {
+	err = p.Unmarshal(&n)
+	return
+}
+
+// Number is a helper to unmarshal a JSON Number as it was sent.
+func (p *Partial) Number() (n json.Number, err error) {
+	err = p.Unmarshal(&n)
+	return
+}
+
 // Bool is a helper to unmarshal a JSON Boolean.
 func (p *Partial) Bool() (b bool, err error) {
 	err = p.Unmarshal(&b)
@@ -154,6 +193,18 @@ func (p *Partial) MustFloat64() float64 {
 	return f
 }
 
+func (p *Partial) MustInt64() int64 {
+	n, err := p.Int64()
+	checkError(err)
+	return n
+}
+
+func (p *Partial) MustNumber() json.Number {
+	n, err := p.Number()
+	checkError(err)
+	return n
+}
+
 func (p *Partial) MustBool() bool {
 	b, err := p.Bool()
 	checkError(err)
@@ -19,3 +19,29 @@ func TestUnmarshalArguments(t *testing.T) {
 		return
 	}
 }
+
+// messages are both valid and malformed dnode messages.
+var messages = []string{
+	`{"method":"square","arguments":[{"kite":{},"withArgs":[4],"responseCallback":"[Function]"}],"callbacks":{"0":["0","responseCallback"]}}`,
+	`{"method":1,"arguments":[{"result":16,"error":null}],"callbacks":{}}`,
+	`{"method":"a","arguments":[[1,2]],"callbacks":{"1":["0","5"]}}`,
+	`{"method":"a","arguments":[{"":1}],"callbacks":{"1":["0",""]}}`,
+	`{"method":"a","arguments":[null],"callbacks":{"1":["0",null,true]}}`,
+	`{"method":"a","callbacks":{"1":["0"]}}`,
+	`{"method":"a","arguments":{},"callbacks":{"x":[]}}`,
+}
+
+func TestUnmarshalMalformedCallbacks(t *testing.T) {
+	for _, seed := range messages {
+		msg, err := ParseMessage([]byte(seed), func(uint64, []interface{}) error { return nil })
+		if err != nil {
+			continue
+		}
+
+		var partial []*Partial
+		var object []map[string]interface{}
+
+		msg.Arguments.Unmarshal(&object)
+		msg.Arguments.Unmarshal(&partial)
+	}
+}
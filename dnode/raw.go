@@ -0,0 +1,292 @@
+package dnode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+var errUnexpectedEnd = errors.New("dnode: unexpected end of JSON input")
+
+// Reader returns a reader of the raw data of the Partial. Unlike Unmarshal,
+// it does not decode the whole data at once, so large arguments can be
+// processed in parts, see Decoder.
+func (p *Partial) Reader() io.Reader {
+	return bytes.NewReader(p.Raw)
+}
+
+// Decoder returns a JSON decoder reading the raw data of the Partial, for
+// decoding large arguments element by element:
+//
+//     dec := args.Decoder()
+//
+//     if _, err := dec.Token(); err != nil { // [
+//         return nil, err
+//     }
+//
+//     for dec.More() {
+//         var row Row
+//         if err := dec.Decode(&row); err != nil {
+//             return nil, err
+//         }
+//         ...
+//     }
+//
+// Unless p.Numbers is NumberFloat64, the numbers decoded into interface{}
+// values are json.Number. The keys are not matched with p.Naming and
+// the callbacks are not set, use Unmarshal for the arguments which need it.
+func (p *Partial) Decoder() *json.Decoder {
+	dec := json.NewDecoder(p.Reader())
+
+	if p.Numbers != NumberFloat64 {
+		dec.UseNumber()
+	}
+
+	return dec
+}
+
+// Index returns the i-th element of the JSON array. Unlike the elements
+// returned by Slice, it shares the raw data with p instead of copying it.
+func (p *Partial) Index(i int) (*Partial, error) {
+	if p == nil {
+		return nil, fmt.Errorf("Cannot index nil argument")
+	}
+
+	var raw []byte
+	n := 0
+
+	err := members(p.Raw, '[', func(_, value []byte) bool {
+		if n == i {
+			raw = value
+			return false
+		}
+		n++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if raw == nil {
+		return nil, fmt.Errorf("dnode: index %d out of range [0:%d]", i, n)
+	}
+
+	return p.sub(raw, strconv.Itoa(i)), nil
+}
+
+// Field returns the value of the field of the JSON object with the given
+// key, or nil if there is none. Like Index, it shares the raw data with p.
+func (p *Partial) Field(key string) (*Partial, error) {
+	if p == nil {
+		return nil, fmt.Errorf("Cannot get field of nil argument")
+	}
+
+	var raw []byte
+	var err error
+
+	merr := members(p.Raw, '{', func(k, value []byte) bool {
+		var s string
+		if err = json.Unmarshal(k, &s); err != nil {
+			return false
+		}
+
+		if s == key {
+			raw = value
+			return false
+		}
+
+		return true
+	})
+	if merr != nil {
+		return nil, merr
+	}
+
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	return p.sub(raw, key), nil
+}
+
+// MustIndex is the same as Index, but panics with an ArgumentError
+// instead of returning an error.
+func (p *Partial) MustIndex(i int) *Partial {
+	e, err := p.Index(i)
+	checkError(err)
+	return e
+}
+
+// MustField is the same as Field, but panics with an ArgumentError
+// instead of returning an error.
+func (p *Partial) MustField(key string) *Partial {
+	f, err := p.Field(key)
+	checkError(err)
+	return f
+}
+
+// sub returns the Partial of the raw value under the key, which inherits
+// the options and the callbacks of p under the key.
+func (p *Partial) sub(raw []byte, key string) *Partial {
+	s := &Partial{
+		Raw:     raw,
+		Naming:  p.Naming,
+		Numbers: p.Numbers,
+	}
+
+	for _, spec := range p.CallbackSpecs {
+		if len(spec.Path) != 0 && fmt.Sprint(spec.Path[0]) == key {
+			s.CallbackSpecs = append(s.CallbackSpecs, CallbackSpec{
+				Path:     spec.Path[1:],
+				Function: spec.Function,
+			})
+		}
+	}
+
+	return s
+}
+
+// members calls fn with the raw keys and values of the members of the JSON
+// array or object in data, depending on open, until fn returns false.
+// The keys are nil for arrays. Like depth, it does not validate the data,
+// which is expected to be validated already, e.g. by ParseMessage.
+func members(data []byte, open byte, fn func(key, value []byte) bool) error {
+	closing := byte(']')
+	if open == '{' {
+		closing = '}'
+	}
+
+	i := skipSpace(data, 0)
+	if i == len(data) || data[i] != open {
+		return fmt.Errorf("dnode: expected %q in JSON input", open)
+	}
+
+	if i = skipSpace(data, i+1); i < len(data) && data[i] == closing {
+		return nil
+	}
+
+	for {
+		var key []byte
+
+		if open == '{' {
+			if i == len(data) || data[i] != '"' {
+				return errors.New("dnode: expected object key in JSON input")
+			}
+
+			end, err := valueEnd(data, i)
+			if err != nil {
+				return err
+			}
+
+			key = data[i:end]
+
+			if i = skipSpace(data, end); i == len(data) || data[i] != ':' {
+				return errors.New("dnode: expected ':' in JSON input")
+			}
+
+			i = skipSpace(data, i+1)
+		}
+
+		end, err := valueEnd(data, i)
+		if err != nil {
+			return err
+		}
+
+		if !fn(key, data[i:end]) {
+			return nil
+		}
+
+		if i = skipSpace(data, end); i == len(data) {
+			return errUnexpectedEnd
+		}
+
+		switch data[i] {
+		case ',':
+			i = skipSpace(data, i+1)
+		case closing:
+			return nil
+		default:
+			return fmt.Errorf("dnode: unexpected %q in JSON input", data[i])
+		}
+	}
+}
+
+// valueEnd returns the index following the JSON value starting at data[i].
+func valueEnd(data []byte, i int) (int, error) {
+	if i >= len(data) {
+		return 0, errUnexpectedEnd
+	}
+
+	switch data[i] {
+	case '"':
+		for j := i + 1; j < len(data); j++ {
+			switch data[j] {
+			case '\\':
+				j++
+			case '"':
+				return j + 1, nil
+			}
+		}
+	case '{', '[':
+		var cur int
+		var inString, escaped bool
+
+		for j := i; j < len(data); j++ {
+			b := data[j]
+
+			if inString {
+				switch {
+				case escaped:
+					escaped = false
+				case b == '\\':
+					escaped = true
+				case b == '"':
+					inString = false
+				}
+				continue
+			}
+
+			switch b {
+			case '"':
+				inString = true
+			case '{', '[':
+				cur++
+			case '}', ']':
+				if cur--; cur == 0 {
+					return j + 1, nil
+				}
+			}
+		}
+	default:
+		j := i
+		for j < len(data) && !isDelim(data[j]) {
+			j++
+		}
+
+		if j > i {
+			return j, nil
+		}
+
+		return 0, fmt.Errorf("dnode: unexpected %q in JSON input", data[i])
+	}
+
+	return 0, errUnexpectedEnd
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && isSpace(data[i]) {
+		i++
+	}
+
+	return i
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+func isDelim(b byte) bool {
+	return isSpace(b) || b == ',' || b == ']' || b == '}' || b == ':'
+}
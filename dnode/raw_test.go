@@ -0,0 +1,98 @@
+package dnode
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPartial_Index(t *testing.T) {
+	p := &Partial{
+		Raw: []byte(` [ {"a": "x,]}", "b": [1, {"c": "\"}"}]} , 2,"s" ,null ] `),
+		CallbackSpecs: []CallbackSpec{
+			{Path: Path{float64(0), "f"}},
+			{Path: Path{"1"}},
+		},
+		Numbers: NumberJSON,
+	}
+
+	cases := []struct {
+		i    int
+		want string
+		cbs  int
+	}{
+		{0, `{"a": "x,]}", "b": [1, {"c": "\"}"}]}`, 1},
+		{1, `2`, 1},
+		{2, `"s"`, 0},
+		{3, `null`, 0},
+	}
+
+	for _, cas := range cases {
+		e, err := p.Index(cas.i)
+		if err != nil {
+			t.Fatalf("Index(%d)=%s", cas.i, err)
+		}
+
+		if string(e.Raw) != cas.want {
+			t.Errorf("Index(%d): got %s, want %s", cas.i, e.Raw, cas.want)
+		}
+
+		if len(e.CallbackSpecs) != cas.cbs {
+			t.Errorf("Index(%d): got %d callbacks, want %d", cas.i, len(e.CallbackSpecs), cas.cbs)
+		}
+
+		if e.Numbers != NumberJSON {
+			t.Errorf("Index(%d): got %s numbers, want json", cas.i, e.Numbers)
+		}
+	}
+
+	if _, err := p.Index(4); err == nil {
+		t.Fatal("Index(4): want error")
+	}
+
+	e := p.MustIndex(0)
+
+	b := e.MustField("b")
+	if b == nil || string(b.Raw) != `[1, {"c": "\"}"}]` {
+		t.Fatalf("got %v, want b field", b)
+	}
+
+	if f := e.MustField("c"); f != nil {
+		t.Fatalf("got %s, want nil", f.Raw)
+	}
+
+	// The elements share the data.
+	e.Raw[2] = 'A'
+
+	if p.Raw[5] != 'A' {
+		t.Fatalf("got %s, want shared data", p.Raw)
+	}
+
+	if _, err := (&Partial{Raw: []byte(`{"a":1}`)}).Index(0); err == nil {
+		t.Fatal("Index() of object: want error")
+	}
+}
+
+func TestPartial_Decoder(t *testing.T) {
+	p := &Partial{Raw: []byte(`[{"id":9007199254740993},{"id":2}]`), Numbers: NumberJSON}
+
+	dec := p.Decoder()
+
+	if _, err := dec.Token(); err != nil {
+		t.Fatalf("Token()=%s", err)
+	}
+
+	var ids []interface{}
+
+	for dec.More() {
+		var v map[string]interface{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("Decode()=%s", err)
+		}
+
+		ids = append(ids, v["id"])
+	}
+
+	if len(ids) != 2 || ids[0] != json.Number("9007199254740993") || ids[1] != json.Number("2") {
+		t.Fatalf("got %#v", ids)
+	}
+}
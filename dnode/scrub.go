@@ -55,8 +55,14 @@ func (s *Scrubber) collect(rv reflect.Value, path Path, callbacks map[string]Pat
 	case reflect.Struct:
 		// register callback functions wrapper.
 		if rv.Type() == dnodeFunctionType {
-			if cb := rv.Interface().(Function); cb.Caller != nil {
-				s.register(cb.Caller.(callback), path, callbacks)
+			switch cb := rv.Interface().(Function).Caller.(type) {
+			case nil:
+			case *trackedCallback:
+				if id, ok := s.register(cb.f, path, callbacks); ok && cb.registered != nil {
+					cb.registered(id)
+				}
+			default:
+				s.register(cb.(callback), path, callbacks)
 			}
 			return
 		}
@@ -119,11 +125,12 @@ func (s *Scrubber) methods(rv reflect.Value, path Path, callbacks map[string]Pat
 }
 
 // register is called when a function/method is found in arguments array. It
-// assigns an unique ID to the passed callback and stores it internally.
-func (s *Scrubber) register(cb func(*Partial), path Path, callbacks map[string]Path) {
+// assigns an unique ID to the passed callback and stores it internally. It
+// returns the ID and false if the callback is nil and was not registered.
+func (s *Scrubber) register(cb func(*Partial), path Path, callbacks map[string]Path) (uint64, bool) {
 	// do not register nil callbacks.
 	if cb == nil {
-		return
+		return 0, false
 	}
 	// subtract one to start counting from zero. This is not absolutely
 	// necessary, just cosmetics.
@@ -140,4 +147,6 @@ func (s *Scrubber) register(cb func(*Partial), path Path, callbacks map[string]P
 	pathCopy := make(Path, len(path))
 	copy(pathCopy, path)
 	callbacks[seq] = pathCopy
+
+	return next, true
 }
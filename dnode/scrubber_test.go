@@ -48,3 +48,28 @@ func TestScrubUnscrub(t *testing.T) {
 		t.Error("callback is not called")
 	}
 }
+
+func TestScrubTrackedCallback(t *testing.T) {
+	scrubber := NewScrubber()
+
+	var ids []uint64
+	f := TrackedCallback(func(*Partial) {}, func(id uint64) { ids = append(ids, id) })
+
+	callbacks := scrubber.Scrub([]interface{}{f, f})
+
+	if len(ids) != 2 || len(callbacks) != 2 {
+		t.Fatalf("got %v IDs for %v callbacks, want 2", ids, callbacks)
+	}
+
+	for _, id := range ids {
+		if scrubber.GetCallback(id) == nil {
+			t.Fatalf("callback %d is not registered", id)
+		}
+
+		scrubber.RemoveCallback(id)
+	}
+
+	if p, err := f.MarshalJSON(); err != nil || string(p) != `"[Function]"` {
+		t.Fatalf("got %s, %v", p, err)
+	}
+}
@@ -0,0 +1,156 @@
+package dnode
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// UnmarshalStrict does the same thing as Unmarshal, except it fails with
+// an *ArgumentError when the data contains object fields which v has no
+// struct fields for, e.g. because of a typo in their names, instead of
+// silently ignoring them.
+func (p *Partial) UnmarshalStrict(v interface{}) error {
+	if p == nil {
+		return fmt.Errorf("Cannot unmarshal nil argument")
+	}
+
+	if err := CheckFields(p.Raw, reflect.TypeOf(v)); err != nil {
+		return err
+	}
+
+	return p.Unmarshal(v)
+}
+
+// CheckFields returns an *ArgumentError if the JSON data contains object
+// fields which are not known to the type t. Malformed data is not reported,
+// it's up to the decoding to fail.
+func CheckFields(data []byte, t reflect.Type) error {
+	if t == nil {
+		return nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil
+	}
+
+	if path := unknownField(v, t, ""); path != "" {
+		return &ArgumentError{s: fmt.Sprintf("unknown field %q", path)}
+	}
+
+	return nil
+}
+
+// unknownField returns the path of the first field of v, which is not
+// known to the type t.
+func unknownField(v interface{}, t reflect.Type, path string) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// Types with custom decoding are not checked.
+	if t.Implements(unmarshalerType) || reflect.PtrTo(t).Implements(unmarshalerType) {
+		return ""
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+
+		fields := make(map[string]reflect.Type)
+		structFields(t, fields)
+
+		for key, value := range obj {
+			// encoding/json matches the names case-insensitively
+			ft, ok := fields[strings.ToLower(key)]
+			if !ok {
+				return joinPath(path, key)
+			}
+
+			if p := unknownField(value, ft, joinPath(path, key)); p != "" {
+				return p
+			}
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+
+		for key, value := range obj {
+			if p := unknownField(value, t.Elem(), joinPath(path, key)); p != "" {
+				return p
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return ""
+		}
+
+		for i, value := range arr {
+			if p := unknownField(value, t.Elem(), joinPath(path, strconv.Itoa(i))); p != "" {
+				return p
+			}
+		}
+	}
+
+	return ""
+}
+
+// structFields collects the lowercased JSON names of the fields of t,
+// embedded structs are flattened the same way the encoding/json
+// package does.
+func structFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := tag
+		if idx := strings.Index(tag, ","); idx != -1 {
+			name = tag[:idx]
+		}
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				structFields(ft, fields)
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fields[strings.ToLower(name)] = f.Type
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
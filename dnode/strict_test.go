@@ -0,0 +1,49 @@
+package dnode
+
+import (
+	"testing"
+)
+
+func TestPartial_UnmarshalStrict(t *testing.T) {
+	type Options struct {
+		Recursive bool `json:"recursive"`
+	}
+
+	type Args struct {
+		Options
+		Path     string             `json:"path"`
+		Mode     int                `json:"mode,omitempty"`
+		Callback Function           `json:"callback"`
+		Targets  []Options          `json:"targets"`
+		Extra    map[string]Options `json:"extra"`
+		Raw      *Partial           `json:"raw"`
+	}
+
+	cases := map[string]string{
+		`{"path":"/tmp","mode":1,"recursive":true}`:          "",
+		`{"Path":"/tmp","callback":"[Function]"}`:            "",
+		`{"path":"/tmp","raw":{"anything":1}}`:               "",
+		`{"path":"/tmp","mdoe":1}`:                           `unknown field "mdoe"`,
+		`{"targets":[{"recursive":true},{"recursiv":true}]}`: `unknown field "targets.1.recursiv"`,
+		`{"extra":{"home":{"recursive":true,"depth":2}}}`:    `unknown field "extra.home.depth"`,
+		`{"path":"/tmp","Options":{"recursive":true}}`:       `unknown field "Options"`,
+	}
+
+	for data, want := range cases {
+		var args Args
+
+		err := (&Partial{Raw: []byte(data)}).UnmarshalStrict(&args)
+
+		if want == "" {
+			if err != nil {
+				t.Errorf("%s: UnmarshalStrict()=%s", data, err)
+			}
+
+			continue
+		}
+
+		if _, ok := err.(*ArgumentError); !ok || err.Error() != want {
+			t.Errorf("%s: got %v, want %q", data, err, want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package dnode
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Times and durations are sent in their canonical encodings, which are the
+// ones produced by the encoding/json package:
+//
+//     time.Time      RFC3339 string, e.g. "2017-10-04T12:00:00.5Z"
+//     time.Duration  integer number of nanoseconds, e.g. 1500000000
+//
+// When unmarshaling into these types, Partial.Unmarshal converts also the
+// encodings commonly used by other languages - times given as a number of
+// seconds since the Unix epoch, e.g. 1507118400.5, and durations given as
+// strings accepted by time.ParseDuration, e.g. "1.5s".
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+
+	// hasTimesCache caches results of hasTimes by the type
+	hasTimesCache sync.Map
+)
+
+// ConvertTimes rewrites times and durations in the JSON data, which are going
+// to be decoded into fields of the type t, to their canonical encodings.
+func ConvertTimes(data []byte, t reflect.Type) ([]byte, error) {
+	if t == nil {
+		return data, nil
+	}
+
+	tree, err := decodeTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(convertTimes(tree, t))
+}
+
+func convertTimes(v interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		if n, ok := v.(json.Number); ok {
+			if f, err := n.Float64(); err == nil {
+				sec, frac := math.Modf(f)
+				return time.Unix(int64(sec), int64(frac*1e9)).UTC().Format(time.RFC3339Nano)
+			}
+		}
+		return v
+	case durationType:
+		if s, ok := v.(string); ok {
+			if d, err := time.ParseDuration(s); err == nil {
+				return json.Number(strconv.FormatInt(int64(d), 10))
+			}
+		}
+		return v
+	}
+
+	// Types with custom decoding are left as they are.
+	if t.Implements(unmarshalerType) || reflect.PtrTo(t).Implements(unmarshalerType) {
+		return v
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if obj, ok := v.(map[string]interface{}); ok {
+			fields := make(map[string]reflect.Type)
+			structFields(t, fields)
+
+			for key, value := range obj {
+				if ft, ok := fields[strings.ToLower(key)]; ok {
+					obj[key] = convertTimes(value, ft)
+				}
+			}
+		}
+	case reflect.Map:
+		if obj, ok := v.(map[string]interface{}); ok {
+			for key, value := range obj {
+				obj[key] = convertTimes(value, t.Elem())
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if arr, ok := v.([]interface{}); ok {
+			for i, value := range arr {
+				arr[i] = convertTimes(value, t.Elem())
+			}
+		}
+	}
+
+	return v
+}
+
+// hasTimes returns true if the values of type t may contain times or
+// durations.
+func hasTimes(t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+
+	if has, ok := hasTimesCache.Load(t); ok {
+		return has.(bool)
+	}
+
+	has := containsTimes(t, make(map[reflect.Type]bool))
+	hasTimesCache.Store(t, has)
+
+	return has
+}
+
+func containsTimes(t reflect.Type, seen map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType || t == durationType {
+		return true
+	}
+
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	if t.Implements(unmarshalerType) || reflect.PtrTo(t).Implements(unmarshalerType) {
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if containsTimes(t.Field(i).Type, seen) {
+				return true
+			}
+		}
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return containsTimes(t.Elem(), seen)
+	}
+
+	return false
+}
@@ -0,0 +1,47 @@
+package dnode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPartial_UnmarshalTimes(t *testing.T) {
+	type Args struct {
+		Deadline time.Time
+		Timeout  time.Duration
+		Retries  []time.Duration
+		Started  *time.Time
+	}
+
+	want := time.Date(2017, 10, 4, 12, 0, 0, 500000000, time.UTC)
+
+	cases := []string{
+		`{"deadline":"2017-10-04T12:00:00.5Z","timeout":1500000000,"retries":[1000000000,2000000000],"started":"2017-10-04T12:00:00.5Z"}`,
+		`{"deadline":1507118400.5,"timeout":"1.5s","retries":["1s","2s"],"started":1507118400.5}`,
+	}
+
+	for _, data := range cases {
+		var args Args
+
+		if err := (&Partial{Raw: []byte(data)}).Unmarshal(&args); err != nil {
+			t.Errorf("%s: Unmarshal()=%s", data, err)
+			continue
+		}
+
+		if !args.Deadline.Equal(want) {
+			t.Errorf("%s: got deadline %s, want %s", data, args.Deadline, want)
+		}
+
+		if args.Started == nil || !args.Started.Equal(want) {
+			t.Errorf("%s: got started %v, want %s", data, args.Started, want)
+		}
+
+		if args.Timeout != 1500*time.Millisecond {
+			t.Errorf("%s: got timeout %s, want 1.5s", data, args.Timeout)
+		}
+
+		if len(args.Retries) != 2 || args.Retries[1] != 2*time.Second {
+			t.Errorf("%s: got retries %v, want [1s 2s]", data, args.Retries)
+		}
+	}
+}
@@ -49,7 +49,11 @@ func setCallback(value reflect.Value, path Path, cb functionReceived) error {
 			case float64:
 				index = int(v)
 			default:
-				panic(fmt.Errorf("unknown type: %#v", path[i]))
+				return fmt.Errorf("integer expected in callback path, got %#v", path[i])
+			}
+
+			if index < 0 || index >= value.Len() {
+				return fmt.Errorf("callback path index out of range: %v", path)
 			}
 
 			value = value.Index(index)
@@ -58,21 +62,35 @@ func setCallback(value reflect.Value, path Path, cb functionReceived) error {
 			if i == len(path) {
 				return fmt.Errorf("callback path too short: %v", path)
 			}
+			key := reflect.ValueOf(path[i])
+			if !key.IsValid() || !key.Type().AssignableTo(value.Type().Key()) {
+				return fmt.Errorf("invalid key in callback path: %#v", path[i])
+			}
 			if i == len(path)-1 && value.Type().Elem().Kind() == reflect.Interface {
-				value.SetMapIndex(reflect.ValueOf(path[i]), reflect.ValueOf(cb))
+				if value.IsNil() || !reflect.TypeOf(cb).AssignableTo(value.Type().Elem()) {
+					return fmt.Errorf("cannot set callback at path: %v", path)
+				}
+				value.SetMapIndex(key, reflect.ValueOf(cb))
 				return nil
 			}
-			value = value.MapIndex(reflect.ValueOf(path[i]))
+			value = value.MapIndex(key)
 			i++
 		case reflect.Ptr:
 			value = value.Elem()
 		case reflect.Interface:
 			if i == len(path) {
+				if !value.CanSet() || !reflect.TypeOf(cb).AssignableTo(value.Type()) {
+					return fmt.Errorf("cannot set callback at path: %v", path)
+				}
 				value.Set(reflect.ValueOf(cb))
 				return nil
 			}
 			value = value.Elem()
 		case reflect.Struct:
+			if !value.CanSet() {
+				return fmt.Errorf("cannot set callback at path: %v", path)
+			}
+
 			if value.Type() == reflect.TypeOf(Function{}) {
 				caller := value.FieldByName("Caller")
 				caller.Set(reflect.ValueOf(cb))
@@ -85,13 +103,17 @@ func setCallback(value reflect.Value, path Path, cb functionReceived) error {
 				return nil
 			}
 
+			if i == len(path) {
+				return fmt.Errorf("callback path too short: %v", path)
+			}
+
 			// Path component may be a string or an integer.
 			name, ok := path[i].(string)
-			if !ok {
+			if !ok || name == "" {
 				return fmt.Errorf("Invalid path: %#v", path[i])
 			}
 
-			value = value.FieldByName(strings.ToUpper(name[0:1]) + name[1:])
+			value = fieldByName(value, name)
 			i++
 		case reflect.Func:
 			// plain func is not supported, use Function type
@@ -100,7 +122,37 @@ func setCallback(value reflect.Value, path Path, cb functionReceived) error {
 			// callback path does not exist, skip
 			return nil
 		default:
-			return fmt.Errorf("Unhandled value of kind '%v' in callback path: %s", value.Kind(), value.Interface())
+			return fmt.Errorf("Unhandled value of kind '%v' in callback path: %v", value.Kind(), path)
 		}
 	}
 }
+
+// fieldByName returns the field of the struct v with the given name. The name
+// is matched against the Go names of the fields, their JSON names and,
+// for keys named with other conventions, ignoring case and underscores.
+func fieldByName(v reflect.Value, name string) reflect.Value {
+	if f := v.FieldByName(strings.ToUpper(name[0:1]) + name[1:]); f.IsValid() {
+		return f
+	}
+
+	t := v.Type()
+	key := normalizeKey(name)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		tag := f.Tag.Get("json")
+		if idx := strings.Index(tag, ","); idx != -1 {
+			tag = tag[:idx]
+		}
+
+		if tag == name || normalizeKey(f.Name) == key || tag != "" && normalizeKey(tag) == key {
+			return v.Field(i)
+		}
+	}
+
+	return reflect.Value{}
+}
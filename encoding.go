@@ -0,0 +1,164 @@
+package kite
+
+import (
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/msgpack"
+
+	"github.com/igm/sockjs-go/sockjs"
+)
+
+// FeatureMsgpack is the feature of the kites, which can exchange messages
+// encoded with MessagePack instead of JSON. MessagePack is used when both
+// kites advertise the feature and the session between them can carry binary
+// messages, see BinarySession; otherwise the messages are sent as JSON:
+//
+//     k := kite.New("client", "1.0.0")
+//     k.AddFeature(kite.FeatureMsgpack)
+//
+// The encoding is negotiated with the features right after dialing. Messages
+// are told apart by their first byte, so kites which advertise the feature
+// receive both encodings during the negotiation.
+//
+// The messages are encoded straight to MessagePack, so the []byte arguments
+// are sent as binaries instead of base64 strings. The handlers receive them
+// as base64 strings nevertheless, like with JSON, so they are unmarshaled
+// to []byte the same way with both encodings.
+//
+// Of the built-in transports only the TCP one can carry binary messages,
+// as the SockJS ones send the messages as text.
+const FeatureMsgpack = "msgpack"
+
+// The encodings of the messages, see Client.Encoding.
+const (
+	EncodingJSON    = "json"
+	EncodingMsgpack = "msgpack"
+)
+
+// BinarySession is implemented by the sessions, which can send binary
+// messages. The binary messages are received with Recv, like the text ones.
+type BinarySession interface {
+	sockjs.Session
+
+	// SendBinary sends one binary message over the session.
+	SendBinary(p []byte) error
+}
+
+// Encoding returns the encoding of the messages sent to the remote kite,
+// EncodingJSON or EncodingMsgpack.
+func (c *Client) Encoding() string {
+	if atomic.LoadInt32(&c.msgpack) == 1 {
+		return EncodingMsgpack
+	}
+
+	return EncodingJSON
+}
+
+// negotiateEncoding switches the messages sent to the remote kite to
+// MessagePack, if both kites support it. It is called once the features
+// of the remote kite are known.
+func (c *Client) negotiateEncoding() {
+	if _, ok := c.getSession().(BinarySession); !ok {
+		return
+	}
+
+	c.LocalKite.featuresMu.RLock()
+	local := c.LocalKite.features[FeatureMsgpack]
+	c.LocalKite.featuresMu.RUnlock()
+
+	c.featuresMu.Lock()
+	remote := c.features[FeatureMsgpack]
+	c.featuresMu.Unlock()
+
+	if local && remote {
+		atomic.StoreInt32(&c.msgpack, 1)
+	}
+}
+
+// outMessage is the dnode message sent to the remote kite, it's encoded
+// with the negotiated encoding, see encodeMessage.
+type outMessage struct {
+	Method    interface{}           `json:"method"`
+	Arguments []interface{}         `json:"arguments"`
+	Callbacks map[string]dnode.Path `json:"callbacks"`
+}
+
+// encodeMessage encodes the message with the negotiated encoding. It tells
+// whether the message is encoded with MessagePack.
+func (c *Client) encodeMessage(msg *outMessage) (p []byte, binary bool, err error) {
+	if atomic.LoadInt32(&c.msgpack) == 1 {
+		if _, ok := c.getSession().(BinarySession); ok {
+			p, err = msgpack.Marshal(msg)
+			return p, true, err
+		}
+	}
+
+	p, err = json.Marshal(msg)
+	return p, false, err
+}
+
+// sendMessage sends the message over the session, with the negotiated
+// encoding. It returns the number of the bytes sent.
+func (c *Client) sendMessage(session sockjs.Session, msg *message) (int, error) {
+	bs, ok := session.(BinarySession)
+
+	switch {
+	case msg.binary && ok:
+		return len(msg.p), bs.SendBinary(msg.p)
+	case msg.binary:
+		// The session was replaced with one which can't carry binary
+		// messages since the message was encoded.
+		p, err := msgpack.ToJSON(msg.p)
+		if err != nil {
+			return 0, err
+		}
+
+		return len(p), session.Send(string(p))
+	case ok && atomic.LoadInt32(&c.msgpack) == 1:
+		p, err := msgpack.FromJSON(msg.p)
+		if err != nil {
+			return 0, err
+		}
+
+		return len(p), bs.SendBinary(p)
+	}
+
+	return len(msg.p), session.Send(string(msg.p))
+}
+
+// debugMessage logs the redacted JSON encoding of the message, it's
+// encoded only when the message is logged.
+type debugMessage struct {
+	k   *Kite
+	msg *message
+}
+
+func (d debugMessage) String() string {
+	return string(d.k.redactJSON(d.msg.json()))
+}
+
+// json returns the JSON encoding of the message.
+func (msg *message) json() []byte {
+	if !msg.binary {
+		return msg.p
+	}
+
+	p, err := msgpack.ToJSON(msg.p)
+	if err != nil {
+		return msg.p
+	}
+
+	return p
+}
+
+// decodeMessage decodes the received message to JSON, if it was encoded
+// with MessagePack.
+func decodeMessage(p []byte) ([]byte, error) {
+	if !msgpack.IsMsgpack(p) {
+		return p, nil
+	}
+
+	return msgpack.ToJSON(p)
+}
@@ -3,6 +3,7 @@ package kite
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/koding/kite/dnode"
 )
@@ -17,6 +18,10 @@ type Error struct {
 	Message   string `json:"message"`
 	CodeVal   string `json:"code"`
 	RequestID string `json:"id"`
+
+	// RetryAfter, when non-zero, is the time after which the failed
+	// call is expected to succeed, e.g. for "rateLimitError" errors.
+	RetryAfter time.Duration `json:"retryAfter,omitempty"`
 }
 
 func (e Error) Code() string {
@@ -0,0 +1,184 @@
+package kite
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/koding/kite/dnode"
+)
+
+// The messages of the heartbeats and of the kite.ping calls, as they are
+// sent by kites, are by far the most frequent ones received by Kontrol and
+// by the proxy kites. They are recognized by their raw form and handled
+// without decoding them, see handleFast.
+var (
+	fastMethodPrefix    = []byte(`{"method":`)
+	fastNoArgsSuffix    = []byte(`,"arguments":[],"callbacks":{}}`)
+	fastPingPrefix      = []byte(`{"method":"kite.ping","arguments":[`)
+	fastCallbacksPrefix = []byte(`,"callbacks":{"`)
+	fastPingSuffix      = []byte(`":[0,"responseCallback"]}}`)
+	fastPongSuffix      = []byte(`,"arguments":[{"error":null,"result":"pong"}],"callbacks":{}}`)
+
+	// fastNoArgs are the arguments the callbacks are called with by
+	// the heartbeats, they are never modified.
+	fastNoArgs = []byte(`[]`)
+)
+
+// handleFast handles the message if it is a heartbeat or a kite.ping call,
+// it tells whether it did. The kite.ping calls are answered right away,
+// without running the middlewares and the handlers added with PreHandle
+// and PostHandle, and without being counted by the metrics.
+func (c *Client) handleFast(p []byte) bool {
+	if !bytes.HasPrefix(p, fastMethodPrefix) {
+		return false
+	}
+
+	if id, ok := parseFastCallback(p); ok {
+		callback := c.scrubber.GetCallback(id)
+		if callback == nil {
+			return false
+		}
+
+		c.traceFrame(traceIn, p)
+		c.countBytes(&c.bytesIn, &c.LocalKite.bytesIn, len(p))
+
+		args := &dnode.Partial{Raw: fastNoArgs, Naming: c.LocalKite.Config.FieldNaming, Numbers: c.LocalKite.Config.Numbers}
+
+		if c.Concurrent && c.ConcurrentCallbacks {
+			go c.runCallback(callback, args)
+		} else {
+			c.runCallback(callback, args)
+		}
+
+		return true
+	}
+
+	if id, ok := parseFastPing(p); ok && c.pingFastPath() {
+		c.traceFrame(traceIn, p)
+		c.countBytes(&c.bytesIn, &c.LocalKite.bytesIn, len(p))
+
+		pong := make([]byte, 0, len(fastMethodPrefix)+20+len(fastPongSuffix))
+		pong = append(pong, fastMethodPrefix...)
+		pong = strconv.AppendUint(pong, id, 10)
+		pong = append(pong, fastPongSuffix...)
+
+		msg := &message{p: pong}
+
+		if c.Concurrent {
+			go c.enqueue(msg)
+		} else {
+			c.enqueue(msg)
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// pingFastPath tells whether the kite.ping calls of the client can be
+// answered by handleFast. The first call of a connected kite is handled
+// as usual, as it identifies the kite, see Kite.OnFirstRequest. So are
+// the calls of the kites, which restrict the calls, see restrictsCalls.
+func (c *Client) pingFastPath() bool {
+	k := c.LocalKite
+
+	m := k.pingMethod
+	if m == nil || k.isDraining() || k.restrictsCalls() {
+		return false
+	}
+
+	// The method may be replaced with another handler.
+	if p, _ := k.method("kite.ping"); p != m {
+		return false
+	}
+
+	// Versions and the throttle of the method are applied as usual.
+	if m.bucket != nil || len(m.versions) != 0 || len(m.kiteVersions) != 0 {
+		return false
+	}
+
+	if c.isDialed() {
+		return true
+	}
+
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return c.Kite.ID != ""
+}
+
+// restrictsCalls tells whether the kite has any rate limits, quota, ACL,
+// authorizers or a memory cap of the connections set, which must apply to
+// the kite.ping calls as well.
+func (k *Kite) restrictsCalls() bool {
+	if k.Config.MaxConnectionMemory != 0 {
+		return true
+	}
+
+	k.rateLimitsMu.RLock()
+	limited := len(k.rateLimits) != 0
+	k.rateLimitsMu.RUnlock()
+
+	if limited {
+		return true
+	}
+
+	k.quotaMu.RLock()
+	quota := k.quota
+	k.quotaMu.RUnlock()
+
+	if quota != nil {
+		return true
+	}
+
+	k.authzMu.RLock()
+	defer k.authzMu.RUnlock()
+
+	return k.acl != nil || len(k.authorizers) != 0
+}
+
+// parseFastCallback parses the call of a callback without arguments,
+// e.g. {"method":3,"arguments":[],"callbacks":{}}.
+func parseFastCallback(p []byte) (uint64, bool) {
+	if !bytes.HasSuffix(p, fastNoArgsSuffix) {
+		return 0, false
+	}
+
+	return parseFastID(p[len(fastMethodPrefix) : len(p)-len(fastNoArgsSuffix)])
+}
+
+// parseFastPing parses the ID of the response callback of a kite.ping
+// call, e.g. {"method":"kite.ping","arguments":[...],"callbacks":{"3":[0,"responseCallback"]}}.
+func parseFastPing(p []byte) (uint64, bool) {
+	if !bytes.HasPrefix(p, fastPingPrefix) || !bytes.HasSuffix(p, fastPingSuffix) {
+		return 0, false
+	}
+
+	p = p[:len(p)-len(fastPingSuffix)]
+
+	i := bytes.LastIndex(p, fastCallbacksPrefix)
+	if i == -1 {
+		return 0, false
+	}
+
+	return parseFastID(p[i+len(fastCallbacksPrefix):])
+}
+
+// parseFastID parses the decimal callback ID without allocating.
+func parseFastID(p []byte) (uint64, bool) {
+	if len(p) == 0 || len(p) > 19 {
+		return 0, false
+	}
+
+	var id uint64
+	for _, b := range p {
+		if b < '0' || b > '9' {
+			return 0, false
+		}
+
+		id = id*10 + uint64(b-'0')
+	}
+
+	return id, true
+}
@@ -0,0 +1,118 @@
+package kite
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/koding/kite/dnode"
+)
+
+func TestParseFast(t *testing.T) {
+	// The messages encoded the way Client.marshalAndSend does.
+	encode := func(method interface{}, args ...interface{}) []byte {
+		if args == nil {
+			args = make([]interface{}, 0)
+		}
+
+		callbacks := dnode.NewScrubber().Scrub(args)
+
+		p, err := json.Marshal(dnode.Message{
+			Method:    method,
+			Arguments: &dnode.Partial{Raw: mustMarshal(t, args)},
+			Callbacks: callbacks,
+		})
+		if err != nil {
+			t.Fatalf("Marshal()=%s", err)
+		}
+
+		return p
+	}
+
+	if id, ok := parseFastCallback(encode(uint64(42))); !ok || id != 42 {
+		t.Fatalf("parseFastCallback()=(%d, %t), want (42, true)", id, ok)
+	}
+
+	opts := callOptionsOut{
+		callOptions: callOptions{
+			Kite:             *New("client", "0.0.1").Kite(),
+			ResponseCallback: dnode.Callback(func(*dnode.Partial) {}),
+		},
+	}
+
+	if _, ok := parseFastPing(encode("kite.ping", opts)); !ok {
+		t.Fatalf("parseFastPing(%s) failed", encode("kite.ping", opts))
+	}
+
+	cases := []struct {
+		p    string
+		ping bool
+		id   uint64
+		ok   bool
+	}{
+		{`{"method":3,"arguments":[],"callbacks":{}}`, false, 3, true},
+		{`{"method":12345,"arguments":[],"callbacks":{}}`, false, 12345, true},
+		{`{"method":"3","arguments":[],"callbacks":{}}`, false, 0, false},
+		{`{"method":3,"arguments":[1],"callbacks":{}}`, false, 0, false},
+		{`{"method":99999999999999999999,"arguments":[],"callbacks":{}}`, false, 0, false},
+		{`{"method":"kite.ping","arguments":[{"kite":{"id":"x"}}],"callbacks":{"7":[0,"responseCallback"]}}`, true, 7, true},
+		{`{"method":"kite.ping","arguments":[{"kite":{"id":"x"}}],"callbacks":{"7":[1,"responseCallback"]}}`, true, 0, false},
+		{`{"method":"kite.echo","arguments":[{"kite":{"id":"x"}}],"callbacks":{"7":[0,"responseCallback"]}}`, true, 0, false},
+	}
+
+	for _, cas := range cases {
+		parse := parseFastCallback
+		if cas.ping {
+			parse = parseFastPing
+		}
+
+		id, ok := parse([]byte(cas.p))
+		if ok != cas.ok || id != cas.id {
+			t.Errorf("%s: got (%d, %t), want (%d, %t)", cas.p, id, ok, cas.id, cas.ok)
+		}
+	}
+}
+
+func TestParseFast_Allocs(t *testing.T) {
+	callback := []byte(`{"method":3,"arguments":[],"callbacks":{}}`)
+	ping := []byte(`{"method":"kite.ping","arguments":[{"kite":{"id":"x"}}],"callbacks":{"7":[0,"responseCallback"]}}`)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		parseFastCallback(callback)
+		parseFastPing(ping)
+	})
+
+	if allocs != 0 {
+		t.Fatalf("got %v allocations, want 0", allocs)
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	p, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal()=%s", err)
+	}
+
+	return p
+}
+
+func TestKite_RestrictsCalls(t *testing.T) {
+	k := New("fastpath", "0.0.1")
+	defer k.Close()
+
+	if k.restrictsCalls() {
+		t.Fatal("want no restrictions by default")
+	}
+
+	k.SetRateLimit(RateLimitPerKite, &RateLimit{Rate: 10})
+
+	if !k.restrictsCalls() {
+		t.Fatal("want the rate limit to restrict the calls")
+	}
+
+	k.SetRateLimit(RateLimitPerKite, nil)
+	k.Authorize(func(*Request) error { return nil })
+
+	if !k.restrictsCalls() {
+		t.Fatal("want the authorizer to restrict the calls")
+	}
+}
@@ -0,0 +1,164 @@
+package kite
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// AddFeature advertises optional features supported by the kite, like
+// compression or streaming. The features are sent to the remote kites when
+// a connection is made, which allows them to degrade gracefully when
+// talking to older kites, see Client.SupportsFeature. The kites which
+// advertise no features exchange them on the first use instead.
+func (k *Kite) AddFeature(names ...string) {
+	k.featuresMu.Lock()
+	defer k.featuresMu.Unlock()
+
+	if k.features == nil {
+		k.features = make(map[string]bool)
+	}
+
+	for _, name := range names {
+		k.features[name] = true
+	}
+}
+
+// Features returns sorted names of the features advertised by the kite.
+func (k *Kite) Features() []string {
+	k.featuresMu.RLock()
+	defer k.featuresMu.RUnlock()
+
+	return featureNames(k.features)
+}
+
+// handleFeatures stores the features of the calling kite and replies
+// with ours.
+func (k *Kite) handleFeatures(r *Request) (interface{}, error) {
+	var features []string
+
+	if r.Args != nil {
+		if err := r.Args.One().Unmarshal(&features); err != nil {
+			return nil, err
+		}
+	}
+
+	r.Client.setFeatures(features)
+	r.Client.negotiateEncoding()
+
+	return k.Features(), nil
+}
+
+// SupportsFeature returns true if the remote kite advertised the given
+// feature. Right after dialing, the call waits until the features are
+// exchanged, exchanging them if it was not done yet, but no longer than
+// Config.Timeout. Kites which do not support the exchange are treated as
+// having no features.
+func (c *Client) SupportsFeature(name string) bool {
+	c.waitFeatures()
+
+	c.featuresMu.Lock()
+	defer c.featuresMu.Unlock()
+
+	return c.features[name]
+}
+
+// Features returns sorted names of the features advertised by the
+// remote kite.
+func (c *Client) Features() []string {
+	c.waitFeatures()
+
+	c.featuresMu.Lock()
+	defer c.featuresMu.Unlock()
+
+	return featureNames(c.features)
+}
+
+func (c *Client) waitFeatures() {
+	c.featuresMu.Lock()
+	known := c.featuresKnown
+	c.featuresMu.Unlock()
+
+	if known == nil {
+		return
+	}
+
+	go c.exchangeFeaturesOnce()
+
+	select {
+	case <-known:
+	case <-time.After(c.config().Timeout):
+	}
+}
+
+// resetFeatures forgets the features of the remote kite, and the encoding
+// negotiated with them, it is called on every dial as the remote kite may
+// have been upgraded in the meantime.
+func (c *Client) resetFeatures() {
+	c.featuresMu.Lock()
+	c.features = nil
+	c.featuresKnown = make(chan struct{})
+	c.featuresAsked = false
+	c.featuresMu.Unlock()
+
+	atomic.StoreInt32(&c.msgpack, 0)
+}
+
+func (c *Client) setFeatures(names []string) {
+	features := make(map[string]bool, len(names))
+	for _, name := range names {
+		features[name] = true
+	}
+
+	c.featuresMu.Lock()
+	defer c.featuresMu.Unlock()
+
+	c.features = features
+
+	if c.featuresKnown != nil {
+		close(c.featuresKnown)
+		c.featuresKnown = nil
+	}
+}
+
+// exchangeFeaturesOnce exchanges the features, unless they were already
+// exchanged since dialing.
+func (c *Client) exchangeFeaturesOnce() {
+	c.featuresMu.Lock()
+	exchange := c.featuresKnown != nil && !c.featuresAsked
+	c.featuresAsked = true
+	c.featuresMu.Unlock()
+
+	if exchange {
+		c.exchangeFeatures()
+	}
+}
+
+// exchangeFeatures sends our features to the remote kite and stores
+// the ones it replies with.
+func (c *Client) exchangeFeatures() {
+	var features []string
+
+	result, err := c.tellHandshake("kite.features", c.LocalKite.Features())
+	if err == nil && result != nil {
+		err = result.Unmarshal(&features)
+	}
+
+	if err != nil {
+		c.LocalKite.Log.Debug("Exchanging features with %q failed: %s", c.URL, err)
+	}
+
+	c.setFeatures(features)
+	c.negotiateEncoding()
+}
+
+func featureNames(features map[string]bool) []string {
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,44 @@
+package kite
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koding/kite/dnode"
+)
+
+func TestFeatures(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	k.AddFeature("streaming", "compression")
+
+	if got, want := k.Features(), []string{"compression", "streaming"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	c := k.NewClient("")
+	c.resetFeatures()
+
+	r := &Request{
+		Args:   &dnode.Partial{Raw: []byte(`[["binary"]]`)},
+		Client: c,
+	}
+
+	result, err := k.handleFeatures(r)
+	if err != nil {
+		t.Fatalf("handleFeatures()=%s", err)
+	}
+
+	if !reflect.DeepEqual(result, k.Features()) {
+		t.Fatalf("want %v, got %v", k.Features(), result)
+	}
+
+	if !c.SupportsFeature("binary") {
+		t.Fatal("want remote kite to support binary feature")
+	}
+
+	if c.SupportsFeature("streaming") {
+		t.Fatal("want remote kite not to support streaming feature")
+	}
+}
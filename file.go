@@ -0,0 +1,422 @@
+package kite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FileChunkSize is the size of the chunks files are sent in by
+// Client.PutFile and Client.GetFile.
+var FileChunkSize = 256 * 1024
+
+// partSuffix is appended to the names of files which are being transferred,
+// they are renamed once the transfer is finished and verified.
+const partSuffix = ".part"
+
+// FileArgs are the arguments of the kite.file.stat, kite.file.get and
+// kite.file.put methods, which transfer files within Config.FileRoot of
+// the kite. They can be called by the owner of the kite only.
+type FileArgs struct {
+	// Path is the path of the file, relative to Config.FileRoot.
+	Path string `json:"path"`
+
+	// Offset is the offset of the chunk to get or put.
+	Offset int64 `json:"offset,omitempty"`
+
+	// Length is the maximum length of the chunk to get, the default is
+	// FileChunkSize.
+	Length int `json:"length,omitempty"`
+
+	// Data is the chunk to put at Offset. Putting a chunk at offset 0
+	// starts the upload over.
+	Data []byte `json:"data,omitempty"`
+
+	// Last tells the chunk is the last one, the uploaded file is verified
+	// against SHA256, if given, and moved to Path.
+	Last   bool   `json:"last,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Checksum makes kite.file.stat compute the checksum of the file.
+	Checksum bool `json:"checksum,omitempty"`
+}
+
+// FileInfo is the reply of the kite.file.stat and kite.file.put methods.
+type FileInfo struct {
+	Exists bool   `json:"exists"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Uploaded is the size of the unfinished upload of the file, the upload
+	// is resumed by putting the next chunk at this offset.
+	Uploaded int64 `json:"uploaded"`
+}
+
+// FileChunk is the reply of the kite.file.get method.
+type FileChunk struct {
+	Data []byte `json:"data"`
+	Size int64  `json:"size"` // size of the whole file
+	EOF  bool   `json:"eof"`
+}
+
+// filePath resolves the path of the file requested with the args, it fails
+// if the transfers are not enabled or the caller is not the owner.
+func (k *Kite) filePath(r *Request, args *FileArgs) (string, error) {
+	if k.Config.FileRoot == "" {
+		return "", &Error{
+			Type:    "fileError",
+			Message: "File transfers are disabled",
+		}
+	}
+
+	if r.Username != k.Config.Username {
+		return "", &Error{
+			Type:    "authenticationError",
+			Message: fmt.Sprintf("%q is not allowed to transfer files", r.Username),
+		}
+	}
+
+	if r.Args == nil {
+		return "", errors.New("empty arguments")
+	}
+
+	if err := r.Args.One().Unmarshal(args); err != nil {
+		return "", err
+	}
+
+	if args.Path == "" {
+		return "", errors.New("empty path")
+	}
+
+	// Cleaning the path as an absolute one keeps it within the root.
+	return filepath.Join(k.Config.FileRoot, filepath.Clean("/"+args.Path)), nil
+}
+
+func (k *Kite) handleFileStat(r *Request) (interface{}, error) {
+	var args FileArgs
+
+	path, err := k.filePath(r, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	return statFile(path, args.Checksum)
+}
+
+func (k *Kite) handleFileGet(r *Request) (interface{}, error) {
+	var args FileArgs
+
+	path, err := k.filePath(r, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	length := args.Length
+	if length <= 0 || length > FileChunkSize {
+		length = FileChunkSize
+	}
+
+	data := make([]byte, length)
+
+	n, err := f.ReadAt(data, args.Offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return &FileChunk{
+		Data: data[:n],
+		Size: fi.Size(),
+		EOF:  args.Offset+int64(n) >= fi.Size(),
+	}, nil
+}
+
+func (k *Kite) handleFilePut(r *Request) (interface{}, error) {
+	var args FileArgs
+
+	path, err := k.filePath(r, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	part := path + partSuffix
+
+	flag := os.O_WRONLY | os.O_CREATE
+	if args.Offset == 0 {
+		flag |= os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(part, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if fi.Size() != args.Offset {
+		f.Close()
+		return nil, &Error{
+			Type:    "fileError",
+			Message: fmt.Sprintf("Chunk at offset %d does not follow the uploaded %d bytes", args.Offset, fi.Size()),
+		}
+	}
+
+	if _, err := f.WriteAt(args.Data, args.Offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	if !args.Last {
+		return &FileInfo{Uploaded: args.Offset + int64(len(args.Data))}, nil
+	}
+
+	if err := verifyFile(part, args.SHA256); err != nil {
+		os.Remove(part)
+		return nil, err
+	}
+
+	if err := os.Rename(part, path); err != nil {
+		return nil, err
+	}
+
+	return statFile(path, false)
+}
+
+// PutFile uploads the local file to the remote path with the kite.file.put
+// method, in chunks of FileChunkSize. An upload that was interrupted is
+// resumed. The uploaded file is verified with its checksum.
+func (c *Client) PutFile(local, remote string) error {
+	sum, err := fileChecksum(local)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var info FileInfo
+	if err := c.callFile("kite.file.stat", &FileArgs{Path: remote}, &info); err != nil {
+		return err
+	}
+
+	offset := info.Uploaded
+	if offset > fi.Size() {
+		offset = 0
+	}
+
+	data := make([]byte, FileChunkSize)
+
+	for {
+		n, err := f.ReadAt(data, offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		args := &FileArgs{
+			Path:   remote,
+			Offset: offset,
+			Data:   data[:n],
+			Last:   offset+int64(n) >= fi.Size(),
+		}
+
+		if args.Last {
+			args.SHA256 = sum
+		}
+
+		if err := c.callFile("kite.file.put", args, &info); err != nil {
+			return err
+		}
+
+		if args.Last {
+			return nil
+		}
+
+		offset += int64(n)
+	}
+}
+
+// GetFile downloads the remote file with the kite.file.get method to the
+// local path, in chunks of FileChunkSize. A download that was interrupted
+// is resumed. The downloaded file is verified with its checksum.
+func (c *Client) GetFile(remote, local string) error {
+	var info FileInfo
+	if err := c.callFile("kite.file.stat", &FileArgs{Path: remote, Checksum: true}, &info); err != nil {
+		return err
+	}
+
+	if !info.Exists {
+		return &Error{
+			Type:    "fileError",
+			Message: fmt.Sprintf("File %q does not exist", remote),
+		}
+	}
+
+	part := local + partSuffix
+
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	offset := fi.Size()
+	if offset > info.Size {
+		offset = 0
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return err
+	}
+
+	for offset < info.Size {
+		var chunk FileChunk
+
+		if err := c.callFile("kite.file.get", &FileArgs{Path: remote, Offset: offset}, &chunk); err != nil {
+			f.Close()
+			return err
+		}
+
+		if len(chunk.Data) == 0 {
+			break
+		}
+
+		if _, err := f.WriteAt(chunk.Data, offset); err != nil {
+			f.Close()
+			return err
+		}
+
+		offset += int64(len(chunk.Data))
+
+		if chunk.EOF {
+			break
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := verifyFile(part, info.SHA256); err != nil {
+		os.Remove(part)
+		return err
+	}
+
+	return os.Rename(part, local)
+}
+
+func (c *Client) callFile(method string, args *FileArgs, v interface{}) error {
+	result, err := c.TellWithTimeout(method, c.config().Timeout, args)
+	if err != nil {
+		return err
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return result.Unmarshal(v)
+}
+
+// statFile gives the info of the file and of its unfinished upload.
+func statFile(path string, checksum bool) (*FileInfo, error) {
+	info := &FileInfo{}
+
+	fi, err := os.Stat(path)
+	switch {
+	case err == nil:
+		info.Exists = true
+		info.Size = fi.Size()
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	if fi, err := os.Stat(path + partSuffix); err == nil {
+		info.Uploaded = fi.Size()
+	}
+
+	if checksum && info.Exists {
+		if info.SHA256, err = fileChecksum(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+// verifyFile checks whether the file has the given checksum, an empty
+// checksum is not verified.
+func verifyFile(path, want string) error {
+	if want == "" {
+		return nil
+	}
+
+	got, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+
+	if got != want {
+		return &Error{
+			Type:    "fileError",
+			Message: fmt.Sprintf("Checksum mismatch: got %s, want %s", got, want),
+		}
+	}
+
+	return nil
+}
+
+// fileChecksum gives the hex-encoded SHA-256 checksum of the file.
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
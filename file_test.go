@@ -0,0 +1,136 @@
+package kite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+)
+
+func TestClient_PutGetFile(t *testing.T) {
+	root, err := ioutil.TempDir("", "kite-file")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(root)
+
+	defer func(n int) { FileChunkSize = n }(FileChunkSize)
+	FileChunkSize = 1024
+
+	conf := config.New()
+	conf.DisableAuthentication = true
+	conf.FileRoot = filepath.Join(root, "remote")
+
+	k := NewWithConfig("files", "0.0.1", conf)
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	data := make([]byte, 10*1024+7)
+	rand.Read(data)
+
+	local := filepath.Join(root, "local")
+	if err := ioutil.WriteFile(local, data, 0644); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	if err := c.PutFile(local, "dir/file"); err != nil {
+		t.Fatalf("PutFile()=%s", err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(root, "remote", "dir", "file"))
+	if err != nil {
+		t.Fatalf("ReadFile()=%s", err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Fatal("uploaded file differs")
+	}
+
+	// Simulate an interrupted download.
+	downloaded := filepath.Join(root, "downloaded")
+	if err := ioutil.WriteFile(downloaded+partSuffix, data[:3000], 0644); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	if err := c.GetFile("../../dir/file", downloaded); err != nil {
+		t.Fatalf("GetFile()=%s", err)
+	}
+
+	if got, err = ioutil.ReadFile(downloaded); err != nil {
+		t.Fatalf("ReadFile()=%s", err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Fatal("downloaded file differs")
+	}
+}
+
+func TestHandleFilePut(t *testing.T) {
+	root, err := ioutil.TempDir("", "kite-file")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(root)
+
+	k := New("files", "0.0.1")
+	k.Config.FileRoot = root
+
+	put := func(username string, args *FileArgs) (*FileInfo, error) {
+		p, err := json.Marshal([]interface{}{args})
+		if err != nil {
+			t.Fatalf("Marshal()=%s", err)
+		}
+
+		res, err := k.handleFilePut(&Request{
+			Username: username,
+			Args:     &dnode.Partial{Raw: p},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return res.(*FileInfo), nil
+	}
+
+	if _, err := put("someone", &FileArgs{Path: "f", Data: []byte("a")}); err == nil {
+		t.Fatal("expected upload by a non-owner to fail")
+	}
+
+	owner := k.Config.Username
+
+	info, err := put(owner, &FileArgs{Path: "f", Data: []byte("hello ")})
+	if err != nil {
+		t.Fatalf("put()=%s", err)
+	}
+
+	if info.Uploaded != 6 {
+		t.Fatalf("got %d uploaded bytes, want 6", info.Uploaded)
+	}
+
+	if _, err := put(owner, &FileArgs{Path: "f", Offset: 3, Data: []byte("x")}); err == nil {
+		t.Fatal("expected chunk at a wrong offset to fail")
+	}
+
+	if _, err := put(owner, &FileArgs{Path: "f", Offset: 6, Data: []byte("world"), Last: true, SHA256: "bad"}); err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "f"+partSuffix)); !os.IsNotExist(err) {
+		t.Fatalf("expected the unverified upload to be removed: %v", err)
+	}
+}
@@ -17,9 +17,22 @@ import (
 func (k *Kite) addDefaultHandlers() {
 	// Default RPC methods
 	k.HandleFunc("kite.systemInfo", handleSystemInfo)
+	k.HandleFunc("kite.stats", k.handleStats)
+	k.HandleFunc("kite.describe", k.handleDescribe)
 	k.HandleFunc("kite.heartbeat", k.handleHeartbeat)
-	k.HandleFunc("kite.ping", handlePing).DisableAuthentication()
+	k.pingMethod = k.HandleFunc("kite.ping", handlePing).DisableAuthentication()
+	k.HandleFunc("kite.features", k.handleFeatures).DisableAuthentication()
+	k.HandleFunc("kite.identity", k.handleIdentity).DisableAuthentication()
+	k.HandleFunc("kite.cancel", handleCancel).DisableAuthentication()
+	k.HandleFunc("kite.subscribe", k.handleSubscribe)
+	k.HandleFunc("kite.unsubscribe", k.handleUnsubscribe)
 	k.HandleFunc("kite.tunnel", handleTunnel)
+	k.HandleFunc("kite.proxyHandoff", k.handleProxyHandoff)
+	k.HandleFunc("kite.admin.disconnect", k.handleDisconnect)
+	k.HandleFunc("kite.admin.revokeTokens", k.handleRevokeTokens)
+	k.HandleFunc("kite.file.stat", k.handleFileStat)
+	k.HandleFunc("kite.file.get", k.handleFileGet)
+	k.HandleFunc("kite.file.put", k.handleFilePut)
 	k.HandleFunc("kite.log", k.handleLog)
 	k.HandleFunc("kite.print", handlePrint)
 	k.HandleFunc("kite.prompt", handlePrompt)
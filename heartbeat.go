@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -88,6 +89,14 @@ func (k *Kite) processHeartbeats() {
 // use it during app initializations. After the registration a reconnect is
 // automatically handled inside the RegisterHTTP method.
 func (k *Kite) RegisterHTTPForever(kiteURL *url.URL) {
+	k.registerHTTPForever(kiteURL)
+}
+
+// registerHTTPForever implements RegisterHTTPForever, returning the
+// result of the successful registration or nil if it gave up.
+func (k *Kite) registerHTTPForever(kiteURL *url.URL) *registerResult {
+	var res *registerResult
+
 	// Create the httpBackoffRegister that RegisterHTTPForever will
 	// use to backoff repeated register attempts.
 	httpRegisterBackOff := backoff.NewExponentialBackOff()
@@ -96,8 +105,8 @@ func (k *Kite) RegisterHTTPForever(kiteURL *url.URL) {
 	httpRegisterBackOff.Multiplier = 1.7
 	httpRegisterBackOff.MaxElapsedTime = 0
 
-	register := func() error {
-		_, err := k.RegisterHTTP(kiteURL)
+	register := func() (err error) {
+		res, err = k.RegisterHTTP(kiteURL)
 		if err != nil {
 			k.Log.Error("Cannot register to Kontrol: %s Will retry after %d seconds",
 				err,
@@ -112,7 +121,10 @@ func (k *Kite) RegisterHTTPForever(kiteURL *url.URL) {
 	err := backoff.Retry(register, httpRegisterBackOff)
 	if err != nil {
 		k.Log.Error("BackOff stopped retrying with Error '%s'", err)
+		return nil
 	}
+
+	return res
 }
 
 func (k *Kite) getKontrolPath(path string) string {
@@ -128,15 +140,84 @@ func (k *Kite) getKontrolPath(path string) string {
 // can find it via GetKites() or WatchKites() method. It registers again if
 // connection to kontrol is lost.
 func (k *Kite) RegisterHTTP(kiteURL *url.URL) (*registerResult, error) {
+	if k.Config.LocalMode {
+		return k.registerLocal(kiteURL)
+	}
+
+	res, err := k.postRegister(kiteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	k.Log.Info("Registered (via HTTP) with URL: '%s' and HeartBeat interval: '%s'",
+		res.result.URL, res.heartbeat)
+
+	go k.sendHeartbeats(res.heartbeat, kiteURL)
+
+	k.callOnRegisterHandlers(res.result)
+
+	return res, nil
+}
+
+// RegisterHTTPRenew registers current Kite to Kontrol with an HTTP POST
+// request, like RegisterHTTP does. However, instead of sending heartbeats,
+// the registration is renewed by sending the same POST request every
+// heartbeat interval. It suits kites behind middleboxes which do not play
+// well with long-lived connections, as every renewal is a standalone request
+// authenticated with the kite key, which also registers the kite again if
+// Kontrol has lost it.
+//
+// The OnRegister handlers are called after every successful renewal.
+func (k *Kite) RegisterHTTPRenew(kiteURL *url.URL) (*registerResult, error) {
+	res, err := k.postRegister(kiteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	k.Log.Info("Registered (via HTTP) with URL: '%s' and renewal interval: '%s'",
+		res.result.URL, res.heartbeat)
+
+	k.callOnRegisterHandlers(res.result)
+
+	renew := func() error {
+		res, err := k.postRegister(kiteURL)
+		if err != nil {
+			return fmt.Errorf("renewing registration failed: %s", err)
+		}
+
+		k.Log.Debug("Renewed registration (via HTTP) with URL: '%s'", res.result.URL)
+
+		k.callOnRegisterHandlers(res.result)
+
+		return nil
+	}
+
+	k.heartbeatC <- &heartbeatReq{
+		ping:     renew,
+		interval: res.heartbeat,
+	}
+
+	return res, nil
+}
+
+// postRegister sends the register request to Kontrol's HTTP endpoint.
+func (k *Kite) postRegister(kiteURL *url.URL) (*registerResult, error) {
+	return k.postRegisterKite(k.Kite(), kiteURL)
+}
+
+// postRegisterKite registers the given kite, which is either the kite
+// itself or one of its versions, see AddVersion.
+func (k *Kite) postRegisterKite(kite *protocol.Kite, kiteURL *url.URL) (*registerResult, error) {
 	registerURL := k.getKontrolPath("register")
 
 	args := protocol.RegisterArgs{
 		URL:  kiteURL.String(),
-		Kite: k.Kite(),
+		Kite: kite,
 		Auth: &protocol.Auth{
 			Type: "kiteKey",
 			Key:  k.KiteKey(),
 		},
+		Color: k.Config.Color,
 	}
 
 	data, err := json.Marshal(&args)
@@ -144,6 +225,8 @@ func (k *Kite) RegisterHTTP(kiteURL *url.URL) (*registerResult, error) {
 		return nil, err
 	}
 
+	sent := time.Now()
+
 	resp, err := k.Config.Client.Post(registerURL, "application/json", bytes.NewReader(data))
 	if err != nil {
 		return nil, err
@@ -155,6 +238,8 @@ func (k *Kite) RegisterHTTP(kiteURL *url.URL) (*registerResult, error) {
 		return nil, err
 	}
 
+	k.updateClockSkew(sent, time.Now(), rr.Time)
+
 	if rr.Error != "" {
 		return nil, errors.New(rr.Error)
 	}
@@ -168,16 +253,11 @@ func (k *Kite) RegisterHTTP(kiteURL *url.URL) (*registerResult, error) {
 		k.Log.Error("Cannot parse registered URL: %s", err.Error())
 	}
 
-	heartbeat := time.Duration(rr.HeartbeatInterval) * time.Second
-
-	k.Log.Info("Registered (via HTTP) with URL: '%s' and HeartBeat interval: '%s'",
-		rr.URL, heartbeat)
-
-	go k.sendHeartbeats(heartbeat, kiteURL)
-
-	k.callOnRegisterHandlers(&rr)
-
-	return &registerResult{parsed}, nil
+	return &registerResult{
+		URL:       parsed,
+		result:    &rr,
+		heartbeat: time.Duration(rr.HeartbeatInterval) * time.Second,
+	}, nil
 }
 
 var errRegisterAgain = errors.New("register again")
@@ -199,6 +279,8 @@ func (k *Kite) sendHeartbeats(interval time.Duration, kiteURL *url.URL) {
 	heartbeatFunc := func() error {
 		k.Log.Debug("Sending heartbeat to %s", u)
 
+		sent := time.Now()
+
 		resp, err := k.Config.Client.Get(u.String())
 		if err != nil {
 			return err
@@ -209,6 +291,10 @@ func (k *Kite) sendHeartbeats(interval time.Duration, kiteURL *url.URL) {
 			return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 		}
 
+		if t, err := strconv.ParseInt(resp.Header.Get(protocol.KontrolTimeHeader), 10, 64); err == nil {
+			k.updateClockSkew(sent, time.Now(), t)
+		}
+
 		// we are just receiving small size strings such as "pong",
 		// "registeragain" so we limit the reader to read just that
 		p, err := ioutil.ReadAll(io.LimitReader(resp.Body, 16))
@@ -227,7 +313,9 @@ func (k *Kite) sendHeartbeats(interval time.Duration, kiteURL *url.URL) {
 			k.Log.Info("Disconnected from Kontrol, going to register again")
 
 			go func() {
-				k.RegisterHTTPForever(kiteURL)
+				if res := k.registerHTTPForever(kiteURL); res != nil {
+					k.callOnReRegisterHandlers(res.result)
+				}
 			}()
 
 			return errRegisterAgain
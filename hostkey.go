@@ -0,0 +1,137 @@
+package kite
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/koding/kite/kitekey"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// hostKey returns the private key the kite proves its identity with, see
+// Kite.HostKey. The key is loaded on the first use, when it can't be read
+// nor generated the kite uses a key which lasts until the process exits,
+// so the kites which pinned the identity reject it after a restart.
+func (k *Kite) hostKey() *ecdsa.PrivateKey {
+	k.hostKeyOnce.Do(func() {
+		if k.HostKey != nil {
+			k.hostKeyLoaded = k.HostKey
+			return
+		}
+
+		key, err := readHostKey()
+		if err != nil {
+			k.Log.Warning("Using a temporary host key: %s", err)
+
+			if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+				panic("kite: generating host key: " + err.Error())
+			}
+		}
+
+		k.hostKeyLoaded = key
+	})
+
+	return k.hostKeyLoaded
+}
+
+// readHostKey reads the host key from $KITE_HOME/host.key, generating it
+// when the file does not exist yet.
+func readHostKey() (*ecdsa.PrivateKey, error) {
+	kiteHome, err := kitekey.KiteHome()
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(kiteHome, "host.key")
+
+	p, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return writeHostKey(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return jwt.ParseECPrivateKeyFromPEM(p)
+}
+
+// writeHostKey generates a host key and writes it to the path, unless
+// another process did it first, in which case its key is read.
+func writeHostKey(path string) (*ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(path)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := ioutil.TempFile(dir, ".host.key")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	if err := pem.Encode(f, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	// Unlike rename, link does not replace the key of another process
+	// generated meanwhile.
+	if err := os.Link(f.Name(), path); os.IsExist(err) {
+		p, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return jwt.ParseECPrivateKeyFromPEM(p)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// hostKeyFingerprint returns the hex-encoded SHA-256 checksum of the DER
+// encoding of the public host key.
+func hostKeyFingerprint(key *ecdsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// encodeHostKey returns the PEM encoding of the public host key.
+func encodeHostKey(key *ecdsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
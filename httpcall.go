@@ -0,0 +1,261 @@
+package kite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/utils"
+
+	"github.com/igm/sockjs-go/sockjs"
+)
+
+// HTTPCallPath is the prefix of the URL path the handlers of a kite are
+// served under over plain HTTP, for environments where websockets and
+// long-polling are blocked. The method name follows the prefix:
+//
+//     POST /kite/call/square
+//     Authorization: Bearer <token>
+//
+//     {"withArgs": [4]}
+//
+// The body is the same object the callers send as the first argument of
+// a websocket call, e.g. it can hold "authentication", "tenant" or
+// "apiVersion" fields. The authentication can be also passed with the
+// Authorization header, as "<type> <key>", where the "Bearer" type stands
+// for a token. Callbacks are not supported.
+//
+// The reply is a JSON-encoded Response.
+//
+// The HTTP calls are disabled unless Config.HTTPCalls is set, and
+// the requests are restricted with SetUpgradePolicy and ValidateUpgrade,
+// like the ones opening SockJS connections.
+const HTTPCallPath = "/kite/call/"
+
+// httpCallMaxBody is the maximum size of the body of an HTTP call.
+const httpCallMaxBody = 32 << 20
+
+var errHTTPSession = errors.New("HTTP calls do not support callbacks")
+
+// handleHTTPCall serves a single call of a method made over plain HTTP. The
+// call goes through the same path as the ones made over websocket, so
+// the authentication, limits and middlewares apply to it as well.
+func (k *Kite) handleHTTPCall(w http.ResponseWriter, req *http.Request) {
+	if !k.Config.HTTPCalls {
+		http.NotFound(w, req)
+		return
+	}
+
+	if err := k.checkUpgrade(req); err != nil {
+		k.Log.Debug("Rejected HTTP call from %s: %s", req.RemoteAddr, err)
+		writeHTTPResponse(w, http.StatusForbidden, &Error{
+			Type:    "genericError",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if req.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeHTTPResponse(w, http.StatusMethodNotAllowed, &Error{
+			Type:    "genericError",
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	name := strings.TrimPrefix(req.URL.Path, HTTPCallPath)
+
+	method, ok := k.method(name)
+	if !ok {
+		writeHTTPResponse(w, http.StatusNotFound, &Error{
+			Type:    "methodNotFound",
+			Message: dnode.MethodNotFoundError{Method: name}.Error(),
+		})
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, httpCallMaxBody))
+	if err != nil {
+		writeHTTPResponse(w, http.StatusBadRequest, &Error{
+			Type:    "genericError",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	options, err := httpCallOptions(body, req.Header.Get("Authorization"))
+	if err != nil {
+		writeHTTPResponse(w, http.StatusBadRequest, &Error{
+			Type:    "argumentError",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	msg, err := json.Marshal(&dnode.Message{
+		Method:    name,
+		Arguments: &dnode.Partial{Raw: append(append([]byte("["), options...), ']')},
+		Callbacks: map[string]dnode.Path{},
+	})
+	if err != nil {
+		writeHTTPResponse(w, http.StatusInternalServerError, &Error{
+			Type:    "genericError",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	limits := &dnode.Limits{
+		MaxDepth:     k.Config.MaxMessageDepth,
+		MaxCallbacks: k.Config.MaxMessageCallbacks,
+		MaxArguments: k.Config.MaxMessageArgs,
+	}
+
+	sender := func(uint64, []interface{}) error { return errHTTPSession }
+
+	parsed, err := dnode.ParseMessageWithLimits(msg, sender, limits)
+	if err != nil {
+		writeHTTPResponse(w, http.StatusBadRequest, &Error{
+			Type:    "messageLimitError",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	parsed.Arguments.Naming = k.Config.FieldNaming
+	parsed.Arguments.Numbers = k.Config.Numbers
+
+	// The client lives for the duration of the call only, it never
+	// dials, so it does not need to track the kite's registration.
+	c := k.newClient("")
+	c.setSession(&httpSession{id: utils.RandomString(20), req: req})
+	defer c.Close()
+
+	// The call is canceled when the caller goes away.
+	c.ctxMu.Lock()
+	c.ctx, c.cancel = context.WithCancel(req.Context())
+	c.ctxMu.Unlock()
+	defer c.closeContext()
+
+	var response *Response
+	c.runMethod(method, parsed.Arguments, func(r *Response) { response = r })
+
+	if response == nil {
+		response = &Response{}
+	}
+
+	status := http.StatusOK
+	if response.Error != nil {
+		status = httpCallStatus(response.Error)
+	}
+
+	writeJSON(w, status, response)
+}
+
+// httpCallOptions returns the call options from the request body, with
+// the authentication taken from the Authorization header, when the body
+// does not have one.
+func httpCallOptions(body []byte, authorization string) ([]byte, error) {
+	options := make(map[string]*json.RawMessage)
+
+	if len(strings.TrimSpace(string(body))) != 0 {
+		if err := json.Unmarshal(body, &options); err != nil {
+			return nil, err
+		}
+	}
+
+	// Callbacks can not be called over HTTP.
+	delete(options, "responseCallback")
+
+	if _, ok := options["authentication"]; !ok && authorization != "" {
+		auth := &Auth{Type: "token", Key: authorization}
+
+		if i := strings.IndexByte(authorization, ' '); i != -1 {
+			auth.Type, auth.Key = authorization[:i], strings.TrimSpace(authorization[i+1:])
+		}
+
+		if strings.EqualFold(auth.Type, "Bearer") {
+			auth.Type = "token"
+		}
+
+		p, err := json.Marshal(auth)
+		if err != nil {
+			return nil, err
+		}
+
+		raw := json.RawMessage(p)
+		options["authentication"] = &raw
+	}
+
+	return json.Marshal(options)
+}
+
+// httpCallStatus gives the HTTP status code for the error of a call.
+func httpCallStatus(err *Error) int {
+	switch err.Type {
+	case "authenticationError":
+		return http.StatusUnauthorized
+	case "methodNotFound":
+		return http.StatusNotFound
+	case "argumentError", "messageLimitError", "unsupportedVersion":
+		return http.StatusBadRequest
+	case "requestLimitError", "quotaExceeded":
+		return http.StatusTooManyRequests
+	case "shutdownError", "overloadedError":
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeHTTPResponse(w http.ResponseWriter, status int, err *Error) {
+	writeJSON(w, status, &Response{Error: err})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// httpSession is the session of a client making a call over HTTP. It does
+// not carry any messages, the response is written to the HTTP response.
+type httpSession struct {
+	id  string
+	req *http.Request
+}
+
+var _ sockjs.Session = (*httpSession)(nil)
+
+func (s *httpSession) ID() string {
+	return s.id
+}
+
+func (s *httpSession) Request() *http.Request {
+	return s.req
+}
+
+func (s *httpSession) RemoteAddr() string {
+	return s.req.RemoteAddr
+}
+
+func (s *httpSession) Recv() (string, error) {
+	return "", errHTTPSession
+}
+
+func (s *httpSession) Send(string) error {
+	return errHTTPSession
+}
+
+func (s *httpSession) Close(uint32, string) error {
+	return nil
+}
+
+func (s *httpSession) GetSessionState() sockjs.SessionState {
+	return sockjs.SessionActive
+}
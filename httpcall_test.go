@@ -0,0 +1,127 @@
+package kite
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestKite_HTTPCall(t *testing.T) {
+	k := New("httpcall", "0.0.1")
+	k.Config.HTTPCalls = true
+	defer k.Close()
+
+	k.HandleFunc("square", func(r *Request) (interface{}, error) {
+		n := r.Args.One().MustFloat64()
+		return n * n, nil
+	}).DisableAuthentication()
+
+	k.HandleFunc("secret", func(r *Request) (interface{}, error) {
+		return "secret", nil
+	})
+
+	call := func(method, path, body string, header http.Header) (int, *Response) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for key, values := range header {
+			req.Header[key] = values
+		}
+
+		rec := httptest.NewRecorder()
+		k.ServeHTTP(rec, req)
+
+		var resp Response
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Unmarshal(%q)=%s", rec.Body.String(), err)
+		}
+
+		return rec.Code, &resp
+	}
+
+	code, resp := call("POST", "/kite/call/square", `{"withArgs": [4]}`, nil)
+	if code != http.StatusOK || resp.Error != nil {
+		t.Fatalf("got %d, %+v, want 200", code, resp.Error)
+	}
+
+	if resp.Result != 16.0 {
+		t.Fatalf("got %v, want 16", resp.Result)
+	}
+
+	code, resp = call("POST", "/kite/call/secret", `{}`, http.Header{"Authorization": {"Bearer invalid"}})
+	if code != http.StatusUnauthorized || resp.Error == nil || resp.Error.Type != "authenticationError" {
+		t.Fatalf("got %d, %+v, want 401 authenticationError", code, resp.Error)
+	}
+
+	code, resp = call("POST", "/kite/call/notfound", `{}`, nil)
+	if code != http.StatusNotFound || resp.Error == nil || resp.Error.Type != "methodNotFound" {
+		t.Fatalf("got %d, %+v, want 404 methodNotFound", code, resp.Error)
+	}
+
+	if code, _ = call("GET", "/kite/call/square", "", nil); code != http.StatusMethodNotAllowed {
+		t.Fatalf("got %d, want 405", code)
+	}
+
+	if code, _ = call("POST", "/kite/call/square", "{", nil); code != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400", code)
+	}
+
+	k.SetUpgradePolicy(&UpgradePolicy{AllowedOrigins: []string{"https://example.com"}})
+
+	code, resp = call("POST", "/kite/call/square", `{"withArgs": [4]}`, http.Header{"Origin": {"https://evil.io"}})
+	if code != http.StatusForbidden || resp.Error == nil {
+		t.Fatalf("got %d, %+v, want 403", code, resp.Error)
+	}
+
+	if code, _ = call("POST", "/kite/call/square", `{"withArgs": [4]}`, http.Header{"Origin": {"https://example.com"}}); code != http.StatusOK {
+		t.Fatalf("got %d, want 200", code)
+	}
+
+	k.SetUpgradePolicy(nil)
+	k.Config.HTTPCalls = false
+
+	rec := httptest.NewRecorder()
+	k.ServeHTTP(rec, httptest.NewRequest("POST", "/kite/call/square", strings.NewReader(`{"withArgs": [4]}`)))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("got %d, want 404 for disabled HTTP calls", rec.Code)
+	}
+}
+
+func TestHTTPCallOptions(t *testing.T) {
+	cases := map[string]Auth{
+		"Bearer abc":  {Type: "token", Key: "abc"},
+		"kiteKey xyz": {Type: "kiteKey", Key: "xyz"},
+		"abc":         {Type: "token", Key: "abc"},
+	}
+
+	for header, want := range cases {
+		p, err := httpCallOptions(nil, header)
+		if err != nil {
+			t.Fatalf("httpCallOptions(%q)=%s", header, err)
+		}
+
+		var options callOptions
+		if err := json.Unmarshal(p, &options); err != nil {
+			t.Fatalf("Unmarshal()=%s", err)
+		}
+
+		if options.Auth == nil || *options.Auth != want {
+			t.Fatalf("%s: got %+v, want %+v", header, options.Auth, want)
+		}
+	}
+
+	p, err := httpCallOptions([]byte(`{"authentication": {"type": "kiteKey", "key": "body"}}`), "Bearer header")
+	if err != nil {
+		t.Fatalf("httpCallOptions()=%s", err)
+	}
+
+	var options callOptions
+	if err := json.Unmarshal(p, &options); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	if options.Auth.Key != "body" {
+		t.Fatalf("got %q, want the authentication from the body", options.Auth.Key)
+	}
+}
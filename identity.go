@@ -0,0 +1,368 @@
+package kite
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/protocol"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Identity identifies a kite to the kites connecting to it.
+type Identity struct {
+	Kite protocol.Kite `json:"kite"`
+
+	// KeyFingerprint is the hex-encoded SHA-256 checksum of the kite key,
+	// it is empty for kites without a kite key.
+	KeyFingerprint string `json:"keyFingerprint,omitempty"`
+
+	// HostKeyFingerprint is the hex-encoded SHA-256 checksum of the public
+	// host key of the kite, see Kite.HostKey. The kite proves it holds
+	// the private key on every connection, so unlike the other fields,
+	// the fingerprint can't be presented by another kite.
+	HostKeyFingerprint string `json:"hostKeyFingerprint,omitempty"`
+}
+
+// IdentityError is the security error the connection is closed with, when
+// the remote kite presents a different identity after reconnecting than
+// it did on the first connection, or fails to prove it. It means another
+// kite took over the URL, which may be an attempt of hijacking the endpoint.
+type IdentityError struct {
+	URL    string
+	Pinned *Identity // identity trusted on the first connection
+	Got    *Identity // identity presented after reconnecting, nil if not proven
+	Err    error     // why the identity was not proven, if it was not
+}
+
+func (e *IdentityError) Error() string {
+	if e.Got == nil {
+		return fmt.Sprintf("kite at %s failed to prove its identity %s (host key %.12s): %s",
+			e.URL, e.Pinned.Kite.ID, e.Pinned.HostKeyFingerprint, e.Err)
+	}
+
+	return fmt.Sprintf("identity of the kite at %s has changed from %s (key %.12s, host key %.12s) to %s (key %.12s, host key %.12s)",
+		e.URL, e.Pinned.Kite.ID, e.Pinned.KeyFingerprint, e.Pinned.HostKeyFingerprint,
+		e.Got.Kite.ID, e.Got.KeyFingerprint, e.Got.HostKeyFingerprint)
+}
+
+// matches tells whether the identities are the same.
+func (id *Identity) matches(other *Identity) bool {
+	return id.Kite.ID == other.Kite.ID &&
+		id.KeyFingerprint == other.KeyFingerprint &&
+		id.HostKeyFingerprint == other.HostKeyFingerprint
+}
+
+// Identity returns the identity of the kite.
+func (k *Kite) Identity() *Identity {
+	id := &Identity{
+		Kite:               *k.Kite(),
+		HostKeyFingerprint: hostKeyFingerprint(&k.hostKey().PublicKey),
+	}
+
+	if key := k.KiteKey(); key != "" {
+		id.KeyFingerprint = kitekey.Fingerprint(key)
+	}
+
+	return id
+}
+
+// identityChallenge is the argument of the kite.identity method, the nonce
+// is signed together with the identity, so the signature can't be replayed.
+type identityChallenge struct {
+	Nonce string `json:"nonce"`
+}
+
+// identityProof is the result of the kite.identity method. The signature
+// is a JWT signed with the host key, whose claims are the identity of
+// the kite and the nonce of the challenge.
+type identityProof struct {
+	HostKey   string `json:"hostKey"`
+	Signature string `json:"signature"`
+}
+
+type identityClaims struct {
+	jwt.StandardClaims
+	Identity
+	Nonce string `json:"nonce"`
+}
+
+func (k *Kite) handleIdentity(r *Request) (interface{}, error) {
+	var challenge identityChallenge
+
+	if r.Args == nil {
+		return nil, errors.New("missing challenge")
+	}
+
+	if err := r.Args.One().Unmarshal(&challenge); err != nil {
+		return nil, err
+	}
+
+	if challenge.Nonce == "" {
+		return nil, errors.New("missing nonce")
+	}
+
+	key := k.hostKey()
+
+	hostKey, err := encodeHostKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &identityClaims{
+		Identity: *k.Identity(),
+		Nonce:    challenge.Nonce,
+	}
+
+	signature, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &identityProof{
+		HostKey:   hostKey,
+		Signature: signature,
+	}, nil
+}
+
+// Identity returns the identity of the remote kite, which is trusted on the
+// first connection and pinned - every reconnect verifies the remote kite
+// still has the same ID, kite key and host key. With Kite.KnownKites,
+// the identity is verified against the recorded one also on the first
+// connection.
+//
+// The remote kite proves it holds the host key by signing a random
+// challenge, the calls made after dialing are sent once it does.
+// A pinned kite failing to prove its identity is treated the same way as
+// the one presenting a different identity, see IdentityError.
+//
+// It returns nil, if the identity is not known yet, the pinning is disabled
+// with DisablePinning or the remote kite does not support it.
+func (c *Client) Identity() *Identity {
+	c.pinnedMu.Lock()
+	defer c.pinnedMu.Unlock()
+
+	return c.pinned
+}
+
+// resetVerified makes the calls wait until the identity of the remote kite
+// is verified after dialing. It returns nil if the pinning is disabled.
+func (c *Client) resetVerified() chan struct{} {
+	if c.DisablePinning {
+		return nil
+	}
+
+	verified := make(chan struct{})
+
+	c.pinnedMu.Lock()
+	c.verified = verified
+	c.identityErr = nil
+	c.pinnedMu.Unlock()
+
+	return verified
+}
+
+// waitVerified waits until the identity of the remote kite is verified
+// after dialing, it returns the error the identity was rejected with.
+func (c *Client) waitVerified(verified chan struct{}) error {
+	if verified == nil {
+		return nil
+	}
+
+	<-verified
+
+	c.pinnedMu.Lock()
+	defer c.pinnedMu.Unlock()
+
+	if c.identityErr != nil {
+		return c.identityErr
+	}
+
+	return nil
+}
+
+// setVerified lets the waiting calls be sent.
+func (c *Client) setVerified(verified chan struct{}) {
+	c.pinnedMu.Lock()
+	if c.verified == verified {
+		c.verified = nil
+	}
+	c.pinnedMu.Unlock()
+
+	close(verified)
+}
+
+func (c *Client) verifiedChan() chan struct{} {
+	c.pinnedMu.Lock()
+	defer c.pinnedMu.Unlock()
+
+	return c.verified
+}
+
+// verifyIdentity challenges the remote kite to prove its identity and
+// compares it with the pinned one. On a mismatch the connection is closed
+// and OnSecurityError handlers are called with an *IdentityError.
+// It returns false if the connection was lost meanwhile.
+func (c *Client) verifyIdentity() bool {
+	got, err := c.challengeIdentity()
+
+	pinned := c.Identity()
+	known := c.LocalKite.KnownKites
+
+	if err != nil {
+		if e, ok := err.(*Error); ok && (e.Type == "disconnect" || e.Type == "sendError") {
+			// The identity is verified again on the next connection.
+			return false
+		}
+
+		if pinned == nil && known != nil {
+			pinned = known.Get(c.URL)
+		}
+
+		if pinned == nil {
+			// Older kites do not support pinning.
+			c.LocalKite.Log.Debug("Verifying identity of %q failed: %s", c.URL, err)
+			return true
+		}
+
+		c.rejectIdentity(&IdentityError{
+			URL:    c.URL,
+			Pinned: pinned,
+			Err:    err,
+		})
+		return true
+	}
+
+	// The known kites are verified on every connection, as the identity
+	// may have been trusted with KnownKites.Prompt meanwhile.
+	if known != nil {
+		idErr, err := known.verify(c.URL, got)
+		if err != nil {
+			c.LocalKite.Log.Warning("Recording identity of %q in %s failed: %s", c.URL, known.Path(), err)
+		}
+
+		if idErr != nil {
+			c.rejectIdentity(idErr)
+			return true
+		}
+
+		c.pinnedMu.Lock()
+		c.pinned = got
+		c.pinnedMu.Unlock()
+
+		return true
+	}
+
+	c.pinnedMu.Lock()
+	pinned = c.pinned
+	if pinned == nil {
+		c.pinned = got
+	}
+	c.pinnedMu.Unlock()
+
+	if pinned == nil || got.matches(pinned) {
+		return true
+	}
+
+	c.rejectIdentity(&IdentityError{
+		URL:    c.URL,
+		Pinned: pinned,
+		Got:    got,
+	})
+
+	return true
+}
+
+// challengeIdentity calls kite.identity with a random nonce and verifies
+// the identity it replies with is signed with the host key the reply
+// carries, together with the nonce.
+func (c *Client) challengeIdentity() (*Identity, error) {
+	var nonce [32]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+
+	challenge := &identityChallenge{
+		Nonce: base64.RawURLEncoding.EncodeToString(nonce[:]),
+	}
+
+	result, err := c.tellHandshake("kite.identity", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	var proof identityProof
+	if err := result.Unmarshal(&proof); err != nil {
+		return nil, err
+	}
+
+	return proof.verify(challenge.Nonce)
+}
+
+// verify returns the identity signed in the proof, if it is signed with
+// the host key of the proof, together with the nonce.
+func (p *identityProof) verify(nonce string) (*Identity, error) {
+	hostKey, err := jwt.ParseECPublicKeyFromPEM([]byte(p.HostKey))
+	if err != nil {
+		return nil, err
+	}
+
+	var claims identityClaims
+
+	keyFunc := func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodES256 {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+
+		return hostKey, nil
+	}
+
+	if _, err := jwt.ParseWithClaims(p.Signature, &claims, keyFunc); err != nil {
+		return nil, err
+	}
+
+	if claims.Nonce != nonce {
+		return nil, errors.New("identity is signed for another challenge")
+	}
+
+	id := claims.Identity
+	id.HostKeyFingerprint = hostKeyFingerprint(hostKey)
+
+	return &id, nil
+}
+
+// tellHandshake makes a call of the kite itself, sent on every dial.
+// Unlike the calls made with Tell, it's sent before the identity of
+// the remote kite is verified and bypasses the interceptors, like
+// the circuit breakers and retries, and the outbound rate limits.
+func (c *Client) tellHandshake(method string, args ...interface{}) (*dnode.Partial, error) {
+	responseChan := make(chan *response, 1)
+
+	c.sendCall(context.Background(), method, args, c.config().Timeout, responseChan)
+
+	resp := <-responseChan
+	return resp.Result, resp.Err
+}
+
+// rejectIdentity closes the connection to the kite, which presented
+// an untrusted identity.
+func (c *Client) rejectIdentity(err *IdentityError) {
+	c.LocalKite.Log.Error("Closing connection: %s", err)
+
+	c.pinnedMu.Lock()
+	c.identityErr = err
+	c.pinnedMu.Unlock()
+
+	c.muReconnect.Lock()
+	c.Reconnect = false
+	c.muReconnect.Unlock()
+
+	c.Close()
+
+	c.callOnSecurityErrHandlers(err)
+}
@@ -0,0 +1,123 @@
+package kite
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+)
+
+func newHostKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey()=%s", err)
+	}
+
+	return key
+}
+
+func TestKite_Identity(t *testing.T) {
+	k := New("identity", "0.0.1")
+	k.Config = config.New()
+	k.Config.KiteKey = "kitekey"
+	k.Config.Username = "devrim"
+	k.HostKey = newHostKey(t)
+
+	id := k.Identity()
+
+	if id.Kite.ID != k.Id {
+		t.Fatalf("got %q, want %q", id.Kite.ID, k.Id)
+	}
+
+	sum := sha256.Sum256([]byte("kitekey"))
+	if want := hex.EncodeToString(sum[:]); id.KeyFingerprint != want {
+		t.Fatalf("got %q, want %q", id.KeyFingerprint, want)
+	}
+
+	if want := hostKeyFingerprint(&k.HostKey.PublicKey); id.HostKeyFingerprint != want {
+		t.Fatalf("got %q, want %q", id.HostKeyFingerprint, want)
+	}
+
+	k.Config.KiteKey = ""
+
+	if id := k.Identity(); id.KeyFingerprint != "" {
+		t.Fatalf("got %q, want empty fingerprint", id.KeyFingerprint)
+	}
+}
+
+func TestKite_IdentityProof(t *testing.T) {
+	k := New("identity", "0.0.1")
+	k.Config = config.New()
+	k.Config.KiteKey = "kitekey"
+	k.HostKey = newHostKey(t)
+
+	prove := func(k *Kite, nonce string) *identityProof {
+		p, err := json.Marshal([]interface{}{&identityChallenge{Nonce: nonce}})
+		if err != nil {
+			t.Fatalf("Marshal()=%s", err)
+		}
+
+		v, err := k.handleIdentity(&Request{Args: &dnode.Partial{Raw: p}})
+		if err != nil {
+			t.Fatalf("handleIdentity()=%s", err)
+		}
+
+		return v.(*identityProof)
+	}
+
+	proof := prove(k, "nonce")
+
+	id, err := proof.verify("nonce")
+	if err != nil {
+		t.Fatalf("verify()=%s", err)
+	}
+
+	if want := k.Identity(); !id.matches(want) {
+		t.Fatalf("got %+v, want %+v", id, want)
+	}
+
+	if _, err := proof.verify("other"); err == nil {
+		t.Fatal("expected the proof for another nonce to be rejected")
+	}
+
+	// An impostor presenting the host key of the kite can't sign with it.
+	impostor := New("identity", "0.0.1")
+	impostor.Config = config.New()
+	impostor.HostKey = newHostKey(t)
+
+	forged := prove(impostor, "nonce")
+	forged.HostKey = proof.HostKey
+
+	if _, err := forged.verify("nonce"); err == nil {
+		t.Fatal("expected the forged proof to be rejected")
+	}
+
+	if _, err := k.handleIdentity(&Request{}); err == nil {
+		t.Fatal("expected the call without a challenge to fail")
+	}
+}
+
+func TestIdentityError(t *testing.T) {
+	err := &IdentityError{
+		URL:    "http://localhost:3636/kite",
+		Pinned: &Identity{KeyFingerprint: "aaaaaaaaaaaaaaaa"},
+		Got:    &Identity{KeyFingerprint: "bbbbbbbbbbbbbbbb"},
+	}
+	err.Pinned.Kite.ID = "first"
+	err.Got.Kite.ID = "second"
+
+	s := err.Error()
+
+	for _, want := range []string{"first", "second", "aaaaaaaaaaaa", "bbbbbbbbbbbb"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("%q does not contain %q", s, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+)
+
+type impersonationKey struct{}
+
+// WithImpersonation returns a copy of ctx that makes the calls done with
+// Client.TellWithContext on behalf of the given user. The remote kite
+// accepts such calls only from the callers listed in its
+// Config.Impersonators, other calls fail with an authentication error.
+func WithImpersonation(ctx context.Context, username string) context.Context {
+	return context.WithValue(ctx, impersonationKey{}, username)
+}
+
+func impersonationFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	username, _ := ctx.Value(impersonationKey{}).(string)
+	return username
+}
+
+// impersonate replaces the authenticated username of the request with the
+// one requested by the caller, provided the caller is allowed to
+// impersonate other users. The caller becomes the Actor of the request.
+func (r *Request) impersonate() *Error {
+	if r.impersonation == "" || r.impersonation == r.Username {
+		return nil
+	}
+
+	if !r.LocalKite.canImpersonate(r.Username) {
+		r.LocalKite.Log.Warning("Impersonation of %q denied for %q calling %q",
+			r.impersonation, r.Username, r.Method)
+
+		return &Error{
+			Type:    "authenticationError",
+			Message: fmt.Sprintf("%s is not allowed to impersonate %s", r.Username, r.impersonation),
+		}
+	}
+
+	r.LocalKite.Log.Info("Impersonation of %q by %q calling %q",
+		r.impersonation, r.Username, r.Method)
+
+	r.Actor = r.Username
+	r.Username = r.impersonation
+
+	return nil
+}
+
+func (k *Kite) canImpersonate(username string) bool {
+	for _, impersonator := range k.Config.Impersonators {
+		if impersonator == username {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,95 @@
+package kite
+
+import (
+	"context"
+	"testing"
+
+	"github.com/koding/kite/config"
+)
+
+func TestWithImpersonation(t *testing.T) {
+	if username := impersonationFromContext(context.Background()); username != "" {
+		t.Fatalf("want no username, got %q", username)
+	}
+
+	ctx := WithImpersonation(context.Background(), "alice")
+
+	if username := impersonationFromContext(ctx); username != "alice" {
+		t.Fatalf("want %q, got %q", "alice", username)
+	}
+}
+
+func TestRequest_Impersonate(t *testing.T) {
+	log, _ := newLogger("impersonate")
+
+	k := &Kite{
+		Config: config.New(),
+		Log:    log,
+	}
+	k.Config.Impersonators = []string{"operator"}
+
+	cases := map[string]struct {
+		username      string
+		impersonation string
+		wantUsername  string
+		wantActor     string
+		wantErr       bool
+	}{
+		"no impersonation": {
+			username:     "bob",
+			wantUsername: "bob",
+		},
+		"self impersonation": {
+			username:      "bob",
+			impersonation: "bob",
+			wantUsername:  "bob",
+		},
+		"allowed": {
+			username:      "operator",
+			impersonation: "alice",
+			wantUsername:  "alice",
+			wantActor:     "operator",
+		},
+		"denied": {
+			username:      "bob",
+			impersonation: "alice",
+			wantErr:       true,
+		},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := &Request{
+				Method:        "foo",
+				LocalKite:     k,
+				Username:      cas.username,
+				impersonation: cas.impersonation,
+			}
+
+			err := r.impersonate()
+			if cas.wantErr {
+				if err == nil {
+					t.Fatal("expected impersonation to be denied")
+				}
+
+				if err.Type != "authenticationError" {
+					t.Fatalf("want authenticationError, got %q", err.Type)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("impersonate()=%s", err)
+			}
+
+			if r.Username != cas.wantUsername {
+				t.Fatalf("want username %q, got %q", cas.wantUsername, r.Username)
+			}
+
+			if r.Actor != cas.wantActor {
+				t.Fatalf("want actor %q, got %q", cas.wantActor, r.Actor)
+			}
+		})
+	}
+}
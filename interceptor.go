@@ -0,0 +1,110 @@
+package kite
+
+import (
+	"context"
+	"time"
+)
+
+// Call describes an outgoing method call, it is passed through the
+// interceptors before it is sent. Interceptors may modify any of the fields.
+type Call struct {
+	// Context of the call. The tenant, the impersonated user and the API
+	// version carried by it are sent along with the call.
+	Context context.Context
+
+	Method  string
+	Args    []interface{}
+	Timeout time.Duration // zero or negative means no timeout
+}
+
+// Invoker sends the call and waits for the result.
+type Invoker func(call *Call) (*Result, error)
+
+// Interceptor wraps outgoing calls, which makes it the client-side
+// counterpart of PreHandle and PostHandle. An interceptor can modify the
+// call before passing it to next, inspect or modify the result, or reject
+// the call altogether by not calling next:
+//
+//     k.Intercept(func(call *kite.Call, next kite.Invoker) (*kite.Result, error) {
+//         start := time.Now()
+//         res, err := next(call)
+//         metrics.Observe(call.Method, time.Since(start), err)
+//         return res, err
+//     })
+//
+// Interceptors run in a separate goroutine, so calls made with Go or
+// GoWithTimeout do not block on them.
+type Interceptor func(call *Call, next Invoker) (*Result, error)
+
+// Intercept adds interceptors of the calls made by all the clients of the
+// kite, including the Kontrol client. They run before the interceptors
+// added with Client.Intercept, in the order they were added. It should be
+// called before any client is dialed.
+func (k *Kite) Intercept(interceptors ...Interceptor) {
+	k.interceptors = append(k.interceptors, interceptors...)
+}
+
+// Intercept adds interceptors of the calls made by the client. They run
+// after the ones added with Kite.Intercept, in the order they were added.
+func (c *Client) Intercept(interceptors ...Interceptor) {
+	c.m.Lock()
+	c.interceptorsList = append(c.interceptorsList, interceptors...)
+	c.m.Unlock()
+}
+
+// interceptors returns the interceptors of the kite and the client.
+func (c *Client) interceptors() []Interceptor {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	var kiteInterceptors []Interceptor
+	if c.LocalKite != nil {
+		kiteInterceptors = c.LocalKite.interceptors
+	}
+
+	if len(c.interceptorsList) == 0 {
+		return kiteInterceptors
+	}
+
+	interceptors := make([]Interceptor, 0, len(kiteInterceptors)+len(c.interceptorsList))
+	interceptors = append(interceptors, kiteInterceptors...)
+	return append(interceptors, c.interceptorsList...)
+}
+
+// intercept runs the call through the interceptors, the last one of them
+// invokes the method.
+func (c *Client) intercept(call *Call, interceptors []Interceptor) (*Result, error) {
+	if len(interceptors) == 0 {
+		return c.invoke(call)
+	}
+
+	return interceptors[0](call, func(call *Call) (*Result, error) {
+		return c.intercept(call, interceptors[1:])
+	})
+}
+
+// invoke sends the call and waits for the result.
+func (c *Client) invoke(call *Call) (*Result, error) {
+	if err := c.waitOutbound(call); err != nil {
+		return nil, err
+	}
+
+	ctx := call.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	responseChan := make(chan *response, 1)
+
+	c.invokeMethod(ctx, call.Method, call.Args, call.Timeout, responseChan)
+
+	resp := <-responseChan
+
+	result := &Result{
+		Value:    resp.Result,
+		Warnings: resp.Warnings,
+		Metadata: resp.Metadata,
+	}
+
+	return result, resp.Err
+}
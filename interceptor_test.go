@@ -0,0 +1,65 @@
+package kite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/koding/kite/dnode"
+)
+
+func TestClient_Intercept(t *testing.T) {
+	k := New("interceptor", "0.0.1")
+	defer k.Close()
+
+	var order []string
+
+	k.Intercept(func(call *Call, next Invoker) (*Result, error) {
+		order = append(order, "kite:"+call.Method)
+		call.Args = append(call.Args, "kite")
+		return next(call)
+	})
+
+	c := k.NewClient("http://127.0.0.1:1/kite")
+
+	c.Intercept(func(call *Call, next Invoker) (*Result, error) {
+		order = append(order, "client:"+call.Method)
+
+		if call.Method == "forbidden" {
+			return nil, errors.New("call is not allowed")
+		}
+
+		p, err := json.Marshal(call.Args)
+		if err != nil {
+			return nil, err
+		}
+
+		// Reply without sending the call.
+		return &Result{Value: &dnode.Partial{Raw: p}}, nil
+	})
+
+	res, err := c.Tell("square", "client")
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	var args []string
+	if err := res.Unmarshal(&args); err != nil {
+		t.Fatalf("Unmarshal()=%s", err)
+	}
+
+	if want := []string{"client", "kite"}; fmt.Sprint(args) != fmt.Sprint(want) {
+		t.Fatalf("want %q, got %q", want, args)
+	}
+
+	if _, err := c.Tell("forbidden"); err == nil || err.Error() != "call is not allowed" {
+		t.Fatalf("want error, got %v", err)
+	}
+
+	want := []string{"kite:square", "client:square", "kite:forbidden", "client:forbidden"}
+
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Fatalf("want %q, got %q", want, order)
+	}
+}
@@ -0,0 +1,155 @@
+package kite
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// keepAlive returns the ping interval and the pong timeout of the client,
+// see Config.PingInterval.
+func (c *Client) keepAlive() (interval, timeout time.Duration) {
+	interval, timeout = c.PingInterval, c.PongTimeout
+
+	if interval == 0 {
+		interval = c.config().PingInterval
+	}
+
+	if timeout == 0 {
+		timeout = c.config().PongTimeout
+	}
+
+	if timeout <= 0 {
+		timeout = interval
+	}
+
+	return interval, timeout
+}
+
+// touch records that a message was received from the remote kite.
+func (c *Client) touch() {
+	atomic.StoreInt64(&c.lastRecv, time.Now().UnixNano())
+}
+
+// startKeepAlive pings the remote kite whenever the connection is idle
+// for the ping interval, and closes the session if nothing is received
+// within the pong timeout afterwards, which ends the read loop. It also
+// measures the latency of the connection every Config.LatencyInterval.
+// The returned function stops the pings.
+func (c *Client) startKeepAlive() (stop func()) {
+	interval, timeout := c.keepAlive()
+	probe := c.config().LatencyInterval
+
+	if interval <= 0 && probe <= 0 {
+		return func() {}
+	}
+
+	session := c.getSession()
+	if session == nil {
+		return func() {}
+	}
+
+	c.touch()
+
+	var tick time.Duration
+	for _, d := range []time.Duration{interval, timeout, probe} {
+		if d > 0 && (tick == 0 || d < tick) {
+			tick = d
+		}
+	}
+
+	if interval <= 0 {
+		timeout = c.config().Timeout
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		t := time.NewTicker(tick / 2)
+		defer t.Stop()
+
+		var pinged, probed time.Time
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+
+			if probe > 0 && time.Since(probed) >= probe {
+				go c.ping(timeout)
+				probed = time.Now()
+			}
+
+			if interval <= 0 {
+				continue
+			}
+
+			last := time.Unix(0, atomic.LoadInt64(&c.lastRecv))
+
+			switch {
+			case pinged.IsZero():
+				if time.Since(last) >= interval {
+					// Any message received counts as a pong, e.g. an error
+					// of a kite not knowing the method.
+					go c.ping(timeout)
+					pinged = time.Now()
+				}
+			case last.After(pinged):
+				pinged = time.Time{}
+			case time.Since(pinged) >= timeout:
+				c.LocalKite.Log.Warning("No pong from %s within %s, closing the connection", c.RemoteAddr(), timeout)
+				session.Close(uint32(closeGoAway.Code), closeGoAway.Reason)
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// Ping calls the kite.ping method of the remote kite, it returns the round
+// trip time of the call, which is recorded in the latency of the client,
+// see Latency.
+func (c *Client) Ping() (time.Duration, error) {
+	return c.ping(c.config().Timeout)
+}
+
+func (c *Client) ping(timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+
+	if _, err := c.TellWithTimeout("kite.ping", timeout); err != nil {
+		return 0, err
+	}
+
+	rtt := time.Since(start)
+	c.addLatency(rtt)
+
+	return rtt, nil
+}
+
+// Latency returns the smoothed round trip time of the pings of the remote
+// kite, or 0 if it was not pinged yet. The latency of the connections is
+// measured every Config.LatencyInterval, and with every call of Ping.
+//
+// The latency is kept across reconnects.
+func (c *Client) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.latency))
+}
+
+// addLatency adds the round trip time to the smoothed one, with the same
+// weight TCP uses for the smoothed RTT.
+func (c *Client) addLatency(rtt time.Duration) {
+	for {
+		old := atomic.LoadInt64(&c.latency)
+
+		srtt := int64(rtt)
+		if old != 0 {
+			srtt = old + (int64(rtt)-old)/8
+		}
+
+		if atomic.CompareAndSwapInt64(&c.latency, old, srtt) {
+			return
+		}
+	}
+}
@@ -5,16 +5,20 @@ package kite
 
 import (
 	"bytes"
+	"crypto/ecdsa"
 	"crypto/rsa"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/koding/kite/config"
@@ -24,9 +28,9 @@ import (
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
 	"github.com/igm/sockjs-go/sockjs"
+	"github.com/juju/ratelimit"
 	"github.com/koding/cache"
 	"github.com/koding/kite/sockjsclient"
-	uuid "github.com/satori/go.uuid"
 )
 
 var hostname string
@@ -52,6 +56,18 @@ func init() {
 // with HandleFunc mehtod, then call Run method to start the inbuilt server (or
 // pass it to any http.Handler compatible server)
 type Kite struct {
+	// 64-bit fields accessed atomically go first to be aligned on 32-bit
+	// platforms.
+
+	// clockSkew is the last measured difference between the local clock
+	// and Kontrol's one, see ClockSkew
+	clockSkew int64
+
+	// bytesIn and bytesOut count the traffic of all the clients of the
+	// kite, see Stats
+	bytesIn  uint64
+	bytesOut uint64
+
 	Config *config.Config
 
 	// Log logs with the given Logger interface
@@ -64,6 +80,27 @@ type Kite struct {
 	// Keys are the authentication types (options.auth.type).
 	Authenticators map[string]func(*Request) error
 
+	// CertificateUsername, when non-nil, maps the client certificates
+	// authenticated by the "mtls" authenticator to usernames, instead of
+	// the CertificateUsername function, see AuthenticateFromTLS.
+	CertificateUsername func(*x509.Certificate) (string, error)
+
+	// KiteKeyPolicy, when non-nil, decides which of the callers
+	// authenticated by the "kiteKey" authenticator are trusted. By default
+	// any kite key signed by a trusted Kontrol is.
+	KiteKeyPolicy KiteKeyPolicy
+
+	// KnownKites, when non-nil, records the identities of the kites
+	// the clients connect to, so they are verified across the restarts
+	// of the process, see Client.Identity.
+	KnownKites *KnownKites
+
+	// HostKey is the private key the kite proves its identity with to
+	// the kites connecting to it, see Client.Identity. If nil, the key is
+	// read from $KITE_HOME/host.key, which is generated if it does not
+	// exist, like the host keys of SSH.
+	HostKey *ecdsa.PrivateKey
+
 	// ClientFunc is used as the default value for kite.Client.ClientFunc.
 	// If nil, a default ClientFunc will be used.
 	//
@@ -72,21 +109,111 @@ type Kite struct {
 
 	// Handlers added with Kite.HandleFunc().
 	handlers     map[string]*Method // method map for exported methods
+	methodsMu    sync.RWMutex       // protects handlers
 	preHandlers  []Handler          // a list of handlers that are executed before any handler
 	postHandlers []Handler          // a list of handlers that are executed after any handler
 	finalFuncs   []FinalFunc        // a list of funcs executed after any handler regardless of the error
+	middlewares  []Middleware       // a list of middlewares wrapping every handler
+	interceptors []Interceptor      // a list of interceptors of the calls made by any client
+
+	// responseValidators validate the results of the calls made by any
+	// client, see ValidateResponse
+	responseValidators   map[string]ResponseValidator
+	responseValidatorsMu sync.RWMutex
+
+	// pingMethod is the default kite.ping method, its calls are answered
+	// by Client.handleFast
+	pingMethod *Method
 
 	// MethodHandling defines how the kite is returning the response for
 	// multiple handlers
 	MethodHandling MethodHandling
 
+	// quota and quotaStore are used for enforcing per-username quotas,
+	// see SetQuota.
+	quota      *Quota
+	quotaStore QuotaStore
+	quotaMu    sync.RWMutex
+
+	// proxy is the proxy kite the kite is registered to, see
+	// RegisterToProxy
+	proxy proxyRegistration
+
+	// acl and authorizers decide which calls are allowed, see SetACL
+	// and Authorize
+	acl         *ACL
+	authorizers []func(*Request) error
+	authzMu     sync.RWMutex
+
+	// upgradePolicy and upgradeValidators decide which requests can open
+	// SockJS connections, see SetUpgradePolicy and ValidateUpgrade
+	upgradePolicy     *UpgradePolicy
+	upgradeValidators []func(*http.Request) error
+	upgradeMu         sync.RWMutex
+
+	// cors allows the cross-origin HTTP requests, see SetCORS
+	cors   *CORS
+	corsMu sync.RWMutex
+
+	// rateLimits are the rate limits of the handled calls by scope,
+	// see SetRateLimit
+	rateLimits   map[RateLimitScope]*rateLimiter
+	rateLimitsMu sync.RWMutex
+
+	// outbound are rate limits of the calls to remote kites by kite ID or
+	// name, see ThrottleOutgoing
+	outbound   map[string]*ratelimit.Bucket
+	outboundMu sync.RWMutex
+
+	// modules are names of the loaded modules
+	modules   map[string]bool
+	modulesMu sync.Mutex
+
+	// features are advertised to remote kites, see AddFeature
+	features   map[string]bool
+	featuresMu sync.RWMutex
+
+	// shared are connections shared by kite ID, see DialShared
+	shared   map[string]*sharedClient
+	sharedMu sync.Mutex
+
 	// HTTP muxer
 	muxer *mux.Router
 
+	// httpHandler is the muxer wrapped with the middlewares added with
+	// WrapHTTP, it is nil if there are none
+	httpHandler     http.Handler
+	httpMiddlewares []func(http.Handler) http.Handler
+
 	// kontrolclient is used to register to kontrol and query third party kites
 	// from kontrol
 	kontrol *kontrolClient
 
+	// local replaces Kontrol in local mode
+	local localRegistry
+
+	// topics holds the subscriptions to the events published by the kite
+	topics topics
+
+	// versions are served in addition to the version of the kite,
+	// see AddVersion
+	versions   map[string]*KiteVersion
+	versionsMu sync.Mutex
+
+	// clientCAsPool holds the CAs read from Config.TLSClientCAFile by
+	// the "mtls" authenticator, see clientCAs
+	clientCAsPool *x509.CertPool
+	clientCAsErr  error
+	clientCAsOnce sync.Once
+
+	// hostKeyLoaded is the HostKey or the one loaded from KITE_HOME,
+	// see hostKey
+	hostKeyLoaded *ecdsa.PrivateKey
+	hostKeyOnce   sync.Once
+
+	// revoked are the IDs of the revoked tokens, see RevokeTokens
+	revoked revocations
+
 	// kontrolKey stores parsed Config.KontrolKey
 	kontrolKey *rsa.PublicKey
 
@@ -132,6 +259,18 @@ type Kite struct {
 	// registers successfully to Kontrol
 	onRegisterHandlers []func(*protocol.RegisterResult)
 
+	// onClockSkewHandlers field holds callbacks invoked when the local
+	// clock is detected to be skewed, see OnClockSkew
+	onClockSkewHandlers []func(time.Duration)
+
+	// onReRegisterHandlers field holds callbacks invoked when Kite
+	// registers again to Kontrol, after the registration was lost
+	onReRegisterHandlers []func(*protocol.RegisterResult)
+
+	// onShutdownHandlers field holds functions run by Shutdown,
+	// see OnShutdown
+	onShutdownHandlers []shutdownHook
+
 	// handlersMu protects access to on*Handlers fields.
 	handlersMu sync.RWMutex
 
@@ -143,10 +282,57 @@ type Kite struct {
 	// server fields, are initialized and used when
 	// TODO: move them to their own struct, just like KontrolClient
 	listener  *gracefulListener
+	tcp       *net.TCPListener // the listener before wrapping with TLS
 	TLSConfig *tls.Config
 	readyC    chan bool // To signal when kite is ready to accept connections
 	closeC    chan bool // To signal when kite is closed with Close()
 
+	// TraceRedact, when non-nil, is applied to payloads of the frames
+	// before they are logged by the tracing, see SetTrace.
+	TraceRedact func(payload []byte) []byte
+
+	// Tracer, when non-nil, starts the spans of the outgoing calls and of
+	// the handled requests. The trace context is sent along with the calls
+	// regardless, see WithSpanContext.
+	Tracer Tracer
+
+	// redactPaths are JSON paths of sensitive fields, see RedactFields
+	redactPaths [][]string
+	redactMu    sync.RWMutex
+
+	// trace overrides Config.Trace, see SetTrace
+	trace int32
+
+	// clockSkewed is non-zero while the clock skew is over the threshold,
+	// see ClockSkew
+	clockSkewed int32
+
+	// conns are the connections made to the kite
+	conns   map[*Client]struct{}
+	connsMu sync.Mutex
+
+	// started and connections are reported by kite.stats
+	started     time.Time
+	connections int32
+
+	// inflight counts the method calls being handled, draining is set
+	// once the kite is shutting down, see Shutdown
+	inflight int32
+	draining int32
+
+	// admission limits the calls handled at once,
+	// see Config.MaxConcurrentRequests
+	admission admission
+
+	// metrics are exported at MetricsPath, see EnableMetrics
+	metrics   *metrics
+	metricsMu sync.Mutex
+
+	// tokens are the tokens of the kites returned by GetKites, when
+	// Config.TokenCache is enabled
+	tokens     *tokenCache
+	tokensOnce sync.Once
+
 	name    string
 	version string
 	Id      string // Unique kite instance id
@@ -171,8 +357,6 @@ func NewWithConfig(name, version string, cfg *config.Config) *Kite {
 		panic("kite: version must be 3-digits semantic version")
 	}
 
-	kiteID := uuid.NewV4()
-
 	l, setlevel := newLogger(name)
 
 	kClient := &kontrolClient{
@@ -190,21 +374,31 @@ func NewWithConfig(name, version string, cfg *config.Config) *Kite {
 		kontrol:        kClient,
 		name:           name,
 		version:        version,
-		Id:             kiteID.String(),
+		Id:             NewKiteID(name, cfg),
 		readyC:         make(chan bool),
 		closeC:         make(chan bool),
 		heartbeatC:     make(chan *heartbeatReq, 1),
 		muxer:          mux.NewRouter(),
+		started:        time.Now(),
+	}
+
+	if cfg.LogLevel != "" {
+		setlevel(parseLevel(cfg.LogLevel))
 	}
 
+	// Calls made over plain HTTP, it must precede the sockjs endpoint.
+	k.muxer.PathPrefix(HTTPCallPath).HandlerFunc(k.handleHTTPCall)
+
 	// All sockjs communication is done through this endpoint..
-	k.muxer.PathPrefix("/kite").Handler(sockjs.NewHandler("/kite", *cfg.SockJS, k.sockjsHandler))
+	k.muxer.PathPrefix("/kite").Handler(k.upgradeHandler(sockjs.NewHandler("/kite", sockjsOptions(cfg), k.sockjsHandler)))
 
 	// Add useful debug logs
 	k.OnConnect(func(c *Client) { k.Log.Debug("New session: %s", c.session.ID()) })
 	k.OnFirstRequest(func(c *Client) { k.Log.Debug("Session %q is identified as %q", c.session.ID(), c.Kite) })
 	k.OnDisconnect(func(c *Client) { k.Log.Debug("Kite has disconnected: %q", c.Kite) })
+	k.OnDisconnect(k.unsubscribeClient)
 	k.OnRegister(k.updateAuth)
+	k.OnRegister(k.registerVersions)
 
 	// Every kite should be able to authenticate the user from token.
 	// Tokens are granted by Kontrol Kite.
@@ -213,6 +407,9 @@ func NewWithConfig(name, version string, cfg *config.Config) *Kite {
 	// A kite accepts requests with the same username.
 	k.Authenticators["kiteKey"] = k.AuthenticateFromKiteKey
 
+	// Kites connected over TLS can authenticate with their certificates.
+	k.Authenticators["mtls"] = k.AuthenticateFromTLS
+
 	// Register default methods and handlers.
 	k.addDefaultHandlers()
 
@@ -267,10 +464,55 @@ func (k *Kite) HandleHTTPFunc(pattern string, handler func(http.ResponseWriter,
 // ServeHTTP helps Kite to satisfy the http.Handler interface. So kite can be
 // used as a standard http server.
 func (k *Kite) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if k.handleCORS(w, req) {
+		return
+	}
+
+	if k.httpHandler != nil {
+		k.httpHandler.ServeHTTP(w, req)
+		return
+	}
+
 	k.muxer.ServeHTTP(w, req)
 }
 
+// WrapHTTP adds middlewares that wrap all the HTTP requests served by
+// the kite, including the ones opening SockJS connections before they are
+// upgraded to websocket, e.g. to check cookies, log the requests or filter
+// them out:
+//
+//     k.WrapHTTP(func(next http.Handler) http.Handler {
+//         return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//             if _, err := r.Cookie("session"); err != nil {
+//                 http.Error(w, "not logged in", http.StatusUnauthorized)
+//                 return
+//             }
+//
+//             next.ServeHTTP(w, r)
+//         })
+//     })
+//
+// The first one added is the outermost. The preflight requests allowed by
+// SetCORS are answered before any of them, the upgrade policy of the kite
+// is checked after all of them, see SetUpgradePolicy. It should be called
+// before the kite is run.
+func (k *Kite) WrapHTTP(middlewares ...func(http.Handler) http.Handler) {
+	k.httpMiddlewares = append(k.httpMiddlewares, middlewares...)
+
+	var handler http.Handler = k.muxer
+	for i := len(k.httpMiddlewares) - 1; i >= 0; i-- {
+		handler = k.httpMiddlewares[i](handler)
+	}
+
+	k.httpHandler = handler
+}
+
 func (k *Kite) sockjsHandler(session sockjs.Session) {
+	if k.isDraining() {
+		session.Close(uint32(CloseShutdown.Code), CloseShutdown.Reason)
+		return
+	}
+
 	defer session.Close(3000, "Go away!")
 
 	// This Client also handles the connected client.
@@ -278,6 +520,22 @@ func (k *Kite) sockjsHandler(session sockjs.Session) {
 	c := k.NewClient("")
 	defer c.Close()
 
+	atomic.AddInt32(&k.connections, 1)
+	defer atomic.AddInt32(&k.connections, -1)
+
+	k.connsMu.Lock()
+	if k.conns == nil {
+		k.conns = make(map[*Client]struct{})
+	}
+	k.conns[c] = struct{}{}
+	k.connsMu.Unlock()
+
+	defer func() {
+		k.connsMu.Lock()
+		delete(k.conns, c)
+		k.connsMu.Unlock()
+	}()
+
 	c.setSession(session)
 	c.wg.Add(1)
 	go c.sendHub()
@@ -323,6 +581,16 @@ func (k *Kite) OnRegister(handler func(*protocol.RegisterResult)) {
 	k.handlersMu.Unlock()
 }
 
+// OnReRegister registers a callback which is called when a Kite registered
+// with RegisterForever registers again to a Kontrol, after reconnecting to
+// it or after its registration was lost, e.g. when Kontrol's storage was
+// wiped.
+func (k *Kite) OnReRegister(handler func(*protocol.RegisterResult)) {
+	k.handlersMu.Lock()
+	k.onReRegisterHandlers = append(k.onReRegisterHandlers, handler)
+	k.handlersMu.Unlock()
+}
+
 func (k *Kite) callOnConnectHandlers(c *Client) {
 	k.handlersMu.RLock()
 	defer k.handlersMu.RUnlock()
@@ -371,6 +639,18 @@ func (k *Kite) callOnRegisterHandlers(r *protocol.RegisterResult) {
 	}
 }
 
+func (k *Kite) callOnReRegisterHandlers(r *protocol.RegisterResult) {
+	k.handlersMu.RLock()
+	defer k.handlersMu.RUnlock()
+
+	for _, handler := range k.onReRegisterHandlers {
+		func() {
+			defer nopRecover()
+			handler(r)
+		}()
+	}
+}
+
 func (k *Kite) updateAuth(reg *protocol.RegisterResult) {
 	k.configMu.Lock()
 	defer k.configMu.Unlock()
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"strconv"
@@ -542,3 +544,53 @@ func newXhrKite(name, version string) *Kite {
 	k.Config.Transport = config.XHRPolling
 	return k
 }
+
+func TestKite_WrapHTTP(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	k.HandleHTTPFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+
+	var order []string
+
+	wrap := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+
+				if r.Header.Get("X-Block") == name {
+					http.Error(w, "blocked", http.StatusForbidden)
+					return
+				}
+
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	k.WrapHTTP(wrap("first"))
+	k.WrapHTTP(wrap("second"))
+
+	rec := httptest.NewRecorder()
+	k.ServeHTTP(rec, httptest.NewRequest("GET", "/hello", nil))
+
+	if got := rec.Body.String(); got != "hello" {
+		t.Fatalf("got %q, want %q", got, "hello")
+	}
+
+	if want := []string{"first", "second"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("got %v, want %v", order, want)
+	}
+
+	req := httptest.NewRequest("GET", "/kite/websocket", nil)
+	req.Header.Set("X-Block", "second")
+
+	rec = httptest.NewRecorder()
+	k.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,119 @@
+package command
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/kitekey"
+	"github.com/mitchellh/cli"
+)
+
+type Describe struct {
+	KiteClient *kite.Kite
+	Ui         cli.Ui
+}
+
+func NewDescribe() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Describe{
+			KiteClient: DefaultKiteClient,
+			Ui:         DefaultUi,
+		}, nil
+	}
+}
+
+func (c *Describe) Synopsis() string {
+	return "Lists the methods of a kite with their documentation"
+}
+
+func (c *Describe) Help() string {
+	helpText := `
+Usage: kitectl describe [options]
+
+  Lists the methods of a kite with their documentation.
+
+Options:
+
+  -to=URL          URL of the remote kite
+  -timeout=4       Timeout in seconds.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Describe) Run(args []string) int {
+	var to string
+	var timeout time.Duration
+
+	flags := flag.NewFlagSet("describe", flag.ExitOnError)
+	flags.StringVar(&to, "to", "", "URL of remote kite")
+	flags.DurationVar(&timeout, "timeout", 4*time.Second, "timeout of describe method")
+	flags.Parse(args)
+
+	if to == "" {
+		c.Ui.Output(c.Help())
+		return 1
+	}
+
+	key, err := kitekey.Read()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	remote := c.KiteClient.NewClient(to)
+	remote.Auth = &kite.Auth{
+		Type: "kiteKey",
+		Key:  key,
+	}
+
+	if err = remote.Dial(); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	result, err := remote.TellWithTimeout("kite.describe", timeout)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	var docs []*kite.MethodDoc
+	if err := result.Unmarshal(&docs); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	for _, doc := range docs {
+		name := doc.Name
+		if doc.Version != "" {
+			name += "@" + doc.Version
+		}
+
+		if doc.Deprecated {
+			name += " (deprecated"
+			if doc.Replacement != "" {
+				name += ", use " + doc.Replacement
+			}
+			name += ")"
+		}
+
+		c.Ui.Output(name)
+
+		if doc.Description != "" {
+			c.Ui.Output("    " + doc.Description)
+		}
+
+		if len(doc.Example) != 0 {
+			example, err := json.Marshal(doc.Example)
+			if err == nil {
+				c.Ui.Output(fmt.Sprintf("    Example: %s", example))
+			}
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,103 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/koding/kite/kitekey"
+
+	"github.com/mitchellh/cli"
+)
+
+type Fingerprint struct {
+	Ui cli.Ui
+}
+
+func NewFingerprint() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Fingerprint{
+			Ui: DefaultUi,
+		}, nil
+	}
+}
+
+func (c *Fingerprint) Synopsis() string {
+	return "Shows fingerprints of the registration key and kontrol key"
+}
+
+func (c *Fingerprint) Help() string {
+	helpText := `
+Usage: kitectl fingerprint [options]
+
+  Shows fingerprints of the registration key and of the kontrol key
+  it was signed with.
+
+Options:
+
+  -key=kite.key         Path of the registration key, the default is
+                        $KITE_HOME/kite.key.
+  -kontrol-key=key.pem  Shows fingerprint of the given kontrol public key
+                        instead.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Fingerprint) Run(args []string) int {
+	var keyFile, kontrolKeyFile string
+
+	flags := flag.NewFlagSet("fingerprint", flag.ExitOnError)
+	flags.StringVar(&keyFile, "key", "", "Path of the registration key")
+	flags.StringVar(&kontrolKeyFile, "kontrol-key", "", "Path of the kontrol public key")
+	flags.Parse(args)
+
+	if kontrolKeyFile != "" {
+		p, err := ioutil.ReadFile(kontrolKeyFile)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+
+		fp, err := kitekey.PublicKeyFingerprint(string(p))
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+
+		c.Ui.Output(fp)
+		return 0
+	}
+
+	kiteKey, err := readKiteKey(keyFile)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	kontrolKey, err := kitekey.KontrolKeyFingerprint(kiteKey)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	c.Ui.Output(fmt.Sprintf("%-15s%s", "kiteKey", kitekey.Fingerprint(kiteKey)))
+	c.Ui.Output(fmt.Sprintf("%-15s%s", "kontrolKey", kontrolKey))
+
+	return 0
+}
+
+// readKiteKey reads the kite key from the given file, or the default
+// location if file is empty.
+func readKiteKey(file string) (string, error) {
+	if file == "" {
+		return kitekey.Read()
+	}
+
+	p, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(p)), nil
+}
@@ -0,0 +1,89 @@
+package command
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/kitekey"
+
+	"github.com/mitchellh/cli"
+)
+
+type Verifykey struct {
+	KiteClient *kite.Kite
+	Ui         cli.Ui
+}
+
+func NewVerifykey() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &Verifykey{
+			KiteClient: DefaultKiteClient,
+			Ui:         DefaultUi,
+		}, nil
+	}
+}
+
+func (c *Verifykey) Synopsis() string {
+	return "Verifies the registration key against kontrol"
+}
+
+func (c *Verifykey) Help() string {
+	helpText := `
+Usage: kitectl verifykey [options]
+
+  Verifies the registration key is accepted by kontrol and signed
+  with the key kontrol currently uses.
+
+Options:
+
+  -key=kite.key                         Path of the registration key, the
+                                        default is $KITE_HOME/kite.key.
+  -to=https://discovery.koding.io/kite  Kontrol URL, the default is taken
+                                        from the registration key.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *Verifykey) Run(args []string) int {
+	var keyFile, kontrolURL string
+
+	flags := flag.NewFlagSet("verifykey", flag.ExitOnError)
+	flags.StringVar(&keyFile, "key", "", "Path of the registration key")
+	flags.StringVar(&kontrolURL, "to", "", "Kontrol URL")
+	flags.Parse(args)
+
+	kiteKey, err := readKiteKey(keyFile)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	token, err := kitekey.ParseToken(kiteKey)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	conf := config.New()
+	if err := conf.ReadToken(token); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if kontrolURL != "" {
+		conf.KontrolURL = kontrolURL
+	}
+
+	c.KiteClient.Config = conf
+
+	if err := c.KiteClient.VerifyKiteKey(); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	c.Ui.Info("Registration key is valid.")
+
+	return 0
+}
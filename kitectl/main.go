@@ -14,14 +14,17 @@ func main() {
 	c := cli.NewCLI(command.AppName, command.AppVersion)
 	c.Args = os.Args[1:]
 	c.Commands = map[string]cli.CommandFactory{
-		"showkey":   command.NewShowkey(),
-		"register":  command.NewRegister(),
-		"query":     command.NewQuery(),
-		"run":       command.NewRun(),
-		"tell":      command.NewTell(),
-		"uninstall": command.NewUninstall(),
-		"list":      command.NewList(),
-		"install":   command.NewInstall(),
+		"showkey":     command.NewShowkey(),
+		"fingerprint": command.NewFingerprint(),
+		"verifykey":   command.NewVerifykey(),
+		"register":    command.NewRegister(),
+		"query":       command.NewQuery(),
+		"run":         command.NewRun(),
+		"tell":        command.NewTell(),
+		"describe":    command.NewDescribe(),
+		"uninstall":   command.NewUninstall(),
+		"list":        command.NewList(),
+		"install":     command.NewInstall(),
 	}
 
 	_, err := c.Run()
@@ -0,0 +1,292 @@
+// Package kitehttp tunnels HTTP requests over kite connections, so the
+// standard Go HTTP clients can reach the services behind a remote kite:
+//
+//     // The remote kite makes the requests to the allowed hosts.
+//     k.HandleFunc(kitehttp.Method, kitehttp.Handler(kitehttp.Forward("billing.internal")))
+//
+//     // The local kite sends the requests of the HTTP client to it.
+//     client := &http.Client{
+//         Transport: &kitehttp.Transport{Client: c},
+//     }
+//
+//     resp, err := client.Get("http://billing.internal/invoices")
+//
+// The remote kite may serve the requests with any http.Handler instead,
+// e.g. the one of its own HTTP API.
+//
+// The bodies of the requests and of the responses are buffered, so the
+// tunnel is not meant for streaming or for very large bodies, see MaxBodySize.
+package kitehttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+// Method is the default name of the method serving the tunneled requests.
+const Method = "httpProxy"
+
+// MaxBodySize is the default limit of the size of the bodies of
+// the tunneled requests and responses.
+const MaxBodySize = 10 * 1024 * 1024
+
+// ErrBodyTooLarge is returned for the bodies exceeding the limit.
+var ErrBodyTooLarge = errors.New("kitehttp: body too large")
+
+// Request is the argument of the method serving the tunneled requests.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Host   string      `json:"host,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// Response is the result of the method serving the tunneled requests.
+type Response struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+}
+
+// Client sends the requests, it's implemented by *kite.Client and
+// *kite.ClientPool.
+type Client interface {
+	TellWithContext(ctx context.Context, method string, args ...interface{}) (*dnode.Partial, error)
+}
+
+// Transport is an http.RoundTripper, which sends the requests to a remote
+// kite serving them with Handler.
+type Transport struct {
+	// Client is the client of the remote kite.
+	Client Client
+
+	// Method is the method of the remote kite serving the requests.
+	//
+	// When empty, the default value of Method is used.
+	Method string
+
+	// MaxBodySize limits the size of the bodies of the requests.
+	//
+	// When 0, the default value of MaxBodySize is used.
+	MaxBodySize int64
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// RoundTrip implements the http.RoundTripper interface. The context of
+// the request is the one of the call, so the call is canceled with
+// the request.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req.Body, t.maxBodySize())
+	if err != nil {
+		return nil, err
+	}
+
+	method := t.Method
+	if method == "" {
+		method = Method
+	}
+
+	r := &Request{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Host:   req.Host,
+		Header: req.Header,
+		Body:   body,
+	}
+
+	partial, err := t.Client.TellWithContext(req.Context(), method, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response
+	if err := partial.Unmarshal(&resp); err != nil {
+		return nil, err
+	}
+
+	header := resp.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(resp.StatusCode) + " " + http.StatusText(resp.StatusCode),
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *Transport) maxBodySize() int64 {
+	if t.MaxBodySize > 0 {
+		return t.MaxBodySize
+	}
+
+	return MaxBodySize
+}
+
+// readBody reads and closes the body, which may be nil.
+func readBody(body io.ReadCloser, max int64) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+	defer body.Close()
+
+	p, err := ioutil.ReadAll(io.LimitReader(body, max+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(p)) > max {
+		return nil, ErrBodyTooLarge
+	}
+
+	return p, nil
+}
+
+// Forward returns an http.Handler, which makes the requests to their URLs,
+// for serving the requests of the Transports with Handler. Only the hosts
+// of the URLs matching the allowed ones are reached, the other requests are
+// rejected with the 403 Forbidden status.
+//
+// The allowed hosts are host names, which match the URLs with any port,
+// or "host:port" pairs. They can be patterns with the syntax of path.Match,
+// e.g. "*.internal". The hosts are compared case-insensitively.
+func Forward(allowed ...string) http.Handler {
+	proxy := &httputil.ReverseProxy{
+		Director: func(*http.Request) {},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !allowedHost(allowed, req.URL.Host) {
+			http.Error(w, fmt.Sprintf("host %q is not allowed", req.URL.Host), http.StatusForbidden)
+			return
+		}
+
+		proxy.ServeHTTP(w, req)
+	})
+}
+
+// allowedHost tells whether the host, with an optional port, matches any of
+// the allowed ones.
+func allowedHost(allowed []string, host string) bool {
+	host = strings.ToLower(host)
+
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Handler returns a handler of the method serving the tunneled requests
+// with h. The request is canceled when the call is, and the response
+// bodies larger than MaxBodySize are rejected.
+func Handler(h http.Handler) kite.HandlerFunc {
+	return func(r *kite.Request) (interface{}, error) {
+		var args Request
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(args.Method, args.URL, bytes.NewReader(args.Body))
+		if err != nil {
+			return nil, &kite.Error{
+				Type:    "argumentError",
+				Message: err.Error(),
+			}
+		}
+
+		if args.Header != nil {
+			req.Header = args.Header
+		}
+
+		if args.Host != "" {
+			req.Host = args.Host
+		}
+
+		if r.Context != nil {
+			req = req.WithContext(r.Context)
+		}
+
+		w := &responseWriter{header: make(http.Header)}
+
+		h.ServeHTTP(w, req)
+
+		if w.overflow {
+			return nil, fmt.Errorf("%s: %s", ErrBodyTooLarge, args.URL)
+		}
+
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+
+		return &Response{
+			StatusCode: w.status,
+			Header:     w.header,
+			Body:       w.body.Bytes(),
+		}, nil
+	}
+}
+
+// responseWriter buffers the response of a handler.
+type responseWriter struct {
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+
+	if w.body.Len()+len(p) > MaxBodySize {
+		w.overflow = true
+		return 0, ErrBodyTooLarge
+	}
+
+	return w.body.Write(p)
+}
@@ -0,0 +1,158 @@
+package kitehttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/kitehttp"
+)
+
+// client calls the handler in process, the way it's called by the remote
+// kite.
+type client struct {
+	handler kite.HandlerFunc
+}
+
+func (c *client) TellWithContext(ctx context.Context, method string, args ...interface{}) (*dnode.Partial, error) {
+	if method != kitehttp.Method {
+		return nil, &kite.Error{Type: "methodNotFound"}
+	}
+
+	p, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.handler(&kite.Request{
+		Method:  method,
+		Args:    &dnode.Partial{Raw: p},
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if p, err = json.Marshal(result); err != nil {
+		return nil, err
+	}
+
+	return &dnode.Partial{Raw: p}, nil
+}
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		w.Header().Set("X-Echo", r.Header.Get("X-Request"))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.Path, body)
+	}))
+	defer srv.Close()
+
+	c := &http.Client{
+		Transport: &kitehttp.Transport{
+			Client: &client{handler: kitehttp.Handler(kitehttp.Forward(srv.Listener.Addr().String()))},
+		},
+	}
+
+	req, err := http.NewRequest("POST", srv.URL+"/items", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("NewRequest()=%s", err)
+	}
+
+	req.Header.Set("X-Request", "42")
+
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Do()=%s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll()=%s", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("got %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+
+	if got := resp.Header.Get("X-Echo"); got != "42" {
+		t.Errorf("got %q, want %q", got, "42")
+	}
+
+	if got, want := string(body), "POST /items hello"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestForward(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	cases := map[string]int{
+		"127.0.0.1":                  http.StatusOK,
+		"127.0.0.*":                  http.StatusOK,
+		srv.Listener.Addr().String(): http.StatusOK,
+		"127.0.0.1:1":                http.StatusForbidden,
+		"example.com":                http.StatusForbidden,
+	}
+
+	for allowed, want := range cases {
+		c := &http.Client{
+			Transport: &kitehttp.Transport{
+				Client: &client{handler: kitehttp.Handler(kitehttp.Forward(allowed))},
+			},
+		}
+
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("%s: Get()=%s", allowed, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != want {
+			t.Errorf("%s: got %d, want %d", allowed, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestTransport_MaxBodySize(t *testing.T) {
+	tr := &kitehttp.Transport{
+		Client:      &client{handler: kitehttp.Handler(http.NotFoundHandler())},
+		MaxBodySize: 4,
+	}
+
+	req, err := http.NewRequest("PUT", "http://example.com/", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("NewRequest()=%s", err)
+	}
+
+	if _, err := tr.RoundTrip(req); err != kitehttp.ErrBodyTooLarge {
+		t.Fatalf("got %v, want %v", err, kitehttp.ErrBodyTooLarge)
+	}
+
+	req, err = http.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatalf("NewRequest()=%s", err)
+	}
+
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip()=%s", err)
+	}
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("got %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
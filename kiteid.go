@@ -0,0 +1,43 @@
+package kite
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/koding/kite/config"
+	uuid "github.com/satori/go.uuid"
+)
+
+// NewKiteID generates the ID of a new kite with the given name, it may be
+// replaced before the kite is created to generate IDs differently. The
+// default one returns Config.KiteID, if set, the StableKiteID when
+// Config.StableID is set or a random UUID otherwise.
+var NewKiteID = func(name string, cfg *config.Config) string {
+	switch {
+	case cfg.KiteID != "":
+		return cfg.KiteID
+	case cfg.StableID:
+		return StableKiteID(name, cfg)
+	default:
+		return uuid.NewV4().String()
+	}
+}
+
+// StableKiteID derives the ID of the kite with the given name from the ID
+// of its kite key, the hostname and the port of the kite server, as well
+// as from the username, environment and region of the kite. The same
+// kite gets the same ID after restarting, as long as it listens on a fixed
+// port, while kites on other hosts or ports get different ones.
+func StableKiteID(name string, cfg *config.Config) string {
+	identity := strings.Join([]string{
+		cfg.Id, // ID of the kite key
+		cfg.Username,
+		cfg.Environment,
+		name,
+		cfg.Region,
+		hostname,
+		strconv.Itoa(cfg.Port),
+	}, "\n")
+
+	return uuid.NewV5(uuid.NamespaceOID, identity).String()
+}
@@ -0,0 +1,41 @@
+package kite
+
+import (
+	"testing"
+
+	"github.com/koding/kite/config"
+)
+
+func TestNewKiteID(t *testing.T) {
+	conf := config.New()
+
+	if a, b := NewWithConfig("kite", "0.0.1", conf).Id, NewWithConfig("kite", "0.0.1", conf).Id; a == b {
+		t.Fatalf("want random IDs, got %q twice", a)
+	}
+
+	conf.StableID = true
+	conf.Port = 4000
+	conf.Id = "key-id"
+
+	stable := NewWithConfig("kite", "0.0.1", conf).Id
+
+	if id := NewWithConfig("kite", "0.0.1", conf.Copy()).Id; id != stable {
+		t.Fatalf("want stable ID %q, got %q", stable, id)
+	}
+
+	if id := NewWithConfig("other", "0.0.1", conf).Id; id == stable {
+		t.Fatalf("want different ID for other kite, got %q", id)
+	}
+
+	conf.Port = 4001
+
+	if id := NewWithConfig("kite", "0.0.1", conf).Id; id == stable {
+		t.Fatalf("want different ID for other port, got %q", id)
+	}
+
+	conf.KiteID = "my-kite"
+
+	if id := NewWithConfig("kite", "0.0.1", conf).Kite().ID; id != "my-kite" {
+		t.Fatalf("want %q, got %q", "my-kite", id)
+	}
+}
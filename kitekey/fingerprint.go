@@ -0,0 +1,46 @@
+package kitekey
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Fingerprint returns the hex-encoded SHA-256 checksum of the kite key,
+// which is how kites identify their keys, see kite.Identity.
+func Fingerprint(kiteKey string) string {
+	sum := sha256.Sum256([]byte(kiteKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// PublicKeyFingerprint returns the hex-encoded SHA-256 checksum of the
+// DER encoding of the PEM-encoded RSA public key, like the kontrolKey claim
+// of kite keys. Unlike a checksum of the PEM text, it does not depend on
+// formatting of the key.
+func PublicKeyFingerprint(publicKey string) (string, error) {
+	key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKey))
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// KontrolKeyFingerprint returns the fingerprint of the Kontrol public key
+// embedded in the kontrolKey claim of the given kite key.
+func KontrolKeyFingerprint(kiteKey string) (string, error) {
+	token, err := ParseToken(kiteKey)
+	if err != nil {
+		return "", err
+	}
+
+	return PublicKeyFingerprint(token.Claims.(*KiteClaims).KontrolKey)
+}
@@ -0,0 +1,64 @@
+package kitekey
+
+import (
+	"testing"
+
+	"github.com/koding/kite/testkeys"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestPublicKeyFingerprint(t *testing.T) {
+	fp, err := PublicKeyFingerprint(testkeys.Public)
+	if err != nil {
+		t.Fatalf("PublicKeyFingerprint()=%s", err)
+	}
+
+	if len(fp) != 64 {
+		t.Fatalf("got %q, want hex-encoded SHA-256 checksum", fp)
+	}
+
+	// The fingerprint must not depend on formatting of the PEM text.
+	fp2, err := PublicKeyFingerprint("\n" + testkeys.Public + "\n\n")
+	if err != nil {
+		t.Fatalf("PublicKeyFingerprint()=%s", err)
+	}
+
+	if fp != fp2 {
+		t.Fatalf("got %q, want %q", fp2, fp)
+	}
+
+	if _, err := PublicKeyFingerprint("invalid"); err == nil {
+		t.Fatal("want error for invalid key")
+	}
+
+	rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(testkeys.Private))
+	if err != nil {
+		t.Fatalf("ParseRSAPrivateKeyFromPEM()=%s", err)
+	}
+
+	claims := &KiteClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject: "testuser",
+		},
+		KontrolKey: testkeys.Public,
+	}
+
+	kiteKey, err := jwt.NewWithClaims(jwt.GetSigningMethod("RS256"), claims).SignedString(rsaKey)
+	if err != nil {
+		t.Fatalf("SignedString()=%s", err)
+	}
+
+	got, err := KontrolKeyFingerprint(kiteKey)
+	if err != nil {
+		t.Fatalf("KontrolKeyFingerprint()=%s", err)
+	}
+
+	if got != fp {
+		t.Fatalf("got %q, want %q", got, fp)
+	}
+
+	if Fingerprint(kiteKey) == Fingerprint(kiteKey+"x") {
+		t.Fatal("want different fingerprints for different keys")
+	}
+}
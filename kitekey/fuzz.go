@@ -0,0 +1,16 @@
+//go:build gofuzz
+// +build gofuzz
+
+package kitekey
+
+// FuzzToken is an entry point for go-fuzz, build it with:
+//
+//     go-fuzz-build -func FuzzToken github.com/koding/kite/kitekey
+//
+func FuzzToken(data []byte) int {
+	if _, err := ParseToken(string(data)); err != nil {
+		return 0
+	}
+
+	return 1
+}
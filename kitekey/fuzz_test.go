@@ -0,0 +1,17 @@
+//go:build go1.18
+// +build go1.18
+
+package kitekey
+
+import "testing"
+
+func FuzzParseToken(f *testing.F) {
+	f.Add("")
+	f.Add("a.b.c")
+	f.Add("eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.eyJrb250cm9sS2V5IjoiLS0tLS1CRUdJTiBQVUJMSUMgS0VZLS0tLS0ifQ.c2ln")
+	f.Add("eyJhbGciOiJub25lIn0.eyJzdWIiOjF9.")
+
+	f.Fuzz(func(t *testing.T, kiteKey string) {
+		ParseToken(kiteKey)
+	})
+}
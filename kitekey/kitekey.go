@@ -24,6 +24,15 @@ type KiteClaims struct {
 	jwt.StandardClaims
 	KontrolKey string `json:"kontrolKey,omitempty"`
 	KontrolURL string `json:"kontrolURL,omitempty"`
+	Tenant     string `json:"tenant,omitempty"`
+
+	// Actor is the username of the kite acting on behalf of the subject,
+	// it is set only for delegate tokens.
+	Actor string `json:"act,omitempty"`
+
+	// Ephemeral is true for short-lived kite keys, the registrations of
+	// kites using them are removed when the key expires.
+	Ephemeral bool `json:"eph,omitempty"`
 }
 
 // KiteHome returns the home path of Kite directory.
@@ -49,7 +58,13 @@ func kiteKeyPath() (string, error) {
 }
 
 // Read the contents of the kite.key file.
+// The file is not read if the key is given with KITE_KEY environment
+// variable, which is how ephemeral kites get their keys.
 func Read() (string, error) {
+	if key := os.Getenv("KITE_KEY"); key != "" {
+		return strings.TrimSpace(key), nil
+	}
+
 	keyPath, err := kiteKeyPath()
 	if err != nil {
 		return "", err
@@ -87,7 +102,7 @@ func Parse() (*jwt.Token, error) {
 		return nil, err
 	}
 
-	return jwt.ParseWithClaims(kiteKey, &KiteClaims{}, GetKontrolKey)
+	return ParseToken(kiteKey)
 }
 
 // ParseFile reads the given kite key file and parses it as a JWT token.
@@ -97,7 +112,13 @@ func ParseFile(file string) (*jwt.Token, error) {
 		return nil, err
 	}
 
-	return jwt.ParseWithClaims(string(bytes.TrimSpace(kiteKey)), &KiteClaims{}, GetKontrolKey)
+	return ParseToken(string(bytes.TrimSpace(kiteKey)))
+}
+
+// ParseToken parses the given kite key as JWT token, the signature is
+// validated with the kontrol key, embedded in the kontrolKey claim.
+func ParseToken(kiteKey string) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(kiteKey, &KiteClaims{}, GetKontrolKey)
 }
 
 // Extractor is used to extract kontrol key from JWT token.
@@ -0,0 +1,80 @@
+package kite
+
+import (
+	"fmt"
+
+	"github.com/koding/kite/kitekey"
+)
+
+// KiteKeyPolicy decides whether the caller authenticated with the kite key,
+// which has the given verified claims, is trusted. It returns a non-nil
+// error if it is not, see Kite.KiteKeyPolicy.
+type KiteKeyPolicy func(r *Request, claims *kitekey.KiteClaims) error
+
+// AllowSameUsername returns a KiteKeyPolicy trusting the kite keys of
+// the owner of the kite only.
+func AllowSameUsername() KiteKeyPolicy {
+	return func(r *Request, claims *kitekey.KiteClaims) error {
+		if claims.Subject != r.LocalKite.Config.Username {
+			return fmt.Errorf("kite key of %q is not trusted", claims.Subject)
+		}
+
+		return nil
+	}
+}
+
+// AllowUsernames returns a KiteKeyPolicy trusting the kite keys of the given
+// users, e.g. the members of a team.
+func AllowUsernames(usernames ...string) KiteKeyPolicy {
+	allowed := make(map[string]struct{}, len(usernames))
+	for _, username := range usernames {
+		allowed[username] = struct{}{}
+	}
+
+	return func(r *Request, claims *kitekey.KiteClaims) error {
+		if _, ok := allowed[claims.Subject]; !ok {
+			return fmt.Errorf("kite key of %q is not trusted", claims.Subject)
+		}
+
+		return nil
+	}
+}
+
+// AllowIssuers returns a KiteKeyPolicy trusting the kite keys issued by
+// the given Kontrol users, e.g. the Kontrols of the environments, which
+// kites can call each other.
+func AllowIssuers(issuers ...string) KiteKeyPolicy {
+	allowed := make(map[string]struct{}, len(issuers))
+	for _, issuer := range issuers {
+		allowed[issuer] = struct{}{}
+	}
+
+	return func(r *Request, claims *kitekey.KiteClaims) error {
+		if _, ok := allowed[claims.Issuer]; !ok {
+			return fmt.Errorf("kite key issued by %q is not trusted", claims.Issuer)
+		}
+
+		return nil
+	}
+}
+
+// AnyPolicy returns a KiteKeyPolicy trusting the kite keys trusted by any of
+// the given policies:
+//
+//     k.KiteKeyPolicy = kite.AnyPolicy(
+//         kite.AllowUsernames("alice", "bob"),
+//         kite.AllowIssuers("kontrol-staging"),
+//     )
+func AnyPolicy(policies ...KiteKeyPolicy) KiteKeyPolicy {
+	return func(r *Request, claims *kitekey.KiteClaims) error {
+		err := fmt.Errorf("kite key of %q is not trusted", claims.Subject)
+
+		for _, policy := range policies {
+			if err = policy(r, claims); err == nil {
+				return nil
+			}
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,78 @@
+package kite
+
+import (
+	"testing"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/testkeys"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestKite_KiteKeyPolicy(t *testing.T) {
+	conf := config.New()
+	conf.Username = "devrim"
+	conf.KontrolKey = testkeys.Public
+
+	k := NewWithConfig("policy", "0.0.1", conf)
+	defer k.Close()
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(testkeys.Private))
+	if err != nil {
+		t.Fatalf("ParseRSAPrivateKeyFromPEM()=%s", err)
+	}
+
+	request := func(issuer, username string) *Request {
+		claims := &kitekey.KiteClaims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:  issuer,
+				Subject: username,
+			},
+			KontrolKey: testkeys.Public,
+		}
+
+		s, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("SignedString()=%s", err)
+		}
+
+		return &Request{
+			LocalKite: k,
+			Auth:      &Auth{Type: "kiteKey", Key: s},
+		}
+	}
+
+	cases := []struct {
+		policy   KiteKeyPolicy
+		issuer   string
+		username string
+		ok       bool
+	}{
+		{nil, "kontrol", "alice", true},
+		{AllowSameUsername(), "kontrol", "devrim", true},
+		{AllowSameUsername(), "kontrol", "alice", false},
+		{AllowUsernames("alice", "bob"), "kontrol", "bob", true},
+		{AllowUsernames("alice", "bob"), "kontrol", "mallory", false},
+		{AllowIssuers("kontrol-staging"), "kontrol-staging", "mallory", true},
+		{AllowIssuers("kontrol-staging"), "kontrol", "mallory", false},
+		{AnyPolicy(AllowUsernames("alice"), AllowIssuers("kontrol-staging")), "kontrol-staging", "mallory", true},
+		{AnyPolicy(AllowUsernames("alice"), AllowIssuers("kontrol-staging")), "kontrol", "alice", true},
+		{AnyPolicy(AllowUsernames("alice"), AllowIssuers("kontrol-staging")), "kontrol", "mallory", false},
+	}
+
+	for i, cas := range cases {
+		k.KiteKeyPolicy = cas.policy
+
+		r := request(cas.issuer, cas.username)
+
+		err := k.AuthenticateFromKiteKey(r)
+		if (err == nil) != cas.ok {
+			t.Errorf("%d: got %v, want ok=%t", i, err, cas.ok)
+		}
+
+		if err == nil && r.Username != cas.username {
+			t.Errorf("%d: got %q, want %q", i, r.Username, cas.username)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Package kiteplugin loads kite modules from Go plugins.
+//
+// A plugin is a main package built with -buildmode=plugin, which registers
+// its modules in an init function:
+//
+//     func init() {
+//         kite.RegisterModule("terminal", func(k *kite.Kite) error {
+//             k.HandleFunc("terminal.connect", connect)
+//             return nil
+//         })
+//     }
+//
+// Once the plugins are opened, the modules are enabled the same way the
+// built-in ones are, with Config.Modules and Kite.LoadModules.
+//
+// Go plugins are supported only on some platforms and require cgo, which is
+// why the loading lives in a separate package.
+package kiteplugin
+
+import (
+	"fmt"
+	"path/filepath"
+	"plugin"
+
+	"github.com/koding/kite"
+)
+
+// Open opens the plugins with the given paths, registering their modules.
+func Open(paths ...string) error {
+	for _, path := range paths {
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("kiteplugin: opening %s failed: %s", path, err)
+		}
+	}
+
+	return nil
+}
+
+// OpenDir opens all the plugins with the ".so" extension in the given
+// directory.
+func OpenDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return err
+	}
+
+	return Open(paths...)
+}
+
+// Load opens all the plugins in the given directory and loads the modules
+// enabled in the kite's Config.Modules.
+func Load(k *kite.Kite, dir string) error {
+	if err := OpenDir(dir); err != nil {
+		return err
+	}
+
+	return k.LoadModules()
+}
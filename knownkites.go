@@ -0,0 +1,244 @@
+package kite
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/koding/kite/kitekey"
+)
+
+// KnownKites is a file of the identities of the kites per URL, like the
+// known_hosts file of SSH. The identity of a kite is trusted the first
+// time a client connects to its URL and recorded, so the following
+// connections, also the ones made by other processes, verify the kite at
+// the URL has the same ID, kite key and host key:
+//
+//     known, err := kite.NewKnownKites("")
+//     if err != nil {
+//         return err
+//     }
+//
+//     known.Prompt = func(err *kite.IdentityError) bool {
+//         fmt.Printf("WARNING: %s\nTrust the new identity? [y/N] ", err)
+//         var answer string
+//         fmt.Scanln(&answer)
+//         return answer == "y"
+//     }
+//
+//     k.KnownKites = known
+//
+// Only the identities the kites proved with their host keys are recorded,
+// see Client.Identity. Dialing a recorded kite, which fails to prove its
+// identity, fails with an *IdentityError.
+//
+// Each line of the file holds the URL, the ID, the kite key fingerprint and
+// the host key fingerprint of a kite, separated with spaces. The kite key
+// fingerprint is "-" for the kites without a kite key. Empty lines and
+// lines starting with "#" are ignored.
+type KnownKites struct {
+	// Prompt is called when a kite presents an identity other than
+	// the recorded one. If it returns true, the new identity is trusted
+	// and replaces the recorded one, otherwise the connection is closed
+	// with the error, like for the identities pinned by the clients.
+	//
+	// If nil, the kites with changed identities are rejected, they can be
+	// trusted again with Remove.
+	Prompt func(err *IdentityError) bool
+
+	path string
+
+	mu    sync.Mutex
+	kites map[string]*Identity
+}
+
+// NewKnownKites reads the known kites from the file at path, which is
+// created when the first kite is recorded. If the path is empty,
+// $KITE_HOME/known_kites is used.
+func NewKnownKites(path string) (*KnownKites, error) {
+	if path == "" {
+		kiteHome, err := kitekey.KiteHome()
+		if err != nil {
+			return nil, err
+		}
+
+		path = filepath.Join(kiteHome, "known_kites")
+	}
+
+	kk := &KnownKites{
+		path:  path,
+		kites: make(map[string]*Identity),
+	}
+
+	p, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return kk, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(p))
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("kite: invalid line %d of %s", n, path)
+		}
+
+		id := &Identity{
+			HostKeyFingerprint: fields[3],
+		}
+		id.Kite.ID = fields[1]
+
+		if fields[2] != "-" {
+			id.KeyFingerprint = fields[2]
+		}
+
+		kk.kites[fields[0]] = id
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return kk, nil
+}
+
+// Path returns the path of the file.
+func (kk *KnownKites) Path() string {
+	return kk.path
+}
+
+// Get returns the known identity of the kite at the URL, or nil if there
+// is none.
+func (kk *KnownKites) Get(url string) *Identity {
+	kk.mu.Lock()
+	defer kk.mu.Unlock()
+
+	return kk.kites[url]
+}
+
+// Add records the identity of the kite at the URL, replacing the known one.
+func (kk *KnownKites) Add(url string, id *Identity) error {
+	kk.mu.Lock()
+	defer kk.mu.Unlock()
+
+	kk.kites[url] = &Identity{
+		Kite:               id.Kite,
+		KeyFingerprint:     id.KeyFingerprint,
+		HostKeyFingerprint: id.HostKeyFingerprint,
+	}
+
+	return kk.write()
+}
+
+// Remove forgets the identity of the kite at the URL, so the next kite
+// connected to at the URL is trusted.
+func (kk *KnownKites) Remove(url string) error {
+	kk.mu.Lock()
+	defer kk.mu.Unlock()
+
+	if _, ok := kk.kites[url]; !ok {
+		return nil
+	}
+
+	delete(kk.kites, url)
+
+	return kk.write()
+}
+
+// write replaces the file with the known kites atomically, so it's never
+// left half-written.
+func (kk *KnownKites) write() error {
+	urls := make([]string, 0, len(kk.kites))
+	for url := range kk.kites {
+		urls = append(urls, url)
+	}
+
+	sort.Strings(urls)
+
+	var buf bytes.Buffer
+	for _, url := range urls {
+		id := kk.kites[url]
+
+		fingerprint := id.KeyFingerprint
+		if fingerprint == "" {
+			fingerprint = "-"
+		}
+
+		fmt.Fprintf(&buf, "%s %s %s %s\n", url, id.Kite.ID, fingerprint, id.HostKeyFingerprint)
+	}
+
+	dir := filepath.Dir(kk.path)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, ".known_kites")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := os.Rename(f.Name(), kk.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
+
+// verify checks the identity of the kite at the URL against the known one,
+// recording it if there is none. The identity must be the one the kite
+// proved with its host key. It returns an IdentityError if the identity
+// has changed and was not trusted with Prompt, and the error of recording
+// the identity, if any.
+func (kk *KnownKites) verify(url string, got *Identity) (*IdentityError, error) {
+	if got.HostKeyFingerprint == "" {
+		return nil, errors.New("kite: recording identity without host key")
+	}
+
+	known := kk.Get(url)
+
+	if known != nil && got.matches(known) {
+		return nil, nil
+	}
+
+	if known != nil {
+		err := &IdentityError{
+			URL:    url,
+			Pinned: known,
+			Got:    got,
+		}
+
+		if kk.Prompt == nil || !kk.Prompt(err) {
+			return err, nil
+		}
+	}
+
+	return nil, kk.Add(url, got)
+}
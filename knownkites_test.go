@@ -0,0 +1,118 @@
+package kite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKnownKites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knownkites")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "kite", "known_kites")
+
+	kk, err := NewKnownKites(path)
+	if err != nil {
+		t.Fatalf("NewKnownKites()=%s", err)
+	}
+
+	const url = "http://localhost:3636/kite"
+
+	first := &Identity{KeyFingerprint: "aaaa", HostKeyFingerprint: "1111"}
+	first.Kite.ID = "first"
+
+	second := &Identity{HostKeyFingerprint: "2222"}
+	second.Kite.ID = "second"
+
+	// Only the identities proven with host keys are recorded.
+	if _, err := kk.verify(url, &Identity{KeyFingerprint: "aaaa"}); err == nil {
+		t.Fatal("verify(): want error")
+	}
+
+	if id := kk.Get(url); id != nil {
+		t.Fatalf("got %+v, want nil", id)
+	}
+
+	// The first identity is trusted and recorded.
+	if idErr, err := kk.verify(url, first); idErr != nil || err != nil {
+		t.Fatalf("verify()=%v, %v", idErr, err)
+	}
+
+	if idErr, err := kk.verify(url, first); idErr != nil || err != nil {
+		t.Fatalf("verify()=%v, %v", idErr, err)
+	}
+
+	// The identities are read by other processes.
+	kk, err = NewKnownKites(path)
+	if err != nil {
+		t.Fatalf("NewKnownKites()=%s", err)
+	}
+
+	if id := kk.Get(url); id == nil || !id.matches(first) {
+		t.Fatalf("got %+v, want first identity", id)
+	}
+
+	idErr, err := kk.verify(url, second)
+	if err != nil {
+		t.Fatalf("verify()=%s", err)
+	}
+
+	if idErr == nil || idErr.Pinned.Kite.ID != "first" || idErr.Got.Kite.ID != "second" {
+		t.Fatalf("got %v, want identity error", idErr)
+	}
+
+	// The changed identity is trusted with the prompt.
+	var prompted *IdentityError
+	kk.Prompt = func(err *IdentityError) bool {
+		prompted = err
+		return true
+	}
+
+	if idErr, err := kk.verify(url, second); idErr != nil || err != nil {
+		t.Fatalf("verify()=%v, %v", idErr, err)
+	}
+
+	if prompted == nil {
+		t.Fatal("prompt was not called")
+	}
+
+	kk, err = NewKnownKites(path)
+	if err != nil {
+		t.Fatalf("NewKnownKites()=%s", err)
+	}
+
+	if id := kk.Get(url); id == nil || !id.matches(second) {
+		t.Fatalf("got %+v, want second identity", id)
+	}
+
+	if err := kk.Remove(url); err != nil {
+		t.Fatalf("Remove()=%s", err)
+	}
+
+	if idErr, err := kk.verify(url, first); idErr != nil || err != nil {
+		t.Fatalf("verify()=%v, %v", idErr, err)
+	}
+
+	// The host key of the same kite is verified too.
+	impostor := &Identity{KeyFingerprint: "aaaa", HostKeyFingerprint: "3333"}
+	impostor.Kite.ID = "first"
+
+	kk.Prompt = nil
+
+	if idErr, err := kk.verify(url, impostor); idErr == nil || err != nil {
+		t.Fatalf("verify()=%v, %v, want identity error", idErr, err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("# comment\n\n"+url+" first aaaa\n"), 0600); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	if _, err := NewKnownKites(path); err == nil {
+		t.Fatal("NewKnownKites(): want error")
+	}
+}
@@ -38,6 +38,7 @@ CREATE UNLOGGED TABLE "kite"."kite" (
     created_at timestamptz NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'), -- you may set a global timezone
     updated_at timestamptz NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
     key_id UUID NOT NULL,
+    color TEXT NOT NULL DEFAULT '', -- deployment color the kite registered with
 
     CONSTRAINT "kite_key_id_fkey" FOREIGN KEY ("key_id") REFERENCES kite.key (id) ON UPDATE NO ACTION ON DELETE NO ACTION NOT DEFERRABLE INITIALLY IMMEDIATE
 );
@@ -50,3 +51,14 @@ DROP INDEX IF EXISTS kite_updated_at_btree_idx;
 
 CREATE INDEX kite_updated_at_btree_idx ON "kite"."kite" USING BTREE (updated_at DESC);
 
+
+--
+-- create color table for storing active colors of services
+--
+CREATE TABLE IF NOT EXISTS "kite"."color" (
+    service TEXT PRIMARY KEY, -- in the form of /username/environment/kitename
+    color TEXT NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC')
+);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON "kite"."color" TO "kontrol";
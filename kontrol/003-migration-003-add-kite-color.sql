@@ -0,0 +1,21 @@
+-- add color column into kite table
+DO $$
+  BEGIN
+    BEGIN
+      ALTER TABLE kite.kite ADD COLUMN "color" TEXT NOT NULL DEFAULT '';
+    EXCEPTION
+      WHEN duplicate_column THEN RAISE NOTICE 'color column already exists';
+    END;
+  END;
+$$;
+
+--
+-- create color table for storing active colors of services
+--
+CREATE TABLE IF NOT EXISTS "kite"."color" (
+    service TEXT PRIMARY KEY, -- in the form of /username/environment/kitename
+    color TEXT NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC')
+);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON "kite"."color" TO "kontrol";
@@ -0,0 +1,9 @@
+--
+-- create revoked table for storing the revoked tokens until they expire
+--
+CREATE TABLE IF NOT EXISTS "kite"."revoked" (
+    id TEXT PRIMARY KEY, -- the jti claim of the token
+    expires_at timestamptz NOT NULL
+);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON "kite"."revoked" TO "kontrol";
@@ -0,0 +1,189 @@
+package kontrol
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+)
+
+// HandleBroadcast delivers a message to all kites matching the query, by
+// calling the given method on each of them. It is meant for fleet-wide
+// commands, like "upgrade now".
+//
+// The message is delivered on behalf of the requester, so the kites
+// authenticate and authorize it as if the requester called them directly.
+// The requester can broadcast only to its own kites, unless it's the owner
+// of Kontrol. Kites which can't be reached are retried, up to
+// BroadcastMaxRetries times. The response contains a delivery receipt for
+// each of the kites.
+func (k *Kontrol) HandleBroadcast(r *kite.Request) (interface{}, error) {
+	var args protocol.BroadcastArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if args.Query == nil {
+		return nil, errors.New("empty query")
+	}
+
+	if args.Method == "" {
+		return nil, errors.New("empty method")
+	}
+
+	if args.Query.Username == "" {
+		args.Query.Username = r.Username
+	}
+
+	if args.Query.Username != r.Username && r.Username != k.Kite.Kite().Username {
+		return nil, fmt.Errorf("not allowed to broadcast to the kites of %q", args.Query.Username)
+	}
+
+	if args.Timeout <= 0 {
+		args.Timeout = k.Kite.Config.Timeout
+	}
+
+	if args.Timeout > BroadcastMaxTimeout {
+		args.Timeout = BroadcastMaxTimeout
+	}
+
+	if args.Retries > BroadcastMaxRetries {
+		args.Retries = BroadcastMaxRetries
+	}
+
+	if args.RetryInterval <= 0 {
+		args.RetryInterval = time.Second
+	}
+
+	kites, err := k.storage.Get(args.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	k.log.Info("Broadcasting %q from %q to %d kites", args.Method, r.Username, len(kites))
+
+	receipts := make([]*protocol.BroadcastReceipt, len(kites))
+	sem := make(chan struct{}, BroadcastConcurrency)
+
+	var wg sync.WaitGroup
+
+	for i, kt := range kites {
+		wg.Add(1)
+
+		go func(i int, kt *protocol.KiteWithToken) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			receipts[i] = k.deliver(r, &args, kt)
+			<-sem
+		}(i, kt)
+	}
+
+	wg.Wait()
+
+	delivered := 0
+	for _, receipt := range receipts {
+		if receipt.Delivered {
+			delivered++
+		}
+	}
+
+	k.log.Info("Broadcast of %q from %q delivered to %d/%d kites", args.Method, r.Username, delivered, len(kites))
+
+	return &protocol.BroadcastResult{
+		Receipts: receipts,
+	}, nil
+}
+
+// deliver calls the broadcast method on the given kite, retrying when
+// the kite is unreachable.
+func (k *Kontrol) deliver(r *kite.Request, args *protocol.BroadcastArgs, kt *protocol.KiteWithToken) *protocol.BroadcastReceipt {
+	receipt := &protocol.BroadcastReceipt{
+		Kite: kt.Kite,
+	}
+
+	keyPair, err := k.getOrUpdateKeyID(kt.KeyID, r)
+	if err != nil {
+		receipt.Error = err.Error()
+		return receipt
+	}
+
+	tkn, err := k.generateToken(&token{
+		audience: getAudience(kt.Kite.Query()),
+		username: r.Username,
+		tenant:   r.Tenant,
+		issuer:   k.Kite.Kite().Username,
+		keyPair:  keyPair,
+	})
+	if err != nil {
+		receipt.Error = err.Error()
+		return receipt
+	}
+
+	for {
+		receipt.Attempts++
+
+		err := k.deliverOnce(kt.URL, tkn, args)
+		if err == nil {
+			receipt.Delivered = true
+			receipt.Error = ""
+			return receipt
+		}
+
+		receipt.Error = err.Error()
+
+		if !isUnreachable(err) || receipt.Attempts > args.Retries {
+			return receipt
+		}
+
+		k.log.Debug("Broadcast of %q to %s failed, retrying: %s", args.Method, &kt.Kite, err)
+
+		select {
+		case <-k.closed:
+			return receipt
+		case <-time.After(args.RetryInterval):
+		}
+	}
+}
+
+func (k *Kontrol) deliverOnce(url, tkn string, args *protocol.BroadcastArgs) error {
+	c := k.Kite.NewClient(url)
+	c.Auth = &kite.Auth{
+		Type: "token",
+		Key:  tkn,
+	}
+	defer c.Close()
+
+	if err := c.DialTimeout(args.Timeout); err != nil {
+		return err
+	}
+
+	var withArgs []interface{}
+	if len(args.Args) != 0 {
+		withArgs = append(withArgs, args.Args)
+	}
+
+	_, err := c.TellWithTimeout(args.Method, args.Timeout, withArgs...)
+
+	return err
+}
+
+// isUnreachable tells whether the delivery failed because the kite could
+// not be reached, as opposed to the kite replying with an error.
+func isUnreachable(err error) bool {
+	e, ok := err.(*kite.Error)
+	if !ok {
+		return true // dial error
+	}
+
+	switch e.Type {
+	case "timeout", "disconnect", "sendError":
+		return true
+	}
+
+	return false
+}
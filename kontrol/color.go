@@ -0,0 +1,192 @@
+package kontrol
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+)
+
+// ErrColorChanged is returned by ColorStorage.SetColor when the active color
+// of a service is not the expected previous one.
+var ErrColorChanged = errors.New("active color was changed concurrently")
+
+// ColorStorage keeps the active deployment color of services. A service is
+// identified by the "/username/environment/name" key, see ServiceKey.
+//
+// When a service has an active color, the getKites method returns only
+// those of its kites which registered with that color. This allows for
+// blue/green deployments, where a whole set of kites is switched over by
+// flipping a single value.
+type ColorStorage interface {
+	// GetColor returns the active color of the service, or an empty
+	// string if there is none.
+	GetColor(service string) (string, error)
+
+	// SetColor atomically sets the active color of the service and returns
+	// the color it replaced. If prev is non-empty and it is not the current
+	// color, ErrColorChanged is returned and the color is not modified.
+	// An empty color clears the active color.
+	SetColor(service, color, prev string) (string, error)
+}
+
+// ServiceKey returns the key that identifies the service of the given query
+// in a ColorStorage.
+func ServiceKey(q *protocol.KontrolQuery) (string, error) {
+	if q.Username == "" || q.Environment == "" || q.Name == "" {
+		return "", errors.New("username, environment and name fields are required")
+	}
+
+	return "/" + q.Username + "/" + q.Environment + "/" + q.Name, nil
+}
+
+// MemColorStorage is an in-memory ColorStorage. It is used by default, when
+// no other color storage is set.
+type MemColorStorage struct {
+	mu     sync.Mutex
+	colors map[string]string
+}
+
+var _ ColorStorage = (*MemColorStorage)(nil)
+
+// NewMemColorStorage returns a new, empty in-memory color storage.
+func NewMemColorStorage() *MemColorStorage {
+	return &MemColorStorage{
+		colors: make(map[string]string),
+	}
+}
+
+func (m *MemColorStorage) GetColor(service string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.colors[service], nil
+}
+
+func (m *MemColorStorage) SetColor(service, color, prev string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.colors[service]
+
+	if prev != "" && old != prev {
+		return "", ErrColorChanged
+	}
+
+	if color == "" {
+		delete(m.colors, service)
+	} else {
+		m.colors[service] = color
+	}
+
+	return old, nil
+}
+
+// SetColorStorage sets the backend storage that kontrol is going to use to
+// store active colors of services.
+func (k *Kontrol) SetColorStorage(storage ColorStorage) {
+	k.colors = storage
+}
+
+func (k *Kontrol) colorStorage() ColorStorage {
+	k.colorsOnce.Do(func() {
+		if k.colors != nil {
+			return
+		}
+
+		if cs, ok := k.storage.(ColorStorage); ok {
+			k.colors = cs
+			return
+		}
+
+		k.log.Warning("Color storage is not set. Using in memory cache")
+		k.colors = NewMemColorStorage()
+	})
+
+	return k.colors
+}
+
+// filterColor removes kites that registered with a color other than the
+// active color of their service.
+func (k *Kontrol) filterColor(kites Kites) (Kites, error) {
+	active := make(map[string]string)
+	filtered := kites[:0]
+
+	for _, kite := range kites {
+		service, err := ServiceKey(kite.Kite.Query())
+		if err != nil {
+			return nil, err
+		}
+
+		color, ok := active[service]
+		if !ok {
+			if color, err = k.colorStorage().GetColor(service); err != nil {
+				return nil, err
+			}
+
+			active[service] = color
+		}
+
+		if color == "" || color == kite.Color {
+			filtered = append(filtered, kite)
+		}
+	}
+
+	return filtered, nil
+}
+
+// HandleGetActiveColor returns the active color of the requested service.
+func (k *Kontrol) HandleGetActiveColor(r *kite.Request) (interface{}, error) {
+	var args protocol.ActiveColorArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	service, err := ServiceKey(&args.Service)
+	if err != nil {
+		return nil, err
+	}
+
+	color, err := k.colorStorage().GetColor(service)
+	if err != nil {
+		return nil, err
+	}
+
+	return &protocol.ActiveColorResult{
+		Color: color,
+	}, nil
+}
+
+// HandleSetActiveColor flips the active color of the requested service. Only
+// the owner of the service or the kontrol user is allowed to do so.
+func (k *Kontrol) HandleSetActiveColor(r *kite.Request) (interface{}, error) {
+	var args protocol.ActiveColorArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	service, err := ServiceKey(&args.Service)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Username != args.Service.Username && r.Username != k.Kite.Kite().Username {
+		return nil, fmt.Errorf("not allowed to change the active color of %q", service)
+	}
+
+	prev, err := k.colorStorage().SetColor(service, args.Color, args.PrevColor)
+	if err != nil {
+		return nil, err
+	}
+
+	k.log.Info("Active color of %q changed to %q by %q", service, args.Color, r.Username)
+
+	return &protocol.ActiveColorResult{
+		Color:     args.Color,
+		PrevColor: prev,
+	}, nil
+}
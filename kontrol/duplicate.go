@@ -0,0 +1,97 @@
+package kontrol
+
+import (
+	"fmt"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+)
+
+// DuplicatePolicy tells how Kontrol resolves registrations of two live kites
+// with the same ID, which happens e.g. when a VM is cloned together with its
+// kite or a kite.key is copied, and which otherwise causes the calls to be
+// routed to either of the kites intermittently.
+//
+// A kite is considered a duplicate if it registers from a different URL than
+// the live kite with the same ID. A kite which moved to another URL may be
+// considered a duplicate until its previous registration expires.
+type DuplicatePolicy int
+
+const (
+	// DuplicateAlert logs the conflict and calls Kontrol.OnDuplicate, the
+	// newer registration replaces the older one.
+	DuplicateAlert DuplicatePolicy = iota
+
+	// DuplicateReject logs the conflict, calls Kontrol.OnDuplicate and
+	// rejects the newer registration with a *DuplicateError.
+	DuplicateReject
+)
+
+// DuplicateError is returned when a kite registers with the ID of another
+// live kite and the DuplicateReject policy is used.
+type DuplicateError struct {
+	ID          string
+	URL         string
+	ExistingURL string
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("kite %s is already registered from %s", e.ID, e.ExistingURL)
+}
+
+// checkDuplicate resolves a conflict of the registering kite with another
+// live kite with the same ID according to the DuplicatePolicy. The client
+// is the connection the kite registers over, nil for HTTP registrations.
+func (k *Kontrol) checkDuplicate(remoteKite *protocol.Kite, url string, client *kite.Client) error {
+	existingURL := k.liveURL(remoteKite, client)
+	if existingURL == "" || existingURL == url {
+		return nil
+	}
+
+	k.log.Warning("Kite %s registers from %s, but a kite with the same ID is registered from %s",
+		remoteKite, url, existingURL)
+
+	if k.OnDuplicate != nil {
+		k.OnDuplicate(remoteKite, url, existingURL)
+	}
+
+	if k.DuplicatePolicy == DuplicateReject {
+		return &DuplicateError{
+			ID:          remoteKite.ID,
+			URL:         url,
+			ExistingURL: existingURL,
+		}
+	}
+
+	return nil
+}
+
+// liveURL returns the URL of the live kite with the same ID as remoteKite,
+// which is registered over another connection than the client, or an empty
+// string if there is none.
+func (k *Kontrol) liveURL(remoteKite *protocol.Kite, client *kite.Client) string {
+	k.registrationsMu.Lock()
+	reg, live := k.registrations[remoteKite.ID]
+	k.registrationsMu.Unlock()
+
+	if live && client != nil && reg.client == client {
+		return "" // the kite registers again over the same connection
+	}
+
+	if !live {
+		k.heartbeatsMu.Lock()
+		_, live = k.heartbeats[remoteKite.ID]
+		k.heartbeatsMu.Unlock()
+	}
+
+	if !live {
+		return ""
+	}
+
+	kites, err := k.storage.Get(&protocol.KontrolQuery{ID: remoteKite.ID})
+	if err != nil || len(kites) == 0 {
+		return ""
+	}
+
+	return kites[0].URL
+}
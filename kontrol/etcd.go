@@ -2,9 +2,8 @@ package kontrol
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,7 +14,7 @@ import (
 	"github.com/koding/kite/protocol"
 )
 
-// keyOrder defines the order of the query parameters.
+// keyOrder defines the order of the query parameters, see QueryFields.
 var keyOrder = []string{
 	"username",
 	"environment",
@@ -26,6 +25,13 @@ var keyOrder = []string{
 	"id",
 }
 
+// Values larger than etcdCompressSize are stored compressed, etcd rejects
+// requests larger than etcdMaxValueSize by default.
+const (
+	etcdCompressSize = 4 * 1024
+	etcdMaxValueSize = 1024 * 1024
+)
+
 // Etcd implements the Storage interface
 type Etcd struct {
 	client etcd.KeysAPI
@@ -76,7 +82,7 @@ func NewEtcd(machines []string, log kite.Logger) *Etcd {
 }
 
 func (e *Etcd) Delete(k *protocol.Kite) error {
-	etcdKey := KitesPrefix + k.String()
+	etcdKey := KitesPrefix + PathKeys{}.KiteKey(k)
 	etcdIDKey := KitesPrefix + "/" + k.ID
 
 	_, e1 := e.client.Delete(context.TODO(), etcdKey, &etcd.DeleteOptions{
@@ -100,16 +106,14 @@ func (e *Etcd) Upsert(k *protocol.Kite, v *kontrolprotocol.RegisterValue) error
 }
 
 func (e *Etcd) Add(k *protocol.Kite, v *kontrolprotocol.RegisterValue) error {
-	etcdKey := KitesPrefix + k.String()
+	etcdKey := KitesPrefix + PathKeys{}.KiteKey(k)
 	etcdIDKey := KitesPrefix + "/" + k.ID
 
-	p, err := json.Marshal(v)
+	value, err := encodeValue(k, v, etcdCompressSize, etcdMaxValueSize)
 	if err != nil {
 		return err
 	}
 
-	value := string(p)
-
 	// Set the kite key.
 	// Example "/koding/production/os/0.0.1/sj/kontainer1.sj.koding.com/1234asdf..."
 	_, err = e.client.Set(context.TODO(),
@@ -138,16 +142,14 @@ func (e *Etcd) Add(k *protocol.Kite, v *kontrolprotocol.RegisterValue) error {
 }
 
 func (e *Etcd) Update(k *protocol.Kite, v *kontrolprotocol.RegisterValue) error {
-	etcdKey := KitesPrefix + k.String()
+	etcdKey := KitesPrefix + PathKeys{}.KiteKey(k)
 	etcdIDKey := KitesPrefix + "/" + k.ID
 
-	p, err := json.Marshal(v)
+	value, err := encodeValue(k, v, etcdCompressSize, etcdMaxValueSize)
 	if err != nil {
 		return err
 	}
 
-	value := string(p)
-
 	// update the kite key.
 	// Example "/koding/production/os/0.0.1/sj/kontainer1.sj.koding.com/1234asdf..."
 	_, err = e.client.Set(context.TODO(),
@@ -272,6 +274,108 @@ func (e *Etcd) Get(query *protocol.KontrolQuery) (Kites, error) {
 	return kites, nil
 }
 
+func (e *Etcd) GetColor(service string) (string, error) {
+	resp, err := e.client.Get(context.TODO(), ColorsPrefix+service, nil)
+	if etcd.IsKeyNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Node.Value, nil
+}
+
+func (e *Etcd) SetColor(service, color, prev string) (string, error) {
+	var (
+		resp *etcd.Response
+		err  error
+	)
+
+	// Both operations are compare-and-swap ones if prev is given, so
+	// concurrent flips are detected by etcd itself.
+	if color == "" {
+		resp, err = e.client.Delete(context.TODO(), ColorsPrefix+service, &etcd.DeleteOptions{
+			PrevValue: prev,
+		})
+	} else {
+		resp, err = e.client.Set(context.TODO(), ColorsPrefix+service, color, &etcd.SetOptions{
+			PrevValue: prev,
+		})
+	}
+
+	switch e, ok := err.(etcd.Error); {
+	case err == nil:
+	case ok && e.Code == etcd.ErrorCodeTestFailed:
+		return "", ErrColorChanged
+	case ok && e.Code == etcd.ErrorCodeKeyNotFound:
+		if prev != "" {
+			return "", ErrColorChanged
+		}
+
+		// clearing a color that was never set
+		return "", nil
+	default:
+		return "", err
+	}
+
+	if resp.PrevNode == nil {
+		return "", nil
+	}
+
+	return resp.PrevNode.Value, nil
+}
+
+// RevokeTokens stores every revocation with a TTL, so it expires with
+// the token.
+func (e *Etcd) RevokeTokens(tokens []protocol.RevokedToken) error {
+	for _, tok := range tokens {
+		until := revokedUntil(tok)
+
+		ttl := time.Until(until)
+		if ttl <= 0 {
+			continue
+		}
+
+		_, err := e.client.Set(context.TODO(), RevokedPrefix+"/"+tok.ID, strconv.FormatInt(until.Unix(), 10), &etcd.SetOptions{
+			TTL: ttl,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Etcd) RevokedTokens() ([]protocol.RevokedToken, error) {
+	resp, err := e.client.Get(context.TODO(), RevokedPrefix, &etcd.GetOptions{
+		Recursive: true,
+	})
+	if etcd.IsKeyNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]protocol.RevokedToken, 0, len(resp.Node.Nodes))
+
+	for _, node := range resp.Node.Nodes {
+		expiresAt, err := strconv.ParseInt(node.Value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, protocol.RevokedToken{
+			ID:        strings.TrimPrefix(node.Key, RevokedPrefix+"/"),
+			ExpiresAt: expiresAt,
+		})
+	}
+
+	return tokens, nil
+}
+
 func (e *Etcd) etcdKey(query *protocol.KontrolQuery) (string, error) {
 	if onlyIDQuery(query) {
 		resp, err := e.client.Get(context.TODO(),
@@ -335,40 +439,9 @@ func onlyIDQuery(q *protocol.KontrolQuery) bool {
 	return false
 }
 
-// getQueryKey returns the etcd key for the query.
+// GetQueryKey returns the etcd key for the query, see PathKeys.
 func GetQueryKey(q *protocol.KontrolQuery) (string, error) {
-	fields := q.Fields()
-
-	if q.Username == "" {
-		return "", errors.New("Empty username field")
-	}
-
-	// Validate query and build key.
-	path := "/"
-
-	empty := false   // encountered with empty field?
-	empytField := "" // for error log
-
-	// http://golang.org/doc/go1.3#map, order is important and we can't rely on
-	// maps because the keys are not ordered :)
-	for _, key := range keyOrder {
-		v := fields[key]
-		if v == "" {
-			empty = true
-			empytField = key
-			continue
-		}
-
-		if empty && v != "" {
-			return "", fmt.Errorf("Invalid query. Query option is not set: %s", empytField)
-		}
-
-		path = path + v + "/"
-	}
-
-	path = strings.TrimSuffix(path, "/")
-
-	return path, nil
+	return PathKeys{}.QueryKey(q)
 }
 
 func getAudience(q *protocol.KontrolQuery) string {
@@ -0,0 +1,520 @@
+package kontrol
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/hashicorp/go-version"
+	"github.com/koding/kite"
+	kontrolprotocol "github.com/koding/kite/kontrol/protocol"
+	"github.com/koding/kite/protocol"
+)
+
+// KeysPrefix is the prefix of the key pairs stored in etcd by EtcdV3.
+const KeysPrefix = "/keys"
+
+// etcdV3Timeout is the timeout of the requests made to etcd.
+const etcdV3Timeout = 5 * time.Second
+
+// EtcdV3 implements the Storage interface with the v3 API of etcd. Every
+// kite is stored with a lease of KeyTTL, which is kept alive by
+// the heartbeats of the kite, so the kites which are gone are deregistered
+// by etcd itself.
+//
+// Unlike Etcd, it implements the KeyPairStorage, ColorStorage and
+// RevocationStorage interfaces too, so multiple Kontrol instances can share
+// a single etcd cluster without any other storage.
+type EtcdV3 struct {
+	client *clientv3.Client
+	log    kite.Logger
+}
+
+var (
+	_ Storage           = (*EtcdV3)(nil)
+	_ KeyPairStorage    = (*EtcdV3)(nil)
+	_ ColorStorage      = (*EtcdV3)(nil)
+	_ RevocationStorage = (*EtcdV3)(nil)
+)
+
+// NewEtcdV3 returns a storage connected to the etcd cluster of the given
+// machines, "127.0.0.1:2379" is used if there are none.
+func NewEtcdV3(machines []string, log kite.Logger) *EtcdV3 {
+	if len(machines) == 0 {
+		machines = []string{"127.0.0.1:2379"}
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   machines,
+		DialTimeout: etcdV3Timeout,
+	})
+	if err != nil {
+		panic("cannot connect to etcd cluster: " + strings.Join(machines, ","))
+	}
+
+	return NewEtcdV3Client(client, log)
+}
+
+// NewEtcdV3Client returns a storage using the given client, e.g. one
+// configured with TLS or authentication.
+func NewEtcdV3Client(client *clientv3.Client, log kite.Logger) *EtcdV3 {
+	return &EtcdV3{
+		client: client,
+		log:    log,
+	}
+}
+
+// Close closes the client of the storage.
+func (e *EtcdV3) Close() error {
+	return e.client.Close()
+}
+
+func (e *EtcdV3) Clear() error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdV3Timeout)
+	defer cancel()
+
+	_, err := e.client.Delete(ctx, KitesPrefix, clientv3.WithPrefix())
+	return err
+}
+
+func (e *EtcdV3) Add(k *protocol.Kite, v *kontrolprotocol.RegisterValue) error {
+	value, err := encodeValue(k, v, etcdCompressSize, etcdMaxValueSize)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdV3Timeout)
+	defer cancel()
+
+	lease, err := e.client.Grant(ctx, int64(KeyTTL/time.Second))
+	if err != nil {
+		return err
+	}
+
+	kiteKey := PathKeys{}.KiteKey(k)
+
+	// The kite key and the ID key for the lookups by ID expire together.
+	_, err = e.client.Txn(ctx).Then(
+		clientv3.OpPut(KitesPrefix+kiteKey, value, clientv3.WithLease(lease.ID)),
+		clientv3.OpPut(KitesPrefix+"/"+k.ID, kiteKey, clientv3.WithLease(lease.ID)),
+	).Commit()
+
+	return err
+}
+
+func (e *EtcdV3) Update(k *protocol.Kite, v *kontrolprotocol.RegisterValue) error {
+	value, err := encodeValue(k, v, etcdCompressSize, etcdMaxValueSize)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdV3Timeout)
+	defer cancel()
+
+	kiteKey := KitesPrefix + PathKeys{}.KiteKey(k)
+
+	resp, err := e.client.Get(ctx, kiteKey)
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Kvs) == 0 || resp.Kvs[0].Lease == 0 {
+		return e.Add(k, v)
+	}
+
+	kv := resp.Kvs[0]
+	lease := clientv3.LeaseID(kv.Lease)
+
+	// The lease is looked up in etcd, so the kite can be updated by any
+	// of the Kontrol instances sharing the cluster.
+	if _, err := e.client.KeepAliveOnce(ctx, lease); err != nil {
+		e.log.Debug("etcd: renewing lease of %s failed, adding it again: %s", k, err)
+		return e.Add(k, v)
+	}
+
+	if string(kv.Value) != value {
+		_, err = e.client.Put(ctx, kiteKey, value, clientv3.WithLease(lease))
+	}
+
+	return err
+}
+
+func (e *EtcdV3) Upsert(k *protocol.Kite, v *kontrolprotocol.RegisterValue) error {
+	return e.Update(k, v)
+}
+
+func (e *EtcdV3) Delete(k *protocol.Kite) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdV3Timeout)
+	defer cancel()
+
+	kiteKey := KitesPrefix + PathKeys{}.KiteKey(k)
+
+	resp, err := e.client.Delete(ctx, kiteKey, clientv3.WithPrevKV())
+	if err != nil {
+		return err
+	}
+
+	_, err = e.client.Delete(ctx, KitesPrefix+"/"+k.ID)
+
+	// Revoking the lease removes the keys added with it concurrently.
+	for _, kv := range resp.PrevKvs {
+		if kv.Lease != 0 {
+			e.client.Revoke(ctx, clientv3.LeaseID(kv.Lease))
+		}
+	}
+
+	return err
+}
+
+func (e *EtcdV3) Get(query *protocol.KontrolQuery) (Kites, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdV3Timeout)
+	defer cancel()
+
+	etcdKey, err := e.etcdKey(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if etcdKey == "" {
+		return make(Kites, 0), nil
+	}
+
+	// See Etcd.Get for the handling of version constraints.
+	var hasVersionConstraint bool
+	var keyRest string
+	var versionConstraint version.Constraints
+	_, err = version.NewVersion(query.Version)
+	if err != nil && query.Version != "" {
+		versionConstraint, err = version.NewConstraint(query.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		hasVersionConstraint = true
+		nameQuery := &protocol.KontrolQuery{
+			Username:    query.Username,
+			Environment: query.Environment,
+			Name:        query.Name,
+		}
+
+		etcdKey, _ = GetQueryKey(nameQuery)
+
+		keyRest = "/" + strings.TrimRight(
+			query.Region+"/"+query.Hostname+"/"+query.ID, "/")
+	}
+
+	// The keys of all the fields match a single kite, the other ones are
+	// prefixes of the keys of the matching kites.
+	var resp *clientv3.GetResponse
+	if _, perr := (PathKeys{}).ParseKiteKey(etcdKey); perr == nil {
+		resp, err = e.client.Get(ctx, KitesPrefix+etcdKey)
+	} else {
+		resp, err = e.client.Get(ctx, KitesPrefix+etcdKey+"/", clientv3.WithPrefix())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kites := make(Kites, 0, len(resp.Kvs))
+
+	for _, kv := range resp.Kvs {
+		k, err := etcdV3Kite(kv)
+		if err != nil {
+			return nil, err
+		}
+
+		kites = append(kites, k)
+	}
+
+	if hasVersionConstraint {
+		kites.Filter(versionConstraint, keyRest)
+	}
+
+	kites.Shuffle()
+
+	return kites, nil
+}
+
+// etcdV3Kite returns the kite stored in the key-value pair.
+func etcdV3Kite(kv *mvccpb.KeyValue) (*protocol.KiteWithToken, error) {
+	k, err := PathKeys{}.ParseKiteKey(strings.TrimPrefix(string(kv.Key), KitesPrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := decodeValue(string(kv.Value))
+	if err != nil {
+		return nil, err
+	}
+
+	return &protocol.KiteWithToken{
+		Kite:  *k,
+		URL:   val.URL,
+		KeyID: val.KeyID,
+		Color: val.Color,
+	}, nil
+}
+
+// etcdKey returns the key of the kites matching the query, or an empty
+// one if the kite of the ID query is not registered.
+func (e *EtcdV3) etcdKey(ctx context.Context, query *protocol.KontrolQuery) (string, error) {
+	if !onlyIDQuery(query) {
+		return GetQueryKey(query)
+	}
+
+	resp, err := e.client.Get(ctx, KitesPrefix+"/"+query.ID)
+	if err != nil || len(resp.Kvs) == 0 {
+		return "", err
+	}
+
+	return string(resp.Kvs[0].Value), nil
+}
+
+func (e *EtcdV3) GetColor(service string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdV3Timeout)
+	defer cancel()
+
+	resp, err := e.client.Get(ctx, ColorsPrefix+service)
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return "", nil
+	}
+
+	return string(resp.Kvs[0].Value), nil
+}
+
+func (e *EtcdV3) SetColor(service, color, prev string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdV3Timeout)
+	defer cancel()
+
+	key := ColorsPrefix + service
+
+	op := clientv3.OpPut(key, color)
+	if color == "" {
+		op = clientv3.OpDelete(key)
+	}
+
+	if prev != "" {
+		resp, err := e.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.Value(key), "=", prev)).
+			Then(op).
+			Commit()
+		if err != nil {
+			return "", err
+		}
+
+		if !resp.Succeeded {
+			return "", ErrColorChanged
+		}
+
+		return prev, nil
+	}
+
+	if color == "" {
+		resp, err := e.client.Delete(ctx, key, clientv3.WithPrevKV())
+		if err != nil || len(resp.PrevKvs) == 0 {
+			return "", err
+		}
+
+		return string(resp.PrevKvs[0].Value), nil
+	}
+
+	resp, err := e.client.Put(ctx, key, color, clientv3.WithPrevKV())
+	if err != nil || resp.PrevKv == nil {
+		return "", err
+	}
+
+	return string(resp.PrevKv.Value), nil
+}
+
+// RevokeTokens stores every revocation with a lease, which expires with
+// the token.
+func (e *EtcdV3) RevokeTokens(tokens []protocol.RevokedToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdV3Timeout)
+	defer cancel()
+
+	for _, tok := range tokens {
+		until := revokedUntil(tok)
+
+		ttl := int64(time.Until(until) / time.Second)
+		if ttl <= 0 {
+			continue
+		}
+
+		lease, err := e.client.Grant(ctx, ttl)
+		if err != nil {
+			return err
+		}
+
+		value := strconv.FormatInt(until.Unix(), 10)
+
+		if _, err := e.client.Put(ctx, RevokedPrefix+"/"+tok.ID, value, clientv3.WithLease(lease.ID)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *EtcdV3) RevokedTokens() ([]protocol.RevokedToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdV3Timeout)
+	defer cancel()
+
+	resp, err := e.client.Get(ctx, RevokedPrefix+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]protocol.RevokedToken, 0, len(resp.Kvs))
+
+	for _, kv := range resp.Kvs {
+		expiresAt, err := strconv.ParseInt(string(kv.Value), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, protocol.RevokedToken{
+			ID:        strings.TrimPrefix(string(kv.Key), RevokedPrefix+"/"),
+			ExpiresAt: expiresAt,
+		})
+	}
+
+	return tokens, nil
+}
+
+// etcdKeyPair is the value of the key pairs stored in etcd, the deleted
+// ones are kept, so their tokens are rejected with ErrKeyDeleted.
+type etcdKeyPair struct {
+	ID      string `json:"id"`
+	Public  string `json:"public"`
+	Private string `json:"private"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// publicKeyKey returns the key the ID of the key pair is stored under,
+// for the lookups by the public key.
+func publicKeyKey(public string) string {
+	sum := sha256.Sum256([]byte(public))
+	return KeysPrefix + "/public/" + hex.EncodeToString(sum[:])
+}
+
+func idKeyKey(id string) string {
+	return KeysPrefix + "/id/" + id
+}
+
+func (e *EtcdV3) AddKey(keyPair *KeyPair) error {
+	if err := keyPair.Validate(); err != nil {
+		return err
+	}
+
+	p, err := json.Marshal(&etcdKeyPair{
+		ID:      keyPair.ID,
+		Public:  keyPair.Public,
+		Private: keyPair.Private,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdV3Timeout)
+	defer cancel()
+
+	_, err = e.client.Txn(ctx).Then(
+		clientv3.OpPut(idKeyKey(keyPair.ID), string(p)),
+		clientv3.OpPut(publicKeyKey(keyPair.Public), keyPair.ID),
+	).Commit()
+
+	return err
+}
+
+func (e *EtcdV3) DeleteKey(keyPair *KeyPair) error {
+	kp, err := e.getKey(keyPair.ID)
+	if err == ErrKeyDeleted || err == ErrNoKeyFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	kp.Deleted = true
+
+	p, err := json.Marshal(kp)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdV3Timeout)
+	defer cancel()
+
+	_, err = e.client.Put(ctx, idKeyKey(kp.ID), string(p))
+	return err
+}
+
+func (e *EtcdV3) GetKeyFromID(id string) (*KeyPair, error) {
+	kp, err := e.getKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyPair{
+		ID:      kp.ID,
+		Public:  kp.Public,
+		Private: kp.Private,
+	}, nil
+}
+
+func (e *EtcdV3) GetKeyFromPublic(public string) (*KeyPair, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdV3Timeout)
+	defer cancel()
+
+	resp, err := e.client.Get(ctx, publicKeyKey(public))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNoKeyFound
+	}
+
+	return e.GetKeyFromID(string(resp.Kvs[0].Value))
+}
+
+func (e *EtcdV3) IsValid(public string) error {
+	// A valid key is currently a key that is not deleted.
+	_, err := e.GetKeyFromPublic(public)
+	return err
+}
+
+func (e *EtcdV3) getKey(id string) (*etcdKeyPair, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdV3Timeout)
+	defer cancel()
+
+	resp, err := e.client.Get(ctx, idKeyKey(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNoKeyFound
+	}
+
+	var kp etcdKeyPair
+	if err := json.Unmarshal(resp.Kvs[0].Value, &kp); err != nil {
+		return nil, err
+	}
+
+	if kp.Deleted {
+		return nil, ErrKeyDeleted
+	}
+
+	return &kp, nil
+}
@@ -26,7 +26,8 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 	}
 
 	var args struct {
-		URL string `json:"url"`
+		URL   string `json:"url"`
+		Color string `json:"color"`
 	}
 
 	if err := r.Args.One().Unmarshal(&args); err != nil {
@@ -42,7 +43,8 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 	}
 
 	res := &protocol.RegisterResult{
-		URL: args.URL,
+		URL:  args.URL,
+		Time: time.Now().UnixNano(),
 	}
 
 	ex := &kitekey.Extractor{
@@ -74,16 +76,29 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 		return nil, err
 	}
 
+	if err := k.checkDuplicate(&r.Client.Kite, args.URL, r.Client); err != nil {
+		return nil, err
+	}
+
+	// expired is closed when the ephemeral kite key of the kite expires,
+	// it stays nil for regular kites.
+	var expired chan struct{}
+
 	value := &kontrolprotocol.RegisterValue{
 		URL:   args.URL,
 		KeyID: keyPair.ID,
+		Color: args.Color,
+	}
+
+	if err := k.checkRegistrationSize(&r.Client.Kite, value); err != nil {
+		return nil, err
 	}
 
 	// Register first by adding the value to the storage. Return if there is
 	// any error.
 	if err := k.storage.Upsert(&r.Client.Kite, value); err != nil {
 		k.log.Error("storage add '%s' error: %s", &r.Client.Kite, err)
-		return nil, errors.New("internal error - register")
+		return nil, registerError(err)
 	}
 
 	every := onceevery.New(UpdateInterval)
@@ -93,11 +108,37 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 
 	kiteCopy := r.Client.Kite
 
+	reg := &registration{
+		client:       r.Client,
+		unregistered: make(chan struct{}),
+	}
+	unregistered := reg.unregistered
+
+	k.registrationsMu.Lock()
+	k.registrations[kiteCopy.ID] = reg
+	k.registrationsMu.Unlock()
+
+	if expiresAt := ephemeralExpiry(ex.Claims); !expiresAt.IsZero() {
+		expired = make(chan struct{})
+
+		time.AfterFunc(time.Until(expiresAt), func() {
+			k.clientLocks.Get(kiteCopy.ID).Lock()
+			defer k.clientLocks.Get(kiteCopy.ID).Unlock()
+
+			close(expired)
+			k.deleteEphemeral(&kiteCopy)
+		})
+	}
+
 	updaterFunc := func() {
 		for {
 			select {
 			case <-k.closed:
 				return
+			case <-expired:
+				return
+			case <-unregistered:
+				return
 			case <-ping:
 				k.log.Debug("Kite is active, got a ping %s", &kiteCopy)
 				every.Do(func() {
@@ -126,6 +167,11 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 			defer k.clientLocks.Get(kiteCopy.ID).Unlock()
 
 			select {
+			case <-expired:
+				// The kite key has expired, the kite is not welcome anymore.
+				return
+			case <-unregistered:
+				return
 			case ping <- struct{}{}:
 			default:
 			}
@@ -158,11 +204,78 @@ func (k *Kontrol) HandleRegister(r *kite.Request) (interface{}, error) {
 
 	r.Client.OnDisconnect(func() {
 		k.log.Info("Kite disconnected: %s", clientKite)
+
+		k.registrationsMu.Lock()
+		if k.registrations[kiteCopy.ID] == reg {
+			delete(k.registrations, kiteCopy.ID)
+		}
+		k.registrationsMu.Unlock()
 	})
 
 	return res, nil
 }
 
+// HandleUnregister removes the registration of the calling kite, so it is
+// not returned by getKites anymore. It's called by kites shutting down
+// gracefully, see kite.Kite.Shutdown.
+func (k *Kontrol) HandleUnregister(r *kite.Request) (interface{}, error) {
+	remoteKite := r.Client.Kite
+
+	if remoteKite.ID == "" {
+		return nil, errors.New("kite is not registered")
+	}
+
+	var args protocol.UnregisterArgs
+
+	if r.Args != nil {
+		if a, err := r.Args.Slice(); err == nil && len(a) == 1 {
+			if err := a[0].Unmarshal(&args); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Other versions of the kite, served by the same process, are
+	// unregistered over its connection.
+	if args.Kite != nil {
+		if args.Kite.Name != remoteKite.Name || args.Kite.Hostname != remoteKite.Hostname {
+			return nil, errors.New("only versions of the kite can be unregistered")
+		}
+
+		remoteKite = *args.Kite
+	}
+
+	if remoteKite.Username != r.Username {
+		return nil, errors.New("kites of other users can't be unregistered")
+	}
+
+	k.clientLocks.Get(remoteKite.ID).Lock()
+	defer k.clientLocks.Get(remoteKite.ID).Unlock()
+
+	k.registrationsMu.Lock()
+	if reg, ok := k.registrations[remoteKite.ID]; ok {
+		close(reg.unregistered)
+		delete(k.registrations, remoteKite.ID)
+	}
+	k.registrationsMu.Unlock()
+
+	k.heartbeatsMu.Lock()
+	if h, ok := k.heartbeats[remoteKite.ID]; ok {
+		// Fire the timer now, so it stops the updater.
+		h.timer.Reset(0)
+	}
+	k.heartbeatsMu.Unlock()
+
+	if err := k.storage.Delete(&remoteKite); err != nil {
+		k.log.Error("storage delete '%s' error: %s", &remoteKite, err)
+		return nil, errors.New("internal error - unregister")
+	}
+
+	k.log.Info("Kite unregistered: %s", &remoteKite)
+
+	return true, nil
+}
+
 func (k *Kontrol) HandleGetKites(r *kite.Request) (interface{}, error) {
 	var args protocol.GetKitesArgs
 
@@ -176,6 +289,16 @@ func (k *Kontrol) HandleGetKites(r *kite.Request) (interface{}, error) {
 		return nil, err
 	}
 
+	// A query for a particular kite ID is never filtered, so a kite of the
+	// inactive color can still be reached directly.
+	if args.Query.ID == "" {
+		if kites, err = k.filterColor(kites); err != nil {
+			return nil, err
+		}
+	}
+
+	ephemeral, expiresAt := ephemeralCredentials(r)
+
 	for _, kite := range kites {
 		keyPair, err := k.getOrUpdateKeyID(kite.KeyID, r)
 		if err != nil {
@@ -183,10 +306,13 @@ func (k *Kontrol) HandleGetKites(r *kite.Request) (interface{}, error) {
 		}
 
 		tok := &token{
-			audience: getAudience(args.Query),
-			username: r.Username,
-			issuer:   k.Kite.Kite().Username,
-			keyPair:  keyPair,
+			audience:  getAudience(args.Query),
+			username:  r.Username,
+			tenant:    r.Tenant,
+			issuer:    k.Kite.Kite().Username,
+			keyPair:   keyPair,
+			ephemeral: ephemeral,
+			expiresAt: expiresAt,
 		}
 
 		// Generate token once here because we are using the same token for every
@@ -199,9 +325,21 @@ func (k *Kontrol) HandleGetKites(r *kite.Request) (interface{}, error) {
 		kite.Token = token
 	}
 
-	return &protocol.GetKitesResult{
+	result := &protocol.GetKitesResult{
 		Kites: kites,
-	}, nil
+	}
+
+	if err := k.signResult(r, &args, result); err != nil {
+		return nil, err
+	}
+
+	if args.Compress {
+		if err := result.Compress(CompressMinSize); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
 }
 
 func (k *Kontrol) HandleGetToken(r *kite.Request) (interface{}, error) {
@@ -232,12 +370,100 @@ func (k *Kontrol) HandleGetToken(r *kite.Request) (interface{}, error) {
 		return nil, err
 	}
 
+	// The tokens of ephemeral kites do not outlive their kite keys.
+	ephemeral, expiresAt := ephemeralCredentials(r)
+
+	return k.generateToken(&token{
+		audience:  getAudience(&args.KontrolQuery),
+		username:  r.Username,
+		tenant:    r.Tenant,
+		issuer:    k.Kite.Kite().Username,
+		keyPair:   keyPair,
+		force:     args.Force,
+		ephemeral: ephemeral,
+		expiresAt: expiresAt,
+	})
+}
+
+// HandleGetDelegateToken exchanges a token of a user, that was used to call
+// the requesting kite, for a token that allows the kite to call the
+// requested kite on behalf of the user. The new token is narrowed down to the
+// requested kite and it does not outlive the user's token.
+func (k *Kontrol) HandleGetDelegateToken(r *kite.Request) (interface{}, error) {
+	var args protocol.DelegateTokenArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, fmt.Errorf("invalid query: %s", err)
+	}
+
+	// The user's token was signed with the key pair of the requesting
+	// kite's registration.
+	actors, err := k.storage.Get(r.Client.Kite.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(actors) != 1 {
+		return nil, errors.New("requesting kite is not registered")
+	}
+
+	actorKeyPair, err := k.keyPair.GetKeyFromID(actors[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &kitekey.KiteClaims{}
+
+	keyFn := func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+
+		return jwt.ParseRSAPublicKeyFromPEM([]byte(actorKeyPair.Public))
+	}
+
+	if _, err := jwt.ParseWithClaims(args.Token, claims, keyFn); err != nil {
+		return nil, fmt.Errorf("invalid user token: %s", err)
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("user token has no username")
+	}
+
+	// Only the kite the user's token was issued for can exchange it.
+	if err := kite.VerifyAudience(&r.Client.Kite, claims.Audience); err != nil {
+		return nil, fmt.Errorf("user token was not issued for the requesting kite: %s", err)
+	}
+
+	kites, err := k.storage.Get(&args.KontrolQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(kites) > 1 {
+		return nil, errors.New("query matches more than one kite")
+	}
+
+	if len(kites) == 0 {
+		return nil, errors.New("no kites found")
+	}
+
+	keyPair, err := k.getOrUpdateKeyID(kites[0].KeyID, r)
+	if err != nil {
+		return nil, err
+	}
+
+	k.log.Info("Issuing delegate token for %q acting on behalf of %q to %s",
+		r.Username, claims.Subject, getAudience(&args.KontrolQuery))
+
 	return k.generateToken(&token{
-		audience: getAudience(&args.KontrolQuery),
-		username: r.Username,
-		issuer:   k.Kite.Kite().Username,
-		keyPair:  keyPair,
-		force:    args.Force,
+		audience:  getAudience(&args.KontrolQuery),
+		username:  claims.Subject,
+		tenant:    claims.Tenant,
+		actor:     r.Username,
+		issuer:    k.Kite.Kite().Username,
+		keyPair:   keyPair,
+		expiresAt: time.Unix(claims.ExpiresAt, 0),
 	})
 }
 
@@ -274,6 +500,115 @@ func (k *Kontrol) HandleMachine(r *kite.Request) (interface{}, error) {
 	return k.registerUser(r.Client.Kite.Username, keyPair.Public, keyPair.Private)
 }
 
+// HandleGetEphemeralKey issues a short-lived kite key for the requesting
+// user, which is meant for kites that live only as long as a CI job or
+// a serverless invocation. The key is passed to the ephemeral kite
+// directly, e.g. with KITE_KEY environment variable, so it is never
+// written to disk. Registrations of kites using the key are removed when
+// the key expires.
+func (k *Kontrol) HandleGetEphemeralKey(r *kite.Request) (interface{}, error) {
+	var args protocol.EphemeralKeyArgs
+
+	if r.Args != nil {
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+	}
+
+	// Ephemeral kites can't prolong their lives by issuing new keys.
+	if ephemeral, _ := ephemeralCredentials(r); ephemeral {
+		return nil, errors.New("ephemeral kites can't request ephemeral keys")
+	}
+
+	ttl := k.ephemeralTTL()
+	if args.TTL > 0 && args.TTL < ttl {
+		ttl = args.TTL
+	}
+
+	var keyPair *KeyPair
+	var err error
+
+	if k.MachineKeyPicker != nil {
+		keyPair, err = k.MachineKeyPicker(r)
+	} else {
+		keyPair, err = k.KeyPair()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(ttl).UTC()
+
+	kiteKey, err := k.signKiteKey(r.Username, keyPair.Public, keyPair.Private, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	k.log.Info("Issued ephemeral kite key for user %q, expires at %s", r.Username, expiresAt)
+
+	return &protocol.EphemeralKeyResult{
+		KiteKey:   kiteKey,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// ephemeralCredentials tells whether the caller is authenticated with
+// an ephemeral kite key or with a token issued for one, and when
+// the kite key expires.
+func ephemeralCredentials(r *kite.Request) (bool, time.Time) {
+	if r.Auth == nil {
+		return false, time.Time{}
+	}
+
+	claims := &kitekey.KiteClaims{}
+
+	switch r.Auth.Type {
+	case "kiteKey":
+		ex := &kitekey.Extractor{Claims: claims}
+
+		if _, err := jwt.ParseWithClaims(r.Auth.Key, claims, ex.Extract); err != nil {
+			return false, time.Time{}
+		}
+	case "token":
+		c, err := r.LocalKite.ValidateToken(r.Auth.Key)
+		if err != nil {
+			return false, time.Time{}
+		}
+
+		claims = c
+	default:
+		return false, time.Time{}
+	}
+
+	if !claims.Ephemeral {
+		return false, time.Time{}
+	}
+
+	return true, time.Unix(claims.ExpiresAt, 0)
+}
+
+// ephemeralExpiry gives the expiration time of an ephemeral kite key,
+// or zero time for regular kite keys.
+func ephemeralExpiry(claims *kitekey.KiteClaims) time.Time {
+	if !claims.Ephemeral || claims.ExpiresAt == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.ExpiresAt, 0)
+}
+
+// deleteEphemeral removes the registration of a kite which kite key
+// has expired.
+func (k *Kontrol) deleteEphemeral(kite *protocol.Kite) {
+	if err := k.storage.Delete(kite); err != nil {
+		k.log.Error("storage delete '%s' error: %s", kite, err)
+		return
+	}
+
+	k.log.Info("Ephemeral kite expired: %s", kite)
+}
+
 func (k *Kontrol) HandleGetKey(r *kite.Request) (interface{}, error) {
 	// Only accept requests with kiteKey because we need this info
 	// for checking if the key is valid and needs to be regenerated
@@ -59,6 +59,10 @@ func startKontrol(pem, pub string, port int) (*Kontrol, *Config) {
 	switch os.Getenv("KONTROL_STORAGE") {
 	case "etcd":
 		kon.SetStorage(NewEtcd(nil, kon.Kite.Log))
+	case "etcdv3":
+		e := NewEtcdV3(nil, kon.Kite.Log)
+		kon.SetStorage(e)
+		kon.SetKeyPairStorage(e)
 	case "postgres":
 		p := NewPostgres(nil, kon.Kite.Log)
 		kon.SetStorage(p)
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
@@ -21,6 +22,8 @@ func (k *Kontrol) HandleHeartbeat(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	rw.Header().Set(protocol.KontrolTimeHeader, strconv.FormatInt(time.Now().UnixNano(), 10))
+
 	k.heartbeatsMu.Lock()
 	defer k.heartbeatsMu.Unlock()
 
@@ -32,6 +35,15 @@ func (k *Kontrol) HandleHeartbeat(rw http.ResponseWriter, req *http.Request) {
 		// according to the write interval. If the kite doesn't send any
 		// heartbeat, the timer func is being called, which stops the updater
 		// so the key is being deleted automatically via the TTL mechanism.
+		if h.expired() {
+			// Do not keep alive kites which kite key has expired, let the
+			// timer stop the updater instead. The kite is not going to be
+			// able to register again.
+			k.log.Debug("Sending registeragain to expired '%s'", id)
+			rw.Write([]byte("registeragain"))
+			return
+		}
+
 		h.timer.Reset(HeartbeatInterval + HeartbeatDelay)
 
 		k.log.Debug("Sending pong '%s'", id)
@@ -98,6 +110,7 @@ func (k *Kontrol) HandleRegisterHTTP(rw http.ResponseWriter, req *http.Request)
 	resp := &protocol.RegisterResult{
 		URL:               args.URL,
 		HeartbeatInterval: int64(HeartbeatInterval / time.Second),
+		Time:              time.Now().UnixNano(),
 	}
 
 	// check if the key is valid and is stored in the key pair storage, if not
@@ -131,23 +144,42 @@ func (k *Kontrol) HandleRegisterHTTP(rw http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	if err := k.checkDuplicate(remoteKite, args.URL, nil); err != nil {
+		http.Error(rw, jsonError(err), http.StatusConflict)
+		return
+	}
+
 	// This will be stored into the final storage
 	value := &kontrolprotocol.RegisterValue{
 		URL:   args.URL,
 		KeyID: keyPair.ID,
+		Color: args.Color,
+	}
+
+	if err := k.checkRegistrationSize(remoteKite, value); err != nil {
+		http.Error(rw, jsonError(err), http.StatusRequestEntityTooLarge)
+		return
 	}
 
 	// Register first by adding the value to the storage. Return if there is
 	// any error.
 	if err := k.storage.Upsert(remoteKite, value); err != nil {
 		k.log.Error("storage add '%s' error: %s", remoteKite, err)
-		http.Error(rw, jsonError(errors.New("internal error - register")), http.StatusInternalServerError)
+
+		if _, ok := err.(*RegistrationSizeError); ok {
+			http.Error(rw, jsonError(err), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		http.Error(rw, jsonError(registerError(err)), http.StatusInternalServerError)
 		return
 	}
 
 	k.heartbeatsMu.Lock()
 	defer k.heartbeatsMu.Unlock()
 
+	expiresAt := ephemeralExpiry(ex.Claims)
+
 	h, ok := k.heartbeats[remoteKite.ID]
 	if ok {
 		// there is already a previous registration, use it
@@ -221,6 +253,25 @@ func (k *Kontrol) HandleRegisterHTTP(rw http.ResponseWriter, req *http.Request)
 		k.heartbeats[remoteKite.ID] = h
 	}
 
+	h.expiresAt = expiresAt
+
+	if !expiresAt.IsZero() {
+		time.AfterFunc(time.Until(expiresAt), func() {
+			k.heartbeatsMu.Lock()
+			defer k.heartbeatsMu.Unlock()
+
+			if h, ok := k.heartbeats[remoteKite.ID]; !ok || !h.expired() {
+				// Kite has gone or registered again with a new key.
+				return
+			}
+
+			// Fire the timer now, so it stops the updater.
+			h.timer.Reset(0)
+
+			k.deleteEphemeral(remoteKite)
+		})
+	}
+
 	k.log.Info("Kite registered (via HTTP): %s", remoteKite)
 
 	// send the response back to the requester
@@ -0,0 +1,119 @@
+package kontrol
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/koding/kite/protocol"
+)
+
+// KeyField is a field of a kite or of a query, named as in the JSON form
+// of protocol.Kite.
+type KeyField struct {
+	Name  string
+	Value string
+}
+
+// QueryFields returns the non-empty fields of the query, in the order of
+// the kite hierarchy: username, environment, name, version, region,
+// hostname and id.
+//
+// Storages with native indexes, like SQL databases, can look the kites up
+// by the fields, instead of emulating the path keys of etcd.
+func QueryFields(q *protocol.KontrolQuery) []KeyField {
+	values := q.Fields()
+	fields := make([]KeyField, 0, len(keyOrder))
+
+	for _, name := range keyOrder {
+		if v := values[name]; v != "" {
+			fields = append(fields, KeyField{Name: name, Value: v})
+		}
+	}
+
+	return fields
+}
+
+// KeySerializer builds the storage keys of the kites and of the queries.
+// Key-value storages, which look the kites up by the key prefixes, can
+// use other serializers than PathKeys, e.g. to order the fields
+// differently.
+type KeySerializer interface {
+	// KiteKey returns the key the kite is stored under.
+	KiteKey(k *protocol.Kite) string
+
+	// ParseKiteKey is the inverse of KiteKey.
+	ParseKiteKey(key string) (*protocol.Kite, error)
+
+	// QueryKey returns the prefix of the keys of the kites matching
+	// the query. It fails if the query cannot be expressed with
+	// a single prefix.
+	QueryKey(q *protocol.KontrolQuery) (string, error)
+}
+
+// PathKeys is the KeySerializer used by the etcd storage, the keys are
+// paths like "/username/environment/name/version/region/hostname/id".
+type PathKeys struct{}
+
+var _ KeySerializer = PathKeys{}
+
+// KiteKey implements the KeySerializer interface.
+func (PathKeys) KiteKey(k *protocol.Kite) string {
+	return k.String()
+}
+
+// ParseKiteKey implements the KeySerializer interface.
+func (PathKeys) ParseKiteKey(key string) (*protocol.Kite, error) {
+	fields := strings.Split(strings.TrimPrefix(key, "/"), "/")
+	if len(fields) != len(keyOrder) {
+		return nil, fmt.Errorf("kontrol: invalid kite key %s", key)
+	}
+
+	return &protocol.Kite{
+		Username:    fields[0],
+		Environment: fields[1],
+		Name:        fields[2],
+		Version:     fields[3],
+		Region:      fields[4],
+		Hostname:    fields[5],
+		ID:          fields[6],
+	}, nil
+}
+
+// QueryKey implements the KeySerializer interface. The fields of the query
+// must be set without gaps, starting with the username, as wildcards are
+// not allowed in paths.
+func (PathKeys) QueryKey(q *protocol.KontrolQuery) (string, error) {
+	fields := q.Fields()
+
+	if q.Username == "" {
+		return "", errors.New("Empty username field")
+	}
+
+	// Validate query and build key.
+	path := "/"
+
+	empty := false   // encountered with empty field?
+	empytField := "" // for error log
+
+	// http://golang.org/doc/go1.3#map, order is important and we can't rely on
+	// maps because the keys are not ordered :)
+	for _, key := range keyOrder {
+		v := fields[key]
+		if v == "" {
+			empty = true
+			empytField = key
+			continue
+		}
+
+		if empty && v != "" {
+			return "", fmt.Errorf("Invalid query. Query option is not set: %s", empytField)
+		}
+
+		path = path + v + "/"
+	}
+
+	path = strings.TrimSuffix(path, "/")
+
+	return path, nil
+}
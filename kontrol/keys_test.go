@@ -0,0 +1,56 @@
+package kontrol
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koding/kite/protocol"
+)
+
+func TestPathKeys(t *testing.T) {
+	k := &protocol.Kite{
+		Username:    "cenk",
+		Environment: "production",
+		Name:        "fs",
+		Version:     "0.0.1",
+		Region:      "sj",
+		Hostname:    "localhost",
+		ID:          "1234",
+	}
+
+	key := PathKeys{}.KiteKey(k)
+	if key != "/cenk/production/fs/0.0.1/sj/localhost/1234" {
+		t.Fatalf("unexpected key: %s", key)
+	}
+
+	got, err := PathKeys{}.ParseKiteKey(key)
+	if err != nil {
+		t.Fatalf("ParseKiteKey()=%s", err)
+	}
+
+	if !reflect.DeepEqual(got, k) {
+		t.Fatalf("got %+v, want %+v", got, k)
+	}
+
+	if _, err := (PathKeys{}).ParseKiteKey("/cenk/production/fs"); err == nil {
+		t.Fatal("expected partial key to be rejected")
+	}
+}
+
+func TestQueryFields(t *testing.T) {
+	q := &protocol.KontrolQuery{
+		Username: "cenk",
+		Name:     "fs",
+		ID:       "1234",
+	}
+
+	want := []KeyField{
+		{Name: "username", Value: "cenk"},
+		{Name: "name", Value: "fs"},
+		{Name: "id", Value: "1234"},
+	}
+
+	if got := QueryFields(q); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
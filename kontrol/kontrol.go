@@ -15,12 +15,15 @@ import (
 	"github.com/koding/kite/config"
 	"github.com/koding/kite/kitekey"
 	kontrolprotocol "github.com/koding/kite/kontrol/protocol"
+	"github.com/koding/kite/protocol"
 	uuid "github.com/satori/go.uuid"
 )
 
 const (
 	KontrolVersion = "0.0.4"
 	KitesPrefix    = "/kites"
+	ColorsPrefix   = "/colors"
+	RevokedPrefix  = "/revoked"
 )
 
 var (
@@ -32,6 +35,28 @@ var (
 	// no more than a few minutes, to account for clock skew.
 	TokenLeeway = 5 * time.Minute
 
+	// EphemeralTTL is the maximum lifetime of ephemeral kite keys issued
+	// with the "getEphemeralKey" method.
+	EphemeralTTL = time.Hour
+
+	// RevocationSyncInterval is the interval in which Kontrol loads
+	// the tokens revoked at the other Kontrol instances from the storage.
+	RevocationSyncInterval = time.Minute
+
+	// BroadcastConcurrency is the maximum number of kites a single
+	// broadcast is delivered to at the same time.
+	BroadcastConcurrency = 32
+
+	// BroadcastMaxTimeout and BroadcastMaxRetries limit the timeout of
+	// a single delivery attempt and the number of the retries requested
+	// by the broadcast callers.
+	BroadcastMaxTimeout = time.Minute
+	BroadcastMaxRetries = 10
+
+	// CompressMinSize is the size of the encoded getKites result, starting
+	// from which the result is compressed for callers that allow it.
+	CompressMinSize = 16 << 10
+
 	// DefaultPort is a default kite port value.
 	DefaultPort = 4000
 
@@ -84,6 +109,34 @@ type Kontrol struct {
 	// TokenNoNBF when true does not set nbf field for generated JWT tokens.
 	TokenNoNBF bool
 
+	// EphemeralTTL describes the maximum TTL of ephemeral kite keys.
+	//
+	// If EphemeralTTL is 0, default global EphemeralTTL is used.
+	EphemeralTTL time.Duration
+
+	// RevocationSyncInterval describes how often the revoked tokens are
+	// loaded from the storage.
+	//
+	// If RevocationSyncInterval is 0, default global RevocationSyncInterval
+	// is used.
+	RevocationSyncInterval time.Duration
+
+	// DuplicatePolicy tells how to resolve registrations of two live kites
+	// with the same ID, see DuplicatePolicy.
+	DuplicatePolicy DuplicatePolicy
+
+	// OnDuplicate, if not nil, is called when a kite registers with the ID
+	// of another live kite, registered from the existingURL.
+	OnDuplicate func(kite *protocol.Kite, url, existingURL string)
+
+	// MaxRegistrationSize is the maximum size in bytes of the kite key and
+	// the registered value, larger registrations are rejected with
+	// a *RegistrationSizeError.
+	//
+	// If MaxRegistrationSize is 0, DefaultMaxRegistrationSize is used,
+	// a negative value disables the limit.
+	MaxRegistrationSize int
+
 	clientLocks *IdLock
 
 	heartbeats   map[string]*heartbeat
@@ -92,6 +145,15 @@ type Kontrol struct {
 	tokenCache   map[string]cachedToken
 	tokenCacheMu sync.Mutex
 
+	// signingKeys are the parsed private keys the results are signed
+	// with, keyed by their PEM encoding, see signResult
+	signingKeys sync.Map
+
+	// registrations are the live registrations of the kites registered
+	// over websocket, keyed by kite ID
+	registrations   map[string]*registration
+	registrationsMu sync.Mutex
+
 	// closed notifies goroutines started by kontrol that it got closed
 	closed chan struct{}
 
@@ -107,6 +169,14 @@ type Kontrol struct {
 	// storage defines the storage of the kites.
 	storage Storage
 
+	// colors defines the storage of the active colors of services.
+	colors     ColorStorage
+	colorsOnce sync.Once
+
+	// revocations defines the storage of the revoked tokens.
+	revocations     RevocationStorage
+	revocationsOnce sync.Once
+
 	// selfKeyPair is a key pair used to sign Kontrol's kite key.
 	selfKeyPair *KeyPair
 
@@ -117,9 +187,26 @@ type Kontrol struct {
 	log kite.Logger
 }
 
+// registration is a live registration of a kite made over websocket.
+type registration struct {
+	client *kite.Client
+
+	// unregistered is closed when the kite unregisters itself, so the
+	// registration is not kept alive anymore
+	unregistered chan struct{}
+}
+
 type heartbeat struct {
 	updateC chan func() error
 	timer   *time.Timer
+
+	// expiresAt is the expiration time of the kite key of an ephemeral
+	// kite, it is zero for regular kites.
+	expiresAt time.Time
+}
+
+func (h *heartbeat) expired() bool {
+	return !h.expiresAt.IsZero() && !time.Now().Before(h.expiresAt)
 }
 
 // New creates a new kontrol instance with the given version and config
@@ -141,10 +228,18 @@ func New(conf *config.Config, version string) *Kontrol {
 	kontrol := NewWithoutHandlers(conf, version)
 
 	kontrol.Kite.HandleFunc("register", kontrol.HandleRegister)
+	kontrol.Kite.HandleFunc("unregister", kontrol.HandleUnregister)
 	kontrol.Kite.HandleFunc("registerMachine", kontrol.HandleMachine).DisableAuthentication()
 	kontrol.Kite.HandleFunc("getKites", kontrol.HandleGetKites)
 	kontrol.Kite.HandleFunc("getToken", kontrol.HandleGetToken)
+	kontrol.Kite.HandleFunc("getDelegateToken", kontrol.HandleGetDelegateToken)
+	kontrol.Kite.HandleFunc("getEphemeralKey", kontrol.HandleGetEphemeralKey)
+	kontrol.Kite.HandleFunc("revokeTokens", kontrol.HandleRevokeTokens)
+	kontrol.Kite.HandleFunc("getRevokedTokens", kontrol.HandleGetRevokedTokens)
+	kontrol.Kite.HandleFunc("broadcast", kontrol.HandleBroadcast)
 	kontrol.Kite.HandleFunc("getKey", kontrol.HandleGetKey)
+	kontrol.Kite.HandleFunc("getActiveColor", kontrol.HandleGetActiveColor)
+	kontrol.Kite.HandleFunc("setActiveColor", kontrol.HandleSetActiveColor)
 
 	kontrol.Kite.HandleHTTPFunc("/register", kontrol.HandleRegisterHTTP)
 	kontrol.Kite.HandleHTTPFunc("/heartbeat", kontrol.HandleHeartbeat)
@@ -160,10 +255,18 @@ func New(conf *config.Config, version string) *Kontrol {
 //
 //     kontrol := NewWithoutHandlers(conf, version)
 //     kontrol.Kite.HandleFunc("register", kontrol.HandleRegister)
+//     kontrol.Kite.HandleFunc("unregister", kontrol.HandleUnregister)
 //     kontrol.Kite.HandleFunc("registerMachine", kontrol.HandleMachine).DisableAuthentication()
 //     kontrol.Kite.HandleFunc("getKites", kontrol.HandleGetKites)
 //     kontrol.Kite.HandleFunc("getToken", kontrol.HandleGetToken)
+//     kontrol.Kite.HandleFunc("getDelegateToken", kontrol.HandleGetDelegateToken)
+//     kontrol.Kite.HandleFunc("getEphemeralKey", kontrol.HandleGetEphemeralKey)
+//     kontrol.Kite.HandleFunc("revokeTokens", kontrol.HandleRevokeTokens)
+//     kontrol.Kite.HandleFunc("getRevokedTokens", kontrol.HandleGetRevokedTokens)
+//     kontrol.Kite.HandleFunc("broadcast", kontrol.HandleBroadcast)
 //     kontrol.Kite.HandleFunc("getKey", kontrol.HandleGetKey)
+//     kontrol.Kite.HandleFunc("getActiveColor", kontrol.HandleGetActiveColor)
+//     kontrol.Kite.HandleFunc("setActiveColor", kontrol.HandleSetActiveColor)
 //     kontrol.Kite.HandleHTTPFunc("/heartbeat", kontrol.HandleHeartbeat)
 //     kontrol.Kite.HandleHTTPFunc("/register", kontrol.HandleRegisterHTTP)
 //
@@ -173,6 +276,8 @@ func NewWithoutHandlers(conf *config.Config, version string) *Kontrol {
 		heartbeats:  make(map[string]*heartbeat),
 		closed:      make(chan struct{}),
 		tokenCache:  make(map[string]cachedToken),
+
+		registrations: make(map[string]*registration),
 	}
 
 	// Make a copy to not modify user-provided value.
@@ -322,6 +427,7 @@ func (k *Kontrol) Run() {
 
 	// now go and register ourself
 	go k.registerSelf()
+	go k.syncRevokedTokens()
 
 	k.Kite.Run()
 }
@@ -358,6 +464,19 @@ func (k *Kontrol) InitializeSelf() error {
 }
 
 func (k *Kontrol) registerUser(username, publicKey, privateKey string) (kiteKey string, err error) {
+	kiteKey, err = k.signKiteKey(username, publicKey, privateKey, time.Time{})
+	if err != nil {
+		return "", err
+	}
+
+	k.Kite.Log.Info("Registered machine on user: %s", username)
+
+	return kiteKey, nil
+}
+
+// signKiteKey generates a kite key for the given user. If expiresAt is
+// non-zero, the key is an ephemeral one that expires at the given time.
+func (k *Kontrol) signKiteKey(username, publicKey, privateKey string, expiresAt time.Time) (string, error) {
 	claims := &kitekey.KiteClaims{
 		StandardClaims: jwt.StandardClaims{
 			Issuer:   k.Kite.Kite().Username,
@@ -369,13 +488,16 @@ func (k *Kontrol) registerUser(username, publicKey, privateKey string) (kiteKey
 		KontrolKey: strings.TrimSpace(publicKey),
 	}
 
+	if !expiresAt.IsZero() {
+		claims.ExpiresAt = expiresAt.UTC().Unix()
+		claims.Ephemeral = true
+	}
+
 	rsaPrivate, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKey))
 	if err != nil {
 		return "", err
 	}
 
-	k.Kite.Log.Info("Registered machine on user: %s", username)
-
 	return jwt.NewWithClaims(jwt.GetSigningMethod("RS256"), claims).SignedString(rsaPrivate)
 }
 
@@ -497,6 +619,22 @@ func (k *Kontrol) tokenTTL() time.Duration {
 	return TokenTTL
 }
 
+func (k *Kontrol) ephemeralTTL() time.Duration {
+	if k.EphemeralTTL != 0 {
+		return k.EphemeralTTL
+	}
+
+	return EphemeralTTL
+}
+
+func (k *Kontrol) revocationSyncInterval() time.Duration {
+	if k.RevocationSyncInterval != 0 {
+		return k.RevocationSyncInterval
+	}
+
+	return RevocationSyncInterval
+}
+
 func (k *Kontrol) tokenLeeway() time.Duration {
 	if k.TokenLeeway != 0 {
 		return k.TokenLeeway
@@ -508,18 +646,27 @@ func (k *Kontrol) tokenLeeway() time.Duration {
 type token struct {
 	audience string
 	username string
+	tenant   string
+	actor    string
 	issuer   string
 	keyPair  *KeyPair
 	force    bool
+
+	// expiresAt, when non-zero, caps the expiration time of the token
+	expiresAt time.Time
+
+	// ephemeral marks the tokens issued for ephemeral kite keys
+	ephemeral bool
 }
 
 type cachedToken struct {
 	signed string
+	id     string // the "jti" claim, see revokeTokens
 	timer  *time.Timer
 }
 
 func (t *token) String() string {
-	return t.audience + t.username + t.issuer + t.keyPair.ID
+	return t.audience + t.username + t.tenant + t.actor + t.issuer + t.keyPair.ID
 }
 
 // cacheToken cached the signed token under the given key.
@@ -528,13 +675,14 @@ func (t *token) String() string {
 //
 // If the token was already exists in the cache, it will be
 // overwritten with a new value.
-func (k *Kontrol) cacheToken(key, signed string) {
+func (k *Kontrol) cacheToken(key, id, signed string) {
 	if ct, ok := k.tokenCache[key]; ok {
 		ct.timer.Stop()
 	}
 
 	k.tokenCache[key] = cachedToken{
 		signed: signed,
+		id:     id,
 		timer: time.AfterFunc(k.tokenTTL()-k.tokenLeeway(), func() {
 			k.tokenCacheMu.Lock()
 			delete(k.tokenCache, key)
@@ -551,7 +699,11 @@ func (k *Kontrol) generateToken(tok *token) (string, error) {
 	k.tokenCacheMu.Lock()
 	defer k.tokenCacheMu.Unlock()
 
-	if !tok.force {
+	// Tokens with capped expiration time are never cached, as the cached
+	// one could outlive the cap.
+	cache := tok.expiresAt.IsZero()
+
+	if !tok.force && cache {
 		if ct, ok := k.tokenCache[uniqKey]; ok {
 			return ct.signed, nil
 		}
@@ -573,6 +725,13 @@ func (k *Kontrol) generateToken(tok *token) (string, error) {
 			IssuedAt:  now.Add(-k.tokenLeeway()).UTC().Unix(),
 			Id:        uuid.NewV4().String(),
 		},
+		Tenant:    tok.tenant,
+		Actor:     tok.actor,
+		Ephemeral: tok.ephemeral,
+	}
+
+	if !tok.expiresAt.IsZero() && tok.expiresAt.Unix() < claims.ExpiresAt {
+		claims.ExpiresAt = tok.expiresAt.Unix()
 	}
 
 	if !k.TokenNoNBF {
@@ -584,7 +743,9 @@ func (k *Kontrol) generateToken(tok *token) (string, error) {
 		return "", errors.New("Server error: Cannot generate a token")
 	}
 
-	k.cacheToken(uniqKey, signed)
+	if cache {
+		k.cacheToken(uniqKey, claims.Id, signed)
+	}
 
 	return signed, nil
 }
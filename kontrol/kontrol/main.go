@@ -93,6 +93,10 @@ func main() {
 		p := kontrol.NewPostgres(postgresConf, k.Kite.Log)
 		k.SetStorage(p)
 		k.SetKeyPairStorage(p)
+	case "etcdv3":
+		e := kontrol.NewEtcdV3(conf.Machines, k.Kite.Log)
+		k.SetStorage(e)
+		k.SetKeyPairStorage(e)
 	case "etcd":
 		fallthrough
 	default:
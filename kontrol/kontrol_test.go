@@ -35,7 +35,7 @@ func init() {
 }
 
 func TestUpdateKeys(t *testing.T) {
-	if storage := os.Getenv("KONTROL_STORAGE"); storage != "postgres" {
+	if storage := os.Getenv("KONTROL_STORAGE"); storage != "postgres" && storage != "etcdv3" {
 		t.Skip("skipping TestUpdateKeys for storage %q: not implemented", storage)
 	}
 
@@ -312,6 +312,48 @@ func TestMultipleRegister(t *testing.T) {
 	}
 }
 
+func TestRegisterHTTPRenew(t *testing.T) {
+	confCopy := *conf
+	confCopy.RegisterFunc = func(hk *HelloKite) error {
+		if _, err := hk.Kite.RegisterHTTPRenew(hk.URL); err != nil {
+			hk.Kite.Close()
+			return err
+		}
+
+		if _, err := hk.WaitRegister(15 * time.Second); err != nil {
+			hk.Kite.Close()
+			return err
+		}
+
+		return nil
+	}
+
+	hk, err := NewHelloKite("renew", &confCopy)
+	if err != nil {
+		t.Fatalf("error creating kite: %s", err)
+	}
+	defer hk.Close()
+
+	// Wipe the registration from the storage, the next renewal
+	// is expected to bring it back.
+	if err := kon.storage.Delete(hk.Kite.Kite()); err != nil {
+		t.Fatalf("Delete()=%s", err)
+	}
+
+	if _, err := hk.WaitRegister(2 * HeartbeatInterval); err != nil {
+		t.Fatal(err)
+	}
+
+	kites, err := kon.storage.Get(hk.Kite.Kite().Query())
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	if len(kites) != 1 {
+		t.Fatalf("want 1 kite, got %d", len(kites))
+	}
+}
+
 func TestTokenInvalidation(t *testing.T) {
 	oldval := TokenTTL
 	defer func() {
@@ -499,6 +541,354 @@ func TestGetKites(t *testing.T) {
 	}
 }
 
+func TestActiveColor(t *testing.T) {
+	testName := "colorworker"
+	kiteURL := &url.URL{Scheme: "http", Host: "localhost:4444", Path: "/kite"}
+
+	for _, color := range []string{"blue", "green"} {
+		m := kite.New(testName, "1.0.0")
+		m.Config = conf.Config.Copy()
+		m.Config.Color = color
+		defer m.Close()
+
+		if _, err := m.Register(kiteURL); err != nil {
+			t.Fatalf("Register()=%s", err)
+		}
+	}
+
+	query := &protocol.KontrolQuery{
+		Username:    conf.Config.Username,
+		Environment: conf.Config.Environment,
+		Name:        testName,
+	}
+
+	exp := kite.New("exp", "0.0.1")
+	exp.Config = conf.Config.Copy()
+	defer exp.Close()
+
+	getKites := func(want int) {
+		kites, err := exp.GetKites(query)
+		if err != nil {
+			t.Fatalf("GetKites()=%s", err)
+		}
+		klose(kites)
+
+		if len(kites) != want {
+			t.Fatalf("want len(kites) = %d; got %d", want, len(kites))
+		}
+	}
+
+	setColor := func(color, prev string) error {
+		args := &protocol.ActiveColorArgs{
+			Service:   *query,
+			Color:     color,
+			PrevColor: prev,
+		}
+
+		_, err := exp.TellKontrolWithTimeout("setActiveColor", 4*time.Second, args)
+		return err
+	}
+
+	getKites(2)
+
+	if err := setColor("green", ""); err != nil {
+		t.Fatalf("setActiveColor()=%s", err)
+	}
+
+	getKites(1)
+
+	if err := setColor("blue", "red"); err == nil {
+		t.Fatal("expected setActiveColor to fail for a stale previous color")
+	}
+
+	if err := setColor("blue", "green"); err != nil {
+		t.Fatalf("setActiveColor()=%s", err)
+	}
+
+	getKites(1)
+
+	if err := setColor("", ""); err != nil {
+		t.Fatalf("setActiveColor()=%s", err)
+	}
+
+	getKites(2)
+}
+
+func TestReRegister(t *testing.T) {
+	kiteURL := &url.URL{Scheme: "http", Host: "localhost:4444", Path: "/kite"}
+
+	m := kite.New("reregister", "1.0.0")
+	m.Config = conf.Config.Copy()
+	m.Config.RegistrationCheckInterval = 250 * time.Millisecond
+	defer m.Close()
+
+	reregistered := make(chan struct{}, 1)
+	m.OnReRegister(func(*protocol.RegisterResult) {
+		select {
+		case reregistered <- struct{}{}:
+		default:
+		}
+	})
+
+	if err := m.RegisterForever(kiteURL); err != nil {
+		t.Fatalf("RegisterForever()=%s", err)
+	}
+
+	// Wipe the registration from the storage, as if kontrol lost it.
+	if err := kon.storage.Delete(m.Kite()); err != nil {
+		t.Fatalf("Delete()=%s", err)
+	}
+
+	select {
+	case <-reregistered:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the kite to register again")
+	}
+
+	kites, err := kon.storage.Get(m.Kite().Query())
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	if len(kites) != 1 {
+		t.Fatalf("want 1 kite, got %d", len(kites))
+	}
+}
+
+func TestDelegateToken(t *testing.T) {
+	backend, err := NewHelloKite("backend", conf)
+	if err != nil {
+		t.Fatalf("NewHelloKite()=%s", err)
+	}
+	defer backend.Close()
+
+	backend.Kite.HandleFunc("whoami", func(r *kite.Request) (interface{}, error) {
+		return r.Username + " via " + r.Actor, nil
+	})
+
+	gateway, err := NewHelloKite("gateway", conf)
+	if err != nil {
+		t.Fatalf("NewHelloKite()=%s", err)
+	}
+	defer gateway.Close()
+
+	gateway.Kite.HandleFunc("whoami", func(r *kite.Request) (interface{}, error) {
+		tkn, err := gateway.Kite.GetDelegateToken(r, backend.Kite.Kite())
+		if err != nil {
+			return nil, err
+		}
+
+		c := gateway.Kite.NewClient(backend.URL.String())
+		c.Auth = &kite.Auth{Type: "token", Key: tkn}
+		defer c.Close()
+
+		if err := c.DialTimeout(10 * time.Second); err != nil {
+			return nil, err
+		}
+
+		res, err := c.TellWithTimeout("whoami", 10*time.Second)
+		if err != nil {
+			return nil, err
+		}
+
+		return res.String()
+	})
+
+	user, err := NewHelloKite("user", conf)
+	if err != nil {
+		t.Fatalf("NewHelloKite()=%s", err)
+	}
+	defer user.Close()
+
+	tkn, err := user.Kite.GetToken(gateway.Kite.Kite())
+	if err != nil {
+		t.Fatalf("GetToken()=%s", err)
+	}
+
+	c := user.Kite.NewClient(gateway.URL.String())
+	c.Auth = &kite.Auth{Type: "token", Key: tkn}
+	defer c.Close()
+
+	if err := c.DialTimeout(10 * time.Second); err != nil {
+		t.Fatalf("DialTimeout()=%s", err)
+	}
+
+	res, err := c.TellWithTimeout("whoami", 10*time.Second)
+	if err != nil {
+		t.Fatalf("TellWithTimeout()=%s", err)
+	}
+
+	got, err := res.String()
+	if err != nil {
+		t.Fatalf("String()=%s", err)
+	}
+
+	if want := "user via gateway"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// A token issued for another kite can't be exchanged.
+	_, err = user.Kite.GetDelegateToken(&kite.Request{
+		Client: &kite.Client{Kite: *user.Kite.Kite()},
+		Auth:   &kite.Auth{Type: "token", Key: tkn},
+	}, backend.Kite.Kite())
+	if err == nil {
+		t.Fatal("expected GetDelegateToken to fail for a token of another kite")
+	}
+}
+
+func TestEphemeralKey(t *testing.T) {
+	parent, err := NewHelloKite("ci", conf)
+	if err != nil {
+		t.Fatalf("NewHelloKite()=%s", err)
+	}
+	defer parent.Close()
+
+	res, err := parent.Kite.GetEphemeralKey(3 * time.Second)
+	if err != nil {
+		t.Fatalf("GetEphemeralKey()=%s", err)
+	}
+
+	if ttl := res.ExpiresAt.Sub(time.Now()); ttl <= 0 || ttl > 3*time.Second {
+		t.Fatalf("want expiration in 3s, got %s", ttl)
+	}
+
+	job := kite.New("job", "1.0.0")
+	job.Config = conf.Config.Copy()
+	job.Config.Username = "ci"
+	job.Config.KiteKey = res.KiteKey
+	defer job.Close()
+
+	if _, err := job.GetEphemeralKey(time.Hour); err == nil {
+		t.Fatal("expected ephemeral kite to not get a new ephemeral key")
+	}
+
+	kiteURL := &url.URL{Scheme: "http", Host: "localhost:4444", Path: "/kite"}
+
+	if _, err := job.Register(kiteURL); err != nil {
+		t.Fatalf("Register()=%s", err)
+	}
+
+	kites, err := kon.storage.Get(job.Kite().Query())
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	if len(kites) != 1 {
+		t.Fatalf("want 1 kite, got %d", len(kites))
+	}
+
+	if kites[0].Kite.Username != "ci" {
+		t.Fatalf("want ephemeral kite of user %q, got %q", "ci", kites[0].Kite.Username)
+	}
+
+	// The tokens of the ephemeral kite do not outlive its kite key.
+	tok, err := job.GetToken(parent.Kite.Kite())
+	if err != nil {
+		t.Fatalf("GetToken()=%s", err)
+	}
+
+	claims, err := parent.Kite.ValidateToken(tok)
+	if err != nil {
+		t.Fatalf("ValidateToken()=%s", err)
+	}
+
+	if !claims.Ephemeral || claims.ExpiresAt > res.ExpiresAt.Unix() {
+		t.Fatalf("want ephemeral token expiring by %s, got %+v", res.ExpiresAt, claims)
+	}
+
+	time.Sleep(time.Until(res.ExpiresAt) + time.Second)
+
+	kites, err = kon.storage.Get(job.Kite().Query())
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	if len(kites) != 0 {
+		t.Fatalf("want ephemeral kite to be removed, got %d kites", len(kites))
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	upgraded := make(chan string, 2)
+
+	var fleet []*HelloKite
+
+	for i := 0; i < 2; i++ {
+		hk, err := NewHelloKite("fleet", conf)
+		if err != nil {
+			t.Fatalf("NewHelloKite()=%s", err)
+		}
+		defer hk.Close()
+
+		hk.Kite.HandleFunc("upgrade", func(r *kite.Request) (interface{}, error) {
+			version, err := r.Args.One().String()
+			if err != nil {
+				return nil, err
+			}
+
+			upgraded <- r.Username + " " + version
+			return true, nil
+		})
+
+		fleet = append(fleet, hk)
+	}
+
+	operator, err := NewHelloKite("operator", conf)
+	if err != nil {
+		t.Fatalf("NewHelloKite()=%s", err)
+	}
+	defer operator.Close()
+
+	query := &protocol.KontrolQuery{
+		Username: "fleet",
+		Name:     "fleet",
+	}
+
+	if _, err := operator.Kite.Broadcast(query, "upgrade", "1.2.3"); err == nil {
+		t.Fatal("want broadcast to the kites of another user to fail")
+	}
+
+	res, err := fleet[0].Kite.Broadcast(query, "upgrade", "1.2.3")
+	if err != nil {
+		t.Fatalf("Broadcast()=%s", err)
+	}
+
+	if len(res.Receipts) != 2 {
+		t.Fatalf("want 2 receipts, got %d", len(res.Receipts))
+	}
+
+	for _, receipt := range res.Receipts {
+		if !receipt.Delivered {
+			t.Fatalf("not delivered to %s: %s", &receipt.Kite, receipt.Error)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if got, want := <-upgraded, "fleet 1.2.3"; got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+
+	opts := &kite.BroadcastOptions{Retries: 2}
+
+	res, err = fleet[0].Kite.BroadcastWithOptions(query, "downgrade", nil, opts)
+	if err != nil {
+		t.Fatalf("BroadcastWithOptions()=%s", err)
+	}
+
+	for _, receipt := range res.Receipts {
+		if receipt.Delivered {
+			t.Fatalf("want delivery of unknown method to fail for %s", &receipt.Kite)
+		}
+
+		// The kite is reachable, so there is no point in retrying.
+		if receipt.Attempts != 1 {
+			t.Fatalf("want 1 attempt, got %d", receipt.Attempts)
+		}
+	}
+}
+
 func TestGetToken(t *testing.T) {
 	testName := "mathworker5"
 	testVersion := "1.1.1"
@@ -660,7 +1050,7 @@ func TestGetQueryKey(t *testing.T) {
 }
 
 func TestKontrolMultiKey(t *testing.T) {
-	if storage := os.Getenv("KONTROL_STORAGE"); storage != "postgres" {
+	if storage := os.Getenv("KONTROL_STORAGE"); storage != "postgres" && storage != "etcdv3" {
 		t.Skip("%q storage does not currently implement soft key pair deletes", storage)
 	}
 
@@ -772,3 +1162,52 @@ func TestKontrolMultiKey(t *testing.T) {
 			testkeys.Public, publicKey)
 	}
 }
+
+func TestDuplicateRegister(t *testing.T) {
+	kon.DuplicatePolicy = DuplicateReject
+	defer func() { kon.DuplicatePolicy = DuplicateAlert }()
+
+	duplicates := make(chan string, 1)
+	kon.OnDuplicate = func(_ *protocol.Kite, url, existingURL string) {
+		duplicates <- existingURL
+	}
+	defer func() { kon.OnDuplicate = nil }()
+
+	newKite := func() *kite.Kite {
+		k := kite.New("cloned", "1.0.0")
+		k.Config = conf.Config.Copy()
+		k.Id = "11111111-2222-3333-4444-555555555555"
+		return k
+	}
+
+	original := newKite()
+	defer original.Close()
+
+	originalURL := &url.URL{Scheme: "http", Host: "10.0.0.1:4444", Path: "/kite"}
+
+	if _, err := original.Register(originalURL); err != nil {
+		t.Fatalf("Register()=%s", err)
+	}
+
+	clone := newKite()
+	defer clone.Close()
+
+	_, err := clone.Register(&url.URL{Scheme: "http", Host: "10.0.0.2:4444", Path: "/kite"})
+	if err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Fatalf("want duplicate to be rejected, got %v", err)
+	}
+
+	select {
+	case existingURL := <-duplicates:
+		if existingURL != originalURL.String() {
+			t.Fatalf("got existing URL %q, want %q", existingURL, originalURL)
+		}
+	default:
+		t.Fatal("want OnDuplicate to be called")
+	}
+
+	// Registering again from the same URL is not a conflict.
+	if _, err := original.Register(originalURL); err != nil {
+		t.Fatalf("Register()=%s", err)
+	}
+}
@@ -1,7 +1,6 @@
 package kontrol
 
 import (
-	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -61,34 +60,23 @@ func (n *Node) Kite() (*protocol.KiteWithToken, error) {
 		Kite:  *kite,
 		URL:   val.URL,
 		KeyID: val.KeyID,
+		Color: val.Color,
 	}, nil
 }
 
 // KiteFromKey returns a *protocol.Kite from an etcd key. etcd key is like:
 // "/kites/devrim/env/mathworker/1/localhost/tardis.local/id"
 func (n *Node) KiteFromKey() (*protocol.Kite, error) {
-	// TODO replace "kites" with KitesPrefix constant
-	fields := strings.Split(strings.TrimPrefix(n.Node.Key, "/"), "/")
-	if len(fields) != 8 || (len(fields) > 0 && fields[0] != "kites") {
+	if !strings.HasPrefix(n.Node.Key, KitesPrefix+"/") {
 		return nil, fmt.Errorf("kontrol: invalid kite %s", n.Node.Key)
 	}
 
-	return &protocol.Kite{
-		Username:    fields[1],
-		Environment: fields[2],
-		Name:        fields[3],
-		Version:     fields[4],
-		Region:      fields[5],
-		Hostname:    fields[6],
-		ID:          fields[7],
-	}, nil
+	return PathKeys{}.ParseKiteKey(strings.TrimPrefix(n.Node.Key, KitesPrefix))
 }
 
 // Value returns the value associated with the current node.
 func (n *Node) Value() (kontrolprotocol.RegisterValue, error) {
-	var rv kontrolprotocol.RegisterValue
-	err := json.Unmarshal([]byte(n.Node.Value), &rv)
-	return rv, err
+	return decodeValue(n.Node.Value)
 }
 
 // Kites returns a list of kites that are gathered by collecting recursively
@@ -39,8 +39,10 @@ type Postgres struct {
 }
 
 var (
-	_ Storage        = (*Postgres)(nil)
-	_ KeyPairStorage = (*Postgres)(nil)
+	_ Storage           = (*Postgres)(nil)
+	_ KeyPairStorage    = (*Postgres)(nil)
+	_ ColorStorage      = (*Postgres)(nil)
+	_ RevocationStorage = (*Postgres)(nil)
 )
 
 func NewPostgres(conf *PostgresConfig, log kite.Logger) *Postgres {
@@ -182,6 +184,7 @@ func (p *Postgres) Get(query *protocol.KontrolQuery) (Kites, error) {
 		updated_at  time.Time
 		created_at  time.Time
 		keyId       string
+		color       string
 	)
 
 	kites := make(Kites, 0)
@@ -199,6 +202,7 @@ func (p *Postgres) Get(query *protocol.KontrolQuery) (Kites, error) {
 			&updated_at,
 			&created_at,
 			&keyId,
+			&color,
 		)
 		if err != nil {
 			return nil, err
@@ -216,6 +220,7 @@ func (p *Postgres) Get(query *protocol.KontrolQuery) (Kites, error) {
 			},
 			URL:   url,
 			KeyID: keyId,
+			Color: color,
 		})
 	}
 
@@ -267,8 +272,8 @@ func (p *Postgres) Upsert(kiteProt *protocol.Kite, value *kontrolprotocol.Regist
 		}
 	}()
 
-	res, err := tx.Exec(`UPDATE kite.kite SET url = $1, key_id = $3, updated_at = (now() at time zone 'utc') WHERE id = $2`,
-		value.URL, kiteProt.ID, value.KeyID)
+	res, err := tx.Exec(`UPDATE kite.kite SET url = $1, key_id = $3, color = $4, updated_at = (now() at time zone 'utc') WHERE id = $2`,
+		value.URL, kiteProt.ID, value.KeyID, value.Color)
 	if err != nil {
 		return err
 	}
@@ -283,7 +288,7 @@ func (p *Postgres) Upsert(kiteProt *protocol.Kite, value *kontrolprotocol.Regist
 		return nil
 	}
 
-	insertSQL, args, err := insertKiteQuery(kiteProt, value.URL, value.KeyID)
+	insertSQL, args, err := insertKiteQuery(kiteProt, value)
 	if err != nil {
 		return err
 	}
@@ -299,7 +304,7 @@ func (p *Postgres) Add(kiteProt *protocol.Kite, value *kontrolprotocol.RegisterV
 		return err
 	}
 
-	sqlQuery, args, err := insertKiteQuery(kiteProt, value.URL, value.KeyID)
+	sqlQuery, args, err := insertKiteQuery(kiteProt, value)
 	if err != nil {
 		return err
 	}
@@ -335,22 +340,17 @@ func selectQuery(query *protocol.KontrolQuery) (string, []interface{}, error) {
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
 	kites := psql.Select("*").From("kite.kite")
-	fields := query.Fields()
 	andQuery := sq.And{}
 
-	// we stop for the first empty value
-	for _, key := range keyOrder {
-		v := fields[key]
-		if v == "" {
-			continue
-		}
+	for _, field := range QueryFields(query) {
+		column := field.Name
 
 		// we are using "kitename" as the columname
-		if key == "name" {
-			key = "kitename"
+		if column == "name" {
+			column = "kitename"
 		}
 
-		andQuery = append(andQuery, sq.Eq{key: v})
+		andQuery = append(andQuery, sq.Eq{column: field.Value})
 	}
 
 	if len(andQuery) == 0 {
@@ -360,8 +360,8 @@ func selectQuery(query *protocol.KontrolQuery) (string, []interface{}, error) {
 	return kites.Where(andQuery).ToSql()
 }
 
-// inseryKiteQuery inserts the given kite, url and key to the kite.kite table
-func insertKiteQuery(kiteProt *protocol.Kite, url, keyId string) (string, []interface{}, error) {
+// inseryKiteQuery inserts the given kite, url, key and color to the kite.kite table
+func insertKiteQuery(kiteProt *protocol.Kite, value *kontrolprotocol.RegisterValue) (string, []interface{}, error) {
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
 	kiteValues := kiteProt.Values()
@@ -371,8 +371,9 @@ func insertKiteQuery(kiteProt *protocol.Kite, url, keyId string) (string, []inte
 		values[i] = kiteVal
 	}
 
-	values = append(values, url)
-	values = append(values, keyId)
+	values = append(values, value.URL)
+	values = append(values, value.KeyID)
+	values = append(values, value.Color)
 
 	return psql.Insert("kite.kite").Columns(
 		"username",
@@ -384,11 +385,139 @@ func insertKiteQuery(kiteProt *protocol.Kite, url, keyId string) (string, []inte
 		"id",
 		"url",
 		"key_id",
+		"color",
 	).Values(values...).ToSql()
 }
 
 /*
 
+--- Color -----------------
+
+*/
+
+func (p *Postgres) GetColor(service string) (string, error) {
+	var color string
+
+	err := p.DB.QueryRow(`SELECT color FROM kite.color WHERE service = $1`, service).Scan(&color)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return color, err
+}
+
+func (p *Postgres) SetColor(service, color, prev string) (old string, err error) {
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	// lock the row, so concurrent flips of the same service are serialized
+	err = tx.QueryRow(`SELECT color FROM kite.color WHERE service = $1 FOR UPDATE`, service).Scan(&old)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	if prev != "" && old != prev {
+		return "", ErrColorChanged
+	}
+
+	if color == "" {
+		_, err = tx.Exec(`DELETE FROM kite.color WHERE service = $1`, service)
+		return old, err
+	}
+
+	res, err := tx.Exec(`UPDATE kite.color SET color = $2, updated_at = (now() at time zone 'utc') WHERE service = $1`,
+		service, color)
+	if err != nil {
+		return "", err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n != 0 {
+		return old, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO kite.color (service, color) VALUES ($1, $2)`, service, color)
+	return old, err
+}
+
+/*
+
+--- Revoked Tokens -----------------
+
+*/
+
+func (p *Postgres) RevokeTokens(tokens []protocol.RevokedToken) error {
+	for _, tok := range tokens {
+		until := revokedUntil(tok).UTC()
+
+		res, err := p.DB.Exec(`UPDATE kite.revoked SET expires_at = $2 WHERE id = $1 AND expires_at < $2`,
+			tok.ID, until)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n != 0 {
+			continue
+		}
+
+		// the row may exist with a later expiration, which is kept
+		_, err = p.DB.Exec(`INSERT INTO kite.revoked (id, expires_at)
+			SELECT $1, $2 WHERE NOT EXISTS (SELECT 1 FROM kite.revoked WHERE id = $1)`,
+			tok.ID, until)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the expired revocations are of no use anymore
+	_, err := p.DB.Exec(`DELETE FROM kite.revoked WHERE expires_at < (now() at time zone 'utc')`)
+	return err
+}
+
+func (p *Postgres) RevokedTokens() ([]protocol.RevokedToken, error) {
+	rows, err := p.DB.Query(`SELECT id, expires_at FROM kite.revoked WHERE expires_at > (now() at time zone 'utc')`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []protocol.RevokedToken
+
+	for rows.Next() {
+		var (
+			id        string
+			expiresAt time.Time
+		)
+
+		if err := rows.Scan(&id, &expiresAt); err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, protocol.RevokedToken{
+			ID:        id,
+			ExpiresAt: expiresAt.Unix(),
+		})
+	}
+
+	return tokens, rows.Err()
+}
+
+/*
+
 --- Key Pair -----------------
 
 */
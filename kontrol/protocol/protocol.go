@@ -9,4 +9,7 @@ type RegisterValue struct {
 	// This is currently only used by Kontrol itself internally, however it
 	// might be changed in the future.
 	KeyID string `json:"key_id"`
+
+	// Color is the deployment color the kite registered with.
+	Color string `json:"color,omitempty"`
 }
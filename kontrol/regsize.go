@@ -0,0 +1,140 @@
+package kontrol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	kontrolprotocol "github.com/koding/kite/kontrol/protocol"
+	"github.com/koding/kite/protocol"
+)
+
+// DefaultMaxRegistrationSize is the default limit of the registration
+// payload size, see Kontrol.MaxRegistrationSize.
+const DefaultMaxRegistrationSize = 1 << 20
+
+// compressedPrefix marks values which are stored compressed. JSON encoded
+// values always start with '{', so the two never clash.
+const compressedPrefix = "gz:"
+
+// RegistrationSizeError is returned when the registration payload of a kite
+// is too large to be stored.
+type RegistrationSizeError struct {
+	Kite string // kite key
+	Size int    // size of the payload in bytes
+	Max  int    // the limit in bytes
+}
+
+func (e *RegistrationSizeError) Error() string {
+	return fmt.Sprintf("registration of %s is %d bytes, which exceeds the limit of %d bytes",
+		e.Kite, e.Size, e.Max)
+}
+
+// checkRegistrationSize returns a *RegistrationSizeError if the size of the
+// kite key together with the registered value exceeds MaxRegistrationSize.
+func (k *Kontrol) checkRegistrationSize(remoteKite *protocol.Kite, value *kontrolprotocol.RegisterValue) error {
+	max := k.MaxRegistrationSize
+	if max == 0 {
+		max = DefaultMaxRegistrationSize
+	}
+
+	if max < 0 {
+		return nil
+	}
+
+	p, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if size := len(remoteKite.String()) + len(p); size > max {
+		return &RegistrationSizeError{
+			Kite: remoteKite.String(),
+			Size: size,
+			Max:  max,
+		}
+	}
+
+	return nil
+}
+
+// registerError converts the error of storing a registration to the one
+// sent back to the kite. Errors the kite can act upon are passed as is,
+// others are hidden behind a generic message.
+func registerError(err error) error {
+	if e, ok := err.(*RegistrationSizeError); ok {
+		return e
+	}
+
+	return errors.New("internal error - register")
+}
+
+// encodeValue encodes the register value for storing in etcd. Values larger
+// than compressSize are gzipped, a *RegistrationSizeError is returned if the
+// result is still larger than maxSize.
+func encodeValue(k *protocol.Kite, v *kontrolprotocol.RegisterValue, compressSize, maxSize int) (string, error) {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	if len(p) <= compressSize {
+		return string(p), nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(compressedPrefix)
+
+	enc := base64.NewEncoder(base64.StdEncoding, &buf)
+	gz := gzip.NewWriter(enc)
+
+	if _, err := gz.Write(p); err != nil {
+		return "", err
+	}
+
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+
+	if buf.Len() > maxSize {
+		return "", &RegistrationSizeError{
+			Kite: k.String(),
+			Size: buf.Len(),
+			Max:  maxSize,
+		}
+	}
+
+	return buf.String(), nil
+}
+
+// decodeValue decodes the register value stored by encodeValue.
+func decodeValue(s string) (kontrolprotocol.RegisterValue, error) {
+	var rv kontrolprotocol.RegisterValue
+
+	p := []byte(s)
+
+	if strings.HasPrefix(s, compressedPrefix) {
+		dec := base64.NewDecoder(base64.StdEncoding, strings.NewReader(s[len(compressedPrefix):]))
+
+		gz, err := gzip.NewReader(dec)
+		if err != nil {
+			return rv, err
+		}
+
+		if p, err = ioutil.ReadAll(gz); err != nil {
+			return rv, err
+		}
+	}
+
+	err := json.Unmarshal(p, &rv)
+	return rv, err
+}
@@ -0,0 +1,51 @@
+package kontrol
+
+import (
+	"strings"
+	"testing"
+
+	kontrolprotocol "github.com/koding/kite/kontrol/protocol"
+	"github.com/koding/kite/protocol"
+)
+
+func TestEncodeValue(t *testing.T) {
+	k := &protocol.Kite{
+		Username:    "devrim",
+		Environment: "test",
+		Name:        "mathworker",
+		Version:     "1.0.0",
+		Region:      "localhost",
+		Hostname:    "localhost",
+		ID:          "1234",
+	}
+
+	cases := []*kontrolprotocol.RegisterValue{
+		{URL: "http://localhost:4444/kite", KeyID: "key"},
+		{URL: "http://localhost:4444/kite?" + strings.Repeat("q=1&", 4096), KeyID: "key"},
+	}
+
+	for i, want := range cases {
+		s, err := encodeValue(k, want, etcdCompressSize, etcdMaxValueSize)
+		if err != nil {
+			t.Fatalf("%d: encodeValue()=%s", i, err)
+		}
+
+		if compressed := strings.HasPrefix(s, compressedPrefix); compressed != (i == 1) {
+			t.Errorf("%d: got compressed=%t", i, compressed)
+		}
+
+		got, err := decodeValue(s)
+		if err != nil {
+			t.Fatalf("%d: decodeValue()=%s", i, err)
+		}
+
+		if got != *want {
+			t.Errorf("%d: got %+v, want %+v", i, got, want)
+		}
+	}
+
+	_, err := encodeValue(k, cases[1], 0, 16)
+	if _, ok := err.(*RegistrationSizeError); !ok {
+		t.Fatalf("got %T, want *RegistrationSizeError", err)
+	}
+}
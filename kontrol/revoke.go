@@ -0,0 +1,196 @@
+package kontrol
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+)
+
+// RevocationStorage keeps the tokens revoked with the "revokeTokens" method,
+// so they are rejected by every Kontrol instance sharing the storage.
+type RevocationStorage interface {
+	// RevokeTokens stores the revocations of the tokens, which are kept
+	// until the tokens expire.
+	RevokeTokens(tokens []protocol.RevokedToken) error
+
+	// RevokedTokens returns the revoked tokens, which have not
+	// expired yet.
+	RevokedTokens() ([]protocol.RevokedToken, error)
+}
+
+// MemRevocationStorage is an in-memory RevocationStorage. It is used by
+// default, when no other revocation storage is set.
+type MemRevocationStorage struct {
+	mu     sync.Mutex
+	tokens map[string]int64
+}
+
+var _ RevocationStorage = (*MemRevocationStorage)(nil)
+
+// NewMemRevocationStorage returns a new, empty in-memory revocation storage.
+func NewMemRevocationStorage() *MemRevocationStorage {
+	return &MemRevocationStorage{
+		tokens: make(map[string]int64),
+	}
+}
+
+func (m *MemRevocationStorage) RevokeTokens(tokens []protocol.RevokedToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, tok := range tokens {
+		m.tokens[tok.ID] = revokedUntil(tok).Unix()
+	}
+
+	return nil
+}
+
+func (m *MemRevocationStorage) RevokedTokens() ([]protocol.RevokedToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().Unix()
+	tokens := make([]protocol.RevokedToken, 0, len(m.tokens))
+
+	for id, expiresAt := range m.tokens {
+		if expiresAt < now {
+			delete(m.tokens, id)
+			continue
+		}
+
+		tokens = append(tokens, protocol.RevokedToken{ID: id, ExpiresAt: expiresAt})
+	}
+
+	return tokens, nil
+}
+
+// revokedUntil gives the time the revocation of the token is kept until,
+// the tokens of unknown expiration time are kept for TokenTTL.
+func revokedUntil(tok protocol.RevokedToken) time.Time {
+	if tok.ExpiresAt != 0 {
+		return time.Unix(tok.ExpiresAt, 0)
+	}
+
+	return time.Now().Add(TokenTTL)
+}
+
+// SetRevocationStorage sets the backend storage that kontrol is going to use
+// to store the revoked tokens.
+func (k *Kontrol) SetRevocationStorage(storage RevocationStorage) {
+	k.revocations = storage
+}
+
+func (k *Kontrol) revocationStorage() RevocationStorage {
+	k.revocationsOnce.Do(func() {
+		if k.revocations != nil {
+			return
+		}
+
+		if rs, ok := k.storage.(RevocationStorage); ok {
+			k.revocations = rs
+			return
+		}
+
+		k.log.Warning("Revocation storage is not set. Using in memory cache")
+		k.revocations = NewMemRevocationStorage()
+	})
+
+	return k.revocations
+}
+
+// HandleRevokeTokens revokes the given tokens, so they are rejected by
+// Kontrol and by the kites fetching the revoked tokens with the
+// "getRevokedTokens" method. Only the kontrol user is allowed to do so.
+//
+// The revocations are kept in the revocation storage, the other Kontrol
+// instances load them every RevocationSyncInterval.
+func (k *Kontrol) HandleRevokeTokens(r *kite.Request) (interface{}, error) {
+	if r.Username != k.Kite.Kite().Username {
+		return nil, fmt.Errorf("%q is not allowed to revoke tokens", r.Username)
+	}
+
+	if r.Args == nil {
+		return nil, errors.New("empty arguments")
+	}
+
+	var args protocol.RevokeTokensArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if err := k.revocationStorage().RevokeTokens(args.Tokens); err != nil {
+		k.log.Error("storage revoke tokens error: %s", err)
+		return nil, errors.New("internal error - revokeTokens")
+	}
+
+	k.revokeTokens(args.Tokens)
+
+	k.log.Info("%d tokens revoked by %q", len(args.Tokens), r.Username)
+
+	return nil, nil
+}
+
+// HandleGetRevokedTokens returns the tokens revoked with "revokeTokens",
+// which have not expired yet.
+func (k *Kontrol) HandleGetRevokedTokens(r *kite.Request) (interface{}, error) {
+	tokens, err := k.revocationStorage().RevokedTokens()
+	if err != nil {
+		k.log.Error("storage revoked tokens error: %s", err)
+		return nil, errors.New("internal error - getRevokedTokens")
+	}
+
+	k.revokeTokens(tokens)
+
+	return &protocol.RevokedTokensResult{
+		Tokens: tokens,
+	}, nil
+}
+
+// revokeTokens makes the Kontrol kite reject the tokens and stops handing
+// out the cached ones.
+func (k *Kontrol) revokeTokens(tokens []protocol.RevokedToken) {
+	k.Kite.RevokeTokens(tokens...)
+
+	ids := make(map[string]bool, len(tokens))
+	for _, tok := range tokens {
+		ids[tok.ID] = true
+	}
+
+	k.tokenCacheMu.Lock()
+	defer k.tokenCacheMu.Unlock()
+
+	for key, ct := range k.tokenCache {
+		if ids[ct.id] {
+			ct.timer.Stop()
+			delete(k.tokenCache, key)
+		}
+	}
+}
+
+// syncRevokedTokens loads the tokens revoked at the other Kontrol instances
+// from the storage periodically, until Kontrol is closed.
+func (k *Kontrol) syncRevokedTokens() {
+	ticker := time.NewTicker(k.revocationSyncInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-k.closed:
+			return
+		}
+
+		tokens, err := k.revocationStorage().RevokedTokens()
+		if err != nil {
+			k.log.Warning("Cannot load revoked tokens: %s", err)
+			continue
+		}
+
+		k.revokeTokens(tokens)
+	}
+}
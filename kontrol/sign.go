@@ -0,0 +1,79 @@
+package kontrol
+
+import (
+	"crypto/rsa"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/protocol"
+)
+
+// signResult signs the result of the getKites query, so the caller can
+// verify it has not been tampered with, see protocol.ResultClaims.
+// The result is left unsigned if there is no key pair to sign it with.
+func (k *Kontrol) signResult(r *kite.Request, args *protocol.GetKitesArgs, result *protocol.GetKitesResult) error {
+	keyPair := k.resultKeyPair(r)
+	if keyPair == nil {
+		return nil
+	}
+
+	digest, err := result.Digest()
+	if err != nil {
+		return err
+	}
+
+	rsaPrivate, err := k.signingKey(keyPair)
+	if err != nil {
+		return err
+	}
+
+	claims := &protocol.ResultClaims{
+		Nonce:  args.Nonce,
+		Digest: digest,
+	}
+
+	result.Signature, err = jwt.NewWithClaims(jwt.GetSigningMethod("RS256"), claims).SignedString(rsaPrivate)
+	return err
+}
+
+// signingKey returns the parsed private key of the key pair, which is
+// parsed once and cached.
+func (k *Kontrol) signingKey(keyPair *KeyPair) (*rsa.PrivateKey, error) {
+	if key, ok := k.signingKeys.Load(keyPair.Private); ok {
+		return key.(*rsa.PrivateKey), nil
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(keyPair.Private))
+	if err != nil {
+		return nil, err
+	}
+
+	k.signingKeys.Store(keyPair.Private, key)
+
+	return key, nil
+}
+
+// resultKeyPair gives the key pair the results of the caller are signed
+// with. The kites verify them with the key of their kite keys, so it is
+// preferred over the key pair of Kontrol.
+func (k *Kontrol) resultKeyPair(r *kite.Request) *KeyPair {
+	if r.Auth != nil && r.Auth.Type == "kiteKey" {
+		ex := &kitekey.Extractor{
+			Claims: &kitekey.KiteClaims{},
+		}
+
+		if _, err := jwt.ParseWithClaims(r.Auth.Key, ex.Claims, ex.Extract); err == nil && ex.Claims.KontrolKey != "" {
+			if keyPair, err := k.keyPair.GetKeyFromPublic(ex.Claims.KontrolKey); err == nil {
+				return keyPair
+			}
+		}
+	}
+
+	keyPair, err := k.KeyPair()
+	if err != nil {
+		return nil
+	}
+
+	return keyPair
+}
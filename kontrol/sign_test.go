@@ -0,0 +1,55 @@
+package kontrol
+
+import (
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+	"github.com/koding/kite/testkeys"
+)
+
+func TestKontrol_SignResult(t *testing.T) {
+	k := &Kontrol{
+		selfKeyPair: &KeyPair{
+			ID:      "test",
+			Public:  testkeys.Public,
+			Private: testkeys.Private,
+		},
+	}
+
+	args := &protocol.GetKitesArgs{Nonce: "nonce"}
+	result := &protocol.GetKitesResult{
+		Kites: []*protocol.KiteWithToken{{
+			Kite: protocol.Kite{Name: "math", ID: "1"},
+			URL:  "http://127.0.0.1:4000/kite",
+		}},
+	}
+
+	if err := k.signResult(&kite.Request{}, args, result); err != nil {
+		t.Fatalf("signResult()=%s", err)
+	}
+
+	public, err := jwt.ParseRSAPublicKeyFromPEM([]byte(testkeys.Public))
+	if err != nil {
+		t.Fatalf("ParseRSAPublicKeyFromPEM()=%s", err)
+	}
+
+	var claims protocol.ResultClaims
+
+	_, err = jwt.ParseWithClaims(result.Signature, &claims, func(*jwt.Token) (interface{}, error) {
+		return public, nil
+	})
+	if err != nil {
+		t.Fatalf("ParseWithClaims()=%s", err)
+	}
+
+	digest, err := result.Digest()
+	if err != nil {
+		t.Fatalf("Digest()=%s", err)
+	}
+
+	if claims.Nonce != "nonce" || claims.Digest != digest {
+		t.Fatalf("got claims %+v, want nonce %q and digest %q", claims, "nonce", digest)
+	}
+}
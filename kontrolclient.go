@@ -2,16 +2,21 @@
 package kite
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/rand"
 	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/kitekey"
 	"github.com/koding/kite/protocol"
+	"github.com/koding/kite/utils"
 )
 
 const (
@@ -44,6 +49,9 @@ type kontrolClient struct {
 
 type registerResult struct {
 	URL *url.URL
+
+	result    *protocol.RegisterResult
+	heartbeat time.Duration // only for HTTP registrations
 }
 
 // SetupKontrolClient setups and prepares a the kontrol instance. It connects
@@ -51,6 +59,10 @@ type registerResult struct {
 // is called internally whenever a kontrol client specific action is taking.
 // However if you wish to connect earlier you may call this method.
 func (k *Kite) SetupKontrolClient() error {
+	if k.Config.LocalMode {
+		return ErrLocalMode
+	}
+
 	if k.kontrol.Client != nil {
 		return nil // already prepared
 	}
@@ -98,6 +110,10 @@ func (k *Kite) SetupKontrolClient() error {
 		return err
 	}
 
+	if k.Config.RevocationSyncInterval > 0 {
+		go k.syncRevokedTokens(client.closeChan)
+	}
+
 	return nil
 }
 
@@ -122,11 +138,20 @@ func (k *Kite) SetupKontrolClient() error {
 //   return clients[0]
 //
 func (k *Kite) GetKites(query *protocol.KontrolQuery) ([]*Client, error) {
+	if k.Config.LocalMode {
+		clients := k.localKites(query)
+		if len(clients) == 0 {
+			return nil, ErrNoKitesAvailable
+		}
+
+		return clients, nil
+	}
+
 	if err := k.SetupKontrolClient(); err != nil {
 		return nil, err
 	}
 
-	clients, err := k.getKites(protocol.GetKitesArgs{Query: query})
+	clients, err := k.getKites(protocol.GetKitesArgs{Query: query, Compress: true})
 	if err != nil {
 		return nil, err
 	}
@@ -142,6 +167,8 @@ func (k *Kite) GetKites(query *protocol.KontrolQuery) ([]*Client, error) {
 func (k *Kite) getKites(args protocol.GetKitesArgs) ([]*Client, error) {
 	<-k.kontrol.readyConnected
 
+	args.Nonce = utils.RandomString(16)
+
 	response, err := k.kontrol.TellWithTimeout("getKites", k.Config.Timeout, args)
 	if err != nil {
 		return nil, err
@@ -153,6 +180,14 @@ func (k *Kite) getKites(args protocol.GetKitesArgs) ([]*Client, error) {
 		return nil, err
 	}
 
+	if err := result.Decompress(); err != nil {
+		return nil, err
+	}
+
+	if err := k.verifyResult(args.Nonce, result); err != nil {
+		return nil, err
+	}
+
 	clients := make([]*Client, len(result.Kites))
 	for i, currentKite := range result.Kites {
 		auth := &Auth{
@@ -165,6 +200,18 @@ func (k *Kite) getKites(args protocol.GetKitesArgs) ([]*Client, error) {
 		clients[i].Auth = auth
 	}
 
+	// Share the tokens with the clients of the same audience and renew
+	// them in background.
+	if k.Config.TokenCache {
+		for _, c := range clients {
+			if err := k.tokenCache().add(c); err != nil {
+				k.Log.Error("Error in token. Token will not be renewed when it expires: %s", err)
+			}
+		}
+
+		return clients, nil
+	}
+
 	// Renew tokens
 	for _, c := range clients {
 		token, err := NewTokenRenewer(c, k)
@@ -175,6 +222,7 @@ func (k *Kite) getKites(args protocol.GetKitesArgs) ([]*Client, error) {
 
 		token.RenewWhenExpires()
 		c.closeRenewer = token.disconnect
+		c.tokenRenewer = token
 	}
 
 	return clients, nil
@@ -185,11 +233,21 @@ func (k *Kite) getKites(args protocol.GetKitesArgs) ([]*Client, error) {
 // In case of calling GetToken multiple times, it usually
 // returns the same token until it expires on Kontrol side.
 func (k *Kite) GetToken(kite *protocol.Kite) (string, error) {
+	return k.getToken(context.Background(), kite)
+}
+
+// getToken is like GetToken, the ctx bounds waiting for the connection
+// to Kontrol.
+func (k *Kite) getToken(ctx context.Context, kite *protocol.Kite) (string, error) {
 	if err := k.SetupKontrolClient(); err != nil {
 		return "", err
 	}
 
-	<-k.kontrol.readyConnected
+	select {
+	case <-k.kontrol.readyConnected:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
 
 	result, err := k.kontrol.TellWithTimeout("getToken", k.Config.Timeout, kite)
 	if err != nil {
@@ -205,6 +263,43 @@ func (k *Kite) GetToken(kite *protocol.Kite) (string, error) {
 	return tkn, nil
 }
 
+// GetDelegateToken exchanges the token of the request at Kontrol for a token
+// that allows calling the given kite on behalf of the requesting user.
+// Gateway kites should use it instead of forwarding the user's token, which
+// grants access to many more kites.
+//
+// The request must be authenticated with a token. The remote kite sees the
+// user as Request.Username and the local kite as Request.Actor.
+func (k *Kite) GetDelegateToken(r *Request, kite *protocol.Kite) (string, error) {
+	if r.Auth == nil || r.Auth.Type != "token" {
+		return "", errors.New("request is not authenticated with a token")
+	}
+
+	if err := k.SetupKontrolClient(); err != nil {
+		return "", err
+	}
+
+	<-k.kontrol.readyConnected
+
+	args := &protocol.DelegateTokenArgs{
+		KontrolQuery: *kite.Query(),
+		Token:        r.Auth.Key,
+	}
+
+	result, err := k.kontrol.TellWithTimeout("getDelegateToken", k.Config.Timeout, args)
+	if err != nil {
+		return "", err
+	}
+
+	var tkn string
+	err = result.Unmarshal(&tkn)
+	if err != nil {
+		return "", err
+	}
+
+	return tkn, nil
+}
+
 // GetTokenForce is used to obtain a new token for the given kite.
 //
 // It always returns a new token and forces a Kontrol to
@@ -244,6 +339,69 @@ func (k *Kite) GetKey() (string, error) {
 		return "", err
 	}
 
+	key, err := k.fetchKey()
+	if err != nil {
+		return "", err
+	}
+
+	k.configMu.Lock()
+	k.Config.KontrolKey = key
+	k.configMu.Unlock()
+
+	return key, nil
+}
+
+// KeyMismatchError is returned by VerifyKiteKey when the kite key was
+// signed with a different key than the one Kontrol currently trusts.
+type KeyMismatchError struct {
+	Local  string // fingerprint of the key in the kontrolKey claim
+	Remote string // fingerprint of the key returned by Kontrol
+}
+
+func (e *KeyMismatchError) Error() string {
+	return fmt.Sprintf("kite key is signed with kontrol key %s, kontrol uses %s", e.Local, e.Remote)
+}
+
+// VerifyKiteKey checks the kite key against Kontrol. It returns an error
+// if Kontrol does not accept the key, or *KeyMismatchError if the key was
+// signed with a Kontrol key which is not used anymore. Unlike GetKey,
+// the key the kite uses is not replaced.
+func (k *Kite) VerifyKiteKey() error {
+	k.configMu.RLock()
+	kontrolKey := k.Config.KontrolKey
+	k.configMu.RUnlock()
+
+	local, err := kitekey.PublicKeyFingerprint(kontrolKey)
+	if err != nil {
+		return fmt.Errorf("invalid kontrol key: %s", err)
+	}
+
+	if err := k.SetupKontrolClient(); err != nil {
+		return err
+	}
+
+	key, err := k.fetchKey()
+	if err != nil {
+		return err
+	}
+
+	remote, err := kitekey.PublicKeyFingerprint(key)
+	if err != nil {
+		return fmt.Errorf("invalid kontrol key: %s", err)
+	}
+
+	if local != remote {
+		return &KeyMismatchError{
+			Local:  local,
+			Remote: remote,
+		}
+	}
+
+	return nil
+}
+
+// fetchKey gets the public key Kontrol uses for the kite key.
+func (k *Kite) fetchKey() (string, error) {
 	<-k.kontrol.readyConnected
 
 	result, err := k.kontrol.TellWithTimeout("getKey", k.Config.Timeout)
@@ -252,18 +410,117 @@ func (k *Kite) GetKey() (string, error) {
 	}
 
 	var key string
-	err = result.Unmarshal(&key)
-	if err != nil {
+	if err := result.Unmarshal(&key); err != nil {
 		return "", err
 	}
 
-	k.configMu.Lock()
-	k.Config.KontrolKey = key
-	k.configMu.Unlock()
-
 	return key, nil
 }
 
+// GetEphemeralKey obtains from Kontrol a short-lived kite key for the
+// user of the kite, which expires after the given TTL. Kontrol may
+// shorten the TTL.
+//
+// The key is meant for kites that should not keep a kite.key on disk,
+// like CI jobs or serverless invocations. It can be given to them with
+// KITE_KEY environment variable. Once the key expires, the kites using it
+// are removed from Kontrol.
+func (k *Kite) GetEphemeralKey(ttl time.Duration) (*protocol.EphemeralKeyResult, error) {
+	if err := k.SetupKontrolClient(); err != nil {
+		return nil, err
+	}
+
+	<-k.kontrol.readyConnected
+
+	args := &protocol.EphemeralKeyArgs{
+		TTL: ttl,
+	}
+
+	result, err := k.kontrol.TellWithTimeout("getEphemeralKey", k.Config.Timeout, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var res protocol.EphemeralKeyResult
+	err = result.Unmarshal(&res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// BroadcastOptions configures BroadcastWithOptions.
+type BroadcastOptions struct {
+	// Timeout is the timeout of a single delivery attempt. The default is
+	// Kontrol's Config.Timeout, the maximum is kontrol.BroadcastMaxTimeout.
+	Timeout time.Duration
+
+	// Retries is the number of times the delivery to an unreachable kite
+	// is retried, waiting RetryInterval between the attempts, up to
+	// kontrol.BroadcastMaxRetries. The default interval is one second.
+	Retries       int
+	RetryInterval time.Duration
+}
+
+// Broadcast asks Kontrol to call the method with the given argument on all
+// the kites matching the query, e.g. to tell the whole fleet to upgrade.
+// A nil args calls the method without arguments.
+//
+// The kites are called on behalf of the user of this kite, which can
+// broadcast only to its own kites. If the query has no username, it's
+// the one of this kite. The call blocks until all the kites are tried,
+// the result contains delivery receipts for each of them.
+func (k *Kite) Broadcast(query *protocol.KontrolQuery, method string, args interface{}) (*protocol.BroadcastResult, error) {
+	return k.BroadcastWithOptions(query, method, args, nil)
+}
+
+// BroadcastWithOptions does the same thing with Broadcast() method except it
+// takes options to configure timeouts and retries of the delivery.
+func (k *Kite) BroadcastWithOptions(query *protocol.KontrolQuery, method string, args interface{}, opts *BroadcastOptions) (*protocol.BroadcastResult, error) {
+	if opts == nil {
+		opts = &BroadcastOptions{}
+	}
+
+	bargs := &protocol.BroadcastArgs{
+		Query:         query,
+		Method:        method,
+		Timeout:       opts.Timeout,
+		Retries:       opts.Retries,
+		RetryInterval: opts.RetryInterval,
+	}
+
+	if args != nil {
+		p, err := json.Marshal(args)
+		if err != nil {
+			return nil, err
+		}
+
+		bargs.Args = p
+	}
+
+	if err := k.SetupKontrolClient(); err != nil {
+		return nil, err
+	}
+
+	<-k.kontrol.readyConnected
+
+	// Delivering to many kites takes a while, so wait for Kontrol
+	// without a timeout.
+	result, err := k.kontrol.TellWithTimeout("broadcast", -1, bargs)
+	if err != nil {
+		return nil, err
+	}
+
+	var res protocol.BroadcastResult
+	err = result.Unmarshal(&res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
 // NewKeyRenewer renews the internal key every given interval
 func (k *Kite) NewKeyRenewer(interval time.Duration) {
 	ticker := time.NewTicker(interval)
@@ -281,6 +538,59 @@ func (k *Kite) KontrolReadyNotify() chan struct{} {
 	return k.kontrol.readyRegistered
 }
 
+// isRegistered returns true if the kite has registered to Kontrol.
+func (k *kontrolClient) isRegistered() bool {
+	select {
+	case <-k.readyRegistered:
+		return true
+	default:
+		return false
+	}
+}
+
+// Unregister removes the registration of the kite from Kontrol, so it's not
+// returned by GetKites anymore. The kite does not register again when it
+// reconnects to Kontrol afterwards, it's meant to be called right before
+// the kite is closed, see Shutdown.
+func (k *Kite) Unregister() error {
+	ctx, cancel := context.WithTimeout(context.Background(), k.Config.Timeout)
+	defer cancel()
+
+	return k.unregister(ctx)
+}
+
+func (k *Kite) unregister(ctx context.Context) error {
+	if k.Config.LocalMode {
+		k.unregisterLocal()
+		return k.unregisterVersions(nil)
+	}
+
+	if err := k.SetupKontrolClient(); err != nil {
+		return err
+	}
+
+	select {
+	case <-k.kontrol.readyConnected:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	err := k.unregisterVersions(func(kite *protocol.Kite) error {
+		_, err := k.kontrol.TellWithContext(ctx, "unregister", &protocol.UnregisterArgs{Kite: kite})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	k.kontrol.Lock()
+	k.kontrol.lastRegisteredURL = nil
+	k.kontrol.Unlock()
+
+	_, err = k.kontrol.TellWithContext(ctx, "unregister")
+	return err
+}
+
 // signalReady is an internal method to notify that a successful registration
 // is done.
 func (k *Kite) signalReady() {
@@ -294,13 +604,23 @@ func (k *Kite) signalReady() {
 func (k *Kite) RegisterForever(kiteURL *url.URL) error {
 	errs := make(chan error, 1)
 	go func() {
+		registered := false
+
 		for u := range k.kontrol.registerChan {
-			_, err := k.Register(u)
+			res, err := k.Register(u)
 			if err == nil {
 				k.kontrol.Lock()
 				k.kontrol.lastRegisteredURL = u
 				k.kontrol.Unlock()
 				k.signalReady()
+
+				if registered {
+					k.callOnReRegisterHandlers(res.result)
+				} else {
+					registered = true
+					go k.checkRegistration()
+				}
+
 				continue
 			}
 
@@ -337,11 +657,88 @@ func (k *Kite) RegisterForever(kiteURL *url.URL) error {
 	}
 }
 
+// checkRegistration periodically verifies that Kontrol still has the
+// registration of the kite and registers it again if it does not.
+func (k *Kite) checkRegistration() {
+	interval := k.Config.RegistrationCheckInterval
+	if interval <= 0 || k.Config.LocalMode {
+		return
+	}
+
+	k.kontrol.Lock()
+	closed := k.kontrol.closeChan
+	k.kontrol.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+
+		k.kontrol.Lock()
+		u := k.kontrol.lastRegisteredURL
+		k.kontrol.Unlock()
+
+		if u == nil {
+			continue
+		}
+
+		ok, err := k.isRegistered()
+		if err != nil {
+			k.Log.Debug("Cannot check registration in Kontrol: %s", err)
+			continue
+		}
+
+		if ok {
+			continue
+		}
+
+		k.Log.Warning("Registration is missing in Kontrol, registering again")
+
+		select {
+		case k.kontrol.registerChan <- u:
+		default:
+		}
+	}
+}
+
+// isRegistered returns true if Kontrol has the registration of the kite.
+func (k *Kite) isRegistered() (bool, error) {
+	args := protocol.GetKitesArgs{
+		Query: k.Kite().Query(),
+	}
+
+	response, err := k.kontrol.TellWithTimeout("getKites", k.Config.Timeout, args)
+	if e, ok := err.(*Error); ok && strings.Contains(e.Message, "Key not found") {
+		// The etcd storage fails with its KeyNotFound error when
+		// no kites match the query.
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var result protocol.GetKitesResult
+	if err := response.Unmarshal(&result); err != nil {
+		return false, err
+	}
+
+	return len(result.Kites) != 0, nil
+}
+
 // Register registers current Kite to Kontrol. After registration other Kites
 // can find it via GetKites() or WatchKites() method.  This method does not
 // handle the reconnection case. If you want to keep registered to kontrol, use
 // RegisterForever().
 func (k *Kite) Register(kiteURL *url.URL) (*registerResult, error) {
+	if k.Config.LocalMode {
+		return k.registerLocal(kiteURL)
+	}
+
 	if err := k.SetupKontrolClient(); err != nil {
 		return nil, err
 	}
@@ -349,11 +746,14 @@ func (k *Kite) Register(kiteURL *url.URL) (*registerResult, error) {
 	<-k.kontrol.readyConnected
 
 	args := protocol.RegisterArgs{
-		URL: kiteURL.String(),
+		URL:   kiteURL.String(),
+		Color: k.Config.Color,
 	}
 
 	k.Log.Info("Registering to kontrol with URL: %s", kiteURL.String())
 
+	sent := time.Now()
+
 	response, err := k.kontrol.TellWithTimeout("register", k.Config.Timeout, args)
 	if err != nil {
 		return nil, err
@@ -365,6 +765,8 @@ func (k *Kite) Register(kiteURL *url.URL) (*registerResult, error) {
 		return nil, err
 	}
 
+	k.updateClockSkew(sent, time.Now(), rr.Time)
+
 	k.Log.Info("Registered to kontrol with URL: %s and Kite query: %s",
 		rr.URL, k.Kite())
 
@@ -375,7 +777,7 @@ func (k *Kite) Register(kiteURL *url.URL) (*registerResult, error) {
 
 	k.callOnRegisterHandlers(&rr)
 
-	return &registerResult{parsed}, nil
+	return &registerResult{URL: parsed, result: &rr}, nil
 }
 
 // RegisterToTunnel finds a tunnel proxy kite by asking kontrol then registers
@@ -397,9 +799,23 @@ func (k *Kite) RegisterToTunnel() {
 // to kontrol over a kite-proxy. A Kiteproxy is a reverseproxy that can be used
 // for SSL termination or handling hundreds of kites behind a single. This is a
 // blocking function.
+//
+// When the proxy kite is scaled in, it may hand the registration off to
+// another proxy kite, which the kite connects to right away with the same
+// credentials, without asking Kontrol.
 func (k *Kite) RegisterToProxy(registerURL *url.URL, query *protocol.KontrolQuery) {
 	go k.RegisterForever(nil)
 
+	// The proxy kite can hand the registration off to another proxy kite,
+	// see handleProxyHandoff.
+	handoffC := make(chan protocol.ProxyHandoff, 1)
+
+	var (
+		handoff *protocol.ProxyHandoff
+		prev    *Client // proxy kite that handed off the registration
+		lastURL string
+	)
+
 	for {
 		var proxyKite *Client
 
@@ -409,7 +825,12 @@ func (k *Kite) RegisterToProxy(registerURL *url.URL, query *protocol.KontrolQuer
 		// As an authentication informain kiteKey method will be used,
 		// so be careful when using this feature.
 		kiteProxyURL := os.Getenv("KITE_PROXY_URL")
-		if kiteProxyURL != "" {
+		if handoff != nil {
+			// The new proxy kite has the registration already, it is
+			// connected with the credentials used for the previous one.
+			proxyKite = k.NewClient(handoff.ProxyURL)
+			proxyKite.Auth = prev.Auth
+		} else if kiteProxyURL != "" {
 			proxyKite = k.NewClient(kiteProxyURL)
 			proxyKite.Auth = &Auth{
 				Type: "kiteKey",
@@ -438,15 +859,49 @@ func (k *Kite) RegisterToProxy(registerURL *url.URL, query *protocol.KontrolQuer
 		})
 
 		proxyURL, err := k.registerToProxyKite(proxyKite, registerURL)
+
+		if prev != nil {
+			prev.Close()
+			prev = nil
+		}
+
 		if err != nil {
-			time.Sleep(proxyRetryDuration)
+			// Failed handoffs fall back to a new registration.
+			if handoff == nil {
+				time.Sleep(proxyRetryDuration)
+			}
+
+			handoff = nil
 			continue
 		}
 
-		k.kontrol.registerChan <- proxyURL
+		// Proxies behind the same public host give the same URL, which
+		// does not have to be registered to Kontrol again.
+		if handoff == nil || proxyURL.String() != lastURL {
+			k.kontrol.registerChan <- proxyURL
+		}
+
+		handoff, lastURL = nil, proxyURL.String()
+
+		k.proxy.set(proxyKite, handoffC)
 
 		// Block until disconnect from Proxy Kite.
-		<-disconnect
+		select {
+		case <-disconnect:
+		case h := <-handoffC:
+			handoff, prev = &h, proxyKite
+		}
+
+		k.proxy.set(nil, nil)
+
+		// The proxy may disconnect right after handing off.
+		if handoff == nil {
+			select {
+			case h := <-handoffC:
+				handoff, prev = &h, proxyKite
+			default:
+			}
+		}
 	}
 }
 
@@ -0,0 +1,69 @@
+package kite
+
+import (
+	"errors"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite/protocol"
+)
+
+// verifyResult verifies the signature of the result of the getKites query
+// with the given nonce, see Config.RequireSignedResults. A signed result is
+// always verified, unsigned ones are accepted unless signatures are
+// required, so kites can be upgraded before their Kontrol.
+func (k *Kite) verifyResult(nonce string, result *protocol.GetKitesResult) error {
+	if result.Signature == "" {
+		if k.Config.RequireSignedResults {
+			return &Error{
+				Type:    "signatureError",
+				Message: "Kontrol result is not signed",
+			}
+		}
+
+		return nil
+	}
+
+	kontrolKey := k.KontrolKey()
+
+	if kontrolKey == nil {
+		if k.Config.RequireSignedResults {
+			return &Error{
+				Type:    "signatureError",
+				Message: "Kontrol key is not known to verify the result",
+			}
+		}
+
+		return nil
+	}
+
+	var claims protocol.ResultClaims
+
+	keyFunc := func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+
+		return kontrolKey, nil
+	}
+
+	if _, err := jwt.ParseWithClaims(result.Signature, &claims, keyFunc); err != nil {
+		return &Error{
+			Type:    "signatureError",
+			Message: "Invalid signature of Kontrol result: " + err.Error(),
+		}
+	}
+
+	digest, err := result.Digest()
+	if err != nil {
+		return err
+	}
+
+	if claims.Nonce != nonce || claims.Digest != digest {
+		return &Error{
+			Type:    "signatureError",
+			Message: "Kontrol result does not match its signature",
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package kite
+
+import (
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/protocol"
+	"github.com/koding/kite/testkeys"
+)
+
+func TestKite_VerifyResult(t *testing.T) {
+	private, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(testkeys.Private))
+	if err != nil {
+		t.Fatalf("ParseRSAPrivateKeyFromPEM()=%s", err)
+	}
+
+	k := NewWithConfig("verifier", "0.0.1", config.New())
+	k.kontrolKey = &private.PublicKey
+
+	sign := func(nonce string, result *protocol.GetKitesResult) {
+		digest, err := result.Digest()
+		if err != nil {
+			t.Fatalf("Digest()=%s", err)
+		}
+
+		claims := &protocol.ResultClaims{Nonce: nonce, Digest: digest}
+
+		result.Signature, err = jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(private)
+		if err != nil {
+			t.Fatalf("SignedString()=%s", err)
+		}
+	}
+
+	result := &protocol.GetKitesResult{
+		Kites: []*protocol.KiteWithToken{{
+			Kite:  protocol.Kite{Name: "math", ID: "1"},
+			URL:   "http://127.0.0.1:4000/kite",
+			Token: "token",
+		}},
+	}
+
+	sign("nonce", result)
+
+	if err := k.verifyResult("nonce", result); err != nil {
+		t.Fatalf("verifyResult()=%s", err)
+	}
+
+	if err := k.verifyResult("other", result); err == nil {
+		t.Fatal("want result of other query to be rejected")
+	}
+
+	result.Kites[0].URL = "http://evil.example.com/kite"
+
+	if err := k.verifyResult("nonce", result); err == nil {
+		t.Fatal("want tampered result to be rejected")
+	}
+
+	signature := result.Signature
+	result.Signature = ""
+
+	if err := k.verifyResult("nonce", result); err != nil {
+		t.Fatalf("want unsigned result of an older Kontrol to be accepted, got %s", err)
+	}
+
+	k.Config.RequireSignedResults = true
+
+	if err := k.verifyResult("nonce", result); err == nil {
+		t.Fatal("want unsigned result to be rejected")
+	}
+
+	result.Signature = signature
+	k.kontrolKey = nil
+
+	if err := k.verifyResult("nonce", result); err == nil {
+		t.Fatal("want result to be rejected without the Kontrol key")
+	}
+
+	k.Config.RequireSignedResults = false
+
+	if err := k.verifyResult("nonce", result); err != nil {
+		t.Fatalf("want result to be accepted without the Kontrol key, got %s", err)
+	}
+}
@@ -0,0 +1,129 @@
+package kite
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+
+	"github.com/koding/kite/protocol"
+)
+
+// ErrLocalMode is returned by the methods which need Kontrol, like GetToken,
+// when the kite runs in local mode, see Config.LocalMode.
+var ErrLocalMode = errors.New("kite: Kontrol is not available in local mode")
+
+// localRegistry stands in for Kontrol in local mode, it holds the kites
+// added with AddLocalKite and Config.LocalKites, and the registration of
+// the kite itself.
+type localRegistry struct {
+	mu    sync.Mutex
+	kites []localKite
+}
+
+type localKite struct {
+	kite protocol.Kite
+	url  string
+}
+
+// AddLocalKite makes the kite with the given URL returned by GetKites when
+// the kite runs in local mode. Empty fields of the kite match any query,
+// so a kite with only the name set is returned for all queries of
+// the name.
+func (k *Kite) AddLocalKite(kite protocol.Kite, url string) {
+	k.local.mu.Lock()
+	defer k.local.mu.Unlock()
+
+	k.local.add(kite, url)
+}
+
+func (r *localRegistry) add(kite protocol.Kite, url string) {
+	for i := range r.kites {
+		if r.kites[i].kite == kite {
+			r.kites[i].url = url
+			return
+		}
+	}
+
+	r.kites = append(r.kites, localKite{kite: kite, url: url})
+}
+
+func (r *localRegistry) remove(kite protocol.Kite) {
+	for i := range r.kites {
+		if r.kites[i].kite == kite {
+			r.kites = append(r.kites[:i], r.kites[i+1:]...)
+			return
+		}
+	}
+}
+
+// registerLocal registers the kite in the local registry instead of Kontrol.
+func (k *Kite) registerLocal(kiteURL *url.URL) (*registerResult, error) {
+	k.local.mu.Lock()
+	k.local.add(*k.Kite(), kiteURL.String())
+	k.local.mu.Unlock()
+
+	k.Log.Info("Registered locally with URL: %s", kiteURL)
+
+	rr := &protocol.RegisterResult{URL: kiteURL.String()}
+
+	k.callOnRegisterHandlers(rr)
+	k.signalReady()
+
+	return &registerResult{URL: kiteURL, result: rr}, nil
+}
+
+func (k *Kite) unregisterLocal() {
+	k.local.mu.Lock()
+	defer k.local.mu.Unlock()
+
+	k.local.remove(*k.Kite())
+}
+
+// localKites gives the clients of the local kites matching the query.
+func (k *Kite) localKites(query *protocol.KontrolQuery) []*Client {
+	k.local.mu.Lock()
+	kites := append([]localKite(nil), k.local.kites...)
+	k.local.mu.Unlock()
+
+	for name, url := range k.Config.LocalKites {
+		kites = append(kites, localKite{kite: protocol.Kite{Name: name}, url: url})
+	}
+
+	var clients []*Client
+
+	for _, lk := range kites {
+		if query != nil && !matchLocal(&lk.kite, query) {
+			continue
+		}
+
+		c := k.NewClient(lk.url)
+		c.Kite = lk.kite
+
+		if key := k.KiteKey(); key != "" {
+			c.Auth = &Auth{
+				Type: "kiteKey",
+				Key:  key,
+			}
+		}
+
+		clients = append(clients, c)
+	}
+
+	return clients
+}
+
+// matchLocal tells whether the kite matches the query, empty fields of
+// the kite match any value.
+func matchLocal(kite *protocol.Kite, query *protocol.KontrolQuery) bool {
+	match := func(field, value string) bool {
+		return field == "" || value == "" || field == value
+	}
+
+	return match(kite.Username, query.Username) &&
+		match(kite.Environment, query.Environment) &&
+		match(kite.Name, query.Name) &&
+		match(kite.Version, query.Version) &&
+		match(kite.Region, query.Region) &&
+		match(kite.Hostname, query.Hostname) &&
+		match(kite.ID, query.ID)
+}
@@ -0,0 +1,74 @@
+package kite
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/koding/kite/protocol"
+)
+
+func TestKite_LocalMode(t *testing.T) {
+	k := New("local", "0.0.1")
+	defer k.Close()
+
+	k.Config.LocalMode = true
+	k.Config.LocalKites = map[string]string{
+		"storage": "http://127.0.0.1:5000/kite",
+	}
+
+	k.AddLocalKite(protocol.Kite{Name: "math", Version: "1.0.0"}, "http://127.0.0.1:6000/kite")
+
+	registered := make(chan string, 1)
+	k.OnRegister(func(rr *protocol.RegisterResult) {
+		registered <- rr.URL
+	})
+
+	u, err := url.Parse("http://127.0.0.1:4000/kite")
+	if err != nil {
+		t.Fatalf("Parse()=%s", err)
+	}
+
+	if err := k.RegisterForever(u); err != nil {
+		t.Fatalf("RegisterForever()=%s", err)
+	}
+
+	if got := <-registered; got != u.String() {
+		t.Fatalf("got %q, want %q", got, u)
+	}
+
+	cases := []struct {
+		query *protocol.KontrolQuery
+		url   string
+	}{
+		{&protocol.KontrolQuery{Name: "local"}, u.String()},
+		{&protocol.KontrolQuery{Username: "anyone", Name: "storage"}, "http://127.0.0.1:5000/kite"},
+		{&protocol.KontrolQuery{Name: "math", Version: "1.0.0"}, "http://127.0.0.1:6000/kite"},
+	}
+
+	for _, cas := range cases {
+		clients, err := k.GetKites(cas.query)
+		if err != nil {
+			t.Fatalf("%+v: GetKites()=%s", cas.query, err)
+		}
+
+		if len(clients) != 1 || clients[0].URL != cas.url {
+			t.Fatalf("%+v: got %d clients, want one with %q", cas.query, len(clients), cas.url)
+		}
+	}
+
+	if _, err := k.GetKites(&protocol.KontrolQuery{Name: "math", Version: "2.0.0"}); err != ErrNoKitesAvailable {
+		t.Fatalf("got %v, want %v", err, ErrNoKitesAvailable)
+	}
+
+	if err := k.Unregister(); err != nil {
+		t.Fatalf("Unregister()=%s", err)
+	}
+
+	if _, err := k.GetKites(&protocol.KontrolQuery{Name: "local"}); err != ErrNoKitesAvailable {
+		t.Fatalf("got %v, want %v after unregistering", err, ErrNoKitesAvailable)
+	}
+
+	if _, err := k.GetToken(&protocol.Kite{Name: "math"}); err != ErrLocalMode {
+		t.Fatalf("got %v, want %v", err, ErrLocalMode)
+	}
+}
@@ -0,0 +1,38 @@
+// Package logadapter adapts the loggers of the logging packages to
+// the kite.Logger interface, so kites can log with the logger of
+// the application:
+//
+//     k := kite.New("math", "1.0.0")
+//     k.Log = logadapter.Slog(slog.Default())
+//
+// The adapters implement kite.FieldLogger, so the fields of the messages,
+// like the ID of the request, are logged as structured fields.
+//
+// The adapters of logrus and zap are built with the "logrus" and "zap"
+// build tags respectively, so the packages are not dependencies of kites
+// not using them.
+package logadapter
+
+import (
+	"sort"
+
+	"github.com/koding/kite"
+)
+
+// keyValues returns the fields as alternating keys and values, sorted by
+// the keys.
+func keyValues(fields kite.Fields) []interface{} {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	kv := make([]interface{}, 0, 2*len(keys))
+	for _, key := range keys {
+		kv = append(kv, key, fields[key])
+	}
+
+	return kv
+}
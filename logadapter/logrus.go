@@ -0,0 +1,44 @@
+// +build logrus
+
+package logadapter
+
+import (
+	"github.com/koding/kite"
+	"github.com/sirupsen/logrus"
+)
+
+// Logrus returns a kite.Logger logging with l, which can be a *logrus.Logger
+// or a *logrus.Entry. It is built with the "logrus" build tag.
+func Logrus(l logrus.FieldLogger) kite.Logger {
+	return &logrusLogger{l: l}
+}
+
+type logrusLogger struct {
+	l logrus.FieldLogger
+}
+
+var _ kite.FieldLogger = (*logrusLogger)(nil)
+
+func (l *logrusLogger) Fatal(format string, args ...interface{}) {
+	l.l.Fatalf(format, args...)
+}
+
+func (l *logrusLogger) Error(format string, args ...interface{}) {
+	l.l.Errorf(format, args...)
+}
+
+func (l *logrusLogger) Warning(format string, args ...interface{}) {
+	l.l.Warnf(format, args...)
+}
+
+func (l *logrusLogger) Info(format string, args ...interface{}) {
+	l.l.Infof(format, args...)
+}
+
+func (l *logrusLogger) Debug(format string, args ...interface{}) {
+	l.l.Debugf(format, args...)
+}
+
+func (l *logrusLogger) WithFields(fields kite.Fields) kite.Logger {
+	return &logrusLogger{l: l.l.WithFields(logrus.Fields(fields))}
+}
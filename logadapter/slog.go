@@ -0,0 +1,55 @@
+// +build go1.21
+
+package logadapter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/koding/kite"
+)
+
+// Slog returns a kite.Logger logging with l. The FATAL messages are logged
+// at the ERROR level, then os.Exit(1) is called.
+func Slog(l *slog.Logger) kite.Logger {
+	return &slogLogger{l: l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+var _ kite.FieldLogger = (*slogLogger)(nil)
+
+func (s *slogLogger) log(level slog.Level, format string, args []interface{}) {
+	if s.l.Enabled(context.Background(), level) {
+		s.l.Log(context.Background(), level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (s *slogLogger) Fatal(format string, args ...interface{}) {
+	s.log(slog.LevelError, format, args)
+	os.Exit(1)
+}
+
+func (s *slogLogger) Error(format string, args ...interface{}) {
+	s.log(slog.LevelError, format, args)
+}
+
+func (s *slogLogger) Warning(format string, args ...interface{}) {
+	s.log(slog.LevelWarn, format, args)
+}
+
+func (s *slogLogger) Info(format string, args ...interface{}) {
+	s.log(slog.LevelInfo, format, args)
+}
+
+func (s *slogLogger) Debug(format string, args ...interface{}) {
+	s.log(slog.LevelDebug, format, args)
+}
+
+func (s *slogLogger) WithFields(fields kite.Fields) kite.Logger {
+	return &slogLogger{l: s.l.With(keyValues(fields)...)}
+}
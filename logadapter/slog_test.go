@@ -0,0 +1,34 @@
+// +build go1.21
+
+package logadapter
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/koding/kite"
+)
+
+func TestSlog(t *testing.T) {
+	var buf bytes.Buffer
+
+	h := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})
+	l := Slog(slog.New(h))
+
+	l.Debug("debug %d", 1)
+	kite.WithFields(l, kite.Fields{"method": "square", "requestID": "abc"}).Warning("failed: %d", 2)
+
+	got := buf.String()
+
+	if strings.Contains(got, "debug 1") {
+		t.Fatalf("expected debug message to be skipped: %s", got)
+	}
+
+	for _, want := range []string{"level=WARN", `msg="failed: 2"`, "method=square", "requestID=abc"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("want %q in %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// +build zap
+
+package logadapter
+
+import (
+	"github.com/koding/kite"
+	"go.uber.org/zap"
+)
+
+// Zap returns a kite.Logger logging with l, it is built with the "zap"
+// build tag.
+func Zap(l *zap.Logger) kite.Logger {
+	return &zapLogger{l: l.Sugar()}
+}
+
+type zapLogger struct {
+	l *zap.SugaredLogger
+}
+
+var _ kite.FieldLogger = (*zapLogger)(nil)
+
+func (z *zapLogger) Fatal(format string, args ...interface{}) {
+	z.l.Fatalf(format, args...)
+}
+
+func (z *zapLogger) Error(format string, args ...interface{}) {
+	z.l.Errorf(format, args...)
+}
+
+func (z *zapLogger) Warning(format string, args ...interface{}) {
+	z.l.Warnf(format, args...)
+}
+
+func (z *zapLogger) Info(format string, args ...interface{}) {
+	z.l.Infof(format, args...)
+}
+
+func (z *zapLogger) Debug(format string, args ...interface{}) {
+	z.l.Debugf(format, args...)
+}
+
+func (z *zapLogger) WithFields(fields kite.Fields) kite.Logger {
+	return &zapLogger{l: z.l.With(keyValues(fields)...)}
+}
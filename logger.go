@@ -1,7 +1,10 @@
 package kite
 
 import (
+	"bytes"
+	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/koding/logging"
@@ -40,11 +43,91 @@ type Logger interface {
 	Debug(format string, args ...interface{})
 }
 
+// Fields are the structured context of log messages, like the ID of
+// the request, see WithFields.
+type Fields map[string]interface{}
+
+// FieldLogger is a Logger, which can attach structured fields to
+// the messages. The adapters of the logging packages, like the ones in
+// the logadapter package, implement it.
+type FieldLogger interface {
+	Logger
+
+	// WithFields returns a logger, which attaches the fields to
+	// the messages, along with the fields of this logger.
+	WithFields(fields Fields) Logger
+}
+
+// WithFields returns a logger, which attaches the fields to the messages
+// logged with l. If l is not a FieldLogger, the fields are written before
+// the messages, like "[method=square requestID=nw3Xa8] message".
+func WithFields(l Logger, fields Fields) Logger {
+	if fl, ok := l.(FieldLogger); ok {
+		return fl.WithFields(fields)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+
+	buf.WriteByte('[')
+	for i, key := range keys {
+		if i != 0 {
+			buf.WriteByte(' ')
+		}
+
+		fmt.Fprintf(&buf, "%s=%v", key, fields[key])
+	}
+	buf.WriteString("] ")
+
+	// The fields are escaped, as the prefix is a part of the format.
+	return &prefixLogger{
+		Logger: l,
+		prefix: strings.Replace(buf.String(), "%", "%%", -1),
+	}
+}
+
+type prefixLogger struct {
+	Logger
+	prefix string
+}
+
+func (l *prefixLogger) Fatal(format string, args ...interface{}) {
+	l.Logger.Fatal(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Error(format string, args ...interface{}) {
+	l.Logger.Error(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Warning(format string, args ...interface{}) {
+	l.Logger.Warning(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Info(format string, args ...interface{}) {
+	l.Logger.Info(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Debug(format string, args ...interface{}) {
+	l.Logger.Debug(l.prefix+format, args...)
+}
+
 // getLogLevel returns the logging level defined via the KITE_LOG_LEVEL
 // environment. It returns Info by default if no environment variable
 // is set.
 func getLogLevel() Level {
-	switch strings.ToUpper(os.Getenv("KITE_LOG_LEVEL")) {
+	return parseLevel(os.Getenv("KITE_LOG_LEVEL"))
+}
+
+// parseLevel parses the name of the level, e.g. "debug". It returns Info
+// for unknown names.
+func parseLevel(name string) Level {
+	switch strings.ToUpper(name) {
 	case "DEBUG":
 		return DEBUG
 	case "WARNING":
@@ -0,0 +1,40 @@
+package kite
+
+import (
+	"fmt"
+	"testing"
+)
+
+type fieldsLogger struct {
+	recordLogger
+	fields Fields
+}
+
+func (l *fieldsLogger) WithFields(fields Fields) Logger {
+	return &fieldsLogger{fields: fields}
+}
+
+func TestWithFields(t *testing.T) {
+	l := &recordLogger{}
+
+	WithFields(l, Fields{"requestID": "abc", "method": "square"}).Error("failed: %d", 1)
+	WithFields(l, Fields{"arg": "100%"}).Info("done")
+
+	want := []string{"[method=square requestID=abc] failed: 1", "[arg=100%] done"}
+
+	if fmt.Sprint(l.lines) != fmt.Sprint(want) {
+		t.Fatalf("want %q, got %q", want, l.lines)
+	}
+
+	fl := WithFields(&fieldsLogger{}, Fields{"method": "square"})
+
+	if f, ok := fl.(*fieldsLogger); !ok || f.fields["method"] != "square" {
+		t.Fatalf("want fields to be passed to FieldLogger, got %#v", fl)
+	}
+
+	rl := (&Request{LocalKite: &Kite{Log: &fieldsLogger{}}, Tenant: "acme"}).Logger()
+
+	if f, ok := rl.(*fieldsLogger); !ok || f.fields["tenant"] != "acme" {
+		t.Fatalf("want tenant field, got %#v", rl)
+	}
+}
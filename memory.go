@@ -0,0 +1,63 @@
+package kite
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// memoryPollInterval is how often a connection over Config.MaxConnectionMemory
+// checks whether it dropped under the cap.
+var memoryPollInterval = 10 * time.Millisecond
+
+var errMemoryCap = errors.New("connection is over the memory cap")
+
+// MemoryUsage returns the approximate number of bytes held for
+// the connection, see Config.MaxConnectionMemory.
+//
+// The messages buffered by the transport itself, after they were handed to
+// it, are not accounted.
+func (c *Client) MemoryUsage() int64 {
+	return atomic.LoadInt64(&c.memory)
+}
+
+// holdMemory accounts n bytes held for the connection, a negative n
+// releases them.
+func (c *Client) holdMemory(n int) {
+	atomic.AddInt64(&c.memory, int64(n))
+}
+
+func (c *Client) overMemoryCap() bool {
+	max := c.LocalKite.Config.MaxConnectionMemory
+	return max > 0 && c.MemoryUsage() > int64(max)
+}
+
+// waitMemory is called before reading a message from the connection, it
+// blocks while the connection is over the memory cap, so the remote kite
+// is throttled. The connection is closed with CloseOverloaded once it is
+// over the cap for longer than Config.MemoryThrottleTimeout.
+func (c *Client) waitMemory() error {
+	if !c.overMemoryCap() {
+		return nil
+	}
+
+	timeout := time.NewTimer(c.LocalKite.Config.MemoryThrottleTimeout)
+	defer timeout.Stop()
+
+	ticker := time.NewTicker(memoryPollInterval)
+	defer ticker.Stop()
+
+	for c.overMemoryCap() {
+		select {
+		case <-ticker.C:
+		case <-c.closeChan:
+			return errors.New("client is closed")
+		case <-timeout.C:
+			c.LocalKite.Log.Warning("Closing connection of %s holding %d bytes: %s", c.Kite, c.MemoryUsage(), errMemoryCap)
+			c.CloseWithReason(CloseOverloaded)
+			return errMemoryCap
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package kite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+)
+
+func TestClient_WaitMemory(t *testing.T) {
+	conf := config.New()
+	conf.MaxConnectionMemory = 100
+	conf.MemoryThrottleTimeout = time.Second
+
+	k := NewWithConfig("memory", "0.0.1", conf)
+	defer k.Close()
+
+	c := k.NewClient("")
+	c.holdMemory(200)
+
+	time.AfterFunc(50*time.Millisecond, func() { c.holdMemory(-150) })
+
+	if err := c.waitMemory(); err != nil {
+		t.Fatalf("waitMemory()=%s", err)
+	}
+
+	if n := c.MemoryUsage(); n != 50 {
+		t.Fatalf("got %d, want 50", n)
+	}
+
+	conf.MemoryThrottleTimeout = 50 * time.Millisecond
+	c.holdMemory(100)
+
+	if err := c.waitMemory(); err != errMemoryCap {
+		t.Fatalf("got %v, want %v", err, errMemoryCap)
+	}
+
+	select {
+	case <-c.closeChan:
+	default:
+		t.Fatal("want the client to be closed")
+	}
+}
+
+func TestStream_Memory(t *testing.T) {
+	k := New("memory", "0.0.1")
+	defer k.Close()
+
+	c := k.NewClient("")
+
+	s := newStream(context.Background(), c, "stream", streamEndpoint{})
+	defer s.finish()
+
+	s.push(&dnode.Partial{Raw: []byte(`[1,"world"]`)})
+	s.push(&dnode.Partial{Raw: []byte(`[0,"hello"]`)})
+
+	if n := c.MemoryUsage(); n != 14 {
+		t.Fatalf("got %d, want 14", n)
+	}
+
+	if _, err := s.Recv(); err != nil {
+		t.Fatalf("Recv()=%s", err)
+	}
+
+	if n := c.MemoryUsage(); n != 7 {
+		t.Fatalf("got %d, want 7", n)
+	}
+
+	s.releaseMemory()
+
+	if n := c.MemoryUsage(); n != 0 {
+		t.Fatalf("got %d, want 0", n)
+	}
+}
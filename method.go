@@ -1,7 +1,11 @@
 package kite
 
 import (
+	"fmt"
+	"reflect"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/juju/ratelimit"
@@ -48,6 +52,10 @@ type FinalFunc func(r *Request, resp interface{}, err error) (interface{}, error
 // Method defines a method and the Handler it is bind to. By default
 // "ReturnMethod" handling is used.
 type Method struct {
+	// deprecatedCalls counts calls of a deprecated method. It's the first
+	// field to guarantee 64-bit alignment for atomic operations.
+	deprecatedCalls int64
+
 	// name is the method name. Unnamed methods can exist
 	name string
 
@@ -71,25 +79,78 @@ type Method struct {
 	// bucket is used for throttling the method by certain rule
 	bucket *ratelimit.Bucket
 
+	// deprecated marks the method as deprecated, replacement is an optional
+	// name of the method that should be used instead.
+	deprecated  bool
+	replacement string
+
+	// args and result are the types of the method's argument and result,
+	// they are used for introspection only.
+	args   reflect.Type
+	result reflect.Type
+
+	// strict enables rejecting unknown fields of the arguments, see Strict
+	strict bool
+
+	// rawArgs makes the arguments share the data of the message instead
+	// of copying it, see HandleDecoderFunc
+	rawArgs bool
+
+	// description and example are documentation of the method, see
+	// Describe and Example.
+	description string
+	example     []interface{}
+
+	// version is the API version the method implements, versions are the
+	// implementations of the method registered with Kite.HandleVersion.
+	version  string
+	versions map[string]*Method
+
+	// kiteVersions are the implementations of the method for the versions
+	// of the kite added with Kite.AddVersion.
+	kiteVersions map[string]*Method
+
 	mu sync.Mutex // protects handler slices
 }
 
 // addHandle is an internal method to add a handler
 func (k *Kite) addHandle(method string, handler Handler) *Method {
+	m := k.newMethod(method, handler)
+
+	k.methodsMu.Lock()
+	defer k.methodsMu.Unlock()
+
+	// keep the versions registered with HandleVersion and KiteVersion.Handle
+	if prev, ok := k.handlers[method]; ok {
+		m.versions = prev.versions
+		m.kiteVersions = prev.kiteVersions
+	}
+
+	k.handlers[method] = m
+	return m
+}
+
+// method returns the registered method with the given name.
+func (k *Kite) method(name string) (*Method, bool) {
+	k.methodsMu.RLock()
+	defer k.methodsMu.RUnlock()
+
+	m, ok := k.handlers[name]
+	return m, ok
+}
+
+func (k *Kite) newMethod(method string, handler Handler) *Method {
 	authenticate := true
 	if k.Config.DisableAuthentication {
 		authenticate = false
 	}
 
-	m := &Method{
+	return &Method{
 		name:         method,
 		handler:      handler,
 		authenticate: authenticate,
 		handling:     k.MethodHandling,
 	}
-
-	k.handlers[method] = m
-	return m
 }
 
 // DisableAuthentication disables authentication check for this method.
@@ -122,6 +183,81 @@ func (m *Method) Throttle(fillInterval time.Duration, capacity int64) *Method {
 	return m
 }
 
+// takeTokens takes the cost of the request from the rate limit of the
+// method. It returns false if there are not enough tokens. Requests of
+// batch priority leave a part of the tokens for the more urgent ones.
+func (m *Method) takeTokens(r *Request) bool {
+	cost := r.cost()
+
+	if r.Priority < PriorityNormal {
+		reserve := m.bucket.Capacity() / batchReserve
+
+		if m.bucket.Available()-cost < reserve {
+			return false
+		}
+	}
+
+	_, ok := m.bucket.TakeMaxDuration(cost, 0)
+	return ok
+}
+
+// Deprecate marks the method as deprecated. The method is still served, but
+// every response carries a warning, pointing to the replacement method if
+// it's not empty, and the calls are counted, see Kite.DeprecatedCalls.
+func (m *Method) Deprecate(replacement string) *Method {
+	m.deprecated = true
+	m.replacement = replacement
+	return m
+}
+
+// deprecationWarning returns a warning sent along with responses of a
+// deprecated method.
+func (m *Method) deprecationWarning() string {
+	if m.replacement == "" {
+		return fmt.Sprintf("method %q is deprecated", m.name)
+	}
+
+	return fmt.Sprintf("method %q is deprecated, use %q instead", m.name, m.replacement)
+}
+
+// Args declares the type of the argument the method expects, the value of v
+// itself is ignored. It is used only for introspection, see Kite.Methods.
+func (m *Method) Args(v interface{}) *Method {
+	m.args = reflect.TypeOf(v)
+	return m
+}
+
+// Returns declares the type of the result the method returns, the value of
+// v itself is ignored. It is used only for introspection, see Kite.Methods.
+func (m *Method) Returns(v interface{}) *Method {
+	m.result = reflect.TypeOf(v)
+	return m
+}
+
+// Strict makes the method reject arguments containing fields that are not
+// known to the type declared with Args, e.g. because of typos, with an
+// "argumentError" error, instead of silently ignoring them. Handlers which
+// decode their arguments on their own can use dnode.Partial.UnmarshalStrict
+// instead.
+func (m *Method) Strict() *Method {
+	m.strict = true
+	return m
+}
+
+// Describe sets a human-readable description of the method, which is
+// served by the kite.describe method to discovery tools like kitectl.
+func (m *Method) Describe(description string) *Method {
+	m.description = description
+	return m
+}
+
+// Example sets example arguments of the method, which are served by the
+// kite.describe method together with the description.
+func (m *Method) Example(args ...interface{}) *Method {
+	m.example = args
+	return m
+}
+
 // PreHandler adds a new kite handler which is executed before the method.
 func (m *Method) PreHandle(handler Handler) *Method {
 	m.preHandlers = append(m.preHandlers, handler)
@@ -204,6 +340,94 @@ func (k *Kite) FinalFunc(f FinalFunc) {
 	k.finalFuncs = append(k.finalFuncs, f)
 }
 
+// MethodInfo describes a method registered with a kite.
+type MethodInfo struct {
+	Name         string
+	Version      string       // empty unless registered with Kite.HandleVersion
+	Args         reflect.Type // nil if not declared with Method.Args
+	Result       reflect.Type // nil if not declared with Method.Returns
+	Authenticate bool
+	Deprecated   bool
+	Replacement  string
+	Description  string        // set with Method.Describe
+	Example      []interface{} // set with Method.Example
+}
+
+// Methods returns the description of every method registered with the kite,
+// sorted by the method name. Each version of a method registered with
+// HandleVersion is described separately.
+func (k *Kite) Methods() []*MethodInfo {
+	all := k.allMethods()
+	methods := make([]*MethodInfo, 0, len(all))
+
+	for _, m := range all {
+		methods = append(methods, &MethodInfo{
+			Name:         m.name,
+			Version:      m.version,
+			Args:         m.args,
+			Result:       m.result,
+			Authenticate: m.authenticate,
+			Deprecated:   m.deprecated,
+			Replacement:  m.replacement,
+			Description:  m.description,
+			Example:      m.example,
+		})
+	}
+
+	sort.Slice(methods, func(i, j int) bool {
+		if methods[i].Name != methods[j].Name {
+			return methods[i].Name < methods[j].Name
+		}
+
+		return versionLess(methods[i].Version, methods[j].Version)
+	})
+
+	return methods
+}
+
+// DeprecatedCalls returns the number of calls for each of the deprecated
+// methods, keyed by a method name. Deprecated versions of a method are
+// keyed by the name and the version, e.g. "fs.readFile@v1".
+func (k *Kite) DeprecatedCalls() map[string]int64 {
+	calls := make(map[string]int64)
+
+	for _, m := range k.allMethods() {
+		if !m.deprecated {
+			continue
+		}
+
+		name := m.name
+		if m.version != "" {
+			name += "@" + m.version
+		}
+
+		calls[name] = atomic.LoadInt64(&m.deprecatedCalls)
+	}
+
+	return calls
+}
+
+// allMethods gives the registered methods along with all their versions.
+// Methods having versions only are skipped.
+func (k *Kite) allMethods() []*Method {
+	var methods []*Method
+
+	k.methodsMu.RLock()
+	defer k.methodsMu.RUnlock()
+
+	for _, m := range k.handlers {
+		if m.handler != nil {
+			methods = append(methods, m)
+		}
+
+		for _, v := range m.versions {
+			methods = append(methods, v)
+		}
+	}
+
+	return methods
+}
+
 func (m *Method) ServeKite(r *Request) (interface{}, error) {
 	var firstResp interface{}
 	var resp interface{}
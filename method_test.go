@@ -3,6 +3,7 @@ package kite
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -246,3 +247,344 @@ func TestMethod_Base(t *testing.T) {
 	}
 
 }
+
+func TestMethod_Deprecate(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+
+	k.HandleFunc("foo", func(r *Request) (interface{}, error) {
+		return "foo", nil
+	}).Deprecate("bar")
+
+	k.HandleFunc("bar", func(r *Request) (interface{}, error) {
+		return "bar", nil
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		result, err := c.TellWithTimeout("foo", 4*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if s := result.MustString(); s != "foo" {
+			t.Fatalf("got %q, want %q", s, "foo")
+		}
+	}
+
+	if _, err := c.TellWithTimeout("bar", 4*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := k.DeprecatedCalls()
+	if len(calls) != 1 || calls["foo"] != 3 {
+		t.Fatalf("got %v, want map[foo:3]", calls)
+	}
+}
+
+func TestMethod_Metadata(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+
+	k.HandleFunc("search", func(r *Request) (interface{}, error) {
+		r.AddWarning("index is being rebuilt")
+		r.SetMetadata("cache", "miss")
+		r.SetMetadata("partial", true)
+		return []string{"foo"}, nil
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	result, err := c.TellResult("search", 4*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Warnings) != 1 || result.Warnings[0] != "index is being rebuilt" {
+		t.Fatalf("got %v warnings", result.Warnings)
+	}
+
+	var cache string
+	if ok, err := result.Meta("cache", &cache); !ok || err != nil || cache != "miss" {
+		t.Fatalf("got cache=%q (ok=%t, err=%v), want %q", cache, ok, err, "miss")
+	}
+
+	var partial bool
+	if ok, err := result.Meta("partial", &partial); !ok || err != nil || !partial {
+		t.Fatalf("got partial=%t (ok=%t, err=%v), want true", partial, ok, err)
+	}
+
+	if ok, _ := result.Meta("missing", &cache); ok {
+		t.Fatal("want missing metadata key not to be found")
+	}
+
+	if s := result.Value.MustSliceOfLength(1)[0].MustString(); s != "foo" {
+		t.Fatalf("got %q, want %q", s, "foo")
+	}
+}
+
+func TestMethod_Call(t *testing.T) {
+	type squareArgs struct {
+		Number int `json:"number"`
+	}
+
+	type squareResult struct {
+		Square int `json:"square"`
+	}
+
+	k := New("testkite", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+
+	k.HandleFunc("square", func(r *Request) (interface{}, error) {
+		var args squareArgs
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		if args.Number < 0 {
+			return nil, errors.New("negative number")
+		}
+
+		return squareResult{Square: args.Number * args.Number}, nil
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var res squareResult
+	if err := c.Call("square", squareArgs{Number: 4}, &res); err != nil {
+		t.Fatalf("Call()=%s", err)
+	}
+
+	if res.Square != 16 {
+		t.Fatalf("got %d, want 16", res.Square)
+	}
+
+	err := c.Call("square", squareArgs{Number: -1}, &res)
+	if e, ok := err.(*Error); !ok || e.Type != "genericError" {
+		t.Fatalf("got %#v, want genericError", err)
+	}
+
+	var wrong string
+	err = c.Call("square", squareArgs{Number: 2}, &wrong)
+	if e, ok := err.(*Error); !ok || e.Type != "invalidResponse" {
+		t.Fatalf("got %#v, want invalidResponse", err)
+	}
+}
+
+func TestMethod_Version(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+
+	k.HandleFuncVersion("fs.readFile", "v1", func(r *Request) (interface{}, error) {
+		return "content", nil
+	})
+
+	k.HandleFuncVersion("fs.readFile", "v2", func(r *Request) (interface{}, error) {
+		return map[string]string{"content": "content"}, nil
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	res, err := c.TellWithContext(WithAPIVersion(context.Background(), "v1"), "fs.readFile")
+	if err != nil {
+		t.Fatalf("TellWithContext()=%s", err)
+	}
+
+	if s := res.MustString(); s != "content" {
+		t.Fatalf("got %q, want %q", s, "content")
+	}
+
+	// The latest version is used when none is requested.
+	result, err := c.TellResult("fs.readFile", 4*time.Second)
+	if err != nil {
+		t.Fatalf("TellResult()=%s", err)
+	}
+
+	var version string
+	if ok, err := result.Meta("apiVersion", &version); !ok || err != nil || version != "v2" {
+		t.Fatalf("got apiVersion=%q (ok=%t, err=%v), want %q", version, ok, err, "v2")
+	}
+
+	_, err = c.TellWithContext(WithAPIVersion(context.Background(), "v3"), "fs.readFile")
+	if e, ok := err.(*Error); !ok || e.Type != "unsupportedVersion" {
+		t.Fatalf("got %#v, want unsupportedVersion", err)
+	}
+}
+
+func TestMethod_ResolveVersion(t *testing.T) {
+	k := New("testkite", "0.0.1")
+
+	noop := func(r *Request) (interface{}, error) { return nil, nil }
+
+	k.HandleFuncVersion("foo", "v10", noop)
+	k.HandleFuncVersion("foo", "v2", noop)
+	k.HandleFuncVersion("bar", "v1", noop)
+	k.HandleFunc("bar", noop)
+	k.HandleFunc("baz", noop)
+
+	cases := []struct {
+		method    string
+		requested string
+		want      string
+		wantErr   bool
+	}{
+		{"foo", "", "v10", false},
+		{"foo", "v2", "v2", false},
+		{"foo", "v3", "", true},
+		{"bar", "", "", false},
+		{"bar", "v1", "v1", false},
+		{"baz", "", "", false},
+		{"baz", "v1", "", true},
+	}
+
+	for _, cas := range cases {
+		r := &Request{APIVersion: cas.requested}
+
+		m, err := k.handlers[cas.method].resolveVersion(r)
+		if cas.wantErr {
+			if err == nil || err.Type != "unsupportedVersion" {
+				t.Errorf("%s@%s: got %v, want unsupportedVersion", cas.method, cas.requested, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s@%s: resolveVersion()=%s", cas.method, cas.requested, err)
+			continue
+		}
+
+		if m.version != cas.want || r.APIVersion != cas.want {
+			t.Errorf("%s@%s: got %q, want %q", cas.method, cas.requested, m.version, cas.want)
+		}
+	}
+
+	var names []string
+	for _, m := range k.Methods() {
+		if m.Name == "foo" || m.Name == "bar" {
+			names = append(names, m.Name+"@"+m.Version)
+		}
+	}
+
+	want := []string{"bar@", "bar@v1", "foo@v2", "foo@v10"}
+
+	if fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+}
+
+func TestMethod_Describe(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	k.HandleFunc("square", func(r *Request) (interface{}, error) {
+		return nil, nil
+	}).Describe("Returns the square of the number.").Example(4)
+
+	k.HandleFunc("pow", func(r *Request) (interface{}, error) {
+		return nil, nil
+	}).Deprecate("square")
+
+	var square, pow *MethodDoc
+
+	for _, doc := range k.Describe() {
+		switch doc.Name {
+		case "square":
+			square = doc
+		case "pow":
+			pow = doc
+		}
+	}
+
+	if square == nil || square.Description != "Returns the square of the number." || fmt.Sprint(square.Example) != "[4]" {
+		t.Fatalf("got %+v", square)
+	}
+
+	if pow == nil || !pow.Deprecated || pow.Replacement != "square" || pow.Description != "" {
+		t.Fatalf("got %+v", pow)
+	}
+}
+
+func TestMethod_Strict(t *testing.T) {
+	type SquareArgs struct {
+		Number int `json:"number"`
+	}
+
+	k := New("testkite", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+
+	square := func(r *Request) (interface{}, error) {
+		var args SquareArgs
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		return args.Number * args.Number, nil
+	}
+
+	k.HandleFunc("square", square).Args(SquareArgs{}).Strict()
+	k.HandleFunc("squareLoose", square).Args(SquareArgs{})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var result int
+
+	if err := c.Call("square", map[string]int{"number": 4}, &result); err != nil || result != 16 {
+		t.Fatalf("got %d, %v", result, err)
+	}
+
+	err := c.Call("square", map[string]int{"nubmer": 4}, &result)
+	if e, ok := err.(*Error); !ok || e.Type != "argumentError" || !strings.Contains(e.Message, "nubmer") {
+		t.Fatalf("got %#v, want argumentError", err)
+	}
+
+	if err := c.Call("squareLoose", map[string]int{"nubmer": 4}, &result); err != nil || result != 0 {
+		t.Fatalf("got %d, %v", result, err)
+	}
+}
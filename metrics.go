@@ -0,0 +1,210 @@
+package kite
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsPath is the URL path the metrics are exported at, see
+// EnableMetrics.
+const MetricsPath = "/metrics"
+
+// metricsBuckets are upper bounds of the call duration histogram, in
+// seconds. They are the default buckets of the Prometheus client.
+var metricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metrics collects the statistics of the calls handled by the kite.
+type metrics struct {
+	mu      sync.Mutex
+	methods map[string]*methodMetrics
+}
+
+type methodMetrics struct {
+	calls   uint64
+	errors  map[string]uint64 // by error type
+	buckets []uint64          // cumulative counts, one per metricsBuckets
+	sum     float64           // total duration in seconds
+}
+
+// EnableMetrics exports metrics of the kite in the Prometheus text format
+// at MetricsPath. The metrics are:
+//
+//     kite_calls_total{method}                 number of handled calls
+//     kite_call_errors_total{method,type}      number of failed calls
+//     kite_call_duration_seconds{method}       histogram of call durations
+//     kite_deprecated_calls_total{method}      number of calls of deprecated methods
+//     kite_connections                         number of connected kites
+//     kite_received_bytes_total                bytes received from all kites
+//     kite_sent_bytes_total                    bytes sent to all kites
+//
+// The calls are recorded since the metrics are enabled, except for the calls
+// of the deprecated methods, see DeprecatedCalls.
+func (k *Kite) EnableMetrics() {
+	k.metricsMu.Lock()
+	defer k.metricsMu.Unlock()
+
+	if k.metrics != nil {
+		return
+	}
+
+	k.metrics = &metrics{
+		methods: make(map[string]*methodMetrics),
+	}
+
+	k.HandleHTTPFunc(MetricsPath, k.handleMetrics)
+}
+
+// getMetrics returns the metrics, or nil if they are not enabled.
+func (k *Kite) getMetrics() *metrics {
+	k.metricsMu.Lock()
+	defer k.metricsMu.Unlock()
+
+	return k.metrics
+}
+
+// observe returns callFunc, which records the result of the call before
+// sending it.
+func (m *metrics) observe(method string, start time.Time, callFunc func(interface{}, *Error)) func(interface{}, *Error) {
+	return func(result interface{}, err *Error) {
+		m.record(method, time.Since(start), err)
+		callFunc(result, err)
+	}
+}
+
+func (m *metrics) record(method string, d time.Duration, err *Error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mm, ok := m.methods[method]
+	if !ok {
+		mm = &methodMetrics{
+			errors:  make(map[string]uint64),
+			buckets: make([]uint64, len(metricsBuckets)),
+		}
+		m.methods[method] = mm
+	}
+
+	seconds := d.Seconds()
+
+	mm.calls++
+	mm.sum += seconds
+
+	for i, le := range metricsBuckets {
+		if seconds <= le {
+			mm.buckets[i]++
+		}
+	}
+
+	if err != nil {
+		mm.errors[err.Type]++
+	}
+}
+
+func (k *Kite) handleMetrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	buf := bufio.NewWriter(w)
+	k.writeMetrics(buf)
+	buf.Flush()
+}
+
+// writeMetrics writes the metrics in the Prometheus text format.
+func (k *Kite) writeMetrics(w *bufio.Writer) {
+	m := k.getMetrics()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	methods := make([]string, 0, len(m.methods))
+	for method := range m.methods {
+		methods = append(methods, method)
+	}
+
+	sort.Strings(methods)
+
+	fmt.Fprintln(w, "# HELP kite_calls_total Number of handled calls.")
+	fmt.Fprintln(w, "# TYPE kite_calls_total counter")
+
+	for _, method := range methods {
+		fmt.Fprintf(w, "kite_calls_total{method=%s} %d\n", quoteLabel(method), m.methods[method].calls)
+	}
+
+	fmt.Fprintln(w, "# HELP kite_call_errors_total Number of failed calls.")
+	fmt.Fprintln(w, "# TYPE kite_call_errors_total counter")
+
+	for _, method := range methods {
+		mm := m.methods[method]
+
+		types := make([]string, 0, len(mm.errors))
+		for typ := range mm.errors {
+			types = append(types, typ)
+		}
+
+		sort.Strings(types)
+
+		for _, typ := range types {
+			fmt.Fprintf(w, "kite_call_errors_total{method=%s,type=%s} %d\n", quoteLabel(method), quoteLabel(typ), mm.errors[typ])
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP kite_call_duration_seconds Duration of handled calls.")
+	fmt.Fprintln(w, "# TYPE kite_call_duration_seconds histogram")
+
+	for _, method := range methods {
+		mm := m.methods[method]
+		label := quoteLabel(method)
+
+		for i, le := range metricsBuckets {
+			fmt.Fprintf(w, "kite_call_duration_seconds_bucket{method=%s,le=\"%s\"} %d\n", label, formatFloat(le), mm.buckets[i])
+		}
+
+		fmt.Fprintf(w, "kite_call_duration_seconds_bucket{method=%s,le=\"+Inf\"} %d\n", label, mm.calls)
+		fmt.Fprintf(w, "kite_call_duration_seconds_sum{method=%s} %s\n", label, formatFloat(mm.sum))
+		fmt.Fprintf(w, "kite_call_duration_seconds_count{method=%s} %d\n", label, mm.calls)
+	}
+
+	deprecated := k.DeprecatedCalls()
+
+	names := make([]string, 0, len(deprecated))
+	for name := range deprecated {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "# HELP kite_deprecated_calls_total Number of calls of deprecated methods.")
+	fmt.Fprintln(w, "# TYPE kite_deprecated_calls_total counter")
+
+	for _, name := range names {
+		fmt.Fprintf(w, "kite_deprecated_calls_total{method=%s} %d\n", quoteLabel(name), deprecated[name])
+	}
+
+	fmt.Fprintln(w, "# HELP kite_connections Number of connected kites.")
+	fmt.Fprintln(w, "# TYPE kite_connections gauge")
+	fmt.Fprintf(w, "kite_connections %d\n", atomic.LoadInt32(&k.connections))
+
+	fmt.Fprintln(w, "# HELP kite_received_bytes_total Bytes received from all kites.")
+	fmt.Fprintln(w, "# TYPE kite_received_bytes_total counter")
+	fmt.Fprintf(w, "kite_received_bytes_total %d\n", atomic.LoadUint64(&k.bytesIn))
+
+	fmt.Fprintln(w, "# HELP kite_sent_bytes_total Bytes sent to all kites.")
+	fmt.Fprintln(w, "# TYPE kite_sent_bytes_total counter")
+	fmt.Fprintf(w, "kite_sent_bytes_total %d\n", atomic.LoadUint64(&k.bytesOut))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,62 @@
+package kite
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestKite_EnableMetrics(t *testing.T) {
+	k := New("metrics", "0.0.1")
+	defer k.Close()
+
+	k.EnableMetrics()
+	k.Config.HTTPCalls = true
+
+	k.HandleFunc("ok", func(r *Request) (interface{}, error) {
+		return "ok", nil
+	}).DisableAuthentication()
+
+	k.HandleFunc("fail", func(r *Request) (interface{}, error) {
+		return nil, errors.New("failed")
+	}).DisableAuthentication()
+
+	k.HandleFunc("old", func(r *Request) (interface{}, error) {
+		return "ok", nil
+	}).DisableAuthentication().Deprecate("ok")
+
+	for _, method := range []string{"ok", "ok", "fail", "old"} {
+		rec := httptest.NewRecorder()
+		k.ServeHTTP(rec, httptest.NewRequest("POST", HTTPCallPath+method, strings.NewReader("{}")))
+	}
+
+	rec := httptest.NewRecorder()
+	k.ServeHTTP(rec, httptest.NewRequest("GET", MetricsPath, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200", rec.Code)
+	}
+
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`kite_calls_total{method="ok"} 2`,
+		`kite_calls_total{method="fail"} 1`,
+		`kite_call_errors_total{method="fail",type="genericError"} 1`,
+		`kite_call_duration_seconds_bucket{method="ok",le="+Inf"} 2`,
+		`kite_call_duration_seconds_count{method="fail"} 1`,
+		`kite_deprecated_calls_total{method="old"} 1`,
+		`kite_connections 0`,
+		`# TYPE kite_sent_bytes_total counter`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want %q in:\n%s", want, body)
+		}
+	}
+
+	if strings.Contains(body, `kite_call_errors_total{method="ok"`) {
+		t.Errorf("want no errors of the ok method:\n%s", body)
+	}
+}
@@ -0,0 +1,35 @@
+package kite
+
+// Middleware wraps the handling of every method call, which allows running
+// code before and after the handlers, like authorization, logging, metrics
+// or panic recovery, without duplicating it in every HandlerFunc:
+//
+//     k.Use(func(next kite.Handler) kite.Handler {
+//         return kite.HandlerFunc(func(r *kite.Request) (interface{}, error) {
+//             start := time.Now()
+//             result, err := next.ServeKite(r)
+//             metrics.Observe(r.Method, time.Since(start), err)
+//             return result, err
+//         })
+//     })
+//
+// A middleware may reject the call altogether by not calling next. The
+// wrapped handler runs the PreHandle and PostHandle handlers of the method
+// as well.
+type Middleware func(next Handler) Handler
+
+// Use adds middlewares that wrap all the methods of the kite. The first one
+// added is the outermost, so it runs first before the handler and last after
+// it. It should be called before the kite is run.
+func (k *Kite) Use(middlewares ...Middleware) {
+	k.middlewares = append(k.middlewares, middlewares...)
+}
+
+// wrap returns the handler wrapped with the middlewares of the kite.
+func (k *Kite) wrap(handler Handler) Handler {
+	for i := len(k.middlewares) - 1; i >= 0; i-- {
+		handler = k.middlewares[i](handler)
+	}
+
+	return handler
+}
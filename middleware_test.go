@@ -0,0 +1,67 @@
+package kite
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestKite_Use(t *testing.T) {
+	k := New("middleware", "0.0.1")
+	defer k.Close()
+
+	var calls []string
+
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(r *Request) (interface{}, error) {
+				calls = append(calls, name+" before")
+				result, err := next.ServeKite(r)
+				calls = append(calls, name+" after")
+				return result, err
+			})
+		}
+	}
+
+	k.Use(trace("first"), trace("second"))
+
+	handler := HandlerFunc(func(r *Request) (interface{}, error) {
+		calls = append(calls, "handler")
+		return "ok", nil
+	})
+
+	result, err := k.wrap(handler).ServeKite(&Request{})
+	if err != nil {
+		t.Fatalf("ServeKite()=%s", err)
+	}
+
+	if result != "ok" {
+		t.Fatalf("got %v, want ok", result)
+	}
+
+	want := []string{"first before", "second before", "handler", "second after", "first after"}
+
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("got %v, want %v", calls, want)
+	}
+
+	errDenied := errors.New("denied")
+
+	k.Use(func(next Handler) Handler {
+		return HandlerFunc(func(r *Request) (interface{}, error) {
+			return nil, errDenied
+		})
+	})
+
+	calls = nil
+
+	if _, err := k.wrap(handler).ServeKite(&Request{}); err != errDenied {
+		t.Fatalf("got %v, want %v", err, errDenied)
+	}
+
+	for _, call := range calls {
+		if call == "handler" {
+			t.Fatal("want the handler not to be called")
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package kite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Module registers a set of handlers of a feature, like file system access
+// or command execution, to the given kite.
+type Module func(k *Kite) error
+
+var (
+	modules   = make(map[string]Module)
+	modulesMu sync.RWMutex
+)
+
+// RegisterModule makes the module available under the given name, so it can
+// be enabled per deployment with Config.Modules. It is meant to be called
+// from the init function of the package that implements the module, or of
+// a Go plugin. It panics if a module with the same name is already
+// registered.
+func RegisterModule(name string, module Module) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+
+	if module == nil {
+		panic("kite: RegisterModule module is nil")
+	}
+
+	if _, ok := modules[name]; ok {
+		panic("kite: RegisterModule called twice for module " + name)
+	}
+
+	modules[name] = module
+}
+
+// Modules returns sorted names of the registered modules.
+func Modules() []string {
+	modulesMu.RLock()
+	defer modulesMu.RUnlock()
+
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// LoadModules registers handlers of the modules listed in Config.Modules.
+// It should be called before the kite is run. Modules which were already
+// loaded are skipped.
+func (k *Kite) LoadModules() error {
+	for _, name := range k.Config.Modules {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		if err := k.LoadModule(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadModule registers handlers of the module with the given name.
+func (k *Kite) LoadModule(name string) error {
+	modulesMu.RLock()
+	module, ok := modules[name]
+	modulesMu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("kite: unknown module %q", name)
+	}
+
+	k.modulesMu.Lock()
+	defer k.modulesMu.Unlock()
+
+	if k.modules[name] {
+		return nil
+	}
+
+	if err := module(k); err != nil {
+		return fmt.Errorf("kite: loading module %q failed: %s", name, err)
+	}
+
+	if k.modules == nil {
+		k.modules = make(map[string]bool)
+	}
+
+	k.modules[name] = true
+
+	k.Log.Debug("Module %q is loaded", name)
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package kite
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKite_LoadModules(t *testing.T) {
+	loads := 0
+
+	RegisterModule("test.echo", func(k *Kite) error {
+		loads++
+		k.HandleFunc("echo", func(r *Request) (interface{}, error) {
+			return r.Args.One().MustString(), nil
+		})
+		return nil
+	})
+
+	RegisterModule("test.broken", func(k *Kite) error {
+		return errors.New("broken")
+	})
+
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	k.Config.Modules = []string{"test.echo", " test.echo "}
+
+	if err := k.LoadModules(); err != nil {
+		t.Fatalf("LoadModules()=%s", err)
+	}
+
+	if loads != 1 {
+		t.Fatalf("want module to be loaded once, got %d", loads)
+	}
+
+	methods := k.Methods()
+	if len(methods) == 0 || methods[0].Name != "echo" {
+		t.Fatalf("want echo method to be registered, got %+v", methods)
+	}
+
+	if err := k.LoadModule("test.broken"); err == nil {
+		t.Fatal("want error loading broken module")
+	}
+
+	if err := k.LoadModule("test.missing"); err == nil {
+		t.Fatal("want error loading unknown module")
+	}
+}
@@ -0,0 +1,512 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Marshal returns the MessagePack encoding of v. The values are encoded
+// the way encoding/json marshals them, so a value decoded with ToJSON is
+// the same as the one encoded with json.Marshal, except for []byte values,
+// which are encoded as binaries.
+//
+// The struct fields are named with their json tags, and the values
+// implementing json.Marshaler are encoded from their JSON, e.g. the ones of
+// dnode.Partial, which holds the raw JSON of the received values.
+func Marshal(v interface{}) ([]byte, error) {
+	e := &encoder{
+		buf: make([]byte, 0, 256),
+	}
+
+	if err := e.reflect(reflect.ValueOf(v), 0); err != nil {
+		return nil, err
+	}
+
+	return e.buf, nil
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func (e *encoder) reflect(v reflect.Value, depth int) error {
+	if depth >= MaxDepth {
+		return ErrTooDeep
+	}
+
+	if !v.IsValid() {
+		e.buf = append(e.buf, 0xc0)
+		return nil
+	}
+
+	if m, ok := marshaler(v, jsonMarshalerType); ok {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+
+		p, err := m.Interface().(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return err
+		}
+
+		return e.json(p, depth)
+	}
+
+	if m, ok := marshaler(v, textMarshalerType); ok {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+
+		p, err := m.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+
+		e.string(string(p))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 0xc3)
+		} else {
+			e.buf = append(e.buf, 0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := v.Uint(); u > math.MaxInt64 {
+			e.buf = append(e.buf, 0xcf)
+			e.buf = appendUint64(e.buf, u)
+		} else {
+			e.int(int64(u))
+		}
+	case reflect.Float32:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("msgpack: unsupported float value %v", f)
+		}
+
+		e.buf = append(e.buf, 0xca)
+		u := math.Float32bits(float32(f))
+		e.buf = append(e.buf, byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+	case reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("msgpack: unsupported float value %v", f)
+		}
+
+		e.buf = append(e.buf, 0xcb)
+		e.buf = appendUint64(e.buf, math.Float64bits(f))
+	case reflect.String:
+		e.string(v.String())
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+
+		return e.reflect(v.Elem(), depth+1)
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.binary(v.Bytes())
+			return nil
+		}
+
+		return e.array(v, depth)
+	case reflect.Array:
+		return e.array(v, depth)
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+
+		return e.mapValue(v, depth)
+	case reflect.Struct:
+		return e.structValue(v, depth)
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// marshaler gives the value, which implements the interface, if v or
+// a pointer to it does.
+func marshaler(v reflect.Value, iface reflect.Type) (reflect.Value, bool) {
+	if v.Kind() != reflect.Interface && v.Type().Implements(iface) {
+		return v, true
+	}
+
+	if v.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(v.Type()).Implements(iface) {
+		return v.Addr(), true
+	}
+
+	return reflect.Value{}, false
+}
+
+// json encodes the JSON value.
+func (e *encoder) json(p []byte, depth int) error {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	sub := &encoder{dec: dec, buf: e.buf}
+
+	if err := sub.value(tok, depth); err != nil {
+		return err
+	}
+
+	e.buf = sub.buf
+
+	return nil
+}
+
+func (e *encoder) binary(p []byte) {
+	n := len(p)
+
+	switch {
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xc5, byte(n>>8), byte(n))
+	default:
+		e.buf = append(e.buf, 0xc6, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+
+	e.buf = append(e.buf, p...)
+}
+
+func (e *encoder) array(v reflect.Value, depth int) error {
+	n := v.Len()
+
+	e.buf = appendArrayHeader(e.buf, n)
+
+	for i := 0; i < n; i++ {
+		if err := e.reflect(v.Index(i), depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mapValue encodes the map with the keys sorted, like encoding/json does.
+func (e *encoder) mapValue(v reflect.Value, depth int) error {
+	keys := v.MapKeys()
+
+	type entry struct {
+		key   string
+		value reflect.Value
+	}
+
+	entries := make([]entry, len(keys))
+
+	for i, key := range keys {
+		s, err := mapKey(key)
+		if err != nil {
+			return err
+		}
+
+		entries[i] = entry{key: s, value: v.MapIndex(key)}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	e.buf = appendMapHeader(e.buf, len(entries))
+
+	for _, entry := range entries {
+		e.string(entry.key)
+
+		if err := e.reflect(entry.value, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func mapKey(key reflect.Value) (string, error) {
+	if key.Kind() == reflect.String {
+		return key.String(), nil
+	}
+
+	if m, ok := key.Interface().(encoding.TextMarshaler); ok {
+		p, err := m.MarshalText()
+		return string(p), err
+	}
+
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+
+	return "", fmt.Errorf("msgpack: unsupported map key type %s", key.Type())
+}
+
+func (e *encoder) structValue(v reflect.Value, depth int) error {
+	fields := cachedFields(v.Type())
+
+	type entry struct {
+		name  string
+		value reflect.Value
+		quote bool
+	}
+
+	entries := make([]entry, 0, len(fields))
+
+	for _, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (f.omitEmpty && isEmpty(fv)) {
+			continue
+		}
+
+		entries = append(entries, entry{name: f.name, value: fv, quote: f.quote})
+	}
+
+	e.buf = appendMapHeader(e.buf, len(entries))
+
+	for _, entry := range entries {
+		e.string(entry.name)
+
+		if entry.quote {
+			p, err := json.Marshal(entry.value.Interface())
+			if err != nil {
+				return err
+			}
+
+			e.string(string(p))
+			continue
+		}
+
+		if err := e.reflect(entry.value, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fieldByIndex returns the field, it's false if the field is promoted
+// through a nil pointer to an embedded struct.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.Field(x)
+	}
+
+	return v, true
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// field is an encoded field of a struct.
+type field struct {
+	name      string
+	index     []int
+	tagged    bool
+	omitEmpty bool
+	quote     bool
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+func cachedFields(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return f.([]field)
+}
+
+// typeFields gives the fields of the struct encoded by encoding/json, with
+// the fields of the embedded structs promoted by the same rules.
+func typeFields(t reflect.Type) []field {
+	var all []field
+
+	var walk func(t reflect.Type, index []int, visited map[reflect.Type]bool)
+	walk = func(t reflect.Type, index []int, visited map[reflect.Type]bool) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+
+			tag := sf.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+
+			name, opts := tag, ""
+			if j := strings.IndexByte(tag, ','); j != -1 {
+				name, opts = tag[:j], tag[j:]
+			}
+
+			idx := make([]int, len(index)+1)
+			copy(idx, index)
+			idx[len(index)] = i
+
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				walk(ft, idx, visited)
+				continue
+			}
+
+			if sf.PkgPath != "" {
+				continue // unexported
+			}
+
+			f := field{
+				name:      name,
+				index:     idx,
+				tagged:    name != "",
+				omitEmpty: strings.Contains(opts, ",omitempty"),
+			}
+
+			if strings.Contains(opts, ",string") {
+				switch ft.Kind() {
+				case reflect.Bool, reflect.String,
+					reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+					reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+					reflect.Float32, reflect.Float64:
+					f.quote = sf.Type.Kind() != reflect.Ptr
+				}
+			}
+
+			if f.name == "" {
+				f.name = sf.Name
+			}
+
+			all = append(all, f)
+		}
+
+		delete(visited, t)
+	}
+
+	walk(t, nil, make(map[reflect.Type]bool))
+
+	// The shallowest field of a name wins, the fields of the same depth
+	// cancel each other out, unless only one of them is tagged.
+	byName := make(map[string][]field)
+	var names []string
+
+	for _, f := range all {
+		if _, ok := byName[f.name]; !ok {
+			names = append(names, f.name)
+		}
+
+		byName[f.name] = append(byName[f.name], f)
+	}
+
+	var fields []field
+
+	for _, name := range names {
+		if f, ok := dominantField(byName[name]); ok {
+			fields = append(fields, f)
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		a, b := fields[i].index, fields[j].index
+
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+
+		return len(a) < len(b)
+	})
+
+	return fields
+}
+
+func dominantField(fields []field) (field, bool) {
+	depth := len(fields[0].index)
+	for _, f := range fields {
+		if len(f.index) < depth {
+			depth = len(f.index)
+		}
+	}
+
+	var candidates []field
+	for _, f := range fields {
+		if len(f.index) == depth {
+			candidates = append(candidates, f)
+		}
+	}
+
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+
+	var tagged []field
+	for _, f := range candidates {
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+
+	return field{}, false
+}
@@ -0,0 +1,144 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+type embedded struct {
+	ID    string `json:"id"`
+	Shown int
+}
+
+type value struct {
+	*embedded
+	Name     string            `json:"name"`
+	Skipped  string            `json:"-"`
+	Empty    string            `json:"empty,omitempty"`
+	Count    int64             `json:"count,string"`
+	Ratio    float32           `json:"ratio"`
+	Big      uint64            `json:"big"`
+	Tags     map[string]int    `json:"tags"`
+	Nested   []interface{}     `json:"nested"`
+	Raw      json.RawMessage   `json:"raw"`
+	Time     time.Time         `json:"time"`
+	Keys     map[int]string    `json:"keys"`
+	Nil      *embedded         `json:"nil"`
+	Slice    []string          `json:"slice"`
+	Array    [2]bool           `json:"array"`
+	Any      interface{}       `json:"any"`
+	Headers  map[string][]byte `json:"headers,omitempty"`
+	internal string
+}
+
+func TestMarshal(t *testing.T) {
+	cases := []interface{}{
+		nil,
+		true,
+		[]interface{}{int8(-5), uint16(65535), -1 << 40, uint64(math.MaxUint64), 1.5, "x"},
+		map[string]interface{}{"z": 1, "a": []int{1, 2}, "m": map[string]string{}},
+		&value{
+			embedded: &embedded{ID: "abc", Shown: 3},
+			Name:     "kite",
+			Skipped:  "secret",
+			Count:    42,
+			Ratio:    1.5,
+			Big:      1 << 63,
+			Tags:     map[string]int{"b": 2, "a": 1},
+			Nested:   []interface{}{map[string]interface{}{"k": nil}, "s"},
+			Raw:      json.RawMessage(`{"b":1,"a":[true]}`),
+			Time:     time.Date(2017, 10, 4, 12, 0, 0, 0, time.UTC),
+			Keys:     map[int]string{10: "ten", 2: "two"},
+			Array:    [2]bool{true, false},
+			Any:      struct{ X int }{X: 1},
+			internal: "internal",
+		},
+		value{},
+	}
+
+	for _, cas := range cases {
+		p, err := Marshal(cas)
+		if err != nil {
+			t.Fatalf("Marshal(%#v)=%s", cas, err)
+		}
+
+		got, err := ToJSON(p)
+		if err != nil {
+			t.Fatalf("ToJSON(%#v)=%s", cas, err)
+		}
+
+		want, err := json.Marshal(cas)
+		if err != nil {
+			t.Fatalf("json.Marshal(%#v)=%s", cas, err)
+		}
+
+		if !bytes.Equal(got, want) {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	cases := map[int][]byte{
+		0:      {0xc4, 0},
+		255:    {0xc4, 0xff},
+		256:    {0xc5, 0x01, 0x00},
+		65536:  {0xc6, 0x00, 0x01, 0x00, 0x00},
+		100000: {0xc6, 0x00, 0x01, 0x86, 0xa0},
+	}
+
+	for n, header := range cases {
+		data := bytes.Repeat([]byte{0x7f}, n)
+
+		p, err := Marshal(data)
+		if err != nil {
+			t.Fatalf("Marshal(%d bytes)=%s", n, err)
+		}
+
+		if !bytes.HasPrefix(p, header) || len(p) != len(header)+n {
+			t.Fatalf("Marshal(%d bytes): got header % x, want % x", n, p[:len(header)], header)
+		}
+
+		got, err := ToJSON(p)
+		if err != nil {
+			t.Fatalf("ToJSON(%d bytes)=%s", n, err)
+		}
+
+		want, _ := json.Marshal(data)
+
+		if !bytes.Equal(got, want) {
+			t.Errorf("ToJSON(%d bytes): got %.40s, want %.40s", n, got, want)
+		}
+	}
+
+	if p, err := Marshal([]byte(nil)); err != nil || !bytes.Equal(p, []byte{0xc0}) {
+		t.Errorf("Marshal(nil bytes)=% x, %v, want c0", p, err)
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	cases := []interface{}{
+		math.NaN(),
+		math.Inf(1),
+		make(chan int),
+		map[bool]int{true: 1},
+	}
+
+	for _, cas := range cases {
+		if _, err := Marshal(cas); err == nil {
+			t.Errorf("Marshal(%#v): expected error", cas)
+		}
+	}
+
+	var v interface{}
+	for i := 0; i < MaxDepth+1; i++ {
+		v = []interface{}{v}
+	}
+
+	if _, err := Marshal(v); err != ErrTooDeep {
+		t.Errorf("got %v, want %v", err, ErrTooDeep)
+	}
+}
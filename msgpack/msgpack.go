@@ -0,0 +1,582 @@
+// Package msgpack encodes dnode messages with MessagePack and transcodes
+// them between JSON and MessagePack.
+//
+// Kites which negotiated MessagePack encode the messages they send with
+// Marshal, and transcode the received ones to JSON right after receiving,
+// as they are parsed as JSON by the dnode package, see kite.FeatureMsgpack.
+// The transcoding keeps the order of the object keys, so a message
+// transcoded both ways has the same meaning as the original one:
+//
+//     p, err := msgpack.FromJSON([]byte(`{"method":"square","arguments":[4]}`))
+//     if err != nil {
+//         return err
+//     }
+//
+//     data, err := msgpack.ToJSON(p) // {"method":"square","arguments":[4]}
+//
+// Only the types which have a JSON counterpart are supported. Marshal
+// encodes []byte values as binaries, which are decoded as base64 strings,
+// like []byte values are encoded in JSON.
+package msgpack
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// MaxDepth is the maximum nesting of the arrays and maps of a transcoded
+// value.
+const MaxDepth = 10000
+
+// ErrTooDeep is returned when a value is nested deeper than MaxDepth.
+var ErrTooDeep = errors.New("msgpack: value is nested too deep")
+
+// IsMsgpack tells whether the message is a MessagePack encoded map. It is
+// used to tell MessagePack messages from JSON ones, which are objects.
+func IsMsgpack(p []byte) bool {
+	if len(p) == 0 {
+		return false
+	}
+
+	b := p[0]
+
+	return b&0xf0 == 0x80 || b == 0xde || b == 0xdf
+}
+
+// FromJSON transcodes the JSON value to MessagePack.
+func FromJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	e := &encoder{
+		dec: dec,
+		buf: make([]byte, 0, len(data)),
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.value(tok, 0); err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("msgpack: invalid JSON after top-level value")
+	}
+
+	return e.buf, nil
+}
+
+type encoder struct {
+	dec *json.Decoder
+	buf []byte
+}
+
+func (e *encoder) value(tok json.Token, depth int) error {
+	switch v := tok.(type) {
+	case nil:
+		e.buf = append(e.buf, 0xc0)
+	case bool:
+		if v {
+			e.buf = append(e.buf, 0xc3)
+		} else {
+			e.buf = append(e.buf, 0xc2)
+		}
+	case string:
+		e.string(v)
+	case json.Number:
+		return e.number(v)
+	case json.Delim:
+		if depth >= MaxDepth {
+			return ErrTooDeep
+		}
+
+		switch v {
+		case '[':
+			return e.container(false, depth+1)
+		case '{':
+			return e.container(true, depth+1)
+		}
+
+		return fmt.Errorf("msgpack: unexpected JSON delimiter %s", v)
+	default:
+		return fmt.Errorf("msgpack: unexpected JSON token %v (%T)", tok, tok)
+	}
+
+	return nil
+}
+
+// container encodes the elements of an array or of an object, the header
+// is written once the number of the elements is known.
+func (e *encoder) container(isMap bool, depth int) error {
+	start := len(e.buf)
+	e.buf = append(e.buf, 0, 0, 0, 0, 0) // room for the largest header
+
+	n := 0
+
+	for e.dec.More() {
+		tok, err := e.dec.Token()
+		if err != nil {
+			return err
+		}
+
+		if isMap {
+			key, ok := tok.(string)
+			if !ok {
+				return fmt.Errorf("msgpack: unexpected JSON object key %v", tok)
+			}
+
+			e.string(key)
+
+			if tok, err = e.dec.Token(); err != nil {
+				return err
+			}
+		}
+
+		if err := e.value(tok, depth); err != nil {
+			return err
+		}
+
+		n++
+	}
+
+	// Consume the closing delimiter.
+	if _, err := e.dec.Token(); err != nil {
+		return err
+	}
+
+	var header []byte
+	if isMap {
+		header = appendMapHeader(make([]byte, 0, 5), n)
+	} else {
+		header = appendArrayHeader(make([]byte, 0, 5), n)
+	}
+
+	copy(e.buf[start+len(header):], e.buf[start+5:])
+	e.buf = e.buf[:len(e.buf)-(5-len(header))]
+	copy(e.buf[start:], header)
+
+	return nil
+}
+
+func (e *encoder) string(s string) {
+	n := len(s)
+
+	switch {
+	case n < 32:
+		e.buf = append(e.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xda, byte(n>>8), byte(n))
+	default:
+		e.buf = append(e.buf, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+
+	e.buf = append(e.buf, s...)
+}
+
+// number encodes integers as the smallest MessagePack integers, and
+// the other numbers as 64-bit floats.
+func (e *encoder) number(n json.Number) error {
+	s := n.String()
+
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		e.int(i)
+		return nil
+	}
+
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		e.buf = append(e.buf, 0xcf)
+		e.buf = appendUint64(e.buf, u)
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("msgpack: invalid JSON number %s", s)
+	}
+
+	e.buf = append(e.buf, 0xcb)
+	e.buf = appendUint64(e.buf, math.Float64bits(f))
+
+	return nil
+}
+
+func (e *encoder) int(i int64) {
+	switch {
+	case i >= 0 && i <= 127:
+		e.buf = append(e.buf, byte(i))
+	case i >= -32 && i < 0:
+		e.buf = append(e.buf, byte(i))
+	case i >= 0 && i <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(i))
+	case i >= 0 && i <= math.MaxUint16:
+		e.buf = append(e.buf, 0xcd, byte(i>>8), byte(i))
+	case i >= 0 && i <= math.MaxUint32:
+		e.buf = append(e.buf, 0xce, byte(i>>24), byte(i>>16), byte(i>>8), byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		e.buf = append(e.buf, 0xd0, byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		e.buf = append(e.buf, 0xd1, byte(i>>8), byte(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		e.buf = append(e.buf, 0xd2, byte(i>>24), byte(i>>16), byte(i>>8), byte(i))
+	default:
+		e.buf = append(e.buf, 0xd3)
+		e.buf = appendUint64(e.buf, uint64(i))
+	}
+}
+
+func appendArrayHeader(p []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(p, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(p, 0xdc, byte(n>>8), byte(n))
+	default:
+		return append(p, 0xdd, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendMapHeader(p []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(p, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(p, 0xde, byte(n>>8), byte(n))
+	default:
+		return append(p, 0xdf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendUint64(p []byte, u uint64) []byte {
+	return append(p, byte(u>>56), byte(u>>48), byte(u>>40), byte(u>>32),
+		byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+}
+
+// ToJSON transcodes the MessagePack value to JSON.
+func ToJSON(p []byte) ([]byte, error) {
+	d := &decoder{
+		p:   p,
+		buf: make([]byte, 0, 2*len(p)),
+	}
+
+	if err := d.value(0); err != nil {
+		return nil, err
+	}
+
+	if d.off != len(d.p) {
+		return nil, errors.New("msgpack: invalid data after top-level value")
+	}
+
+	return d.buf, nil
+}
+
+var errShort = errors.New("msgpack: unexpected end of data")
+
+type decoder struct {
+	p   []byte
+	off int
+	buf []byte
+}
+
+// next returns the next n bytes of the data.
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.p)-d.off < n {
+		return nil, errShort
+	}
+
+	b := d.p[d.off : d.off+n]
+	d.off += n
+
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of n bytes.
+func (d *decoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+func (d *decoder) value(depth int) error {
+	b, err := d.next(1)
+	if err != nil {
+		return err
+	}
+
+	c := b[0]
+
+	switch {
+	case c <= 0x7f:
+		d.buf = strconv.AppendUint(d.buf, uint64(c), 10)
+		return nil
+	case c >= 0xe0:
+		d.buf = strconv.AppendInt(d.buf, int64(int8(c)), 10)
+		return nil
+	case c&0xf0 == 0x80:
+		return d.container(int(c&0x0f), true, depth)
+	case c&0xf0 == 0x90:
+		return d.container(int(c&0x0f), false, depth)
+	case c&0xe0 == 0xa0:
+		return d.string(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		d.buf = append(d.buf, "null"...)
+	case 0xc2:
+		d.buf = append(d.buf, "false"...)
+	case 0xc3:
+		d.buf = append(d.buf, "true"...)
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return err
+		}
+
+		b, err := d.next(int(n))
+		if err != nil {
+			return err
+		}
+
+		d.buf = append(d.buf, '"')
+		d.buf = append(d.buf, base64.StdEncoding.EncodeToString(b)...)
+		d.buf = append(d.buf, '"')
+	case 0xca:
+		u, err := d.uint(4)
+		if err != nil {
+			return err
+		}
+
+		return d.float(float64(math.Float32frombits(uint32(u))), 32)
+	case 0xcb:
+		u, err := d.uint(8)
+		if err != nil {
+			return err
+		}
+
+		return d.float(math.Float64frombits(u), 64)
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return err
+		}
+
+		d.buf = strconv.AppendUint(d.buf, u, 10)
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n := 1 << (c - 0xd0)
+
+		u, err := d.uint(n)
+		if err != nil {
+			return err
+		}
+
+		// Sign-extend the integer.
+		shift := uint(64 - 8*n)
+		d.buf = strconv.AppendInt(d.buf, int64(u<<shift)>>shift, 10)
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return err
+		}
+
+		return d.string(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return err
+		}
+
+		return d.container(int(n), false, depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return err
+		}
+
+		return d.container(int(n), true, depth)
+	default:
+		return fmt.Errorf("msgpack: unsupported type 0x%02x", c)
+	}
+
+	return nil
+}
+
+func (d *decoder) container(n int, isMap bool, depth int) error {
+	if depth >= MaxDepth {
+		return ErrTooDeep
+	}
+
+	open, end := byte('['), byte(']')
+	if isMap {
+		open, end = '{', '}'
+	}
+
+	// Every element takes at least a byte, which keeps made up sizes
+	// from running the loop for long.
+	if n < 0 || n > len(d.p)-d.off {
+		return errShort
+	}
+
+	d.buf = append(d.buf, open)
+
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			d.buf = append(d.buf, ',')
+		}
+
+		if isMap {
+			if err := d.key(); err != nil {
+				return err
+			}
+
+			d.buf = append(d.buf, ':')
+		}
+
+		if err := d.value(depth + 1); err != nil {
+			return err
+		}
+	}
+
+	d.buf = append(d.buf, end)
+
+	return nil
+}
+
+// key decodes a map key, which must be a string.
+func (d *decoder) key() error {
+	b, err := d.next(1)
+	if err != nil {
+		return err
+	}
+
+	c := b[0]
+
+	switch {
+	case c&0xe0 == 0xa0:
+		return d.string(int(c & 0x1f))
+	case c == 0xd9 || c == 0xda || c == 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return err
+		}
+
+		return d.string(int(n))
+	}
+
+	return fmt.Errorf("msgpack: unsupported map key type 0x%02x", c)
+}
+
+// float formats the number like encoding/json does.
+func (d *decoder) float(f float64, bits int) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("msgpack: unsupported float value %v", f)
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+
+	d.buf = strconv.AppendFloat(d.buf, f, format, -1, bits)
+
+	if format == 'e' {
+		// Clean up e-09 to e-9.
+		n := len(d.buf)
+		if n >= 4 && d.buf[n-4] == 'e' && d.buf[n-3] == '-' && d.buf[n-2] == '0' {
+			d.buf[n-2] = d.buf[n-1]
+			d.buf = d.buf[:n-1]
+		}
+	}
+
+	return nil
+}
+
+const hex = "0123456789abcdef"
+
+// string decodes a string of n bytes and appends it as a JSON string.
+func (d *decoder) string(n int) error {
+	s, err := d.next(n)
+	if err != nil {
+		return err
+	}
+
+	d.buf = append(d.buf, '"')
+
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+
+			d.buf = append(d.buf, s[start:i]...)
+
+			switch c {
+			case '"', '\\':
+				d.buf = append(d.buf, '\\', c)
+			case '\n':
+				d.buf = append(d.buf, '\\', 'n')
+			case '\r':
+				d.buf = append(d.buf, '\\', 'r')
+			case '\t':
+				d.buf = append(d.buf, '\\', 't')
+			default:
+				d.buf = append(d.buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			d.buf = append(d.buf, s[start:i]...)
+			d.buf = append(d.buf, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+
+		// U+2028 and U+2029 are valid JSON, but not valid JavaScript.
+		if r == '\u2028' || r == '\u2029' {
+			d.buf = append(d.buf, s[start:i]...)
+			d.buf = append(d.buf, '\\', 'u', '2', '0', '2', hex[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+
+		i += size
+	}
+
+	d.buf = append(d.buf, s[start:]...)
+	d.buf = append(d.buf, '"')
+
+	return nil
+}
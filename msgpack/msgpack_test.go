@@ -0,0 +1,139 @@
+package msgpack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	cases := []string{
+		`null`,
+		`true`,
+		`[false,0,127,128,255,256,65535,65536,4294967295,4294967296,9223372036854775807,18446744073709551615]`,
+		`[-1,-32,-33,-128,-129,-32768,-32769,-2147483648,-2147483649,-9223372036854775808]`,
+		`[1.5,-0.25,1e-7,1e+21,123456.789]`,
+		`{"method":"kite.ping","arguments":[{"kite":{"id":"x"}}],"callbacks":{"3":[0,"responseCallback"]}}`,
+		`{"method":3,"arguments":[],"callbacks":{}}`,
+		`["","quote \" backslash \\ newline \n tab \t ctrl \u0001","żółw ☃ \u2028"]`,
+		`{"z":1,"a":2,"m":{"y":[],"b":{}}}`,
+		`"` + strings.Repeat("x", 70000) + `"`,
+		`[` + strings.TrimSuffix(strings.Repeat("1,", 20), ",") + `]`,
+	}
+
+	for _, cas := range cases {
+		p, err := FromJSON([]byte(cas))
+		if err != nil {
+			t.Fatalf("FromJSON(%.40s)=%s", cas, err)
+		}
+
+		got, err := ToJSON(p)
+		if err != nil {
+			t.Fatalf("ToJSON(%.40s)=%s", cas, err)
+		}
+
+		if string(got) != cas {
+			t.Errorf("got %.80s, want %.80s", got, cas)
+		}
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	cases := []struct {
+		json string
+		want []byte
+	}{
+		{`{"a":1}`, []byte{0x81, 0xa1, 'a', 0x01}},
+		{`[-1,200]`, []byte{0x92, 0xff, 0xcc, 200}},
+		{`[true,null]`, []byte{0x92, 0xc3, 0xc0}},
+		{`1.5`, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+	}
+
+	for _, cas := range cases {
+		got, err := FromJSON([]byte(cas.json))
+		if err != nil {
+			t.Fatalf("FromJSON(%s)=%s", cas.json, err)
+		}
+
+		if !bytes.Equal(got, cas.want) {
+			t.Errorf("FromJSON(%s): got %x, want %x", cas.json, got, cas.want)
+		}
+	}
+
+	for _, invalid := range []string{``, `{`, `[1,]`, `{"a":1} 2`} {
+		if _, err := FromJSON([]byte(invalid)); err == nil {
+			t.Errorf("FromJSON(%q): want error", invalid)
+		}
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cases := []struct {
+		p    []byte
+		want string
+	}{
+		{[]byte{0xc4, 3, 1, 2, 3}, `"AQID"`},                                                   // bin8
+		{[]byte{0xca, 0x3f, 0xc0, 0, 0}, `1.5`},                                                // float32
+		{[]byte{0xa2, 0xff, 'a'}, `"\ufffda"`},                                                 // invalid UTF-8
+		{[]byte{0xde, 0, 1, 0xa1, 'k', 0xd0, 0x80}, `{"k":-128}`},                              // map16, int8
+		{[]byte{0xdc, 0, 2, 0xd1, 0xff, 0x7f, 0xa0}, `[-129,""]`},                              // array16, int16
+		{[]byte{0xdb, 0, 0, 0, 1, 'x'}, `"x"`},                                                 // str32
+		{[]byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, `18446744073709551615`}, // uint64
+	}
+
+	for _, cas := range cases {
+		got, err := ToJSON(cas.p)
+		if err != nil {
+			t.Fatalf("ToJSON(%x)=%s", cas.p, err)
+		}
+
+		if string(got) != cas.want {
+			t.Errorf("ToJSON(%x): got %s, want %s", cas.p, got, cas.want)
+		}
+	}
+
+	invalid := [][]byte{
+		{},
+		{0x92, 0x01},                         // short array
+		{0xdd, 0xff, 0xff, 0xff, 0xff},       // made up size
+		{0x81, 0x01, 0x01},                   // integer key
+		{0xd4, 0x01, 0x01},                   // ext
+		{0x01, 0x01},                         // trailing data
+		{0xcb, 0x7f, 0xf0, 0, 0, 0, 0, 0, 0}, // +Inf
+	}
+
+	for _, p := range invalid {
+		if _, err := ToJSON(p); err == nil {
+			t.Errorf("ToJSON(%x): want error", p)
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	deep := strings.Repeat("[", MaxDepth+1) + strings.Repeat("]", MaxDepth+1)
+
+	if _, err := FromJSON([]byte(deep)); err == nil {
+		t.Fatal("FromJSON(): want error")
+	}
+
+	p := bytes.Repeat([]byte{0x91}, MaxDepth+1)
+	p = append(p, 0xc0)
+
+	if _, err := ToJSON(p); err != ErrTooDeep {
+		t.Fatalf("ToJSON()=%v, want %v", err, ErrTooDeep)
+	}
+}
+
+func TestIsMsgpack(t *testing.T) {
+	for _, p := range [][]byte{{0x80}, {0x8f}, {0xde}, {0xdf}} {
+		if !IsMsgpack(p) {
+			t.Errorf("IsMsgpack(%x)=false", p)
+		}
+	}
+
+	for _, p := range [][]byte{nil, []byte(`{}`), {0x90}, {0xc0}} {
+		if IsMsgpack(p) {
+			t.Errorf("IsMsgpack(%x)=true", p)
+		}
+	}
+}
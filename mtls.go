@@ -0,0 +1,116 @@
+package kite
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+)
+
+// AuthenticateFromTLS is the "mtls" Authenticator, an alternative to tokens
+// for kites connected over TLS. It verifies the certificate chain the remote
+// kite presented during the TLS handshake with the CAs of the kite, which
+// are the Kite.TLSConfig.ClientCAs or the ones read from
+// Config.TLSClientCAFile, and authenticates the user with the name the
+// certificate was issued for, see CertificateUsername.
+//
+// The remote kite dials with its certificate set in
+// Config.Websocket.TLSClientConfig and with the authentication:
+//
+//     client.Auth = &kite.Auth{Type: "mtls"}
+func (k *Kite) AuthenticateFromTLS(r *Request) error {
+	state := r.Client.TLSConnectionState()
+	if state == nil {
+		return errors.New("connection is not made over TLS")
+	}
+
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("no client certificate")
+	}
+
+	roots, err := k.clientCAs()
+	if err != nil {
+		return err
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	for _, cert := range state.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	cert := state.PeerCertificates[0]
+
+	if _, err := cert.Verify(opts); err != nil {
+		return err
+	}
+
+	username := CertificateUsername(cert)
+	if k.CertificateUsername != nil {
+		if username, err = k.CertificateUsername(cert); err != nil {
+			return err
+		}
+	}
+
+	if username == "" {
+		return errors.New("client certificate has no username")
+	}
+
+	r.Username = username
+
+	return nil
+}
+
+// CertificateUsername gives the username of the owner of the certificate,
+// which is the common name of the subject or, when it is empty, the first
+// of the DNS names and email addresses of the certificate.
+func CertificateUsername(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+
+	if len(cert.DNSNames) != 0 {
+		return cert.DNSNames[0]
+	}
+
+	if len(cert.EmailAddresses) != 0 {
+		return cert.EmailAddresses[0]
+	}
+
+	return ""
+}
+
+// clientCAs gives the CAs the client certificates are verified with.
+func (k *Kite) clientCAs() (*x509.CertPool, error) {
+	if k.TLSConfig != nil && k.TLSConfig.ClientCAs != nil {
+		return k.TLSConfig.ClientCAs, nil
+	}
+
+	if k.Config.TLSClientCAFile == "" {
+		return nil, errors.New("no CAs to verify client certificates with")
+	}
+
+	k.clientCAsOnce.Do(func() {
+		k.clientCAsPool, k.clientCAsErr = loadCertPool(k.Config.TLSClientCAFile)
+	})
+
+	return k.clientCAsPool, k.clientCAsErr
+}
+
+// TLSConnectionState gives the state of the TLS connection the remote kite
+// connected with, it is nil if the connection is not made over TLS.
+func (c *Client) TLSConnectionState() *tls.ConnectionState {
+	session := c.getSession()
+	if session == nil {
+		return nil
+	}
+
+	if r := session.Request(); r != nil {
+		return r.TLS
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package kite
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/koding/kite/config"
+)
+
+func TestKite_AuthenticateFromTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kite-mtls")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, nil)
+	other := newTestCert(t, nil)
+
+	caFile, _ := ca.write(t, dir, "ca")
+
+	conf := config.New()
+	conf.TLSClientCAFile = caFile
+
+	k := NewWithConfig("server", "0.0.1", conf)
+	defer k.Close()
+
+	request := func(certs ...*testCert) *Request {
+		req := &http.Request{TLS: &tls.ConnectionState{}}
+		for _, c := range certs {
+			req.TLS.PeerCertificates = append(req.TLS.PeerCertificates, c.cert)
+		}
+
+		c := k.NewClient("")
+		c.setSession(&httpSession{id: "mtls", req: req})
+
+		return &Request{
+			Client:    c,
+			LocalKite: k,
+			Auth:      &Auth{Type: "mtls"},
+		}
+	}
+
+	r := request(newTestCert(t, ca, "alice.example.com"))
+
+	if err := k.Authenticators["mtls"](r); err != nil {
+		t.Fatalf("AuthenticateFromTLS()=%s", err)
+	}
+
+	if r.Username != "kite test" {
+		t.Fatalf("got %q, want %q", r.Username, "kite test")
+	}
+
+	if err := k.AuthenticateFromTLS(request(newTestCert(t, other, "bob.example.com"))); err == nil {
+		t.Fatal("expected certificate of an untrusted CA to be rejected")
+	}
+
+	if err := k.AuthenticateFromTLS(request()); err == nil {
+		t.Fatal("expected connection without a certificate to be rejected")
+	}
+
+	k.CertificateUsername = func(cert *x509.Certificate) (string, error) {
+		return cert.DNSNames[0], nil
+	}
+
+	r = request(newTestCert(t, ca, "alice.example.com"))
+
+	if err := k.AuthenticateFromTLS(r); err != nil {
+		t.Fatalf("AuthenticateFromTLS()=%s", err)
+	}
+
+	if r.Username != "alice.example.com" {
+		t.Fatalf("got %q, want %q", r.Username, "alice.example.com")
+	}
+}
@@ -0,0 +1,29 @@
+package kite
+
+import (
+	"encoding/json"
+
+	"github.com/koding/kite/dnode"
+)
+
+// applyNaming converts keys of the JSON objects of v to the naming convention
+// of Config.FieldNaming. Values carrying callbacks are sent as they are, as
+// the callbacks could not be found in the converted value.
+func (k *Kite) applyNaming(v interface{}) interface{} {
+	naming := k.Config.FieldNaming
+	if naming == dnode.GoNaming || v == nil {
+		return v
+	}
+
+	if len(dnode.NewScrubber().Scrub([]interface{}{v})) != 0 {
+		return v
+	}
+
+	p, err := naming.Marshal(v)
+	if err != nil {
+		k.Log.Debug("Applying %s naming failed: %s", naming, err)
+		return v
+	}
+
+	return json.RawMessage(p)
+}
@@ -0,0 +1,82 @@
+package kite
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/juju/ratelimit"
+)
+
+// ThrottleOutgoing limits the rate of calls made by all the clients of the
+// kite to the remote kites with the given ID or name, which protects fragile
+// kites from being overwhelmed by e.g. batch jobs. The limit is a token
+// bucket, the same as in Method.Throttle, shared by all the clients; limits
+// by kite ID take precedence over the ones by name.
+//
+// Calls exceeding the limit wait for the bucket to be refilled, up to their
+// timeout or Config.Timeout when they have none. Calls which can't be sent
+// in time fail with a "requestLimitError" error. A zero capacity removes
+// the limit.
+func (k *Kite) ThrottleOutgoing(target string, fillInterval time.Duration, capacity int64) {
+	k.outboundMu.Lock()
+	defer k.outboundMu.Unlock()
+
+	if capacity <= 0 {
+		delete(k.outbound, target)
+		return
+	}
+
+	if k.outbound == nil {
+		k.outbound = make(map[string]*ratelimit.Bucket)
+	}
+
+	k.outbound[target] = ratelimit.NewBucket(fillInterval, capacity)
+}
+
+// outboundBucket returns the bucket limiting the calls to the remote kite,
+// or nil if they are not limited.
+func (c *Client) outboundBucket() *ratelimit.Bucket {
+	k := c.LocalKite
+	if k == nil {
+		return nil
+	}
+
+	k.outboundMu.RLock()
+	defer k.outboundMu.RUnlock()
+
+	if len(k.outbound) == 0 {
+		return nil
+	}
+
+	if b, ok := k.outbound[c.Kite.ID]; ok && c.Kite.ID != "" {
+		return b
+	}
+
+	if b, ok := k.outbound[c.Kite.Name]; ok && c.Kite.Name != "" {
+		return b
+	}
+
+	return nil
+}
+
+// waitOutbound waits until the outbound rate limit allows sending the call.
+func (c *Client) waitOutbound(call *Call) error {
+	b := c.outboundBucket()
+	if b == nil {
+		return nil
+	}
+
+	timeout := call.Timeout
+	if timeout == 0 {
+		timeout = c.config().Timeout
+	}
+
+	if !b.WaitMaxDuration(1, timeout) {
+		return &Error{
+			Type:    "requestLimitError",
+			Message: fmt.Sprintf("The maximum request rate to %q is exceeded.", c.Kite.Name),
+		}
+	}
+
+	return nil
+}
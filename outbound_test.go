@@ -0,0 +1,44 @@
+package kite
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClient_ThrottleOutgoing(t *testing.T) {
+	k := New("outbound", "0.0.1")
+	defer k.Close()
+
+	k.ThrottleOutgoing("fragile", time.Hour, 2)
+
+	c := k.NewClient("http://127.0.0.1:1/kite")
+	c.Kite.Name = "fragile"
+
+	if c.outboundBucket() == nil {
+		t.Fatal("want the client to be throttled")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := c.waitOutbound(&Call{Timeout: 50 * time.Millisecond}); err != nil {
+			t.Fatalf("%d: waitOutbound()=%s", i, err)
+		}
+	}
+
+	err := c.waitOutbound(&Call{Timeout: 50 * time.Millisecond})
+	if e, ok := err.(*Error); !ok || e.Type != "requestLimitError" {
+		t.Fatalf("want requestLimitError, got %v", err)
+	}
+
+	other := k.NewClient("http://127.0.0.1:1/kite")
+	other.Kite.Name = "sturdy"
+
+	if other.outboundBucket() != nil {
+		t.Fatal("want the client not to be throttled")
+	}
+
+	k.ThrottleOutgoing("fragile", 0, 0)
+
+	if c.outboundBucket() != nil {
+		t.Fatal("want the limit to be removed")
+	}
+}
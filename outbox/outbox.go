@@ -0,0 +1,326 @@
+// Package outbox delivers method calls, which must not be lost, like the
+// ones with side effects on the remote kite. The calls are recorded in
+// a persistent storage before they are sent and removed once the remote
+// kite acknowledges them, so the calls pending when the process crashed
+// are sent again after it's restarted:
+//
+//     s, err := outbox.NewFileStorage("/var/lib/agent/outbox")
+//     if err != nil {
+//         return err
+//     }
+//
+//     o := outbox.New(c, s)
+//     o.Start()
+//     defer o.Close()
+//
+//     if _, err := o.Send("billing.charge", charge); err != nil {
+//         return err
+//     }
+//
+// The calls are delivered at least once: a call may be sent again if
+// the process crashes before its acknowledgment is recorded, so the remote
+// handlers should be idempotent, e.g. by keying the effects on an ID
+// passed in the arguments.
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+// Client sends the calls, it's implemented by *kite.Client and
+// *kite.ClientPool.
+type Client interface {
+	TellWithTimeout(method string, timeout time.Duration, args ...interface{}) (*dnode.Partial, error)
+}
+
+// Entry is a call recorded in the outbox.
+type Entry struct {
+	// ID identifies the entry, the entries are sent in the order of
+	// their IDs.
+	ID string `json:"id"`
+
+	Method  string            `json:"method"`
+	Args    []json.RawMessage `json:"args"`
+	Created time.Time         `json:"created"`
+
+	// Attempts is the number of the failed attempts to deliver the call.
+	Attempts int `json:"attempts"`
+}
+
+// Storage persists the entries of the outbox. It must be safe for
+// concurrent use.
+type Storage interface {
+	// Put stores the entry, replacing the one with the same ID.
+	Put(e *Entry) error
+
+	// Delete removes the entry with the given ID. Deleting an entry that
+	// does not exist is not an error.
+	Delete(id string) error
+
+	// Entries returns all the stored entries, sorted by their IDs.
+	Entries() ([]*Entry, error)
+}
+
+// Outbox records the calls in the storage and delivers them in order
+// in background, once it's started.
+type Outbox struct {
+	// Client the calls are sent with.
+	Client Client
+
+	// Storage the calls are recorded in.
+	Storage Storage
+
+	// Timeout is the timeout of waiting for the reply to a call.
+	//
+	// When 0, the default value of 30s is used.
+	Timeout time.Duration
+
+	// RetryInterval is the time to wait before retrying to deliver a call,
+	// which failed.
+	//
+	// When 0, the default value of 5s is used.
+	RetryInterval time.Duration
+
+	// OnDelivered is called once the call is acknowledged, with the reply
+	// of the remote kite. The errors returned by the remote handler are
+	// replies too, so err can be non-nil.
+	OnDelivered func(e *Entry, result *dnode.Partial, err error)
+
+	// Log is used for logging the failed deliveries, if non-nil.
+	Log kite.Logger
+
+	mu      sync.Mutex
+	lastID  int64
+	started bool
+	kick    chan struct{}
+	closed  chan struct{}
+	done    chan struct{}
+}
+
+// New returns an outbox sending the calls with the client.
+func New(c Client, s Storage) *Outbox {
+	return &Outbox{
+		Client:  c,
+		Storage: s,
+	}
+}
+
+// Send records the call in the storage and returns the ID of its entry,
+// the call is sent in background. The arguments must be encodable to JSON,
+// so they can't contain callbacks.
+func (o *Outbox) Send(method string, args ...interface{}) (id string, err error) {
+	e := &Entry{
+		ID:      o.nextID(),
+		Method:  method,
+		Args:    make([]json.RawMessage, len(args)),
+		Created: time.Now().UTC(),
+	}
+
+	for i, arg := range args {
+		if e.Args[i], err = json.Marshal(arg); err != nil {
+			return "", fmt.Errorf("outbox: encoding argument %d of %q failed: %s", i, method, err)
+		}
+	}
+
+	if err := o.Storage.Put(e); err != nil {
+		return "", err
+	}
+
+	o.init()
+
+	select {
+	case o.kick <- struct{}{}:
+	default:
+	}
+
+	return e.ID, nil
+}
+
+// Pending returns the entries, which are not delivered yet.
+func (o *Outbox) Pending() ([]*Entry, error) {
+	return o.Storage.Entries()
+}
+
+// Start starts delivering the calls recorded in the storage, including
+// the ones left by the previous runs of the process.
+func (o *Outbox) Start() {
+	o.init()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.started {
+		return
+	}
+
+	o.started = true
+
+	go o.run()
+}
+
+// Close stops delivering the calls and waits for the one being sent.
+// The calls not delivered yet stay in the storage.
+func (o *Outbox) Close() {
+	o.init()
+
+	o.mu.Lock()
+	select {
+	case <-o.closed:
+	default:
+		close(o.closed)
+	}
+	started := o.started
+	o.mu.Unlock()
+
+	if started {
+		<-o.done
+	}
+}
+
+func (o *Outbox) init() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.kick == nil {
+		o.kick = make(chan struct{}, 1)
+		o.closed = make(chan struct{})
+		o.done = make(chan struct{})
+	}
+}
+
+// nextID returns the ID of a new entry, the IDs grow monotonically
+// as long as the clock does.
+func (o *Outbox) nextID() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	id := time.Now().UnixNano()
+	if id <= o.lastID {
+		id = o.lastID + 1
+	}
+
+	o.lastID = id
+
+	return fmt.Sprintf("%020d", id)
+}
+
+func (o *Outbox) run() {
+	defer close(o.done)
+
+	for {
+		// With all the calls delivered, it waits for new ones.
+		var retry *time.Timer
+		var retryC <-chan time.Time
+		if !o.deliver() {
+			retry = time.NewTimer(o.retryInterval())
+			retryC = retry.C
+		}
+
+		select {
+		case <-o.closed:
+			return
+		case <-o.kick:
+		case <-retryC:
+		}
+
+		if retry != nil {
+			retry.Stop()
+		}
+	}
+}
+
+// deliver sends the pending calls in order, until one of them fails.
+// It returns true if all of them were delivered.
+func (o *Outbox) deliver() bool {
+	entries, err := o.Storage.Entries()
+	if err != nil {
+		o.logf("reading the entries failed: %s", err)
+		return false
+	}
+
+	for _, e := range entries {
+		select {
+		case <-o.closed:
+			return false
+		default:
+		}
+
+		args := make([]interface{}, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = arg
+		}
+
+		result, err := o.Client.TellWithTimeout(e.Method, o.timeout(), args...)
+		if err != nil && !IsAcknowledged(err) {
+			e.Attempts++
+
+			o.logf("delivering %q call %s failed (attempt %d): %s", e.Method, e.ID, e.Attempts, err)
+
+			if err := o.Storage.Put(e); err != nil {
+				o.logf("updating %s failed: %s", e.ID, err)
+			}
+
+			return false
+		}
+
+		if err := o.Storage.Delete(e.ID); err != nil {
+			o.logf("removing %s failed: %s", e.ID, err)
+			return false
+		}
+
+		if o.OnDelivered != nil {
+			o.OnDelivered(e, result, err)
+		}
+	}
+
+	return true
+}
+
+// undelivered are the types of the errors, which mean the call may not
+// have reached the remote handler.
+var undelivered = map[string]bool{
+	"timeout":           true,
+	"sendError":         true,
+	"disconnect":        true,
+	"canceled":          true,
+	"overloadedError":   true,
+	"shutdownError":     true,
+	"circuitOpen":       true,
+	"requestLimitError": true,
+	"rateLimitError":    true,
+}
+
+// IsAcknowledged tells whether the non-nil error of a call was returned
+// by the remote handler, which means the call was delivered.
+func IsAcknowledged(err error) bool {
+	e, ok := err.(*kite.Error)
+	return ok && !undelivered[e.Type]
+}
+
+func (o *Outbox) logf(format string, args ...interface{}) {
+	if o.Log != nil {
+		o.Log.Warning("outbox: "+format, args...)
+	}
+}
+
+func (o *Outbox) timeout() time.Duration {
+	if o.Timeout > 0 {
+		return o.Timeout
+	}
+
+	return 30 * time.Second
+}
+
+func (o *Outbox) retryInterval() time.Duration {
+	if o.RetryInterval > 0 {
+		return o.RetryInterval
+	}
+
+	return 5 * time.Second
+}
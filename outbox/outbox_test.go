@@ -0,0 +1,135 @@
+package outbox_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/outbox"
+)
+
+type client struct {
+	mu    sync.Mutex
+	calls []string
+	fail  int // number of the calls to fail with a timeout
+}
+
+func (c *client) TellWithTimeout(method string, _ time.Duration, args ...interface{}) (*dnode.Partial, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.fail > 0 {
+		c.fail--
+		return nil, &kite.Error{Type: "timeout"}
+	}
+
+	arg := string(args[0].(json.RawMessage))
+	c.calls = append(c.calls, method+" "+arg)
+
+	if method == "invalid" {
+		return nil, &kite.Error{Type: "genericError", Message: "invalid call"}
+	}
+
+	return &dnode.Partial{Raw: []byte("true")}, nil
+}
+
+func TestOutbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kiteoutbox")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := outbox.NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFileStorage()=%s", err)
+	}
+
+	// The calls are recorded, but not sent, like by a process that crashed.
+	o := outbox.New(nil, s)
+
+	for _, method := range []string{"charge", "invalid", "refund"} {
+		if _, err := o.Send(method, map[string]int{"amount": 10}); err != nil {
+			t.Fatalf("Send()=%s", err)
+		}
+	}
+
+	pending, err := o.Pending()
+	if err != nil {
+		t.Fatalf("Pending()=%s", err)
+	}
+
+	if len(pending) != 3 {
+		t.Fatalf("got %d pending entries, want 3", len(pending))
+	}
+
+	s, err = outbox.NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFileStorage()=%s", err)
+	}
+
+	c := &client{fail: 1}
+
+	delivered := make(chan error, 4)
+
+	o = outbox.New(c, s)
+	o.RetryInterval = 10 * time.Millisecond
+	o.OnDelivered = func(e *outbox.Entry, _ *dnode.Partial, err error) {
+		delivered <- err
+	}
+
+	o.Start()
+	defer o.Close()
+
+	if _, err := o.Send("notify", "done"); err != nil {
+		t.Fatalf("Send()=%s", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		select {
+		case <-delivered:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for call %d", i)
+		}
+	}
+
+	want := []string{
+		`charge {"amount":10}`,
+		`invalid {"amount":10}`,
+		`refund {"amount":10}`,
+		`notify "done"`,
+	}
+
+	c.mu.Lock()
+	calls := c.calls
+	c.mu.Unlock()
+
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("got %q, want %q", calls, want)
+	}
+
+	if pending, err := o.Pending(); err != nil || len(pending) != 0 {
+		t.Fatalf("Pending()=%v, %v; want no entries", pending, err)
+	}
+}
+
+func TestIsAcknowledged(t *testing.T) {
+	cases := map[error]bool{
+		&kite.Error{Type: "genericError"}: true,
+		&kite.Error{Type: "timeout"}:      false,
+		&kite.Error{Type: "disconnect"}:   false,
+		os.ErrNotExist:                    false,
+	}
+
+	for err, want := range cases {
+		if got := outbox.IsAcknowledged(err); got != want {
+			t.Errorf("IsAcknowledged(%v)=%t, want %t", err, got, want)
+		}
+	}
+}
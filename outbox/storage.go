@@ -0,0 +1,208 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/koding/kite/state"
+)
+
+// FileStorage stores every entry in a separate JSON file of a directory.
+// The files are written atomically and synced to the disk, so the entries
+// survive crashes of the process and of the machine.
+type FileStorage struct {
+	dir string
+	mu  sync.Mutex
+}
+
+var _ Storage = (*FileStorage)(nil)
+
+// NewFileStorage returns a storage keeping the entries in the directory,
+// which is created if it does not exist.
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FileStorage{dir: dir}, nil
+}
+
+// Put implements the Storage interface.
+func (s *FileStorage) Put(e *Entry) error {
+	p, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := ioutil.TempFile(s.dir, e.ID+".tmp")
+	if err != nil {
+		return err
+	}
+
+	tmp := f.Name()
+
+	_, err = f.Write(p)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp, s.path(e.ID))
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return s.syncDir()
+}
+
+// Delete implements the Storage interface.
+func (s *FileStorage) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return s.syncDir()
+}
+
+// Entries implements the Storage interface. The leftovers of the writes
+// interrupted by crashes are ignored.
+func (s *FileStorage) Entries() ([]*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+
+		p, err := ioutil.ReadFile(filepath.Join(s.dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var e Entry
+		if err := json.Unmarshal(p, &e); err != nil {
+			return nil, fmt.Errorf("outbox: reading %s failed: %s", fi.Name(), err)
+		}
+
+		entries = append(entries, &e)
+	}
+
+	sort.Sort(byID(entries))
+
+	return entries, nil
+}
+
+func (s *FileStorage) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// syncDir makes the renames and removals in the directory durable.
+func (s *FileStorage) syncDir() error {
+	d, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	// Syncing directories is not supported on some platforms, like
+	// Windows, the error is ignored there.
+	d.Sync()
+
+	return nil
+}
+
+// StateStorage stores the entries in a bucket of the state store, which
+// is an SQLite database, see the state package.
+type StateStorage struct {
+	store  *state.Store
+	bucket string
+}
+
+var _ Storage = (*StateStorage)(nil)
+
+// NewStateStorage returns a storage keeping the entries in the bucket
+// of the store.
+func NewStateStorage(store *state.Store, bucket string) *StateStorage {
+	return &StateStorage{
+		store:  store,
+		bucket: bucket,
+	}
+}
+
+// Put implements the Storage interface.
+func (s *StateStorage) Put(e *Entry) error {
+	p, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Put(s.bucket, e.ID, p)
+}
+
+// Delete implements the Storage interface.
+func (s *StateStorage) Delete(id string) error {
+	return s.store.Delete(s.bucket, id)
+}
+
+// Entries implements the Storage interface.
+func (s *StateStorage) Entries() ([]*Entry, error) {
+	var entries []*Entry
+
+	err := s.store.View(func(tx *state.Tx) error {
+		keys, err := tx.Keys(s.bucket)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			p, err := tx.Get(s.bucket, key)
+			if err != nil {
+				return err
+			}
+
+			var e Entry
+			if err := json.Unmarshal(p, &e); err != nil {
+				return fmt.Errorf("outbox: reading %s failed: %s", key, err)
+			}
+
+			entries = append(entries, &e)
+		}
+
+		return nil
+	})
+
+	return entries, err
+}
+
+type byID []*Entry
+
+func (p byID) Len() int           { return len(p) }
+func (p byID) Less(i, j int) bool { return p[i].ID < p[j].ID }
+func (p byID) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
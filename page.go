@@ -0,0 +1,240 @@
+package kite
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/koding/kite/dnode"
+)
+
+// DefaultPageLimit is the number of items returned in a single page by
+// PaginateSlice when the caller does not specify the limit.
+var DefaultPageLimit = 100
+
+// Page is the standard result of list-style methods. A method returns the
+// items of the page requested with PageArgs, and the cursor of the next
+// page, which is empty for the last one.
+type Page struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// PageArgs are the standard pagination arguments of list-style methods.
+// They are sent as fields of the method's argument object, alongside
+// the method-specific fields.
+type PageArgs struct {
+	Cursor string `json:"cursor,omitempty"` // empty for the first page
+	Limit  int    `json:"limit,omitempty"`  // maximum number of items
+}
+
+// PageArgs reads the pagination arguments of the request. A request without
+// arguments asks for the first page.
+func (r *Request) PageArgs() (*PageArgs, error) {
+	var args PageArgs
+
+	if r.Args == nil {
+		return &args, nil
+	}
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	return &args, nil
+}
+
+// PaginateSlice returns the page of the given slice requested by args.
+// Cursors created by PaginateSlice are opaque offsets into the slice, so
+// the slice should be sorted the same way on every call.
+func PaginateSlice(items interface{}, args *PageArgs) (*Page, error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("kite: paginating %T, want slice", items)
+	}
+
+	if v.Kind() == reflect.Array {
+		// Arrays passed by value are not addressable, so they
+		// can't be sliced without being copied first.
+		a := reflect.New(v.Type()).Elem()
+		a.Set(v)
+		v = a
+	}
+
+	offset := 0
+	if args.Cursor != "" {
+		p, err := base64.RawURLEncoding.DecodeString(args.Cursor)
+		if err != nil {
+			return nil, errors.New("kite: invalid cursor")
+		}
+
+		if offset, err = strconv.Atoi(string(p)); err != nil || offset < 0 {
+			return nil, errors.New("kite: invalid cursor")
+		}
+	}
+
+	limit := args.Limit
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+
+	if offset > v.Len() {
+		offset = v.Len()
+	}
+
+	// Limit comes from the caller, so the clamp must not overflow.
+	if limit > v.Len()-offset {
+		limit = v.Len() - offset
+	}
+
+	end := offset + limit
+
+	page := &Page{
+		Items: v.Slice(offset, end).Interface(),
+	}
+
+	if end < v.Len() {
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	}
+
+	return page, nil
+}
+
+// PageIterator iterates over the pages of a list-style method, see
+// Client.Pages:
+//
+//     it := c.Pages("fs.list", args, 100)
+//     for it.Next() {
+//         var files []File
+//         if err := it.Items(&files); err != nil {
+//             return err
+//         }
+//         ...
+//     }
+//     if err := it.Err(); err != nil {
+//         return err
+//     }
+//
+type PageIterator struct {
+	ctx    context.Context
+	c      *Client
+	method string
+	args   interface{}
+	limit  int
+
+	cursor string
+	items  *dnode.Partial
+	done   bool
+	err    error
+}
+
+// Pages returns an iterator over the pages of the given list-style method.
+// The args must marshal to a JSON object, or be nil - the pagination
+// arguments are added to it. A zero limit lets the remote kite choose
+// the page size.
+func (c *Client) Pages(method string, args interface{}, limit int) *PageIterator {
+	return c.PagesWithContext(context.Background(), method, args, limit)
+}
+
+// PagesWithContext does the same thing with Pages() method except the calls
+// are made with TellWithContext.
+func (c *Client) PagesWithContext(ctx context.Context, method string, args interface{}, limit int) *PageIterator {
+	return &PageIterator{
+		ctx:    ctx,
+		c:      c,
+		method: method,
+		args:   args,
+		limit:  limit,
+	}
+}
+
+// Next fetches the next page. It returns false when there are no more pages
+// or an error occurred, see Err.
+func (it *PageIterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+
+	args, err := it.pageArgs()
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	res, err := it.c.TellWithContext(it.ctx, it.method, args)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	var page struct {
+		Items      *dnode.Partial `json:"items"`
+		NextCursor string         `json:"nextCursor"`
+	}
+
+	if res != nil {
+		if err := res.Unmarshal(&page); err != nil {
+			it.err = &Error{
+				Type:    "invalidResponse",
+				Message: fmt.Sprintf("Unable to unmarshal page of %q method: %s", it.method, err),
+			}
+			return false
+		}
+	}
+
+	it.items = page.Items
+	it.cursor = page.NextCursor
+	it.done = page.NextCursor == ""
+
+	return true
+}
+
+// Items unmarshals the items of the current page into v.
+func (it *PageIterator) Items(v interface{}) error {
+	if it.items == nil {
+		return nil
+	}
+
+	return it.items.Unmarshal(v)
+}
+
+// Cursor returns the cursor of the next page. It can be used to resume
+// the iteration later, by passing it in the args.
+func (it *PageIterator) Cursor() string {
+	return it.cursor
+}
+
+// Err returns the error, which stopped the iteration.
+func (it *PageIterator) Err() error {
+	return it.err
+}
+
+// pageArgs merges the pagination arguments into the method arguments.
+func (it *PageIterator) pageArgs() (map[string]interface{}, error) {
+	args := make(map[string]interface{})
+
+	if it.args != nil {
+		p, err := json.Marshal(it.args)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(p, &args); err != nil {
+			return nil, fmt.Errorf("kite: paginated method arguments must be an object: %s", err)
+		}
+	}
+
+	if it.cursor != "" {
+		args["cursor"] = it.cursor
+	}
+
+	if it.limit > 0 {
+		args["limit"] = it.limit
+	}
+
+	return args, nil
+}
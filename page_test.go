@@ -0,0 +1,122 @@
+package kite
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPaginateSlice(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+
+	var got [][]int
+	args := &PageArgs{Limit: 2}
+
+	for {
+		page, err := PaginateSlice(items, args)
+		if err != nil {
+			t.Fatalf("PaginateSlice()=%s", err)
+		}
+
+		got = append(got, page.Items.([]int))
+
+		if page.NextCursor == "" {
+			break
+		}
+
+		args.Cursor = page.NextCursor
+	}
+
+	want := [][]int{{1, 2}, {3, 4}, {5}}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if _, err := PaginateSlice(items, &PageArgs{Cursor: "%%%"}); err == nil {
+		t.Fatal("expected invalid cursor to fail")
+	}
+
+	if _, err := PaginateSlice("foo", &PageArgs{}); err == nil {
+		t.Fatal("expected paginating a string to fail")
+	}
+
+	maxInt := int(^uint(0) >> 1)
+
+	page, err := PaginateSlice(items, &PageArgs{Cursor: args.Cursor, Limit: maxInt})
+	if err != nil {
+		t.Fatalf("PaginateSlice()=%s", err)
+	}
+
+	if fmt.Sprint(page.Items) != "[5]" || page.NextCursor != "" {
+		t.Fatalf("got %v (cursor %q), want [5]", page.Items, page.NextCursor)
+	}
+
+	page, err = PaginateSlice([3]string{"a", "b", "c"}, &PageArgs{Limit: 2})
+	if err != nil {
+		t.Fatalf("PaginateSlice()=%s", err)
+	}
+
+	if fmt.Sprint(page.Items) != "[a b]" || page.NextCursor == "" {
+		t.Fatalf("got %v (cursor %q), want [a b]", page.Items, page.NextCursor)
+	}
+}
+
+func TestClient_Pages(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+
+	k.HandleFunc("list", func(r *Request) (interface{}, error) {
+		args, err := r.PageArgs()
+		if err != nil {
+			return nil, err
+		}
+
+		var filter struct {
+			Prefix string `json:"prefix"`
+		}
+
+		if err := r.Args.One().Unmarshal(&filter); err != nil {
+			return nil, err
+		}
+
+		var items []string
+		for i := 0; i < 5; i++ {
+			items = append(items, fmt.Sprintf("%s%d", filter.Prefix, i))
+		}
+
+		return PaginateSlice(items, args)
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var got []string
+
+	it := c.Pages("list", map[string]string{"prefix": "file"}, 2)
+	for it.Next() {
+		var items []string
+		if err := it.Items(&items); err != nil {
+			t.Fatalf("Items()=%s", err)
+		}
+
+		got = append(got, items...)
+	}
+
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err()=%s", err)
+	}
+
+	want := []string{"file0", "file1", "file2", "file3", "file4"}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,298 @@
+package kite
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/protocol"
+)
+
+// Balance tells how a ClientPool distributes the calls between its members.
+type Balance int
+
+const (
+	// RoundRobin sends the calls to the members in turn.
+	RoundRobin Balance = iota
+
+	// LeastLoaded sends the calls to the member with the fewest calls
+	// in flight, the ties are broken in turn.
+	LeastLoaded
+
+	// LowestLatency sends the calls to the member with the lowest latency,
+	// see Client.Latency. The members with unknown latency are picked last,
+	// the ties are broken in turn. The latency is measured only with
+	// Config.LatencyInterval set or with the pings of the members.
+	LowestLatency
+)
+
+// ClientPool holds connections to multiple instances of the same kite and
+// distributes the calls between them:
+//
+//     pool, err := k.DialPool(&protocol.KontrolQuery{
+//         Username:    "koding",
+//         Environment: "production",
+//         Name:        "math",
+//     }, kite.LeastLoaded)
+//     if err != nil {
+//         return err
+//     }
+//     defer pool.Close()
+//
+//     result, err := pool.Tell("square", 4)
+//
+// The members that disconnect are skipped until they reconnect, the ones
+// which do not reconnect are removed from the pool and closed.
+type ClientPool struct {
+	// Balance tells how the calls are distributed, it should be set before
+	// the pool is used.
+	Balance Balance
+
+	mu      sync.Mutex
+	members []*poolMember
+	next    int
+}
+
+type poolMember struct {
+	client   *Client
+	inflight int32
+	down     bool // disconnected, waiting for the client to reconnect
+}
+
+// NewClientPool returns a pool of the given clients, which must be dialed.
+func NewClientPool(clients []*Client, balance Balance) *ClientPool {
+	p := &ClientPool{
+		Balance: balance,
+	}
+
+	for _, c := range clients {
+		p.Add(c)
+	}
+
+	return p
+}
+
+// DialPool queries Kontrol for the kites matching the query and returns
+// a pool of the ones it was able to dial. The clients are authenticated
+// with tokens, which are renewed when they expire.
+func (k *Kite) DialPool(query *protocol.KontrolQuery, balance Balance) (*ClientPool, error) {
+	clients, err := k.GetKites(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		dialed  []*Client
+		dialErr = &DialError{Errs: make(map[string]error)}
+	)
+
+	for _, c := range clients {
+		wg.Add(1)
+
+		go func(c *Client) {
+			defer wg.Done()
+
+			err := c.DialTimeout(k.Config.Timeout)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				k.Log.Debug("DialPool: dialing %s failed: %s", c.URL, err)
+				dialErr.Errs[c.URL] = err
+				c.Close()
+				return
+			}
+
+			dialed = append(dialed, c)
+		}(c)
+	}
+
+	wg.Wait()
+
+	if len(dialed) == 0 {
+		if len(dialErr.Errs) == 0 {
+			return nil, ErrNoKitesAvailable
+		}
+
+		return nil, dialErr
+	}
+
+	return NewClientPool(dialed, balance), nil
+}
+
+// Add adds the dialed client to the pool.
+func (p *ClientPool) Add(c *Client) {
+	p.mu.Lock()
+	p.members = append(p.members, &poolMember{client: c})
+	p.mu.Unlock()
+
+	c.OnConnect(func() { p.setDown(c, false) })
+	c.OnDisconnect(func() { p.setDown(c, true) })
+}
+
+// Remove removes the client from the pool, without closing it.
+func (p *ClientPool) Remove(c *Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.remove(c)
+}
+
+func (p *ClientPool) remove(c *Client) bool {
+	for i, m := range p.members {
+		if m.client == c {
+			p.members = append(p.members[:i], p.members[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// setDown marks the member of the client as disconnected or connected. The
+// members disconnected for good are removed.
+func (p *ClientPool) setDown(c *Client, down bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, m := range p.members {
+		if m.client != c {
+			continue
+		}
+
+		if down && !c.reconnect() {
+			p.remove(c)
+
+			// The disconnect handlers are called with the client locked.
+			go c.Close()
+
+			return
+		}
+
+		m.down = down
+		return
+	}
+}
+
+// Clients returns the clients of the pool.
+func (p *ClientPool) Clients() []*Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	clients := make([]*Client, len(p.members))
+	for i, m := range p.members {
+		clients[i] = m.client
+	}
+
+	return clients
+}
+
+// Len returns the number of the connected members of the pool.
+func (p *ClientPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, m := range p.members {
+		if !m.down {
+			n++
+		}
+	}
+
+	return n
+}
+
+// pick returns the member the next call is sent to.
+func (p *ClientPool) pick() (*poolMember, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var picked *poolMember
+
+	for i := range p.members {
+		m := p.members[(p.next+i)%len(p.members)]
+		if m.down {
+			continue
+		}
+
+		switch {
+		case picked == nil:
+			picked = m
+		case p.Balance == LeastLoaded:
+			if atomic.LoadInt32(&m.inflight) < atomic.LoadInt32(&picked.inflight) {
+				picked = m
+			}
+		case p.Balance == LowestLatency:
+			if lowerLatency(m.client.Latency(), picked.client.Latency()) {
+				picked = m
+			}
+		}
+
+		if p.Balance == RoundRobin {
+			break
+		}
+	}
+
+	if picked == nil {
+		return nil, ErrNoKitesAvailable
+	}
+
+	p.next++
+
+	return picked, nil
+}
+
+// lowerLatency tells whether the latency a is lower than b, the unknown
+// latency is higher than any known one.
+func lowerLatency(a, b time.Duration) bool {
+	return a != 0 && (b == 0 || a < b)
+}
+
+// Tell calls the method of one of the members of the pool, see Client.Tell.
+// It fails with ErrNoKitesAvailable if none of them is connected.
+func (p *ClientPool) Tell(method string, args ...interface{}) (*dnode.Partial, error) {
+	return p.TellWithContext(context.Background(), method, args...)
+}
+
+// TellWithTimeout does the same thing as Tell, but with the given timeout.
+func (p *ClientPool) TellWithTimeout(method string, timeout time.Duration, args ...interface{}) (*dnode.Partial, error) {
+	m, err := p.pick()
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt32(&m.inflight, 1)
+	defer atomic.AddInt32(&m.inflight, -1)
+
+	return m.client.TellWithTimeout(method, timeout, args...)
+}
+
+// TellWithContext does the same thing as Tell, but with the given context.
+func (p *ClientPool) TellWithContext(ctx context.Context, method string, args ...interface{}) (*dnode.Partial, error) {
+	m, err := p.pick()
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt32(&m.inflight, 1)
+	defer atomic.AddInt32(&m.inflight, -1)
+
+	return m.client.TellWithContext(ctx, method, args...)
+}
+
+// Close closes all the clients of the pool.
+func (p *ClientPool) Close() {
+	p.mu.Lock()
+	members := p.members
+	p.members = nil
+	p.mu.Unlock()
+
+	for _, m := range members {
+		m.client.Close()
+	}
+}
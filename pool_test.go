@@ -0,0 +1,103 @@
+package kite
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientPool_Balance(t *testing.T) {
+	clients := []*Client{{URL: "a"}, {URL: "b"}, {URL: "c"}}
+
+	p := NewClientPool(clients, RoundRobin)
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		m, err := p.pick()
+		if err != nil {
+			t.Fatalf("pick()=%s", err)
+		}
+
+		got = append(got, m.client.URL)
+	}
+
+	if got, want := strings.Join(got, ""), "abcabc"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	p.Balance = LeastLoaded
+	p.members[0].inflight = 2
+	p.members[1].inflight = 1
+	p.members[2].inflight = 3
+
+	if m, _ := p.pick(); m.client.URL != "b" {
+		t.Fatalf("got %s, want b", m.client.URL)
+	}
+
+	p.Balance = LowestLatency
+	clients[0].latency = int64(20 * time.Millisecond)
+	clients[2].latency = int64(10 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if m, _ := p.pick(); m.client.URL != "c" {
+			t.Fatalf("got %s, want c", m.client.URL)
+		}
+	}
+}
+
+func TestClient_Latency(t *testing.T) {
+	var c Client
+
+	c.addLatency(80 * time.Millisecond)
+
+	if got := c.Latency(); got != 80*time.Millisecond {
+		t.Fatalf("got %s, want 80ms", got)
+	}
+
+	c.addLatency(160 * time.Millisecond)
+
+	if got := c.Latency(); got != 90*time.Millisecond {
+		t.Fatalf("got %s, want 90ms", got)
+	}
+}
+
+func TestClientPool_Disconnect(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	a, b := k.NewClient("a"), k.NewClient("b")
+	a.Reconnect = true
+
+	p := NewClientPool([]*Client{a, b}, RoundRobin)
+
+	a.callOnDisconnectHandlers()
+
+	if n := p.Len(); n != 1 {
+		t.Fatalf("got %d connected members, want 1", n)
+	}
+
+	for i := 0; i < 3; i++ {
+		if m, _ := p.pick(); m.client != b {
+			t.Fatalf("got %s, want b", m.client.URL)
+		}
+	}
+
+	a.callOnConnectHandlers()
+
+	if n := p.Len(); n != 2 {
+		t.Fatalf("got %d connected members, want 2", n)
+	}
+
+	p.Remove(a)
+
+	// b does not reconnect, so it is removed for good.
+	p.setDown(b, true)
+
+	if n := len(p.Clients()); n != 0 {
+		t.Fatalf("got %d members, want 0", n)
+	}
+
+	if _, err := p.Tell("square", 2); err != ErrNoKitesAvailable {
+		t.Fatalf("got %v, want %v", err, ErrNoKitesAvailable)
+	}
+}
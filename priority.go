@@ -0,0 +1,192 @@
+package kite
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Priority is a hint of how urgent a call is. Under load the kite serves
+// the calls with higher priority first, see Config.MaxConcurrentRequests,
+// and keeps part of the rate limits of the methods for them.
+type Priority int
+
+const (
+	// PriorityBatch is for background work, which can wait.
+	PriorityBatch Priority = -1
+
+	// PriorityNormal is the priority of the calls without a hint.
+	PriorityNormal Priority = 0
+
+	// PriorityInteractive is for calls a user waits for.
+	PriorityInteractive Priority = 1
+)
+
+// batchReserve is the fraction of the rate limit of a method, which is
+// reserved for the calls of normal and interactive priority.
+const batchReserve = 4 // 1/4
+
+type priorityKey struct{}
+
+type costKey struct{}
+
+// WithPriority returns a copy of ctx that sends the given priority hint
+// with the calls made with Client.TellWithContext.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// WithCost returns a copy of ctx that sends the given cost hint with
+// the calls made with Client.TellWithContext. The cost tells how many
+// regular calls the call is worth, e.g. a call processing a batch of 10
+// items may have a cost of 10. It is taken from the rate limits and
+// quotas instead of a single request.
+func WithCost(ctx context.Context, cost int) context.Context {
+	return context.WithValue(ctx, costKey{}, cost)
+}
+
+func priorityFromContext(ctx context.Context) Priority {
+	if ctx == nil {
+		return PriorityNormal
+	}
+
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
+
+func costFromContext(ctx context.Context) int {
+	if ctx == nil {
+		return 0
+	}
+
+	cost, _ := ctx.Value(costKey{}).(int)
+	return cost
+}
+
+// admission limits the number of calls handled at once, making the calls
+// over the limit wait in a queue ordered by priority.
+type admission struct {
+	mu      sync.Mutex
+	running int
+	queue   []*admissionWaiter // by priority, then by arrival
+}
+
+type admissionWaiter struct {
+	priority Priority
+	ready    chan struct{} // closed when admitted or rejected
+	rejected bool
+}
+
+// admit waits until the request can be handled. The returned func must be
+// called once the request is handled. Requests of the built-in methods are
+// admitted right away.
+func (k *Kite) admit(r *Request) (func(), *Error) {
+	max := k.Config.MaxConcurrentRequests
+	if max <= 0 || strings.HasPrefix(r.Method, "kite.") {
+		return func() {}, nil
+	}
+
+	a := &k.admission
+
+	a.mu.Lock()
+
+	if a.running < max && len(a.queue) == 0 {
+		a.running++
+		a.mu.Unlock()
+
+		return a.release, nil
+	}
+
+	if maxQueued := k.Config.MaxQueuedRequests; maxQueued > 0 && len(a.queue) >= maxQueued {
+		// The queue is full, the request is queued only if it is more
+		// urgent than the least urgent one waiting, which is dropped.
+		last := a.queue[len(a.queue)-1]
+
+		if last.priority >= r.Priority {
+			a.mu.Unlock()
+			return nil, overloadedError(r)
+		}
+
+		last.rejected = true
+		close(last.ready)
+		a.queue = a.queue[:len(a.queue)-1]
+	}
+
+	w := &admissionWaiter{
+		priority: r.Priority,
+		ready:    make(chan struct{}),
+	}
+
+	i := len(a.queue)
+	for i > 0 && a.queue[i-1].priority < w.priority {
+		i--
+	}
+
+	a.queue = append(a.queue, nil)
+	copy(a.queue[i+1:], a.queue[i:])
+	a.queue[i] = w
+
+	a.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		if w.rejected {
+			return nil, overloadedError(r)
+		}
+
+		return a.release, nil
+	case <-r.Context.Done():
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		for i, queued := range a.queue {
+			if queued == w {
+				a.queue = append(a.queue[:i], a.queue[i+1:]...)
+				return nil, createError(r, r.Context.Err())
+			}
+		}
+
+		// Admitted in the meantime, pass the slot on.
+		if !w.rejected {
+			a.releaseLocked()
+		}
+
+		return nil, createError(r, r.Context.Err())
+	}
+}
+
+// release passes the slot of a handled request to the first request in
+// the queue.
+func (a *admission) release() {
+	a.mu.Lock()
+	a.releaseLocked()
+	a.mu.Unlock()
+}
+
+func (a *admission) releaseLocked() {
+	if len(a.queue) == 0 {
+		a.running--
+		return
+	}
+
+	w := a.queue[0]
+	a.queue = a.queue[1:]
+	close(w.ready)
+}
+
+// cost returns the cost of the request, which is at least 1.
+func (r *Request) cost() int64 {
+	if r.Cost < 1 {
+		return 1
+	}
+
+	return int64(r.Cost)
+}
+
+func overloadedError(r *Request) *Error {
+	return &Error{
+		Type:      "overloadedError",
+		Message:   "Kite is overloaded, try again later",
+		RequestID: r.ID,
+	}
+}
@@ -0,0 +1,164 @@
+package kite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+func TestKite_Admit(t *testing.T) {
+	k := New("admission", "0.0.1")
+	defer k.Close()
+
+	k.Config.MaxConcurrentRequests = 1
+	k.Config.MaxQueuedRequests = 2
+
+	request := func(p Priority) *Request {
+		return &Request{Method: "work", Priority: p, Context: context.Background()}
+	}
+
+	queued := func(n int) {
+		for i := 0; i < 100; i++ {
+			k.admission.mu.Lock()
+			l := len(k.admission.queue)
+			k.admission.mu.Unlock()
+
+			if l == n {
+				return
+			}
+
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		t.Fatalf("timed out waiting for %d queued requests", n)
+	}
+
+	release, err := k.admit(request(PriorityNormal))
+	if err != nil {
+		t.Fatalf("admit()=%s", err)
+	}
+
+	// Built-in methods are never queued.
+	if _, err := k.admit(&Request{Method: "kite.ping", Context: context.Background()}); err != nil {
+		t.Fatalf("admit()=%s", err)
+	}
+
+	admitted := make(chan Priority, 3)
+	rejected := make(chan Priority, 3)
+
+	wait := func(p Priority) {
+		release, err := k.admit(request(p))
+		if err != nil {
+			rejected <- p
+			return
+		}
+
+		admitted <- p
+		release()
+	}
+
+	go wait(PriorityBatch)
+	queued(1)
+
+	go wait(PriorityNormal)
+	queued(2)
+
+	// The queue is full, the batch request gives way.
+	go wait(PriorityInteractive)
+
+	select {
+	case p := <-rejected:
+		if p != PriorityBatch {
+			t.Fatalf("got %d rejected, want batch", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the batch request to be rejected")
+	}
+
+	// A batch request does not fit into the full queue.
+	if _, err := k.admit(request(PriorityBatch)); err == nil || err.Type != "overloadedError" {
+		t.Fatalf("got %v, want overloadedError", err)
+	}
+
+	release()
+
+	for _, want := range []Priority{PriorityInteractive, PriorityNormal} {
+		select {
+		case p := <-admitted:
+			if p != want {
+				t.Fatalf("got %d admitted, want %d", p, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %d to be admitted", want)
+		}
+	}
+
+	// Canceled requests leave the queue.
+	release, _ = k.admit(request(PriorityNormal))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := request(PriorityNormal)
+	r.Context = ctx
+
+	done := make(chan *Error, 1)
+	go func() {
+		_, err := k.admit(r)
+		done <- err
+	}()
+
+	queued(1)
+	cancel()
+
+	if err := <-done; err == nil {
+		t.Fatal("want error for canceled request")
+	}
+
+	queued(0)
+	release()
+
+	if k.admission.running != 0 {
+		t.Fatalf("got %d running, want 0", k.admission.running)
+	}
+}
+
+func TestMethod_TakeTokens(t *testing.T) {
+	k := New("ratelimit", "0.0.1")
+	defer k.Close()
+
+	m := k.HandleFunc("work", func(*Request) (interface{}, error) { return nil, nil }).Throttle(time.Hour, 8)
+
+	if !m.takeTokens(&Request{Cost: 5}) {
+		t.Fatal("want the request to take 5 tokens")
+	}
+
+	// 3 tokens are left, 2 of them are reserved for non-batch requests.
+	if m.takeTokens(&Request{Cost: 2, Priority: PriorityBatch}) {
+		t.Fatal("want batch request to be limited")
+	}
+
+	if !m.takeTokens(&Request{Cost: 2, Priority: PriorityInteractive}) {
+		t.Fatal("want interactive request to take the reserved tokens")
+	}
+
+	if m.takeTokens(&Request{Cost: 2}) {
+		t.Fatal("want request to be limited")
+	}
+}
+
+func TestClient_PriorityHints(t *testing.T) {
+	k := New("hints", "0.0.1")
+	defer k.Close()
+
+	c := k.NewClient("")
+
+	ctx := WithCost(WithPriority(context.Background(), PriorityBatch), 10)
+
+	args := c.wrapMethodArgs(ctx, nil, dnode.Function{}, "")
+
+	options := args[0].(callOptionsOut)
+	if options.Priority != PriorityBatch || options.Cost != 10 {
+		t.Fatalf("got priority %d and cost %d, want %d and 10", options.Priority, options.Cost, PriorityBatch)
+	}
+}
@@ -4,9 +4,14 @@
 package protocol
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/koding/kite/dnode"
 )
@@ -117,6 +122,19 @@ type RegisterArgs struct {
 	URL  string `json:"url"`
 	Kite *Kite  `json:"kite,omitempty"`
 	Auth *Auth  `json:"auth,omitempty"`
+
+	// Color is the deployment color of the kite, like "blue" or "green".
+	// Kontrol hides kites with a color other than the active color
+	// of their service from the getKites results.
+	Color string `json:"color,omitempty"`
+}
+
+// UnregisterArgs is used as the function argument to the Kontrol's
+// unregister method.
+type UnregisterArgs struct {
+	// Kite is another version of the calling kite, served by the same
+	// process, to unregister instead of the calling kite itself.
+	Kite *Kite `json:"kite,omitempty"`
 }
 
 type Auth struct {
@@ -141,12 +159,29 @@ type RegisterResult struct {
 	// In such case Kontrol is going to create new kite key by signing
 	// it with new keys.
 	KiteKey string `json:"kiteKey,omitempty"`
+
+	// Time is the time of Kontrol's clock in Unix nanoseconds, kites use
+	// it for detecting clock skew.
+	Time int64 `json:"time,omitempty"`
 }
 
+// KontrolTimeHeader is the header of HTTP heartbeat responses with the time
+// of Kontrol's clock in Unix nanoseconds.
+const KontrolTimeHeader = "X-Kontrol-Time"
+
 type GetKitesArgs struct {
 	Query         *KontrolQuery   `json:"query"`
 	WatchCallback dnode.Function  `json:"watchCallback"`
 	Who           json.RawMessage `json:"who"`
+
+	// Compress allows Kontrol to send large results compressed,
+	// see GetKitesResult.Compressed.
+	Compress bool `json:"compress,omitempty"`
+
+	// Nonce is a random string Kontrol puts in the signature of the result,
+	// so the result can not be replayed as the result of other queries,
+	// see GetKitesResult.Signature.
+	Nonce string `json:"nonce,omitempty"`
 }
 
 // GetTokenArgs is a request value for the "getToken" kontrol method.
@@ -156,21 +191,246 @@ type GetTokenArgs struct {
 	Force bool `json:"force"` // force creation of a new token
 }
 
+// DelegateTokenArgs is a request value for the "getDelegateToken" kontrol
+// method.
+type DelegateTokenArgs struct {
+	KontrolQuery // kite to generate a token for
+
+	// Token is the token of the user, which was used to call the kite
+	// requesting the delegate token.
+	Token string `json:"token"`
+}
+
+// EphemeralKeyArgs is a request value for the "getEphemeralKey" kontrol
+// method.
+type EphemeralKeyArgs struct {
+	// TTL is the requested lifetime of the kite key. Kontrol caps it with
+	// its own maximum.
+	TTL time.Duration `json:"ttl"`
+}
+
+// EphemeralKeyResult is a response value of the "getEphemeralKey" kontrol
+// method.
+type EphemeralKeyResult struct {
+	KiteKey   string    `json:"kiteKey"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// BroadcastArgs is a request value for the "broadcast" kontrol method.
+type BroadcastArgs struct {
+	Query  *KontrolQuery   `json:"query"`          // kites to deliver the message to
+	Method string          `json:"method"`         // method to call on the kites
+	Args   json.RawMessage `json:"args,omitempty"` // argument of the method
+
+	// Timeout is the timeout of a single delivery attempt.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// Retries is the number of times the delivery to an unreachable kite
+	// is retried, waiting RetryInterval between the attempts.
+	Retries       int           `json:"retries,omitempty"`
+	RetryInterval time.Duration `json:"retryInterval,omitempty"`
+}
+
+// BroadcastReceipt describes the delivery of a broadcast message
+// to a single kite.
+type BroadcastReceipt struct {
+	Kite      Kite   `json:"kite"`
+	Delivered bool   `json:"delivered"`
+	Attempts  int    `json:"attempts"`
+	Error     string `json:"error,omitempty"` // error of the last attempt
+}
+
+// BroadcastResult is a response value of the "broadcast" kontrol method.
+type BroadcastResult struct {
+	Receipts []*BroadcastReceipt `json:"receipts"`
+}
+
 type WhoResult struct {
 	Query *KontrolQuery `json:"query"`
 }
 
 type GetKitesResult struct {
 	Kites []*KiteWithToken `json:"kites"`
+
+	// Compressed is the gzip-compressed JSON encoding of Kites. It is sent
+	// instead of Kites when the caller allowed compression, and the result
+	// is large enough for it to pay off. Use Decompress to decode it.
+	Compressed []byte `json:"compressed,omitempty"`
+
+	// Signature is a JWT with ResultClaims, signed by Kontrol with the key
+	// pair of the kite key of the caller. It lets the kites detect results
+	// tampered with on the way, e.g. by a proxy.
+	Signature string `json:"signature,omitempty"`
+}
+
+// ResultClaims are the claims of GetKitesResult.Signature.
+type ResultClaims struct {
+	Nonce  string `json:"nonce"`  // nonce of the query, see GetKitesArgs
+	Digest string `json:"digest"` // digest of the kites, see Digest
+}
+
+// Valid implements the jwt.Claims interface. The claims do not expire, as
+// the nonce binds them to a single query.
+func (*ResultClaims) Valid() error {
+	return nil
+}
+
+// Digest returns the hex-encoded SHA-256 checksum of the JSON encoding of
+// Kites, which is signed by Kontrol.
+func (r *GetKitesResult) Digest() (string, error) {
+	p, err := json.Marshal(r.Kites)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(p)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Compress replaces Kites with their compressed encoding, if the encoding
+// is at least minSize bytes long.
+func (r *GetKitesResult) Compress(minSize int) error {
+	p, err := json.Marshal(r.Kites)
+	if err != nil {
+		return err
+	}
+
+	if len(p) < minSize {
+		return nil
+	}
+
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+
+	if _, err := w.Write(p); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	r.Kites = nil
+	r.Compressed = buf.Bytes()
+
+	return nil
+}
+
+// Decompress decodes the compressed kites into Kites. It is a nop if
+// the kites were not sent compressed.
+func (r *GetKitesResult) Decompress() error {
+	if len(r.Compressed) == 0 {
+		return nil
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(r.Compressed))
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	var kites []*KiteWithToken
+	if err := json.NewDecoder(gr).Decode(&kites); err != nil {
+		return err
+	}
+
+	r.Kites = kites
+	r.Compressed = nil
+
+	return nil
 }
 
 type KiteWithToken struct {
 	Kite  Kite   `json:"kite"`
 	URL   string `json:"url"`
 	KeyID string `json:"keyId,omitempty"`
+	Color string `json:"color,omitempty"`
 	Token string `json:"token"`
 }
 
+// ActiveColorArgs is a request value for the "getActiveColor" and
+// "setActiveColor" kontrol methods.
+type ActiveColorArgs struct {
+	// Service identifies the service by its username, environment and
+	// name fields, the remaining fields are ignored.
+	Service KontrolQuery `json:"service"`
+
+	// Color is the new active color, only used by "setActiveColor".
+	// An empty value clears the active color, so all kites of the
+	// service are returned again.
+	Color string `json:"color"`
+
+	// PrevColor, when non-empty, makes "setActiveColor" fail unless
+	// it is the currently active color of the service.
+	PrevColor string `json:"prevColor,omitempty"`
+}
+
+// ActiveColorResult is a response value for the "getActiveColor" and
+// "setActiveColor" kontrol methods.
+type ActiveColorResult struct {
+	Color     string `json:"color"`
+	PrevColor string `json:"prevColor,omitempty"`
+}
+
+// RevokedToken identifies a revoked token by its ID, the "jti" claim.
+type RevokedToken struct {
+	ID string `json:"id"`
+
+	// ExpiresAt is the expiration time of the token in Unix seconds, after
+	// which the revocation does not need to be kept anymore. Zero means
+	// the expiration time is unknown.
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+}
+
+// RevokeTokensArgs is a request value for the "revokeTokens" kontrol method
+// and the "kite.admin.revokeTokens" kite method.
+type RevokeTokensArgs struct {
+	Tokens []RevokedToken `json:"tokens"`
+}
+
+// RevokedTokensResult is a response value for the "getRevokedTokens" kontrol
+// method.
+type RevokedTokensResult struct {
+	Tokens []RevokedToken `json:"tokens"`
+}
+
+// ProxySession is a registration of a kite at a proxy kite, it is handed
+// off to another proxy instance with the "handoff" proxy method.
+type ProxySession struct {
+	// Kite is the registered kite.
+	Kite Kite `json:"kite"`
+
+	// URL is the URL of the kite the requests are proxied to.
+	URL string `json:"url"`
+
+	// Username is the authenticated username of the kite, only the kite
+	// of the same user can take the session over at the new proxy.
+	Username string `json:"username"`
+}
+
+// ProxyHandoffArgs is a request value for the "handoff" proxy method.
+type ProxyHandoffArgs struct {
+	Sessions []ProxySession `json:"sessions"`
+}
+
+// ProxyHandoffResult is a response value for the "handoff" proxy method.
+type ProxyHandoffResult struct {
+	// URLs are the proxy URLs of the kites at the new proxy, by kite ID.
+	URLs map[string]string `json:"urls"`
+}
+
+// ProxyHandoff is a request value for the "kite.proxyHandoff" kite method,
+// the proxy kite calls it to move the registered kites to another proxy.
+type ProxyHandoff struct {
+	// ProxyURL is the URL of the proxy kite to connect to.
+	ProxyURL string `json:"proxyURL"`
+
+	// URL is the proxy URL of the kite at the new proxy.
+	URL string `json:"url"`
+}
+
 // KiteEvent is the struct that is sent as an argument in watchCallback of
 // getKites method of Kontrol.
 type KiteEvent struct {
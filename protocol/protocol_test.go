@@ -61,3 +61,44 @@ func TestKiteQuery(t *testing.T) {
 	expect(q.Version, "version")
 	expect(q.Hostname, "hostname")
 }
+
+func TestGetKitesResultCompress(t *testing.T) {
+	var kites []*KiteWithToken
+	for i := 0; i < 100; i++ {
+		kites = append(kites, &KiteWithToken{
+			Kite:  k,
+			URL:   "http://localhost:4000/kite",
+			Token: "token",
+		})
+	}
+
+	r := &GetKitesResult{Kites: kites}
+
+	if err := r.Compress(1 << 20); err != nil {
+		t.Fatalf("Compress()=%s", err)
+	}
+
+	if r.Compressed != nil || len(r.Kites) != 100 {
+		t.Fatal("want small result not to be compressed")
+	}
+
+	if err := r.Compress(0); err != nil {
+		t.Fatalf("Compress()=%s", err)
+	}
+
+	if r.Compressed == nil || r.Kites != nil {
+		t.Fatal("want result to be compressed")
+	}
+
+	if err := r.Decompress(); err != nil {
+		t.Fatalf("Decompress()=%s", err)
+	}
+
+	if len(r.Kites) != 100 {
+		t.Fatalf("want 100 kites, got %d", len(r.Kites))
+	}
+
+	if r.Kites[99].Kite != k || r.Kites[99].Token != "token" {
+		t.Fatalf("got %+v", r.Kites[99])
+	}
+}
@@ -0,0 +1,60 @@
+package kite
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/koding/kite/protocol"
+)
+
+// proxyRegistration is the proxy kite the kite is registered to with
+// RegisterToProxy.
+type proxyRegistration struct {
+	mu      sync.Mutex
+	client  *Client
+	handoff chan protocol.ProxyHandoff
+}
+
+func (p *proxyRegistration) set(client *Client, handoff chan protocol.ProxyHandoff) {
+	p.mu.Lock()
+	p.client, p.handoff = client, handoff
+	p.mu.Unlock()
+}
+
+// handleProxyHandoff is called by the proxy kite the kite is registered to,
+// when the proxy is shutting down. The registration was already handed off
+// to the given proxy, so the kite connects to it right away, instead of
+// asking Kontrol for a proxy and registering from scratch.
+func (k *Kite) handleProxyHandoff(r *Request) (interface{}, error) {
+	k.proxy.mu.Lock()
+	client, handoff := k.proxy.client, k.proxy.handoff
+	k.proxy.mu.Unlock()
+
+	if client == nil || r.Client != client {
+		return nil, errors.New("not registered to the proxy kite")
+	}
+
+	if r.Args == nil {
+		return nil, errors.New("empty arguments")
+	}
+
+	var args protocol.ProxyHandoff
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if args.ProxyURL == "" {
+		return nil, errors.New("empty proxy URL")
+	}
+
+	select {
+	case handoff <- args:
+	default:
+		return nil, errors.New("handoff is already in progress")
+	}
+
+	k.Log.Info("Proxy kite hands off the registration to %s", args.ProxyURL)
+
+	return nil, nil
+}
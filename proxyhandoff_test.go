@@ -0,0 +1,43 @@
+package kite
+
+import (
+	"testing"
+
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/protocol"
+)
+
+func TestKite_HandleProxyHandoff(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	proxy := k.NewClient("http://127.0.0.1:4999/kite")
+	other := k.NewClient("http://127.0.0.1:5999/kite")
+
+	request := func(c *Client) *Request {
+		return &Request{
+			Client:    c,
+			LocalKite: k,
+			Args:      &dnode.Partial{Raw: []byte(`[{"proxyURL":"http://127.0.0.1:5999/kite","url":"http://proxy/kite1"}]`)},
+		}
+	}
+
+	if _, err := k.handleProxyHandoff(request(proxy)); err == nil {
+		t.Fatal("expected handoff to be rejected when not registered")
+	}
+
+	handoff := make(chan protocol.ProxyHandoff, 1)
+	k.proxy.set(proxy, handoff)
+
+	if _, err := k.handleProxyHandoff(request(other)); err == nil {
+		t.Fatal("expected handoff of other kite to be rejected")
+	}
+
+	if _, err := k.handleProxyHandoff(request(proxy)); err != nil {
+		t.Fatalf("handleProxyHandoff()=%s", err)
+	}
+
+	if h := <-handoff; h.ProxyURL != "http://127.0.0.1:5999/kite" || h.URL != "http://proxy/kite1" {
+		t.Fatalf("unexpected handoff: %+v", h)
+	}
+}
@@ -0,0 +1,233 @@
+package kite
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/koding/kite/dnode"
+)
+
+// Event is an event published to a topic with Kite.Publish.
+type Event struct {
+	Topic   string
+	Payload *dnode.Partial
+}
+
+// TopicArgs are the arguments of the kite.subscribe and kite.unsubscribe
+// methods.
+type TopicArgs struct {
+	// Topic is the topic to subscribe to. A topic ending with "*" matches
+	// all the topics with the same prefix, e.g. "build.*" matches both
+	// "build.started" and "build.finished".
+	Topic string `json:"topic,omitempty"`
+
+	// OnEvent is called with the topic and the payload of every event
+	// published to the topic.
+	OnEvent dnode.Function `json:"onEvent"`
+
+	// ID is the ID of the subscription to cancel with kite.unsubscribe.
+	ID uint64 `json:"id,omitempty"`
+}
+
+// topics routes the published events to the subscribed clients.
+type topics struct {
+	mu   sync.RWMutex
+	subs map[uint64]*topicSub
+	next uint64
+}
+
+type topicSub struct {
+	id      uint64
+	topic   string
+	client  *Client
+	onEvent dnode.Function
+}
+
+func (s *topicSub) matches(topic string) bool {
+	if strings.HasSuffix(s.topic, "*") {
+		return strings.HasPrefix(topic, s.topic[:len(s.topic)-1])
+	}
+
+	return s.topic == topic
+}
+
+// Publish sends the event to the remote kites subscribed to the topic over
+// the connections made to this kite, see Client.SubscribeTopic. It returns
+// the number of subscriptions the event was sent to.
+func (k *Kite) Publish(topic string, payload interface{}) int {
+	k.topics.mu.RLock()
+	var subs []*topicSub
+	for _, s := range k.topics.subs {
+		if s.matches(topic) {
+			subs = append(subs, s)
+		}
+	}
+	k.topics.mu.RUnlock()
+
+	sent := 0
+
+	for _, s := range subs {
+		if err := s.onEvent.Call(topic, payload); err != nil {
+			k.Log.Debug("Publishing %q to %s failed: %s", topic, s.client.Kite, err)
+			k.removeTopicSub(s.id)
+			continue
+		}
+
+		sent++
+	}
+
+	return sent
+}
+
+// Subscribers returns the number of subscriptions to the topic.
+func (k *Kite) Subscribers(topic string) int {
+	k.topics.mu.RLock()
+	defer k.topics.mu.RUnlock()
+
+	n := 0
+	for _, s := range k.topics.subs {
+		if s.matches(topic) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (k *Kite) handleSubscribe(r *Request) (interface{}, error) {
+	var args TopicArgs
+
+	if r.Args == nil {
+		return nil, errors.New("empty arguments")
+	}
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if args.Topic == "" {
+		return nil, errors.New("empty topic")
+	}
+
+	if !args.OnEvent.IsValid() {
+		return nil, errors.New("invalid onEvent callback")
+	}
+
+	k.topics.mu.Lock()
+	defer k.topics.mu.Unlock()
+
+	if k.topics.subs == nil {
+		k.topics.subs = make(map[uint64]*topicSub)
+	}
+
+	k.topics.next++
+
+	s := &topicSub{
+		id:      k.topics.next,
+		topic:   args.Topic,
+		client:  r.Client,
+		onEvent: args.OnEvent,
+	}
+
+	k.topics.subs[s.id] = s
+
+	return s.id, nil
+}
+
+func (k *Kite) handleUnsubscribe(r *Request) (interface{}, error) {
+	var args TopicArgs
+
+	if r.Args == nil {
+		return nil, errors.New("empty arguments")
+	}
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	k.topics.mu.Lock()
+	defer k.topics.mu.Unlock()
+
+	// Only the subscriptions made over the same connection can be canceled.
+	if s, ok := k.topics.subs[args.ID]; ok && s.client == r.Client {
+		delete(k.topics.subs, args.ID)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (k *Kite) removeTopicSub(id uint64) {
+	k.topics.mu.Lock()
+	defer k.topics.mu.Unlock()
+
+	delete(k.topics.subs, id)
+}
+
+// unsubscribeClient removes the subscriptions of the disconnected client.
+func (k *Kite) unsubscribeClient(c *Client) {
+	k.topics.mu.Lock()
+	defer k.topics.mu.Unlock()
+
+	for id, s := range k.topics.subs {
+		if s.client == c {
+			delete(k.topics.subs, id)
+		}
+	}
+}
+
+// TopicSubscription is a subscription to a topic made with
+// Client.SubscribeTopic.
+type TopicSubscription struct {
+	Topic string
+
+	sub *Subscription
+}
+
+// SubscribeTopic subscribes to the events published by the remote kite to
+// the topic with Kite.Publish, the handler is called with every event.
+// The subscription is made again when the client reconnects, see Subscribe.
+func (c *Client) SubscribeTopic(topic string, handler func(*Event)) (*TopicSubscription, error) {
+	onEvent := dnode.Callback(func(args *dnode.Partial) {
+		var a []*dnode.Partial
+
+		if err := args.Unmarshal(&a); err != nil || len(a) != 2 {
+			c.LocalKite.Log.Warning("Invalid event of %q topic: %v", topic, args)
+			return
+		}
+
+		e := &Event{Payload: a[1]}
+
+		if err := a[0].Unmarshal(&e.Topic); err != nil {
+			c.LocalKite.Log.Warning("Invalid event of %q topic: %v", topic, args)
+			return
+		}
+
+		handler(e)
+	})
+
+	s, err := c.Subscribe("kite.subscribe", &TopicArgs{Topic: topic, OnEvent: onEvent})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TopicSubscription{Topic: topic, sub: s}, nil
+}
+
+// Unsubscribe cancels the subscription.
+func (s *TopicSubscription) Unsubscribe() error {
+	s.sub.Cancel()
+
+	var id uint64
+	if res := s.sub.Result(); res != nil {
+		if err := res.Unmarshal(&id); err != nil {
+			return err
+		}
+	}
+
+	c := s.sub.client
+
+	_, err := c.TellWithTimeout("kite.unsubscribe", c.config().Timeout, &TopicArgs{ID: id})
+	return err
+}
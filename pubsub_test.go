@@ -0,0 +1,64 @@
+package kite
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestKite_Publish(t *testing.T) {
+	conf := config.New()
+	conf.DisableAuthentication = true
+
+	k := NewWithConfig("publisher", "0.0.1", conf)
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	events := make(chan *Event, 4)
+
+	s, err := c.SubscribeTopic("build.*", func(e *Event) { events <- e })
+	if err != nil {
+		t.Fatalf("SubscribeTopic()=%s", err)
+	}
+
+	if n := k.Publish("deploy.started", "ignored"); n != 0 {
+		t.Fatalf("got %d subscribers, want 0", n)
+	}
+
+	if n := k.Publish("build.finished", map[string]int{"status": 0}); n != 1 {
+		t.Fatalf("got %d subscribers, want 1", n)
+	}
+
+	select {
+	case e := <-events:
+		var payload struct{ Status int }
+
+		if err := e.Payload.Unmarshal(&payload); err != nil {
+			t.Fatalf("Unmarshal()=%s", err)
+		}
+
+		if e.Topic != "build.finished" {
+			t.Fatalf("got topic %q, want build.finished", e.Topic)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the event")
+	}
+
+	if err := s.Unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribe()=%s", err)
+	}
+
+	if n := k.Subscribers("build.finished"); n != 0 {
+		t.Fatalf("got %d subscribers after unsubscribing, want 0", n)
+	}
+}
@@ -0,0 +1,154 @@
+package kite
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Quota limits the usage of a kite by a single username, across all of the
+// user's connections. Zero value of a limit means no limit.
+type Quota struct {
+	// Requests is the maximum number of requests a user can make
+	// within the Window.
+	Requests int64
+
+	// Bytes is the maximum number of bytes of request arguments a user
+	// can send within the Window. The responses are not counted, so it
+	// does not limit the bandwidth of the methods with large results.
+	Bytes int64
+
+	// Window is the duration after which the usage is reset, it must be
+	// positive.
+	Window time.Duration
+}
+
+// QuotaStore counts the usage of users. It can be implemented with a shared
+// storage, like Redis, to enforce the quotas across multiple kites.
+type QuotaStore interface {
+	// Add adds n to the counter identified by the key and returns the
+	// counter's new value. The counter is reset to zero when the window
+	// passes since the first call after the previous reset.
+	Add(key string, n int64, window time.Duration) (int64, error)
+}
+
+// MemQuotaStore is an in-memory QuotaStore, it is used by default.
+type MemQuotaStore struct {
+	mu       sync.Mutex
+	counters map[string]*quotaCounter
+	swept    time.Time
+}
+
+type quotaCounter struct {
+	n     int64
+	reset time.Time
+}
+
+var _ QuotaStore = (*MemQuotaStore)(nil)
+
+// NewMemQuotaStore returns a new in-memory quota store.
+func NewMemQuotaStore() *MemQuotaStore {
+	return &MemQuotaStore{
+		counters: make(map[string]*quotaCounter),
+	}
+}
+
+func (m *MemQuotaStore) Add(key string, n int64, window time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop expired counters once per window, so the map does not grow
+	// with the number of users that ever connected.
+	if now.Sub(m.swept) >= window {
+		for k, c := range m.counters {
+			if !now.Before(c.reset) {
+				delete(m.counters, k)
+			}
+		}
+
+		m.swept = now
+	}
+
+	c, ok := m.counters[key]
+	if !ok || !now.Before(c.reset) {
+		c = &quotaCounter{reset: now.Add(window)}
+		m.counters[key] = c
+	}
+
+	c.n += n
+
+	return c.n, nil
+}
+
+// SetQuota enables enforcing the given quota for every user of authenticated
+// methods. Requests over the quota are rejected with "quotaExceeded" error.
+// A nil quota disables enforcing.
+func (k *Kite) SetQuota(quota *Quota) error {
+	if quota != nil && quota.Window <= 0 {
+		return fmt.Errorf("kite: invalid quota window %s", quota.Window)
+	}
+
+	k.quotaMu.Lock()
+	k.quota = quota
+	if k.quotaStore == nil {
+		k.quotaStore = NewMemQuotaStore()
+	}
+	k.quotaMu.Unlock()
+
+	return nil
+}
+
+// SetQuotaStore sets the storage of user's usage counters.
+func (k *Kite) SetQuotaStore(store QuotaStore) {
+	k.quotaMu.Lock()
+	k.quotaStore = store
+	k.quotaMu.Unlock()
+}
+
+// checkQuota counts the request against the quota of the user. It returns
+// a non-nil error if the quota is exceeded.
+func (k *Kite) checkQuota(r *Request) *Error {
+	k.quotaMu.RLock()
+	quota, store := k.quota, k.quotaStore
+	k.quotaMu.RUnlock()
+
+	if quota == nil || store == nil {
+		return nil
+	}
+
+	check := func(kind string, n, max int64) *Error {
+		if max <= 0 {
+			return nil
+		}
+
+		total, err := store.Add(kind+":"+r.Username, n, quota.Window)
+		if err != nil {
+			// Failing to count is not the user's fault, let the request pass.
+			r.Logger().Error("quota: counting %s of %q failed: %s", kind, r.Username, err)
+			return nil
+		}
+
+		if total > max {
+			return &Error{
+				Type:      "quotaExceeded",
+				Message:   fmt.Sprintf("The quota of %d %s per %s is exceeded.", max, kind, quota.Window),
+				RequestID: r.ID,
+			}
+		}
+
+		return nil
+	}
+
+	if err := check("requests", r.cost(), quota.Requests); err != nil {
+		return err
+	}
+
+	var size int64
+	if r.Args != nil {
+		size = int64(len(r.Args.Raw))
+	}
+
+	return check("bytes", size, quota.Bytes)
+}
@@ -0,0 +1,66 @@
+package kite
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemQuotaStore(t *testing.T) {
+	s := NewMemQuotaStore()
+
+	for i := int64(1); i <= 3; i++ {
+		n, err := s.Add("requests:user", 1, 50*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Add()=%s", err)
+		}
+
+		if n != i {
+			t.Fatalf("want %d, got %d", i, n)
+		}
+	}
+
+	if n, _ := s.Add("requests:other", 5, 50*time.Millisecond); n != 5 {
+		t.Fatalf("want 5, got %d", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if n, _ := s.Add("requests:user", 1, 50*time.Millisecond); n != 1 {
+		t.Fatalf("want counter to be reset, got %d", n)
+	}
+}
+
+func TestKite_CheckQuota(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	r := &Request{Username: "user"}
+
+	if err := k.checkQuota(r); err != nil {
+		t.Fatalf("want no quota, got %s", err)
+	}
+
+	if err := k.SetQuota(&Quota{Requests: 2}); err == nil {
+		t.Fatal("want quota without window to be rejected")
+	}
+
+	if err := k.SetQuota(&Quota{Requests: 2, Window: time.Minute}); err != nil {
+		t.Fatalf("SetQuota()=%s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := k.checkQuota(r); err != nil {
+			t.Fatalf("checkQuota()=%s", err)
+		}
+	}
+
+	err := k.checkQuota(r)
+	if err == nil || err.Type != "quotaExceeded" {
+		t.Fatalf("want quotaExceeded error, got %v", err)
+	}
+
+	// quota is per user
+	if err := k.checkQuota(&Request{Username: "other"}); err != nil {
+		t.Fatalf("checkQuota()=%s", err)
+	}
+}
@@ -0,0 +1,173 @@
+package kite
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/juju/ratelimit"
+)
+
+// RateLimit is a token bucket limit of the rate of the calls handled by
+// the kite, see SetRateLimit.
+type RateLimit struct {
+	// Rate is the number of calls allowed per second, on average.
+	Rate float64
+
+	// Burst is the number of calls allowed at once, it is at least 1.
+	Burst int64
+}
+
+// RateLimitScope tells which calls share a rate limit.
+type RateLimitScope int
+
+const (
+	// RateLimitGlobal limits all the calls handled by the kite.
+	RateLimitGlobal RateLimitScope = iota
+
+	// RateLimitPerKite limits the calls of each remote kite, by kite ID.
+	RateLimitPerKite
+
+	// RateLimitPerMethod limits the calls of each method, by method name.
+	RateLimitPerMethod
+)
+
+// String implements the fmt.Stringer interface.
+func (s RateLimitScope) String() string {
+	switch s {
+	case RateLimitGlobal:
+		return "global"
+	case RateLimitPerKite:
+		return "kite"
+	case RateLimitPerMethod:
+		return "method"
+	default:
+		return fmt.Sprintf("RateLimitScope(%d)", int(s))
+	}
+}
+
+// rateLimitSweepInterval is how often the buckets of the remote kites and
+// methods, which are full, are dropped.
+var rateLimitSweepInterval = time.Minute
+
+// rateLimiter holds the buckets of a scope, by kite ID or method name.
+type rateLimiter struct {
+	scope RateLimitScope
+	limit RateLimit
+
+	mu      sync.Mutex
+	buckets map[string]*ratelimit.Bucket
+	swept   time.Time
+}
+
+// take takes the cost from the bucket of the key, it returns the time after
+// which the call would be allowed if there are not enough tokens.
+func (l *rateLimiter) take(key string, cost int64) (time.Duration, bool) {
+	l.mu.Lock()
+
+	// Full buckets are the same as new ones, dropping them keeps the map
+	// from growing with the number of kites that ever called.
+	if now := time.Now(); now.Sub(l.swept) >= rateLimitSweepInterval {
+		for key, b := range l.buckets {
+			if b.Available() >= b.Capacity() {
+				delete(l.buckets, key)
+			}
+		}
+
+		l.swept = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = ratelimit.NewBucketWithRate(l.limit.Rate, l.limit.Burst)
+		l.buckets[key] = b
+	}
+
+	l.mu.Unlock()
+
+	if _, ok := b.TakeMaxDuration(cost, 0); ok {
+		return 0, true
+	}
+
+	if cost > b.Capacity() {
+		cost = b.Capacity()
+	}
+
+	missing := float64(cost - b.Available())
+
+	return time.Duration(missing / b.Rate() * float64(time.Second)), false
+}
+
+// SetRateLimit limits the rate of the calls of the methods handled by
+// the kite in the given scope. The calls over the limit are rejected with
+// a "rateLimitError" error, which Error.RetryAfter tells when the call
+// would be allowed. The limits of all the scopes apply, a nil limit
+// removes the limit of the scope.
+//
+// Limits of the remote kites are by their IDs, so they apply to methods
+// with the authentication disabled as well. A method can have its own
+// limit, see Method.Throttle.
+func (k *Kite) SetRateLimit(scope RateLimitScope, limit *RateLimit) {
+	k.rateLimitsMu.Lock()
+	defer k.rateLimitsMu.Unlock()
+
+	if limit == nil {
+		delete(k.rateLimits, scope)
+		return
+	}
+
+	l := &rateLimiter{
+		scope:   scope,
+		limit:   *limit,
+		buckets: make(map[string]*ratelimit.Bucket),
+	}
+
+	if l.limit.Burst < 1 {
+		l.limit.Burst = 1
+	}
+
+	if k.rateLimits == nil {
+		k.rateLimits = make(map[RateLimitScope]*rateLimiter)
+	}
+
+	k.rateLimits[scope] = l
+}
+
+// checkRateLimits takes the cost of the request from the rate limits of
+// the kite, the most specific ones first. It returns a non-nil error if
+// any of the limits is exceeded.
+func (k *Kite) checkRateLimits(r *Request) *Error {
+	k.rateLimitsMu.RLock()
+	defer k.rateLimitsMu.RUnlock()
+
+	if len(k.rateLimits) == 0 {
+		return nil
+	}
+
+	scopes := []struct {
+		scope RateLimitScope
+		key   string
+	}{
+		{RateLimitPerMethod, r.Method},
+		{RateLimitPerKite, r.Client.Kite.ID},
+		{RateLimitGlobal, ""},
+	}
+
+	for _, s := range scopes {
+		l, ok := k.rateLimits[s.scope]
+		if !ok {
+			continue
+		}
+
+		if retryAfter, ok := l.take(s.key, r.cost()); !ok {
+			return &Error{
+				Type:       "rateLimitError",
+				Message:    fmt.Sprintf("The %s rate limit of %g calls per second is exceeded.", s.scope, l.limit.Rate),
+				RequestID:  r.ID,
+				RetryAfter: retryAfter,
+			}
+		}
+	}
+
+	return nil
+}
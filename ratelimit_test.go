@@ -0,0 +1,61 @@
+package kite
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKite_RateLimits(t *testing.T) {
+	k := New("ratelimit", "0.0.1")
+	defer k.Close()
+
+	k.SetRateLimit(RateLimitPerKite, &RateLimit{Rate: 10, Burst: 2})
+	k.SetRateLimit(RateLimitPerMethod, &RateLimit{Rate: 1, Burst: 3})
+
+	request := func(kiteID, method string) *Request {
+		c := k.NewClient("")
+		c.Kite.ID = kiteID
+
+		return &Request{
+			ID:        "req",
+			Method:    method,
+			Client:    c,
+			LocalKite: k,
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := k.checkRateLimits(request("alice", "square")); err != nil {
+			t.Fatalf("%d: checkRateLimits()=%s", i, err)
+		}
+	}
+
+	err := k.checkRateLimits(request("alice", "square"))
+	if err == nil {
+		t.Fatal("want the limit of the kite to be exceeded")
+	}
+
+	if err.Type != "rateLimitError" {
+		t.Fatalf("got %q, want %q", err.Type, "rateLimitError")
+	}
+
+	if err.RetryAfter <= 0 || err.RetryAfter > 100*time.Millisecond {
+		t.Fatalf("got %s, want retry within 100ms", err.RetryAfter)
+	}
+
+	// The limit of the method is taken from before the one of the kite.
+	if err := k.checkRateLimits(request("bob", "square")); err == nil {
+		t.Fatal("want the limit of the method to be exceeded")
+	}
+
+	if err := k.checkRateLimits(request("bob", "cube")); err != nil {
+		t.Fatalf("checkRateLimits()=%s", err)
+	}
+
+	k.SetRateLimit(RateLimitPerMethod, nil)
+	k.SetRateLimit(RateLimitPerKite, nil)
+
+	if err := k.checkRateLimits(request("alice", "square")); err != nil {
+		t.Fatalf("checkRateLimits()=%s", err)
+	}
+}
@@ -0,0 +1,275 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+// ReconnectPolicy configures how a Client with Reconnect enabled redials
+// the remote kite after the connection was lost.
+type ReconnectPolicy struct {
+	// InitialInterval is the delay before the first redial.
+	//
+	// When 0, the default value of 500ms is used.
+	InitialInterval time.Duration
+
+	// MaxInterval caps the delay between redials.
+	//
+	// When 0, the default value of 1m is used.
+	MaxInterval time.Duration
+
+	// Multiplier is the factor the delay grows by after every redial.
+	//
+	// When 0, the default value of 1.5 is used.
+	Multiplier float64
+
+	// Jitter randomizes the delays by the given fraction, e.g. with 0.5
+	// a delay of 2s becomes a random one between 1s and 3s, so clients
+	// that lost connections at the same time do not redial all at once.
+	//
+	// When 0, the default value of 0.5 is used. When <0, the delays
+	// are not randomized.
+	Jitter float64
+
+	// MaxRetries is the number of failed redials after which the client
+	// gives up and closes itself.
+	//
+	// When 0, the client redials forever.
+	MaxRetries int
+
+	// QueueSize is the number of the calls held while the client is
+	// reconnecting, they are sent in order once the connection is restored,
+	// after the OnReconnect callbacks. The calls made when the queue is
+	// full fail right away.
+	//
+	// When 0, the calls made while reconnecting fail right away.
+	QueueSize int
+
+	// QueueTimeout is the longest time a call is held while the client is
+	// reconnecting, it fails with the "timeout" error afterwards.
+	//
+	// When 0, the timeout of the call is used.
+	QueueTimeout time.Duration
+}
+
+// backOff returns a new BackOff following the policy.
+func (p *ReconnectPolicy) backOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = 0 // stopped by MaxRetries only
+
+	if p.InitialInterval > 0 {
+		b.InitialInterval = p.InitialInterval
+	}
+
+	if p.MaxInterval > 0 {
+		b.MaxInterval = p.MaxInterval
+	}
+
+	if p.Multiplier > 0 {
+		b.Multiplier = p.Multiplier
+	}
+
+	switch {
+	case p.Jitter > 0:
+		b.RandomizationFactor = p.Jitter
+	case p.Jitter < 0:
+		b.RandomizationFactor = 0
+	}
+
+	b.Reset()
+
+	if p.MaxRetries > 0 {
+		return &maxRetries{b: b, max: p.MaxRetries}
+	}
+
+	return b
+}
+
+// maxRetries stops the wrapped BackOff after max retries.
+type maxRetries struct {
+	b       backoff.BackOff
+	max     int
+	retries int
+}
+
+func (m *maxRetries) NextBackOff() time.Duration {
+	if m.retries >= m.max {
+		return backoff.Stop
+	}
+
+	m.retries++
+
+	return m.b.NextBackOff()
+}
+
+func (m *maxRetries) Reset() {
+	m.retries = 0
+	m.b.Reset()
+}
+
+// OnReconnect adds a callback which is called when the client connects
+// again to the remote kite after the connection was lost, right after the
+// OnConnect callbacks. It is meant for restoring the state of the session,
+// like subscriptions or authentication.
+func (c *Client) OnReconnect(handler func()) {
+	c.m.Lock()
+	c.onReconnectHandlers = append(c.onReconnectHandlers, handler)
+	c.m.Unlock()
+}
+
+// callOnReconnectHandlers runs the registered reconnect handlers.
+func (c *Client) callOnReconnectHandlers() {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	for _, handler := range c.onReconnectHandlers {
+		func() {
+			defer nopRecover()
+			handler()
+		}()
+	}
+}
+
+// callQueue holds the calls made while the client is reconnecting, see
+// ReconnectPolicy.QueueSize.
+type callQueue struct {
+	size    int
+	timeout time.Duration
+	calls   []*queuedCall
+	flushed chan struct{}
+}
+
+type queuedCall struct {
+	ctx          context.Context
+	method       string
+	args         []interface{}
+	timeout      time.Duration
+	responseChan chan *response
+	done         int32 // 1 once the call is sent or failed
+}
+
+// startQueue makes the calls wait for the client to reconnect, if
+// the reconnect policy enables it.
+func (c *Client) startQueue() {
+	p := c.ReconnectPolicy
+	if p == nil || p.QueueSize <= 0 {
+		return
+	}
+
+	c.queueMu.Lock()
+	if c.queue == nil {
+		c.queue = &callQueue{
+			size:    p.QueueSize,
+			timeout: p.QueueTimeout,
+			flushed: make(chan struct{}),
+		}
+	}
+	c.queueMu.Unlock()
+}
+
+// queueCall holds the call until the client reconnects, it returns false
+// if the client is not reconnecting.
+func (c *Client) queueCall(ctx context.Context, method string, args []interface{}, timeout time.Duration, responseChan chan *response) bool {
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+
+	q := c.queue
+	if q == nil {
+		return false
+	}
+
+	if len(q.calls) >= q.size {
+		responseChan <- &response{
+			Err: &Error{
+				Type:    "sendError",
+				Message: fmt.Sprintf("can't send, %d calls are already waiting for the client to reconnect", q.size),
+			},
+		}
+		return true
+	}
+
+	call := &queuedCall{
+		ctx:          ctx,
+		method:       method,
+		args:         args,
+		timeout:      timeout,
+		responseChan: responseChan,
+	}
+
+	q.calls = append(q.calls, call)
+
+	wait := q.timeout
+	if wait == 0 {
+		wait = timeout
+	}
+
+	go c.expireCall(q, call, wait)
+
+	return true
+}
+
+// expireCall fails the queued call if the client does not reconnect
+// in time.
+func (c *Client) expireCall(q *callQueue, call *queuedCall, wait time.Duration) {
+	var timeout <-chan time.Time
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	var err *Error
+
+	select {
+	case <-q.flushed:
+		return
+	case <-timeout:
+		err = &Error{
+			Type:    "timeout",
+			Message: fmt.Sprintf("No connection to send %q method in %s", call.method, wait),
+		}
+	case <-call.ctx.Done():
+		errType := "canceled"
+		if call.ctx.Err() == context.DeadlineExceeded {
+			errType = "timeout"
+		}
+
+		err = &Error{
+			Type:    errType,
+			Message: fmt.Sprintf("Call to %q method: %s", call.method, call.ctx.Err()),
+		}
+	case <-c.closeChan:
+		err = &Error{
+			Type:    "sendError",
+			Message: "can't send, client is closed",
+		}
+	}
+
+	if atomic.CompareAndSwapInt32(&call.done, 0, 1) {
+		call.responseChan <- &response{Err: err}
+	}
+}
+
+// flushQueue sends the calls held while the client was reconnecting.
+func (c *Client) flushQueue() {
+	c.queueMu.Lock()
+	q := c.queue
+	c.queue = nil
+	c.queueMu.Unlock()
+
+	if q == nil {
+		return
+	}
+
+	close(q.flushed)
+
+	for _, call := range q.calls {
+		if atomic.CompareAndSwapInt32(&call.done, 0, 1) {
+			c.invokeMethod(call.ctx, call.method, call.args, call.timeout, call.responseChan)
+		}
+	}
+}
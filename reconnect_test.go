@@ -0,0 +1,87 @@
+package kite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+func TestReconnectPolicy(t *testing.T) {
+	p := &ReconnectPolicy{
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     400 * time.Millisecond,
+		Multiplier:      2,
+		Jitter:          -1,
+		MaxRetries:      5,
+	}
+
+	b := p.backOff()
+
+	want := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		400 * time.Millisecond,
+		400 * time.Millisecond,
+		backoff.Stop,
+	}
+
+	for i, w := range want {
+		if got := b.NextBackOff(); got != w {
+			t.Fatalf("%d: got %s, want %s", i, got, w)
+		}
+	}
+
+	b.Reset()
+
+	if got := b.NextBackOff(); got != p.InitialInterval {
+		t.Fatalf("got %s, want %s after reset", got, p.InitialInterval)
+	}
+
+	p = &ReconnectPolicy{
+		InitialInterval: time.Second,
+		Jitter:          0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		d := p.backOff().NextBackOff()
+
+		if d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Fatalf("got %s, want between 500ms and 1.5s", d)
+		}
+	}
+}
+
+func TestClient_QueueCalls(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	c := k.NewClient("http://127.0.0.1:0/kite")
+	c.ReconnectPolicy = &ReconnectPolicy{
+		QueueSize:    1,
+		QueueTimeout: 50 * time.Millisecond,
+	}
+
+	c.startQueue()
+
+	queued := c.Go("square", 2)
+
+	select {
+	case resp := <-c.Go("square", 3):
+		if e, ok := resp.Err.(*Error); !ok || e.Type != "sendError" {
+			t.Fatalf("got %v, want sendError", resp.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the call to fail")
+	}
+
+	select {
+	case resp := <-queued:
+		if e, ok := resp.Err.(*Error); !ok || e.Type != "timeout" {
+			t.Fatalf("got %v, want timeout", resp.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the call to expire")
+	}
+}
@@ -0,0 +1,214 @@
+package kite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Redacted is what the values of sensitive fields are replaced with
+// in the logs.
+const Redacted = "[REDACTED]"
+
+// RedactFields marks the fields with the given JSON paths as sensitive, their
+// values are replaced with Redacted before messages, arguments or results
+// are logged, including traces (see SetTrace).
+//
+// A path is a dot-separated list of object keys and array indexes, matched
+// against the whole message, e.g. "arguments.0.password"; "*" matches any
+// key or index. A path without dots matches the field at any depth:
+//
+//     k.RedactFields("password", "arguments.*.token")
+//
+// Fields of Go values can also be marked as sensitive with the
+// `kite:"redact"` struct tag, see Redact.
+func (k *Kite) RedactFields(paths ...string) {
+	k.redactMu.Lock()
+	defer k.redactMu.Unlock()
+
+	for _, path := range paths {
+		if path != "" {
+			k.redactPaths = append(k.redactPaths, strings.Split(path, "."))
+		}
+	}
+}
+
+// Redact returns v encoded as JSON, with the values of the sensitive fields
+// replaced with Redacted. Sensitive are the fields registered with
+// RedactFields and the struct fields tagged with `kite:"redact"`.
+func (k *Kite) Redact(v interface{}) string {
+	var tagged [][]string
+	collectRedacted(reflect.ValueOf(v), nil, &tagged)
+
+	p, err := json.Marshal(v)
+	if err != nil {
+		// Values with callbacks can't be encoded, in which case
+		// nothing can be redacted.
+		if len(tagged) == 0 && !k.redacting() {
+			return fmt.Sprintf("%#v", v)
+		}
+
+		return Redacted
+	}
+
+	return string(k.redactJSON(p, tagged...))
+}
+
+func (k *Kite) redacting() bool {
+	k.redactMu.RLock()
+	defer k.redactMu.RUnlock()
+
+	return len(k.redactPaths) != 0
+}
+
+// redactJSON replaces the values of the sensitive fields in the JSON
+// document p. The given paths are redacted in addition to the ones
+// registered with RedactFields.
+func (k *Kite) redactJSON(p []byte, paths ...[]string) []byte {
+	k.redactMu.RLock()
+	paths = append(paths, k.redactPaths...)
+	k.redactMu.RUnlock()
+
+	if len(paths) == 0 {
+		return p
+	}
+
+	var v interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+
+	if err := dec.Decode(&v); err != nil {
+		// Do not risk leaking the sensitive fields of malformed documents.
+		return []byte(fmt.Sprintf("[malformed JSON, %d bytes]", len(p)))
+	}
+
+	for _, path := range paths {
+		if len(path) == 1 {
+			redactAny(v, path[0])
+		} else {
+			v = redactPath(v, path)
+		}
+	}
+
+	redacted, err := json.Marshal(v)
+	if err != nil {
+		return []byte(Redacted)
+	}
+
+	return redacted
+}
+
+// redactPath replaces the value under the given path.
+func redactPath(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return Redacted
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if path[0] == "*" || path[0] == key {
+				v[key] = redactPath(value, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				v[i] = redactPath(value, path[1:])
+			}
+		}
+	}
+
+	return v
+}
+
+// redactAny replaces values of all the fields with the given name.
+func redactAny(v interface{}, name string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if key == name {
+				v[key] = Redacted
+			} else {
+				redactAny(value, name)
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			redactAny(value, name)
+		}
+	}
+}
+
+// collectRedacted collects JSON paths of the struct fields tagged
+// with `kite:"redact"`.
+func collectRedacted(rv reflect.Value, path []string, paths *[][]string) {
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !rv.IsNil() {
+			collectRedacted(rv.Elem(), path, paths)
+		}
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return // []byte is encoded as a string
+		}
+
+		for i := 0; i < rv.Len(); i++ {
+			collectRedacted(rv.Index(i), appendPath(path, strconv.Itoa(i)), paths)
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return
+		}
+
+		for _, key := range rv.MapKeys() {
+			collectRedacted(rv.MapIndex(key), appendPath(path, key.String()), paths)
+		}
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			sf := rv.Type().Field(i)
+			if sf.PkgPath != "" && !sf.Anonymous { // unexported
+				continue
+			}
+
+			tag := sf.Tag.Get("json")
+			if idx := strings.Index(tag, ","); idx != -1 {
+				tag = tag[:idx]
+			}
+
+			if tag == "-" {
+				continue
+			}
+
+			if sf.Anonymous && tag == "" {
+				collectRedacted(rv.Field(i), path, paths)
+				continue
+			}
+
+			name := tag
+			if name == "" {
+				name = sf.Name
+			}
+
+			if sf.Tag.Get("kite") == "redact" {
+				*paths = append(*paths, appendPath(path, name))
+				continue
+			}
+
+			collectRedacted(rv.Field(i), appendPath(path, name), paths)
+		}
+	}
+}
+
+// appendPath returns a copy of path with the key appended, so the collected
+// paths do not share their backing arrays.
+func appendPath(path []string, key string) []string {
+	p := make([]string, len(path)+1)
+	copy(p, path)
+	p[len(path)] = key
+	return p
+}
@@ -0,0 +1,52 @@
+package kite
+
+import (
+	"testing"
+)
+
+func TestKite_RedactJSON(t *testing.T) {
+	k := &Kite{}
+
+	p := []byte(`{"method":"login","arguments":[{"user":"jdoe","password":"hunter2","token":"abc"}]}`)
+
+	if got := string(k.redactJSON(p)); got != string(p) {
+		t.Fatalf("got %s, want unchanged", got)
+	}
+
+	k.RedactFields("password", "arguments.*.token")
+
+	want := `{"arguments":[{"password":"[REDACTED]","token":"[REDACTED]","user":"jdoe"}],"method":"login"}`
+
+	if got := string(k.redactJSON(p)); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	if got := string(k.redactJSON([]byte(`{"password":`))); got != "[malformed JSON, 12 bytes]" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestKite_Redact(t *testing.T) {
+	type credentials struct {
+		User   string `json:"user"`
+		Secret string `json:"secret" kite:"redact"`
+	}
+
+	type args struct {
+		Credentials []credentials
+		Count       int64 `json:"count"`
+	}
+
+	k := &Kite{}
+
+	got := k.Redact([]interface{}{&args{
+		Credentials: []credentials{{User: "jdoe", Secret: "hunter2"}},
+		Count:       9007199254740993,
+	}})
+
+	want := `[{"Credentials":[{"secret":"[REDACTED]","user":"jdoe"}],"count":9007199254740993}]`
+
+	if got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"runtime/debug"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -12,7 +13,6 @@ import (
 	"github.com/koding/kite/dnode"
 	"github.com/koding/kite/kitekey"
 	"github.com/koding/kite/protocol"
-	"github.com/koding/kite/sockjsclient"
 	"github.com/koding/kite/utils"
 )
 
@@ -28,6 +28,31 @@ type Request struct {
 	// This is authenticated and validated if authentication is enabled.
 	Username string
 
+	// Tenant is the ID of the tenant the request is made on behalf of. It is
+	// taken from the "tenant" claim of the token or kite key. When the
+	// claim is missing, the tenant sent by the caller kite is used only if
+	// the caller is trusted to impersonate other users, which lets services
+	// pass the tenant along to the kites they call, see Config.Impersonators.
+	// Otherwise it is empty.
+	//
+	// The tenant is also stored in the Context, see TenantFromContext.
+	Tenant string
+
+	// APIVersion is the version of the method, which serves the request.
+	// It is requested by the caller with WithAPIVersion, see
+	// Kite.HandleVersion. It is empty for methods without versions.
+	APIVersion string
+
+	// KiteVersion is the version of the kite serving the request, which is
+	// the version the caller queried for, if the kite serves it, see
+	// Kite.AddVersion.
+	KiteVersion string
+
+	// Actor is the username of the kite, which made the request on behalf
+	// of the user with a delegate token, see Kite.GetDelegateToken.
+	// It is empty for requests made by the user directly.
+	Actor string
+
 	// Args defines the incoming arguments for the given method.
 	Args *dnode.Partial
 
@@ -46,9 +71,27 @@ type Request struct {
 	// chain. This is useful with PreHandle and PostHandle handlers to pass
 	// data between handlers.
 	//
-	// The context is canceled when client has disconnected or session
-	// was prematurely terminated.
+	// The context is canceled when client has disconnected, session
+	// was prematurely terminated or the caller canceled the call, see
+	// ContextHandlerFunc.
 	Context context.Context
+
+	// Priority and Cost are the hints sent by the caller, see WithPriority
+	// and WithCost.
+	Priority Priority
+	Cost     int
+
+	// impersonation is the username the caller wants to make the request
+	// on behalf of, see WithImpersonation.
+	impersonation string
+
+	// tenant is the tenant sent by the caller, see Tenant.
+	tenant string
+
+	// warnings and metadata are sent back to the caller along with
+	// the response.
+	warnings []string
+	metadata map[string]interface{}
 }
 
 // Response is the type of the object that is returned from request handlers
@@ -56,10 +99,36 @@ type Request struct {
 type Response struct {
 	Error  *Error      `json:"error" dnode:"-"`
 	Result interface{} `json:"result"`
+
+	// Warnings are non-fatal notices for the caller, e.g. about calling
+	// a deprecated method.
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Metadata holds additional information about the result, like cache
+	// status or partial-result flags.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
 
-// runMethod is called when a method is received from remote Kite.
-func (c *Client) runMethod(method *Method, args *dnode.Partial) {
+// AddWarning attaches a non-fatal warning to the response. The warnings are
+// logged by the caller kite and are available in Client.TellResult.
+func (r *Request) AddWarning(warning string) {
+	r.warnings = append(r.warnings, warning)
+}
+
+// SetMetadata attaches a metadata value to the response, it is available
+// to the caller in Client.TellResult.
+func (r *Request) SetMetadata(key string, value interface{}) {
+	if r.metadata == nil {
+		r.metadata = make(map[string]interface{})
+	}
+
+	r.metadata[key] = value
+}
+
+// runMethod is called when a method is received from remote Kite. The
+// response is sent with the response callback of the call, unless respond
+// is non-nil.
+func (c *Client) runMethod(method *Method, args *dnode.Partial, respond func(*Response)) {
 	var (
 		callFunc func(interface{}, *Error)
 		request  *Request
@@ -67,17 +136,48 @@ func (c *Client) runMethod(method *Method, args *dnode.Partial) {
 
 	// Recover dnode argument errors and send them back. The caller can use
 	// functions like MustString(), MustSlice()... without the fear of panic.
+	// Other panics of the handlers are sent back as well, so they do not
+	// tear down the connection.
 	defer func() {
 		if r := recover(); r != nil {
-			debug.PrintStack()
-			kiteErr := createError(request, r)
-			c.LocalKite.Log.Error(kiteErr.Error()) // let's log it too :)
-			callFunc(nil, kiteErr)
+			c.recoverMethod(request, callFunc, respond, r)
 		}
 	}()
 
 	// The request that will be constructed from incoming dnode message.
-	request, callFunc = c.newRequest(method.name, args)
+	request, callFunc = c.newRequest(method, args, respond)
+
+	if m := c.LocalKite.getMetrics(); m != nil {
+		callFunc = m.observe(method.name, time.Now(), callFunc)
+	}
+
+	callFunc = c.startHandlerSpan(request, callFunc)
+	callFunc = c.logRequest(request, callFunc)
+
+	atomic.AddInt32(&c.LocalKite.inflight, 1)
+	defer atomic.AddInt32(&c.LocalKite.inflight, -1)
+
+	if c.LocalKite.isDraining() {
+		callFunc(nil, &Error{
+			Type:      "shutdownError",
+			Message:   "Kite is shutting down",
+			RequestID: request.ID,
+		})
+		return
+	}
+
+	method, kiteErr := method.resolveKiteVersion(request)
+	if kiteErr != nil {
+		callFunc(nil, kiteErr)
+		return
+	}
+
+	method, kiteErr = method.resolveVersion(request)
+	if kiteErr != nil {
+		callFunc(nil, kiteErr)
+		return
+	}
+
 	if method.authenticate {
 		if err := request.authenticate(); err != nil {
 			callFunc(nil, createError(request, err))
@@ -89,6 +189,19 @@ func (c *Client) runMethod(method *Method, args *dnode.Partial) {
 		request.Username = request.Client.Kite.Username
 	}
 
+	if method.authenticate {
+		request.acceptTenant()
+	}
+
+	if request.Tenant != "" {
+		request.Context = WithTenant(request.Context, request.Tenant)
+	}
+
+	if err := c.LocalKite.authorize(request); err != nil {
+		callFunc(nil, err)
+		return
+	}
+
 	method.mu.Lock()
 	if !method.initialized {
 		method.preHandlers = append(method.preHandlers, c.LocalKite.preHandlers...)
@@ -98,12 +211,32 @@ func (c *Client) runMethod(method *Method, args *dnode.Partial) {
 	}
 	method.mu.Unlock()
 
+	if max := c.LocalKite.Config.MaxMessageArgs; max > 0 && request.Args != nil {
+		if args, err := request.Args.Slice(); err == nil && len(args) > max {
+			callFunc(nil, &Error{
+				Type:      "messageLimitError",
+				Message:   dnode.LimitError{Limit: "arguments", Max: max}.Error(),
+				RequestID: request.ID,
+			})
+			return
+		}
+	}
+
+	if method.strict && method.args != nil && request.Args != nil {
+		if args, err := request.Args.Slice(); err == nil && len(args) != 0 {
+			if err := dnode.CheckFields(args[0].Raw, method.args); err != nil {
+				callFunc(nil, createError(request, err))
+				return
+			}
+		}
+	}
+
 	// check if any throttling is enabled and then check token's available.
 	// Tokens are filled per frequency of the initial bucket, so every request
 	// is going to take one token from the bucket. If many requests come in (in
 	// span time larger than the bucket's frequency), there will be no token's
 	// available more so it will return a zero.
-	if method.bucket != nil && method.bucket.TakeAvailable(1) == 0 {
+	if method.bucket != nil && !method.takeTokens(request) {
 		callFunc(nil, &Error{
 			Type:      "requestLimitError",
 			Message:   "The maximum request rate is exceeded.",
@@ -112,12 +245,100 @@ func (c *Client) runMethod(method *Method, args *dnode.Partial) {
 		return
 	}
 
+	if err := c.LocalKite.checkRateLimits(request); err != nil {
+		callFunc(nil, err)
+		return
+	}
+
+	if method.authenticate {
+		if err := c.LocalKite.checkQuota(request); err != nil {
+			callFunc(nil, err)
+			return
+		}
+	}
+
+	release, kiteErr := c.LocalKite.admit(request)
+	if kiteErr != nil {
+		callFunc(nil, kiteErr)
+		return
+	}
+	defer release()
+
+	if method.deprecated {
+		atomic.AddInt64(&method.deprecatedCalls, 1)
+		request.AddWarning(method.deprecationWarning())
+	}
+
 	// Call the handler functions.
-	result, err := method.ServeKite(request)
+	result, err := c.LocalKite.wrap(method).ServeKite(request)
 
 	callFunc(result, createError(request, err))
 }
 
+// logRequest logs the handled request at the DEBUG level, with the ID of
+// the remote kite, the method, the ID of the request and the duration as
+// the fields of the message.
+func (c *Client) logRequest(r *Request, callFunc func(interface{}, *Error)) func(interface{}, *Error) {
+	start := time.Now()
+
+	return func(result interface{}, err *Error) {
+		c.m.RLock()
+		id := c.Kite.ID
+		c.m.RUnlock()
+
+		fields := Fields{
+			"kite":      id,
+			"method":    r.Method,
+			"requestID": r.ID,
+			"duration":  time.Since(start),
+		}
+
+		if err != nil {
+			fields["error"] = err.Type
+		}
+
+		WithFields(r.Logger(), fields).Debug("request handled")
+
+		callFunc(result, err)
+	}
+}
+
+// recoverMethod sends the value recovered from a panic of runMethod back
+// to the caller as an error. Panics other than the argument errors are
+// logged with the stack trace.
+func (c *Client) recoverMethod(request *Request, callFunc func(interface{}, *Error), respond func(*Response), r interface{}) {
+	kiteErr := createError(request, r)
+
+	log := c.LocalKite.Log
+	if request != nil {
+		log = request.Logger()
+	}
+
+	if _, ok := r.(*dnode.ArgumentError); ok {
+		log.Error(kiteErr.Error())
+	} else {
+		log.Error("Recovered panic: %s\n%s", kiteErr, debug.Stack())
+	}
+
+	// The request could not be parsed, so the error can be sent only
+	// to the HTTP callers.
+	if callFunc == nil {
+		if respond != nil {
+			respond(&Response{Error: kiteErr})
+		}
+
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("Cannot send error response: %v", r)
+		}
+	}()
+
+	callFunc(nil, kiteErr)
+}
+
 // runCallback is called when a callback method call is received from remote Kite.
 func (c *Client) runCallback(callback func(*dnode.Partial), args *dnode.Partial) {
 	// Do not panic no matter what.
@@ -132,13 +353,17 @@ func (c *Client) runCallback(callback func(*dnode.Partial), args *dnode.Partial)
 }
 
 // newRequest returns a new *Request from the method and arguments passed.
-func (c *Client) newRequest(method string, args *dnode.Partial) (*Request, func(interface{}, *Error)) {
+func (c *Client) newRequest(method *Method, args *dnode.Partial, respond func(*Response)) (*Request, func(interface{}, *Error)) {
 	// Parse dnode method arguments: [options]
 	var options callOptions
-	args.One().MustUnmarshal(&options)
+	if method.rawArgs {
+		unmarshalRawOptions(args, &options)
+	} else {
+		args.One().MustUnmarshal(&options)
+	}
 
 	// Notify the handlers registered with Kite.OnFirstRequest().
-	if _, ok := c.session.(*sockjsclient.WebsocketSession); !ok {
+	if !c.isDialed() {
 		c.firstRequestHandlersNotified.Do(func() {
 			c.m.Lock()
 			c.Kite = options.Kite
@@ -147,26 +372,57 @@ func (c *Client) newRequest(method string, args *dnode.Partial) (*Request, func(
 		})
 	}
 
+	// The context of a request, which can be canceled by the caller, is
+	// canceled also once the request is finished.
+	ctx := c.context()
+	if options.CallID != "" {
+		ctx = c.trackCall(ctx, options.CallID)
+	}
+
+	// The span of the caller is the parent of the spans of the request.
+	if sc, err := ParseTraceParent(options.TraceParent); err == nil {
+		ctx = WithSpanContext(ctx, sc)
+	}
+
 	request := &Request{
 		ID:        utils.RandomString(16),
-		Method:    method,
+		Method:    method.name,
 		Args:      options.WithArgs,
 		LocalKite: c.LocalKite,
 		Client:    c,
 		Auth:      options.Auth,
-		Context:   c.context(),
+		Context:   ctx,
+
+		APIVersion:  options.APIVersion,
+		KiteVersion: options.KiteVersion,
+		Priority:    options.Priority,
+		Cost:        options.Cost,
+
+		impersonation: options.Impersonate,
+		tenant:        options.Tenant,
 	}
 
 	// Call response callback function, send back our response
 	callFunc := func(result interface{}, err *Error) {
-		if options.ResponseCallback.Caller == nil {
+		if options.CallID != "" {
+			defer c.releaseCall(options.CallID)
+		}
+
+		if respond == nil && options.ResponseCallback.Caller == nil {
 			return
 		}
 
 		// Only argument to the callback.
 		response := Response{
-			Result: result,
-			Error:  err,
+			Result:   c.LocalKite.applyNaming(result),
+			Error:    err,
+			Warnings: request.warnings,
+			Metadata: request.metadata,
+		}
+
+		if respond != nil {
+			respond(&response)
+			return
 		}
 
 		if err := options.ResponseCallback.Call(response); err != nil {
@@ -180,13 +436,8 @@ func (c *Client) newRequest(method string, args *dnode.Partial) (*Request, func(
 // authenticate tries to authenticate the user by selecting appropriate
 // authenticator function.
 func (r *Request) authenticate() *Error {
-	// Trust the Kite if we have initiated the connection.  Following casts
-	// means, session is opened by the client.
-	if _, ok := r.Client.session.(*sockjsclient.WebsocketSession); ok {
-		return nil
-	}
-
-	if _, ok := r.Client.session.(*sockjsclient.XHRSession); ok {
+	// Trust the Kite if we have initiated the connection.
+	if r.Client.isDialed() {
 		return nil
 	}
 
@@ -218,60 +469,32 @@ func (r *Request) authenticate() *Error {
 	// Replace username of the remote Kite with the username that client send
 	// us. This prevents a Kite to impersonate someone else's Kite.
 	r.Client.SetUsername(r.Username)
-	return nil
+
+	// Impersonation is checked after the client's username is set, so the
+	// client is still bound to the identity it authenticated with.
+	return r.impersonate()
 }
 
 // AuthenticateFromToken is the default Authenticator for Kite.
 func (k *Kite) AuthenticateFromToken(r *Request) error {
-	k.verifyOnce.Do(k.verifyInit)
-
-	token, err := jwt.ParseWithClaims(r.Auth.Key, &kitekey.KiteClaims{}, r.LocalKite.RSAKey)
-
-	if e, ok := err.(*jwt.ValidationError); ok {
-		// Translate public key mismatch errors to token-is-expired one.
-		// This is to signal remote client the key pairs have been
-		// updated on kontrol and it should invalidate all tokens.
-		if (e.Errors & jwt.ValidationErrorSignatureInvalid) != 0 {
-			return errors.New("token is expired")
-		}
-	}
-
+	claims, err := k.ValidateToken(r.Auth.Key)
 	if err != nil {
 		return err
 	}
 
-	if !token.Valid {
-		return errors.New("Invalid signature in token")
-	}
-
-	claims, ok := token.Claims.(*kitekey.KiteClaims)
-	if !ok {
-		return errors.New("token does not have valid claims")
-	}
-
-	if claims.Audience == "" {
-		return errors.New("token has no audience")
-	}
-
-	if claims.Subject == "" {
-		return errors.New("token has no username")
-	}
-
-	// check if we have an audience and it matches our own signature
-	if err := k.verifyAudienceFunc(k.Kite(), claims.Audience); err != nil {
-		return err
-	}
-
-	// We don't check for exp and nbf claims here because jwt-go package
-	// already checks them.
-
 	// replace the requester username so we reflect the validated
 	r.Username = claims.Subject
+	r.Actor = claims.Actor
+
+	if claims.Tenant != "" {
+		r.Tenant = claims.Tenant
+	}
 
 	return nil
 }
 
-// AuthenticateFromKiteKey authenticates user from kite key.
+// AuthenticateFromKiteKey authenticates user from kite key. The callers are
+// checked with the KiteKeyPolicy, if it is set.
 func (k *Kite) AuthenticateFromKiteKey(r *Request) error {
 	claims := &kitekey.KiteClaims{}
 
@@ -288,8 +511,18 @@ func (k *Kite) AuthenticateFromKiteKey(r *Request) error {
 		return errors.New("token has no username")
 	}
 
+	if k.KiteKeyPolicy != nil {
+		if err := k.KiteKeyPolicy(r, claims); err != nil {
+			return err
+		}
+	}
+
 	r.Username = claims.Subject
 
+	if claims.Tenant != "" {
+		r.Tenant = claims.Tenant
+	}
+
 	return nil
 }
 
@@ -410,6 +643,12 @@ func (k *Kite) verify(token *jwt.Token) (interface{}, error) {
 }
 
 func (k *Kite) verifyAudience(kite *protocol.Kite, audience string) error {
+	return VerifyAudience(kite, audience)
+}
+
+// VerifyAudience returns a non-nil error if the given token audience does
+// not allow access to the kite.
+func VerifyAudience(kite *protocol.Kite, audience string) error {
 	switch audience {
 	case "/":
 		// The root audience is like superuser - it has access to everything.
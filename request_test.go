@@ -0,0 +1,45 @@
+package kite
+
+import (
+	"testing"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+)
+
+func TestClient_RunMethodPanic(t *testing.T) {
+	conf := config.New()
+	conf.DisableAuthentication = true
+
+	k := NewWithConfig("testkite", "0.0.1", conf)
+	defer k.Close()
+
+	k.HandleFunc("boom", func(r *Request) (interface{}, error) {
+		panic("boom")
+	})
+
+	c := k.NewClient("")
+
+	cases := []struct {
+		args string
+		typ  string
+		msg  string
+	}{
+		{`[{"withArgs":[]}]`, "genericError", "boom"},
+		{`[1]`, "argumentError", ""},
+	}
+
+	for _, cas := range cases {
+		var resp *Response
+
+		c.runMethod(k.handlers["boom"], &dnode.Partial{Raw: []byte(cas.args)}, func(r *Response) { resp = r })
+
+		if resp == nil || resp.Error == nil {
+			t.Fatalf("%s: want error response, got %+v", cas.args, resp)
+		}
+
+		if resp.Error.Type != cas.typ || (cas.msg != "" && resp.Error.Message != cas.msg) {
+			t.Fatalf("%s: got %s", cas.args, resp.Error)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package kite
+
+import (
+	"context"
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+// RetryPolicy retries the calls of idempotent methods, which failed with
+// errors that may go away, like timeouts or the remote kite being
+// overloaded. It is an interceptor of the calls:
+//
+//     p := &kite.RetryPolicy{
+//         MaxAttempts: 5,
+//         Methods:     []string{"user.get", "user.list"},
+//     }
+//     c.Intercept(p.Intercept)
+//
+//     // Calls of other methods are retried when marked as idempotent.
+//     ctx := kite.WithIdempotent(context.Background())
+//     result, err := c.TellWithContext(ctx, "user.setName", "alice")
+//
+// The calls of the other methods are never retried, as the failed call may
+// have been handled by the remote kite anyway, e.g. before its reply
+// timed out.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts to make the call,
+	// including the first one.
+	//
+	// When 0, the default value of 3 is used.
+	MaxAttempts int
+
+	// InitialInterval is the delay before the first retry.
+	//
+	// When 0, the default value of 100ms is used.
+	InitialInterval time.Duration
+
+	// MaxInterval caps the delay between retries.
+	//
+	// When 0, the default value of 5s is used.
+	MaxInterval time.Duration
+
+	// Multiplier is the factor the delay grows by after every retry.
+	//
+	// When 0, the default value of 2 is used.
+	Multiplier float64
+
+	// Methods are the idempotent methods, the calls of which are retried.
+	Methods []string
+
+	// RetryOn tells whether the call which failed with the error should
+	// be retried.
+	//
+	// If nil, the calls failed with the errors of the "timeout",
+	// "sendError", "disconnect", "overloadedError", "shutdownError",
+	// "rateLimitError" and "requestLimitError" types are retried.
+	RetryOn func(err error) bool
+}
+
+// retryable are the types of the errors, which are retried by default.
+var retryable = map[string]bool{
+	"timeout":           true,
+	"sendError":         true,
+	"disconnect":        true,
+	"overloadedError":   true,
+	"shutdownError":     true,
+	"rateLimitError":    true,
+	"requestLimitError": true,
+}
+
+func isRetryable(err error) bool {
+	e, ok := err.(*Error)
+	return ok && retryable[e.Type]
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent returns a copy of ctx that marks the calls made with
+// Client.TellWithContext as idempotent, so they are retried by
+// the RetryPolicy interceptors.
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func idempotentFromContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+
+	idempotent, _ := ctx.Value(idempotentKey{}).(bool)
+	return idempotent
+}
+
+// Intercept makes the call and retries it when it fails, if the call is
+// idempotent. It's meant to be added with Client.Intercept or
+// Kite.Intercept.
+//
+// The delays between the attempts grow exponentially, unless the error
+// tells when to retry, see Error.RetryAfter. The retries stop when
+// the context of the call is done.
+func (p *RetryPolicy) Intercept(call *Call, next Invoker) (*Result, error) {
+	res, err := next(call)
+	if err == nil || !p.idempotent(call) {
+		return res, err
+	}
+
+	retryOn := p.RetryOn
+	if retryOn == nil {
+		retryOn = isRetryable
+	}
+
+	ctx := call.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	b := p.backOff()
+
+	for attempt := 1; attempt < p.maxAttempts() && retryOn(err); attempt++ {
+		wait := b.NextBackOff()
+
+		if e, ok := err.(*Error); ok && e.RetryAfter > wait {
+			wait = e.RetryAfter
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			break
+		}
+
+		t := time.NewTimer(wait)
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return res, err
+		}
+
+		res, err = next(call)
+		if err == nil {
+			break
+		}
+	}
+
+	return res, err
+}
+
+func (p *RetryPolicy) idempotent(call *Call) bool {
+	if idempotentFromContext(call.Context) {
+		return true
+	}
+
+	for _, method := range p.Methods {
+		if method == call.Method {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts > 0 {
+		return p.MaxAttempts
+	}
+
+	return 3
+}
+
+// backOff returns a new BackOff following the policy.
+func (p *RetryPolicy) backOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = 0 // stopped by MaxAttempts only
+	b.InitialInterval = 100 * time.Millisecond
+	b.MaxInterval = 5 * time.Second
+	b.Multiplier = 2
+
+	if p.InitialInterval > 0 {
+		b.InitialInterval = p.InitialInterval
+	}
+
+	if p.MaxInterval > 0 {
+		b.MaxInterval = p.MaxInterval
+	}
+
+	if p.Multiplier > 0 {
+		b.Multiplier = p.Multiplier
+	}
+
+	b.Reset()
+
+	return b
+}
@@ -0,0 +1,87 @@
+package kite
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	p := &RetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: time.Millisecond,
+		Methods:         []string{"get"},
+	}
+
+	cases := []struct {
+		call  *Call
+		errs  []error
+		calls int
+		ok    bool
+	}{{ // idempotent method succeeds on the second attempt
+		call:  &Call{Method: "get"},
+		errs:  []error{&Error{Type: "timeout"}, nil},
+		calls: 2,
+		ok:    true,
+	}, { // attempts are exhausted
+		call:  &Call{Method: "get"},
+		errs:  []error{&Error{Type: "disconnect"}, &Error{Type: "timeout"}, &Error{Type: "timeout"}, nil},
+		calls: 3,
+	}, { // non-idempotent method is not retried
+		call:  &Call{Method: "set"},
+		errs:  []error{&Error{Type: "timeout"}, nil},
+		calls: 1,
+	}, { // call marked as idempotent is retried
+		call:  &Call{Method: "set", Context: WithIdempotent(context.Background())},
+		errs:  []error{&Error{Type: "sendError"}, nil},
+		calls: 2,
+		ok:    true,
+	}, { // errors of the handlers are not retried
+		call:  &Call{Method: "get"},
+		errs:  []error{&Error{Type: "genericError"}, nil},
+		calls: 1,
+	}}
+
+	for i, cas := range cases {
+		calls := 0
+
+		_, err := p.Intercept(cas.call, func(*Call) (*Result, error) {
+			err := cas.errs[calls]
+			calls++
+			return &Result{}, err
+		})
+
+		if calls != cas.calls {
+			t.Errorf("%d: got %d calls, want %d", i, calls, cas.calls)
+		}
+
+		if (err == nil) != cas.ok {
+			t.Errorf("%d: got err=%v, want ok=%t", i, err, cas.ok)
+		}
+	}
+}
+
+func TestRetryPolicy_RetryAfter(t *testing.T) {
+	p := &RetryPolicy{
+		InitialInterval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(WithIdempotent(context.Background()), 50*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+
+	_, err := p.Intercept(&Call{Context: ctx}, func(*Call) (*Result, error) {
+		calls++
+		return nil, &Error{Type: "rateLimitError", RetryAfter: time.Second}
+	})
+
+	if e, ok := err.(*Error); !ok || e.Type != "rateLimitError" {
+		t.Fatalf("got %v, want rateLimitError", err)
+	}
+
+	// The retry after the deadline of the call is not made.
+	if calls != 1 {
+		t.Fatalf("got %d calls, want 1", calls)
+	}
+}
@@ -0,0 +1,177 @@
+package reverseproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
+)
+
+// DefaultHandoffTimeout is the default value of Proxy.HandoffTimeout.
+var DefaultHandoffTimeout = time.Minute
+
+// session is a registration of a kite.
+type session struct {
+	protocol.ProxySession
+
+	// client is the connection of the registered kite, it is nil for
+	// the sessions handed off by another proxy, until the kite connects.
+	client *kite.Client
+
+	// expire drops the handed off session if the kite does not connect.
+	expire *time.Timer
+}
+
+// Handoff hands the registrations of the kites off to the proxy kite at
+// the given URL, e.g. when the proxy is removed during scale-in. The other
+// proxy serves the kites right away, and the kites are told to connect to
+// it, so they do not have to find a proxy and register from scratch
+// after this proxy is closed.
+//
+// The other proxy must be run by the same user. With the same public host,
+// the proxy URLs of the kites do not change, so the clients reconnecting
+// through the load balancer find their kites at the other proxy.
+func (p *Proxy) Handoff(proxyURL string) error {
+	var args protocol.ProxyHandoffArgs
+
+	clients := make(map[string]*kite.Client)
+
+	p.kitesMu.Lock()
+	for id, s := range p.sessions {
+		args.Sessions = append(args.Sessions, s.ProxySession)
+
+		if s.client != nil {
+			clients[id] = s.client
+		}
+	}
+	p.kitesMu.Unlock()
+
+	peer := p.Kite.NewClient(proxyURL)
+	peer.Auth = &kite.Auth{
+		Type: "kiteKey",
+		Key:  p.Kite.KiteKey(),
+	}
+
+	if err := peer.Dial(); err != nil {
+		return err
+	}
+	defer peer.Close()
+
+	result, err := peer.TellWithTimeout("handoff", p.Kite.Config.Timeout, &args)
+	if err != nil {
+		return err
+	}
+
+	var res protocol.ProxyHandoffResult
+
+	if err := result.Unmarshal(&res); err != nil {
+		return err
+	}
+
+	for id, c := range clients {
+		u, ok := res.URLs[id]
+		if !ok {
+			continue
+		}
+
+		_, err := c.TellWithTimeout("kite.proxyHandoff", p.Kite.Config.Timeout, &protocol.ProxyHandoff{
+			ProxyURL: proxyURL,
+			URL:      u,
+		})
+		if err != nil {
+			p.Kite.Log.Warning("[%s] Cannot hand off kite to %s: %s", id, proxyURL, err)
+		}
+	}
+
+	p.Kite.Log.Info("Handed off %d kites to %s", len(res.URLs), proxyURL)
+
+	return nil
+}
+
+// handleHandoff takes over the registrations of the kites from another
+// proxy kite of the same user, see Handoff.
+func (p *Proxy) handleHandoff(r *kite.Request) (interface{}, error) {
+	if r.Username != p.Kite.Config.Username {
+		return nil, fmt.Errorf("%q is not allowed to hand off kites", r.Username)
+	}
+
+	if r.Args == nil {
+		return nil, errors.New("empty arguments")
+	}
+
+	var args protocol.ProxyHandoffArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	res := &protocol.ProxyHandoffResult{
+		URLs: make(map[string]string, len(args.Sessions)),
+	}
+
+	p.kitesMu.Lock()
+	defer p.kitesMu.Unlock()
+
+	for _, ps := range args.Sessions {
+		id := ps.Kite.ID
+
+		kiteURL, err := url.Parse(ps.URL)
+		if err != nil || id == "" {
+			p.Kite.Log.Warning("[%s] Invalid handed off kite with url: '%s'", id, ps.URL)
+			continue
+		}
+
+		// The kite might have connected already.
+		if s, ok := p.sessions[id]; ok && s.client != nil {
+			res.URLs[id] = p.proxyURL(id)
+			continue
+		}
+
+		s := &session{ProxySession: ps}
+		s.expire = time.AfterFunc(p.handoffTimeout(), func() {
+			p.expireSession(id, s)
+		})
+
+		p.dropSession(id)
+		p.kites[id] = *kiteURL
+		p.sessions[id] = s
+
+		res.URLs[id] = p.proxyURL(id)
+	}
+
+	p.Kite.Log.Info("Took over %d kites handed off by %s", len(res.URLs), r.Client.Kite)
+
+	return res, nil
+}
+
+// expireSession drops the handed off session, if its kite did not connect.
+func (p *Proxy) expireSession(id string, s *session) {
+	p.kitesMu.Lock()
+	defer p.kitesMu.Unlock()
+
+	if p.sessions[id] == s && s.client == nil {
+		p.Kite.Log.Info("[%s] Handed off kite did not connect, removing it from proxy", id)
+		p.dropSession(id)
+	}
+}
+
+// dropSession removes the registration of the kite, kitesMu must be held.
+func (p *Proxy) dropSession(id string) {
+	if s, ok := p.sessions[id]; ok && s.expire != nil {
+		s.expire.Stop()
+	}
+
+	delete(p.sessions, id)
+	delete(p.kites, id)
+}
+
+func (p *Proxy) handoffTimeout() time.Duration {
+	if p.HandoffTimeout > 0 {
+		return p.HandoffTimeout
+	}
+
+	return DefaultHandoffTimeout
+}
@@ -0,0 +1,86 @@
+package reverseproxy
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/protocol"
+)
+
+func TestProxy_HandleHandoff(t *testing.T) {
+	conf := config.New()
+	conf.Username = "proxyuser"
+
+	p := New(conf)
+	p.Scheme = "http"
+	p.PublicHost = "localhost"
+	p.PublicPort = 4999
+	p.HandoffTimeout = 50 * time.Millisecond
+	defer p.Kite.Close()
+
+	request := func(username string, id string, arg interface{}) *kite.Request {
+		raw, err := json.Marshal([]interface{}{arg})
+		if err != nil {
+			t.Fatalf("Marshal()=%s", err)
+		}
+
+		c := p.Kite.NewClient("")
+		c.Kite = protocol.Kite{ID: id, Username: username}
+
+		return &kite.Request{
+			Username:  username,
+			Args:      &dnode.Partial{Raw: raw},
+			Client:    c,
+			LocalKite: p.Kite,
+		}
+	}
+
+	args := &protocol.ProxyHandoffArgs{
+		Sessions: []protocol.ProxySession{
+			{Kite: protocol.Kite{ID: "kite1"}, URL: "http://10.0.0.1:3000/kite", Username: "alice"},
+			{Kite: protocol.Kite{ID: "kite2"}, URL: "http://10.0.0.2:3000/kite", Username: "bob"},
+		},
+	}
+
+	if _, err := p.handleHandoff(request("alice", "other", args)); err == nil {
+		t.Fatal("expected handoff of other user to be rejected")
+	}
+
+	result, err := p.handleHandoff(request("proxyuser", "proxy2", args))
+	if err != nil {
+		t.Fatalf("handleHandoff()=%s", err)
+	}
+
+	res := result.(*protocol.ProxyHandoffResult)
+
+	if got, want := res.URLs["kite1"], "http://localhost:4999/proxy/kite1"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	if _, err := p.handleRegister(request("mallory", "kite1", "http://10.0.0.3:3000/kite")); err == nil {
+		t.Fatal("expected handed off kite of other user to be rejected")
+	}
+
+	if _, err := p.handleRegister(request("alice", "kite1", "http://10.0.0.1:3000/kite")); err != nil {
+		t.Fatalf("handleRegister()=%s", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	p.kitesMu.Lock()
+	_, ok1 := p.kites["kite1"]
+	_, ok2 := p.kites["kite2"]
+	p.kitesMu.Unlock()
+
+	if !ok1 {
+		t.Fatal("expected registered kite to be kept")
+	}
+
+	if ok2 {
+		t.Fatal("expected handed off kite, which did not connect, to be removed")
+	}
+}
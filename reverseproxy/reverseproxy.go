@@ -2,6 +2,7 @@ package reverseproxy
 
 import (
 	"crypto/tls"
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/httputil"
@@ -10,10 +11,12 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/koding/kite"
 	"github.com/koding/kite/config"
+	"github.com/koding/kite/protocol"
 	"github.com/koding/websocketproxy"
 )
 
@@ -32,8 +35,9 @@ type Proxy struct {
 	closeC chan bool // To signal when kite is closed with Close()
 
 	// Holds registered kites. Keys are kite IDs.
-	kites   map[string]url.URL
-	kitesMu sync.Mutex
+	kites    map[string]url.URL
+	sessions map[string]*session
+	kitesMu  sync.Mutex
 
 	// muxer for proxy
 	mux            *http.ServeMux
@@ -44,6 +48,11 @@ type Proxy struct {
 	Scheme     string
 	PublicHost string // If given it must match the domain in certificate.
 	PublicPort int    // Uses for registering and defining the public port.
+
+	// HandoffTimeout is how long the kites handed off by another proxy
+	// are served before they connect, see Handoff. When 0,
+	// DefaultHandoffTimeout is used.
+	HandoffTimeout time.Duration
 }
 
 func New(conf *config.Config) *Proxy {
@@ -51,17 +60,22 @@ func New(conf *config.Config) *Proxy {
 	k.Config = conf
 
 	p := &Proxy{
-		Kite:   k,
-		kites:  make(map[string]url.URL),
-		readyC: make(chan bool),
-		closeC: make(chan bool),
-		mux:    http.NewServeMux(),
+		Kite:     k,
+		kites:    make(map[string]url.URL),
+		sessions: make(map[string]*session),
+		readyC:   make(chan bool),
+		closeC:   make(chan bool),
+		mux:      http.NewServeMux(),
 	}
 
 	// third part kites are going to use this to register themself to
 	// proxy-kite and get a proxy url, which they use for register to kontrol.
 	p.Kite.HandleFunc("register", p.handleRegister)
 
+	// other proxy kites hand their registered kites off with this, see
+	// Handoff.
+	p.Kite.HandleFunc("handoff", p.handleHandoff)
+
 	// create our websocketproxy http.handler
 
 	p.websocketProxy = &websocketproxy.WebsocketProxy{
@@ -85,8 +99,16 @@ func New(conf *config.Config) *Proxy {
 
 	// OnDisconnect is called whenever a kite is disconnected from us.
 	k.OnDisconnect(func(r *kite.Client) {
+		p.kitesMu.Lock()
+		defer p.kitesMu.Unlock()
+
+		// the kite may have registered again with another connection
+		if s, ok := p.sessions[r.Kite.ID]; ok && s.client != r {
+			return
+		}
+
 		k.Log.Info("Removing kite Id '%s' from proxy. It's disconnected", r.Kite.ID)
-		delete(p.kites, r.Kite.ID)
+		p.dropSession(r.Kite.ID)
 	})
 
 	return p
@@ -128,18 +150,41 @@ func (p *Proxy) handleRegister(r *kite.Request) (interface{}, error) {
 		return nil, err
 	}
 
+	p.kitesMu.Lock()
+	defer p.kitesMu.Unlock()
+
+	// only the owner of a handed off kite can take it over
+	if s, ok := p.sessions[r.Client.ID]; ok && s.Username != r.Username {
+		return nil, fmt.Errorf("kite %q is registered by another user", r.Client.ID)
+	}
+
+	p.dropSession(r.Client.ID)
+
 	p.kites[r.Client.ID] = *kiteUrl
+	p.sessions[r.Client.ID] = &session{
+		ProxySession: protocol.ProxySession{
+			Kite:     r.Client.Kite,
+			URL:      kiteUrl.String(),
+			Username: r.Username,
+		},
+		client: r.Client,
+	}
+
+	s := p.proxyURL(r.Client.ID)
+	p.Kite.Log.Info("Registering kite with url: '%s'. Can be reached now with: '%s'", kiteUrl, s)
+
+	return s, nil
+}
 
+// proxyURL returns the URL the kite with the given ID is reachable with.
+func (p *Proxy) proxyURL(id string) string {
 	proxyURL := url.URL{
 		Scheme: p.Scheme,
 		Host:   p.PublicHost + ":" + strconv.Itoa(p.PublicPort),
-		Path:   "/proxy/" + r.Client.ID,
+		Path:   "/proxy/" + id,
 	}
 
-	s := proxyURL.String()
-	p.Kite.Log.Info("Registering kite with url: '%s'. Can be reached now with: '%s'", kiteUrl, s)
-
-	return s, nil
+	return proxyURL.String()
 }
 
 func (p *Proxy) backend(req *http.Request) *url.URL {
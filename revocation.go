@@ -0,0 +1,169 @@
+package kite
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/protocol"
+)
+
+// revokedTokenTTL is how long the revocations of the tokens, which
+// expiration time is unknown, are kept.
+var revokedTokenTTL = 48 * time.Hour
+
+// revocations are the IDs of the revoked tokens, see RevokeTokens.
+type revocations struct {
+	mu  sync.RWMutex
+	ids map[string]time.Time // the time the revocation is kept until
+}
+
+func (r *revocations) add(tokens []protocol.RevokedToken, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ids == nil {
+		r.ids = make(map[string]time.Time)
+	}
+
+	// Revocations of the expired tokens are dropped while adding new ones,
+	// as the expired tokens are rejected anyway.
+	for id, until := range r.ids {
+		if now.After(until) {
+			delete(r.ids, id)
+		}
+	}
+
+	for _, tok := range tokens {
+		if tok.ID == "" {
+			continue
+		}
+
+		until := now.Add(revokedTokenTTL)
+		if tok.ExpiresAt != 0 {
+			until = time.Unix(tok.ExpiresAt, 0)
+		}
+
+		if now.After(until) {
+			continue
+		}
+
+		if prev, ok := r.ids[tok.ID]; !ok || until.After(prev) {
+			r.ids[tok.ID] = until
+		}
+	}
+}
+
+func (r *revocations) has(id string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.ids[id]
+	return ok
+}
+
+func (r *revocations) list(now time.Time) []protocol.RevokedToken {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tokens := make([]protocol.RevokedToken, 0, len(r.ids))
+	for id, until := range r.ids {
+		if !now.After(until) {
+			tokens = append(tokens, protocol.RevokedToken{ID: id, ExpiresAt: until.Unix()})
+		}
+	}
+
+	return tokens
+}
+
+// RevokeTokens revokes the tokens with the given IDs, the "jti" claims.
+// The revoked tokens are rejected by ValidateToken, and so by the "token"
+// authenticator, starting with the next request. The revocations are kept
+// until the tokens expire.
+//
+// The owner of the kite and Kontrol can revoke tokens remotely with
+// the kite.admin.revokeTokens method. The kite fetches the tokens revoked
+// at Kontrol every Config.RevocationSyncInterval, if it is set.
+func (k *Kite) RevokeTokens(tokens ...protocol.RevokedToken) {
+	k.revoked.add(tokens, time.Now().UTC())
+}
+
+// IsTokenRevoked tells whether the token with the given ID was revoked.
+func (k *Kite) IsTokenRevoked(id string) bool {
+	return k.revoked.has(id)
+}
+
+// RevokedTokens returns the tokens revoked with RevokeTokens, which have
+// not expired yet.
+func (k *Kite) RevokedTokens() []protocol.RevokedToken {
+	return k.revoked.list(time.Now().UTC())
+}
+
+// handleRevokeTokens revokes the given tokens, it can be called only by
+// the owner of the kite or by Kontrol.
+func (k *Kite) handleRevokeTokens(r *Request) (interface{}, error) {
+	if r.Username != k.Config.Username && (k.Config.KontrolUser == "" || r.Username != k.Config.KontrolUser) {
+		return nil, &Error{
+			Type:    "authenticationError",
+			Message: fmt.Sprintf("%q is not allowed to revoke tokens", r.Username),
+		}
+	}
+
+	if r.Args == nil {
+		return nil, errors.New("empty arguments")
+	}
+
+	var args protocol.RevokeTokensArgs
+
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	k.RevokeTokens(args.Tokens...)
+
+	k.Log.Info("%d tokens revoked by %q", len(args.Tokens), r.Username)
+
+	return nil, nil
+}
+
+// syncRevokedTokens fetches the tokens revoked at Kontrol periodically,
+// until the Kontrol client is closed.
+func (k *Kite) syncRevokedTokens(done <-chan struct{}) {
+	ticker := time.NewTicker(k.Config.RevocationSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.kontrol.readyConnected:
+		case <-done:
+			return
+		}
+
+		if err := k.fetchRevokedTokens(); err != nil {
+			k.Log.Warning("Cannot fetch revoked tokens from Kontrol: %s", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+func (k *Kite) fetchRevokedTokens() error {
+	result, err := k.kontrol.TellWithTimeout("getRevokedTokens", k.Config.Timeout)
+	if err != nil {
+		return err
+	}
+
+	var res protocol.RevokedTokensResult
+	if err := result.Unmarshal(&res); err != nil {
+		return err
+	}
+
+	k.RevokeTokens(res.Tokens...)
+
+	return nil
+}
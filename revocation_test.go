@@ -0,0 +1,88 @@
+package kite
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/dnode"
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/protocol"
+	"github.com/koding/kite/testkeys"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestKite_RevokeTokens(t *testing.T) {
+	conf := config.New()
+	conf.Username = "devrim"
+	conf.KontrolUser = "kontrol"
+	conf.KontrolKey = testkeys.Public
+
+	k := NewWithConfig("revoke", "0.0.1", conf)
+	defer k.Close()
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(testkeys.Private))
+	if err != nil {
+		t.Fatalf("ParseRSAPrivateKeyFromPEM()=%s", err)
+	}
+
+	token := func(id string) string {
+		claims := &kitekey.KiteClaims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    "kontrol",
+				Subject:   "alice",
+				Audience:  "/devrim",
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+				Id:        id,
+			},
+		}
+
+		s, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("SignedString()=%s", err)
+		}
+
+		return s
+	}
+
+	if _, err := k.ValidateToken(token("revoked")); err != nil {
+		t.Fatalf("ValidateToken()=%s", err)
+	}
+
+	p, err := json.Marshal([]interface{}{&protocol.RevokeTokensArgs{
+		Tokens: []protocol.RevokedToken{{ID: "revoked"}, {ID: "expired", ExpiresAt: time.Now().Add(-time.Minute).Unix()}},
+	}})
+	if err != nil {
+		t.Fatalf("Marshal()=%s", err)
+	}
+
+	r := &Request{
+		LocalKite: k,
+		Username:  "alice",
+		Args:      &dnode.Partial{Raw: p},
+	}
+
+	if _, err := k.handleRevokeTokens(r); err == nil {
+		t.Fatal("want other users to be refused")
+	}
+
+	r.Username = "kontrol"
+
+	if _, err := k.handleRevokeTokens(r); err != nil {
+		t.Fatalf("handleRevokeTokens()=%s", err)
+	}
+
+	if _, err := k.ValidateToken(token("revoked")); err == nil || err.Error() != "token is revoked" {
+		t.Fatalf("got %v, want the token to be revoked", err)
+	}
+
+	if _, err := k.ValidateToken(token("other")); err != nil {
+		t.Fatalf("ValidateToken()=%s", err)
+	}
+
+	if tokens := k.RevokedTokens(); len(tokens) != 1 || tokens[0].ID != "revoked" {
+		t.Fatalf("got %+v, want only the unexpired token", tokens)
+	}
+}
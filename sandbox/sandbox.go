@@ -0,0 +1,337 @@
+// Package sandbox runs commands on behalf of kite handlers, like the
+// exec-style handlers of agent kites, enforcing CPU time, memory and
+// wall-clock limits.
+//
+// A handler wrapped with Wrap gets the limits in its Request.Context and
+// starts the commands with Command:
+//
+//     limits := &sandbox.Limits{
+//         CPUTime:   10 * time.Second,
+//         Memory:    256 << 20,
+//         WallClock: time.Minute,
+//     }
+//
+//     k.Handle("exec", sandbox.Wrap(limits, kite.HandlerFunc(func(r *kite.Request) (interface{}, error) {
+//         out, err := sandbox.Command(r.Context, "make", "test").CombinedOutput()
+//         return string(out), err
+//     })))
+//
+// Violations are sent to the caller as *kite.Error values of
+// "limitExceeded" type, the violated limit is stored in its code.
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+)
+
+// Limit names, used as codes of the errors sent to the caller.
+const (
+	CPUTime   = "cpu"
+	Memory    = "memory"
+	WallClock = "wallclock"
+)
+
+// MemoryCheckInterval is the interval in which memory usage of the running
+// commands is checked.
+var MemoryCheckInterval = 100 * time.Millisecond
+
+// Limits describes the resources a request may use. Zero value of a field
+// means no limit.
+type Limits struct {
+	CPUTime   time.Duration // CPU time of a single command
+	Memory    uint64        // resident memory of a single command, in bytes
+	WallClock time.Duration // duration of the whole request
+}
+
+// LimitError is returned when a command or a request exceeds one of the
+// limits.
+type LimitError struct {
+	Limit string // CPUTime, Memory or WallClock
+	Value string // the value of the limit
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit of %s exceeded", e.Limit, e.Value)
+}
+
+type limitsKey struct{}
+
+// WithLimits returns a copy of ctx that carries the given limits. Commands
+// created with the returned context are run with the limits.
+func WithLimits(ctx context.Context, l *Limits) context.Context {
+	return context.WithValue(ctx, limitsKey{}, l)
+}
+
+// LimitsFromContext returns the limits carried by ctx, or nil if
+// there are none.
+func LimitsFromContext(ctx context.Context) *Limits {
+	if ctx == nil {
+		return nil
+	}
+
+	l, _ := ctx.Value(limitsKey{}).(*Limits)
+	return l
+}
+
+// Wrap returns a handler, which runs h with the given limits. The wall-clock
+// limit applies to the whole request, CPU time and memory limits apply to
+// every command started by h with Command. Once the wall-clock limit is
+// exceeded, the request context is canceled, which kills the running
+// commands, and the caller gets the error without waiting for h to return.
+func Wrap(l *Limits, h kite.Handler) kite.Handler {
+	return kite.HandlerFunc(func(r *kite.Request) (interface{}, error) {
+		ctx := r.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		ctx = WithLimits(ctx, l)
+
+		if l.WallClock > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, l.WallClock)
+			defer cancel()
+		}
+
+		r.Context = ctx
+
+		type result struct {
+			value interface{}
+			err   error
+			panic interface{}
+		}
+
+		done := make(chan result, 1)
+
+		go func() {
+			var res result
+
+			// Forward the panic, so it is handled by the kite the same
+			// way as panics of unwrapped handlers.
+			defer func() {
+				if v := recover(); v != nil {
+					res.panic = v
+				}
+
+				done <- res
+			}()
+
+			res.value, res.err = h.ServeKite(r)
+		}()
+
+		select {
+		case res := <-done:
+			if res.panic != nil {
+				panic(res.panic)
+			}
+
+			return res.value, toKiteError(res.err)
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, toKiteError(&LimitError{Limit: WallClock, Value: l.WallClock.String()})
+			}
+
+			return nil, ctx.Err()
+		}
+	})
+}
+
+func toKiteError(err error) error {
+	if e, ok := err.(*LimitError); ok {
+		return &kite.Error{
+			Type:    "limitExceeded",
+			Message: e.Error(),
+			CodeVal: e.Limit,
+		}
+	}
+
+	return err
+}
+
+// Cmd is a command run with the limits. It embeds *exec.Cmd, so it
+// can be configured the same way.
+type Cmd struct {
+	*exec.Cmd
+
+	ctx    context.Context
+	limits Limits
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	violation *LimitError
+}
+
+// Command returns a command, which runs with the limits carried by ctx.
+// The command is killed when the ctx is done.
+//
+// The wall-clock limit, if the ctx was not created by Wrap, limits
+// the command alone.
+func Command(ctx context.Context, name string, args ...string) *Cmd {
+	c := &Cmd{
+		ctx: ctx,
+	}
+
+	if l := LimitsFromContext(ctx); l != nil {
+		c.limits = *l
+	}
+
+	c.Cmd = command(&c.limits, name, args...)
+
+	return c
+}
+
+// Start starts the command and the watcher that enforces memory and
+// wall-clock limits.
+func (c *Cmd) Start() error {
+	if err := c.Cmd.Start(); err != nil {
+		return err
+	}
+
+	c.done = make(chan struct{})
+	c.wg.Add(1)
+
+	go c.watch()
+
+	return nil
+}
+
+// Wait waits for the command to exit. If the command exceeded any of the
+// limits, a *LimitError is returned.
+func (c *Cmd) Wait() error {
+	err := c.Cmd.Wait()
+
+	if c.done != nil {
+		close(c.done)
+		c.wg.Wait()
+	}
+
+	c.mu.Lock()
+	violation := c.violation
+	c.mu.Unlock()
+
+	if violation != nil {
+		return violation
+	}
+
+	if err != nil && c.limits.CPUTime > 0 && cpuExceeded(c.ProcessState, c.limits.CPUTime) {
+		return &LimitError{Limit: CPUTime, Value: c.limits.CPUTime.String()}
+	}
+
+	return err
+}
+
+// Run starts the command and waits for it to exit.
+func (c *Cmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+
+	return c.Wait()
+}
+
+// Output runs the command and returns its standard output.
+func (c *Cmd) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, fmt.Errorf("sandbox: Stdout already set")
+	}
+
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+
+	err := c.Run()
+
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the command and returns its combined standard
+// output and standard error.
+func (c *Cmd) CombinedOutput() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, fmt.Errorf("sandbox: Stdout already set")
+	}
+
+	if c.Stderr != nil {
+		return nil, fmt.Errorf("sandbox: Stderr already set")
+	}
+
+	var out bytes.Buffer
+	c.Stdout = &out
+	c.Stderr = &out
+
+	err := c.Run()
+
+	return out.Bytes(), err
+}
+
+func (c *Cmd) watch() {
+	defer c.wg.Done()
+
+	var wallClock <-chan time.Time
+	if c.limits.WallClock > 0 {
+		t := time.NewTimer(c.limits.WallClock)
+		defer t.Stop()
+
+		wallClock = t.C
+	}
+
+	var memory <-chan time.Time
+	if c.limits.Memory > 0 {
+		t := time.NewTicker(MemoryCheckInterval)
+		defer t.Stop()
+
+		memory = t.C
+	}
+
+	var ctxDone <-chan struct{}
+	if c.ctx != nil {
+		ctxDone = c.ctx.Done()
+	}
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-wallClock:
+			c.kill(&LimitError{Limit: WallClock, Value: c.limits.WallClock.String()})
+			return
+		case <-ctxDone:
+			var violation *LimitError
+
+			if c.ctx.Err() == context.DeadlineExceeded {
+				if l := LimitsFromContext(c.ctx); l != nil && l.WallClock > 0 {
+					violation = &LimitError{Limit: WallClock, Value: l.WallClock.String()}
+				}
+			}
+
+			c.kill(violation)
+			return
+		case <-memory:
+			used, err := residentMemory(c.Process.Pid)
+			if err != nil {
+				// The process may have just exited.
+				continue
+			}
+
+			if used > c.limits.Memory {
+				c.kill(&LimitError{Limit: Memory, Value: fmt.Sprintf("%d bytes", c.limits.Memory)})
+				return
+			}
+		}
+	}
+}
+
+func (c *Cmd) kill(violation *LimitError) {
+	c.mu.Lock()
+	c.violation = violation
+	c.mu.Unlock()
+
+	kill(c.Process)
+}
@@ -0,0 +1,22 @@
+package sandbox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// residentMemory gives the resident set size of the process, in bytes.
+func residentMemory(pid int) (uint64, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/statm", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	var size, resident uint64
+	if _, err := fmt.Sscan(string(data), &size, &resident); err != nil {
+		return 0, err
+	}
+
+	return resident * uint64(os.Getpagesize()), nil
+}
@@ -0,0 +1,24 @@
+// +build !linux,!windows
+
+package sandbox
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// residentMemory gives the resident set size of the process, in bytes.
+func residentMemory(pid int) (uint64, error) {
+	out, err := exec.Command("ps", "-o", "rss=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, err
+	}
+
+	kb, err := strconv.ParseUint(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return kb << 10, nil
+}
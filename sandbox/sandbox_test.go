@@ -0,0 +1,88 @@
+// +build !windows
+
+package sandbox
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+)
+
+func TestCommand_NoLimits(t *testing.T) {
+	out, err := Command(context.Background(), "echo", "hello").Output()
+	if err != nil {
+		t.Fatalf("Output()=%s", err)
+	}
+
+	if string(out) != "hello\n" {
+		t.Fatalf("want %q, got %q", "hello\n", out)
+	}
+}
+
+func TestCommand_WallClock(t *testing.T) {
+	ctx := WithLimits(context.Background(), &Limits{WallClock: 100 * time.Millisecond})
+
+	err := Command(ctx, "sleep", "10").Run()
+
+	e, ok := err.(*LimitError)
+	if !ok {
+		t.Fatalf("want *LimitError, got %T: %v", err, err)
+	}
+
+	if e.Limit != WallClock {
+		t.Fatalf("want %q limit, got %q", WallClock, e.Limit)
+	}
+}
+
+func TestCommand_CPUTime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+
+	ctx := WithLimits(context.Background(), &Limits{CPUTime: time.Second, WallClock: 30 * time.Second})
+
+	err := Command(ctx, "/bin/sh", "-c", "while :; do :; done").Run()
+
+	e, ok := err.(*LimitError)
+	if !ok {
+		t.Fatalf("want *LimitError, got %T: %v", err, err)
+	}
+
+	if e.Limit != CPUTime {
+		t.Fatalf("want %q limit, got %q", CPUTime, e.Limit)
+	}
+}
+
+func TestCommand_Memory(t *testing.T) {
+	ctx := WithLimits(context.Background(), &Limits{Memory: 1, WallClock: 30 * time.Second})
+
+	err := Command(ctx, "sleep", "10").Run()
+
+	e, ok := err.(*LimitError)
+	if !ok {
+		t.Fatalf("want *LimitError, got %T: %v", err, err)
+	}
+
+	if e.Limit != Memory {
+		t.Fatalf("want %q limit, got %q", Memory, e.Limit)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	h := Wrap(&Limits{WallClock: 100 * time.Millisecond}, kite.HandlerFunc(func(r *kite.Request) (interface{}, error) {
+		return nil, Command(r.Context, "sleep", "10").Run()
+	}))
+
+	_, err := h.ServeKite(&kite.Request{Context: context.Background()})
+
+	e, ok := err.(*kite.Error)
+	if !ok {
+		t.Fatalf("want *kite.Error, got %T: %v", err, err)
+	}
+
+	if e.Type != "limitExceeded" || e.Code() != WallClock {
+		t.Fatalf("want limitExceeded error with %q code, got %+v", WallClock, e)
+	}
+}
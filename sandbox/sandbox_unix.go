@@ -0,0 +1,61 @@
+// +build !windows
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// command limits the CPU time with setrlimit. As the limits can't be set
+// for a child process directly, the command is started by a shell, which
+// sets them for itself before exec'ing the command.
+func command(l *Limits, name string, args ...string) *exec.Cmd {
+	var cmd *exec.Cmd
+
+	if l.CPUTime > 0 {
+		// Round the limit up to full seconds, the resolution of ulimit.
+		secs := int64((l.CPUTime + time.Second - 1) / time.Second)
+
+		script := fmt.Sprintf(`ulimit -t %d && exec "$0" "$@"`, secs)
+		cmd = exec.Command("/bin/sh", append([]string{"-c", script, name}, args...)...)
+	} else {
+		cmd = exec.Command(name, args...)
+	}
+
+	// Run the command in its own process group, so the processes it starts
+	// are killed along with it.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	return cmd
+}
+
+// cpuExceeded tells whether the process was killed by the kernel due
+// to exceeding its CPU time limit.
+func cpuExceeded(ps *os.ProcessState, limit time.Duration) bool {
+	if ps == nil {
+		return false
+	}
+
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return false
+	}
+
+	if sig := ws.Signal(); sig != syscall.SIGXCPU && sig != syscall.SIGKILL {
+		return false
+	}
+
+	// The limit has second resolution, so allow for a half of a second.
+	return ps.UserTime()+ps.SystemTime() >= limit-time.Second/2
+}
+
+func kill(p *os.Process) {
+	// Kill the whole process group, falling back to the process alone.
+	if err := syscall.Kill(-p.Pid, syscall.SIGKILL); err != nil {
+		p.Kill()
+	}
+}
@@ -0,0 +1,26 @@
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// command does not limit the CPU time on Windows, neither is the memory
+// usage checked - only the wall-clock limit is enforced.
+func command(l *Limits, name string, args ...string) *exec.Cmd {
+	return exec.Command(name, args...)
+}
+
+func cpuExceeded(ps *os.ProcessState, limit time.Duration) bool {
+	return false
+}
+
+func residentMemory(pid int) (uint64, error) {
+	return 0, errors.New("sandbox: memory usage is not supported on windows")
+}
+
+func kill(p *os.Process) {
+	p.Kill()
+}
@@ -0,0 +1,500 @@
+// Package selfupdate implements updating of agent kites in place.
+//
+// The Updater checks a release endpoint for a newer version of the kite,
+// downloads the binary, verifies its signature, swaps it with the running
+// one and restarts the kite. The restarted kite takes over the listening
+// socket and the kite key of the old one, so the update is transparent to
+// the callers.
+//
+// Updates can be triggered remotely by registering the updater as a module:
+//
+//     u := &selfupdate.Updater{
+//         Kite:      k,
+//         Endpoint:  "https://releases.example.com/agent/latest.json",
+//         PublicKey: releasePublicKey,
+//     }
+//
+//     kite.RegisterModule("selfupdate", u.Module())
+//
+// The "kite.update" method of the module reports progress of the update to
+// the caller.
+package selfupdate
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/hashicorp/go-version"
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+// RestartDelay is the time the "kite.update" method waits after replying,
+// before it restarts the kite.
+var RestartDelay = time.Second
+
+// CheckTimeout is the time the updated binary is given to print its
+// version, before it's killed and the update fails.
+var CheckTimeout = 30 * time.Second
+
+// Update stages reported with Progress.
+const (
+	StageCheck    = "check"
+	StageDownload = "download"
+	StageVerify   = "verify"
+	StageSwap     = "swap"
+	StageRestart  = "restart"
+)
+
+// ErrUpToDate is returned by Install when there is no newer version.
+var ErrUpToDate = errors.New("selfupdate: kite is up to date")
+
+// Release describes a release of the kite, as returned by the release
+// endpoint.
+type Release struct {
+	Version string `json:"version"`
+	URL     string `json:"url"` // URL of the binary
+
+	// SHA256 is the hex-encoded SHA-256 checksum of the binary.
+	SHA256 string `json:"sha256"`
+
+	// Signature is the base64-encoded RSA PKCS#1 v1.5 signature of the
+	// SHA-256 checksum of the binary.
+	Signature string `json:"signature"`
+}
+
+// Progress describes the progress of an update.
+type Progress struct {
+	Stage   string `json:"stage"`
+	Version string `json:"version,omitempty"`
+
+	// Written and Total are the number of bytes downloaded so far and the
+	// size of the binary, in the download stage. Total is -1 when the size
+	// is unknown.
+	Written int64 `json:"written,omitempty"`
+	Total   int64 `json:"total,omitempty"`
+}
+
+// Updater updates the binary of a kite.
+type Updater struct {
+	// Kite is the kite to update. Required.
+	Kite *kite.Kite
+
+	// Endpoint is the URL, which responds with a JSON-encoded Release
+	// of the latest version. Required.
+	Endpoint string
+
+	// PublicKey is the PEM-encoded RSA public key, the releases are
+	// signed with. Required.
+	PublicKey string
+
+	// Executable is the path of the binary to update. By default it is
+	// the binary of the running process.
+	Executable string
+
+	// Client is used for fetching releases. If nil, http.DefaultClient
+	// is used.
+	Client *http.Client
+
+	// Authorize tells whether the caller of "kite.update" is allowed to
+	// update the kite. By default only the user the kite belongs to is.
+	Authorize func(r *kite.Request) error
+
+	// Restart starts the updated binary. By default the binary is started
+	// with the same arguments and environment, it takes over the listening
+	// socket and the kite key, and the kite is closed. Once Kite.Run
+	// returns, the main function of the old binary is expected to exit.
+	Restart func(exe string) error
+}
+
+// Check fetches the latest release and tells whether it is newer than
+// the version of the kite.
+func (u *Updater) Check() (*Release, bool, error) {
+	resp, err := u.client().Get(u.Endpoint)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("selfupdate: release endpoint responded with %s", resp.Status)
+	}
+
+	var rel Release
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return nil, false, fmt.Errorf("selfupdate: invalid release: %s", err)
+	}
+
+	latest, err := version.NewVersion(rel.Version)
+	if err != nil {
+		return nil, false, fmt.Errorf("selfupdate: invalid release version: %s", err)
+	}
+
+	current, err := version.NewVersion(u.Kite.Kite().Version)
+	if err != nil {
+		return nil, false, fmt.Errorf("selfupdate: invalid kite version: %s", err)
+	}
+
+	return &rel, latest.GreaterThan(current), nil
+}
+
+// Update installs the latest release and restarts the kite. It returns
+// ErrUpToDate if there is no newer release.
+func (u *Updater) Update(progress func(*Progress)) error {
+	rel, err := u.Install(progress)
+	if err != nil {
+		return err
+	}
+
+	return u.restart(rel, progress)
+}
+
+// Install downloads the latest release, verifies it and replaces the
+// binary of the kite with it. The previous binary is kept with ".old"
+// suffix. The kite is not restarted.
+func (u *Updater) Install(progress func(*Progress)) (*Release, error) {
+	if progress == nil {
+		progress = func(*Progress) {}
+	}
+
+	progress(&Progress{Stage: StageCheck})
+
+	rel, newer, err := u.Check()
+	if err != nil {
+		return nil, err
+	}
+
+	if !newer {
+		return nil, ErrUpToDate
+	}
+
+	exe, err := u.executable()
+	if err != nil {
+		return nil, err
+	}
+
+	// Download next to the binary, so it can be renamed over it.
+	f, err := ioutil.TempFile(filepath.Dir(exe), filepath.Base(exe)+".update")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	sum, err := u.download(rel, f, progress)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	progress(&Progress{Stage: StageVerify, Version: rel.Version})
+
+	if err := u.verify(rel, sum); err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(f.Name(), 0755); err != nil {
+		return nil, err
+	}
+
+	if err := checkVersion(f.Name(), rel.Version); err != nil {
+		return nil, err
+	}
+
+	progress(&Progress{Stage: StageSwap, Version: rel.Version})
+
+	// Renaming over an existing file fails on Windows.
+	if err := os.Remove(exe + ".old"); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := os.Rename(exe, exe+".old"); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(f.Name(), exe); err != nil {
+		// Bring the previous binary back.
+		os.Rename(exe+".old", exe)
+		return nil, err
+	}
+
+	u.Kite.Log.Info("Kite binary is updated to version %s", rel.Version)
+
+	return rel, nil
+}
+
+// Module returns a kite module, which registers the "kite.update" method.
+// The method accepts an optional object argument:
+//
+//     {
+//         "checkOnly": false,        // only check for a newer version
+//         "progress":  function(p) {} // called with Progress values
+//     }
+//
+// and replies with {"version": "1.2.3", "updated": true}. The kite is
+// restarted after the reply.
+func (u *Updater) Module() kite.Module {
+	return func(k *kite.Kite) error {
+		k.HandleFunc("kite.update", u.handleUpdate)
+		return nil
+	}
+}
+
+type updateArgs struct {
+	CheckOnly bool           `json:"checkOnly"`
+	Progress  dnode.Function `json:"progress"`
+}
+
+type updateResult struct {
+	Version string `json:"version"`
+	Updated bool   `json:"updated"`
+}
+
+func (u *Updater) handleUpdate(r *kite.Request) (interface{}, error) {
+	if err := u.authorize(r); err != nil {
+		return nil, err
+	}
+
+	var args updateArgs
+
+	if r.Args != nil {
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+	}
+
+	if args.CheckOnly {
+		rel, newer, err := u.Check()
+		if err != nil {
+			return nil, err
+		}
+
+		return &updateResult{Version: rel.Version, Updated: newer}, nil
+	}
+
+	progress := func(p *Progress) {
+		if !args.Progress.IsValid() {
+			return
+		}
+
+		if err := args.Progress.Call(p); err != nil {
+			r.LocalKite.Log.Debug("Sending update progress failed: %s", err)
+		}
+	}
+
+	rel, err := u.Install(progress)
+	if err == ErrUpToDate {
+		return &updateResult{Version: u.Kite.Kite().Version}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Restart after the reply is sent.
+	time.AfterFunc(RestartDelay, func() {
+		if err := u.restart(rel, progress); err != nil {
+			u.Kite.Log.Error("Restarting updated kite failed: %s", err)
+		}
+	})
+
+	return &updateResult{Version: rel.Version, Updated: true}, nil
+}
+
+func (u *Updater) authorize(r *kite.Request) error {
+	if u.Authorize != nil {
+		return u.Authorize(r)
+	}
+
+	if r.Username != u.Kite.Kite().Username {
+		return fmt.Errorf("selfupdate: %s is not allowed to update the kite", r.Username)
+	}
+
+	return nil
+}
+
+func (u *Updater) download(rel *Release, w io.Writer, progress func(*Progress)) ([]byte, error) {
+	resp, err := u.client().Get(rel.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("selfupdate: downloading %s failed: %s", rel.URL, resp.Status)
+	}
+
+	h := sha256.New()
+
+	pw := &progressWriter{
+		hash:     h,
+		progress: progress,
+		p: Progress{
+			Stage:   StageDownload,
+			Version: rel.Version,
+			Total:   resp.ContentLength,
+		},
+	}
+
+	if _, err := io.Copy(io.MultiWriter(w, pw), resp.Body); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+func (u *Updater) verify(rel *Release, sum []byte) error {
+	if !strings.EqualFold(hex.EncodeToString(sum), rel.SHA256) {
+		return errors.New("selfupdate: checksum mismatch")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(rel.Signature)
+	if err != nil {
+		return fmt.Errorf("selfupdate: invalid signature: %s", err)
+	}
+
+	pub, err := jwt.ParseRSAPublicKeyFromPEM([]byte(u.PublicKey))
+	if err != nil {
+		return fmt.Errorf("selfupdate: invalid public key: %s", err)
+	}
+
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum, sig); err != nil {
+		return errors.New("selfupdate: signature verification failed")
+	}
+
+	return nil
+}
+
+func (u *Updater) restart(rel *Release, progress func(*Progress)) error {
+	if progress != nil {
+		progress(&Progress{Stage: StageRestart, Version: rel.Version})
+	}
+
+	exe, err := u.executable()
+	if err != nil {
+		return err
+	}
+
+	if u.Restart != nil {
+		return u.Restart(exe)
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+
+	// Pass the kite key in memory, as it may have been updated by Kontrol
+	// since the kite was started.
+	if key := u.Kite.KiteKey(); key != "" {
+		cmd.Env = append(cmd.Env, "KITE_KEY="+key)
+	}
+
+	if f, err := u.Kite.ListenerFile(); err == nil {
+		defer f.Close()
+
+		// ExtraFiles start at file descriptor 3.
+		cmd.ExtraFiles = []*os.File{f}
+		cmd.Env = append(cmd.Env, "KITE_LISTENER_FD=3")
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	u.Kite.Log.Info("Started updated kite with pid %d, closing", cmd.Process.Pid)
+
+	u.Kite.Close()
+
+	return nil
+}
+
+func (u *Updater) executable() (string, error) {
+	if u.Executable != "" {
+		return u.Executable, nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.EvalSymlinks(exe)
+}
+
+func (u *Updater) client() *http.Client {
+	if u.Client != nil {
+		return u.Client
+	}
+
+	return http.DefaultClient
+}
+
+// checkVersion runs the downloaded binary with KITE_VERSION set, which
+// makes kites print their version and exit, to ensure the binary is runnable
+// and is of the expected version. The binary is killed after CheckTimeout.
+func checkVersion(exe, want string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), CheckTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, exe)
+	cmd.Env = append(os.Environ(), "KITE_VERSION=1")
+
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("selfupdate: updated binary did not print its version within %s", CheckTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("selfupdate: running the updated binary failed: %s", err)
+	}
+
+	if got := strings.TrimSpace(string(out)); got != want {
+		return fmt.Errorf("selfupdate: updated binary has version %q, want %q", got, want)
+	}
+
+	return nil
+}
+
+// progressWriter reports the download progress, every time another
+// percent, or megabyte if the size is unknown, is written.
+type progressWriter struct {
+	hash     hash.Hash
+	progress func(*Progress)
+	p        Progress
+	reported int64
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.hash.Write(p)
+	w.p.Written += int64(len(p))
+
+	step := int64(1 << 20)
+	if w.p.Total > 0 {
+		step = w.p.Total / 100
+	}
+
+	if w.p.Written-w.reported >= step || w.p.Written == w.p.Total {
+		w.reported = w.p.Written
+		cur := w.p
+		w.progress(&cur)
+	}
+
+	return len(p), nil
+}
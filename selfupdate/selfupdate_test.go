@@ -0,0 +1,220 @@
+// +build !windows
+
+package selfupdate
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/koding/kite"
+	"github.com/koding/kite/testkeys"
+)
+
+func script(version string) []byte {
+	return []byte("#!/bin/sh\necho " + version + "\n")
+}
+
+func sign(t *testing.T, private string, data []byte) (sum, sig string) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(private))
+	if err != nil {
+		t.Fatalf("ParseRSAPrivateKeyFromPEM()=%s", err)
+	}
+
+	h := sha256.Sum256(data)
+
+	p, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	if err != nil {
+		t.Fatalf("SignPKCS1v15()=%s", err)
+	}
+
+	return hex.EncodeToString(h[:]), base64.StdEncoding.EncodeToString(p)
+}
+
+type fixture struct {
+	updater   *Updater
+	exe       string
+	restarted string
+	close     func()
+}
+
+func newFixture(t *testing.T, private string) *fixture {
+	dir, err := ioutil.TempDir("", "selfupdate")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+
+	exe := filepath.Join(dir, "agent")
+
+	if err := ioutil.WriteFile(exe, script("1.0.0"), 0755); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	binary := script("1.1.0")
+	sum, sig := sign(t, private, binary)
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+
+	mux.HandleFunc("/latest.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&Release{
+			Version:   "1.1.0",
+			URL:       srv.URL + "/agent",
+			SHA256:    sum,
+			Signature: sig,
+		})
+	})
+
+	mux.HandleFunc("/agent", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	})
+
+	f := &fixture{
+		exe: exe,
+		close: func() {
+			srv.Close()
+			os.RemoveAll(dir)
+		},
+	}
+
+	f.updater = &Updater{
+		Kite:       kite.New("agent", "1.0.0"),
+		Endpoint:   srv.URL + "/latest.json",
+		PublicKey:  testkeys.Public,
+		Executable: exe,
+		Restart: func(exe string) error {
+			f.restarted = exe
+			return nil
+		},
+	}
+
+	return f
+}
+
+func TestUpdate(t *testing.T) {
+	f := newFixture(t, testkeys.Private)
+	defer f.close()
+
+	var stages []string
+
+	err := f.updater.Update(func(p *Progress) {
+		if n := len(stages); n == 0 || stages[n-1] != p.Stage {
+			stages = append(stages, p.Stage)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Update()=%s", err)
+	}
+
+	want := []string{StageCheck, StageDownload, StageVerify, StageSwap, StageRestart}
+
+	if len(stages) != len(want) {
+		t.Fatalf("want stages %v, got %v", want, stages)
+	}
+
+	for i := range want {
+		if stages[i] != want[i] {
+			t.Fatalf("want stages %v, got %v", want, stages)
+		}
+	}
+
+	if f.restarted != f.exe {
+		t.Fatalf("want %q to be restarted, got %q", f.exe, f.restarted)
+	}
+
+	if err := checkVersion(f.exe, "1.1.0"); err != nil {
+		t.Fatalf("checkVersion()=%s", err)
+	}
+
+	if err := checkVersion(f.exe+".old", "1.0.0"); err != nil {
+		t.Fatalf("checkVersion()=%s", err)
+	}
+}
+
+func TestUpdate_OldBinary(t *testing.T) {
+	f := newFixture(t, testkeys.Private)
+	defer f.close()
+
+	if err := ioutil.WriteFile(f.exe+".old", script("0.9.0"), 0755); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	if err := f.updater.Update(nil); err != nil {
+		t.Fatalf("Update()=%s", err)
+	}
+
+	if err := checkVersion(f.exe+".old", "1.0.0"); err != nil {
+		t.Fatalf("checkVersion()=%s", err)
+	}
+}
+
+func TestUpdate_UpToDate(t *testing.T) {
+	f := newFixture(t, testkeys.Private)
+	defer f.close()
+
+	f.updater.Kite = kite.New("agent", "1.1.0")
+
+	if err := f.updater.Update(nil); err != ErrUpToDate {
+		t.Fatalf("want ErrUpToDate, got %v", err)
+	}
+}
+
+func TestUpdate_InvalidSignature(t *testing.T) {
+	f := newFixture(t, testkeys.PrivateEvil)
+	defer f.close()
+
+	if err := f.updater.Update(nil); err == nil {
+		t.Fatal("expected update signed with another key to fail")
+	}
+
+	if f.restarted != "" {
+		t.Fatal("expected kite to not be restarted")
+	}
+
+	if err := checkVersion(f.exe, "1.0.0"); err != nil {
+		t.Fatalf("checkVersion()=%s", err)
+	}
+}
+
+func TestCheckVersion_Timeout(t *testing.T) {
+	defer func(timeout time.Duration) {
+		CheckTimeout = timeout
+	}(CheckTimeout)
+
+	CheckTimeout = 100 * time.Millisecond
+
+	f, err := ioutil.TempFile("", "selfupdate")
+	if err != nil {
+		t.Fatalf("TempFile()=%s", err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString("#!/bin/sh\nexec sleep 10\n")
+	f.Close()
+
+	if err := os.Chmod(f.Name(), 0755); err != nil {
+		t.Fatalf("Chmod()=%s", err)
+	}
+
+	start := time.Now()
+
+	if err := checkVersion(f.Name(), "1.1.0"); err == nil {
+		t.Fatal("expected hanging binary to fail the check")
+	}
+
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("check took %s, want the binary to be killed", d)
+	}
+}
@@ -3,6 +3,7 @@ package kite
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -11,6 +12,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+
+	"github.com/koding/kite/config"
+
+	"github.com/gorilla/websocket"
+	"github.com/igm/sockjs-go/sockjs"
 )
 
 // Run is a blocking method. It runs the kite server and then accepts requests
@@ -37,7 +43,8 @@ func (k *Kite) Run() {
 	}
 }
 
-// Close stops the server and the kontrol client instance.
+// Close stops the server and the kontrol client instance. The connected
+// kites are disconnected with the CloseShutdown reason.
 func (k *Kite) Close() {
 	k.Log.Info("Closing kite...")
 
@@ -52,6 +59,9 @@ func (k *Kite) Close() {
 		k.listener = nil
 	}
 
+	k.closeConnections(CloseShutdown)
+	k.stopVersions()
+
 	k.mu.Lock()
 	cache := k.verifyCache
 	k.mu.Unlock()
@@ -59,6 +69,10 @@ func (k *Kite) Close() {
 	if cache != nil {
 		cache.StopGC()
 	}
+
+	if k.tokens != nil {
+		k.tokens.close()
+	}
 }
 
 func (k *Kite) Addr() string {
@@ -69,17 +83,21 @@ func (k *Kite) Addr() string {
 // calls Serve to handle requests on incoming connectionk.
 func (k *Kite) listenAndServe() error {
 	// create a new one if there doesn't exist
-	l, err := net.Listen("tcp4", k.Addr())
+	l, err := k.listen()
 	if err != nil {
 		return err
 	}
 
 	k.Log.Info("New listening: %s", l.Addr())
 
+	k.tcp, _ = l.(*net.TCPListener)
+
+	if err := k.setupTLS(); err != nil {
+		l.Close()
+		return err
+	}
+
 	if k.TLSConfig != nil {
-		if k.TLSConfig.NextProtos == nil {
-			k.TLSConfig.NextProtos = []string{"http/1.1"}
-		}
 		l = tls.NewListener(l, k.TLSConfig)
 	}
 
@@ -94,6 +112,41 @@ func (k *Kite) listenAndServe() error {
 	return k.serve(k.listener, k)
 }
 
+// listen creates the listener of the kite server. If the kite was started
+// by a process, which passed its listening socket with KITE_LISTENER_FD
+// environment variable, e.g. when restarting after an update, the socket is
+// used instead so no connections are refused in the meantime.
+func (k *Kite) listen() (net.Listener, error) {
+	fd := os.Getenv("KITE_LISTENER_FD")
+	if fd == "" {
+		return net.Listen("tcp4", k.Addr())
+	}
+
+	// Do not pass the socket to the processes started by this one.
+	os.Unsetenv("KITE_LISTENER_FD")
+
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KITE_LISTENER_FD: %s", err)
+	}
+
+	f := os.NewFile(uintptr(n), "kite-listener")
+	defer f.Close()
+
+	return net.FileListener(f)
+}
+
+// ListenerFile returns a duplicate of the listening socket of the kite
+// server. It can be passed to a child process with KITE_LISTENER_FD
+// environment variable, so it takes over serving on the same address.
+func (k *Kite) ListenerFile() (*os.File, error) {
+	if k.tcp == nil {
+		return nil, errors.New("kite is not listening on a TCP socket")
+	}
+
+	return k.tcp.File()
+}
+
 func (k *Kite) serve(l net.Listener, h http.Handler) error {
 	if k.Config.Serve != nil {
 		return k.Config.Serve(l, h)
@@ -218,3 +271,29 @@ func (c *gracefulConn) Close() error {
 
 	return c.Conn.Close()
 }
+
+// sockjsOptions returns the options of the SockJS server of the kite,
+// the websocket connections negotiate compression if it is enabled,
+// see Config.Compression.
+func sockjsOptions(cfg *config.Config) sockjs.Options {
+	opts := *cfg.SockJS
+
+	if !cfg.Compression {
+		return opts
+	}
+
+	upgrader := &websocket.Upgrader{
+		// Origins are checked by the upgrade policy of the kite,
+		// see SetUpgradePolicy.
+		CheckOrigin: func(*http.Request) bool { return true },
+	}
+
+	if opts.WebsocketUpgrader != nil {
+		*upgrader = *opts.WebsocketUpgrader
+	}
+
+	upgrader.EnableCompression = true
+	opts.WebsocketUpgrader = upgrader
+
+	return opts
+}
@@ -0,0 +1,131 @@
+package kite
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// sharedClient is a connection to a kite which is shared between all the
+// callers of DialShared, that resolved to the same kite ID.
+type sharedClient struct {
+	client *Client
+	err    error
+	ready  chan struct{} // closed once dialing is finished
+}
+
+// DialShared dials the kite of the given client, which is usually one of the
+// clients returned by GetKites, and returns the connected client. If there
+// already is a connection to a kite with the same ID, the given client is
+// closed and the existing connection is returned instead.
+//
+// The returned client is reference counted - every caller of DialShared
+// must call Close on it exactly once, and the connection is closed when the
+// last one does.
+func (k *Kite) DialShared(c *Client, timeout time.Duration) (*Client, error) {
+	id := c.Kite.ID
+	if id == "" {
+		// Kites without an ID can't be told apart, so they are not shared.
+		if err := c.DialTimeout(timeout); err != nil {
+			return nil, err
+		}
+
+		return c, nil
+	}
+
+	k.sharedMu.Lock()
+
+	if s, ok := k.shared[id]; ok {
+		k.sharedMu.Unlock()
+
+		<-s.ready
+
+		k.sharedMu.Lock()
+		if s.err == nil && k.shared[id] == s && atomic.LoadInt32(&s.client.closed) == 0 {
+			s.client.refs++
+			k.sharedMu.Unlock()
+
+			if s.client != c {
+				c.Close()
+			}
+
+			return s.client, nil
+		}
+		k.sharedMu.Unlock()
+
+		// The shared connection has failed in the meantime, dial our own.
+		return k.DialShared(c, timeout)
+	}
+
+	if k.shared == nil {
+		k.shared = make(map[string]*sharedClient)
+	}
+
+	s := &sharedClient{ready: make(chan struct{})}
+	k.shared[id] = s
+	k.sharedMu.Unlock()
+
+	err := c.DialTimeout(timeout)
+
+	k.sharedMu.Lock()
+	if err != nil {
+		s.err = err
+		delete(k.shared, id)
+	} else {
+		s.client = c
+		c.sharedID = id
+		c.refs = 1
+	}
+	k.sharedMu.Unlock()
+
+	close(s.ready)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// A connection that is lost for good is not shared anymore, so new
+	// callers do not get a dead client.
+	c.OnDisconnect(func() {
+		if !c.reconnect() {
+			k.unshare(c)
+		}
+	})
+
+	return c, nil
+}
+
+// unshare removes the client from the shared connections.
+func (k *Kite) unshare(c *Client) {
+	k.sharedMu.Lock()
+	defer k.sharedMu.Unlock()
+
+	if s, ok := k.shared[c.sharedID]; ok && s.client == c {
+		delete(k.shared, c.sharedID)
+	}
+}
+
+// releaseShared drops a reference to a shared client. It returns false if
+// the client is still used by other callers and must not be closed yet.
+func (c *Client) releaseShared() bool {
+	k := c.LocalKite
+	if k == nil {
+		return true
+	}
+
+	k.sharedMu.Lock()
+	defer k.sharedMu.Unlock()
+
+	if c.sharedID == "" {
+		return true
+	}
+
+	if c.refs--; c.refs > 0 {
+		return false
+	}
+
+	if s, ok := k.shared[c.sharedID]; ok && s.client == c {
+		delete(k.shared, c.sharedID)
+	}
+
+	return true
+}
@@ -0,0 +1,107 @@
+package kite
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+
+	"github.com/igm/sockjs-go/sockjs"
+)
+
+func TestClient_ReleaseShared(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	c := k.NewClient("")
+	c.sharedID = "kite-id"
+	c.refs = 2
+
+	k.shared = map[string]*sharedClient{
+		"kite-id": {client: c, ready: make(chan struct{})},
+	}
+
+	c.Close()
+
+	if atomic.LoadInt32(&c.closed) != 0 {
+		t.Fatal("want client to stay open while it is still referenced")
+	}
+
+	if _, ok := k.shared["kite-id"]; !ok {
+		t.Fatal("want client to be still shared")
+	}
+
+	c.Close()
+
+	if atomic.LoadInt32(&c.closed) != 1 {
+		t.Fatal("want client to be closed after the last reference is released")
+	}
+
+	if _, ok := k.shared["kite-id"]; ok {
+		t.Fatal("want client not to be shared anymore")
+	}
+}
+
+func TestKite_DialShared(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	var mu sync.Mutex
+	var sessions []*testSession
+
+	transport := TransportFunc(func(url string, _ *config.Config) (sockjs.Session, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		s := newTestSession(url)
+		sessions = append(sessions, s)
+
+		return s, nil
+	})
+
+	newClient := func() *Client {
+		c := k.NewClient("http://fs/kite")
+		c.Kite.ID = "kite-id"
+		c.Transport = transport
+		c.DisablePinning = true // the session does not reply
+		return c
+	}
+
+	first, second := newClient(), newClient()
+
+	c1, err := k.DialShared(first, time.Second)
+	if err != nil {
+		t.Fatalf("DialShared()=%s", err)
+	}
+
+	c2, err := k.DialShared(second, time.Second)
+	if err != nil {
+		t.Fatalf("DialShared()=%s", err)
+	}
+
+	if c1 != first || c2 != first {
+		t.Fatal("want both callers to get the first client")
+	}
+
+	if atomic.LoadInt32(&second.closed) != 1 {
+		t.Fatal("want the client of the second caller to be closed")
+	}
+
+	if len(sessions) != 1 {
+		t.Fatalf("got %d connections, want 1", len(sessions))
+	}
+
+	c1.Close()
+
+	if sessions[0].isClosed() {
+		t.Fatal("want connection to stay open while it is still referenced")
+	}
+
+	c2.Close()
+
+	if !sessions[0].isClosed() {
+		t.Fatal("want connection to be closed after the last reference is released")
+	}
+}
@@ -0,0 +1,126 @@
+package kite
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// drainPollInterval is how often Shutdown checks for in-flight calls.
+var drainPollInterval = 50 * time.Millisecond
+
+// The priorities of the phases of Shutdown, see OnShutdown.
+const (
+	// ShutdownDeregister is the phase the kite is unregistered from
+	// Kontrol in, so it is not returned by GetKites anymore.
+	ShutdownDeregister = 100
+
+	// ShutdownStopAccepting is the phase the kite stops accepting new
+	// connections and method calls in.
+	ShutdownStopAccepting = 200
+
+	// ShutdownDrain is the phase the in-flight method calls are waited
+	// for in, after which the connections and the kite are closed.
+	ShutdownDrain = 300
+
+	// ShutdownCloseStorage is the phase for closing the storages, e.g.
+	// databases, once the kite does not handle method calls anymore.
+	ShutdownCloseStorage = 400
+)
+
+type shutdownHook struct {
+	priority int
+	fn       func(context.Context)
+}
+
+// OnShutdown registers a function to run when the kite is shut down with
+// Shutdown. The functions run in the order of their priorities, the ones
+// with the same priority in the order they were registered. The steps of
+// Shutdown itself run before the functions with the priority of their
+// phase, e.g. a function to flush the buffers of the handlers may be
+// registered with
+//
+//     k.OnShutdown(kite.ShutdownDrain, flush)
+//
+// and runs once the in-flight calls have finished. The ctx is the one
+// passed to Shutdown.
+func (k *Kite) OnShutdown(priority int, fn func(ctx context.Context)) {
+	k.handlersMu.Lock()
+	k.onShutdownHandlers = append(k.onShutdownHandlers, shutdownHook{priority: priority, fn: fn})
+	k.handlersMu.Unlock()
+}
+
+// Shutdown gracefully shuts the kite down. It unregisters the kite from
+// Kontrol, stops accepting new connections and method calls, which are
+// rejected with a "shutdownError" error, and waits for the in-flight
+// method calls to finish, until the ctx is done. Then it closes the
+// connections with CloseShutdown, so the clients know the kite is going
+// away, and closes the kite. The functions registered with OnShutdown run
+// in between, see the Shutdown* phases.
+//
+// Shutdown returns the error of the ctx if it was done before all the calls
+// have finished, the kite is closed anyway.
+func (k *Kite) Shutdown(ctx context.Context) error {
+	k.Log.Info("Shutting down kite...")
+
+	var err error
+
+	hooks := []shutdownHook{
+		{ShutdownDeregister, func(ctx context.Context) {
+			if k.kontrol.isRegistered() {
+				if err := k.unregister(ctx); err != nil {
+					k.Log.Warning("Unregistering from Kontrol failed: %s", err)
+				}
+			}
+		}},
+		{ShutdownStopAccepting, func(context.Context) {
+			atomic.StoreInt32(&k.draining, 1)
+		}},
+		{ShutdownDrain, func(ctx context.Context) {
+			err = k.drain(ctx)
+
+			k.closeConnections(CloseShutdown)
+			k.Close()
+		}},
+	}
+
+	k.handlersMu.RLock()
+	hooks = append(hooks, k.onShutdownHandlers...)
+	k.handlersMu.RUnlock()
+
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].priority < hooks[j].priority
+	})
+
+	for _, hook := range hooks {
+		func() {
+			defer nopRecover()
+			hook.fn(ctx)
+		}()
+	}
+
+	return err
+}
+
+// isDraining returns true if the kite is shutting down.
+func (k *Kite) isDraining() bool {
+	return atomic.LoadInt32(&k.draining) == 1
+}
+
+// drain waits until there are no in-flight method calls or the ctx is done.
+func (k *Kite) drain(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for atomic.LoadInt32(&k.inflight) > 0 {
+		select {
+		case <-ctx.Done():
+			k.Log.Warning("Shutting down with %d calls in flight: %s", atomic.LoadInt32(&k.inflight), ctx.Err())
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package kite
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKite_Shutdown(t *testing.T) {
+	k := New("shutdown", "0.0.1")
+
+	atomic.AddInt32(&k.inflight, 1)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- k.Shutdown(context.Background())
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown()=%v before the in-flight call finished", err)
+	case <-time.After(3 * drainPollInterval):
+	}
+
+	if !k.isDraining() {
+		t.Fatal("want the kite to be draining")
+	}
+
+	atomic.AddInt32(&k.inflight, -1)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Shutdown()=%s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Shutdown")
+	}
+}
+
+func TestKite_ShutdownTimeout(t *testing.T) {
+	k := New("shutdown", "0.0.1")
+
+	atomic.AddInt32(&k.inflight, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := k.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestKite_OnShutdown(t *testing.T) {
+	k := New("shutdown", "0.0.1")
+
+	var order []string
+
+	hook := func(name string) func(context.Context) {
+		return func(context.Context) {
+			order = append(order, name)
+		}
+	}
+
+	k.OnShutdown(ShutdownCloseStorage, hook("storage"))
+	k.OnShutdown(ShutdownDrain, hook("drain"))
+	k.OnShutdown(ShutdownStopAccepting-1, func(context.Context) {
+		if k.isDraining() {
+			t.Error("want the kite to accept calls before ShutdownStopAccepting")
+		}
+
+		order = append(order, "before stop")
+	})
+	k.OnShutdown(ShutdownStopAccepting, func(context.Context) {
+		if !k.isDraining() {
+			t.Error("want the kite to be draining after ShutdownStopAccepting")
+		}
+
+		order = append(order, "stop")
+	})
+	k.OnShutdown(ShutdownDrain, hook("drain 2"))
+	k.OnShutdown(ShutdownDeregister, func(context.Context) { panic("hook panics") })
+
+	if err := k.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown()=%s", err)
+	}
+
+	want := []string{"before stop", "stop", "drain", "drain 2", "storage"}
+
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("got %v, want %v", order, want)
+	}
+}
@@ -2,3 +2,9 @@ package sockjsclient
 
 // MakeWebsocketURL exports makeWebsocketURL for a test purposes.
 var MakeWebsocketURL = makeWebsocketURL
+
+// ParseCloseFrame exports parseCloseFrame for a test purposes.
+var ParseCloseFrame = parseCloseFrame
+
+// Compressed tells whether the session negotiated compression.
+func Compressed(w *WebsocketSession) bool { return w.compress }
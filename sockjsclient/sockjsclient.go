@@ -11,6 +11,7 @@ import (
 	"net/url"
 	"path"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -55,6 +56,28 @@ func (err *ErrSession) Error() string {
 	return fmt.Sprintf("%s: %s (%s)", stateTexts[err.State], err.Err, err.Type)
 }
 
+// CloseError is the code and reason the server closed the session with,
+// it is the Err of the *ErrSession returned by Recv.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+// Error implements the buildin error interface.
+func (err *CloseError) Error() string {
+	return fmt.Sprintf("closed by server: code=%d, reason=%q", err.Code, err.Reason)
+}
+
+// parseCloseFrame decodes the payload of the close frame.
+func parseCloseFrame(data []byte) *CloseError {
+	var e CloseError
+	var frame = []interface{}{&e.Code, &e.Reason}
+
+	_ = json.Unmarshal(data, &frame)
+
+	return &e
+}
+
 // IsSessionClosed tests whether given error is caused
 // by a closed session.
 func IsSessionClosed(err error) bool {
@@ -80,6 +103,11 @@ type WebsocketSession struct {
 	mu    sync.Mutex
 	conn  *websocket.Conn
 	state sockjs.SessionState
+
+	// compress is true if the connection negotiated the permessage-deflate
+	// extension, messages shorter than threshold are sent uncompressed
+	compress  bool
+	threshold int
 }
 
 var _ sockjs.Session = (*WebsocketSession)(nil)
@@ -148,13 +176,33 @@ func DialWebsocket(uri string, cfg *config.Config) (*WebsocketSession, error) {
 
 	u = makeWebsocketURL(u, serverID, sessionID)
 
-	conn, _, err := cfg.Websocket.Dial(u.String(), h)
+	dialer := cfg.Websocket
+	if cfg.Compression && !dialer.EnableCompression {
+		d := *dialer
+		d.EnableCompression = true
+		dialer = &d
+	}
+
+	conn, resp, err := dialer.Dial(u.String(), h)
 	if err != nil {
 		return nil, err
 	}
 
 	session := NewWebsocketSession(conn)
 	session.id = sessionID
+
+	if cfg.Compression && strings.Contains(resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate") {
+		if cfg.CompressionLevel != 0 {
+			if err := conn.SetCompressionLevel(cfg.CompressionLevel); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+
+		session.compress = true
+		session.threshold = cfg.CompressionThreshold
+	}
+
 	session.req = &http.Request{
 		URL:    u,
 		Header: h,
@@ -241,7 +289,11 @@ read_frame:
 		w.messages = append(w.messages, message)
 	case 'c':
 		w.setState(sockjs.SessionClosed)
-		return "", ErrSessionClosed
+		return "", &ErrSession{
+			Type:  config.WebSocket,
+			State: sockjs.SessionClosed,
+			Err:   parseCloseFrame(data),
+		}
 	case 'h':
 		// TODO handle heartbeat
 		goto read_frame
@@ -268,6 +320,11 @@ func (w *WebsocketSession) Send(str string) error {
 	defer w.mu.Unlock()
 
 	b, _ := json.Marshal([]string{str})
+
+	if w.compress {
+		w.conn.EnableWriteCompression(len(b) >= w.threshold)
+	}
+
 	return w.conn.WriteMessage(websocket.TextMessage, b)
 }
 
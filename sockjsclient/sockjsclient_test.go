@@ -1,10 +1,16 @@
 package sockjsclient_test
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
+	"github.com/koding/kite/config"
 	"github.com/koding/kite/sockjsclient"
+
+	"github.com/gorilla/websocket"
 )
 
 func TestMakeWebsocketURL(t *testing.T) {
@@ -27,3 +33,83 @@ func TestMakeWebsocketURL(t *testing.T) {
 		}
 	}
 }
+
+func TestParseCloseFrame(t *testing.T) {
+	cases := map[string]sockjsclient.CloseError{
+		`[4002,"kicked"]`: {Code: 4002, Reason: "kicked"},
+		`[3000]`:          {Code: 3000},
+		`malformed`:       {},
+	}
+
+	for cas, want := range cases {
+		got := sockjsclient.ParseCloseFrame([]byte(cas))
+
+		if *got != want {
+			t.Fatalf("%s: got %+v, want %+v", cas, got, want)
+		}
+	}
+}
+
+func TestDialWebsocket_Compression(t *testing.T) {
+	// echo is a minimal SockJS websocket server, which sends back
+	// the received messages.
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := &websocket.Upgrader{EnableCompression: true}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("o")); err != nil {
+			return
+		}
+
+		for {
+			_, p, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if err := conn.WriteMessage(websocket.TextMessage, append([]byte("a"), p...)); err != nil {
+				return
+			}
+		}
+	})
+
+	s := httptest.NewServer(echo)
+	defer s.Close()
+
+	for _, compression := range []bool{true, false} {
+		cfg := config.New()
+		cfg.Compression = compression
+		cfg.CompressionThreshold = 64
+
+		session, err := sockjsclient.DialWebsocket(s.URL+"/kite", cfg)
+		if err != nil {
+			t.Fatalf("DialWebsocket()=%s", err)
+		}
+
+		if got := sockjsclient.Compressed(session); got != compression {
+			t.Fatalf("got compressed=%t, want %t", got, compression)
+		}
+
+		for _, msg := range []string{"short", strings.Repeat(`{"large":true}`, 100)} {
+			if err := session.Send(msg); err != nil {
+				t.Fatalf("Send()=%s", err)
+			}
+
+			got, err := session.Recv()
+			if err != nil {
+				t.Fatalf("Recv()=%s", err)
+			}
+
+			if got != msg {
+				t.Fatalf("got %.40q, want %.40q", got, msg)
+			}
+		}
+
+		session.Close(0, "")
+	}
+}
@@ -242,18 +242,15 @@ func (x *XHRSession) handleResp(resp *http.Response) (msg string, again bool, er
 	case 'h':
 		return "", true, nil
 	case 'c':
-		var code int
-		var reason string
-		var frame = []interface{}{&code, &reason}
-
-		_ = json.NewDecoder(fr).Decode(&frame)
+		var data json.RawMessage
+		_ = json.NewDecoder(fr).Decode(&data)
 
 		x.setState(sockjs.SessionClosed)
 
 		return "", false, &ErrSession{
 			Type:  config.XHRPolling,
 			State: sockjs.SessionClosed,
-			Err:   fmt.Errorf("closed by server: code=%d, reason=%q", code, reason),
+			Err:   parseCloseFrame(data),
 		}
 	default:
 		return "", false, errors.New("invalid frame type")
@@ -0,0 +1,125 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/koding/kite/config"
+
+	"github.com/igm/sockjs-go/sockjs"
+)
+
+// The schemes of the URLs of the kites discovered with DNS SRV records,
+// see SRVTransport.
+const (
+	SRVScheme       = "srv"
+	SRVSecureScheme = "srvs"
+)
+
+func init() {
+	RegisterTransport(SRVScheme, &SRVTransport{Scheme: "http"})
+	RegisterTransport(SRVSecureScheme, &SRVTransport{Scheme: "https"})
+}
+
+// lookupSRV resolves the SRV records when SRVTransport.Resolver is nil.
+var lookupSRV = net.DefaultResolver.LookupSRV
+
+// SRVTransport dials kites with the endpoints resolved from DNS SRV records,
+// e.g. the ones of the Kubernetes headless services, instead of looking
+// them up in Kontrol. It's registered for the "srv" and "srvs" schemes, so
+// the clients of such kites are created with
+//
+//     c := k.NewClient("srv://_kite._tcp.fs.default.svc.cluster.local/kite")
+//
+// The host of the URL is the name of the records. The targets of the
+// records are dialed in the order of their priorities and weights, see
+// net.LookupSRV, until a connection is made, with the rest of the URL as
+// is. The "srvs" URLs are dialed with https.
+//
+// The records are resolved on every dial, so the client follows
+// the changes of the endpoints when it reconnects.
+type SRVTransport struct {
+	// Scheme is the scheme of the URLs of the targets, "http" if empty.
+	Scheme string
+
+	// Transport dials the targets. If nil, the transport of the URLs of
+	// the targets is used, see Transport.
+	Transport Transport
+
+	// Resolver resolves the records. If nil, net.DefaultResolver is used.
+	Resolver *net.Resolver
+}
+
+// Dial resolves the records and dials their targets.
+func (t *SRVTransport) Dial(rawurl string, conf *config.Config) (sockjs.Session, error) {
+	urls, err := t.Resolve(rawurl, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, target := range urls {
+		transport := t.Transport
+		if transport == nil {
+			if transport, err = transportFor(target, conf); err != nil {
+				return nil, err
+			}
+		}
+
+		var session sockjs.Session
+		if session, err = transport.Dial(target, conf); err == nil {
+			return session, nil
+		}
+	}
+
+	return nil, fmt.Errorf("kite: dialing %s: %s", rawurl, err)
+}
+
+// Resolve returns the URLs of the targets of the records for the URL, in
+// the order they are dialed.
+func (t *SRVTransport) Resolve(rawurl string, conf *config.Config) ([]string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if conf != nil && conf.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.Timeout)
+		defer cancel()
+	}
+
+	lookup := lookupSRV
+	if t.Resolver != nil {
+		lookup = t.Resolver.LookupSRV
+	}
+
+	_, addrs, err := lookup(ctx, "", "", u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("kite: no SRV records for %s", u.Hostname())
+	}
+
+	scheme := t.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	urls := make([]string, len(addrs))
+	for i, addr := range addrs {
+		target := *u
+		target.Scheme = scheme
+		target.Host = net.JoinHostPort(strings.TrimSuffix(addr.Target, "."), strconv.Itoa(int(addr.Port)))
+
+		urls[i] = target.String()
+	}
+
+	return urls, nil
+}
@@ -0,0 +1,78 @@
+package kite
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/koding/kite/config"
+
+	"github.com/igm/sockjs-go/sockjs"
+)
+
+func TestSRVTransport(t *testing.T) {
+	defer func(fn func(context.Context, string, string, string) (string, []*net.SRV, error)) {
+		lookupSRV = fn
+	}(lookupSRV)
+
+	lookupSRV = func(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		if name != "_kite._tcp.fs.example.com" {
+			return "", nil, &net.DNSError{Err: "no such host", Name: name}
+		}
+
+		return name, []*net.SRV{
+			{Target: "fs-0.example.com.", Port: 56789, Priority: 1},
+			{Target: "fs-1.example.com.", Port: 56790, Priority: 2},
+		}, nil
+	}
+
+	var dialed []string
+
+	tr := &SRVTransport{
+		Transport: TransportFunc(func(url string, _ *config.Config) (sockjs.Session, error) {
+			dialed = append(dialed, url)
+
+			if len(dialed) == 1 {
+				return nil, errors.New("connection refused")
+			}
+
+			return nil, nil
+		}),
+	}
+
+	if _, err := tr.Dial("srv://_kite._tcp.fs.example.com/kite", config.New()); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+
+	want := []string{
+		"http://fs-0.example.com:56789/kite",
+		"http://fs-1.example.com:56790/kite",
+	}
+
+	if !reflect.DeepEqual(dialed, want) {
+		t.Fatalf("got %v, want %v", dialed, want)
+	}
+
+	secure := &SRVTransport{Scheme: "https"}
+
+	urls, err := secure.Resolve("srvs://_kite._tcp.fs.example.com/kite", nil)
+	if err != nil {
+		t.Fatalf("Resolve()=%s", err)
+	}
+
+	if urls[0] != "https://fs-0.example.com:56789/kite" {
+		t.Fatalf("got %s, want https URL", urls[0])
+	}
+
+	if _, err := tr.Dial("srv://_kite._tcp.os.example.com/kite", config.New()); err == nil {
+		t.Fatal("Dial(): want error")
+	}
+
+	c := New("exp", "0.0.1").NewClient("srvs://_kite._tcp.fs.example.com/kite")
+
+	if transport, err := c.transport(); err != nil || transport.(*SRVTransport).Scheme != "https" {
+		t.Fatalf("got %v, %v, want SRV transport", transport, err)
+	}
+}
@@ -0,0 +1,232 @@
+// Package state provides a small embedded key/value store with transactions,
+// for agent kites that need to persist data like queued requests or their
+// configuration across restarts.
+//
+// The store is kept in an SQLite database. The package uses database/sql
+// and does not import an SQLite driver itself, as the drivers require cgo;
+// the program using the package must import one, e.g.:
+//
+//     import _ "github.com/mattn/go-sqlite3"
+//
+// Keys are grouped into buckets, so the subsystems of a kite sharing
+// a single store do not clash with each other.
+package state
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/koding/kite/kitekey"
+)
+
+// DriverName is the name of the database/sql driver used for opening
+// the store.
+var DriverName = "sqlite3"
+
+var (
+	// ErrNotFound is returned when the requested key does not exist.
+	ErrNotFound = errors.New("state: key not found")
+
+	// ErrReadOnly is returned when modifying the store within View.
+	ErrReadOnly = errors.New("state: transaction is read-only")
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS kv (
+	bucket TEXT NOT NULL,
+	key    TEXT NOT NULL,
+	value  BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+)`
+
+// Store is a key/value store backed by an SQLite database. It is safe for
+// concurrent use.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the store at the given path, creating it if it does not exist.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(DriverName, path)
+	if err != nil {
+		return nil, fmt.Errorf("state: opening %s failed: %s", path, err)
+	}
+
+	// SQLite allows a single writer only, serializing the connections
+	// avoids "database is locked" errors.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("state: opening %s failed: %s", path, err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// OpenDefault opens the store with the given name in the kite home
+// directory, i.e. $KITE_HOME/state/<name>.db.
+func OpenDefault(name string) (*Store, error) {
+	home, err := kitekey.KiteHome()
+	if err != nil {
+		return nil, err
+	}
+
+	return Open(filepath.Join(home, "state", name+".db"))
+}
+
+// Close closes the store.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Get returns the value of the key in the bucket. It returns ErrNotFound
+// if the key does not exist.
+func (s *Store) Get(bucket, key string) (value []byte, err error) {
+	err = s.View(func(tx *Tx) error {
+		value, err = tx.Get(bucket, key)
+		return err
+	})
+
+	return value, err
+}
+
+// Put sets the value of the key in the bucket.
+func (s *Store) Put(bucket, key string, value []byte) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.Put(bucket, key, value)
+	})
+}
+
+// Delete removes the key from the bucket. Deleting a key that does not
+// exist is not an error.
+func (s *Store) Delete(bucket, key string) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.Delete(bucket, key)
+	})
+}
+
+// Keys returns sorted keys of the bucket.
+func (s *Store) Keys(bucket string) (keys []string, err error) {
+	err = s.View(func(tx *Tx) error {
+		keys, err = tx.Keys(bucket)
+		return err
+	})
+
+	return keys, err
+}
+
+// View runs fn in a read-only transaction.
+func (s *Store) View(fn func(*Tx) error) error {
+	return s.run(fn, false)
+}
+
+// Update runs fn in a read-write transaction. The transaction is committed
+// if fn returns nil and rolled back otherwise.
+func (s *Store) Update(fn func(*Tx) error) error {
+	return s.run(fn, true)
+}
+
+func (s *Store) run(fn func(*Tx) error, writable bool) (err error) {
+	sqlTx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	tx := &Tx{tx: sqlTx, writable: writable}
+
+	defer func() {
+		if p := recover(); p != nil {
+			sqlTx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+
+	if !writable {
+		return sqlTx.Rollback()
+	}
+
+	return sqlTx.Commit()
+}
+
+// Tx is a transaction of the store, it is valid only within the function
+// passed to View or Update.
+type Tx struct {
+	tx       *sql.Tx
+	writable bool
+}
+
+// Get returns the value of the key in the bucket. It returns ErrNotFound
+// if the key does not exist.
+func (tx *Tx) Get(bucket, key string) ([]byte, error) {
+	var value []byte
+
+	err := tx.tx.QueryRow("SELECT value FROM kv WHERE bucket = ? AND key = ?", bucket, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// Put sets the value of the key in the bucket.
+func (tx *Tx) Put(bucket, key string, value []byte) error {
+	if !tx.writable {
+		return ErrReadOnly
+	}
+
+	if value == nil {
+		value = []byte{}
+	}
+
+	_, err := tx.tx.Exec("INSERT OR REPLACE INTO kv (bucket, key, value) VALUES (?, ?, ?)", bucket, key, value)
+	return err
+}
+
+// Delete removes the key from the bucket.
+func (tx *Tx) Delete(bucket, key string) error {
+	if !tx.writable {
+		return ErrReadOnly
+	}
+
+	_, err := tx.tx.Exec("DELETE FROM kv WHERE bucket = ? AND key = ?", bucket, key)
+	return err
+}
+
+// Keys returns sorted keys of the bucket.
+func (tx *Tx) Keys(bucket string) ([]string, error) {
+	rows, err := tx.tx.Query("SELECT key FROM kv WHERE bucket = ? ORDER BY key", bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
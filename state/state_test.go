@@ -0,0 +1,89 @@
+// +build sqlite
+
+package state_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/koding/kite/state"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kitestate")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "agent.db")
+
+	s, err := state.Open(path)
+	if err != nil {
+		t.Fatalf("Open()=%s", err)
+	}
+
+	if err := s.Put("queue", "1", []byte("first")); err != nil {
+		t.Fatalf("Put()=%s", err)
+	}
+
+	errRollback := errors.New("rollback")
+
+	err = s.Update(func(tx *state.Tx) error {
+		if err := tx.Put("queue", "2", []byte("second")); err != nil {
+			return err
+		}
+
+		return errRollback
+	})
+
+	if err != errRollback {
+		t.Fatalf("got %v, want %v", err, errRollback)
+	}
+
+	if _, err := s.Get("queue", "2"); err != state.ErrNotFound {
+		t.Fatalf("got %v, want %v", err, state.ErrNotFound)
+	}
+
+	err = s.View(func(tx *state.Tx) error {
+		return tx.Delete("queue", "1")
+	})
+
+	if err != state.ErrReadOnly {
+		t.Fatalf("got %v, want %v", err, state.ErrReadOnly)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close()=%s", err)
+	}
+
+	// The data must survive reopening.
+	if s, err = state.Open(path); err != nil {
+		t.Fatalf("Open()=%s", err)
+	}
+	defer s.Close()
+
+	value, err := s.Get("queue", "1")
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	if string(value) != "first" {
+		t.Fatalf("got %q, want %q", value, "first")
+	}
+
+	keys, err := s.Keys("queue")
+	if err != nil {
+		t.Fatalf("Keys()=%s", err)
+	}
+
+	if want := []string{"1"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("got %v, want %v", keys, want)
+	}
+}
@@ -0,0 +1,103 @@
+package kite
+
+import (
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/koding/kite/protocol"
+)
+
+// Stats describes the runtime state of a kite, it is what the kite.stats
+// method replies with.
+type Stats struct {
+	Kite        protocol.Kite `json:"kite"`
+	Uptime      time.Duration `json:"uptime"`
+	Connections int           `json:"connections"` // number of connected kites
+	Goroutines  int           `json:"goroutines"`
+	GoVersion   string        `json:"goVersion"`
+
+	// BytesIn and BytesOut are the total number of bytes received and
+	// sent by all the clients of the kite.
+	BytesIn  uint64 `json:"bytesIn"`
+	BytesOut uint64 `json:"bytesOut"`
+
+	// Clients is the traffic of the connected kites. The kite.stats
+	// method replies with it to the owner of the kite only.
+	Clients []*ClientStats `json:"clients,omitempty"`
+}
+
+// ClientStats is the traffic of a connected kite.
+type ClientStats struct {
+	Kite     protocol.Kite `json:"kite"`
+	BytesIn  uint64        `json:"bytesIn"`
+	BytesOut uint64        `json:"bytesOut"`
+}
+
+// Stats returns the runtime state of the kite.
+func (k *Kite) Stats() *Stats {
+	s := &Stats{
+		Kite:        *k.Kite(),
+		Uptime:      time.Since(k.started),
+		Connections: int(atomic.LoadInt32(&k.connections)),
+		Goroutines:  runtime.NumGoroutine(),
+		GoVersion:   runtime.Version(),
+		BytesIn:     atomic.LoadUint64(&k.bytesIn),
+		BytesOut:    atomic.LoadUint64(&k.bytesOut),
+	}
+
+	for _, c := range k.Clients() {
+		s.Clients = append(s.Clients, &ClientStats{
+			Kite:     c.Kite,
+			BytesIn:  c.BytesIn(),
+			BytesOut: c.BytesOut(),
+		})
+	}
+
+	return s
+}
+
+// Clients returns the kites connected to the kite, sorted by the number of
+// bytes received from them, the heaviest first.
+func (k *Kite) Clients() []*Client {
+	k.connsMu.Lock()
+	clients := make([]*Client, 0, len(k.conns))
+	for c := range k.conns {
+		clients = append(clients, c)
+	}
+	k.connsMu.Unlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].BytesIn() > clients[j].BytesIn()
+	})
+
+	return clients
+}
+
+// BytesIn returns the number of bytes received from the remote kite.
+func (c *Client) BytesIn() uint64 {
+	return atomic.LoadUint64(&c.bytesIn)
+}
+
+// BytesOut returns the number of bytes sent to the remote kite.
+func (c *Client) BytesOut() uint64 {
+	return atomic.LoadUint64(&c.bytesOut)
+}
+
+// countBytes adds n to the counters of the client and of the kite.
+func (c *Client) countBytes(client, kite *uint64, n int) {
+	atomic.AddUint64(client, uint64(n))
+	atomic.AddUint64(kite, uint64(n))
+}
+
+func (k *Kite) handleStats(r *Request) (interface{}, error) {
+	s := k.Stats()
+
+	// The connected kites are not disclosed to other users.
+	if r.Username != k.Config.Username {
+		s.Clients = nil
+	}
+
+	return s, nil
+}
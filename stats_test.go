@@ -0,0 +1,60 @@
+package kite
+
+import (
+	"testing"
+)
+
+func TestKite_Clients(t *testing.T) {
+	k := New("stats", "0.0.1")
+	defer k.Close()
+
+	light := k.NewClient("")
+	light.Kite.ID = "light"
+
+	heavy := k.NewClient("")
+	heavy.Kite.ID = "heavy"
+
+	k.conns = map[*Client]struct{}{light: {}, heavy: {}}
+
+	light.countBytes(&light.bytesIn, &k.bytesIn, 10)
+	heavy.countBytes(&heavy.bytesIn, &k.bytesIn, 1000)
+	heavy.countBytes(&heavy.bytesOut, &k.bytesOut, 20)
+
+	clients := k.Clients()
+
+	if len(clients) != 2 || clients[0] != heavy || clients[1] != light {
+		t.Fatalf("want heaviest client first, got %v", clients)
+	}
+
+	s := k.Stats()
+
+	if s.BytesIn != 1010 || s.BytesOut != 20 {
+		t.Fatalf("got %d bytes in, %d bytes out", s.BytesIn, s.BytesOut)
+	}
+
+	if len(s.Clients) != 2 || s.Clients[0].Kite.ID != "heavy" || s.Clients[0].BytesOut != 20 {
+		t.Fatalf("got %+v", s.Clients)
+	}
+}
+
+func TestKite_HandleStats(t *testing.T) {
+	k := New("stats", "0.0.1")
+	k.Config.Username = "owner"
+	defer k.Close()
+
+	c := k.NewClient("")
+	c.Kite.ID = "client"
+
+	k.conns = map[*Client]struct{}{c: {}}
+
+	for username, want := range map[string]int{"owner": 1, "other": 0} {
+		v, err := k.handleStats(&Request{Username: username})
+		if err != nil {
+			t.Fatalf("%s: handleStats()=%s", username, err)
+		}
+
+		if got := len(v.(*Stats).Clients); got != want {
+			t.Errorf("%s: got %d clients, want %d", username, got, want)
+		}
+	}
+}
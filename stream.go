@@ -0,0 +1,614 @@
+package kite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/koding/kite/dnode"
+)
+
+// ErrStreamClosed is returned by Stream.Send after the sending side of the
+// stream was closed.
+var ErrStreamClosed = errors.New("kite: stream is closed")
+
+// StreamHandlerFunc is a handler of a streaming method, see HandleStreamFunc.
+// The stream is finished when the handler returns, the returned error is
+// passed to the caller by its Stream.Recv.
+type StreamHandlerFunc func(r *Request, s *Stream) error
+
+// HandleStreamFunc registers a handler of a streaming method, which is called
+// with Client.Stream. The handler runs for as long as the stream is open,
+// sending chunks to the caller and receiving the ones the caller pushes:
+//
+//     k.HandleStreamFunc("log.tail", func(r *kite.Request, s *kite.Stream) error {
+//         for line := range lines {
+//             if err := s.Send(line); err != nil {
+//                 return err
+//             }
+//         }
+//         return nil
+//     })
+//
+// The method arguments are available in r.Args, like for regular methods.
+// The context of the stream carries the values of r.Context, e.g. the tenant
+// and the span of the call, but it's canceled only when the stream is.
+//
+// The open streams count as calls in flight, so Shutdown waits for their
+// handlers to return.
+func (k *Kite) HandleStreamFunc(method string, handler StreamHandlerFunc) *Method {
+	return k.addHandle(method, handler)
+}
+
+// ServeKite opens the stream and runs the handler in the background.
+func (h StreamHandlerFunc) ServeKite(r *Request) (interface{}, error) {
+	var args []streamCall
+
+	if r.Args != nil {
+		if err := r.Args.Unmarshal(&args); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) != 1 || !args[0].Stream.Push.IsValid() || !args[0].Stream.End.IsValid() {
+		return nil, &Error{
+			Type:    "argumentError",
+			Message: fmt.Sprintf("%q is a streaming method, call it with Client.Stream", r.Method),
+		}
+	}
+
+	r.Args = args[0].Args
+
+	// The context of the request is canceled once the stream is opened,
+	// so only its values are passed on.
+	var ctx context.Context = streamContext{
+		Context: context.Background(),
+		values:  r.Context,
+	}
+
+	if r.Context == nil {
+		ctx = context.Background()
+	}
+
+	if r.Tenant != "" {
+		ctx = WithTenant(ctx, r.Tenant)
+	}
+
+	s := newStream(ctx, r.Client, r.Method, args[0].Stream)
+
+	atomic.AddInt32(&r.LocalKite.inflight, 1)
+
+	go func() {
+		defer atomic.AddInt32(&r.LocalKite.inflight, -1)
+
+		var err error
+
+		func() {
+			defer func() {
+				if v := recover(); v != nil {
+					err = createError(r, v)
+				}
+			}()
+
+			err = h(r, s)
+		}()
+
+		if err := s.closeSend(err); err != nil && err != ErrStreamClosed {
+			r.LocalKite.Log.Debug("Closing %q stream failed: %s", r.Method, err)
+		}
+
+		s.finish()
+	}()
+
+	return s.endpoint(), nil
+}
+
+// streamContext is a context with the values of another one.
+type streamContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c streamContext) Value(key interface{}) interface{} {
+	return c.values.Value(key)
+}
+
+// streamWindow is the maximum number of chunks, by which a received chunk
+// may be ahead of the next one read with Recv. The streams receiving chunks
+// further ahead are aborted.
+const streamWindow = 1 << 16
+
+// Stream is a bidirectional stream of chunks between a caller and a handler
+// of a streaming method. Each side sends chunks with Send and receives the
+// ones sent by the other side with Recv, the chunks are received in the
+// order they were sent.
+//
+// Received chunks are buffered until they are read with Recv, so a side
+// which does not read them should not expect the other side to send many.
+// A stream with too many chunks buffered is aborted.
+type Stream struct {
+	// Method is the name of the streaming method.
+	Method string
+
+	client *Client
+	remote streamEndpoint
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// sending side
+	sendMu     sync.Mutex
+	sent       int
+	sendClosed bool
+
+	// receiving side
+	mu       sync.Mutex
+	next     int                    // seq of the next chunk to receive
+	pending  map[int]*dnode.Partial // chunks received out of order
+	received int                    // number of chunks received
+	total    int                    // number of chunks sent, -1 until ended
+	endErr   error                  // error the remote side ended with
+	notify   chan struct{}
+	gone     <-chan struct{} // closed on disconnect
+	doneOnce sync.Once
+
+	// held is the size of the pending chunks, which is accounted to
+	// the memory of the client until released
+	held     int
+	released bool
+
+	// callbacks are the IDs of the push and end callbacks, which are
+	// removed from the scrubber of the client once the stream is done
+	callbacksMu      sync.Mutex
+	callbacks        []uint64
+	callbacksRemoved bool
+}
+
+// streamEndpoint are the callbacks a side of the stream receives chunks
+// and the end of the stream with.
+type streamEndpoint struct {
+	Push dnode.Function `json:"push"`
+	End  dnode.Function `json:"end"`
+}
+
+// streamCall is the argument of a call of a streaming method.
+type streamCall struct {
+	Args   *dnode.Partial `json:"args"`
+	Stream streamEndpoint `json:"stream"`
+}
+
+func newStream(ctx context.Context, c *Client, method string, remote streamEndpoint) *Stream {
+	c.disconnectMu.Lock()
+	gone := c.disconnect
+	c.disconnectMu.Unlock()
+
+	s := &Stream{
+		Method:  method,
+		client:  c,
+		remote:  remote,
+		pending: make(map[int]*dnode.Partial),
+		total:   -1,
+		notify:  make(chan struct{}, 1),
+		gone:    gone,
+	}
+
+	s.ctx, s.cancel = context.WithCancel(ctx)
+
+	// The stream is aborted when the connection is lost.
+	go func() {
+		select {
+		case <-gone:
+			s.finish()
+			s.releaseMemory()
+			s.removeCallbacks()
+		case <-s.ctx.Done():
+		}
+	}()
+
+	return s
+}
+
+// Stream calls the streaming method with the given arguments and returns
+// the opened stream. The call waits for the remote kite to open the stream
+// up to Config.Timeout.
+func (c *Client) Stream(method string, args ...interface{}) (*Stream, error) {
+	return c.StreamWithContext(context.Background(), method, args...)
+}
+
+// StreamWithContext does the same thing with Stream() method except the
+// call is made with TellWithContext and the stream is aborted when the ctx
+// is done.
+func (c *Client) StreamWithContext(ctx context.Context, method string, args ...interface{}) (*Stream, error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+
+	s := newStream(ctx, c, method, streamEndpoint{})
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config().Timeout)
+		defer cancel()
+	}
+
+	call := map[string]interface{}{
+		"args":   args,
+		"stream": s.endpoint(),
+	}
+
+	result, err := c.TellWithContext(ctx, method, call)
+	if err != nil {
+		s.finish()
+		return nil, err
+	}
+
+	var remote streamEndpoint
+	if result != nil {
+		err = result.Unmarshal(&remote)
+	}
+
+	if err != nil || !remote.Push.IsValid() || !remote.End.IsValid() {
+		s.finish()
+		return nil, &Error{
+			Type:    "invalidResponse",
+			Message: fmt.Sprintf("%q did not open a stream", method),
+		}
+	}
+
+	s.remote = remote
+
+	return s, nil
+}
+
+// Context returns the context of the stream, which is canceled when the
+// stream is aborted or the connection is lost. Streams of callers inherit
+// the context passed to StreamWithContext.
+func (s *Stream) Context() context.Context {
+	return s.ctx
+}
+
+// Send sends a chunk to the other side of the stream.
+func (s *Stream) Send(v interface{}) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	if s.sendClosed {
+		return ErrStreamClosed
+	}
+
+	if s.ctx.Err() != nil {
+		return s.abortErr()
+	}
+
+	if err := s.remote.Push.Call(s.sent, v); err != nil {
+		return err
+	}
+
+	s.sent++
+
+	return nil
+}
+
+// CloseSend tells the other side no more chunks are going to be sent, its
+// Recv returns io.EOF after receiving all the chunks. The handlers of
+// streaming methods do not need to call it, it is done when they return.
+func (s *Stream) CloseSend() error {
+	return s.closeSend(nil)
+}
+
+// Abort closes the sending side of the stream with an error, which is
+// returned by Recv of the other side, and stops receiving chunks.
+func (s *Stream) Abort(err error) error {
+	if err == nil {
+		err = context.Canceled
+	}
+
+	defer s.removeCallbacks()
+	defer s.releaseMemory()
+	defer s.finish()
+
+	return s.closeSend(err)
+}
+
+func (s *Stream) closeSend(err error) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	if s.sendClosed {
+		return ErrStreamClosed
+	}
+
+	s.sendClosed = true
+
+	var kiteErr *Error
+	if err != nil {
+		var ok bool
+		if kiteErr, ok = err.(*Error); !ok {
+			kiteErr = &Error{Type: "streamError", Message: err.Error()}
+		}
+	}
+
+	if !s.remote.End.IsValid() {
+		return nil
+	}
+
+	err = s.remote.End.Call(s.sent, kiteErr)
+
+	s.mu.Lock()
+	ended := s.total >= 0
+	s.mu.Unlock()
+
+	if ended {
+		s.finish()
+	}
+
+	return err
+}
+
+// Recv returns the next chunk sent by the other side of the stream. It
+// returns io.EOF once the other side closed the stream and all its chunks
+// were received, or the error the other side ended the stream with.
+func (s *Stream) Recv() (*dnode.Partial, error) {
+	for {
+		s.mu.Lock()
+		if chunk, ok := s.pending[s.next]; ok {
+			delete(s.pending, s.next)
+			s.next++
+			s.holdMemory(-chunkSize(chunk))
+			s.mu.Unlock()
+			return chunk, nil
+		}
+
+		if s.total >= 0 && s.next >= s.total {
+			err := s.endErr
+			s.mu.Unlock()
+
+			if err == nil {
+				err = io.EOF
+			}
+
+			return nil, err
+		}
+
+		// The context of a finished stream is canceled, but the last
+		// chunks may still be on their way.
+		done := s.ctx.Done()
+		if s.total >= 0 && s.endErr == nil {
+			done = nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.notify:
+		case <-s.gone:
+			return nil, s.abortErr()
+		case <-done:
+			s.mu.Lock()
+			finished := s.total >= 0 && s.endErr == nil
+			s.mu.Unlock()
+
+			if !finished {
+				return nil, s.abortErr()
+			}
+		}
+	}
+}
+
+// abortErr gives the reason the stream was aborted for.
+func (s *Stream) abortErr() error {
+	s.mu.Lock()
+	err := s.endErr
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-s.gone:
+		return &Error{
+			Type:    "disconnect",
+			Message: "Remote kite has disconnected",
+		}
+	default:
+		return s.ctx.Err()
+	}
+}
+
+// endpoint gives the callbacks the other side sends chunks with.
+func (s *Stream) endpoint() streamEndpoint {
+	return streamEndpoint{
+		Push: dnode.TrackedCallback(s.push, s.trackCallback),
+		End:  dnode.TrackedCallback(s.end, s.trackCallback),
+	}
+}
+
+// push receives a chunk, the arguments are the seq of the chunk and
+// the chunk.
+func (s *Stream) push(args *dnode.Partial) {
+	var a []*dnode.Partial
+
+	if err := args.Unmarshal(&a); err != nil || len(a) != 2 {
+		s.client.LocalKite.Log.Warning("Invalid chunk of %q stream: %v", s.Method, args)
+		return
+	}
+
+	seq, err := a[0].Float64()
+	if err != nil || seq < 0 || seq != float64(int(seq)) {
+		s.client.LocalKite.Log.Warning("Invalid chunk of %q stream: %v", s.Method, args)
+		return
+	}
+
+	n := int(seq)
+
+	s.mu.Lock()
+	if n >= s.next+streamWindow {
+		err := &Error{
+			Type:    "streamError",
+			Message: fmt.Sprintf("Chunk %d of %q stream is out of the window of %d chunks", n, s.Method, streamWindow),
+		}
+
+		if s.endErr == nil {
+			s.endErr = err
+		}
+		s.mu.Unlock()
+
+		s.Abort(err)
+		s.wake()
+		return
+	}
+
+	if n >= s.next {
+		if old, ok := s.pending[n]; ok {
+			s.holdMemory(-chunkSize(old))
+		} else {
+			s.received++
+		}
+
+		s.pending[n] = a[1]
+		s.holdMemory(chunkSize(a[1]))
+	}
+	s.mu.Unlock()
+
+	// The last chunks may be received after the stream is finished.
+	if s.ctx.Err() != nil && s.drained() {
+		s.removeCallbacks()
+	}
+
+	s.wake()
+}
+
+// end receives the end of the stream, the arguments are the number of the
+// chunks sent and the error, if any, the stream ended with.
+func (s *Stream) end(args *dnode.Partial) {
+	var a []*dnode.Partial
+
+	if err := args.Unmarshal(&a); err != nil || len(a) == 0 {
+		s.client.LocalKite.Log.Warning("Invalid end of %q stream: %v", s.Method, args)
+		return
+	}
+
+	total, err := a[0].Float64()
+	if err != nil {
+		s.client.LocalKite.Log.Warning("Invalid end of %q stream: %v", s.Method, args)
+		return
+	}
+
+	var endErr *Error
+	if len(a) > 1 && a[1] != nil && string(a[1].Raw) != "null" {
+		endErr = &Error{}
+		if err := a[1].Unmarshal(endErr); err != nil {
+			endErr = &Error{Type: "streamError", Message: string(a[1].Raw)}
+		}
+	}
+
+	s.mu.Lock()
+	s.total = int(total)
+	if endErr != nil {
+		s.endErr = endErr
+	}
+	s.mu.Unlock()
+
+	s.sendMu.Lock()
+	sendClosed := s.sendClosed
+	s.sendMu.Unlock()
+
+	// The stream is finished once both sides are done sending, or when
+	// the other side aborted it.
+	if endErr != nil || sendClosed {
+		s.finish()
+	}
+
+	s.wake()
+}
+
+func (s *Stream) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// holdMemory accounts n bytes of the pending chunks to the memory of
+// the client, see Client.MemoryUsage. It's called with s.mu held.
+func (s *Stream) holdMemory(n int) {
+	if s.released {
+		return
+	}
+
+	s.held += n
+	s.client.holdMemory(n)
+}
+
+func chunkSize(chunk *dnode.Partial) int {
+	if chunk == nil {
+		return 0
+	}
+
+	return len(chunk.Raw)
+}
+
+// releaseMemory releases the memory of the pending chunks, once they
+// are not going to be read, and stops accounting them.
+func (s *Stream) releaseMemory() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.released {
+		s.client.holdMemory(-s.held)
+		s.held = 0
+		s.released = true
+	}
+}
+
+// finish cancels the context of the stream, which releases it.
+func (s *Stream) finish() {
+	s.doneOnce.Do(func() {
+		s.cancel()
+
+		if s.drained() {
+			s.removeCallbacks()
+		}
+	})
+}
+
+// drained tells whether no more chunks are expected from the other side,
+// as it sent all of them or the stream was aborted.
+func (s *Stream) drained() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.total < 0 || s.endErr != nil || s.received >= s.total
+}
+
+// trackCallback records the ID of a callback of the stream, once it is
+// registered by the scrubber of the client.
+func (s *Stream) trackCallback(id uint64) {
+	s.callbacksMu.Lock()
+	removed := s.callbacksRemoved
+	if !removed {
+		s.callbacks = append(s.callbacks, id)
+	}
+	s.callbacksMu.Unlock()
+
+	if removed {
+		s.client.scrubber.RemoveCallback(id)
+	}
+}
+
+// removeCallbacks removes the callbacks of the stream from the scrubber of
+// the client, as the other side is not going to call them anymore.
+func (s *Stream) removeCallbacks() {
+	s.callbacksMu.Lock()
+	defer s.callbacksMu.Unlock()
+
+	for _, id := range s.callbacks {
+		s.client.scrubber.RemoveCallback(id)
+	}
+
+	s.callbacks = nil
+	s.callbacksRemoved = true
+}
@@ -0,0 +1,147 @@
+package kite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/koding/kite/dnode"
+)
+
+func TestClient_Stream(t *testing.T) {
+	k := New("streamer", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+
+	k.HandleStreamFunc("double", func(r *Request, s *Stream) error {
+		var prefix string
+		if err := r.Args.One().Unmarshal(&prefix); err != nil {
+			return err
+		}
+
+		for {
+			chunk, err := s.Recv()
+			if err == io.EOF {
+				return s.Send(prefix + "done")
+			}
+			if err != nil {
+				return err
+			}
+
+			var n int
+			if err := chunk.Unmarshal(&n); err != nil {
+				return err
+			}
+
+			if err := s.Send(fmt.Sprintf("%s%d", prefix, 2*n)); err != nil {
+				return err
+			}
+		}
+	})
+
+	k.HandleStreamFunc("fail", func(r *Request, s *Stream) error {
+		if err := s.Send("partial"); err != nil {
+			return err
+		}
+
+		return errors.New("stream failed")
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	s, err := c.Stream("double", "n=")
+	if err != nil {
+		t.Fatalf("Stream()=%s", err)
+	}
+
+	for i := 1; i <= 10; i++ {
+		if err := s.Send(i); err != nil {
+			t.Fatalf("Send()=%s", err)
+		}
+	}
+
+	if err := s.CloseSend(); err != nil {
+		t.Fatalf("CloseSend()=%s", err)
+	}
+
+	var got []string
+	for {
+		chunk, err := s.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv()=%s", err)
+		}
+
+		got = append(got, chunk.MustString())
+	}
+
+	want := []string{"n=2", "n=4", "n=6", "n=8", "n=10", "n=12", "n=14", "n=16", "n=18", "n=20", "n=done"}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	s, err = c.Stream("fail")
+	if err != nil {
+		t.Fatalf("Stream()=%s", err)
+	}
+
+	if chunk, err := s.Recv(); err != nil || chunk.MustString() != "partial" {
+		t.Fatalf("Recv()=%v, %v", chunk, err)
+	}
+
+	_, err = s.Recv()
+	if e, ok := err.(*Error); !ok || e.Message != "stream failed" {
+		t.Fatalf("got %v, want stream failed error", err)
+	}
+
+	if _, err := c.Tell("double", "n="); err == nil {
+		t.Fatal("expected calling a streaming method with Tell to fail")
+	}
+}
+
+func TestStream_Callbacks(t *testing.T) {
+	k := New("streamer", "0.0.1")
+	defer k.Close()
+
+	c := k.NewClient("")
+
+	chunk := func(seq int) *dnode.Partial {
+		return &dnode.Partial{Raw: []byte(fmt.Sprintf(`[%d,"chunk"]`, seq))}
+	}
+
+	s := newStream(context.Background(), c, "test", streamEndpoint{})
+	callbacks := c.scrubber.Scrub([]interface{}{s.endpoint()})
+
+	if len(callbacks) != 2 || len(s.callbacks) != 2 {
+		t.Fatalf("got %d callbacks, %d tracked, want 2", len(callbacks), len(s.callbacks))
+	}
+
+	s.push(chunk(streamWindow))
+
+	if _, err := s.Recv(); err == nil || !strings.Contains(err.Error(), "window") {
+		t.Fatalf("got %v, want window error", err)
+	}
+
+	for id := range callbacks {
+		n, _ := strconv.ParseUint(id, 10, 64)
+
+		if c.scrubber.GetCallback(n) != nil {
+			t.Fatalf("callback %d of the aborted stream was not removed", n)
+		}
+	}
+}
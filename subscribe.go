@@ -0,0 +1,130 @@
+package kite
+
+import (
+	"sync"
+
+	"github.com/koding/kite/dnode"
+
+	"github.com/igm/sockjs-go/sockjs"
+)
+
+// Subscription is a method call, which registers something on the remote
+// kite for the lifetime of the connection, like a callback the remote kite
+// pushes events to. Subscriptions made with Client.Subscribe are made again
+// every time the client reconnects, so they survive reconnects.
+type Subscription struct {
+	Method string
+	Args   []interface{}
+
+	client  *Client
+	result  *dnode.Partial
+	session sockjs.Session // the session the subscription was made on
+	mu      sync.Mutex
+}
+
+// Result returns the result of the latest call of the subscription.
+func (s *Subscription) Result() *dnode.Partial {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.result
+}
+
+// Cancel stops making the subscription again on reconnects. It does not
+// tell the remote kite anything, that is up to the caller.
+func (s *Subscription) Cancel() {
+	c := s.client
+
+	c.subscriptionsMu.Lock()
+	defer c.subscriptionsMu.Unlock()
+
+	delete(c.subscriptions, s)
+}
+
+// Subscribe calls the method with the given arguments and, if the call
+// succeeds, calls it again with the same arguments every time the client
+// reconnects. Callbacks in the arguments are sent anew with every call.
+func (c *Client) Subscribe(method string, args ...interface{}) (*Subscription, error) {
+	session := c.getSession()
+
+	result, err := c.TellWithTimeout(method, c.config().Timeout, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Subscription{
+		Method:  method,
+		Args:    args,
+		client:  c,
+		result:  result,
+		session: session,
+	}
+
+	c.subscriptionsMu.Lock()
+	if c.subscriptions == nil {
+		c.subscriptions = make(map[*Subscription]struct{})
+		c.OnConnect(func() { go c.resubscribe() })
+	}
+	c.subscriptions[s] = struct{}{}
+	c.subscriptionsMu.Unlock()
+
+	return s, nil
+}
+
+// OnResubscribe adds a callback which is called every time a subscription
+// is made again after the client reconnected. The err is non-nil if the
+// call failed, the subscription is going to be retried on the next
+// reconnect.
+func (c *Client) OnResubscribe(handler func(s *Subscription, err error)) {
+	c.m.Lock()
+	c.onResubscribeHandlers = append(c.onResubscribeHandlers, handler)
+	c.m.Unlock()
+}
+
+func (c *Client) callOnResubscribeHandlers(s *Subscription, err error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	for _, handler := range c.onResubscribeHandlers {
+		func() {
+			defer nopRecover()
+			handler(s, err)
+		}()
+	}
+}
+
+// resubscribe makes all the subscriptions of the client again.
+func (c *Client) resubscribe() {
+	c.subscriptionsMu.Lock()
+	subscriptions := make([]*Subscription, 0, len(c.subscriptions))
+	for s := range c.subscriptions {
+		subscriptions = append(subscriptions, s)
+	}
+	c.subscriptionsMu.Unlock()
+
+	session := c.getSession()
+
+	for _, s := range subscriptions {
+		s.mu.Lock()
+		current := s.session == session
+		s.mu.Unlock()
+
+		// Subscriptions made after the connection was established are
+		// already there.
+		if current {
+			continue
+		}
+
+		result, err := c.TellWithTimeout(s.Method, c.config().Timeout, s.Args...)
+		if err != nil {
+			c.LocalKite.Log.Warning("Resubscribing %q to %q failed: %s", s.Method, c.URL, err)
+		} else {
+			s.mu.Lock()
+			s.result = result
+			s.session = session
+			s.mu.Unlock()
+		}
+
+		c.callOnResubscribeHandlers(s, err)
+	}
+}
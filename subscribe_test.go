@@ -0,0 +1,83 @@
+package kite
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+func TestClient_Subscribe(t *testing.T) {
+	k := New("pusher", "0.0.1")
+	k.Config.DisableAuthentication = true
+	k.Config.Port = 0
+
+	var subscribed int32
+
+	k.HandleFunc("watch", func(r *Request) (interface{}, error) {
+		var args struct {
+			OnEvent dnode.Function
+		}
+
+		if err := r.Args.One().Unmarshal(&args); err != nil {
+			return nil, err
+		}
+
+		return atomic.AddInt32(&subscribed, 1), args.OnEvent.Call("subscribed")
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	c := New("exp", "0.0.1").NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+
+	connected, err := c.DialForever()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-connected
+
+	events := make(chan string, 4)
+	onEvent := dnode.Callback(func(p *dnode.Partial) {
+		events <- p.One().MustString()
+	})
+
+	s, err := c.Subscribe("watch", map[string]interface{}{"OnEvent": onEvent})
+	if err != nil {
+		t.Fatalf("Subscribe()=%s", err)
+	}
+
+	resubscribed := make(chan error, 1)
+	c.OnResubscribe(func(sub *Subscription, err error) {
+		if sub == s {
+			resubscribed <- err
+		}
+	})
+
+	<-events
+
+	c.getSession().Close(3000, "test")
+
+	select {
+	case err := <-resubscribed:
+		if err != nil {
+			t.Fatalf("resubscribing failed: %s", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for resubscribe")
+	}
+
+	select {
+	case <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the event after resubscribe")
+	}
+
+	if n := s.Result().MustFloat64(); n != 2 {
+		t.Fatalf("got %v subscriptions, want 2", n)
+	}
+}
@@ -0,0 +1,321 @@
+// Package supervisor runs a kite as the main loop of a long running process,
+// like an agent binary, restarting it whenever it panics or stops
+// unexpectedly.
+//
+// A kite can't be run again once it is closed, therefore the supervisor
+// creates a new one with the New function on every start:
+//
+//     s := &supervisor.Supervisor{
+//         New: func() (*kite.Kite, error) {
+//             k := kite.New("agent", "0.0.1")
+//             k.HandleFunc("exec", exec)
+//             return k, nil
+//         },
+//     }
+//
+//     if err := s.Run(); err != nil {
+//         log.Fatal(err)
+//     }
+package supervisor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/koding/kite"
+)
+
+// Status describes the state of a supervised kite.
+type Status string
+
+const (
+	Starting   Status = "starting"
+	Running    Status = "running"
+	Restarting Status = "restarting"
+	Stopped    Status = "stopped"
+	Failed     Status = "failed"
+)
+
+// ErrStopped is returned by Run when the kite stops without Stop
+// being called.
+var ErrStopped = errors.New("kite stopped unexpectedly")
+
+// ErrMaxRestarts is returned by Run when the kite failed more times than
+// allowed by Supervisor.MaxRestarts.
+var ErrMaxRestarts = errors.New("maximum number of restarts is exceeded")
+
+// PanicError is the error of a run that panicked.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("kite panicked: %v", e.Value)
+}
+
+// Health is a snapshot of the state of a supervised kite.
+type Health struct {
+	Status    Status    `json:"status"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"lastError,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+// Supervisor runs a kite and restarts it on failures, waiting between the
+// restarts according to its backoff policy.
+type Supervisor struct {
+	// New creates a kite for every run. It is required. Failing to create
+	// a kite counts as a failed run.
+	New func() (*kite.Kite, error)
+
+	// Main runs the kite, it should block until the kite stops. When nil,
+	// the kite's Run method is used, which exits the process if the kite
+	// can't listen on its port.
+	//
+	// Only the panics of the goroutine calling Main, or Run, are recovered
+	// and restart the kite. The panics of the goroutines they start crash
+	// the process as usual, except for the ones of the method handlers,
+	// which the kite recovers itself.
+	Main func(k *kite.Kite) error
+
+	// BackOff tells how long to wait before each restart. It is reset
+	// after the kite has been running for ResetAfter. When nil, an
+	// exponential backoff which never gives up is used.
+	BackOff backoff.BackOff
+
+	// ResetAfter is the uptime after which a run is considered successful.
+	// The default is one minute.
+	ResetAfter time.Duration
+
+	// MaxRestarts is the maximum number of consecutive failed runs, after
+	// which Run gives up. Zero means no limit.
+	MaxRestarts int
+
+	// OnHealth is called whenever the health of the kite changes.
+	OnHealth func(Health)
+
+	mu      sync.Mutex
+	kite    *kite.Kite
+	health  Health
+	stopped bool
+	stop    chan struct{}
+}
+
+// Run starts the kite and blocks until Stop is called or until the maximum
+// number of restarts is exceeded.
+func (s *Supervisor) Run() error {
+	s.mu.Lock()
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+	}
+	b := s.BackOff
+	s.mu.Unlock()
+
+	if b == nil {
+		eb := backoff.NewExponentialBackOff()
+		eb.MaxElapsedTime = 0 // never give up
+		b = eb
+	}
+
+	resetAfter := s.ResetAfter
+	if resetAfter == 0 {
+		resetAfter = time.Minute
+	}
+
+	failures := 0
+
+	for {
+		s.setHealth(Starting, nil)
+
+		started := time.Now()
+		err := s.runOnce()
+
+		if s.isStopped() {
+			s.setHealth(Stopped, nil)
+			return nil
+		}
+
+		if time.Since(started) >= resetAfter {
+			b.Reset()
+			failures = 0
+		}
+
+		failures++
+
+		if s.MaxRestarts > 0 && failures > s.MaxRestarts {
+			s.setHealth(Failed, err)
+			return ErrMaxRestarts
+		}
+
+		wait := b.NextBackOff()
+		if wait == backoff.Stop {
+			s.setHealth(Failed, err)
+			return ErrMaxRestarts
+		}
+
+		s.setHealth(Restarting, err)
+
+		select {
+		case <-time.After(wait):
+		case <-s.stop:
+			s.setHealth(Stopped, nil)
+			return nil
+		}
+	}
+}
+
+// runOnce creates and runs a single kite, recovering its panics. The kite
+// which panicked is closed, so it does not keep its listener and its
+// connections while the next one is started.
+func (s *Supervisor) runOnce() (err error) {
+	defer func() {
+		v := recover()
+
+		s.mu.Lock()
+		k := s.kite
+		s.kite = nil
+		s.mu.Unlock()
+
+		if v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+
+			if k != nil {
+				closeKite(k)
+			}
+		}
+	}()
+
+	k, err := s.New()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		k.Close()
+		return nil
+	}
+	s.kite = k
+	s.mu.Unlock()
+
+	s.setHealth(Running, nil)
+
+	if s.Main != nil {
+		err = s.Main(k)
+	} else {
+		k.Run()
+	}
+
+	if err == nil && !s.isStopped() {
+		err = ErrStopped
+	}
+
+	if err != nil {
+		k.Log.Error("supervisor: %s", err)
+		k.Close()
+	}
+
+	return err
+}
+
+// closeKite closes the kite, which panicked, ignoring the panics of Close,
+// as the kite may be left in any state.
+func closeKite(k *kite.Kite) {
+	defer func() {
+		if v := recover(); v != nil {
+			k.Log.Error("supervisor: closing kite: %v", v)
+		}
+	}()
+
+	k.Close()
+}
+
+// Stop closes the running kite and makes Run return.
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return
+	}
+
+	s.stopped = true
+
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+	}
+	close(s.stop)
+
+	if s.kite != nil {
+		s.kite.Close()
+	}
+}
+
+// Kite returns the currently running kite, or nil if there is none.
+func (s *Supervisor) Kite() *kite.Kite {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.kite
+}
+
+// Health returns the current health of the kite.
+func (s *Supervisor) Health() Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.health
+}
+
+// ServeHTTP writes the health of the kite as JSON. The response status is
+// 503 Service Unavailable if the kite is not running.
+func (s *Supervisor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h := s.Health()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.Status != Running {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(h)
+}
+
+func (s *Supervisor) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stopped
+}
+
+func (s *Supervisor) setHealth(status Status, err error) {
+	s.mu.Lock()
+	h := s.health
+	h.Status = status
+	h.Since = time.Now()
+
+	switch status {
+	case Restarting:
+		h.Restarts++
+		fallthrough
+	case Failed:
+		if err != nil {
+			h.LastError = err.Error()
+		}
+	}
+
+	s.health = h
+	s.mu.Unlock()
+
+	if s.OnHealth != nil {
+		s.OnHealth(h)
+	}
+}
@@ -0,0 +1,114 @@
+package supervisor
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/koding/kite"
+)
+
+func TestSupervisor_Restart(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		runs    int
+		crashed *kite.Kite
+		running = make(chan struct{})
+		release = make(chan struct{})
+	)
+
+	s := &Supervisor{
+		New: func() (*kite.Kite, error) {
+			return kite.New("supervised", "0.0.1"), nil
+		},
+		Main: func(k *kite.Kite) error {
+			mu.Lock()
+			runs++
+			n := runs
+			mu.Unlock()
+
+			switch n {
+			case 1:
+				k.Config.Port = 0
+				go k.Run()
+				<-k.ServerReadyNotify()
+
+				crashed = k
+				panic("boom")
+			case 2:
+				return errors.New("failed")
+			}
+
+			close(running)
+			<-release
+			return nil
+		},
+		BackOff: backoff.NewConstantBackOff(10 * time.Millisecond),
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+
+	select {
+	case <-running:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the kite to run")
+	}
+
+	// The kite which panicked is closed.
+	select {
+	case <-crashed.ServerCloseNotify():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the panicked kite to close")
+	}
+
+	h := s.Health()
+	if h.Status != Running {
+		t.Fatalf("want status %q, got %q", Running, h.Status)
+	}
+
+	if h.Restarts != 2 {
+		t.Fatalf("want 2 restarts, got %d", h.Restarts)
+	}
+
+	if h.LastError != "failed" {
+		t.Fatalf("want last error %q, got %q", "failed", h.LastError)
+	}
+
+	s.Stop()
+	close(release)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run()=%s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for Run to return")
+	}
+
+	if h := s.Health(); h.Status != Stopped {
+		t.Fatalf("want status %q, got %q", Stopped, h.Status)
+	}
+}
+
+func TestSupervisor_MaxRestarts(t *testing.T) {
+	s := &Supervisor{
+		New: func() (*kite.Kite, error) {
+			return nil, errors.New("no kite")
+		},
+		BackOff:     &backoff.ZeroBackOff{},
+		MaxRestarts: 3,
+	}
+
+	if err := s.Run(); err != ErrMaxRestarts {
+		t.Fatalf("want %s, got %v", ErrMaxRestarts, err)
+	}
+
+	h := s.Health()
+	if h.Status != Failed || h.Restarts != 3 || h.LastError != "no kite" {
+		t.Fatalf("unexpected health: %+v", h)
+	}
+}
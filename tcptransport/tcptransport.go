@@ -0,0 +1,269 @@
+// Package tcptransport implements a kite transport over raw TCP
+// connections, for kites that talk with each other inside a trusted network
+// and do not need the overhead of SockJS.
+//
+// Importing the package registers the transport for "tcp://" URLs:
+//
+//     import _ "github.com/koding/kite/tcptransport"
+//
+//     k := kite.New("client", "1.0.0")
+//     c := k.NewClient("tcp://127.0.0.1:3636")
+//
+// On the server side the connections are served with Kite.ServeTransport:
+//
+//     l, err := tcptransport.Listen("127.0.0.1:3636")
+//     if err != nil {
+//         log.Fatal(err)
+//     }
+//
+//     go k.ServeTransport(l)
+//
+// The sessions can carry binary messages, so kites which advertise
+// kite.FeatureMsgpack exchange the messages encoded with MessagePack.
+package tcptransport
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/utils"
+
+	"github.com/igm/sockjs-go/sockjs"
+)
+
+// Scheme is the URL scheme the transport is registered for.
+const Scheme = "tcp"
+
+// ErrSessionClosed is returned when sending over a closed session.
+var ErrSessionClosed = errors.New("tcptransport: session is closed")
+
+func init() {
+	kite.RegisterTransport(Scheme, Transport{})
+}
+
+// Transport dials kites over TCP. The URL of the kite is in the form of
+// "tcp://host:port".
+type Transport struct{}
+
+var _ kite.Transport = Transport{}
+
+// Dial implements the kite.Transport interface.
+func (Transport) Dial(rawurl string, conf *config.Config) (sockjs.Session, error) {
+	addr := rawurl
+
+	if strings.Contains(rawurl, "://") {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			return nil, err
+		}
+
+		addr = u.Host
+	}
+
+	dialer := &net.Dialer{
+		Timeout: conf.Timeout,
+	}
+
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSession(conn), nil
+}
+
+// Session is a kite connection over a net.Conn. Every text message is sent
+// as a JSON string in a separate line. Binary messages are sent as a '*',
+// the decimal length of the message and a newline, followed by the message.
+type Session struct {
+	id   string
+	conn net.Conn
+	r    *bufio.Reader
+
+	mu     sync.Mutex // protects writes and closed
+	closed bool
+}
+
+var _ kite.BinarySession = (*Session)(nil)
+
+// MaxBinarySize is the maximum size of a received binary message.
+var MaxBinarySize = 64 << 20
+
+// NewSession returns a new session for the given connection.
+func NewSession(conn net.Conn) *Session {
+	return &Session{
+		id:   utils.RandomString(20),
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+}
+
+// ID returns the session ID.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Request implements the sockjs.Session interface, sessions over TCP
+// are not made with HTTP requests, so it always returns nil.
+func (s *Session) Request() *http.Request {
+	return nil
+}
+
+// RemoteAddr returns the address of the remote end of the connection.
+func (s *Session) RemoteAddr() string {
+	return s.conn.RemoteAddr().String()
+}
+
+// Recv reads one message from the session, binary messages are returned
+// as they were sent.
+func (s *Session) Recv() (string, error) {
+	line, err := s.r.ReadBytes('\n')
+	if err != nil {
+		if s.isClosed() {
+			return "", ErrSessionClosed
+		}
+
+		return "", err
+	}
+
+	if line[0] == '*' {
+		return s.recvBinary(line)
+	}
+
+	var msg string
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return "", err
+	}
+
+	return msg, nil
+}
+
+// Send sends one message over the session.
+func (s *Session) Send(msg string) error {
+	p, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrSessionClosed
+	}
+
+	_, err = s.conn.Write(append(p, '\n'))
+	return err
+}
+
+func (s *Session) recvBinary(line []byte) (string, error) {
+	n, err := strconv.Atoi(string(line[1 : len(line)-1]))
+	if err != nil || n < 0 {
+		return "", errors.New("tcptransport: invalid binary message length")
+	}
+
+	if n > MaxBinarySize {
+		return "", errors.New("tcptransport: binary message is too large")
+	}
+
+	p := make([]byte, n)
+	if _, err := io.ReadFull(s.r, p); err != nil {
+		if s.isClosed() {
+			return "", ErrSessionClosed
+		}
+
+		return "", err
+	}
+
+	return string(p), nil
+}
+
+// SendBinary sends one binary message over the session.
+func (s *Session) SendBinary(p []byte) error {
+	header := make([]byte, 0, 12)
+	header = append(header, '*')
+	header = strconv.AppendInt(header, int64(len(p)), 10)
+	header = append(header, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrSessionClosed
+	}
+
+	_, err := (&net.Buffers{header, p}).WriteTo(s.conn)
+	return err
+}
+
+// Close closes the session, the code and reason are ignored.
+func (s *Session) Close(uint32, string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrSessionClosed
+	}
+
+	s.closed = true
+
+	return s.conn.Close()
+}
+
+// GetSessionState gives state of the session.
+func (s *Session) GetSessionState() sockjs.SessionState {
+	if s.isClosed() {
+		return sockjs.SessionClosed
+	}
+
+	return sockjs.SessionActive
+}
+
+func (s *Session) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+// Listener accepts kite connections over TCP.
+type Listener struct {
+	net.Listener
+}
+
+var _ kite.Listener = (*Listener)(nil)
+
+// Listen announces on the given TCP address.
+func Listen(addr string) (*Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Listener{Listener: l}, nil
+}
+
+// Accept waits for and returns the next connection.
+func (l *Listener) Accept() (sockjs.Session, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSession(conn), nil
+}
+
+// URL returns the URL the listener can be dialed with.
+func (l *Listener) URL() string {
+	return Scheme + "://" + l.Addr().String()
+}
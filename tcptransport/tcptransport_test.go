@@ -0,0 +1,524 @@
+package tcptransport
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+)
+
+func TestTransport(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+	defer l.Close()
+
+	server := kite.New("server", "0.0.1")
+	defer server.Close()
+
+	server.HandleFunc("square", func(r *kite.Request) (interface{}, error) {
+		n := r.Args.One().MustFloat64()
+		return n * n, nil
+	}).DisableAuthentication()
+
+	go server.ServeTransport(l)
+
+	client := kite.New("client", "0.0.1")
+	defer client.Close()
+
+	c := client.NewClient(l.URL())
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	result, err := c.Tell("square", 4)
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if n := result.MustFloat64(); n != 16 {
+		t.Fatalf("got %v, want 16", n)
+	}
+
+	if addr := c.RemoteAddr(); addr != l.Addr().String() {
+		t.Fatalf("got %q, want %q", addr, l.Addr().String())
+	}
+}
+
+func TestTransport_Reconnect(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+	defer l.Close()
+
+	server := kite.New("server", "0.0.1")
+	defer server.Close()
+
+	connected := make(chan *kite.Client, 2)
+	server.OnConnect(func(c *kite.Client) { connected <- c })
+
+	go server.ServeTransport(l)
+
+	client := kite.New("client", "0.0.1")
+	defer client.Close()
+
+	c := client.NewClient(l.URL())
+	c.Reconnect = true
+	c.ReconnectPolicy = &kite.ReconnectPolicy{
+		InitialInterval: 10 * time.Millisecond,
+	}
+
+	reconnected := make(chan struct{}, 1)
+	c.OnReconnect(func() { reconnected <- struct{}{} })
+
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	select {
+	case remote := <-connected:
+		remote.Close() // drop the connection
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the connection")
+	}
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the client to reconnect")
+	}
+}
+
+func TestTransport_ReconnectQueue(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+	defer l.Close()
+
+	server := kite.New("server", "0.0.1")
+	defer server.Close()
+
+	server.HandleFunc("square", func(r *kite.Request) (interface{}, error) {
+		n := r.Args.One().MustFloat64()
+		return n * n, nil
+	}).DisableAuthentication()
+
+	connected := make(chan *kite.Client, 2)
+	server.OnConnect(func(c *kite.Client) { connected <- c })
+
+	go server.ServeTransport(l)
+
+	client := kite.New("client", "0.0.1")
+	defer client.Close()
+
+	c := client.NewClient(l.URL())
+	c.Reconnect = true
+	c.ReconnectPolicy = &kite.ReconnectPolicy{
+		InitialInterval: 50 * time.Millisecond,
+		QueueSize:       10,
+	}
+
+	type result struct {
+		n   float64
+		err error
+	}
+
+	results := make(chan result, 1)
+
+	// The call is made while the client is reconnecting.
+	c.OnDisconnect(func() {
+		go func() {
+			res, err := c.TellWithTimeout("square", 5*time.Second, 3)
+			if err != nil {
+				results <- result{err: err}
+				return
+			}
+
+			results <- result{n: res.MustFloat64()}
+		}()
+	})
+
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	select {
+	case remote := <-connected:
+		remote.Close() // drop the connection
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the connection")
+	}
+
+	select {
+	case res := <-results:
+		if res.err != nil {
+			t.Fatalf("TellWithTimeout()=%s", res.err)
+		}
+
+		if res.n != 9 {
+			t.Fatalf("got %v, want 9", res.n)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the queued call")
+	}
+}
+
+func TestTransport_Msgpack(t *testing.T) {
+	for _, both := range []bool{true, false} {
+		l, err := Listen("127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Listen()=%s", err)
+		}
+		defer l.Close()
+
+		server := kite.New("server", "0.0.1")
+		defer server.Close()
+
+		server.AddFeature(kite.FeatureMsgpack)
+		server.HandleFunc("echo", func(r *kite.Request) (interface{}, error) {
+			return r.Args.One(), nil
+		}).DisableAuthentication()
+
+		go server.ServeTransport(l)
+
+		client := kite.New("client", "0.0.1")
+		defer client.Close()
+
+		if both {
+			client.AddFeature(kite.FeatureMsgpack)
+		}
+
+		c := client.NewClient(l.URL())
+		if err := c.Dial(); err != nil {
+			t.Fatalf("Dial()=%s", err)
+		}
+		defer c.Close()
+
+		want := kite.EncodingJSON
+		if both {
+			want = kite.EncodingMsgpack
+		}
+
+		if !c.SupportsFeature(kite.FeatureMsgpack) {
+			t.Fatal("want server to support msgpack")
+		}
+
+		if enc := c.Encoding(); enc != want {
+			t.Fatalf("got %q encoding, want %q", enc, want)
+		}
+
+		arg := map[string]interface{}{
+			"text":   "żółw\n\"",
+			"number": 1.5,
+			"list":   []interface{}{float64(-300), nil, true},
+		}
+
+		for i := 0; i < 3; i++ {
+			result, err := c.Tell("echo", arg)
+			if err != nil {
+				t.Fatalf("Tell()=%s", err)
+			}
+
+			var got map[string]interface{}
+			if err := result.Unmarshal(&got); err != nil {
+				t.Fatalf("Unmarshal()=%s", err)
+			}
+
+			if !reflect.DeepEqual(got, arg) {
+				t.Fatalf("got %#v, want %#v", got, arg)
+			}
+		}
+
+		data := []byte{0x00, 0xc4, 0xff, '"'}
+
+		result, err := c.Tell("echo", data)
+		if err != nil {
+			t.Fatalf("Tell()=%s", err)
+		}
+
+		var got []byte
+		if err := result.Unmarshal(&got); err != nil {
+			t.Fatalf("Unmarshal()=%s", err)
+		}
+
+		if !reflect.DeepEqual(got, data) {
+			t.Fatalf("got %v, want %v", got, data)
+		}
+	}
+}
+
+func TestTransport_LazyFeatures(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+	defer l.Close()
+
+	server := kite.New("server", "0.0.1")
+	defer server.Close()
+
+	server.AddFeature("streaming")
+	server.HandleFunc("echo", func(r *kite.Request) (interface{}, error) {
+		return r.Args.One(), nil
+	}).DisableAuthentication()
+
+	var mu sync.Mutex
+	var called []string
+
+	server.PreHandleFunc(func(r *kite.Request) (interface{}, error) {
+		mu.Lock()
+		called = append(called, r.Method)
+		mu.Unlock()
+		return nil, nil
+	})
+
+	go server.ServeTransport(l)
+
+	client := kite.New("client", "0.0.1")
+	defer client.Close()
+
+	c := client.NewClient(l.URL())
+
+	// The calls of the kite itself bypass the interceptors.
+	c.Intercept(func(call *kite.Call, next kite.Invoker) (*kite.Result, error) {
+		if call.Method == "kite.features" {
+			t.Errorf("intercepted %s", call.Method)
+		}
+		return next(call)
+	})
+
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Tell("echo", 1); err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	count := func() (n int) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, method := range called {
+			if method == "kite.features" {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := count(); n != 0 {
+		t.Fatalf("got %d kite.features calls before the first use, want 0", n)
+	}
+
+	if !c.SupportsFeature("streaming") || c.SupportsFeature("msgpack") {
+		t.Fatalf("got %v features, want [streaming]", c.Features())
+	}
+
+	if n := count(); n != 1 {
+		t.Fatalf("got %d kite.features calls, want 1", n)
+	}
+}
+
+func TestTransport_KeepAlive(t *testing.T) {
+	// The silent listener accepts connections, but never replies,
+	// like a peer that is gone without closing them.
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+	defer silent.Close()
+
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	l, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+	defer l.Close()
+
+	server := kite.New("server", "0.0.1")
+	defer server.Close()
+
+	go server.ServeTransport(l)
+
+	client := kite.New("client", "0.0.1")
+	defer client.Close()
+
+	client.Config.PingInterval = 50 * time.Millisecond
+	client.Config.PongTimeout = 100 * time.Millisecond
+
+	for _, url := range []string{l.URL(), Scheme + "://" + silent.Addr().String()} {
+		c := client.NewClient(url)
+
+		disconnected := make(chan struct{}, 1)
+		c.OnDisconnect(func() { disconnected <- struct{}{} })
+
+		if err := c.Dial(); err != nil {
+			t.Fatalf("Dial()=%s", err)
+		}
+		defer c.Close()
+
+		alive := url == l.URL()
+
+		select {
+		case <-disconnected:
+			if alive {
+				t.Fatalf("%s: want connection to be kept alive", url)
+			}
+		case <-time.After(time.Second):
+			if !alive {
+				t.Fatalf("%s: timed out waiting for the dead peer to be detected", url)
+			}
+		}
+	}
+}
+
+func TestTransport_Latency(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+	defer l.Close()
+
+	server := kite.New("server", "0.0.1")
+	defer server.Close()
+
+	go server.ServeTransport(l)
+
+	client := kite.New("client", "0.0.1")
+	defer client.Close()
+
+	c := client.NewClient(l.URL())
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	rtt, err := c.Ping()
+	if err != nil {
+		t.Fatalf("Ping()=%s", err)
+	}
+
+	if rtt <= 0 || c.Latency() != rtt {
+		t.Fatalf("got rtt=%s, latency=%s", rtt, c.Latency())
+	}
+
+	client.Config.LatencyInterval = 20 * time.Millisecond
+
+	c = client.NewClient(l.URL())
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	timeout := time.After(time.Second)
+	for c.Latency() == 0 {
+		select {
+		case <-timeout:
+			t.Fatal("timed out waiting for the latency to be measured")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestTransport_ClientPool(t *testing.T) {
+	client := kite.New("client", "0.0.1")
+	defer client.Close()
+
+	var (
+		clients []*kite.Client
+		remotes = make(chan *kite.Client, 2)
+		mu      sync.Mutex
+		calls   = make(map[string]int)
+	)
+
+	for _, name := range []string{"a", "b"} {
+		l, err := Listen("127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Listen()=%s", err)
+		}
+		defer l.Close()
+
+		server := kite.New(name, "0.0.1")
+		defer server.Close()
+
+		server.HandleFunc("name", func(r *kite.Request) (interface{}, error) {
+			mu.Lock()
+			calls[r.LocalKite.Kite().Name]++
+			mu.Unlock()
+
+			return r.LocalKite.Kite().Name, nil
+		}).DisableAuthentication()
+
+		if name == "a" {
+			server.OnConnect(func(c *kite.Client) { remotes <- c })
+		}
+
+		go server.ServeTransport(l)
+
+		c := client.NewClient(l.URL())
+		if err := c.Dial(); err != nil {
+			t.Fatalf("Dial()=%s", err)
+		}
+
+		clients = append(clients, c)
+	}
+
+	pool := kite.NewClientPool(clients, kite.RoundRobin)
+	defer pool.Close()
+
+	for i := 0; i < 4; i++ {
+		if _, err := pool.Tell("name"); err != nil {
+			t.Fatalf("Tell()=%s", err)
+		}
+	}
+
+	mu.Lock()
+	a, b := calls["a"], calls["b"]
+	mu.Unlock()
+
+	if a != 2 || b != 2 {
+		t.Fatalf("got %d and %d calls, want 2 calls per kite", a, b)
+	}
+
+	(<-remotes).Close() // a goes away
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(pool.Clients()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the dead member to be removed")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i := 0; i < 3; i++ {
+		result, err := pool.Tell("name")
+		if err != nil {
+			t.Fatalf("Tell()=%s", err)
+		}
+
+		if name := result.MustString(); name != "b" {
+			t.Fatalf("got %q, want %q", name, "b")
+		}
+	}
+}
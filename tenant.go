@@ -0,0 +1,92 @@
+package kite
+
+import "context"
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx that carries the given tenant ID. Calls
+// made with Client.TellWithContext send the tenant to the remote kite,
+// which accepts it only from the callers listed in its Config.Impersonators,
+// see Request.Tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// acceptTenant sets the tenant of the authenticated request to the one
+// sent by the caller, if the credentials of the caller carry no tenant
+// and the caller is trusted to act on behalf of others.
+func (r *Request) acceptTenant() {
+	if r.Tenant != "" || r.tenant == "" {
+		return
+	}
+
+	caller := r.Username
+	if r.Actor != "" {
+		caller = r.Actor
+	}
+
+	if !r.LocalKite.canImpersonate(caller) {
+		r.LocalKite.Log.Debug("Tenant %q sent by %q calling %q is ignored", r.tenant, caller, r.Method)
+		return
+	}
+
+	r.Tenant = r.tenant
+}
+
+// TenantFromContext returns the tenant ID carried by ctx, or an empty string
+// if there is none.
+func TenantFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// Logger returns the logger of the local kite, which prefixes every message
+// with the tenant of the request, if there is one. FieldLogger loggers get
+// the tenant as the "tenant" field instead.
+func (r *Request) Logger() Logger {
+	if r.Tenant == "" {
+		return r.LocalKite.Log
+	}
+
+	if l, ok := r.LocalKite.Log.(FieldLogger); ok {
+		return l.WithFields(Fields{"tenant": r.Tenant})
+	}
+
+	return &tenantLogger{
+		Logger: r.LocalKite.Log,
+		tenant: r.Tenant,
+	}
+}
+
+type tenantLogger struct {
+	Logger
+	tenant string
+}
+
+func (l *tenantLogger) args(args []interface{}) []interface{} {
+	return append([]interface{}{l.tenant}, args...)
+}
+
+func (l *tenantLogger) Fatal(format string, args ...interface{}) {
+	l.Logger.Fatal("[tenant %s] "+format, l.args(args)...)
+}
+
+func (l *tenantLogger) Error(format string, args ...interface{}) {
+	l.Logger.Error("[tenant %s] "+format, l.args(args)...)
+}
+
+func (l *tenantLogger) Warning(format string, args ...interface{}) {
+	l.Logger.Warning("[tenant %s] "+format, l.args(args)...)
+}
+
+func (l *tenantLogger) Info(format string, args ...interface{}) {
+	l.Logger.Info("[tenant %s] "+format, l.args(args)...)
+}
+
+func (l *tenantLogger) Debug(format string, args ...interface{}) {
+	l.Logger.Debug("[tenant %s] "+format, l.args(args)...)
+}
@@ -0,0 +1,107 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/koding/kite/config"
+)
+
+type recordLogger struct {
+	Logger
+	lines []string
+}
+
+func (l *recordLogger) Error(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Info(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestTenantFromContext(t *testing.T) {
+	if tenant := TenantFromContext(context.Background()); tenant != "" {
+		t.Fatalf("want no tenant, got %q", tenant)
+	}
+
+	ctx := WithTenant(context.Background(), "acme")
+
+	if tenant := TenantFromContext(ctx); tenant != "acme" {
+		t.Fatalf("want %q, got %q", "acme", tenant)
+	}
+}
+
+func TestRequest_AcceptTenant(t *testing.T) {
+	log, _ := newLogger("tenant")
+
+	k := &Kite{
+		Config: config.New(),
+		Log:    log,
+	}
+	k.Config.Impersonators = []string{"operator"}
+
+	cases := map[string]struct {
+		username string
+		actor    string
+		claim    string
+		sent     string
+		want     string
+	}{
+		"claim": {
+			username: "bob",
+			claim:    "acme",
+			sent:     "other",
+			want:     "acme",
+		},
+		"untrusted caller": {
+			username: "bob",
+			sent:     "other",
+		},
+		"impersonator": {
+			username: "operator",
+			sent:     "acme",
+			want:     "acme",
+		},
+		"impersonating": {
+			username: "alice",
+			actor:    "operator",
+			sent:     "acme",
+			want:     "acme",
+		},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := &Request{
+				Method:    "foo",
+				LocalKite: k,
+				Username:  cas.username,
+				Actor:     cas.actor,
+				Tenant:    cas.claim,
+				tenant:    cas.sent,
+			}
+
+			r.acceptTenant()
+
+			if r.Tenant != cas.want {
+				t.Fatalf("got %q, want %q", r.Tenant, cas.want)
+			}
+		})
+	}
+}
+
+func TestRequest_Logger(t *testing.T) {
+	l := &recordLogger{}
+	k := &Kite{Log: l}
+
+	(&Request{LocalKite: k}).Logger().Error("failed: %s", "%d")
+	(&Request{LocalKite: k, Tenant: "acme"}).Logger().Error("failed: %s", "%d")
+
+	want := []string{"failed: %d", "[tenant acme] failed: %d"}
+
+	if fmt.Sprint(l.lines) != fmt.Sprint(want) {
+		t.Fatalf("want %q, got %q", want, l.lines)
+	}
+}
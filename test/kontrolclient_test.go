@@ -34,6 +34,10 @@ func init() {
 	switch os.Getenv("KONTROL_STORAGE") {
 	case "etcd":
 		kon.SetStorage(kontrol.NewEtcd(nil, kon.Kite.Log))
+	case "etcdv3":
+		e := kontrol.NewEtcdV3(nil, kon.Kite.Log)
+		kon.SetStorage(e)
+		kon.SetKeyPairStorage(e)
 	case "postgres":
 		p := kontrol.NewPostgres(nil, kon.Kite.Log)
 		kon.SetStorage(p)
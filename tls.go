@@ -0,0 +1,92 @@
+package kite
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// setupTLS sets up the TLS configuration the kite server is served with,
+// the Kite.TLSConfig is made of the certificates in the config, unless it
+// was set. The server is not served over TLS when both are missing.
+func (k *Kite) setupTLS() error {
+	if k.TLSConfig == nil && k.Config.TLSCertFile != "" {
+		certs, err := loadCertificates(k.Config.TLSCertFile, k.Config.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+
+		k.TLSConfig = &tls.Config{Certificates: certs}
+	}
+
+	if k.TLSConfig == nil {
+		return nil
+	}
+
+	if k.Config.TLSClientCAFile != "" && k.TLSConfig.ClientCAs == nil {
+		pool, err := loadCertPool(k.Config.TLSClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		k.TLSConfig.ClientCAs = pool
+		k.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+
+		if k.Config.TLSClientCertOptional {
+			k.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	if k.TLSConfig.NextProtos == nil {
+		k.TLSConfig.NextProtos = []string{"http/1.1"}
+	}
+
+	// Without the map the first certificate is served for all the names.
+	if len(k.TLSConfig.Certificates) > 1 && k.TLSConfig.NameToCertificate == nil && k.TLSConfig.GetCertificate == nil {
+		k.TLSConfig.BuildNameToCertificate()
+	}
+
+	return nil
+}
+
+// loadCertificates loads the key pairs from the comma-separated lists of
+// the certificate and key files.
+func loadCertificates(certFiles, keyFiles string) ([]tls.Certificate, error) {
+	certs := strings.Split(certFiles, ",")
+	keys := strings.Split(keyFiles, ",")
+
+	if len(certs) != len(keys) {
+		return nil, fmt.Errorf("got %d TLS certificate files and %d key files", len(certs), len(keys))
+	}
+
+	pairs := make([]tls.Certificate, len(certs))
+
+	for i := range certs {
+		cert, err := tls.LoadX509KeyPair(strings.TrimSpace(certs[i]), strings.TrimSpace(keys[i]))
+		if err != nil {
+			return nil, err
+		}
+
+		pairs[i] = cert
+	}
+
+	return pairs, nil
+}
+
+// loadCertPool loads the PEM-encoded certificates from the file.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	p, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(p) {
+		return nil, errors.New("no certificates found in " + file)
+	}
+
+	return pool, nil
+}
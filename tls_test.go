@@ -0,0 +1,176 @@
+package kite
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pair tls.Certificate
+}
+
+// newTestCert creates a certificate for the names signed by the parent,
+// the certificate is a self-signed CA if the parent is nil.
+func newTestCert(t *testing.T, parent *testCert, names ...string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey()=%s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "kite test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     names,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate()=%s", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate()=%s", err)
+	}
+
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pair: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+	}
+}
+
+// write writes the certificate and its key to the dir, it returns the paths
+// of the files.
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey()=%s", err)
+	}
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+"-key.pem")
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	if err := ioutil.WriteFile(certFile, certPEM, 0644); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestKite_TLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kite-tls")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, nil)
+	caFile, _ := ca.write(t, dir, "ca")
+
+	certA, keyA := newTestCert(t, ca, "a.example.com").write(t, dir, "a")
+	certB, keyB := newTestCert(t, ca, "b.example.com").write(t, dir, "b")
+	client := newTestCert(t, ca, "client")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	for _, optional := range []bool{false, true} {
+		conf := config.New()
+		conf.IP = "127.0.0.1"
+		conf.Port = 0
+		conf.TLSCertFile = strings.Join([]string{certA, certB}, ",")
+		conf.TLSKeyFile = strings.Join([]string{keyA, keyB}, ",")
+		conf.TLSClientCAFile = caFile
+		conf.TLSClientCertOptional = optional
+
+		k := NewWithConfig("secure", "0.0.1", conf)
+
+		go k.Run()
+		<-k.ServerReadyNotify()
+
+		get := func(serverName string, certs ...tls.Certificate) (*x509.Certificate, error) {
+			tr := &http.Transport{
+				TLSClientConfig: &tls.Config{
+					ServerName:   serverName,
+					RootCAs:      roots,
+					Certificates: certs,
+				},
+			}
+			defer tr.CloseIdleConnections()
+
+			resp, err := (&http.Client{Transport: tr}).Get(fmt.Sprintf("https://127.0.0.1:%d/", k.Port()))
+			if err != nil {
+				return nil, err
+			}
+			resp.Body.Close()
+
+			return resp.TLS.PeerCertificates[0], nil
+		}
+
+		for _, name := range []string{"a.example.com", "b.example.com"} {
+			cert, err := get(name, client.pair)
+			if err != nil {
+				t.Fatalf("%s: Get()=%s", name, err)
+			}
+
+			if cert.DNSNames[0] != name {
+				t.Fatalf("got certificate of %q, want %q", cert.DNSNames[0], name)
+			}
+		}
+
+		_, err := get("a.example.com")
+
+		if optional && err != nil {
+			t.Fatalf("want client certificate to be optional, got %s", err)
+		}
+
+		if !optional && err == nil {
+			t.Fatal("want client certificate to be required")
+		}
+
+		_, err = get("a.example.com", newTestCert(t, nil, "untrusted").pair)
+		if err == nil {
+			t.Fatal("want untrusted client certificate to be rejected")
+		}
+
+		k.Close()
+	}
+}
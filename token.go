@@ -0,0 +1,93 @@
+package kite
+
+import (
+	"errors"
+	"time"
+
+	"github.com/koding/kite/kitekey"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// ValidateToken validates the token issued by Kontrol for this kite and
+// returns its claims. The token must be signed with a trusted key and
+// have this kite as the audience. The exp, nbf and iat claims are
+// validated tolerating Config.ClockSkew of difference between the clocks.
+//
+// It is used by the "token" authenticator and can be used outside of
+// the request path as well, e.g. for validating tokens passed over HTTP.
+func (k *Kite) ValidateToken(token string) (*kitekey.KiteClaims, error) {
+	k.verifyOnce.Do(k.verifyInit)
+
+	claims := &kitekey.KiteClaims{}
+
+	// The claims are validated below, the parser does not support
+	// clock skew.
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+
+	t, err := parser.ParseWithClaims(token, claims, k.RSAKey)
+
+	if e, ok := err.(*jwt.ValidationError); ok {
+		// Translate public key mismatch errors to token-is-expired one.
+		// This is to signal remote client the key pairs have been
+		// updated on kontrol and it should invalidate all tokens.
+		if (e.Errors & jwt.ValidationErrorSignatureInvalid) != 0 {
+			return nil, errors.New("token is expired")
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !t.Valid {
+		return nil, errors.New("Invalid signature in token")
+	}
+
+	if err := validateTimeClaims(&claims.StandardClaims, time.Now().UTC(), k.Config.ClockSkew); err != nil {
+		return nil, err
+	}
+
+	if claims.Id != "" && k.IsTokenRevoked(claims.Id) {
+		return nil, errors.New("token is revoked")
+	}
+
+	if claims.Audience == "" {
+		return nil, errors.New("token has no audience")
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("token has no username")
+	}
+
+	// check if we have an audience and it matches our own signature
+	if err := k.verifyAudienceFunc(k.Kite(), claims.Audience); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// validateTimeClaims validates the exp, nbf and iat claims, tolerating
+// the given clock skew. The claims are optional.
+func validateTimeClaims(claims *jwt.StandardClaims, now time.Time, skew time.Duration) error {
+	if skew < 0 {
+		skew = 0
+	}
+
+	if !claims.VerifyExpiresAt(now.Add(-skew).Unix(), false) {
+		// The message is recognized by the clients, which renew
+		// the token then, see Client.OnTokenExpire.
+		return errors.New("token is expired")
+	}
+
+	if !claims.VerifyNotBefore(now.Add(skew).Unix(), false) {
+		return errors.New("token is not valid yet")
+	}
+
+	if !claims.VerifyIssuedAt(now.Add(skew).Unix(), false) {
+		return errors.New("token used before issued")
+	}
+
+	return nil
+}
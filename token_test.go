@@ -0,0 +1,62 @@
+package kite
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestValidateTimeClaims(t *testing.T) {
+	now := time.Now().UTC()
+
+	cases := []struct {
+		name   string
+		claims jwt.StandardClaims
+		skew   time.Duration
+		ok     bool
+	}{{
+		name:   "valid",
+		claims: jwt.StandardClaims{ExpiresAt: now.Add(time.Hour).Unix(), NotBefore: now.Unix(), IssuedAt: now.Unix()},
+		ok:     true,
+	}, {
+		name: "no claims",
+		ok:   true,
+	}, {
+		name:   "expired",
+		claims: jwt.StandardClaims{ExpiresAt: now.Add(-time.Minute).Unix()},
+		skew:   30 * time.Second,
+	}, {
+		name:   "expired within skew",
+		claims: jwt.StandardClaims{ExpiresAt: now.Add(-10 * time.Second).Unix()},
+		skew:   30 * time.Second,
+		ok:     true,
+	}, {
+		name:   "not valid yet",
+		claims: jwt.StandardClaims{NotBefore: now.Add(time.Minute).Unix()},
+		skew:   30 * time.Second,
+	}, {
+		name:   "issuer clock ahead",
+		claims: jwt.StandardClaims{NotBefore: now.Add(10 * time.Second).Unix(), IssuedAt: now.Add(10 * time.Second).Unix()},
+		skew:   30 * time.Second,
+		ok:     true,
+	}, {
+		name:   "issuer clock ahead without skew",
+		claims: jwt.StandardClaims{IssuedAt: now.Add(10 * time.Second).Unix()},
+		skew:   -1,
+	}}
+
+	for _, cas := range cases {
+		t.Run(cas.name, func(t *testing.T) {
+			err := validateTimeClaims(&cas.claims, now, cas.skew)
+
+			if cas.ok && err != nil {
+				t.Fatalf("validateTimeClaims()=%s", err)
+			}
+
+			if !cas.ok && err == nil {
+				t.Fatal("want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package kite
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/protocol"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// renewJitter is the maximum random time added to renewBefore, so the
+// tokens cached by many kites are not renewed all at once.
+const renewJitter = 30 * time.Second
+
+// tokenCache holds the tokens of the clients returned by GetKites, keyed by
+// their audience, see Config.TokenCache. Clients of kites with the same
+// audience, e.g. instances of a service, share a single token, which is
+// renewed in the background before it expires.
+type tokenCache struct {
+	k *Kite
+
+	mu     sync.Mutex
+	tokens map[string]*cachedToken // by audience
+	closed bool
+}
+
+// cachedToken is a token shared by the clients of kites with the same
+// audience.
+type cachedToken struct {
+	audience   string
+	token      string
+	validUntil time.Time
+	clients    map[*Client]struct{}
+	timer      *time.Timer
+}
+
+func newTokenCache(k *Kite) *tokenCache {
+	return &tokenCache{
+		k:      k,
+		tokens: make(map[string]*cachedToken),
+	}
+}
+
+// tokenCache returns the token cache of the kite, creating it on
+// first use.
+func (k *Kite) tokenCache() *tokenCache {
+	k.tokensOnce.Do(func() {
+		k.tokens = newTokenCache(k)
+	})
+
+	return k.tokens
+}
+
+// add makes the client use the cached token of its audience. If the token
+// of the client is valid for longer, it replaces the cached one.
+func (tc *tokenCache) add(c *Client) error {
+	audience, validUntil, err := tc.parse(c.Auth.Key)
+	if err != nil {
+		return err
+	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	ct, ok := tc.tokens[audience]
+	if !ok {
+		ct = &cachedToken{
+			audience: audience,
+			clients:  make(map[*Client]struct{}),
+		}
+		tc.tokens[audience] = ct
+	}
+
+	ct.clients[c] = struct{}{}
+	c.tokenAudience = audience
+
+	c.OnTokenExpire(func() { tc.renewNow(audience) })
+
+	if validUntil.After(ct.validUntil) {
+		ct.token = c.Auth.Key
+		ct.validUntil = validUntil
+		tc.schedule(ct, tc.renewDuration(validUntil))
+		return nil
+	}
+
+	c.authMu.Lock()
+	c.Auth.Key = ct.token
+	c.authMu.Unlock()
+
+	return nil
+}
+
+// remove stops renewing the token of the closed client. The cached token
+// is dropped when its last client is closed.
+func (tc *tokenCache) remove(c *Client) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	ct, ok := tc.tokens[c.tokenAudience]
+	if !ok {
+		return
+	}
+
+	delete(ct.clients, c)
+
+	if len(ct.clients) == 0 {
+		if ct.timer != nil {
+			ct.timer.Stop()
+		}
+
+		delete(tc.tokens, ct.audience)
+	}
+}
+
+// close stops renewing all the tokens.
+func (tc *tokenCache) close() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.closed = true
+
+	for _, ct := range tc.tokens {
+		if ct.timer != nil {
+			ct.timer.Stop()
+		}
+	}
+}
+
+// renewNow renews the token of the audience right away, it is called when
+// a remote kite reports the token as expired.
+func (tc *tokenCache) renewNow(audience string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if ct, ok := tc.tokens[audience]; ok {
+		tc.schedule(ct, 0)
+	}
+}
+
+// schedule renews the token after d. Must be called with tc.mu held.
+func (tc *tokenCache) schedule(ct *cachedToken, d time.Duration) {
+	if tc.closed {
+		return
+	}
+
+	if ct.timer != nil {
+		ct.timer.Stop()
+	}
+
+	ct.timer = time.AfterFunc(d, func() { tc.renew(ct) })
+}
+
+// renew gets a new token for the audience and passes it to the clients.
+func (tc *tokenCache) renew(ct *cachedToken) {
+	tc.mu.Lock()
+	kites := make([]protocol.Kite, 0, len(ct.clients))
+	for c := range ct.clients {
+		kites = append(kites, c.Kite)
+	}
+	tc.mu.Unlock()
+
+	if len(kites) == 0 {
+		return
+	}
+
+	var (
+		token string
+		err   error
+	)
+
+	// Any of the kites with the audience will do, they may be gone though.
+	for i := range kites {
+		if token, err = tc.k.GetToken(&kites[i]); err == nil {
+			break
+		}
+	}
+
+	var validUntil time.Time
+	if err == nil {
+		_, validUntil, err = tc.parse(token)
+	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.tokens[ct.audience] != ct {
+		return // all the clients are closed
+	}
+
+	// Kontrol caches the tokens it issues, so it may reply with the
+	// same one when asked too early.
+	if err == nil && !validUntil.After(ct.validUntil) {
+		tc.schedule(ct, retryInterval)
+		return
+	}
+
+	if err != nil {
+		tc.k.Log.Error("token cache: Cannot renew token for %q: %s I will retry in %d seconds...",
+			ct.audience, err, retryInterval/time.Second)
+		tc.schedule(ct, retryInterval)
+		return
+	}
+
+	ct.token = token
+	ct.validUntil = validUntil
+
+	for c := range ct.clients {
+		c.authMu.Lock()
+		c.Auth.Key = token
+		c.authMu.Unlock()
+
+		go c.callOnTokenRenewHandlers(token)
+	}
+
+	tc.schedule(ct, tc.renewDuration(validUntil))
+}
+
+// renewDuration returns the time from now to renewing a token which is
+// valid until the given time.
+func (tc *tokenCache) renewDuration(validUntil time.Time) time.Duration {
+	jitter := time.Duration(rand.Int63n(int64(renewJitter)))
+
+	d := validUntil.Add(-renewBefore - jitter).Sub(time.Now().UTC())
+	if d < 0 {
+		d = 0
+	}
+
+	return d
+}
+
+// parse returns the audience and the expiration time of the token. Like
+// TokenRenewer, it ignores invalid signatures as the token may be signed
+// with a key we do not know.
+func (tc *tokenCache) parse(token string) (string, time.Time, error) {
+	claims := &kitekey.KiteClaims{}
+
+	_, err := jwt.ParseWithClaims(token, claims, tc.k.RSAKey)
+	if err != nil {
+		valErr, ok := err.(*jwt.ValidationError)
+		if !ok || (valErr.Errors&jwt.ValidationErrorSignatureInvalid) == 0 {
+			return "", time.Time{}, err
+		}
+	}
+
+	return claims.Audience, time.Unix(claims.ExpiresAt, 0).UTC(), nil
+}
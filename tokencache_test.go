@@ -0,0 +1,113 @@
+package kite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/koding/kite/kitekey"
+	"github.com/koding/kite/testkeys"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestTokenCache(t *testing.T) {
+	k := New("tokencache", "0.0.1")
+	defer k.Close()
+
+	key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(testkeys.Public))
+	if err != nil {
+		t.Fatalf("ParseRSAPublicKeyFromPEM()=%s", err)
+	}
+
+	k.Config.KontrolUser = "kontrol"
+	k.kontrolKey = key
+
+	sign := func(audience string, ttl time.Duration) string {
+		rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(testkeys.Private))
+		if err != nil {
+			t.Fatalf("ParseRSAPrivateKeyFromPEM()=%s", err)
+		}
+
+		claims := &kitekey.KiteClaims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    "kontrol",
+				Subject:   "testuser",
+				Audience:  audience,
+				ExpiresAt: time.Now().Add(ttl).Unix(),
+			},
+		}
+
+		token, err := jwt.NewWithClaims(jwt.GetSigningMethod("RS256"), claims).SignedString(rsaKey)
+		if err != nil {
+			t.Fatalf("SignedString()=%s", err)
+		}
+
+		return token
+	}
+
+	newClient := func(token string) *Client {
+		c := k.NewClient("")
+		c.Auth = &Auth{Type: "token", Key: token}
+		return c
+	}
+
+	longer := sign("/testuser/dev/backend", 2*time.Hour)
+
+	c1 := newClient(longer)
+	c2 := newClient(sign("/testuser/dev/backend", time.Hour))
+	c3 := newClient(sign("/testuser/dev/other", time.Hour))
+
+	tc := k.tokenCache()
+
+	for _, c := range []*Client{c1, c2, c3} {
+		if err := tc.add(c); err != nil {
+			t.Fatalf("add()=%s", err)
+		}
+	}
+
+	if c2.Auth.Key != longer {
+		t.Fatal("want the client to use the cached token, which is valid for longer")
+	}
+
+	if c3.Auth.Key == longer {
+		t.Fatal("want clients of other audiences to keep their tokens")
+	}
+
+	if n := len(tc.tokens); n != 2 {
+		t.Fatalf("got %d cached tokens, want 2", n)
+	}
+
+	c1.Close()
+
+	if _, ok := tc.tokens["/testuser/dev/backend"]; !ok {
+		t.Fatal("want the token to be cached while it is used")
+	}
+
+	c2.Close()
+	c3.Close()
+
+	if n := len(tc.tokens); n != 0 {
+		t.Fatalf("got %d cached tokens, want 0", n)
+	}
+}
+
+func TestTokenCache_RenewDuration(t *testing.T) {
+	tc := newTokenCache(nil)
+	validUntil := time.Now().UTC().Add(time.Hour)
+
+	for i := 0; i < 100; i++ {
+		d := tc.renewDuration(validUntil)
+
+		if max := time.Hour - renewBefore; d > max {
+			t.Fatalf("got %s, want at most %s", d, max)
+		}
+
+		if min := time.Hour - renewBefore - renewJitter - time.Second; d < min {
+			t.Fatalf("got %s, want at least %s", d, min)
+		}
+	}
+
+	if d := tc.renewDuration(time.Now().UTC()); d != 0 {
+		t.Fatalf("got %s, want 0 for expiring tokens", d)
+	}
+}
@@ -1,6 +1,7 @@
 package kite
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
@@ -20,11 +21,15 @@ const (
 type TokenRenewer struct {
 	client           *Client
 	localKite        *Kite
-	validUntil       time.Time
 	signalRenewToken chan struct{}
 	disconnect       chan struct{}
 	once             sync.Once // for c.installHandlers
 	renewLoopWG      sync.WaitGroup
+
+	mu         sync.Mutex // protects validUntil
+	validUntil time.Time
+
+	renewMu sync.Mutex // serializes renewals of the token
 }
 
 func NewTokenRenewer(r *Client, k *Kite) (*TokenRenewer, error) {
@@ -56,7 +61,10 @@ func (t *TokenRenewer) parse(tokenString string) error {
 		}
 	}
 
+	t.mu.Lock()
 	t.validUntil = time.Unix(claims.ExpiresAt, 0).UTC()
+	t.mu.Unlock()
+
 	return nil
 }
 
@@ -109,9 +117,19 @@ func (t *TokenRenewer) renewLoop() {
 // The duration from now to the time token needs to be renewed.
 // Needs to be calculated after renewing the token.
 func (t *TokenRenewer) renewDuration() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	return t.validUntil.Add(-renewBefore).Sub(time.Now().UTC())
 }
 
+// expiresSoon tells whether the token is to be renewed already, which
+// happens when the renewal was delayed, e.g. by the machine sleeping or
+// by Kontrol being unavailable.
+func (t *TokenRenewer) expiresSoon() bool {
+	return t.renewDuration() <= 0
+}
+
 func (t *TokenRenewer) startRenewLoop() {
 	// In case when t.client missed a disconnect signal (e.g. due to timeout observed
 	// by the remote end), previous renewLoop will be still running.
@@ -142,11 +160,39 @@ func (t *TokenRenewer) sendDisconnectSignal() {
 
 // renewToken gets a new token from a kontrolClient, parses it and sets it as the token.
 func (t *TokenRenewer) renewToken() error {
+	t.renewMu.Lock()
+	defer t.renewMu.Unlock()
+
+	return t.renew(context.Background())
+}
+
+// renewExpiring renews the token before a call is sent with it, if it
+// expires too soon to wait for the renewal in background. The ctx bounds
+// waiting for Kontrol.
+func (t *TokenRenewer) renewExpiring(ctx context.Context) error {
+	if !t.expiresSoon() {
+		return nil
+	}
+
+	t.renewMu.Lock()
+	defer t.renewMu.Unlock()
+
+	// The token may have been renewed while waiting for the lock.
+	if !t.expiresSoon() {
+		return nil
+	}
+
+	return t.renew(ctx)
+}
+
+func (t *TokenRenewer) renew(ctx context.Context) error {
+	t.client.m.RLock()
 	renew := &protocol.Kite{
 		ID: t.client.Kite.ID,
 	}
+	t.client.m.RUnlock()
 
-	token, err := t.localKite.GetToken(renew)
+	token, err := t.localKite.getToken(ctx, renew)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,39 @@
+package kite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/config"
+)
+
+func TestTokenRenewer_RenewExpiring(t *testing.T) {
+	conf := config.New()
+	conf.KontrolURL = "http://127.0.0.1:1/kite" // never connects
+
+	k := NewWithConfig("renewer", "0.0.1", conf)
+	defer k.Close()
+
+	c := k.NewClient("http://127.0.0.1:1/kite")
+	c.Auth = &Auth{Type: "token"}
+
+	r := &TokenRenewer{
+		client:     c,
+		localKite:  k,
+		validUntil: time.Now().UTC().Add(time.Hour),
+	}
+
+	if err := r.renewExpiring(context.Background()); err != nil {
+		t.Fatalf("renewExpiring()=%s", err)
+	}
+
+	r.validUntil = time.Now().UTC().Add(renewBefore / 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := r.renewExpiring(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,75 @@
+package kite
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+const (
+	traceIn  = "<-"
+	traceOut = "->"
+)
+
+// SetTrace enables or disables tracing at runtime, overriding Config.Trace.
+// When tracing is enabled, every frame sent or received by the kite is
+// logged on the INFO level, tagged with the session ID, the remote kite
+// and the method or callback ID of the message, which correlates calls
+// with their responses. Payloads have the fields registered with
+// RedactFields redacted, are passed to TraceRedact, if it is set, and then
+// truncated to Config.TraceMaxPayload bytes.
+//
+// Tracing is meant for diagnosing protocol issues and has a significant
+// overhead, it should not be left enabled.
+func (k *Kite) SetTrace(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&k.trace, 1)
+	} else {
+		atomic.StoreInt32(&k.trace, -1)
+	}
+}
+
+// Trace returns true if tracing is enabled.
+func (k *Kite) Trace() bool {
+	switch atomic.LoadInt32(&k.trace) {
+	case 1:
+		return true
+	case -1:
+		return false
+	default:
+		return k.Config.Trace
+	}
+}
+
+// traceFrame logs the frame if tracing is enabled.
+func (c *Client) traceFrame(dir string, p []byte) {
+	k := c.LocalKite
+	if k == nil || !k.Trace() {
+		return
+	}
+
+	var msg struct {
+		Method interface{} `json:"method"`
+	}
+
+	// Malformed frames are traced as well, thus the error is ignored.
+	json.Unmarshal(p, &msg)
+
+	session := "-"
+	if s := c.getSession(); s != nil {
+		session = s.ID()
+	}
+
+	payload := k.redactJSON(p)
+	if k.TraceRedact != nil {
+		payload = k.TraceRedact(payload)
+	}
+
+	var truncated string
+	if max := k.Config.TraceMaxPayload; max > 0 && len(payload) > max {
+		truncated = fmt.Sprintf(" (%d bytes truncated)", len(payload)-max)
+		payload = payload[:max]
+	}
+
+	k.Log.Info("trace %s session=%s kite=%s method=%v: %s%s", dir, session, c.Kite.ID, msg.Method, payload, truncated)
+}
@@ -0,0 +1,58 @@
+package kite
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/koding/kite/config"
+)
+
+func TestClient_TraceFrame(t *testing.T) {
+	l := &recordLogger{}
+	k := &Kite{Log: l, Config: config.New()}
+	k.Config.TraceMaxPayload = 32
+	k.TraceRedact = func(p []byte) []byte {
+		return bytes.Replace(p, []byte("secret"), []byte("******"), -1)
+	}
+
+	c := &Client{LocalKite: k}
+	c.Kite.ID = "remote"
+
+	frame := []byte(`{"method":"square","arguments":["secret",1234567890]}`)
+
+	c.traceFrame(traceIn, frame)
+
+	if len(l.lines) != 0 {
+		t.Fatalf("want no trace, got %q", l.lines)
+	}
+
+	k.SetTrace(true)
+	c.traceFrame(traceIn, frame)
+	c.traceFrame(traceOut, []byte(`{"method":3,"arguments":[]}`))
+
+	want := []string{
+		`trace <- session=- kite=remote method=square: {"method":"square","arguments":[ (21 bytes truncated)`,
+		`trace -> session=- kite=remote method=3: {"method":3,"arguments":[]}`,
+	}
+
+	if fmt.Sprint(l.lines) != fmt.Sprint(want) {
+		t.Fatalf("want %q, got %q", want, l.lines)
+	}
+
+	l.lines = nil
+	k.Config.TraceMaxPayload = 0
+	c.traceFrame(traceIn, frame)
+
+	if want := `trace <- session=- kite=remote method=square: {"method":"square","arguments":["******",1234567890]}`; len(l.lines) != 1 || l.lines[0] != want {
+		t.Fatalf("want %q, got %q", want, l.lines)
+	}
+
+	k.SetTrace(false)
+	k.Config.Trace = true
+	c.traceFrame(traceIn, frame)
+
+	if len(l.lines) != 1 {
+		t.Fatalf("want tracing disabled, got %q", l.lines)
+	}
+}
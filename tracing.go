@@ -0,0 +1,232 @@
+package kite
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/koding/kite/protocol"
+)
+
+// SpanKind tells whether a span is of an outgoing call or of a handler.
+type SpanKind int
+
+const (
+	// SpanKindClient is the kind of the spans of outgoing calls.
+	SpanKindClient SpanKind = iota + 1
+
+	// SpanKindServer is the kind of the spans of handled calls.
+	SpanKindServer
+)
+
+// String implements the fmt.Stringer interface.
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindClient:
+		return "client"
+	case SpanKindServer:
+		return "server"
+	default:
+		return fmt.Sprintf("SpanKind(%d)", int(k))
+	}
+}
+
+// SpanContext identifies a span of a distributed trace. It is sent along
+// with the calls in the W3C Trace Context "traceparent" format, which is
+// understood by OpenTelemetry, Jaeger and other tracing systems.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid tells whether both the trace and the span IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent gives the span context in the "traceparent" format,
+// e.g. "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+var errTraceParent = errors.New("kite: invalid traceparent")
+
+// ParseTraceParent parses the span context in the "traceparent" format.
+func ParseTraceParent(s string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, errTraceParent
+	}
+
+	// Version 00 has exactly four fields, later ones may add more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, errTraceParent
+	}
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil || len(parts[1]) != 32 {
+		return SpanContext{}, errTraceParent
+	}
+
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil || len(parts[2]) != 16 {
+		return SpanContext{}, errTraceParent
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return SpanContext{}, errTraceParent
+	}
+
+	sc.Sampled = flags[0]&1 == 1
+
+	if !sc.IsValid() {
+		return SpanContext{}, errTraceParent
+	}
+
+	return sc, nil
+}
+
+type spanContextKey struct{}
+
+// WithSpanContext returns a copy of ctx that carries the given span context.
+// Calls made with Client.TellWithContext are sent as the children of
+// the span.
+func WithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx, which is
+// invalid if there is none. The Request.Context of a handler carries the
+// span of the caller, or the span started by the Tracer of the kite.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if ctx == nil {
+		return SpanContext{}
+	}
+
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// SpanInfo describes the span to start, see Tracer.
+type SpanInfo struct {
+	// Method is the name of the called method, it is meant to be used
+	// as the name of the span.
+	Method string
+
+	// Kind tells whether the call is outgoing or handled.
+	Kind SpanKind
+
+	// Remote is the remote kite, the callee of outgoing calls and
+	// the caller of handled ones.
+	Remote protocol.Kite
+
+	// RequestID is the ID of the handled request, see Request.ID.
+	// It is empty for outgoing calls.
+	RequestID string
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// End ends the span, the err is the error the call failed with.
+	End(err error)
+}
+
+// Tracer starts the spans of the outgoing calls and of the handlers of
+// the kite, see Kite.Tracer. It is the glue between the kite and a tracing
+// system, e.g. an adapter of OpenTelemetry, which exports the spans to
+// Jaeger or an OTLP collector, may look like:
+//
+//     func (t *otelTracer) StartSpan(ctx context.Context, info *kite.SpanInfo) (context.Context, kite.Span) {
+//         if sc := kite.SpanContextFromContext(ctx); sc.IsValid() {
+//             ctx = trace.ContextWithRemoteSpanContext(ctx, toOtel(sc))
+//         }
+//
+//         ctx, span := t.tracer.Start(ctx, info.Method, trace.WithSpanKind(toOtelKind(info.Kind)))
+//         return kite.WithSpanContext(ctx, fromOtel(span.SpanContext())), &otelSpan{span}
+//     }
+//
+// The span context carried by the ctx passed to StartSpan is the parent of
+// the span, if it is valid.
+type Tracer interface {
+	// StartSpan starts a span, the returned ctx must carry the context of
+	// the span, see WithSpanContext, which is sent to the remote kite.
+	StartSpan(ctx context.Context, info *SpanInfo) (context.Context, Span)
+}
+
+// startCallSpan starts the span of an outgoing call, the span is ended when
+// the response is sent to the returned channel.
+func (c *Client) startCallSpan(ctx context.Context, method string, responseChan chan *response) (context.Context, chan *response) {
+	t := c.LocalKite.Tracer
+	if t == nil {
+		return ctx, responseChan
+	}
+
+	c.m.RLock()
+	remote := c.Kite
+	c.m.RUnlock()
+
+	ctx, span := t.StartSpan(ctx, &SpanInfo{
+		Method: method,
+		Kind:   SpanKindClient,
+		Remote: remote,
+	})
+
+	spanChan := make(chan *response, 1)
+
+	go func() {
+		resp := <-spanChan
+		span.End(resp.Err)
+		responseChan <- resp
+	}()
+
+	return ctx, spanChan
+}
+
+// startHandlerSpan starts the span of the handled request, the span is
+// ended when the response is sent with the returned function.
+func (c *Client) startHandlerSpan(r *Request, callFunc func(interface{}, *Error)) func(interface{}, *Error) {
+	t := c.LocalKite.Tracer
+	if t == nil {
+		return callFunc
+	}
+
+	ctx, span := t.StartSpan(r.Context, &SpanInfo{
+		Method:    r.Method,
+		Kind:      SpanKindServer,
+		Remote:    r.Client.Kite,
+		RequestID: r.ID,
+	})
+
+	r.Context = ctx
+
+	return func(result interface{}, err *Error) {
+		// A nil *Error must not be passed as a non-nil error.
+		if err != nil {
+			span.End(err)
+		} else {
+			span.End(nil)
+		}
+
+		callFunc(result, err)
+	}
+}
+
+// traceParentFromContext gives the span context carried by ctx in
+// the "traceparent" format, or an empty string if there is none.
+func traceParentFromContext(ctx context.Context) string {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		return sc.TraceParent()
+	}
+
+	return ""
+}
@@ -0,0 +1,166 @@
+package kite
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/koding/kite/config"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := ParseTraceParent(tp)
+	if err != nil {
+		t.Fatalf("ParseTraceParent()=%s", err)
+	}
+
+	if !sc.IsValid() || !sc.Sampled {
+		t.Fatalf("want valid sampled span context, got %+v", sc)
+	}
+
+	if s := sc.TraceParent(); s != tp {
+		t.Fatalf("want %q, got %q", tp, s)
+	}
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-ff",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bz-01",
+	}
+
+	for _, s := range invalid {
+		if _, err := ParseTraceParent(s); err == nil {
+			t.Errorf("ParseTraceParent(%q): want error", s)
+		}
+	}
+}
+
+type recordSpan struct {
+	t      *recordTracer
+	info   SpanInfo
+	parent SpanContext
+	sc     SpanContext
+	err    error
+	ended  bool
+}
+
+type recordTracer struct {
+	mu    sync.Mutex
+	spans []*recordSpan
+}
+
+func (t *recordTracer) StartSpan(ctx context.Context, info *SpanInfo) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := &recordSpan{t: t, info: *info, parent: SpanContextFromContext(ctx)}
+
+	s.sc.TraceID = s.parent.TraceID
+	if !s.parent.IsValid() {
+		s.sc.TraceID[0] = byte(len(t.spans) + 1)
+	}
+	s.sc.SpanID[0] = byte(len(t.spans) + 1)
+
+	t.spans = append(t.spans, s)
+
+	return WithSpanContext(ctx, s.sc), s
+}
+
+// get gives the spans of the method, the internal calls made by
+// the clients, like kite.features, are recorded as well.
+func (t *recordTracer) get(method string) []recordSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var spans []recordSpan
+	for _, s := range t.spans {
+		if s.info.Method == method {
+			spans = append(spans, *s)
+		}
+	}
+
+	return spans
+}
+
+func (s *recordSpan) End(err error) {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+
+	s.err = err
+	s.ended = true
+}
+
+func TestKite_Tracer(t *testing.T) {
+	conf := config.New()
+	conf.DisableAuthentication = true
+
+	tr := &recordTracer{}
+
+	k := NewWithConfig("traced", "0.0.1", conf)
+	k.Tracer = tr
+	k.HandleFunc("parent", func(r *Request) (interface{}, error) {
+		return SpanContextFromContext(r.Context).TraceParent(), nil
+	})
+	k.HandleFunc("fail", func(r *Request) (interface{}, error) {
+		return nil, fmt.Errorf("failed")
+	})
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	e := New("exp", "0.0.1")
+	e.Tracer = tr
+
+	c := e.NewClient(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err := c.Dial(); err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer c.Close()
+
+	res, err := c.Tell("parent")
+	if err != nil {
+		t.Fatalf("Tell()=%s", err)
+	}
+
+	if _, err := c.Tell("fail"); err == nil {
+		t.Fatal("want error")
+	}
+
+	spans := tr.get("parent")
+	if len(spans) != 2 {
+		t.Fatalf("want 2 spans, got %d", len(spans))
+	}
+
+	client, server := spans[0], spans[1]
+
+	if client.info.Kind != SpanKindClient || server.info.Kind != SpanKindServer {
+		t.Fatalf("want client and server spans, got %s and %s", client.info.Kind, server.info.Kind)
+	}
+
+	if server.parent != client.sc {
+		t.Fatalf("want parent %+v, got %+v", client.sc, server.parent)
+	}
+
+	if s := res.MustString(); s != server.sc.TraceParent() {
+		t.Fatalf("want handler context %q, got %q", server.sc.TraceParent(), s)
+	}
+
+	for _, s := range append(spans, tr.get("fail")...) {
+		if !s.ended {
+			t.Fatalf("span %q of %s was not ended", s.info.Method, s.info.Kind)
+		}
+
+		if (s.info.Method == "fail") != (s.err != nil) {
+			t.Fatalf("span %q of %s: unexpected error %v", s.info.Method, s.info.Kind, s.err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package kite
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/sockjsclient"
+
+	"github.com/gorilla/websocket"
+	"github.com/igm/sockjs-go/sockjs"
+)
+
+// Transport opens connections to kites. A connection is represented with
+// a sockjs.Session, which carries the dnode messages, so transports other
+// than the built-in SockJS ones, like raw TCP or QUIC, can be plugged in
+// without touching the dnode layer.
+//
+// The transport used by a client is chosen in the following order:
+// Client.Transport, the transport registered for the scheme of the kite URL
+// with RegisterTransport and the built-in transport set with
+// Config.Transport.
+type Transport interface {
+	// Dial opens a connection to the kite with the given URL.
+	Dial(url string, conf *config.Config) (sockjs.Session, error)
+}
+
+// TransportFunc is a type adapter to allow the use of ordinary functions as
+// a Transport.
+type TransportFunc func(url string, conf *config.Config) (sockjs.Session, error)
+
+// Dial calls f(url, conf)
+func (f TransportFunc) Dial(url string, conf *config.Config) (sockjs.Session, error) {
+	return f(url, conf)
+}
+
+// Listener accepts connections from kites over transports other than the
+// built-in SockJS server, see Kite.ServeTransport.
+type Listener interface {
+	// Accept waits for and returns the next connection.
+	Accept() (sockjs.Session, error)
+
+	// Close stops accepting connections.
+	Close() error
+}
+
+// The built-in transports, see config.Transport.
+var (
+	// WebSocketTransport connects with SockJS over websocket.
+	WebSocketTransport Transport = TransportFunc(func(url string, conf *config.Config) (sockjs.Session, error) {
+		return sockjsclient.DialWebsocket(url, conf)
+	})
+
+	// XHRTransport connects with SockJS over XHR long-polling.
+	XHRTransport Transport = TransportFunc(func(url string, conf *config.Config) (sockjs.Session, error) {
+		return sockjsclient.DialXHR(url, conf)
+	})
+
+	// AutoTransport connects with SockJS over websocket, falling back to
+	// XHR long-polling when the kite is behind a proxy that does not
+	// support websocket connections.
+	AutoTransport Transport = TransportFunc(func(url string, conf *config.Config) (sockjs.Session, error) {
+		session, err := sockjsclient.DialWebsocket(url, conf)
+		if err == websocket.ErrBadHandshake {
+			return sockjsclient.DialXHR(url, conf)
+		}
+
+		return session, err
+	})
+)
+
+var (
+	transports   = make(map[string]Transport)
+	transportsMu sync.RWMutex
+)
+
+// RegisterTransport makes the transport used for dialing kites with URLs
+// of the given scheme, e.g. "tcp". It panics if a transport for the scheme
+// is already registered.
+func RegisterTransport(scheme string, t Transport) {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+
+	if t == nil {
+		panic("kite: RegisterTransport transport is nil")
+	}
+
+	if _, ok := transports[scheme]; ok {
+		panic("kite: RegisterTransport called twice for scheme " + scheme)
+	}
+
+	transports[scheme] = t
+}
+
+// ServeTransport serves the connections accepted by the listener, the same
+// way the ones made over the SockJS server are served. It blocks until the
+// listener fails, e.g. because it was closed, returning the error.
+func (k *Kite) ServeTransport(l Listener) error {
+	for {
+		session, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go k.sockjsHandler(session)
+	}
+}
+
+// transport returns the transport to dial the kite with.
+func (c *Client) transport() (Transport, error) {
+	if c.Transport != nil {
+		return c.Transport, nil
+	}
+
+	return transportFor(c.URL, c.config())
+}
+
+// transportFor returns the transport registered for the scheme of the URL,
+// or the built-in one set with conf.Transport.
+func transportFor(rawurl string, conf *config.Config) (Transport, error) {
+	if u, err := url.Parse(rawurl); err == nil {
+		transportsMu.RLock()
+		t, ok := transports[u.Scheme]
+		transportsMu.RUnlock()
+
+		if ok {
+			return t, nil
+		}
+	}
+
+	switch transport := conf.Transport; transport {
+	case config.WebSocket:
+		return WebSocketTransport, nil
+	case config.XHRPolling:
+		return XHRTransport, nil
+	case config.Auto:
+		return AutoTransport, nil
+	default:
+		return nil, fmt.Errorf("Connection transport is not known '%v'", transport)
+	}
+}
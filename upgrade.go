@@ -0,0 +1,180 @@
+package kite
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// UpgradePolicy restricts the HTTP requests, which open SockJS connections
+// to the kite, e.g. for kites called by browsers, see SetUpgradePolicy.
+//
+//     k.SetUpgradePolicy(&kite.UpgradePolicy{
+//         AllowedOrigins: []string{"https://example.com", "https://*.example.com"},
+//         AllowedHeaders: []string{"X-Forwarded-For", "X-Request-Id"},
+//     })
+type UpgradePolicy struct {
+	// AllowedOrigins are the origins of the pages allowed to connect,
+	// they can be patterns with the syntax of path.Match, "*" allows all
+	// of them. The origins are compared case-insensitively.
+	//
+	// If empty, all the origins are allowed.
+	AllowedOrigins []string
+
+	// RequireOrigin rejects the requests without the Origin header. By
+	// default they are allowed, as kites and other non-browser clients
+	// do not send it.
+	RequireOrigin bool
+
+	// AllowedHeaders are the names of the headers the requests can carry,
+	// in addition to the standard ones, like Cookie, User-Agent or the
+	// websocket handshake headers. The headers added by the proxies in
+	// front of the kite, like X-Forwarded-For, must be allowed as well.
+	//
+	// If empty, all the headers are allowed.
+	AllowedHeaders []string
+}
+
+// standardHeaders are the request headers allowed regardless of
+// UpgradePolicy.AllowedHeaders. The headers starting with "Sec-" are set
+// by browsers only and are always allowed too.
+var standardHeaders = map[string]bool{
+	"Accept":            true,
+	"Accept-Encoding":   true,
+	"Accept-Language":   true,
+	"Cache-Control":     true,
+	"Connection":        true,
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Cookie":            true,
+	"Dnt":               true,
+	"Host":              true,
+	"Origin":            true,
+	"Pragma":            true,
+	"Referer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	"User-Agent":        true,
+}
+
+func (p *UpgradePolicy) allowedOrigin(origin string) bool {
+	return len(p.AllowedOrigins) == 0 || matchOrigin(p.AllowedOrigins, origin)
+}
+
+// matchOrigin tells whether the origin matches any of the patterns.
+func matchOrigin(patterns []string, origin string) bool {
+	origin = strings.ToLower(origin)
+
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			return true
+		}
+
+		if ok, _ := path.Match(strings.ToLower(pattern), origin); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *UpgradePolicy) allowedHeader(name string) bool {
+	if len(p.AllowedHeaders) == 0 {
+		return true
+	}
+
+	name = http.CanonicalHeaderKey(name)
+
+	if standardHeaders[name] || strings.HasPrefix(name, "Sec-") {
+		return true
+	}
+
+	for _, allowed := range p.AllowedHeaders {
+		if http.CanonicalHeaderKey(allowed) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check returns a non-nil error if the request is not allowed by
+// the policy.
+func (p *UpgradePolicy) Check(req *http.Request) error {
+	origin := req.Header.Get("Origin")
+
+	if origin == "" {
+		if p.RequireOrigin {
+			return errors.New("missing Origin header")
+		}
+	} else if !p.allowedOrigin(origin) {
+		return fmt.Errorf("origin %q is not allowed", origin)
+	}
+
+	for name := range req.Header {
+		if !p.allowedHeader(name) {
+			return fmt.Errorf("header %q is not allowed", name)
+		}
+	}
+
+	return nil
+}
+
+// SetUpgradePolicy restricts the requests, which open connections to
+// the kite over SockJS, the other requests are rejected with
+// the 403 Forbidden status. A nil policy removes the restrictions.
+//
+// The connections accepted with ServeTransport are not restricted.
+func (k *Kite) SetUpgradePolicy(p *UpgradePolicy) {
+	k.upgradeMu.Lock()
+	k.upgradePolicy = p
+	k.upgradeMu.Unlock()
+}
+
+// ValidateUpgrade adds a function, which tells whether the request opening
+// a SockJS connection is allowed, by returning a nil error. The requests are
+// rejected if any of the functions or the policy of the kite rejects them,
+// the message of the error is sent in the response.
+func (k *Kite) ValidateUpgrade(fn func(*http.Request) error) {
+	k.upgradeMu.Lock()
+	k.upgradeValidators = append(k.upgradeValidators, fn)
+	k.upgradeMu.Unlock()
+}
+
+// checkUpgrade checks the request against the upgrade policy and
+// the validators of the kite.
+func (k *Kite) checkUpgrade(req *http.Request) error {
+	k.upgradeMu.RLock()
+	policy, validators := k.upgradePolicy, k.upgradeValidators
+	k.upgradeMu.RUnlock()
+
+	if policy != nil {
+		if err := policy.Check(req); err != nil {
+			return err
+		}
+	}
+
+	for _, fn := range validators {
+		if err := fn(req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// upgradeHandler rejects the requests not allowed by checkUpgrade before
+// they reach the SockJS handler.
+func (k *Kite) upgradeHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := k.checkUpgrade(req); err != nil {
+			k.Log.Debug("Rejected connection from %s: %s", req.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,102 @@
+package kite
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpgradePolicy(t *testing.T) {
+	p := &UpgradePolicy{
+		AllowedOrigins: []string{"https://example.com", "https://*.Example.org"},
+		AllowedHeaders: []string{"x-request-id"},
+	}
+
+	cases := []struct {
+		origin string
+		header string
+		ok     bool
+	}{
+		{"", "", true},
+		{"https://example.com", "", true},
+		{"https://EXAMPLE.com", "", true},
+		{"https://app.example.org", "", true},
+		{"http://example.com", "", false},
+		{"https://example.com.evil.io", "", false},
+		{"https://example.com", "X-Request-Id", true},
+		{"https://example.com", "Sec-Websocket-Key", true},
+		{"https://example.com", "X-Custom", false},
+	}
+
+	for _, cas := range cases {
+		req := httptest.NewRequest("GET", "/kite/websocket", nil)
+		if cas.origin != "" {
+			req.Header.Set("Origin", cas.origin)
+		}
+		if cas.header != "" {
+			req.Header.Set(cas.header, "1")
+		}
+
+		if err := p.Check(req); (err == nil) != cas.ok {
+			t.Errorf("Check(%q, %q)=%v, want ok=%t", cas.origin, cas.header, err, cas.ok)
+		}
+	}
+
+	p = &UpgradePolicy{RequireOrigin: true}
+
+	if err := p.Check(httptest.NewRequest("GET", "/kite", nil)); err == nil {
+		t.Fatal("want request without origin to be rejected")
+	}
+}
+
+func TestKite_ValidateUpgrade(t *testing.T) {
+	k := New("testkite", "0.0.1")
+	defer k.Close()
+
+	serve := func(origin string) int {
+		req := httptest.NewRequest("GET", "/kite/info", nil)
+		req.Header.Set("Origin", origin)
+
+		rec := httptest.NewRecorder()
+		k.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	if code := serve("https://evil.io"); code == http.StatusForbidden {
+		t.Fatal("want requests to be allowed without a policy")
+	}
+
+	k.SetUpgradePolicy(&UpgradePolicy{AllowedOrigins: []string{"https://example.com"}})
+
+	if code := serve("https://evil.io"); code != http.StatusForbidden {
+		t.Fatalf("got %d, want %d", code, http.StatusForbidden)
+	}
+
+	if code := serve("https://example.com"); code == http.StatusForbidden {
+		t.Fatal("want request from allowed origin to be allowed")
+	}
+
+	k.ValidateUpgrade(func(req *http.Request) error {
+		if req.URL.Query().Get("token") == "" {
+			return errors.New("missing token")
+		}
+
+		return nil
+	})
+
+	if code := serve("https://example.com"); code != http.StatusForbidden {
+		t.Fatalf("got %d, want %d", code, http.StatusForbidden)
+	}
+
+	k.SetUpgradePolicy(nil)
+
+	req := httptest.NewRequest("GET", "/kite/info?token=x", nil)
+	rec := httptest.NewRecorder()
+	k.ServeHTTP(rec, req)
+
+	if rec.Code == http.StatusForbidden {
+		t.Fatal("want validated request to be allowed")
+	}
+}
@@ -0,0 +1,280 @@
+package kite
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koding/kite/protocol"
+	uuid "github.com/satori/go.uuid"
+)
+
+// versionRetryInterval is the time after which registering an additional
+// version of the kite is retried, when Kontrol could not be reached.
+var versionRetryInterval = 30 * time.Second
+
+// KiteVersion is an additional version of the kite served by the same
+// process, see Kite.AddVersion.
+type KiteVersion struct {
+	kite    *Kite
+	version string
+
+	mu          sync.Mutex
+	url         string        // URL the version is registered with
+	registering bool          // whether the renewal loop is running
+	stop        chan struct{} // stops the renewal loop
+}
+
+// AddVersion makes the kite serve the given version in addition to its own,
+// e.g. during a migration to a new version, which needs to be served next
+// to the old one for a while. Once the kite registers, the version is
+// registered with Kontrol as well, under the same name and URL, so callers
+// can query for either version.
+//
+// Calls of the callers, which queried for the version, are served by the
+// handlers registered for the version with KiteVersion.Handle. The methods
+// without such handlers are served by the handlers of the kite.
+func (k *Kite) AddVersion(version string) *KiteVersion {
+	if digits := strings.Split(version, "."); len(digits) != 3 {
+		panic("kite: version must be 3-digits semantic version")
+	}
+
+	if version == k.version {
+		panic(fmt.Sprintf("kite: version %s is the version of the kite", version))
+	}
+
+	k.versionsMu.Lock()
+	defer k.versionsMu.Unlock()
+
+	if v, ok := k.versions[version]; ok {
+		return v
+	}
+
+	if k.versions == nil {
+		k.versions = make(map[string]*KiteVersion)
+	}
+
+	v := &KiteVersion{
+		kite:    k,
+		version: version,
+		stop:    make(chan struct{}),
+	}
+
+	k.versions[version] = v
+
+	return v
+}
+
+// Versions returns the versions added with AddVersion, from the oldest
+// to the latest one.
+func (k *Kite) Versions() []*KiteVersion {
+	k.versionsMu.Lock()
+	defer k.versionsMu.Unlock()
+
+	versions := make([]*KiteVersion, 0, len(k.versions))
+	for _, v := range k.versions {
+		versions = append(versions, v)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versionLess(versions[i].version, versions[j].version)
+	})
+
+	return versions
+}
+
+// Version returns the version.
+func (v *KiteVersion) Version() string {
+	return v.version
+}
+
+// Kite returns the definition the version is registered with. It differs
+// from the one of the kite by the version and the ID, which is derived
+// from the ID of the kite.
+func (v *KiteVersion) Kite() *protocol.Kite {
+	kite := v.kite.Kite()
+	kite.Version = v.version
+	kite.ID = uuid.NewV5(uuid.NamespaceOID, kite.ID+"\n"+v.version).String()
+
+	return kite
+}
+
+// Handle registers the handler of the method for the version.
+func (v *KiteVersion) Handle(method string, handler Handler) *Method {
+	k := v.kite
+
+	k.methodsMu.Lock()
+	defer k.methodsMu.Unlock()
+
+	base, ok := k.handlers[method]
+	if !ok {
+		base = &Method{name: method}
+		k.handlers[method] = base
+	}
+
+	m := k.newMethod(method, handler)
+
+	if base.kiteVersions == nil {
+		base.kiteVersions = make(map[string]*Method)
+	}
+
+	base.kiteVersions[v.version] = m
+
+	return m
+}
+
+// HandleFunc is the same as Handle. It accepts a HandlerFunc.
+func (v *KiteVersion) HandleFunc(method string, handler HandlerFunc) *Method {
+	return v.Handle(method, handler)
+}
+
+// resolveKiteVersion gives the implementation of the method, which serves
+// the version of the kite the caller queried for.
+func (m *Method) resolveKiteVersion(r *Request) (*Method, *Error) {
+	if v, ok := m.kiteVersions[r.KiteVersion]; ok {
+		return v, nil
+	}
+
+	// Versions which are not served are handled by the kite itself.
+	r.KiteVersion = r.LocalKite.version
+
+	if m.handler == nil && len(m.versions) == 0 {
+		return nil, &Error{
+			Type:      "methodNotFound",
+			Message:   fmt.Sprintf("method %q is not served by version %s", m.name, r.KiteVersion),
+			RequestID: r.ID,
+		}
+	}
+
+	return m, nil
+}
+
+// registerVersions registers the versions added with AddVersion with
+// the URL the kite was registered with.
+func (k *Kite) registerVersions(rr *protocol.RegisterResult) {
+	for _, v := range k.Versions() {
+		v.register(rr.URL)
+	}
+}
+
+// register registers the version with the given URL, either with Kontrol
+// or locally. The registration with Kontrol is renewed for as long as
+// the kite runs.
+func (v *KiteVersion) register(kiteURL string) {
+	k := v.kite
+
+	if k.Config.LocalMode {
+		k.local.mu.Lock()
+		k.local.add(*v.Kite(), kiteURL)
+		k.local.mu.Unlock()
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.url = kiteURL
+
+	if !v.registering {
+		v.registering = true
+		go v.renew(v.stop)
+	}
+}
+
+func (v *KiteVersion) renew(stop <-chan struct{}) {
+	k := v.kite
+
+	for {
+		v.mu.Lock()
+		kiteURL := v.url
+		v.mu.Unlock()
+
+		interval := versionRetryInterval
+
+		u, err := url.Parse(kiteURL)
+		if err == nil {
+			var res *registerResult
+
+			if res, err = k.postRegisterKite(v.Kite(), u); err == nil {
+				k.Log.Debug("Registered version %s with URL: %s", v.version, kiteURL)
+				interval = res.heartbeat
+			}
+		}
+
+		if err != nil {
+			k.Log.Error("Cannot register version %s to Kontrol: %s", v.version, err)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-stop:
+			return
+		case <-k.closeC:
+			return
+		}
+	}
+}
+
+// unregisterVersions stops renewing the registrations of the versions and
+// unregisters them with the given function.
+func (k *Kite) unregisterVersions(unregister func(*protocol.Kite) error) error {
+	for _, v := range k.Versions() {
+		registered := v.stopRenewing()
+
+		if k.Config.LocalMode {
+			k.local.mu.Lock()
+			k.local.remove(*v.Kite())
+			k.local.mu.Unlock()
+			continue
+		}
+
+		if !registered {
+			continue
+		}
+
+		if err := unregister(v.Kite()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stopVersions stops renewing the registrations of the versions.
+func (k *Kite) stopVersions() {
+	for _, v := range k.Versions() {
+		v.stopRenewing()
+	}
+}
+
+// stopRenewing stops the renewal loop, it tells whether it was running.
+func (v *KiteVersion) stopRenewing() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !v.registering {
+		return false
+	}
+
+	close(v.stop)
+	v.stop = make(chan struct{})
+	v.registering = false
+
+	return true
+}
+
+// remoteVersion gives the version of the remote kite the client was made
+// for, it is sent with the calls, so they are served by the version.
+func (c *Client) remoteVersion() string {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	if !c.dialed {
+		return ""
+	}
+
+	return c.Kite.Version
+}
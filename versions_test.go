@@ -0,0 +1,107 @@
+package kite
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/koding/kite/config"
+	"github.com/koding/kite/protocol"
+)
+
+func TestKite_AddVersion(t *testing.T) {
+	conf := config.New()
+	conf.DisableAuthentication = true
+	conf.LocalMode = true
+
+	k := NewWithConfig("math", "1.0.0", conf)
+
+	k.HandleFunc("version", func(r *Request) (interface{}, error) {
+		return "old " + r.KiteVersion, nil
+	})
+	k.HandleFunc("shared", func(r *Request) (interface{}, error) {
+		return "shared " + r.KiteVersion, nil
+	})
+
+	v := k.AddVersion("2.0.0")
+
+	v.HandleFunc("version", func(r *Request) (interface{}, error) {
+		return "new " + r.KiteVersion, nil
+	})
+	v.HandleFunc("added", func(r *Request) (interface{}, error) {
+		return "added " + r.KiteVersion, nil
+	})
+
+	if id := v.Kite().ID; id == k.Id || id != k.AddVersion("2.0.0").Kite().ID {
+		t.Fatalf("want stable ID of the version distinct from %q, got %q", k.Id, id)
+	}
+
+	go k.Run()
+	defer k.Close()
+	<-k.ServerReadyNotify()
+
+	u, err := url.Parse(fmt.Sprintf("http://127.0.0.1:%d/kite", k.Port()))
+	if err != nil {
+		t.Fatalf("Parse()=%s", err)
+	}
+
+	if _, err := k.Register(u); err != nil {
+		t.Fatalf("Register()=%s", err)
+	}
+
+	cases := []struct {
+		version string
+		method  string
+		want    string
+	}{
+		{"1.0.0", "version", "old 1.0.0"},
+		{"1.0.0", "shared", "shared 1.0.0"},
+		{"1.0.0", "added", ""},
+		{"2.0.0", "version", "new 2.0.0"},
+		{"2.0.0", "shared", "shared 1.0.0"},
+		{"2.0.0", "added", "added 2.0.0"},
+	}
+
+	for _, cas := range cases {
+		clients, err := k.GetKites(&protocol.KontrolQuery{Name: "math", Version: cas.version})
+		if err != nil {
+			t.Fatalf("%s: GetKites()=%s", cas.version, err)
+		}
+
+		if len(clients) != 1 || clients[0].Kite.Version != cas.version {
+			t.Fatalf("%s: got %d clients, want one of the version", cas.version, len(clients))
+		}
+
+		c := clients[0]
+
+		if err := c.Dial(); err != nil {
+			t.Fatalf("%s: Dial()=%s", cas.version, err)
+		}
+
+		res, err := c.Tell(cas.method)
+		c.Close()
+
+		if cas.want == "" {
+			if e, ok := err.(*Error); !ok || e.Type != "methodNotFound" {
+				t.Fatalf("%s: %s: got %v, want methodNotFound error", cas.version, cas.method, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: %s: Tell()=%s", cas.version, cas.method, err)
+		}
+
+		if s := res.MustString(); s != cas.want {
+			t.Fatalf("%s: %s: got %q, want %q", cas.version, cas.method, s, cas.want)
+		}
+	}
+
+	if err := k.Unregister(); err != nil {
+		t.Fatalf("Unregister()=%s", err)
+	}
+
+	if _, err := k.GetKites(&protocol.KontrolQuery{Name: "math"}); err != ErrNoKitesAvailable {
+		t.Fatalf("got %v, want %v after unregistering", err, ErrNoKitesAvailable)
+	}
+}